@@ -0,0 +1,78 @@
+// receval 是推荐策略的离线评估工具：按时间留出每位用户最后看过的几部，
+// 用当前的推荐代码重新推荐，报告 recall@K、NDCG@K、覆盖率和新颖度。
+//
+// 它不是网站的一部分，调整推荐权重前后各跑一次对比结果。评估在一个回滚的事务里进行，
+// 但会在事务期间锁住被留出的行，只应对测试库或本地导入的副本运行。
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	platformconfig "github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/TwoThreeWang/Moovie/new/internal/recommendation"
+)
+
+// main 解析参数、连库评估，按表格或 JSON 输出。
+func main() {
+	dsn := flag.String("dsn", strings.TrimSpace(os.Getenv("RECEVAL_DSN")), "PostgreSQL DSN；留空时读 -env")
+	envPath := flag.String("env", ".env.local", "包含数据库配置的 .env，和测试库用同一份")
+	k := flag.Int("k", 20, "每位用户推荐的影片数")
+	holdOut := flag.Int("holdout", 1, "每位用户留出的最后几部看过的作品")
+	minHistory := flag.Int("min-history", 3, "留出后至少剩下的看过作品数")
+	maxUsers := flag.Int("users", 500, "参与评估的用户数上限，0 表示全部")
+	collaborative := flag.Bool("collaborative", true, "重算共现表并评估协同过滤和混合排序")
+	format := flag.String("format", "table", "输出格式：table 或 json")
+	timeout := flag.Duration("timeout", 30*time.Minute, "评估超时")
+	flag.Parse()
+	if *format != "table" && *format != "json" {
+		fatalf("-format 只能是 table 或 json")
+	}
+
+	if strings.TrimSpace(*dsn) == "" {
+		cfg, err := platformconfig.DatabaseConfigFromDotEnv(*envPath)
+		if err != nil {
+			fatalf("读取数据库 env 失败: %v", err)
+		}
+		*dsn = cfg.DSN()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	pool, err := database.Connect(ctx, *dsn, 1)
+	if err != nil {
+		fatalf("连接数据库失败: %v", err)
+	}
+	defer pool.Close()
+
+	report, err := recommendation.Evaluate(ctx, pool, recommendation.EvaluationOptions{
+		HoldOut: *holdOut, K: *k, MinHistory: *minHistory, MaxUsers: *maxUsers, Collaborative: *collaborative,
+	})
+	if err != nil {
+		fatalf("评估失败: %v", err)
+	}
+	if *format == "json" {
+		encoded, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(encoded))
+		return
+	}
+	fmt.Printf("用户 %d 位，每人留出 %d 部，K=%d，全库 %d 部\n\n", report.Users, report.HoldOut, report.K, report.CatalogSize)
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "strategy\trecall@%d\tndcg@%d\tcoverage\tnovelty\t\n", report.K, report.K)
+	for _, strategy := range report.Strategies {
+		fmt.Fprintf(table, "%s\t%.4f\t%.4f\t%.4f\t%.2f\t\n", strategy.Strategy, strategy.Recall, strategy.NDCG, strategy.Coverage, strategy.Novelty)
+	}
+	_ = table.Flush()
+}
+
+// fatalf 打印错误并退出。
+func fatalf(format string, arguments ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", arguments...)
+	os.Exit(1)
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/TwoThreeWang/Moovie/new/internal/identity"
 	"github.com/TwoThreeWang/Moovie/new/internal/library"
 	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
 	"github.com/TwoThreeWang/Moovie/new/internal/operations"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
@@ -44,7 +45,7 @@ import (
 
 // contentPages 列出需要与共享 layout、partial 一起解析的页面模板。
 // 显式维护清单可以让模板缺失或重名在启动阶段暴露，而不是等用户访问时才报错。
-var contentPages = []string{"home", "search", "trends", "about", "advertise", "changelog", "dmca", "copyright_restricted", "privacy", "terms", "404", "player", "player_embed", "iptv", "tvbox", "play", "watch", "login", "register", "dashboard", "settings", "movie", "fetching", "recommendations", "foryou", "share", "share_monthly", "cinema", "feedback", "admin_feedback", "discover", "admin_dashboard", "admin_users", "admin_sites", "admin_cache", "admin_copyright", "admin_category", "admin_matches", "admin_jobs"}
+var contentPages = []string{"home", "search", "trends", "about", "advertise", "changelog", "dmca", "copyright_restricted", "privacy", "terms", "404", "player", "player_embed", "iptv", "tvbox", "play", "watch", "login", "register", "dashboard", "settings", "movie", "fetching", "person", "collection", "recommendations", "foryou", "together", "share", "share_monthly", "cinema", "feedback", "admin_feedback", "discover", "admin_dashboard", "admin_users", "admin_sites", "admin_cache", "admin_copyright", "admin_category", "admin_matches", "admin_jobs", "admin_playback_qoe", "admin_media", "admin_duplicates", "notifications"}
 
 // discoverPopularAdapter 把播放域的热门结果转换成发现页需要的轻量结构。
 type discoverPopularAdapter struct{ provider playback.PopularProvider }
@@ -150,8 +151,11 @@ func main() {
 	queueStore = workqueue.NewPostgresStore(databasePool)
 	doubanJobStore = douban.NewQueueJobStore(queueStore)
 	reportStore = report.NewPostgresStore(databasePool)
-	socialStore = social.NewPostgresStore(databasePool)
-	feedbackStore = feedback.NewPostgresStore(databasePool)
+	postgresSocialStore := social.NewPostgresStore(databasePool)
+	socialStore = postgresSocialStore
+	postgresFeedbackStore := feedback.NewPostgresStore(databasePool)
+	feedbackStore = postgresFeedbackStore
+	notificationStore := notifications.NewPostgresStore(databasePool)
 	danmakuStore = danmaku.NewPostgresStore(databasePool)
 	readiness = databasePool.Ping
 	// ── 阶段 3：进程级共享组件（HTTP Client、搜索并发控制、熔断器）───
@@ -163,42 +167,67 @@ func main() {
 	aiClient := outbound.NewClient(cfg.Catalog.AITimeout, 4)                                  // AI（向量化）专用 Client，超时比资源站长
 	sourceCrawler := search.NewAppleCMSCrawler(sourceClient)                                  // 苹果 CMS 采集器
 	// ── 阶段 4：Service 层（业务逻辑）──────────────────────────────
-	// 数据提供者：豆瓣（抓取影片元数据、短评）和 TMDB（剧照、英文信息）。
+	// 数据提供者：豆瓣（抓取影片元数据、短评）、TMDB（剧照、英文信息）和 Bangumi（动画分集）。
 	// 抓取到的元数据会通过 canonicalStore 写入 media_identity 表建立规范映射。
 	doubanOptions := []catalog.DoubanOption{catalog.WithDoubanRequestInterval(cfg.Catalog.DoubanRequestInterval)}
 	tmdbOptions := []catalog.TMDBOption{}
+	bangumiOptions := []catalog.BangumiOption{}
 	if canonicalStore != nil {
 		doubanOptions = append(doubanOptions, catalog.WithDoubanCanonicalWriter(canonicalStore))
 		tmdbOptions = append(tmdbOptions, catalog.WithTMDBCanonicalWriter(canonicalStore))
+		bangumiOptions = append(bangumiOptions, catalog.WithBangumiCanonicalWriter(canonicalStore))
 		if unitWriter, ok := canonicalStore.(catalog.MediaUnitWriter); ok {
 			tmdbOptions = append(tmdbOptions, catalog.WithTMDBMediaUnitWriter(unitWriter))
+			bangumiOptions = append(bangumiOptions, catalog.WithBangumiMediaUnitWriter(unitWriter))
 		}
 	}
 	doubanProvider := catalog.NewDoubanProvider(sourceClient, catalogStore, doubanOptions...)
 	doubanClient := douban.NewClient(sourceClient)
 	doubanService := douban.NewService(doubanClient, libraryStore, doubanJobStore) // 豆瓣标记同步（想看/已看导入）
-	reportService := report.NewService(reportStore, libraryStore, catalogStore)    // 月度观影报告
-	doubanTaskHandler := douban.NewTaskHandler(doubanJobStore, doubanUserStore, doubanService, douban.WithMonthlyGenerator(reportService))
+	// 站内通知：收件箱 + 邮件/Webhook。点赞、回复发生在请求里，外发渠道放到后台，不拖慢请求。
+	notifier := notifications.NewService(notificationStore, notifications.WithPreferences(notificationStore), notifications.WithDirectory(notificationStore),
+		notifications.WithBackgroundDelivery(), notifications.WithChannels(notifications.ConfiguredChannels(cfg, sourceClient)...))
+	reportService := report.NewService(reportStore, libraryStore, catalogStore, report.WithNotifier(notifier)) // 月度观影报告
+	doubanTaskHandler := douban.NewTaskHandler(doubanJobStore, doubanUserStore, doubanService, douban.WithMonthlyGenerator(reportService), douban.WithNotifier(notifier))
 	metricsStore := operations.NewMetricsStore(nil)
 	if databasePool != nil {
 		metricsStore = operations.NewMetricsStore(databasePool)
 	}
-	operationsService := operations.NewService(operationsStore, // 运维服务：定期清理过期任务、遥测、同步事件
+	operationsOptions := []operations.ServiceOption{
 		operations.WithJobQueueCleanup(metricsStore.DeleteExpiredJobs),
 		operations.WithTelemetryCleanup(metricsStore.DeleteExpiredTelemetry),
-		operations.WithSyncEventCleanup(postgresHistory.DeleteExpiredSyncEvents))
+		operations.WithSyncEventCleanup(postgresHistory.DeleteExpiredSyncEvents),
+		operations.WithNotificationCleanup(notificationStore.DeleteExpired),
+		operations.WithPlaybackStateReset(notificationStore.ResetLapsedPlaybackStates),
+	}
+	var imageCache *catalog.ImageCache // 图片代理磁盘缓存，未配置目录时为 nil，图片代理直连透传
+	if cfg.ImageCache.Dir != "" {
+		if imageCache, err = catalog.NewImageCache(cfg.ImageCache.Dir, cfg.ImageCache.MaxBytes); err != nil {
+			slog.Warn("image cache disabled", "error", err)
+		} else {
+			operationsOptions = append(operationsOptions, operations.WithImageCacheCleanup(imageCache.Trim))
+		}
+	}
+	operationsService := operations.NewService(operationsStore, operationsOptions...) // 运维服务：定期清理过期任务、遥测、同步事件、站内通知、图片缓存
 	tmdbProvider := catalog.NewTMDBProvider(sourceClient, catalogStore, cfg.Catalog.TMDBToken, tmdbOptions...)
-	embeddingService := catalog.NewEmbeddingService(sourceClient, catalogStore, catalog.EmbeddingConfig{ // 向量化服务（相似推荐用）
+	bangumiProvider := catalog.NewBangumiProvider(sourceClient, catalogStore, cfg.Catalog.BangumiUserAgent, bangumiOptions...)
+	embeddingConfig := catalog.EmbeddingConfig{
+		Provider: cfg.Catalog.EmbeddingProvider, Model: cfg.Catalog.EmbeddingModel, Dimensions: cfg.Catalog.EmbeddingDimensions,
+		APIURL: cfg.Catalog.EmbeddingAPIURL, APIKey: cfg.Catalog.EmbeddingAPIKey,
 		OllamaHost: cfg.Catalog.OllamaHost, OllamaModel: cfg.Catalog.OllamaModel,
 		CFGatewayURL: cfg.Catalog.CFGatewayURL, CFAPIToken: cfg.Catalog.CFAPIToken,
 		CFAIModel: cfg.Catalog.CFAIModel,
-	}, catalog.WithEmbeddingAIClient(aiClient))
-	// 元数据刷新：豆瓣抓基本信息 → 补短评 → TMDB 补剧照 → 向量化，四步串行，由后台任务驱动。
+	}
+	embeddingService := catalog.NewEmbeddingService(sourceClient, catalogStore, embeddingConfig, catalog.WithEmbeddingAIClient(aiClient)) // 向量化服务（相似推荐用）
+	// 元数据刷新：豆瓣抓基本信息 → 补短评 → TMDB 补剧照（动画再走 Bangumi 补分集）→ 向量化、算海报占位色，由后台任务驱动。
 	var metadataRefreshHandler *catalog.RefreshHandler
 	if metadataRefreshJobs != nil {
-		refreshOptions := []catalog.RefreshHandlerOption{catalog.WithRefreshReviews(doubanProvider)}
+		refreshOptions := []catalog.RefreshHandlerOption{catalog.WithRefreshReviews(doubanProvider), catalog.WithRefreshBangumi(bangumiProvider)}
 		if cfg.Catalog.TMDBToken != "" {
-			refreshOptions = append(refreshOptions, catalog.WithRefreshBackdrops(tmdbProvider))
+			refreshOptions = append(refreshOptions, catalog.WithRefreshBackdrops(tmdbProvider), catalog.WithRefreshMediaMetadata(tmdbProvider))
+		}
+		if paletteStore, ok := metadataRefreshJobs.(catalog.ImagePaletteStore); ok {
+			refreshOptions = append(refreshOptions, catalog.WithRefreshImagePalette(catalog.NewImagePaletteService(sourceClient, paletteStore)))
 		}
 		metadataRefreshHandler = catalog.NewRefreshHandler(metadataRefreshJobs, doubanProvider, embeddingService, refreshOptions...)
 	}
@@ -254,6 +283,8 @@ func main() {
 		}
 		return items, nil
 	}))
+	// 语义搜索复用相似推荐的向量服务，搜索词和库里的向量出自同一个模型。
+	unifiedOptions = append(unifiedOptions, search.WithSemanticSearch(embeddingService))
 	unifiedSearchService := search.NewUnifiedSearchService(searchService, unifiedOptions...)
 	searchHandler := search.NewHandler(
 		cfg,
@@ -276,9 +307,12 @@ func main() {
 	popularityRefresher := playback.NewPopularityRefresher(snapshotStore,
 		playback.NewCompositePopularProvider(popularSources...), siteTrendingSource, 24*time.Hour)
 	popularProvider := playback.PopularProvider(snapshotStore)
-	recommendationService := recommendation.NewService(catalogStore, recommendation.WithPersonalizer(postgresCatalogStore))
+	cooccurrenceStore := recommendation.NewCooccurrenceStore(databasePool)
+	recommendationService := recommendation.NewService(catalogStore, recommendation.WithPersonalizer(postgresCatalogStore),
+		recommendation.WithCollaborative(cooccurrenceStore), recommendation.WithLibrary(libraryStore))
 	recommendationSnapshots := recommendation.NewSnapshotStore(databasePool)
 	recommendationRefresher := recommendation.NewRefresher(recommendationSnapshots, recommendationService)
+	recommendationDigests := recommendation.NewDigestStore(databasePool) // 每周「本周上新」
 	// ── 阶段 5（可选）：内嵌后台任务 ───────────────────────────────
 	// 生产环境后台任务由独立的 cmd/worker 进程跑，但本地开发时开启 JOBS_IN_WEB
 	// 可以把 worker 也跑在 web 进程里，省得同时启两个进程。
@@ -293,7 +327,9 @@ func main() {
 		workerDispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: operations.TaskCleanup, SubjectKey: "global", Reason: "scheduled"}, Interval: 24 * time.Hour})
 		workerDispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: operations.TaskHealthCheck, SubjectKey: "global", Reason: "scheduled"}, Interval: time.Hour, InitialDelay: time.Hour})
 		if metadataRefreshHandler != nil {
-			for _, taskType := range []string{catalog.RefreshProviderDouban, catalog.RefreshProviderReviews, catalog.RefreshProviderTMDB, catalog.RefreshProviderEmbedding} {
+			for _, taskType := range []string{catalog.RefreshProviderDouban, catalog.RefreshProviderReviews, catalog.RefreshProviderTMDB, catalog.RefreshProviderEmbedding,
+				catalog.RefreshProviderBangumi, catalog.RefreshProviderTMDBMetadata, catalog.RefreshProviderTMDBImport, catalog.RefreshProviderMediaEmbedding,
+				catalog.RefreshProviderImagePalette} {
 				workerDispatcher.Handle(taskType, 10*time.Minute, metadataRefreshHandler.Handle)
 			}
 			workerDispatcher.Handle("metadata_schedule", 2*time.Minute, metadataRefreshHandler.Schedule)
@@ -307,11 +343,27 @@ func main() {
 				workerDispatcher.Handle(catalog.TaskIMDbBackfill, 5*time.Minute, imdbBackfill.Handle)
 				workerDispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: catalog.TaskIMDbBackfill, SubjectKey: "global", Reason: "scheduled"}, Interval: time.Minute, InitialDelay: 30 * time.Second})
 			}
+			// 向量重建同理，只有 Postgres 存储有代际表和临时列可用。
+			if migrationStore, ok := catalogStore.(catalog.EmbeddingMigrationStore); ok {
+				if embedder, err := catalog.NewEmbedder(sourceClient, embeddingConfig); err == nil {
+					embeddingMigration := catalog.NewEmbeddingMigrationHandler(migrationStore, embedder)
+					workerDispatcher.Handle(catalog.TaskEmbeddingMigration, 30*time.Minute, embeddingMigration.Handle)
+					workerDispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: catalog.TaskEmbeddingMigration, SubjectKey: "global", Reason: "scheduled"}, Interval: 10 * time.Minute, InitialDelay: 2 * time.Minute})
+				}
+			}
 			workerDispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: "metadata_schedule", SubjectKey: "global", Reason: "scheduled"}, Interval: time.Minute})
 		}
 		workerDispatcher.Handle(playback.TaskPopularityRefresh, 15*time.Minute, popularityRefresher.Handle)
 		workerDispatcher.Handle(playback.TaskSiteTrendingRefresh, 2*time.Minute, popularityRefresher.HandleSiteTrending)
 		workerDispatcher.Handle(recommendation.TaskRefresh, 5*time.Minute, recommendationRefresher.Handle)
+		workerDispatcher.Handle(recommendation.TaskCooccurrence, 30*time.Minute, cooccurrenceStore.Handle)
+		workerDispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: recommendation.TaskCooccurrence, SubjectKey: "global", Reason: "scheduled"}, Interval: 24 * time.Hour, InitialDelay: 5 * time.Minute})
+		digester := recommendation.NewDigester(recommendationDigests, recommendationService, mediaidentity.AiringLocation(cfg.Database.TimeZone))
+		workerDispatcher.Handle(recommendation.TaskDigest, 30*time.Minute, digester.Handle)
+		workerDispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: recommendation.TaskDigest, SubjectKey: "global", Reason: "scheduled"}, Interval: 24 * time.Hour, InitialDelay: 15 * time.Minute})
+		// 想看的片有了片源时发提醒：资源关联和分集写入就发生在 web 进程的搜索里。
+		availabilityNotifier := notifications.NewAvailabilityNotifier(notificationStore, postgresStore, notifier)
+		workerDispatcher.Handle(mediaidentity.TaskAvailabilityCheck, 2*time.Minute, availabilityNotifier.Handle)
 		workerDispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: playback.TaskPopularityRefresh, SubjectKey: "global", Reason: "scheduled", Priority: 10}, Interval: 24 * time.Hour})
 		workerDispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: playback.TaskSiteTrendingRefresh, SubjectKey: "global", Reason: "scheduled", Priority: 10}, Interval: 24 * time.Hour})
 		if err := workerDispatcher.Start(); err != nil {
@@ -338,6 +390,16 @@ func main() {
 	if airReader, ok := mediaIdentityStore.(playback.AirScheduleReader); ok {
 		playbackOptions = append(playbackOptions, playback.WithAirScheduleReader(airReader))
 	}
+	if skipMarkerStore, ok := mediaIdentityStore.(mediaidentity.SkipMarkerStore); ok {
+		playbackOptions = append(playbackOptions, playback.WithSkipMarkerStore(skipMarkerStore))
+	}
+	if nextUnitReader, ok := mediaIdentityStore.(mediaidentity.NextUnitReader); ok {
+		playbackOptions = append(playbackOptions, playback.WithNextUnitReader(nextUnitReader))
+	}
+	if profileReader, ok := mediaIdentityStore.(mediaidentity.ProfileHealthReader); ok {
+		playbackOptions = append(playbackOptions, playback.WithProfileHealthReader(profileReader))
+	}
+	playbackOptions = append(playbackOptions, playback.WithEmbedStore(playback.NewEmbedStore(databasePool)))
 	playbackHandler := playback.NewHandler(
 		cfg,
 		itemStore.(playback.Catalog),
@@ -381,11 +443,39 @@ func main() {
 	if airReader, ok := mediaIdentityStore.(catalog.AirScheduleReader); ok {
 		catalogHandlerOptions = append(catalogHandlerOptions, catalog.WithAirScheduleReader(airReader))
 	}
+	if personReader, ok := mediaIdentityStore.(mediaidentity.PersonReader); ok {
+		catalogHandlerOptions = append(catalogHandlerOptions, catalog.WithPeople(personReader))
+	}
+	if collectionReader, ok := mediaIdentityStore.(mediaidentity.CollectionReader); ok {
+		catalogHandlerOptions = append(catalogHandlerOptions, catalog.WithCollections(collectionReader))
+	}
+	if translationReader, ok := mediaIdentityStore.(mediaidentity.TranslationReader); ok {
+		catalogHandlerOptions = append(catalogHandlerOptions, catalog.WithTranslations(translationReader))
+	}
+	if imageCache != nil {
+		var imageEncoders []catalog.ImageEncoder // 按优先级排列：AVIF 体积最小，排在 WebP 前面
+		for _, command := range []struct{ contentType, command string }{
+			{"image/avif", cfg.ImageCache.AVIFCommand}, {"image/webp", cfg.ImageCache.WebPCommand},
+		} {
+			if command.command == "" {
+				continue
+			}
+			encoder, encoderErr := catalog.NewCommandImageEncoder(command.contentType, command.command)
+			if encoderErr != nil {
+				slog.Warn("image encoder disabled", "content_type", command.contentType, "error", encoderErr)
+				continue
+			}
+			imageEncoders = append(imageEncoders, encoder)
+		}
+		catalogHandlerOptions = append(catalogHandlerOptions, catalog.WithImageCache(imageCache, imageEncoders...))
+	}
 	catalogHandler := catalog.NewHandler(cfg, catalogStore, catalogHandlerOptions...)
 	contentHandler := content.NewHandler(cfg, catalog.NewSitemapProvider(catalogStore))
-	recommendationHandler := recommendation.NewHandler(cfg, recommendationService, recommendationSnapshots).WithRefreshQueue(queueStore)
-	socialHandler := social.NewHandler(cfg, socialStore)
-	feedbackHandler := feedback.NewHandler(cfg, feedbackStore)
+	recommendationHandler := recommendation.NewHandler(cfg, recommendationService, recommendationSnapshots).WithRefreshQueue(queueStore).
+		WithGroupMembers(identityStore, socialStore).WithDigests(recommendationDigests)
+	socialHandler := social.NewHandler(cfg, socialStore).WithNotifier(notifier, postgresSocialStore)
+	feedbackHandler := feedback.NewHandler(cfg, feedbackStore).WithNotifier(notifier, postgresFeedbackStore)
+	notificationHandler := notifications.NewHandler(cfg, notificationStore)
 	danmakuClient := outbound.NewClient(25*time.Second, cfg.OutboundMaxConnsPerHost)
 	danmakuService := danmaku.NewService(danmakuStore, danmakuClient, cfg.Danmaku.APIBase)
 	danmakuHandler := danmaku.NewHandler(cfg, danmakuService)
@@ -394,13 +484,20 @@ func main() {
 	if retrier, ok := queueStore.(admin.JobRetrier); ok {
 		adminOptions = append(adminOptions, admin.WithJobRetrier(retrier))
 	}
+	if editor, ok := mediaIdentityStore.(mediaidentity.MetadataEditor); ok {
+		adminOptions = append(adminOptions, admin.WithMetadataEditor(editor))
+	}
+	if reviewer, ok := mediaIdentityStore.(mediaidentity.DuplicateReviewer); ok {
+		adminOptions = append(adminOptions, admin.WithDuplicateReviewer(reviewer))
+	}
 	adminHandler := admin.NewHandler(cfg, identityStore, adminSearchStore, catalogStore, feedbackStore, sourceCrawler, searchHealth,
 		adminOptions...)
 	// ── 阶段 7：路由注册 + HTTP 服务启动 ─────────────────────────
 	// 所有路由在一个位置集中注册；全局中间件（限流、CORS 等）由 httpserver.New 先于这些路由安装。
 	server := httpserver.New(cfg, readiness, func(router *gin.Engine) {
 		router.HTMLRender = renderer
-		router.Use(auth.Optional(cfg.AppSecret), identity.LoadUser(identityStore, cfg.AppSecret, cfg.Env == "production"))
+		router.Use(auth.Optional(cfg.AppSecret), identity.LoadUser(identityStore, cfg.AppSecret, cfg.Env == "production"),
+			platformweb.Locale(cfg.Env == "production"))
 		contentHandler.Register(router, filepath.Join(cfg.WebRoot, "static"))
 		searchHandler.Register(router)
 		playbackHandler.Register(router)
@@ -413,6 +510,7 @@ func main() {
 		recommendationHandler.Register(router)
 		socialHandler.Register(router)
 		feedbackHandler.Register(router)
+		notificationHandler.Register(router)
 		danmakuHandler.Register(router)
 		adminHandler.Register(router)
 	})
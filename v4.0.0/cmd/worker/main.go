@@ -21,6 +21,7 @@ import (
 	"github.com/TwoThreeWang/Moovie/new/internal/identity"
 	"github.com/TwoThreeWang/Moovie/new/internal/library"
 	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
 	"github.com/TwoThreeWang/Moovie/new/internal/operations"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
@@ -82,6 +83,8 @@ func main() {
 	metadataProvider := catalog.NewDoubanProvider(client, movies, catalog.WithDoubanCanonicalWriter(mediaStore), catalog.WithDoubanRequestInterval(cfg.Catalog.DoubanRequestInterval))
 	tmdbProvider := catalog.NewTMDBProvider(client, movies, cfg.Catalog.TMDBToken,
 		catalog.WithTMDBCanonicalWriter(mediaStore), catalog.WithTMDBMediaUnitWriter(mediaStore))
+	bangumiProvider := catalog.NewBangumiProvider(client, movies, cfg.Catalog.BangumiUserAgent,
+		catalog.WithBangumiCanonicalWriter(mediaStore), catalog.WithBangumiMediaUnitWriter(mediaStore))
 	// SPARQL 批量查询比普通抓取慢得多，单独一个 Client，超时按 Wikidata 的查询上限配。
 	wikidataClient := outbound.NewClient(cfg.Catalog.WikidataTimeout, 2)
 	defer wikidataClient.CloseIdleConnections()
@@ -89,15 +92,26 @@ func main() {
 		catalog.NewWikidataResolver(wikidataClient, cfg.Catalog.WikidataEndpoint, cfg.Catalog.WikidataUserAgent),
 		catalog.WithIMDbFallback(catalog.NewWMDBResolver(client, "", cfg.Catalog.IMDbLookupInterval)),
 		catalog.WithIMDbBatchSize(cfg.Catalog.IMDbBackfillBatch))
-	embeddingService := catalog.NewEmbeddingService(client, movies, catalog.EmbeddingConfig{
+	embeddingConfig := catalog.EmbeddingConfig{
+		Provider: cfg.Catalog.EmbeddingProvider, Model: cfg.Catalog.EmbeddingModel, Dimensions: cfg.Catalog.EmbeddingDimensions,
+		APIURL: cfg.Catalog.EmbeddingAPIURL, APIKey: cfg.Catalog.EmbeddingAPIKey,
 		OllamaHost: cfg.Catalog.OllamaHost, OllamaModel: cfg.Catalog.OllamaModel,
 		CFGatewayURL: cfg.Catalog.CFGatewayURL, CFAPIToken: cfg.Catalog.CFAPIToken,
 		CFAIModel: cfg.Catalog.CFAIModel,
-	}, catalog.WithEmbeddingAIClient(aiClient))
-	refreshOptions := []catalog.RefreshHandlerOption{catalog.WithRefreshReviews(metadataProvider)}
+	}
+	embeddingService := catalog.NewEmbeddingService(client, movies, embeddingConfig, catalog.WithEmbeddingAIClient(aiClient))
+	embedder, err := catalog.NewEmbedder(client, embeddingConfig)
+	if err != nil {
+		slog.Error("embedding backend configuration failed", "error", err)
+		os.Exit(1)
+	}
+	// 换了向量模型或维度时在后台整库重建，建好之前旧向量继续服务。
+	embeddingMigration := catalog.NewEmbeddingMigrationHandler(movies, embedder)
+	refreshOptions := []catalog.RefreshHandlerOption{catalog.WithRefreshReviews(metadataProvider), catalog.WithRefreshBangumi(bangumiProvider)}
 	if cfg.Catalog.TMDBToken != "" {
-		refreshOptions = append(refreshOptions, catalog.WithRefreshBackdrops(tmdbProvider))
+		refreshOptions = append(refreshOptions, catalog.WithRefreshBackdrops(tmdbProvider), catalog.WithRefreshMediaMetadata(tmdbProvider))
 	}
+	refreshOptions = append(refreshOptions, catalog.WithRefreshImagePalette(catalog.NewImagePaletteService(client, movies)))
 	metadataHandler := catalog.NewRefreshHandler(movies, metadataProvider, embeddingService, refreshOptions...)
 	doubanPopular := playback.NewDoubanPopularProvider(client)
 	popularSources := []playback.PopularSource{
@@ -109,27 +123,53 @@ func main() {
 	}
 	popularityRefresher := playback.NewPopularityRefresher(playback.NewPopularitySnapshotStore(pool),
 		playback.NewCompositePopularProvider(popularSources...), playback.NewSiteTrendingProvider(pool), 24*time.Hour)
-	recommendationService := recommendation.NewService(movies, recommendation.WithPersonalizer(movies))
+	cooccurrenceStore := recommendation.NewCooccurrenceStore(pool)
+	recommendationService := recommendation.NewService(movies, recommendation.WithPersonalizer(movies),
+		recommendation.WithCollaborative(cooccurrenceStore))
 	recommendationRefresher := recommendation.NewRefresher(recommendation.NewSnapshotStore(pool), recommendationService)
+	// 每周摘要的「一周」按追剧日历的时区从周一零点算起。
+	digester := recommendation.NewDigester(recommendation.NewDigestStore(pool), recommendationService, mediaidentity.AiringLocation(cfg.Database.TimeZone))
+	// 站内通知始终写收件箱，邮件和 Webhook 按配置启用。
+	notificationStore := notifications.NewPostgresStore(pool)
+	notifier := notifications.NewService(notificationStore, notifications.WithPreferences(notificationStore), notifications.WithDirectory(notificationStore),
+		notifications.WithChannels(notifications.ConfiguredChannels(cfg, client)...))
+	availabilityNotifier := notifications.NewAvailabilityNotifier(notificationStore, searchStore, notifier)
 	syncService := douban.NewService(douban.NewClient(client), libraryStore, jobs)
-	reportService := report.NewService(reports, libraryStore, movies)
-	doubanHandler := douban.NewTaskHandler(jobs, users, syncService, douban.WithMonthlyGenerator(reportService))
+	reportService := report.NewService(reports, libraryStore, movies, report.WithNotifier(notifier))
+	doubanHandler := douban.NewTaskHandler(jobs, users, syncService, douban.WithMonthlyGenerator(reportService), douban.WithNotifier(notifier))
 	metricsStore := operations.NewMetricsStore(pool)
-	operationsService := operations.NewService(searchStore,
+	operationsOptions := []operations.ServiceOption{
 		operations.WithJobQueueCleanup(metricsStore.DeleteExpiredJobs),
 		operations.WithTelemetryCleanup(metricsStore.DeleteExpiredTelemetry),
-		operations.WithSyncEventCleanup(history.NewPostgresStore(pool).DeleteExpiredSyncEvents))
+		operations.WithSyncEventCleanup(history.NewPostgresStore(pool).DeleteExpiredSyncEvents),
+		operations.WithNotificationCleanup(notificationStore.DeleteExpired),
+		operations.WithPlaybackStateReset(notificationStore.ResetLapsedPlaybackStates),
+	}
+	// 图片缓存由 web 写入，worker 只负责按容量上限淘汰，两边指向同一个目录。
+	if cfg.ImageCache.Dir != "" {
+		if imageCache, cacheErr := catalog.NewImageCache(cfg.ImageCache.Dir, cfg.ImageCache.MaxBytes); cacheErr != nil {
+			slog.Warn("image cache cleanup disabled", "error", cacheErr)
+		} else {
+			operationsOptions = append(operationsOptions, operations.WithImageCacheCleanup(imageCache.Trim))
+		}
+	}
+	operationsService := operations.NewService(searchStore, operationsOptions...)
 	dispatcher := workqueue.NewDispatcher(queueStore, cfg.Worker.Concurrency, cfg.Worker.Poll)
-	for _, taskType := range []string{catalog.RefreshProviderDouban, catalog.RefreshProviderReviews, catalog.RefreshProviderTMDB, catalog.RefreshProviderEmbedding} {
+	for _, taskType := range []string{catalog.RefreshProviderDouban, catalog.RefreshProviderReviews, catalog.RefreshProviderTMDB, catalog.RefreshProviderEmbedding,
+		catalog.RefreshProviderBangumi, catalog.RefreshProviderTMDBMetadata, catalog.RefreshProviderTMDBImport, catalog.RefreshProviderMediaEmbedding,
+		catalog.RefreshProviderImagePalette} {
 		dispatcher.Handle(taskType, 10*time.Minute, metadataHandler.Handle)
 	}
 	dispatcher.Handle("metadata_schedule", 2*time.Minute, metadataHandler.Schedule)
 	dispatcher.Handle(catalog.TaskIMDbBackfill, 5*time.Minute, imdbBackfill.Handle)
+	dispatcher.Handle(catalog.TaskEmbeddingMigration, 30*time.Minute, embeddingMigration.Handle)
 	dispatcher.Handle(douban.TaskSync, 30*time.Minute, doubanHandler.Handle)
 	dispatcher.Handle(douban.TaskDaily, 30*time.Minute, doubanHandler.HandleDaily)
 	dispatcher.Handle(playback.TaskPopularityRefresh, 15*time.Minute, popularityRefresher.Handle)
 	dispatcher.Handle(playback.TaskSiteTrendingRefresh, 2*time.Minute, popularityRefresher.HandleSiteTrending)
 	dispatcher.Handle(recommendation.TaskRefresh, 5*time.Minute, recommendationRefresher.Handle)
+	dispatcher.Handle(recommendation.TaskCooccurrence, 30*time.Minute, cooccurrenceStore.Handle)
+	dispatcher.Handle(recommendation.TaskDigest, 30*time.Minute, digester.Handle)
 	dispatcher.Handle(operations.TaskCleanup, 30*time.Minute, operationsService.HandleCleanup)
 	dispatcher.Handle(operations.TaskHealthCheck, 5*time.Minute, operationsService.HandleHealthCheck)
 	dispatcher.Handle(mediaidentity.TaskQualityRefresh, time.Minute, func(ctx context.Context, job workqueue.Job) error {
@@ -142,12 +182,26 @@ func main() {
 		}
 		return mediaStore.RefreshQuality(ctx, p.SourceKey, p.VodID)
 	})
+	dispatcher.Handle(mediaidentity.TaskAvailabilityCheck, 2*time.Minute, availabilityNotifier.Handle)
+	dispatcher.Handle(mediaidentity.TaskDuplicateScan, 10*time.Minute, func(ctx context.Context, job workqueue.Job) error {
+		recorded, err := mediaStore.DetectDuplicates(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("duplicate media scan finished", "candidates", recorded)
+		return nil
+	})
 	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: "metadata_schedule", SubjectKey: "global", Reason: "scheduled"}, Interval: time.Minute})
 	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: catalog.TaskIMDbBackfill, SubjectKey: "global", Reason: "scheduled"}, Interval: time.Minute, InitialDelay: 30 * time.Second})
+	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: catalog.TaskEmbeddingMigration, SubjectKey: "global", Reason: "scheduled"}, Interval: 10 * time.Minute, InitialDelay: 2 * time.Minute})
 	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: douban.TaskDaily, SubjectKey: "global", Reason: "scheduled"}, Interval: 24 * time.Hour, InitialDelay: time.Minute})
 	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: playback.TaskPopularityRefresh, SubjectKey: "global", Reason: "scheduled", Priority: 10}, Interval: 24 * time.Hour})
 	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: playback.TaskSiteTrendingRefresh, SubjectKey: "global", Reason: "scheduled", Priority: 10}, Interval: 24 * time.Hour})
+	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: recommendation.TaskCooccurrence, SubjectKey: "global", Reason: "scheduled"}, Interval: 24 * time.Hour, InitialDelay: 5 * time.Minute})
+	// 摘要任务每天跑一次，只给这一周还没有摘要的用户生成，所以周一之后的几天只是补漏。
+	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: recommendation.TaskDigest, SubjectKey: "global", Reason: "scheduled"}, Interval: 24 * time.Hour, InitialDelay: 15 * time.Minute})
 	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: operations.TaskCleanup, SubjectKey: "global", Reason: "scheduled"}, Interval: 24 * time.Hour})
+	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: mediaidentity.TaskDuplicateScan, SubjectKey: "global", Reason: "scheduled"}, Interval: 24 * time.Hour, InitialDelay: 10 * time.Minute})
 	dispatcher.Schedule(workqueue.Schedule{Spec: workqueue.Spec{TaskType: operations.TaskHealthCheck, SubjectKey: "global", Reason: "scheduled"}, Interval: time.Hour, InitialDelay: time.Hour})
 	if err := dispatcher.Start(); err != nil {
 		slog.Error("worker dispatcher failed to start", "error", err)
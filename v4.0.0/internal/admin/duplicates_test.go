@@ -0,0 +1,151 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+	"github.com/TwoThreeWang/Moovie/new/internal/feedback"
+	"github.com/TwoThreeWang/Moovie/new/internal/identity"
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/TwoThreeWang/Moovie/new/internal/search"
+	"github.com/gin-gonic/gin"
+)
+
+type duplicateReviewerStub struct {
+	status    string
+	merged    [3]int
+	reason    string
+	dismissed int
+	split     int
+}
+
+func (stub *duplicateReviewerStub) ListDuplicateCandidates(_ context.Context, status string, _ int) ([]mediaidentity.DuplicateCandidate, error) {
+	stub.status = status
+	return []mediaidentity.DuplicateCandidate{{
+		ID: 5, Confidence: 0.85, MatchedBy: "weighted_features", Status: status, ReasonJSON: `{"score":{}}`,
+		Media:     mediaidentity.DuplicateSide{ID: 7, DoubanID: "1292052", Title: "肖申克的救赎", Year: "1994", MediaType: "movie", ResourceCount: 3, LibraryCount: 2},
+		Duplicate: mediaidentity.DuplicateSide{ID: 9, Title: "刺激1995", Year: "1994", MediaType: "movie", ResourceCount: 1},
+	}}, nil
+}
+
+func (stub *duplicateReviewerStub) ListMediaMerges(context.Context, int) ([]mediaidentity.MediaMerge, error) {
+	return []mediaidentity.MediaMerge{{
+		ID: 11, Source: mediaidentity.DuplicateSide{ID: 12, Title: "旧条目"}, Target: mediaidentity.DuplicateSide{ID: 13, Title: "新条目"},
+		ActorUserID: 1, Moves: mediaidentity.MergeMoves{ExternalIDs: []int64{1, 2}, Aliases: []int64{3}}, MergedAt: time.Now(),
+	}}, nil
+}
+
+func (stub *duplicateReviewerStub) MergeDuplicate(_ context.Context, candidateID, targetMediaID, actorUserID int, reason string) (mediaidentity.MediaMerge, error) {
+	if candidateID == 404 {
+		return mediaidentity.MediaMerge{}, mediaidentity.ErrDuplicateCandidateNotFound
+	}
+	if targetMediaID == 8 {
+		return mediaidentity.MediaMerge{}, mediaidentity.ErrInvalidMerge
+	}
+	stub.merged, stub.reason = [3]int{candidateID, targetMediaID, actorUserID}, reason
+	return mediaidentity.MediaMerge{ID: 21, Source: mediaidentity.DuplicateSide{ID: 9}, Target: mediaidentity.DuplicateSide{ID: targetMediaID},
+		Moves: mediaidentity.MergeMoves{Aliases: []int64{4}}}, nil
+}
+
+func (stub *duplicateReviewerStub) DismissDuplicate(_ context.Context, candidateID, _ int) error {
+	stub.dismissed = candidateID
+	return nil
+}
+
+func (stub *duplicateReviewerStub) SplitMerge(_ context.Context, mergeID, _ int, _ string) error {
+	if mergeID == 404 {
+		return mediaidentity.ErrMediaMergeNotFound
+	}
+	stub.split = mergeID
+	return nil
+}
+
+func duplicateReviewRouter(t *testing.T, reviewer mediaidentity.DuplicateReviewer) (*gin.Engine, string, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	users := identity.NewPostgresStore(testdb.Pool(t))
+	_, _ = users.Create(t.Context(), identity.User{Email: "admin@example.com", Username: "admin", Role: "admin", CreatedAt: time.Now()})
+	_, _ = users.Create(t.Context(), identity.User{Email: "user@example.com", Username: "user", Role: "user", CreatedAt: time.Now()})
+	cfg := config.Config{Env: "test", SiteName: "Moovie影牛", SiteURL: "https://moovie.example", AppSecret: "secret"}
+	renderer, err := platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), []string{"admin_duplicates"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.HTMLRender = renderer
+	options := []HandlerOption{WithMetricsReader(adminMetricsStub{})}
+	if reviewer != nil {
+		options = append(options, WithDuplicateReviewer(reviewer))
+	}
+	NewHandler(cfg, users, search.NewPostgresStore(testdb.Pool(t)), catalog.NewPostgresStore(testdb.Pool(t)), feedback.NewPostgresStore(testdb.Pool(t)),
+		crawlerStub{}, nil, options...).Register(router)
+	now := time.Now()
+	adminToken, _ := auth.Sign(auth.Claims{UserID: 1, Role: "admin", Issued: now.Unix(), Expiry: now.Add(time.Hour).Unix()}, "secret")
+	userToken, _ := auth.Sign(auth.Claims{UserID: 2, Role: "user", Issued: now.Unix(), Expiry: now.Add(time.Hour).Unix()}, "secret")
+	return router, adminToken, userToken
+}
+
+func TestDuplicateReviewPageListsCandidatesAndMerges(t *testing.T) {
+	reviewer := &duplicateReviewerStub{}
+	router, adminToken, userToken := duplicateReviewRouter(t, reviewer)
+	if forbidden := request(router, http.MethodGet, "/admin/duplicates", userToken, false); forbidden.Code != http.StatusForbidden {
+		t.Fatalf("non-admin duplicates = %d", forbidden.Code)
+	}
+	page := request(router, http.MethodGet, "/admin/duplicates?status=bogus", adminToken, false)
+	for _, expected := range []string{"肖申克的救赎", "刺激1995", `href="/movie/m9"`, "资源 3 · 片单 2", `data-target-id="9"`, "保留 A", "旧条目", "3 行", "拆分"} {
+		if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), expected) {
+			t.Fatalf("duplicates page missing %q: %d/%s", expected, page.Code, page.Body.String())
+		}
+	}
+	if reviewer.status != "review" {
+		t.Fatalf("unknown status should fall back to review, got %q", reviewer.status)
+	}
+}
+
+func TestDuplicateReviewMergesDismissesAndSplits(t *testing.T) {
+	reviewer := &duplicateReviewerStub{}
+	router, adminToken, userToken := duplicateReviewRouter(t, reviewer)
+	if forbidden := formRequest(router, http.MethodPost, "/admin/duplicates/5/merge", url.Values{"target_media_id": {"7"}}, userToken); forbidden.Code != http.StatusForbidden || reviewer.merged[0] != 0 {
+		t.Fatalf("non-admin merge = %d/%v", forbidden.Code, reviewer.merged)
+	}
+	merged := formRequest(router, http.MethodPost, "/admin/duplicates/5/merge", url.Values{"target_media_id": {"7"}, "reason": {" 同一部片 "}}, adminToken)
+	if merged.Code != http.StatusOK || reviewer.merged != [3]int{5, 7, 1} || reviewer.reason != "同一部片" || !strings.Contains(merged.Body.String(), `"merge_id":21`) {
+		t.Fatalf("merge = %d/%s %v %q", merged.Code, merged.Body.String(), reviewer.merged, reviewer.reason)
+	}
+	if conflict := formRequest(router, http.MethodPost, "/admin/duplicates/5/merge", url.Values{"target_media_id": {"8"}}, adminToken); conflict.Code != http.StatusConflict {
+		t.Fatalf("merge outside pair = %d", conflict.Code)
+	}
+	if missing := formRequest(router, http.MethodPost, "/admin/duplicates/404/merge", url.Values{"target_media_id": {"7"}}, adminToken); missing.Code != http.StatusNotFound {
+		t.Fatalf("merge missing candidate = %d", missing.Code)
+	}
+	if invalid := formRequest(router, http.MethodPost, "/admin/duplicates/5/merge", url.Values{}, adminToken); invalid.Code != http.StatusBadRequest {
+		t.Fatalf("merge without target = %d", invalid.Code)
+	}
+
+	if dismissed := formRequest(router, http.MethodPost, "/admin/duplicates/6/dismiss", url.Values{}, adminToken); dismissed.Code != http.StatusOK || reviewer.dismissed != 6 {
+		t.Fatalf("dismiss = %d/%d", dismissed.Code, reviewer.dismissed)
+	}
+	if split := formRequest(router, http.MethodPost, "/admin/merges/11/split", url.Values{"reason": {"合错了"}}, adminToken); split.Code != http.StatusOK || reviewer.split != 11 {
+		t.Fatalf("split = %d/%d", split.Code, reviewer.split)
+	}
+	if missing := formRequest(router, http.MethodPost, "/admin/merges/404/split", url.Values{}, adminToken); missing.Code != http.StatusNotFound {
+		t.Fatalf("split missing merge = %d", missing.Code)
+	}
+}
+
+func TestDuplicateReviewIsUnavailableWithoutReviewer(t *testing.T) {
+	router, adminToken, _ := duplicateReviewRouter(t, nil)
+	if response := request(router, http.MethodGet, "/admin/duplicates", adminToken, false); response.Code != http.StatusServiceUnavailable {
+		t.Fatalf("duplicates without store = %d", response.Code)
+	}
+}
@@ -1,13 +1,14 @@
 // Package admin 是管理后台，只有 role=admin 的账号能访问。
 //
 // 本包自己不建表，全部通过其他包的接口读写：用户、资源网、版权/分类过滤词、
-// 任务队列、运行指标、资源匹配复核、资源退役。
+// 任务队列、运行指标、资源匹配复核、资源退役、作品元数据修正、重复作品合并。
 //
 // 页面接口返回 HTML，操作接口统一返回 {code, message, data, success} 的 JSON。
 package admin
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/TwoThreeWang/Moovie/new/internal/feedback"
 	"github.com/TwoThreeWang/Moovie/new/internal/identity"
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
 	"github.com/TwoThreeWang/Moovie/new/internal/operations"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
@@ -74,17 +76,19 @@ type JobRetrier interface {
 	RetryFailed(ctx context.Context, taskType string, limit int) (int, error)
 }
 
-// Handler 是后台的全部接口。metrics 和 jobs 是可选的，没注入时相关页面返回 503。
+// Handler 是后台的全部接口。metrics、jobs、editor 和 duplicates 是可选的，没注入时相关页面返回 503。
 type Handler struct {
-	config   config.Config
-	users    UserStore
-	search   SearchStore
-	movies   MovieCounter
-	feedback FeedbackCounter
-	crawler  search.SourceCrawler
-	health   CircuitState
-	metrics  operations.MetricsReader
-	jobs     JobRetrier
+	config     config.Config
+	users      UserStore
+	search     SearchStore
+	movies     MovieCounter
+	feedback   FeedbackCounter
+	crawler    search.SourceCrawler
+	health     CircuitState
+	metrics    operations.MetricsReader
+	jobs       JobRetrier
+	editor     mediaidentity.MetadataEditor
+	duplicates mediaidentity.DuplicateReviewer
 }
 
 // HandlerOption 用于注入可选依赖。
@@ -100,6 +104,16 @@ func WithJobRetrier(retrier JobRetrier) HandlerOption {
 	return func(handler *Handler) { handler.jobs = retrier }
 }
 
+// WithMetadataEditor 注入作品元数据编辑器。
+func WithMetadataEditor(editor mediaidentity.MetadataEditor) HandlerOption {
+	return func(handler *Handler) { handler.editor = editor }
+}
+
+// WithDuplicateReviewer 注入重复作品复核（合并、拆分）能力。
+func WithDuplicateReviewer(reviewer mediaidentity.DuplicateReviewer) HandlerOption {
+	return func(handler *Handler) { handler.duplicates = reviewer }
+}
+
 // NewHandler 创建后台处理器。
 func NewHandler(cfg config.Config, users UserStore, searchStore SearchStore, movies MovieCounter, feedbackStore feedback.Store, crawler search.SourceCrawler, health CircuitState, options ...HandlerOption) *Handler {
 	handler := &Handler{config: cfg, users: users, search: searchStore, movies: movies, feedback: feedbackStore, crawler: crawler, health: health}
@@ -130,7 +144,17 @@ func (handler *Handler) Register(router *gin.Engine) {
 	router.POST("/admin/matches/decision", append(middleware, handler.matchReviewDecision)...)
 	router.GET("/api/v2/admin/media-matches", append(middleware, handler.matchReviewAPIList)...)
 	router.POST("/api/v2/admin/media-matches/:id/resolve", append(middleware, handler.matchReviewAPIResolve)...)
+	router.GET("/admin/media/:id", append(middleware, handler.mediaEditorPage)...)
+	router.POST("/admin/media/:id/fields", append(middleware, handler.mediaEditFields)...)
+	router.POST("/admin/media/:id/locks", append(middleware, handler.mediaFieldLock)...)
+	router.POST("/admin/media/:id/revert", append(middleware, handler.mediaFieldRevert)...)
+	router.GET("/admin/duplicates", append(middleware, handler.duplicateReviewPage)...)
+	router.POST("/admin/duplicates/:id/merge", append(middleware, handler.duplicateMerge)...)
+	router.POST("/admin/duplicates/:id/dismiss", append(middleware, handler.duplicateDismiss)...)
+	router.POST("/admin/merges/:id/split", append(middleware, handler.mergeSplit)...)
 	router.GET("/api/v2/admin/metrics", append(middleware, handler.metricsSnapshot)...)
+	router.GET("/admin/playback-qoe", append(middleware, handler.playbackQoEPage)...)
+	router.GET("/api/v2/admin/playback-qoe", append(middleware, handler.playbackQoEAPI)...)
 	router.POST("/admin/data/clean", append(middleware, handler.dataClean)...)
 	router.GET("/admin/copyright", append(middleware, handler.copyrightList)...)
 	router.POST("/admin/copyright", append(middleware, handler.copyrightCreate)...)
@@ -244,6 +268,49 @@ func (handler *Handler) metricsSnapshot(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": snapshot})
 }
 
+// playbackQoEQuery 从查询参数读取 QoE 报表条件，天数只接受 1/7/14/30。
+func playbackQoEQuery(c *gin.Context) operations.PlaybackQoEQuery {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if days != 1 && days != 14 && days != 30 {
+		days = 7
+	}
+	return operations.PlaybackQoEQuery{Days: days, SourceKey: strings.TrimSpace(c.Query("source_key"))}
+}
+
+// playbackQoEPage 渲染播放体验报表页：按资源站、线路、天看起播耗时、卡顿、失败和自动换源。
+func (handler *Handler) playbackQoEPage(c *gin.Context) {
+	reader, ok := handler.metrics.(operations.PlaybackQoEReader)
+	if !ok {
+		apiError(c, http.StatusServiceUnavailable, "播放体验报表暂不可用")
+		return
+	}
+	query := playbackQoEQuery(c)
+	report, err := reader.PlaybackQoE(c.Request.Context(), query)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "读取播放体验报表失败")
+		return
+	}
+	handler.page(c, "admin_playback_qoe.html", "播放体验 - Moovie影牛", gin.H{
+		"Report": report, "Days": query.Days, "SourceKey": query.SourceKey, "DayOptions": []int{1, 7, 14, 30},
+	})
+}
+
+// playbackQoEAPI 以 JSON 返回同一份报表，方便接外部监控。
+func (handler *Handler) playbackQoEAPI(c *gin.Context) {
+	reader, ok := handler.metrics.(operations.PlaybackQoEReader)
+	if !ok {
+		apiError(c, http.StatusServiceUnavailable, "播放体验报表暂不可用")
+		return
+	}
+	report, err := reader.PlaybackQoE(c.Request.Context(), playbackQoEQuery(c))
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "读取播放体验报表失败")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
+
 // matchReviewPage 渲染资源匹配复核页：机器拿不准的「资源属于哪部片」由人来定。
 func (handler *Handler) matchReviewPage(c *gin.Context) {
 	store, ok := handler.search.(search.MatchReviewStore)
@@ -356,6 +423,259 @@ func matchAPIError(c *gin.Context, status int, code, message string) {
 	c.JSON(status, gin.H{"success": false, "code": code, "message": message})
 }
 
+// mediaFieldRow 是元数据编辑器上的一行：字段、当前值、获胜来源和锁定状态。
+type mediaFieldRow struct {
+	mediaidentity.EditableField
+	Value  string
+	Source mediaidentity.FieldSource
+}
+
+// Manual 表示当前值是管理员改的。只挂了锁的字段来源也记作 manual，但优先级是 0，不算人工值。
+func (row mediaFieldRow) Manual() bool {
+	return row.Source.Provider == mediaidentity.ManualProvider && row.Source.Priority >= mediaidentity.ManualPriority
+}
+
+// mediaEditorPage 渲染作品元数据编辑器：每个字段的当前值和来源、锁定开关，以及全部变更历史。
+func (handler *Handler) mediaEditorPage(c *gin.Context) {
+	if handler.editor == nil {
+		apiError(c, http.StatusServiceUnavailable, "元数据编辑器暂不可用")
+		return
+	}
+	mediaID, err := positiveInt(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "作品 ID 无效")
+		return
+	}
+	ctx := c.Request.Context()
+	media, err := handler.editor.FindByID(ctx, mediaID)
+	if err != nil {
+		apiError(c, http.StatusNotFound, "作品不存在")
+		return
+	}
+	sources, err := handler.editor.ListFieldSources(ctx, mediaID)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "读取字段来源失败")
+		return
+	}
+	history, err := handler.editor.ListFieldHistory(ctx, mediaID, 200)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "读取变更历史失败")
+		return
+	}
+	fields := make([]mediaFieldRow, 0, len(mediaidentity.EditableFields))
+	labels := make(map[string]string, len(mediaidentity.EditableFields))
+	for _, field := range mediaidentity.EditableFields {
+		fields = append(fields, mediaFieldRow{EditableField: field, Value: media.FieldValue(field.Name), Source: sources[field.Name]})
+		labels[field.Name] = field.Label
+	}
+	handler.page(c, "admin_media.html", "编辑资料："+media.Title+" - Moovie影牛", gin.H{
+		"Media": media, "Fields": fields, "History": history, "Labels": labels,
+	})
+}
+
+// mediaEditFields 保存编辑器表单。只提交了的字段才会处理，值没变的字段不会留下历史。
+// 先校验整张表单再一次性写入，不会出现前几个字段已保存、后面的字段报错的半截修改。
+func (handler *Handler) mediaEditFields(c *gin.Context) {
+	if handler.editor == nil {
+		apiError(c, http.StatusServiceUnavailable, "元数据编辑器暂不可用")
+		return
+	}
+	mediaID, err := positiveInt(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "作品 ID 无效")
+		return
+	}
+	if err := c.Request.ParseForm(); err != nil {
+		apiError(c, http.StatusBadRequest, "表单无效")
+		return
+	}
+	values := map[string]string{}
+	for _, field := range mediaidentity.EditableFields {
+		submitted, ok := c.Request.PostForm[field.Name]
+		if !ok {
+			continue
+		}
+		if len([]rune(submitted[0])) > 20000 {
+			apiError(c, http.StatusBadRequest, field.Label+"过长")
+			return
+		}
+		if err := mediaidentity.ValidateFieldValue(field.Name, submitted[0]); err != nil {
+			apiError(c, http.StatusBadRequest, field.Label+"的值无效")
+			return
+		}
+		values[field.Name] = submitted[0]
+	}
+	changed, err := handler.editor.EditFields(c.Request.Context(), mediaID, auth.UserID(c), values)
+	if errors.Is(err, mediaidentity.ErrFieldNotEditable) {
+		apiError(c, http.StatusBadRequest, "字段的值无效")
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "保存失败")
+		return
+	}
+	apiSuccess(c, gin.H{"media_id": mediaID, "changed": changed})
+}
+
+// mediaFieldLock 锁定或解锁一个字段，锁定后豆瓣、TMDB 刷新都不再改写它。
+func (handler *Handler) mediaFieldLock(c *gin.Context) {
+	if handler.editor == nil {
+		apiError(c, http.StatusServiceUnavailable, "元数据编辑器暂不可用")
+		return
+	}
+	mediaID, err := positiveInt(c.Param("id"))
+	field := strings.TrimSpace(c.PostForm("field"))
+	if _, editable := mediaidentity.LookupEditableField(field); err != nil || !editable {
+		apiError(c, http.StatusBadRequest, "作品 ID 或字段无效")
+		return
+	}
+	locked := c.PostForm("locked") == "on" || c.PostForm("locked") == "true"
+	if err := handler.editor.SetFieldLock(c.Request.Context(), mediaID, field, locked); err != nil {
+		apiError(c, http.StatusInternalServerError, "修改锁定状态失败")
+		return
+	}
+	apiSuccess(c, gin.H{"media_id": mediaID, "field": field, "locked": locked})
+}
+
+// mediaFieldRevert 把字段改回某条历史记录之前的值，回滚同样记一条人工修改。
+func (handler *Handler) mediaFieldRevert(c *gin.Context) {
+	if handler.editor == nil {
+		apiError(c, http.StatusServiceUnavailable, "元数据编辑器暂不可用")
+		return
+	}
+	mediaID, err := positiveInt(c.Param("id"))
+	changeID, changeErr := positiveInt(c.PostForm("change_id"))
+	if err != nil || changeErr != nil {
+		apiError(c, http.StatusBadRequest, "作品 ID 或历史记录 ID 无效")
+		return
+	}
+	err = handler.editor.RevertFieldChange(c.Request.Context(), mediaID, changeID, auth.UserID(c))
+	if errors.Is(err, mediaidentity.ErrFieldChangeNotFound) {
+		apiError(c, http.StatusNotFound, "历史记录不存在")
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "回滚失败")
+		return
+	}
+	apiSuccess(c, gin.H{"media_id": mediaID, "change_id": changeID})
+}
+
+// duplicateStatuses 是重复作品复核页可以切换的状态。
+var duplicateStatuses = map[string]bool{"review": true, "merged": true, "dismissed": true}
+
+// duplicateReviewPage 渲染疑似重复作品的复核队列，以及最近的合并记录（可拆分）。
+func (handler *Handler) duplicateReviewPage(c *gin.Context) {
+	if handler.duplicates == nil {
+		apiError(c, http.StatusServiceUnavailable, "重复作品复核暂不可用")
+		return
+	}
+	status := c.DefaultQuery("status", "review")
+	if !duplicateStatuses[status] {
+		status = "review"
+	}
+	ctx := c.Request.Context()
+	candidates, err := handler.duplicates.ListDuplicateCandidates(ctx, status, 100)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "读取复核队列失败")
+		return
+	}
+	merges, err := handler.duplicates.ListMediaMerges(ctx, 50)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "读取合并记录失败")
+		return
+	}
+	handler.page(c, "admin_duplicates.html", "重复作品 - Moovie影牛", gin.H{
+		"Status": status, "Candidates": candidates, "Merges": merges,
+	})
+}
+
+// duplicateMerge 合并一对疑似重复的作品，target_media_id 是要保留的那一部。
+func (handler *Handler) duplicateMerge(c *gin.Context) {
+	if handler.duplicates == nil {
+		apiError(c, http.StatusServiceUnavailable, "重复作品复核暂不可用")
+		return
+	}
+	candidateID, err := positiveInt(c.Param("id"))
+	targetID, targetErr := positiveInt(c.PostForm("target_media_id"))
+	if err != nil || targetErr != nil {
+		apiError(c, http.StatusBadRequest, "复核记录或保留作品无效")
+		return
+	}
+	reason := strings.TrimSpace(c.PostForm("reason"))
+	if len([]rune(reason)) > 500 {
+		apiError(c, http.StatusBadRequest, "合并原因过长")
+		return
+	}
+	merge, err := handler.duplicates.MergeDuplicate(c.Request.Context(), candidateID, targetID, auth.UserID(c), reason)
+	switch {
+	case errors.Is(err, mediaidentity.ErrDuplicateCandidateNotFound):
+		apiError(c, http.StatusNotFound, "复核记录不存在或已处理")
+		return
+	case errors.Is(err, mediaidentity.ErrInvalidMerge):
+		apiError(c, http.StatusConflict, "这两部作品不能合并")
+		return
+	case err != nil:
+		apiError(c, http.StatusInternalServerError, "合并失败")
+		return
+	}
+	apiSuccess(c, gin.H{"merge_id": merge.ID, "source_media_id": merge.Source.ID, "target_media_id": merge.Target.ID, "moved": merge.Moves.Count()})
+}
+
+// duplicateDismiss 把一对作品标为「不是重复」。
+func (handler *Handler) duplicateDismiss(c *gin.Context) {
+	if handler.duplicates == nil {
+		apiError(c, http.StatusServiceUnavailable, "重复作品复核暂不可用")
+		return
+	}
+	candidateID, err := positiveInt(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "复核记录无效")
+		return
+	}
+	err = handler.duplicates.DismissDuplicate(c.Request.Context(), candidateID, auth.UserID(c))
+	if errors.Is(err, mediaidentity.ErrDuplicateCandidateNotFound) {
+		apiError(c, http.StatusNotFound, "复核记录不存在或已处理")
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "操作失败")
+		return
+	}
+	apiSuccess(c, gin.H{"candidate_id": candidateID, "status": "dismissed"})
+}
+
+// mergeSplit 撤销一次合并，把挪走的数据还给原作品。
+func (handler *Handler) mergeSplit(c *gin.Context) {
+	if handler.duplicates == nil {
+		apiError(c, http.StatusServiceUnavailable, "重复作品复核暂不可用")
+		return
+	}
+	mergeID, err := positiveInt(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "合并记录无效")
+		return
+	}
+	reason := strings.TrimSpace(c.PostForm("reason"))
+	if len([]rune(reason)) > 500 {
+		apiError(c, http.StatusBadRequest, "拆分原因过长")
+		return
+	}
+	err = handler.duplicates.SplitMerge(c.Request.Context(), mergeID, auth.UserID(c), reason)
+	switch {
+	case errors.Is(err, mediaidentity.ErrMediaMergeNotFound):
+		apiError(c, http.StatusNotFound, "合并记录不存在或已拆分")
+		return
+	case errors.Is(err, mediaidentity.ErrInvalidMerge):
+		apiError(c, http.StatusConflict, "被合并的作品已改动，无法自动拆分")
+		return
+	case err != nil:
+		apiError(c, http.StatusInternalServerError, "拆分失败")
+		return
+	}
+	apiSuccess(c, gin.H{"merge_id": mergeID, "status": "split"})
+}
+
 // dashboard 渲染后台首页的几个数量统计。
 func (handler *Handler) dashboard(c *gin.Context) {
 	users, _ := handler.users.ListUsers(c.Request.Context())
@@ -34,7 +34,7 @@ func TestAdminPagesAndMutationsRequireRoleAndPreserveMainFlows(t *testing.T) {
 	if forbidden.Code != http.StatusForbidden || !strings.Contains(forbidden.Body.String(), "需要管理员权限") {
 		t.Fatalf("forbidden = %d/%s", forbidden.Code, forbidden.Body.String())
 	}
-	for _, path := range []string{"/admin", "/admin/users", "/admin/sites", "/admin/data", "/admin/jobs", "/admin/matches", "/admin/copyright", "/admin/category"} {
+	for _, path := range []string{"/admin", "/admin/users", "/admin/sites", "/admin/data", "/admin/jobs", "/admin/playback-qoe", "/admin/matches", "/admin/copyright", "/admin/category"} {
 		response := request(router, http.MethodGet, path, adminToken, false)
 		if response.Code != http.StatusOK {
 			t.Fatalf("GET %s = %d/%s", path, response.Code, response.Body.String())
@@ -58,6 +58,16 @@ func TestAdminPagesAndMutationsRequireRoleAndPreserveMainFlows(t *testing.T) {
 	if metricsForbidden.Code != http.StatusForbidden {
 		t.Fatalf("non-admin metrics = %d/%s", metricsForbidden.Code, metricsForbidden.Body.String())
 	}
+	qoePage := request(router, http.MethodGet, "/admin/playback-qoe?days=14&source_key=ffzy", adminToken, false)
+	for _, expected := range []string{"资源站汇总", "ffzy", "HLS 主线", "manifest timeout × 4", "近 14 天"} {
+		if qoePage.Code != http.StatusOK || !strings.Contains(qoePage.Body.String(), expected) {
+			t.Fatalf("qoe page missing %q: %d/%s", expected, qoePage.Code, qoePage.Body.String())
+		}
+	}
+	qoe := request(router, http.MethodGet, "/api/v2/admin/playback-qoe?days=99", adminToken, false)
+	if qoe.Code != http.StatusOK || !strings.Contains(qoe.Body.String(), `"days":7`) || !strings.Contains(qoe.Body.String(), `"rebuffer_ratio":12.5`) {
+		t.Fatalf("qoe api = %d/%s", qoe.Code, qoe.Body.String())
+	}
 
 	created := formRequest(router, http.MethodPost, "/admin/sites", url.Values{"key": {"demo"}, "base_url": {"https://source.example/api"}, "enabled": {"on"}}, adminToken)
 	if created.Code != http.StatusOK || !strings.Contains(created.Body.String(), `"success":true`) {
@@ -241,7 +251,7 @@ func adminTestRouter(t *testing.T) (*gin.Engine, *identity.PostgresStore, *searc
 	feedbackStore := feedback.NewPostgresStore(testdb.Pool(t))
 	_, _ = feedbackStore.Create(t.Context(), feedback.Feedback{Type: "bug", Content: "问题"})
 	cfg := config.Config{Env: "test", SiteName: "Moovie影牛", SiteURL: "https://moovie.example", AppSecret: "secret"}
-	pages := []string{"admin_dashboard", "admin_users", "admin_sites", "admin_cache", "admin_copyright", "admin_category", "admin_matches", "admin_jobs"}
+	pages := []string{"admin_dashboard", "admin_users", "admin_sites", "admin_cache", "admin_copyright", "admin_category", "admin_matches", "admin_jobs", "admin_playback_qoe"}
 	renderer, err := platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), pages)
 	if err != nil {
 		t.Fatal(err)
@@ -287,6 +297,16 @@ func (adminMetricsStub) JobQueue(_ context.Context, query operations.JobQueueQue
 	return snapshot, nil
 }
 
+func (adminMetricsStub) PlaybackQoE(_ context.Context, query operations.PlaybackQoEQuery) (operations.PlaybackQoEReport, error) {
+	reasons := []operations.QoEFailureReason{{Reason: "manifest timeout", Count: 4}}
+	site := operations.PlaybackQoERow{SourceKey: "ffzy", Attempts: 40, FirstFrames: 32, Rebuffers: 4, FatalErrors: 8,
+		FirstFrameRate: 80, RebufferRatio: 12.5, FailureRate: 20, StartupP50Ms: 900, StartupP90Ms: 2400, FailureReasons: reasons}
+	line := site
+	line.Day, line.LineID, line.LineKey, line.LineLabel = "2026-08-15", 3, "ffm3u8", "HLS 主线"
+	return operations.PlaybackQoEReport{Days: query.Days, SourceKey: query.SourceKey,
+		Sites: []operations.PlaybackQoERow{site}, Rows: []operations.PlaybackQoERow{line}}, nil
+}
+
 type crawlerStub struct{}
 
 func (crawlerStub) Search(_ context.Context, _, keyword, sourceKey string, _ []string) ([]search.VodItem, error) {
@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+	"github.com/TwoThreeWang/Moovie/new/internal/feedback"
+	"github.com/TwoThreeWang/Moovie/new/internal/identity"
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/TwoThreeWang/Moovie/new/internal/search"
+	"github.com/gin-gonic/gin"
+)
+
+type metadataEditorStub struct {
+	media    mediaidentity.Media
+	edits    map[string]string
+	actor    int
+	lock     string
+	locked   bool
+	reverted int
+}
+
+func (stub *metadataEditorStub) FindByID(context.Context, int) (mediaidentity.Media, error) {
+	return stub.media, nil
+}
+
+func (stub *metadataEditorStub) ListFieldSources(context.Context, int) (map[string]mediaidentity.FieldSource, error) {
+	return map[string]mediaidentity.FieldSource{
+		"title":  {Field: "title", Provider: "douban", Priority: 100},
+		"poster": {Field: "poster", Provider: mediaidentity.ManualProvider, Priority: mediaidentity.ManualPriority, Locked: true},
+	}, nil
+}
+
+func (stub *metadataEditorStub) EditFields(_ context.Context, _ int, actorUserID int, values map[string]string) ([]string, error) {
+	changed := []string{}
+	for _, field := range mediaidentity.EditableFields {
+		value, ok := values[field.Name]
+		if !ok {
+			continue
+		}
+		stub.edits[field.Name], stub.actor = value, actorUserID
+		if stub.media.FieldValue(field.Name) != value {
+			changed = append(changed, field.Name)
+		}
+	}
+	return changed, nil
+}
+
+func (stub *metadataEditorStub) SetFieldLock(_ context.Context, _ int, field string, locked bool) error {
+	stub.lock, stub.locked = field, locked
+	return nil
+}
+
+func (stub *metadataEditorStub) ListFieldHistory(context.Context, int, int) ([]mediaidentity.FieldChange, error) {
+	oldPoster, newPoster := "https://img.example/wrong.jpg", "https://img.example/fixed.jpg"
+	return []mediaidentity.FieldChange{
+		{ID: 9, MediaID: 7, Field: "poster", Provider: mediaidentity.ManualProvider, ActorUserID: 1, OldValue: &oldPoster, NewValue: &newPoster, CreatedAt: time.Now()},
+		{ID: 8, MediaID: 7, Field: "poster", Provider: "douban", NewValue: &oldPoster, CreatedAt: time.Now()},
+	}, nil
+}
+
+func (stub *metadataEditorStub) RevertFieldChange(_ context.Context, _, changeID, actorUserID int) error {
+	if changeID == 404 {
+		return mediaidentity.ErrFieldChangeNotFound
+	}
+	stub.reverted, stub.actor = changeID, actorUserID
+	return nil
+}
+
+func mediaEditorRouter(t *testing.T, editor mediaidentity.MetadataEditor) (*gin.Engine, string, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	users := identity.NewPostgresStore(testdb.Pool(t))
+	_, _ = users.Create(t.Context(), identity.User{Email: "admin@example.com", Username: "admin", Role: "admin", CreatedAt: time.Now()})
+	_, _ = users.Create(t.Context(), identity.User{Email: "user@example.com", Username: "user", Role: "user", CreatedAt: time.Now()})
+	cfg := config.Config{Env: "test", SiteName: "Moovie影牛", SiteURL: "https://moovie.example", AppSecret: "secret"}
+	renderer, err := platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), []string{"admin_media"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.HTMLRender = renderer
+	options := []HandlerOption{WithMetricsReader(adminMetricsStub{})}
+	if editor != nil {
+		options = append(options, WithMetadataEditor(editor))
+	}
+	NewHandler(cfg, users, search.NewPostgresStore(testdb.Pool(t)), catalog.NewPostgresStore(testdb.Pool(t)), feedback.NewPostgresStore(testdb.Pool(t)),
+		crawlerStub{}, nil, options...).Register(router)
+	now := time.Now()
+	adminToken, _ := auth.Sign(auth.Claims{UserID: 1, Role: "admin", Issued: now.Unix(), Expiry: now.Add(time.Hour).Unix()}, "secret")
+	userToken, _ := auth.Sign(auth.Claims{UserID: 2, Role: "user", Issued: now.Unix(), Expiry: now.Add(time.Hour).Unix()}, "secret")
+	return router, adminToken, userToken
+}
+
+func TestMediaEditorShowsSourcesLocksAndHistory(t *testing.T) {
+	editor := &metadataEditorStub{media: mediaidentity.Media{ID: 7, DoubanID: "1292052", Title: "肖申克的救赎", Poster: "https://img.example/fixed.jpg"}, edits: map[string]string{}}
+	router, adminToken, userToken := mediaEditorRouter(t, editor)
+	if forbidden := request(router, http.MethodGet, "/admin/media/7", userToken, false); forbidden.Code != http.StatusForbidden {
+		t.Fatalf("non-admin editor = %d", forbidden.Code)
+	}
+	page := request(router, http.MethodGet, "/admin/media/7", adminToken, false)
+	for _, expected := range []string{"肖申克的救赎", `name="title"`, `name="rating_douban"`, "douban · 100", "人工修改", `data-field="poster" onchange="lockField(this)" checked`, "管理员 #1", "改回旧值", `data-change-id="9" onclick="revertChange(this)"`} {
+		if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), expected) {
+			t.Fatalf("editor page missing %q: %d/%s", expected, page.Code, page.Body.String())
+		}
+	}
+	if invalid := request(router, http.MethodGet, "/admin/media/abc", adminToken, false); invalid.Code != http.StatusBadRequest {
+		t.Fatalf("invalid media id = %d", invalid.Code)
+	}
+}
+
+func TestMediaEditorSavesManualEditsLocksAndReverts(t *testing.T) {
+	editor := &metadataEditorStub{media: mediaidentity.Media{ID: 7, Title: "肖申克的救赎", Year: "1994"}, edits: map[string]string{}}
+	router, adminToken, userToken := mediaEditorRouter(t, editor)
+	if forbidden := formRequest(router, http.MethodPost, "/admin/media/7/fields", url.Values{"title": {"改名"}}, userToken); forbidden.Code != http.StatusForbidden || len(editor.edits) != 0 {
+		t.Fatalf("non-admin edit = %d/%#v", forbidden.Code, editor.edits)
+	}
+	saved := formRequest(router, http.MethodPost, "/admin/media/7/fields", url.Values{"title": {"肖申克的救赎"}, "year": {"1995"}, "embedding_content": {"x"}}, adminToken)
+	if saved.Code != http.StatusOK || !strings.Contains(saved.Body.String(), `"changed":["year"]`) || editor.actor != 1 {
+		t.Fatalf("save = %d/%s actor=%d", saved.Code, saved.Body.String(), editor.actor)
+	}
+	if _, leaked := editor.edits["embedding_content"]; leaked || len(editor.edits) != 2 {
+		t.Fatalf("edits = %#v", editor.edits)
+	}
+	// 表单里有一个字段不合法时，同一张表单里合法的字段也不能先写进去。
+	if bad := formRequest(router, http.MethodPost, "/admin/media/7/fields", url.Values{"title": {"改名"}, "rating_douban": {"11"}}, adminToken); bad.Code != http.StatusBadRequest ||
+		editor.edits["title"] != "肖申克的救赎" {
+		t.Fatalf("invalid rating = %d/%s edits=%#v", bad.Code, bad.Body.String(), editor.edits)
+	}
+
+	locked := formRequest(router, http.MethodPost, "/admin/media/7/locks", url.Values{"field": {"summary"}, "locked": {"true"}}, adminToken)
+	if locked.Code != http.StatusOK || editor.lock != "summary" || !editor.locked {
+		t.Fatalf("lock = %d/%s (%s %v)", locked.Code, locked.Body.String(), editor.lock, editor.locked)
+	}
+	if bad := formRequest(router, http.MethodPost, "/admin/media/7/locks", url.Values{"field": {"douban_id"}, "locked": {"true"}}, adminToken); bad.Code != http.StatusBadRequest {
+		t.Fatalf("lock unknown field = %d", bad.Code)
+	}
+
+	reverted := formRequest(router, http.MethodPost, "/admin/media/7/revert", url.Values{"change_id": {"9"}}, adminToken)
+	if reverted.Code != http.StatusOK || editor.reverted != 9 {
+		t.Fatalf("revert = %d/%s", reverted.Code, reverted.Body.String())
+	}
+	if missing := formRequest(router, http.MethodPost, "/admin/media/7/revert", url.Values{"change_id": {"404"}}, adminToken); missing.Code != http.StatusNotFound {
+		t.Fatalf("revert missing change = %d", missing.Code)
+	}
+}
+
+func TestMediaEditorIsUnavailableWithoutEditor(t *testing.T) {
+	router, adminToken, _ := mediaEditorRouter(t, nil)
+	if response := request(router, http.MethodGet, "/admin/media/7", adminToken, false); response.Code != http.StatusServiceUnavailable {
+		t.Fatalf("editor without store = %d", response.Code)
+	}
+}
@@ -0,0 +1,368 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultBangumiBase 是 Bangumi（bgm.tv）开放接口地址。
+const defaultBangumiBase = "https://api.bgm.tv"
+
+// bangumiEpisodePages 是分集列表最多翻的页数（每页 100 集），长篇番剧到这里为止。
+const bangumiEpisodePages = 20
+
+// errBangumiSubjectNotFound 表示 Bangumi 上找不到与这部作品对得上的条目。
+var errBangumiSubjectNotFound = errors.New("Bangumi subject not found")
+
+// BangumiProvider 从 Bangumi 同步动画条目和分集表。
+// 豆瓣的动画分集资料很少，TMDB 又常把国内分开标的几季并成一季；Bangumi 和豆瓣一样一季一个条目，
+// 集号也按季从 1 数起，所以动画的集标题和播出日期以它为准。入口同样是豆瓣 ID，按片名和年份找条目。
+type BangumiProvider struct {
+	client    *http.Client
+	store     Store
+	base      string
+	userAgent string
+	group     singleflight.Group
+	canonical CanonicalWriter
+	units     MediaUnitWriter
+}
+
+// BangumiOption 是 Bangumi 抓取器的可选装配项。
+type BangumiOption func(*BangumiProvider)
+
+// WithBangumiCanonicalWriter 注入规范媒体写入器。
+func WithBangumiCanonicalWriter(writer CanonicalWriter) BangumiOption {
+	return func(provider *BangumiProvider) { provider.canonical = writer }
+}
+
+// WithBangumiMediaUnitWriter 注入分集写入器，不注入时跳过分集同步。
+func WithBangumiMediaUnitWriter(writer MediaUnitWriter) BangumiOption {
+	return func(provider *BangumiProvider) { provider.units = writer }
+}
+
+// WithBangumiBase 覆盖 Bangumi 接口地址（测试用）。
+func WithBangumiBase(base string) BangumiOption {
+	return func(provider *BangumiProvider) { provider.base = strings.TrimRight(base, "/") }
+}
+
+// NewBangumiProvider 创建 Bangumi 抓取器。Bangumi 要求请求带上能说明来源的 User-Agent，留空时用默认值。
+func NewBangumiProvider(client *http.Client, store Store, userAgent string, options ...BangumiOption) *BangumiProvider {
+	if userAgent = strings.TrimSpace(userAgent); userAgent == "" {
+		userAgent = "MoovieBot/1.0 (https://github.com/TwoThreeWang/Moovie)"
+	}
+	provider := &BangumiProvider{client: client, store: store, base: defaultBangumiBase, userAgent: userAgent}
+	for _, option := range options {
+		option(provider)
+	}
+	return provider
+}
+
+// SyncAnime 同步一部动画的 Bangumi 条目和分集，同一条目的并发调用会被合并。
+func (provider *BangumiProvider) SyncAnime(ctx context.Context, doubanID string) error {
+	if !validDoubanID(doubanID) {
+		return workqueue.Terminal(fmt.Errorf("invalid Douban ID %q", doubanID))
+	}
+	_, err, _ := provider.group.Do(doubanID, func() (any, error) {
+		return nil, provider.sync(ctx, doubanID)
+	})
+	return err
+}
+
+// sync 的完整流程：按片名搜动画条目 → 抓条目详情 → 写规范媒体和 bangumi 外部 ID → 抓分集写 media_units。
+func (provider *BangumiProvider) sync(ctx context.Context, doubanID string) error {
+	movie, err := provider.store.FindByDoubanID(ctx, doubanID)
+	if err != nil {
+		return fmt.Errorf("find movie for Bangumi sync: %w", err)
+	}
+	if movie == nil {
+		return workqueue.Terminal(fmt.Errorf("movie not found: %s", doubanID))
+	}
+	subjectID, err := provider.findSubject(ctx, movie)
+	if err != nil {
+		if errors.Is(err, errBangumiSubjectNotFound) {
+			return workqueue.Terminal(err)
+		}
+		return err
+	}
+	subject, err := provider.fetchSubject(ctx, subjectID)
+	if err != nil {
+		return fmt.Errorf("fetch Bangumi subject: %w", err)
+	}
+	// 条目本身已经拿到，分集抓到一半失败也先写已有的部分，缺的下次刷新再补。
+	episodes, _ := provider.fetchEpisodes(ctx, subjectID)
+	mediaType := subject.mediaType()
+	payload := struct {
+		DoubanID  string           `json:"douban_id"`
+		BangumiID int              `json:"bangumi_id"`
+		Subject   *bangumiSubject  `json:"subject"`
+		Episodes  []bangumiEpisode `json:"episodes"`
+	}{movie.DoubanID, subjectID, subject, episodes}
+	canonical := mediaidentity.Media{
+		MediaType: mediaType, DoubanID: movie.DoubanID, Title: subject.displayName(),
+		OriginalTitle: strings.TrimSpace(subject.Name), Year: subject.year(), Poster: subject.Images.Large,
+		Summary: strings.TrimSpace(subject.Summary), MetadataStatus: "partial",
+	}
+	// 豆瓣外部 ID 由豆瓣同步按豆瓣自己的类型写入。Bangumi 按放送平台算出的类型可能和它不同（剧场版算电影），
+	// 在这里再写一条会给同一个豆瓣 ID 多出一行类型不对的映射。
+	mediaID, err := syncCanonicalMedia(ctx, provider.canonical, canonical, "bangumi", payload,
+		mediaidentity.ExternalID{Provider: "bangumi", ExternalType: mediaType, ExternalID: strconv.Itoa(subjectID), IsPrimary: true})
+	if err != nil {
+		return fmt.Errorf("save Bangumi media: %w", err)
+	}
+	if mediaType == "tv" && mediaID > 0 {
+		provider.syncEpisodes(ctx, mediaID, mediaidentity.TitleSeasonNumber(movie.Title, movie.OriginalTitle), episodes)
+	}
+	return nil
+}
+
+// 下面几个结构体只用来解析 Bangumi 的接口返回，字段按需保留。
+type bangumiSearchResponse struct {
+	Data []struct {
+		ID     int    `json:"id"`
+		Name   string `json:"name"`
+		NameCN string `json:"name_cn"`
+		Date   string `json:"date"`
+	} `json:"data"`
+}
+
+type bangumiSubject struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	NameCN   string `json:"name_cn"`
+	Summary  string `json:"summary"`
+	Date     string `json:"date"`
+	Platform string `json:"platform"`
+	Images   struct {
+		Large string `json:"large"`
+	} `json:"images"`
+	TotalEpisodes int `json:"total_episodes"`
+}
+
+// mediaType 把 Bangumi 的放送平台收敛成 movie / tv：剧场版是电影，其余（TV、WEB、OVA）按剧集。
+func (subject *bangumiSubject) mediaType() string {
+	if strings.TrimSpace(subject.Platform) == "剧场版" {
+		return "movie"
+	}
+	return "tv"
+}
+
+// displayName 优先用中文名，没有中文名的条目退回原名。
+func (subject *bangumiSubject) displayName() string {
+	if name := strings.TrimSpace(subject.NameCN); name != "" {
+		return name
+	}
+	return strings.TrimSpace(subject.Name)
+}
+
+// year 取首播日期里的年份。
+func (subject *bangumiSubject) year() string {
+	if len(subject.Date) >= 4 {
+		return subject.Date[:4]
+	}
+	return ""
+}
+
+// bangumiEpisode 是分集列表里的一集。Sort 是整个系列连续编号（续作接着前作往下数），
+// Ep 才是本季内的集号；特别篇的 Sort 可能带小数。
+type bangumiEpisode struct {
+	Type            int     `json:"type"`
+	Name            string  `json:"name"`
+	NameCN          string  `json:"name_cn"`
+	Sort            float64 `json:"sort"`
+	Ep              float64 `json:"ep"`
+	AirDate         string  `json:"airdate"`
+	DurationSeconds int     `json:"duration_seconds"`
+}
+
+type bangumiEpisodesResponse struct {
+	Data  []bangumiEpisode `json:"data"`
+	Total int              `json:"total"`
+}
+
+// findSubject 按片名搜动画条目：先用中文片名，搜不到再用原名。
+// 候选必须片名（或剧名加季号）对得上，年份最多差一年（跨年番的首播日期和豆瓣年份常差一年）。
+func (provider *BangumiProvider) findSubject(ctx context.Context, movie *Movie) (int, error) {
+	season := max(mediaidentity.TitleSeasonNumber(movie.Title, movie.OriginalTitle), 1)
+	seen := map[string]bool{}
+	for _, keyword := range []string{movie.Title, movie.OriginalTitle} {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" || seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+		body, err := json.Marshal(map[string]any{"keyword": keyword, "filter": map[string]any{"type": []int{2}}})
+		if err != nil {
+			return 0, err
+		}
+		var response bangumiSearchResponse
+		if err := provider.doJSON(ctx, http.MethodPost, provider.base+"/v0/search/subjects?limit=10", body, &response); err != nil {
+			return 0, fmt.Errorf("search Bangumi subjects: %w", err)
+		}
+		for _, result := range response.Data {
+			if result.ID <= 0 || !bangumiYearMatches(movie.Year, result.Date) {
+				continue
+			}
+			for _, name := range []string{result.NameCN, result.Name} {
+				if bangumiTitleMatches(movie, season, name) {
+					return result.ID, nil
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("%w for Douban ID %s", errBangumiSubjectNotFound, movie.DoubanID)
+}
+
+// bangumiTitleMatches 判断候选名是否就是这部作品：归一化后完全相同，或者剧名相同且季号一致（没标季号算第一季）。
+func bangumiTitleMatches(movie *Movie, season int, name string) bool {
+	key := mediaidentity.NormalizeTitle(name)
+	if key == "" {
+		return false
+	}
+	for _, title := range []string{movie.Title, movie.OriginalTitle} {
+		if title != "" && mediaidentity.NormalizeTitle(title) == key {
+			return true
+		}
+	}
+	base := mediaidentity.NormalizeTitle(mediaidentity.TitleBase(name))
+	if base == "" || max(mediaidentity.TitleSeasonNumber(name), 1) != season {
+		return false
+	}
+	for _, title := range []string{movie.Title, movie.OriginalTitle} {
+		if title != "" && mediaidentity.NormalizeTitle(mediaidentity.TitleBase(title)) == base {
+			return true
+		}
+	}
+	return false
+}
+
+// bangumiYearMatches 在任一侧缺年份时放行，否则最多允许差一年。
+func bangumiYearMatches(year, date string) bool {
+	if len(year) < 4 || len(date) < 4 {
+		return true
+	}
+	left, leftErr := strconv.Atoi(year[:4])
+	right, rightErr := strconv.Atoi(date[:4])
+	if leftErr != nil || rightErr != nil {
+		return true
+	}
+	return left-right <= 1 && right-left <= 1
+}
+
+// fetchSubject 抓条目详情。
+func (provider *BangumiProvider) fetchSubject(ctx context.Context, subjectID int) (*bangumiSubject, error) {
+	var subject bangumiSubject
+	if err := provider.doJSON(ctx, http.MethodGet, fmt.Sprintf("%s/v0/subjects/%d", provider.base, subjectID), nil, &subject); err != nil {
+		return nil, err
+	}
+	return &subject, nil
+}
+
+// fetchEpisodes 抓本篇分集（type=0），按页翻完或翻到上限为止。
+func (provider *BangumiProvider) fetchEpisodes(ctx context.Context, subjectID int) ([]bangumiEpisode, error) {
+	var episodes []bangumiEpisode
+	for page := range bangumiEpisodePages {
+		endpoint := fmt.Sprintf("%s/v0/episodes?subject_id=%d&type=0&limit=100&offset=%d", provider.base, subjectID, page*100)
+		var response bangumiEpisodesResponse
+		if err := provider.doJSON(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+			return episodes, err
+		}
+		episodes = append(episodes, response.Data...)
+		if len(response.Data) == 0 || len(episodes) >= response.Total {
+			break
+		}
+	}
+	return episodes, nil
+}
+
+// syncEpisodes 把本篇分集写入 media_units。季号沿用豆瓣片名里的季号，集号用 Bangumi 的季内集号，
+// 这样和资源站「第二季第 1 集」的标法对得上；系列连续编号存进 absolute_number。
+func (provider *BangumiProvider) syncEpisodes(ctx context.Context, mediaID, season int, episodes []bangumiEpisode) {
+	if provider.units == nil {
+		return
+	}
+	season = max(season, 1)
+	for _, episode := range episodes {
+		if episode.Type != 0 {
+			continue
+		}
+		number := bangumiWholeNumber(episode.Ep)
+		if number <= 0 {
+			number = bangumiWholeNumber(episode.Sort)
+		}
+		if number <= 0 {
+			continue
+		}
+		title := strings.TrimSpace(episode.NameCN)
+		if title == "" {
+			title = strings.TrimSpace(episode.Name)
+		}
+		unit := mediaidentity.MediaUnit{
+			MediaID:        mediaID,
+			UnitType:       "episode",
+			SeasonNumber:   season,
+			EpisodeNumber:  number,
+			AbsoluteNumber: bangumiWholeNumber(episode.Sort),
+			EpisodeKey:     fmt.Sprintf("S%02dE%02d", season, number),
+			Title:          title,
+			RuntimeMinutes: episode.DurationSeconds / 60,
+		}
+		if episode.AirDate != "" {
+			if parsed, err := parseDate(episode.AirDate); err == nil {
+				unit.AirDate = parsed
+			}
+		}
+		_, _ = provider.units.EnsureMediaUnit(ctx, unit)
+	}
+}
+
+// bangumiWholeNumber 只接受整数集号，总集篇之类的 12.5 集返回 0。
+func bangumiWholeNumber(value float64) int {
+	if value <= 0 || value != math.Trunc(value) {
+		return 0
+	}
+	return int(value)
+}
+
+// doJSON 是所有 Bangumi 请求的公共出口。
+func (provider *BangumiProvider) doJSON(ctx context.Context, method, endpoint string, body []byte, destination any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("User-Agent", provider.userAgent)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := provider.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return workqueue.Terminal(fmt.Errorf("%w: %s", errBangumiSubjectNotFound, endpoint))
+	}
+	if response.StatusCode != http.StatusOK {
+		return classifyUpstreamStatus("Bangumi", response)
+	}
+	if err := json.NewDecoder(response.Body).Decode(destination); err != nil {
+		return fmt.Errorf("decode Bangumi response: %w", err)
+	}
+	return nil
+}
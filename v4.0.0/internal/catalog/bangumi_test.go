@@ -0,0 +1,142 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+// movieStoreStub 只实现抓取器用到的 FindByDoubanID。
+type movieStoreStub struct {
+	Store
+	movie *Movie
+}
+
+func (store movieStoreStub) FindByDoubanID(context.Context, string) (*Movie, error) {
+	return store.movie, nil
+}
+
+// bangumiFixtureServer 用 testdata/bangumi 下录下来的接口返回模拟 api.bgm.tv。
+func bangumiFixtureServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var keywords []string
+	fixture := func(writer http.ResponseWriter, name string) {
+		body, err := os.ReadFile(filepath.Join("testdata", "bangumi", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(body)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("User-Agent") == "" || request.Header.Get("User-Agent") == "Go-http-client/1.1" {
+			t.Errorf("Bangumi request without a descriptive User-Agent: %s", request.URL)
+		}
+		switch {
+		case request.Method == http.MethodPost && request.URL.Path == "/v0/search/subjects":
+			var body struct {
+				Keyword string `json:"keyword"`
+				Filter  struct {
+					Type []int `json:"type"`
+				} `json:"filter"`
+			}
+			if err := json.NewDecoder(request.Body).Decode(&body); err != nil || len(body.Filter.Type) != 1 || body.Filter.Type[0] != 2 {
+				t.Errorf("search body = %+v (%v)", body, err)
+			}
+			keywords = append(keywords, body.Keyword)
+			fixture(writer, "search_subjects.json")
+		case request.URL.Path == "/v0/subjects/369304":
+			fixture(writer, "subject_369304.json")
+		case request.URL.Path == "/v0/episodes" && request.URL.Query().Get("subject_id") == "369304":
+			if request.URL.Query().Get("type") != "0" {
+				t.Errorf("episodes query = %s", request.URL.RawQuery)
+			}
+			fixture(writer, "episodes_369304.json")
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &keywords
+}
+
+func TestBangumiProviderWritesSeasonSubjectAndEpisodes(t *testing.T) {
+	server, keywords := bangumiFixtureServer(t)
+	store := movieStoreStub{movie: &Movie{DoubanID: "35734957", Title: "咒术回战 第二季", Year: "2023", Genres: "动作/动画/奇幻"}}
+	canonical := &canonicalWriterStub{}
+	units := &mediaUnitWriterStub{}
+	provider := NewBangumiProvider(server.Client(), store, "", WithBangumiBase(server.URL),
+		WithBangumiCanonicalWriter(canonical), WithBangumiMediaUnitWriter(units))
+	if err := provider.SyncAnime(t.Context(), "35734957"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*keywords) != 1 || (*keywords)[0] != "咒术回战 第二季" {
+		t.Fatalf("search keywords = %v", *keywords)
+	}
+	if canonical.media.Title != "咒术回战 第二季" || canonical.media.OriginalTitle != "呪術廻戦 懐玉・玉折／渋谷事変" || canonical.media.Year != "2023" || canonical.media.MediaType != "tv" {
+		t.Fatalf("canonical media = %+v", canonical.media)
+	}
+	// 只写 bangumi 自己的外部 ID，豆瓣的由豆瓣同步按豆瓣的类型写。
+	if len(canonical.externalIDs) != 1 || canonical.externalIDs[0].Provider != "bangumi" || canonical.externalIDs[0].ExternalID != "369304" || canonical.externalIDs[0].ExternalType != "tv" {
+		t.Fatalf("external IDs = %+v", canonical.externalIDs)
+	}
+	if canonical.snapshotProvider != "bangumi" {
+		t.Fatalf("snapshot provider = %q", canonical.snapshotProvider)
+	}
+	// 续作的 sort 接着第一季往下数，media_units 里要用季内集号，和资源站的「第二季第 1 集」对上。
+	if len(units.units) != 2 {
+		t.Fatalf("units = %+v", units.units)
+	}
+	first, second := units.units[0], units.units[1]
+	if first.EpisodeKey != "S02E01" || first.SeasonNumber != 2 || first.EpisodeNumber != 1 || first.AbsoluteNumber != 25 ||
+		first.Title != "怀玉" || first.AirDate.Format("2006-01-02") != "2023-07-06" || first.RuntimeMinutes != 24 {
+		t.Fatalf("first episode = %+v", first)
+	}
+	if second.EpisodeKey != "S02E02" || second.Title != "懐玉-弐-" {
+		t.Fatalf("second episode should fall back to the original name: %+v", second)
+	}
+}
+
+func TestBangumiProviderRejectsUnmatchedSubjects(t *testing.T) {
+	server, keywords := bangumiFixtureServer(t)
+	// 第三季在搜索结果里没有，第一季和第二季的季号都对不上，不能随便挑一个绑上。
+	store := movieStoreStub{movie: &Movie{DoubanID: "36000001", Title: "咒术回战 第三季", OriginalTitle: "Jujutsu Kaisen Season 3", Year: "2026"}}
+	canonical := &canonicalWriterStub{}
+	provider := NewBangumiProvider(server.Client(), store, "MoovieTest/1.0", WithBangumiBase(server.URL), WithBangumiCanonicalWriter(canonical))
+	if err := provider.SyncAnime(t.Context(), "36000001"); !workqueue.IsTerminal(err) {
+		t.Fatalf("unmatched subject error = %v", err)
+	}
+	if len(*keywords) != 2 || len(canonical.externalIDs) != 0 {
+		t.Fatalf("keywords = %v, external IDs = %+v", *keywords, canonical.externalIDs)
+	}
+	if err := provider.SyncAnime(t.Context(), "not-an-id"); !workqueue.IsTerminal(err) {
+		t.Fatalf("invalid Douban ID error = %v", err)
+	}
+}
+
+func TestBangumiTitleMatchesSeasonsAndYears(t *testing.T) {
+	movie := &Movie{Title: "进击的巨人 第二季", OriginalTitle: "進撃の巨人 Season 2"}
+	for name, expected := range map[string]bool{
+		"进击的巨人 第二季":      true,
+		"進撃の巨人 Season 2": true,
+		"进击的巨人":          false,
+		"进击的巨人 第三季":      false,
+		"":               false,
+	} {
+		if bangumiTitleMatches(movie, 2, name) != expected {
+			t.Fatalf("bangumiTitleMatches(%q) = %v", name, !expected)
+		}
+	}
+	if !bangumiYearMatches("2024", "2023-12-30") || bangumiYearMatches("2024", "2021-04-01") || !bangumiYearMatches("", "2021-04-01") {
+		t.Fatal("year tolerance changed")
+	}
+	if bangumiWholeNumber(12.5) != 0 || bangumiWholeNumber(13) != 13 {
+		t.Fatal("whole episode numbers changed")
+	}
+}
@@ -0,0 +1,179 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/requestmeta"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/TwoThreeWang/Moovie/new/internal/search"
+	"github.com/gin-gonic/gin"
+)
+
+// CollectionView 是合集在页面上的样子：按观看顺序排好的成员，加上当前用户在整个合集上的进度。
+// 未登录时 SignedIn 为 false，进度相关的字段都是零。
+type CollectionView struct {
+	mediaidentity.Collection
+	Entries  []CollectionEntry
+	SignedIn bool
+	Watched  int
+	Watching int
+}
+
+// CollectionEntry 是合集里的一部作品。Progress 是 watched / watching / 空串。
+type CollectionEntry struct {
+	mediaidentity.CollectionItem
+	Progress string
+	Current  bool
+	Playback search.PlaybackSummary
+}
+
+// Path 是合集页地址。
+func (view CollectionView) Path() string {
+	return "/collection/" + strconv.Itoa(view.ID)
+}
+
+// Series 表示这是一部剧的各季，页面上按「第 N 季」展示。
+func (view CollectionView) Series() bool {
+	return view.Kind == mediaidentity.CollectionSeries
+}
+
+// Percent 是看完的成员占比，给进度条用。
+func (view CollectionView) Percent() int {
+	if len(view.Entries) == 0 {
+		return 0
+	}
+	return view.Watched * 100 / len(view.Entries)
+}
+
+// NextUp 是按顺序第一部还没看完的作品，全部看完时返回 nil。
+func (view CollectionView) NextUp() *CollectionEntry {
+	for i := range view.Entries {
+		if view.Entries[i].Progress != mediaidentity.CollectionWatched {
+			return &view.Entries[i]
+		}
+	}
+	return nil
+}
+
+// seriesSeasons 把合集成员转成季度导航的结构，相似推荐据此排除同系列作品。
+func (view *CollectionView) seriesSeasons() []SeriesSeason {
+	if view == nil {
+		return nil
+	}
+	seasons := make([]SeriesSeason, 0, len(view.Entries))
+	for _, entry := range view.Entries {
+		seasons = append(seasons, SeriesSeason{MediaID: entry.MediaID, DoubanID: entry.DoubanID, Title: entry.Title,
+			Year: entry.Year, Rating: entry.Rating, SeasonNumber: entry.SeasonNumber, Current: entry.Current})
+	}
+	return seasons
+}
+
+// DetailKey 是成员的详情页标识，规则与 Movie.DetailKey 一致。
+func (entry CollectionEntry) DetailKey() string {
+	return Movie{ID: entry.MediaID, DoubanID: entry.DoubanID}.DetailKey()
+}
+
+// Label 是导航上的短名：剧集写季号，电影合集写片名。
+func (entry CollectionEntry) Label() string {
+	if entry.SeasonNumber > 0 {
+		return fmt.Sprintf("第%d季", entry.SeasonNumber)
+	}
+	return entry.Title
+}
+
+// collectionView 读取作品所属的合集，给详情页的「按顺序观看」导航用；不足两部时不展示。
+func (handler *Handler) collectionView(ctx context.Context, movie *Movie, userID int) *CollectionView {
+	if handler.collections == nil || movie.ID <= 0 {
+		return nil
+	}
+	collection, err := handler.collections.FindMediaCollection(ctx, movie.ID)
+	if err != nil {
+		if !errors.Is(err, mediaidentity.ErrCollectionNotFound) {
+			requestmeta.Logger(ctx).Warn("load media collection failed", "media_id", movie.ID, "error", err)
+		}
+		return nil
+	}
+	view, err := handler.loadCollection(ctx, collection.ID, userID, movie.ID, false)
+	if err != nil {
+		requestmeta.Logger(ctx).Warn("load collection failed", "collection_id", collection.ID, "error", err)
+		return nil
+	}
+	if len(view.Entries) < 2 {
+		return nil
+	}
+	return view
+}
+
+// loadCollection 读取合集成员、用户进度，合集页另外带上每部作品的可播状态。
+func (handler *Handler) loadCollection(ctx context.Context, collectionID, userID, currentMediaID int, withPlayback bool) (*CollectionView, error) {
+	collection, err := handler.collections.FindCollection(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	progress := map[int]string{}
+	if userID > 0 {
+		if progress, err = handler.collections.ListCollectionProgress(ctx, userID, collectionID); err != nil {
+			requestmeta.Logger(ctx).Warn("load collection progress failed", "collection_id", collectionID, "error", err)
+			progress = map[int]string{}
+		}
+	}
+	view := &CollectionView{Collection: collection, SignedIn: userID > 0, Entries: make([]CollectionEntry, 0, len(collection.Items))}
+	view.Items = nil
+	mediaIDs := make([]int, 0, len(collection.Items))
+	for _, item := range collection.Items {
+		entry := CollectionEntry{CollectionItem: item, Progress: progress[item.MediaID], Current: item.MediaID == currentMediaID,
+			Playback: search.PlaybackSummary{MediaID: item.MediaID, State: search.PlaybackNone}}
+		switch entry.Progress {
+		case mediaidentity.CollectionWatched:
+			view.Watched++
+		case mediaidentity.CollectionWatching:
+			view.Watching++
+		}
+		view.Entries = append(view.Entries, entry)
+		mediaIDs = append(mediaIDs, item.MediaID)
+	}
+	if reader, ok := handler.resources.(search.PlaybackSummaryReader); ok && withPlayback && len(mediaIDs) > 0 {
+		if summaries, summaryErr := reader.ListPlaybackSummaries(ctx, mediaIDs); summaryErr == nil {
+			for i := range view.Entries {
+				if summary, found := summaries[view.Entries[i].MediaID]; found {
+					view.Entries[i].Playback = summary
+				}
+			}
+		}
+	}
+	return view, nil
+}
+
+// collection 渲染合集页：全部成员按观看顺序排列，登录用户能看到自己在整个系列上的进度。
+func (handler *Handler) collection(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, convErr := strconv.Atoi(strings.TrimSpace(c.Param("id")))
+	var view *CollectionView
+	err := mediaidentity.ErrCollectionNotFound
+	if handler.collections != nil && convErr == nil && id > 0 {
+		view, err = handler.loadCollection(ctx, id, auth.UserID(c), 0, true)
+	}
+	if err != nil {
+		if !errors.Is(err, mediaidentity.ErrCollectionNotFound) {
+			requestmeta.Logger(ctx).Warn("load collection failed", "collection_id", id, "error", err)
+		}
+		c.HTML(http.StatusNotFound, "404.html", platformweb.NewData(c, handler.config, platformweb.Metadata{Title: "合集未找到 - " + handler.config.SiteName}, nil))
+		return
+	}
+	description := view.Overview
+	if description == "" {
+		description = fmt.Sprintf("《%s》全系列共 %d 部，按观看顺序排列并标注本站可播放的资源。", view.Name, len(view.Entries))
+	}
+	c.HTML(http.StatusOK, "collection.html", platformweb.NewData(c, handler.config, platformweb.Metadata{
+		Title:       view.Name + " - 全系列观看顺序 - " + handler.config.SiteName,
+		Description: truncateDescription(description, 150), Keywords: strings.Join([]string{view.Name, "观看顺序", "全系列", "在线观看"}, ","),
+		Cover: proxyImageURL(view.Poster), Canonical: handler.config.SiteURL + view.Path(),
+	}, gin.H{"Collection": view}))
+}
@@ -228,14 +228,19 @@ type rexxarMovie struct {
 	Pic struct {
 		Large string `json:"large"`
 	} `json:"pic"`
-	Directors []struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-	} `json:"directors"`
-	Actors []struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-	} `json:"actors"`
+	Directors []rexxarPerson `json:"directors"`
+	Actors    []rexxarPerson `json:"actors"`
+}
+
+// rexxarPerson 是 rexxar 详情里的一位导演或演员。
+type rexxarPerson struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	LatinName string `json:"latin_name"`
+	Avatar    struct {
+		Large string `json:"large"`
+	} `json:"avatar"`
+	Character string `json:"character"`
 }
 
 // Fetch 抓一部影片的主资料。豆瓣按 movie/tv/show 分了三个端点，且事先不知道是哪一种，
@@ -274,6 +279,11 @@ func (provider *DoubanProvider) Fetch(ctx context.Context, doubanID string, _ bo
 					}
 				}
 			}
+			if creditWriter, ok := provider.canonical.(mediaidentity.CreditWriter); ok && mediaID > 0 {
+				if err := creditWriter.ReplaceCredits(ctx, mediaID, "douban", doubanCredits(response)); err != nil {
+					return nil, fmt.Errorf("save Douban credits: %w", err)
+				}
+			}
 			return nil, nil
 		}
 		return nil, attempts.err("fetch Douban movie " + doubanID)
@@ -504,6 +514,23 @@ func mapRexxarMovie(response rexxarMovie) Movie {
 	return movie
 }
 
+// doubanCredits 把 rexxar 的导演和演员转成 media_credits 的写入结构，顺序即豆瓣的署名顺序。
+func doubanCredits(response rexxarMovie) []mediaidentity.Credit {
+	credits := make([]mediaidentity.Credit, 0, len(response.Directors)+len(response.Actors))
+	for _, group := range []struct {
+		role   string
+		people []rexxarPerson
+	}{{mediaidentity.CreditDirector, response.Directors}, {mediaidentity.CreditActor, response.Actors}} {
+		for index, person := range group.people {
+			credits = append(credits, mediaidentity.Credit{Role: group.role, Order: index,
+				Character: strings.TrimSpace(strings.TrimPrefix(person.Character, "饰")),
+				Person: mediaidentity.Person{DoubanID: person.ID, Name: person.Name,
+					OriginalName: person.LatinName, Avatar: person.Avatar.Large}})
+		}
+	}
+	return credits
+}
+
 // fallbackMovieType 是本地数据库兜底专用的分类器。豆瓣真实的 genres 字段
 // 只是「剧情/动作/悬疑」这类内容标签，几乎不会出现「电视剧」「综艺」字样，
 // inferMovieType 在这些词上的匹配对本地库里的真实数据基本不命中——直接拿它给
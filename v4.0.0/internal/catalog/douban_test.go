@@ -1,12 +1,14 @@
 package catalog
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
 )
 
@@ -74,6 +76,27 @@ func TestCanonicalDoubanMediaTypeCollapsesNonMovieEndpointsToTV(t *testing.T) {
 	}
 }
 
+func TestDoubanCreditsKeepPersonIDsCharactersAndOrder(t *testing.T) {
+	var response rexxarMovie
+	if err := json.Unmarshal([]byte(`{"directors":[{"id":"1047973","name":"弗兰克·德拉邦特","latin_name":"Frank Darabont"}],
+"actors":[{"id":"1054521","name":"蒂姆·罗宾斯","latin_name":"Tim Robbins","avatar":{"large":"https://img.doubanio.com/tim.jpg"},"character":"饰 安迪"},
+{"id":"1054534","name":"摩根·弗里曼","character":"饰 瑞德"}]}`), &response); err != nil {
+		t.Fatal(err)
+	}
+	credits := doubanCredits(response)
+	if len(credits) != 3 || credits[0].Role != mediaidentity.CreditDirector || credits[0].Person.OriginalName != "Frank Darabont" {
+		t.Fatalf("credits = %+v", credits)
+	}
+	tim := credits[1]
+	if tim.Role != mediaidentity.CreditActor || tim.Order != 0 || tim.Person.DoubanID != "1054521" ||
+		tim.Person.Avatar != "https://img.doubanio.com/tim.jpg" || tim.Character != "安迪" {
+		t.Fatalf("actor credit = %+v", tim)
+	}
+	if credits[2].Order != 1 {
+		t.Fatalf("second actor order = %d", credits[2].Order)
+	}
+}
+
 func TestDoubanProviderFetchesReviewsIntoExistingMovie(t *testing.T) {
 	client := &http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
 		return jsonResponse(request, http.StatusOK, `{"interests":[{"comment":"经典","create_time":"2026-07-01","sharing_url":"https://douban.example/1","user":{"name":"用户甲"}}]}`), nil
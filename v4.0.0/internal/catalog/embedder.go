@@ -0,0 +1,177 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 向量后端的取值，对应 EMBEDDING_PROVIDER。
+const (
+	EmbeddingProviderOllama = "ollama"
+	EmbeddingProviderOpenAI = "openai"
+)
+
+// Embedder 把一段文本变成向量。Model 是带后端前缀的模型名（如 ollama:bge-m3），
+// 和 Dimensions 一起写进每一行，换模型时靠它判断哪些向量已经过期。
+type Embedder interface {
+	Model() string
+	Dimensions() int
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// NewEmbedder 按配置选择向量后端。Provider 为空按 Ollama 处理，维度为 0 用 768。
+func NewEmbedder(client *http.Client, cfg EmbeddingConfig) (Embedder, error) {
+	dimensions := cfg.Dimensions
+	if dimensions <= 0 {
+		dimensions = embeddingDimensions
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.Provider)) {
+	case "", EmbeddingProviderOllama:
+		model := cfg.Model
+		if model == "" {
+			model = cfg.OllamaModel
+		}
+		return NewOllamaEmbedder(client, cfg.OllamaHost, model, dimensions), nil
+	case EmbeddingProviderOpenAI:
+		if cfg.APIURL == "" || cfg.Model == "" {
+			return nil, fmt.Errorf("openai embedder requires api url and model")
+		}
+		return NewOpenAIEmbedder(client, cfg.APIURL, cfg.APIKey, cfg.Model, dimensions), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", cfg.Provider)
+	}
+}
+
+// OllamaEmbedder 调本机或内网的 Ollama /api/embeddings。
+type OllamaEmbedder struct {
+	client     *http.Client
+	host       string
+	model      string
+	dimensions int
+}
+
+// NewOllamaEmbedder 创建 Ollama 后端，未配置时默认连本机 Ollama。
+func NewOllamaEmbedder(client *http.Client, host, model string, dimensions int) *OllamaEmbedder {
+	host = strings.TrimRight(host, "/")
+	if host == "" {
+		host = "http://localhost:11434"
+	}
+	if model == "" {
+		model = defaultOllamaModel
+	}
+	return &OllamaEmbedder{client: client, host: host, model: model, dimensions: dimensions}
+}
+
+// Model 返回带 ollama: 前缀的模型名。
+func (embedder *OllamaEmbedder) Model() string { return EmbeddingProviderOllama + ":" + embedder.model }
+
+// Dimensions 返回配置的向量维度。
+func (embedder *OllamaEmbedder) Dimensions() int { return embedder.dimensions }
+
+// Embed 调 Ollama 生成向量。
+func (embedder *OllamaEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	payload := struct {
+		Model  string `json:"model"`
+		Prompt string `json:"prompt"`
+	}{Model: embedder.model, Prompt: text}
+	var response struct {
+		Embedding []float32 `json:"embedding"`
+	}
+	if err := postJSON(ctx, embedder.client, embedder.host+"/api/embeddings", payload, &response, ""); err != nil {
+		return nil, fmt.Errorf("generate Ollama embedding: %w", err)
+	}
+	return checkEmbeddingDimensions(response.Embedding, embedder.dimensions)
+}
+
+// OpenAIEmbedder 调 OpenAI 兼容的 /embeddings 接口。除了 OpenAI 本身，
+// Cloudflare Workers AI、SiliconFlow、vLLM 等都实现了这个协议。
+type OpenAIEmbedder struct {
+	client     *http.Client
+	baseURL    string
+	apiKey     string
+	model      string
+	dimensions int
+}
+
+// NewOpenAIEmbedder 创建 OpenAI 兼容后端，baseURL 指到 /v1 这一级。
+func NewOpenAIEmbedder(client *http.Client, baseURL, apiKey, model string, dimensions int) *OpenAIEmbedder {
+	return &OpenAIEmbedder{client: client, baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, model: model, dimensions: dimensions}
+}
+
+// Model 返回带 openai: 前缀的模型名。
+func (embedder *OpenAIEmbedder) Model() string { return EmbeddingProviderOpenAI + ":" + embedder.model }
+
+// Dimensions 返回配置的向量维度。
+func (embedder *OpenAIEmbedder) Dimensions() int { return embedder.dimensions }
+
+// Embed 调 /embeddings 生成向量。text-embedding-3 这类模型支持裁剪维度，
+// 所以请求里带上 dimensions；不支持的服务会忽略它，维度不对时由下面的校验兜住。
+func (embedder *OpenAIEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	payload := struct {
+		Model      string `json:"model"`
+		Input      string `json:"input"`
+		Dimensions int    `json:"dimensions,omitempty"`
+	}{Model: embedder.model, Input: text, Dimensions: embedder.dimensions}
+	var response struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := postJSON(ctx, embedder.client, embedder.baseURL+"/embeddings", payload, &response, embedder.apiKey); err != nil {
+		return nil, fmt.Errorf("generate OpenAI embedding: %w", err)
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("embedding api returned error: %s", response.Error.Message)
+	}
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("embedding api returned no data")
+	}
+	return checkEmbeddingDimensions(response.Data[0].Embedding, embedder.dimensions)
+}
+
+// checkEmbeddingDimensions 拦下维度不符的向量。维度错了写库会被 vector(N) 拒绝，
+// 在这里报错能直接指出是模型配置的问题。
+func checkEmbeddingDimensions(vector []float32, dimensions int) ([]float32, error) {
+	if len(vector) != dimensions {
+		return nil, fmt.Errorf("embedding dimension mismatch: want %d, got %d", dimensions, len(vector))
+	}
+	return vector, nil
+}
+
+// postJSON 是向量后端和 AI Gateway 共用的 POST 封装。
+func postJSON(ctx context.Context, client *http.Client, endpoint string, payload, destination any, bearerToken string) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if bearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return classifyUpstreamStatus("upstream", response)
+	}
+	if err := json.NewDecoder(response.Body).Decode(destination); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package catalog
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewEmbedderSelectsBackendFromConfig(t *testing.T) {
+	ollama, err := NewEmbedder(nil, EmbeddingConfig{OllamaModel: "bge-test"})
+	if err != nil || ollama.Model() != "ollama:bge-test" || ollama.Dimensions() != embeddingDimensions {
+		t.Fatalf("default embedder = %v/%v", ollama, err)
+	}
+	// EMBEDDING_MODEL 优先于 OLLAMA_MODEL，后者只是为了兼容旧配置。
+	override, _ := NewEmbedder(nil, EmbeddingConfig{Model: "bge-m3", Dimensions: 1024, OllamaModel: "bge-test"})
+	if override.Model() != "ollama:bge-m3" || override.Dimensions() != 1024 {
+		t.Fatalf("ollama override = %s/%d", override.Model(), override.Dimensions())
+	}
+	openai, err := NewEmbedder(nil, EmbeddingConfig{Provider: "OpenAI", APIURL: "https://api.test/v1", Model: "text-embedding-3-small", Dimensions: 512})
+	if err != nil || openai.Model() != "openai:text-embedding-3-small" || openai.Dimensions() != 512 {
+		t.Fatalf("openai embedder = %v/%v", openai, err)
+	}
+	if _, err := NewEmbedder(nil, EmbeddingConfig{Provider: "openai"}); err == nil {
+		t.Fatal("openai embedder without endpoint was accepted")
+	}
+	if _, err := NewEmbedder(nil, EmbeddingConfig{Provider: "cohere"}); err == nil {
+		t.Fatal("unknown provider was accepted")
+	}
+}
+
+func TestOpenAIEmbedderPostsInputAndReadsFirstVector(t *testing.T) {
+	client := &http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		if request.URL.String() != "https://api.test/v1/embeddings" || request.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Fatalf("request = %s auth=%q", request.URL, request.Header.Get("Authorization"))
+		}
+		var payload struct {
+			Model      string `json:"model"`
+			Input      string `json:"input"`
+			Dimensions int    `json:"dimensions"`
+		}
+		_ = json.NewDecoder(request.Body).Decode(&payload)
+		if payload.Model != "text-embedding-3-small" || payload.Input != "越狱 希望" || payload.Dimensions != 3 {
+			t.Fatalf("payload = %+v", payload)
+		}
+		return testJSONResponse(request, http.StatusOK, `{"data":[{"embedding":[0.1,0.2,0.3]}]}`), nil
+	})}
+	embedder := NewOpenAIEmbedder(client, "https://api.test/v1/", "sk-test", "text-embedding-3-small", 3)
+	vector, err := embedder.Embed(t.Context(), "越狱 希望")
+	if err != nil || len(vector) != 3 || vector[2] != 0.3 {
+		t.Fatalf("vector/error = %v/%v", vector, err)
+	}
+}
+
+func TestEmbeddersRejectWrongDimensions(t *testing.T) {
+	client := &http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		if request.URL.Path == "/api/embeddings" {
+			return testJSONResponse(request, http.StatusOK, `{"embedding":[0.1,0.2]}`), nil
+		}
+		return testJSONResponse(request, http.StatusOK, `{"data":[{"embedding":[0.1,0.2]}]}`), nil
+	})}
+	for _, embedder := range []Embedder{
+		NewOllamaEmbedder(client, "https://ollama.test", "bge-test", 768),
+		NewOpenAIEmbedder(client, "https://api.test/v1", "", "text-embedding-3-small", 1536),
+	} {
+		if _, err := embedder.Embed(t.Context(), "文本"); err == nil || !strings.Contains(err.Error(), "dimension mismatch") {
+			t.Fatalf("%s accepted wrong dimension: %v", embedder.Model(), err)
+		}
+	}
+}
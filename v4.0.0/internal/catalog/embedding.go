@@ -1,7 +1,6 @@
 package catalog
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -12,18 +11,29 @@ import (
 	"strings"
 	"time"
 
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
 	"golang.org/x/sync/singleflight"
 )
 
-// embeddingDimensions 是向量维度，必须和数据库里 vector 列的维度一致。
+// embeddingDimensions 是默认向量维度，对应默认模型 bge-base-zh-v1.5。
+// 换成别的维度时由 embedding_migration 任务重建 vector 列，不必手工改表。
 const embeddingDimensions = 768
 
+// defaultOllamaModel 是未配置模型时使用的 Ollama 模型。
+const defaultOllamaModel = "quentinz/bge-base-zh-v1.5"
+
 // bge-base-zh-v1.5 的最大序列长度是 512 token，中文大约一字一 token。超出部分会被
 // 模型静默丢弃，所以送进去的文本必须留足余量，不能按字符数随手截。
 const maxEmbeddingRunes = 450
 
-// EmbeddingConfig 是向量生成的配置：Ollama 是必需的，AI Gateway 是可选的语义改写层。
+// EmbeddingConfig 是向量生成的配置：向量后端是必需的，AI Gateway 是可选的语义改写层。
 type EmbeddingConfig struct {
+	// Provider 选择向量后端（ollama / openai），为空按 ollama。Model 为空时 Ollama 沿用 OllamaModel。
+	Provider    string
+	Model       string
+	Dimensions  int
+	APIURL      string
+	APIKey      string
 	OllamaHost  string
 	OllamaModel string
 	// AI Gateway 可选。配置后先把元数据改写成高语义密度的短描述再做 embedding，
@@ -34,9 +44,12 @@ type EmbeddingConfig struct {
 }
 
 // EmbeddingService 给影片生成语义向量，供「相似推荐」和「猜你喜欢」使用。
-// 流程：元数据 →（可选）AI 改写成高密度描述 → Ollama 生成 768 维向量 → 写回 media.embedding。
+// 流程：元数据 →（可选）AI 改写成高密度描述 → 向量后端生成向量 → 按代际写回 media。
 type EmbeddingService struct {
 	client *http.Client
+	// embedder 由配置决定；配置有误时 embedderErr 非空，每次生成都原样报出来。
+	embedder    Embedder
+	embedderErr error
 	// aiClient 专供 AI Gateway。它必须和抓取用的 Client 分开：后者的超时是按搜索源
 	// 配的（默认 10 秒），而一次非流式 chat completion 几乎不可能在 10 秒内返回响应头，
 	// 共用等于让语义改写「必然超时」，重试三次也全是徒劳。
@@ -61,16 +74,20 @@ func WithEmbeddingAIClient(client *http.Client) EmbeddingOption {
 	}
 }
 
+// WithEmbedder 直接指定向量后端，覆盖配置里的选择。
+func WithEmbedder(embedder Embedder) EmbeddingOption {
+	return func(service *EmbeddingService) {
+		if embedder != nil {
+			service.embedder, service.embedderErr = embedder, nil
+		}
+	}
+}
+
 // NewEmbeddingService 创建向量服务，未配置时默认连本机 Ollama。
 func NewEmbeddingService(client *http.Client, store Store, cfg EmbeddingConfig, options ...EmbeddingOption) *EmbeddingService {
-	cfg.OllamaHost = strings.TrimRight(cfg.OllamaHost, "/")
-	if cfg.OllamaHost == "" {
-		cfg.OllamaHost = "http://localhost:11434"
-	}
-	if cfg.OllamaModel == "" {
-		cfg.OllamaModel = "quentinz/bge-base-zh-v1.5"
-	}
+	embedder, err := NewEmbedder(client, cfg)
 	service := &EmbeddingService{client: client, aiClient: client, store: store, config: cfg,
+		embedder: embedder, embedderErr: err,
 		retryDelays: []time.Duration{3 * time.Second, 5 * time.Second, 8 * time.Second}}
 	for _, option := range options {
 		option(service)
@@ -81,41 +98,99 @@ func NewEmbeddingService(client *http.Client, store Store, cfg EmbeddingConfig,
 // Enrich 为一部影片生成向量，同一条目的并发调用会被合并成一次。
 func (service *EmbeddingService) Enrich(ctx context.Context, doubanID string) error {
 	_, err, _ := service.group.Do(doubanID, func() (any, error) {
-		return nil, service.enrich(ctx, doubanID)
+		movie, err := service.store.FindByDoubanID(ctx, doubanID)
+		if err != nil {
+			return nil, fmt.Errorf("find movie for embedding: %w", err)
+		}
+		if movie == nil {
+			return nil, fmt.Errorf("movie not found: %s", doubanID)
+		}
+		return nil, service.enrich(ctx, movie)
 	})
 	return err
 }
 
-// enrich 先比对语义哈希：元数据没变且向量维度正确就直接跳过，不重复调用模型。
-func (service *EmbeddingService) enrich(ctx context.Context, doubanID string) error {
-	movie, err := service.store.FindByDoubanID(ctx, doubanID)
-	if err != nil {
-		return fmt.Errorf("find movie for embedding: %w", err)
-	}
-	if movie == nil {
-		return fmt.Errorf("movie not found: %s", doubanID)
+// EnrichMedia 按 media.id 生成向量，供没有豆瓣 ID 的作品使用。
+// singleflight 的键带 m 前缀，不会和同号的豆瓣 ID 撞在一起。
+func (service *EmbeddingService) EnrichMedia(ctx context.Context, mediaID int) error {
+	_, err, _ := service.group.Do(fmt.Sprintf("m%d", mediaID), func() (any, error) {
+		movie, err := service.store.FindByID(ctx, mediaID)
+		if err != nil {
+			return nil, fmt.Errorf("find movie for embedding: %w", err)
+		}
+		if movie == nil {
+			return nil, fmt.Errorf("media not found: %d", mediaID)
+		}
+		return nil, service.enrich(ctx, movie)
+	})
+	return err
+}
+
+// enrich 先比对语义哈希：元数据没变、向量出自当前模型且维度正确就直接跳过，不重复调用模型。
+func (service *EmbeddingService) enrich(ctx context.Context, movie *Movie) error {
+	if service.embedderErr != nil {
+		return workqueue.Terminal(service.embedderErr)
 	}
 	// 哈希只对元数据取，不对最终送进模型的文本取。AI 每次改写的措辞都不同，
 	// 如果哈希包含 AI 输出，worker 每轮都会判定「内容变了」而无限重算。
 	metadata := strings.TrimSpace(embeddingInput(*movie))
 	semanticHash := contentHash(metadata)
-	if movie.EmbeddingSemanticHash == semanticHash && len(movie.Embedding) == embeddingDimensions {
+	model, dimensions := service.embedder.Model(), service.embedder.Dimensions()
+	if movie.EmbeddingSemanticHash == semanticHash && movie.EmbeddingModel == model && len(movie.Embedding) == dimensions {
 		return nil
 	}
+	versioned, ok := service.store.(EmbeddingGenerationStore)
+	var generation *EmbeddingGeneration
+	if ok {
+		var err error
+		if generation, err = versioned.EmbeddingGeneration(ctx, model, dimensions); err != nil {
+			return err
+		}
+		// 模型刚换、重建任务还没建好新代际：先不算，等它一轮再来。
+		if generation == nil {
+			return workqueue.Throttled(fmt.Errorf("embedding generation for %s (%d) is not prepared yet", model, dimensions), 10*time.Minute)
+		}
+	}
 	content := service.semanticContent(ctx, *movie, metadata)
-	vector, err := service.generateVector(ctx, content)
+	vector, err := service.embedder.Embed(ctx, content)
 	if err != nil {
 		return err
 	}
-	if len(vector) != embeddingDimensions {
-		return fmt.Errorf("embedding dimension mismatch: want %d, got %d", embeddingDimensions, len(vector))
+	if generation != nil {
+		err = versioned.SaveEmbedding(ctx, movie.ID, *generation, content, semanticHash, vector)
+	} else {
+		err = service.store.UpdateEmbedding(ctx, movie.ID, content, semanticHash, vector)
 	}
-	if err := service.store.UpdateEmbedding(ctx, doubanID, content, semanticHash, vector); err != nil {
+	if err != nil {
 		return fmt.Errorf("persist embedding: %w", err)
 	}
 	return nil
 }
 
+// EmbedQuery 把搜索词变成向量，供统一搜索的语义模式使用。搜索词本来就短，不走 AI 改写。
+// 库里的向量必须出自同一模型：换模型后新一代还没激活时直接报错，让搜索退回关键词，
+// 拿新模型的向量去查旧模型的索引，距离毫无意义。
+func (service *EmbeddingService) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	if service.embedderErr != nil {
+		return nil, service.embedderErr
+	}
+	text = truncateRunes(strings.TrimSpace(text), maxEmbeddingRunes)
+	if text == "" {
+		return nil, fmt.Errorf("empty search query")
+	}
+	model, dimensions := service.embedder.Model(), service.embedder.Dimensions()
+	if versioned, ok := service.store.(EmbeddingGenerationStore); ok {
+		generation, err := versioned.EmbeddingGeneration(ctx, model, dimensions)
+		if err != nil {
+			return nil, err
+		}
+		if generation == nil || generation.Status != EmbeddingGenerationActive {
+			return nil, fmt.Errorf("embedding generation for %s (%d) is not active", model, dimensions)
+		}
+	}
+	return service.embedder.Embed(ctx, text)
+}
+
 // embeddingInput 是元数据的规范表示：既用于组装 AI prompt，也是语义哈希的唯一来源。
 // 它不直接送进向量模型，所以不受 512 token 限制。
 func embeddingInput(movie Movie) string {
@@ -233,7 +308,7 @@ func (service *EmbeddingService) generateSemanticSummary(ctx context.Context, me
 			Message string `json:"message"`
 		} `json:"error"`
 	}
-	if err := service.postJSON(ctx, service.aiClient, service.config.CFGatewayURL+"/chat/completions",
+	if err := postJSON(ctx, service.aiClient, service.config.CFGatewayURL+"/chat/completions",
 		payload, &response, service.config.CFAPIToken); err != nil {
 		return "", err
 	}
@@ -270,52 +345,6 @@ func peopleNames(encoded string, limit int) []string {
 	return names
 }
 
-// generateVector 调 Ollama 生成向量。
-func (service *EmbeddingService) generateVector(ctx context.Context, content string) ([]float32, error) {
-	payload := struct {
-		Model  string `json:"model"`
-		Prompt string `json:"prompt"`
-	}{Model: service.config.OllamaModel, Prompt: content}
-	var response struct {
-		Embedding []float32 `json:"embedding"`
-	}
-	if err := service.postJSON(ctx, service.client, service.config.OllamaHost+"/api/embeddings", payload, &response, ""); err != nil {
-		return nil, fmt.Errorf("generate Ollama embedding: %w", err)
-	}
-	return response.Embedding, nil
-}
-
-// postJSON 是 Ollama 和 AI Gateway 共用的 POST 封装。
-func (service *EmbeddingService) postJSON(ctx context.Context, client *http.Client, endpoint string, payload, destination any, bearerToken string) error {
-	encoded, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("encode request: %w", err)
-	}
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(encoded))
-	if err != nil {
-		return err
-	}
-	request.Header.Set("Content-Type", "application/json")
-	if bearerToken != "" {
-		request.Header.Set("Authorization", "Bearer "+bearerToken)
-	}
-	if client == nil {
-		client = service.client
-	}
-	response, err := client.Do(request)
-	if err != nil {
-		return err
-	}
-	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		return classifyUpstreamStatus("upstream", response)
-	}
-	if err := json.NewDecoder(response.Body).Decode(destination); err != nil {
-		return fmt.Errorf("decode response: %w", err)
-	}
-	return nil
-}
-
 // truncateRunes 按字符数截断，避免把汉字截半。
 func truncateRunes(value string, limit int) string {
 	runes := []rune(value)
@@ -0,0 +1,417 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+// TaskEmbeddingMigration 在换了向量模型或维度后把全库重新向量化。
+// 重建期间旧向量照常服务，新向量写进临时列 embedding_next，全部就绪并建好索引后一次性换列。
+const TaskEmbeddingMigration = "embedding_migration"
+
+// 向量代际的状态，对应 embedding_generations.status。
+const (
+	EmbeddingGenerationActive   = "active"
+	EmbeddingGenerationBuilding = "building"
+)
+
+// maxEmbeddingDimensions 是 pgvector 的 HNSW 索引能接受的最大维度，超过只能顺序扫描。
+const maxEmbeddingDimensions = 2000
+
+// matchingEmbeddingGeneration 按模型和维度找还在用的那一代（active 或 building）。
+const matchingEmbeddingGeneration = `WHERE model = $1 AND dimensions = $2 AND status IN ('active', 'building')`
+
+// errEmbeddingsPending 表示换列前复查时又冒出了待重建的条目（期间有资料更新），留到下一轮。
+var errEmbeddingsPending = errors.New("embeddings still pending")
+
+// EmbeddingGeneration 是一代向量：同一个模型、同一个维度生成的全部向量。
+type EmbeddingGeneration struct {
+	ID         int
+	Model      string
+	Dimensions int
+	Status     string
+}
+
+// PendingEmbedding 是重建队列里的一条：沿用已经保存的语义文本，不再走一遍 AI 改写。
+type PendingEmbedding struct {
+	MediaID int
+	Content string
+}
+
+// EmbeddingGenerationStore 是支持向量代际的存储。向量服务会断言这个接口：
+// 实现了就按模型所属的那一代写入，否则退回 Store.UpdateEmbedding 直接覆盖。
+type EmbeddingGenerationStore interface {
+	// EmbeddingGeneration 返回模型对应的 active 或 building 代际，都不是时返回 nil。
+	EmbeddingGeneration(ctx context.Context, model string, dimensions int) (*EmbeddingGeneration, error)
+	SaveEmbedding(ctx context.Context, mediaID int, generation EmbeddingGeneration, content, semanticHash string, embedding []float32) error
+}
+
+// EmbeddingMigrationStore 是重建任务需要的全部存储操作。
+type EmbeddingMigrationStore interface {
+	EmbeddingGenerationStore
+	PrepareEmbeddingGeneration(ctx context.Context, model string, dimensions int) (*EmbeddingGeneration, error)
+	PendingEmbeddings(ctx context.Context, limit int) ([]PendingEmbedding, error)
+	SavePendingEmbedding(ctx context.Context, mediaID int, content string, embedding []float32) error
+	DiscardPendingEmbedding(ctx context.Context, mediaID int) error
+	ActivateEmbeddingGeneration(ctx context.Context, generation EmbeddingGeneration) error
+}
+
+// EmbeddingMigrationHandler 是向量重建任务：发现配置的模型不是当前服务的那一代时，
+// 建一个新代际，按热度从高到低分批重算，全部算完后切换。
+type EmbeddingMigrationHandler struct {
+	store     EmbeddingMigrationStore
+	embedder  Embedder
+	batchSize int
+	budget    time.Duration
+	logger    *slog.Logger
+}
+
+// EmbeddingMigrationOption 是重建任务的可选装配项。
+type EmbeddingMigrationOption func(*EmbeddingMigrationHandler)
+
+// WithEmbeddingMigrationBatchSize 覆盖单批取出的条目数。
+func WithEmbeddingMigrationBatchSize(size int) EmbeddingMigrationOption {
+	return func(handler *EmbeddingMigrationHandler) {
+		if size > 0 {
+			handler.batchSize = size
+		}
+	}
+}
+
+// WithEmbeddingMigrationBudget 限制单次任务占用执行槽的时长，剩下的交给下一轮。
+func WithEmbeddingMigrationBudget(budget time.Duration) EmbeddingMigrationOption {
+	return func(handler *EmbeddingMigrationHandler) {
+		if budget > 0 {
+			handler.budget = budget
+		}
+	}
+}
+
+// NewEmbeddingMigrationHandler 创建重建任务执行器，embedder 必须和向量服务用的是同一个配置。
+func NewEmbeddingMigrationHandler(store EmbeddingMigrationStore, embedder Embedder, options ...EmbeddingMigrationOption) *EmbeddingMigrationHandler {
+	handler := &EmbeddingMigrationHandler{store: store, embedder: embedder, batchSize: 200, budget: 5 * time.Minute, logger: slog.Default()}
+	for _, option := range options {
+		option(handler)
+	}
+	return handler
+}
+
+// Handle 执行一轮重建。模型就是当前服务的那一代时什么都不做，所以可以放心按固定间隔调度。
+func (handler *EmbeddingMigrationHandler) Handle(ctx context.Context, _ workqueue.Job) error {
+	model, dimensions := handler.embedder.Model(), handler.embedder.Dimensions()
+	generation, err := handler.store.EmbeddingGeneration(ctx, model, dimensions)
+	if err != nil {
+		return err
+	}
+	if generation != nil && generation.Status == EmbeddingGenerationActive {
+		return nil
+	}
+	if generation == nil {
+		if generation, err = handler.store.PrepareEmbeddingGeneration(ctx, model, dimensions); err != nil {
+			return err
+		}
+		handler.logger.Info("embedding generation prepared", "model", model, "dimensions", dimensions, "generation", generation.ID)
+	}
+	deadline := time.Now().Add(handler.budget)
+	embedded, discarded := 0, 0
+	for time.Now().Before(deadline) {
+		pending, err := handler.store.PendingEmbeddings(ctx, handler.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			if err := handler.store.ActivateEmbeddingGeneration(ctx, *generation); err != nil {
+				if errors.Is(err, errEmbeddingsPending) {
+					continue
+				}
+				return err
+			}
+			handler.logger.Info("embedding generation activated", "model", model, "dimensions", dimensions,
+				"generation", generation.ID, "embedded", embedded, "discarded", discarded)
+			return nil
+		}
+		for _, item := range pending {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			vector, err := handler.embedder.Embed(ctx, item.Content)
+			if err != nil {
+				// 单条文本被拒（太长、含非法字符）不该卡住整次重建：清掉它的语义文本，
+				// 换代后由常规的资料刷新重新生成。其余错误多半是后端不可用，整轮重试。
+				if status, ok := upstreamStatus(err); ok && isRejectedEmbeddingInput(status) {
+					if err := handler.store.DiscardPendingEmbedding(ctx, item.MediaID); err != nil {
+						return err
+					}
+					discarded++
+					continue
+				}
+				return fmt.Errorf("re-embed media %d: %w", item.MediaID, err)
+			}
+			if err := handler.store.SavePendingEmbedding(ctx, item.MediaID, item.Content, vector); err != nil {
+				return err
+			}
+			embedded++
+		}
+	}
+	handler.logger.Info("embedding generation in progress", "model", model, "generation", generation.ID,
+		"embedded", embedded, "discarded", discarded)
+	return nil
+}
+
+// isRejectedEmbeddingInput 判断是不是输入本身被拒。
+func isRejectedEmbeddingInput(status int) bool {
+	return status == http.StatusBadRequest || status == http.StatusRequestEntityTooLarge || status == http.StatusUnprocessableEntity
+}
+
+// EmbeddingGeneration 查模型所属的代际。库里还没有任何向量、也没有 active 代际时
+// （新部署，或测试库被清空），直接把这个模型登记为 active——只要维度和 embedding 列一致，
+// 就没有旧向量需要迁移。
+func (store *PostgresStore) EmbeddingGeneration(ctx context.Context, model string, dimensions int) (*EmbeddingGeneration, error) {
+	generation, err := findEmbeddingGeneration(ctx, store.database, matchingEmbeddingGeneration, model, dimensions)
+	if err != nil || generation != nil {
+		return generation, err
+	}
+	if _, err := store.database.Exec(ctx, `INSERT INTO embedding_generations (model, dimensions, status, activated_at)
+SELECT $1, $2, 'active', NOW()
+WHERE NOT EXISTS (SELECT 1 FROM embedding_generations WHERE status = 'active')
+  AND NOT EXISTS (SELECT 1 FROM media WHERE embedding IS NOT NULL)
+  AND (SELECT atttypmod FROM pg_attribute WHERE attrelid = 'media'::regclass AND attname = 'embedding' AND NOT attisdropped) = $2
+ON CONFLICT DO NOTHING`, model, dimensions); err != nil {
+		return nil, fmt.Errorf("adopt embedding generation: %w", err)
+	}
+	return findEmbeddingGeneration(ctx, store.database, matchingEmbeddingGeneration, model, dimensions)
+}
+
+// findEmbeddingGeneration 按条件取一代，没有时返回 (nil, nil)。
+func findEmbeddingGeneration(ctx context.Context, executor database.Executor, predicate string, arguments ...any) (*EmbeddingGeneration, error) {
+	rows, err := executor.Query(ctx, `SELECT id, model, dimensions, status FROM embedding_generations `+predicate+` LIMIT 1`, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("find embedding generation: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var generation EmbeddingGeneration
+	if err := rows.Scan(&generation.ID, &generation.Model, &generation.Dimensions, &generation.Status); err != nil {
+		return nil, fmt.Errorf("scan embedding generation: %w", err)
+	}
+	return &generation, nil
+}
+
+// SaveEmbedding 按代际写入向量。active 代写正式列；重建期间如果还有进程按旧模型写入，
+// 顺手清掉 embedding_next，让重建任务按新文本再算一次。building 代只写临时列，
+// 旧向量保持不动继续服务。两种写法都要求代际状态没变，换列之后迟到的写入会落空并报错重试。
+func (store *PostgresStore) SaveEmbedding(ctx context.Context, mediaID int, generation EmbeddingGeneration, content, semanticHash string, embedding []float32) error {
+	vector, err := vectorLiteral(embedding)
+	if err != nil {
+		return err
+	}
+	var affected int64
+	switch generation.Status {
+	case EmbeddingGenerationActive:
+		var building bool
+		if err := store.database.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM embedding_generations WHERE status = 'building')`).Scan(&building); err != nil {
+			return fmt.Errorf("check building embedding generation: %w", err)
+		}
+		resetNext := ""
+		if building {
+			resetNext = ", embedding_next = NULL"
+		}
+		affected, err = store.database.Exec(ctx, `UPDATE media SET embedding_content = $2, semantic_hash = $3,
+embedding = $4::vector, embedding_model = $5, embedding_dimensions = $6`+resetNext+`, updated_at = NOW()
+WHERE id = $1 AND EXISTS (SELECT 1 FROM embedding_generations WHERE id = $7 AND status = 'active')`,
+			mediaID, content, semanticHash, vector, generation.Model, generation.Dimensions, generation.ID)
+	case EmbeddingGenerationBuilding:
+		affected, err = store.database.Exec(ctx, `UPDATE media SET embedding_content = $2, semantic_hash = $3,
+embedding_next = $4::vector, updated_at = NOW()
+WHERE id = $1 AND EXISTS (SELECT 1 FROM embedding_generations WHERE id = $5 AND status = 'building')`,
+			mediaID, content, semanticHash, vector, generation.ID)
+	default:
+		return fmt.Errorf("embedding generation %d is %s", generation.ID, generation.Status)
+	}
+	if err != nil {
+		return fmt.Errorf("save media embedding: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("save media embedding %d: generation %d is no longer %s", mediaID, generation.ID, generation.Status)
+	}
+	return nil
+}
+
+// PrepareEmbeddingGeneration 为新模型建一个 building 代际并加上临时列。
+// 上一次没做完、但模型又换了的 building 代直接作废，连同它的临时列一起丢掉。
+// 整个过程持有咨询锁，web 和 worker 同时发现模型变化时只会建一次。
+func (store *PostgresStore) PrepareEmbeddingGeneration(ctx context.Context, model string, dimensions int) (*EmbeddingGeneration, error) {
+	if dimensions <= 0 || dimensions > maxEmbeddingDimensions {
+		return nil, fmt.Errorf("embedding dimensions must be between 1 and %d, got %d", maxEmbeddingDimensions, dimensions)
+	}
+	beginner, ok := store.database.(database.Beginner)
+	if !ok {
+		return nil, fmt.Errorf("prepare embedding generation: executor does not support transactions")
+	}
+	transaction, err := beginner.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin embedding generation: %w", err)
+	}
+	defer transaction.Rollback(context.WithoutCancel(ctx))
+	if _, err := transaction.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('embedding_generations'))`); err != nil {
+		return nil, fmt.Errorf("lock embedding generations: %w", err)
+	}
+	existing, err := findEmbeddingGeneration(ctx, transaction, matchingEmbeddingGeneration, model, dimensions)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	abandoned, err := transaction.Exec(ctx, `UPDATE embedding_generations SET status = 'abandoned' WHERE status = 'building'`)
+	if err != nil {
+		return nil, fmt.Errorf("abandon embedding generation: %w", err)
+	}
+	if abandoned > 0 {
+		if _, err := transaction.Exec(ctx, `ALTER TABLE media DROP COLUMN IF EXISTS embedding_next`); err != nil {
+			return nil, fmt.Errorf("drop abandoned embedding column: %w", err)
+		}
+	}
+	// 维度已在上面校验过，只能是正整数，可以安全拼进 DDL。
+	if _, err := transaction.Exec(ctx, fmt.Sprintf(`ALTER TABLE media ADD COLUMN embedding_next vector(%d)`, dimensions)); err != nil {
+		return nil, fmt.Errorf("add embedding column: %w", err)
+	}
+	generation := EmbeddingGeneration{Model: model, Dimensions: dimensions, Status: EmbeddingGenerationBuilding}
+	if err := transaction.QueryRow(ctx, `INSERT INTO embedding_generations (model, dimensions, status)
+VALUES ($1, $2, 'building') RETURNING id`, model, dimensions).Scan(&generation.ID); err != nil {
+		return nil, fmt.Errorf("create embedding generation: %w", err)
+	}
+	if err := transaction.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit embedding generation: %w", err)
+	}
+	return &generation, nil
+}
+
+// PendingEmbeddings 取还没有新向量的条目，热门的排前面：换代期间旧向量还在服务，
+// 但越早算完用户常看的那部分，切换后的推荐质量越早稳定下来。
+// 热度按收藏/看过人数算，再按豆瓣评分兜底。
+func (store *PostgresStore) PendingEmbeddings(ctx context.Context, limit int) ([]PendingEmbedding, error) {
+	rows, err := store.database.Query(ctx, `SELECT m.id, m.embedding_content FROM media m
+LEFT JOIN (SELECT media_id, COUNT(*) AS saves FROM user_movies WHERE media_id IS NOT NULL GROUP BY media_id) um ON um.media_id = m.id
+WHERE m.embedding_next IS NULL AND m.embedding_content <> ''
+ORDER BY COALESCE(um.saves, 0) DESC, m.rating_douban DESC NULLS LAST, m.id
+LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pending embeddings: %w", err)
+	}
+	defer rows.Close()
+	var pending []PendingEmbedding
+	for rows.Next() {
+		var item PendingEmbedding
+		if err := rows.Scan(&item.MediaID, &item.Content); err != nil {
+			return nil, fmt.Errorf("scan pending embedding: %w", err)
+		}
+		pending = append(pending, item)
+	}
+	return pending, rows.Err()
+}
+
+// SavePendingEmbedding 写入重建出的向量。条件里带上语义文本：重算期间资料被刷新过的话，
+// 这次的结果已经过时，写入会落空，下一批按新文本再算。
+func (store *PostgresStore) SavePendingEmbedding(ctx context.Context, mediaID int, content string, embedding []float32) error {
+	vector, err := vectorLiteral(embedding)
+	if err != nil {
+		return err
+	}
+	if _, err := store.database.Exec(ctx, `UPDATE media SET embedding_next = $3::vector
+WHERE id = $1 AND embedding_content = $2`, mediaID, content, vector); err != nil {
+		return fmt.Errorf("save pending embedding: %w", err)
+	}
+	return nil
+}
+
+// DiscardPendingEmbedding 把被向量后端拒绝的条目移出重建队列。语义文本和哈希一起清空，
+// 换代后资料刷新会把它当成「从没算过」重新生成。
+func (store *PostgresStore) DiscardPendingEmbedding(ctx context.Context, mediaID int) error {
+	if _, err := store.database.Exec(ctx, `UPDATE media SET embedding_content = '', semantic_hash = ''
+WHERE id = $1`, mediaID); err != nil {
+		return fmt.Errorf("discard pending embedding: %w", err)
+	}
+	return nil
+}
+
+// ActivateEmbeddingGeneration 给临时列建索引后换列。索引必须 CONCURRENTLY 建，
+// 否则建索引的几分钟里 media 表写不进去；中途被打断会留下无效索引，先删掉再重建。
+// 换列本身在一个事务里完成，旧列和旧索引一起删除，相似推荐的查询语句不用改。
+func (store *PostgresStore) ActivateEmbeddingGeneration(ctx context.Context, generation EmbeddingGeneration) error {
+	var invalid bool
+	if err := store.database.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+WHERE c.relname = 'media_embedding_next_hnsw' AND NOT i.indisvalid)`).Scan(&invalid); err != nil {
+		return fmt.Errorf("check embedding index: %w", err)
+	}
+	if invalid {
+		if _, err := store.database.Exec(ctx, `DROP INDEX CONCURRENTLY IF EXISTS media_embedding_next_hnsw`); err != nil {
+			return fmt.Errorf("drop invalid embedding index: %w", err)
+		}
+	}
+	if _, err := store.database.Exec(ctx, `CREATE INDEX CONCURRENTLY IF NOT EXISTS media_embedding_next_hnsw
+ON media USING hnsw (embedding_next vector_l2_ops)`); err != nil {
+		return fmt.Errorf("build embedding index: %w", err)
+	}
+	beginner, ok := store.database.(database.Beginner)
+	if !ok {
+		return fmt.Errorf("activate embedding generation: executor does not support transactions")
+	}
+	transaction, err := beginner.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin embedding activation: %w", err)
+	}
+	defer transaction.Rollback(context.WithoutCancel(ctx))
+	if _, err := transaction.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('embedding_generations'))`); err != nil {
+		return fmt.Errorf("lock embedding generations: %w", err)
+	}
+	current, err := findEmbeddingGeneration(ctx, transaction, `WHERE id = $1`, generation.ID)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Status != EmbeddingGenerationBuilding {
+		return fmt.Errorf("embedding generation %d is no longer building", generation.ID)
+	}
+	// 先锁表再复查，复查之后就不会再有写入插进来。
+	if _, err := transaction.Exec(ctx, `LOCK TABLE media IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("lock media for embedding activation: %w", err)
+	}
+	var pending bool
+	if err := transaction.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM media WHERE embedding_next IS NULL AND embedding_content <> '')`).Scan(&pending); err != nil {
+		return fmt.Errorf("check pending embeddings: %w", err)
+	}
+	if pending {
+		return errEmbeddingsPending
+	}
+	// 没有新向量的行（没有语义文本的旧数据）清掉语义哈希，下次资料刷新会重新生成。
+	if _, err := transaction.Exec(ctx, `UPDATE media SET
+    embedding_model = CASE WHEN embedding_next IS NULL THEN '' ELSE $1 END,
+    embedding_dimensions = CASE WHEN embedding_next IS NULL THEN 0 ELSE $2 END,
+    semantic_hash = CASE WHEN embedding_next IS NULL THEN '' ELSE semantic_hash END
+WHERE embedding IS NOT NULL OR embedding_next IS NOT NULL`, generation.Model, generation.Dimensions); err != nil {
+		return fmt.Errorf("stamp embedding generation: %w", err)
+	}
+	for _, statement := range []string{
+		`ALTER TABLE media DROP COLUMN embedding`,
+		`ALTER TABLE media RENAME COLUMN embedding_next TO embedding`,
+		`ALTER INDEX media_embedding_next_hnsw RENAME TO media_embedding_hnsw`,
+		`UPDATE embedding_generations SET status = 'retired' WHERE status = 'active'`,
+	} {
+		if _, err := transaction.Exec(ctx, statement); err != nil {
+			return fmt.Errorf("swap embedding column: %w", err)
+		}
+	}
+	if _, err := transaction.Exec(ctx, `UPDATE embedding_generations SET status = 'active', activated_at = NOW() WHERE id = $1`, generation.ID); err != nil {
+		return fmt.Errorf("activate embedding generation: %w", err)
+	}
+	if err := transaction.Commit(ctx); err != nil {
+		return fmt.Errorf("commit embedding activation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+type generationStoreStub struct {
+	generation *EmbeddingGeneration
+	prepared   int
+	queue      []PendingEmbedding
+	saved      map[int]int
+	discarded  []int
+	activated  *EmbeddingGeneration
+}
+
+func (stub *generationStoreStub) EmbeddingGeneration(context.Context, string, int) (*EmbeddingGeneration, error) {
+	return stub.generation, nil
+}
+
+func (stub *generationStoreStub) SaveEmbedding(context.Context, int, EmbeddingGeneration, string, string, []float32) error {
+	return nil
+}
+
+func (stub *generationStoreStub) PrepareEmbeddingGeneration(_ context.Context, model string, dimensions int) (*EmbeddingGeneration, error) {
+	stub.prepared++
+	stub.generation = &EmbeddingGeneration{ID: 9, Model: model, Dimensions: dimensions, Status: EmbeddingGenerationBuilding}
+	return stub.generation, nil
+}
+
+// PendingEmbeddings 模拟真实查询：已写入或已丢弃的条目不再出现。
+func (stub *generationStoreStub) PendingEmbeddings(_ context.Context, limit int) ([]PendingEmbedding, error) {
+	var pending []PendingEmbedding
+	for _, item := range stub.queue {
+		if _, done := stub.saved[item.MediaID]; done || containsInt(stub.discarded, item.MediaID) {
+			continue
+		}
+		if len(pending) < limit {
+			pending = append(pending, item)
+		}
+	}
+	return pending, nil
+}
+
+func (stub *generationStoreStub) SavePendingEmbedding(_ context.Context, mediaID int, _ string, embedding []float32) error {
+	stub.saved[mediaID] = len(embedding)
+	return nil
+}
+
+func (stub *generationStoreStub) DiscardPendingEmbedding(_ context.Context, mediaID int) error {
+	stub.discarded = append(stub.discarded, mediaID)
+	return nil
+}
+
+func (stub *generationStoreStub) ActivateEmbeddingGeneration(_ context.Context, generation EmbeddingGeneration) error {
+	stub.activated = &generation
+	return nil
+}
+
+func containsInt(values []int, target int) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// embedderStub 按文本返回向量或错误，并记下调用顺序。
+type embedderStub struct {
+	errors map[string]error
+	calls  []string
+}
+
+func (stub *embedderStub) Model() string   { return "openai:text-embedding-3-small" }
+func (stub *embedderStub) Dimensions() int { return 4 }
+
+func (stub *embedderStub) Embed(_ context.Context, text string) ([]float32, error) {
+	stub.calls = append(stub.calls, text)
+	if err := stub.errors[text]; err != nil {
+		return nil, err
+	}
+	return []float32{0.1, 0.2, 0.3, 0.4}, nil
+}
+
+func TestEmbeddingMigrationSkipsWhenModelIsActive(t *testing.T) {
+	store := &generationStoreStub{generation: &EmbeddingGeneration{ID: 1, Status: EmbeddingGenerationActive},
+		queue: []PendingEmbedding{{MediaID: 1, Content: "甲"}}, saved: map[int]int{}}
+	embedder := &embedderStub{}
+	if err := NewEmbeddingMigrationHandler(store, embedder).Handle(t.Context(), workqueue.Job{TaskType: TaskEmbeddingMigration}); err != nil {
+		t.Fatal(err)
+	}
+	if store.prepared != 0 || len(embedder.calls) != 0 || store.activated != nil {
+		t.Fatalf("active model triggered a rebuild: prepared=%d calls=%v", store.prepared, embedder.calls)
+	}
+}
+
+func TestEmbeddingMigrationRebuildsInBatchesThenActivates(t *testing.T) {
+	store := &generationStoreStub{saved: map[int]int{}, queue: []PendingEmbedding{
+		{MediaID: 7, Content: "热门"}, {MediaID: 3, Content: "超长文本"}, {MediaID: 5, Content: "冷门"},
+	}}
+	embedder := &embedderStub{errors: map[string]error{
+		"超长文本": &upstreamStatusError{source: "upstream", status: http.StatusRequestEntityTooLarge},
+	}}
+	handler := NewEmbeddingMigrationHandler(store, embedder, WithEmbeddingMigrationBatchSize(2))
+	if err := handler.Handle(t.Context(), workqueue.Job{TaskType: TaskEmbeddingMigration}); err != nil {
+		t.Fatal(err)
+	}
+	if store.prepared != 1 || store.activated == nil || store.activated.ID != 9 || store.activated.Model != "openai:text-embedding-3-small" {
+		t.Fatalf("prepared=%d activated=%+v", store.prepared, store.activated)
+	}
+	// 按存储给出的热度顺序重算；被后端拒绝的条目移出队列，不能卡住换代。
+	if len(embedder.calls) != 3 || embedder.calls[0] != "热门" || store.saved[7] != 4 || store.saved[5] != 4 {
+		t.Fatalf("calls=%v saved=%v", embedder.calls, store.saved)
+	}
+	if len(store.discarded) != 1 || store.discarded[0] != 3 {
+		t.Fatalf("discarded = %v", store.discarded)
+	}
+}
+
+func TestEmbeddingMigrationRetriesWhenBackendIsDown(t *testing.T) {
+	store := &generationStoreStub{generation: &EmbeddingGeneration{ID: 2, Status: EmbeddingGenerationBuilding}, saved: map[int]int{},
+		queue: []PendingEmbedding{{MediaID: 1, Content: "甲"}, {MediaID: 2, Content: "乙"}}}
+	embedder := &embedderStub{errors: map[string]error{"乙": errors.New("connection refused")}}
+	err := NewEmbeddingMigrationHandler(store, embedder).Handle(t.Context(), workqueue.Job{TaskType: TaskEmbeddingMigration})
+	if err == nil || store.activated != nil || store.prepared != 0 {
+		t.Fatalf("error=%v activated=%+v prepared=%d", err, store.activated, store.prepared)
+	}
+	// 出错前已经算好的向量要保住，下一轮从剩下的接着做。
+	if store.saved[1] != 4 || len(store.discarded) != 0 {
+		t.Fatalf("saved=%v discarded=%v", store.saved, store.discarded)
+	}
+}
+
+func TestEmbedQueryRequiresActiveGenerationForCurrentModel(t *testing.T) {
+	generations := &generationStoreStub{generation: &EmbeddingGeneration{ID: 2, Status: EmbeddingGenerationBuilding}}
+	store := struct {
+		movieStoreStub
+		*generationStoreStub
+	}{generationStoreStub: generations}
+	embedder := &embedderStub{}
+	service := NewEmbeddingService(nil, store, EmbeddingConfig{}, WithEmbedder(embedder))
+	// 新模型还在重建：查询向量和索引里的旧向量不在一个空间，必须拒绝。
+	if _, err := service.EmbedQuery(t.Context(), "太空 孤独"); err == nil || len(embedder.calls) != 0 {
+		t.Fatalf("building generation accepted: err=%v calls=%v", err, embedder.calls)
+	}
+	generations.generation.Status = EmbeddingGenerationActive
+	vector, err := service.EmbedQuery(t.Context(), "  太空 孤独  ")
+	if err != nil || len(vector) != 4 || len(embedder.calls) != 1 || embedder.calls[0] != "太空 孤独" {
+		t.Fatalf("vector=%v err=%v calls=%v", vector, err, embedder.calls)
+	}
+}
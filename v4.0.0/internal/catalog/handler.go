@@ -53,6 +53,11 @@ type SimilarFinder interface {
 	FindSimilar(ctx context.Context, doubanID string, limit int) ([]Movie, error)
 }
 
+// MediaSimilarFinder 按 media.id 提供相似影片。
+type MediaSimilarFinder interface {
+	FindSimilarByID(ctx context.Context, mediaID int, limit int) ([]Movie, error)
+}
+
 // SeriesFinder 提供同系列的各季（详情页季度导航）。
 type SeriesFinder interface {
 	FindSeriesSeasons(ctx context.Context, doubanID string) ([]SeriesSeason, error)
@@ -68,6 +73,11 @@ type VectorEnricher interface {
 	Enrich(ctx context.Context, doubanID string) error
 }
 
+// MediaVectorEnricher 按 media.id 生成语义向量，供没有豆瓣 ID 的作品使用。
+type MediaVectorEnricher interface {
+	EnrichMedia(ctx context.Context, mediaID int) error
+}
+
 // Review 是一条豆瓣短评，以 JSON 数组形式存在 media.reviews_json。
 type Review struct {
 	Title     string `json:"title"`
@@ -98,28 +108,40 @@ type AirScheduleReader interface {
 	ListUpcomingUnits(ctx context.Context, mediaID, seasonNumber int, from time.Time, limit int) ([]mediaidentity.MediaUnit, error)
 }
 
+// MergeTargetFinder 返回作品被合并进的那部作品，没有合并过时返回 (nil, nil)。
+// 重复作品合并后旧地址还在外面流传，详情页据此 301 到保留的作品。
+type MergeTargetFinder interface {
+	FindMergeTarget(ctx context.Context, mediaID int) (*Movie, error)
+}
+
 // Handler 提供影片详情页、发现页、图片代理和资料刷新接口。
 // 各种能力都通过 Option 注入，缺失时对应区块自动降级为不展示。
 type Handler struct {
-	config       config.Config
-	store        Store
-	userMovies   UserMovies
-	fetcher      Fetcher
-	reviews      ReviewFetcher
-	backdrops    BackdropSyncer
-	vectors      VectorEnricher
-	suggester    Suggester
-	popular      PopularProvider
-	trending     PopularProvider
-	similar      SimilarFinder
-	resources    ResourceLister
-	airSchedule  AirScheduleReader
-	runner       BackgroundRunner
-	refreshQueue RefreshQueue
-	httpClient   *http.Client
-	crawling     sync.Map
-	similarCache *cache.TTL[[]Movie]
-	similarSF    singleflight.Group
+	config        config.Config
+	store         Store
+	userMovies    UserMovies
+	fetcher       Fetcher
+	reviews       ReviewFetcher
+	backdrops     BackdropSyncer
+	vectors       VectorEnricher
+	suggester     Suggester
+	popular       PopularProvider
+	trending      PopularProvider
+	similar       SimilarFinder
+	resources     ResourceLister
+	airSchedule   AirScheduleReader
+	people        mediaidentity.PersonReader
+	collections   mediaidentity.CollectionReader
+	translations  mediaidentity.TranslationReader
+	runner        BackgroundRunner
+	refreshQueue  RefreshQueue
+	httpClient    *http.Client
+	imageCache    *ImageCache
+	imageEncoders []ImageEncoder
+	imageFlight   singleflight.Group
+	crawling      sync.Map
+	similarCache  *cache.TTL[[]Movie]
+	similarSF     singleflight.Group
 }
 
 // similarCacheTTL 是相似影片的缓存时长。
@@ -201,6 +223,27 @@ func WithAirScheduleReader(reader AirScheduleReader) HandlerOption {
 	return func(handler *Handler) { handler.airSchedule = reader }
 }
 
+// WithPeople 注入人物读取，启用 /person/:id 人物页。
+func WithPeople(reader mediaidentity.PersonReader) HandlerOption {
+	return func(handler *Handler) { handler.people = reader }
+}
+
+// WithCollections 注入合集读取，启用 /collection/:id 合集页和详情页的按顺序观看导航。
+func WithCollections(reader mediaidentity.CollectionReader) HandlerOption {
+	return func(handler *Handler) { handler.collections = reader }
+}
+
+// WithImageCache 启用图片代理的磁盘缓存，encoders 按优先级排列（AVIF 在 WebP 前），
+// 浏览器 Accept 里声明支持的第一个会被用来转码。不注入时图片代理保持直连透传。
+func WithImageCache(cache *ImageCache, encoders ...ImageEncoder) HandlerOption {
+	return func(handler *Handler) { handler.imageCache, handler.imageEncoders = cache, encoders }
+}
+
+// WithTranslations 注入多语言资料读取，详情页按当前语言显示片名、简介和宣传语。
+func WithTranslations(reader mediaidentity.TranslationReader) HandlerOption {
+	return func(handler *Handler) { handler.translations = reader }
+}
+
 // NewHandler 构造详情页 Handler，并给出站 HTTP Client 套上图片代理的安全拦截。
 func NewHandler(cfg config.Config, store Store, options ...HandlerOption) *Handler {
 	handler := &Handler{config: cfg, store: store, httpClient: &http.Client{Timeout: 15 * time.Second},
@@ -212,9 +255,11 @@ func NewHandler(cfg config.Config, store Store, options ...HandlerOption) *Handl
 	return handler
 }
 
-// Register 注册路由：详情页、发现页、图片代理、短评/剧照片段和资料刷新接口。
+// Register 注册路由：详情页、人物页、合集页、发现页、图片代理、短评/剧照片段和资料刷新接口。
 func (handler *Handler) Register(router *gin.Engine) {
 	router.GET("/movie/:id", auth.Optional(handler.config.AppSecret), handler.movie)
+	router.GET("/person/:id", handler.person)
+	router.GET("/collection/:id", auth.Optional(handler.config.AppSecret), handler.collection)
 	router.GET("/api/proxy/image/:url", handler.proxyImage)
 	router.GET("/api/htmx/reviews", handler.reviewList)
 	router.GET("/api/htmx/movie-backdrops", handler.backdropList)
@@ -360,10 +405,11 @@ func (handler *Handler) reviewList(c *gin.Context) {
 }
 
 // backdropList 返回剧照片段，逻辑与 reviewList 相同：缺数据就排任务并提示稍后刷新。
+// 没有豆瓣 ID 的作品按 media_id 读，剧照已随 TMDB 主资料一起导入，不再单独排任务。
 func (handler *Handler) backdropList(c *gin.Context) {
 	doubanID := c.Query("douban_id")
 	if doubanID == "" {
-		c.String(http.StatusOK, "")
+		handler.mediaBackdropList(c)
 		return
 	}
 	movie, err := handler.store.FindByDoubanID(c.Request.Context(), doubanID)
@@ -412,6 +458,25 @@ func (handler *Handler) backdropList(c *gin.Context) {
 	c.HTML(http.StatusOK, "partials/movie_backdrops.html", gin.H{"Backdrops": backdrops})
 }
 
+// mediaBackdropList 按 media_id 渲染已有剧照。
+func (handler *Handler) mediaBackdropList(c *gin.Context) {
+	mediaID, _ := strconv.Atoi(c.Query("media_id"))
+	if mediaID <= 0 {
+		c.String(http.StatusOK, "")
+		return
+	}
+	movie, err := handler.store.FindByID(c.Request.Context(), mediaID)
+	if err != nil || movie == nil {
+		c.String(http.StatusOK, "")
+		return
+	}
+	backdrops := []string{}
+	if movie.Backdrops != "" {
+		backdrops = strings.Split(movie.Backdrops, ",")
+	}
+	c.HTML(http.StatusOK, "partials/movie_backdrops.html", gin.H{"Backdrops": backdrops})
+}
+
 // queueReviewRefresh 是没有任务队列时的兜底：进程内抓一次，用 crawling 这张表防止重复。
 func (handler *Handler) queueReviewRefresh(doubanID string) {
 	if handler.reviews == nil || handler.runner == nil {
@@ -429,10 +494,22 @@ func (handler *Handler) queueReviewRefresh(doubanID string) {
 	}
 }
 
-// movie 渲染影片详情页。本地没有资料时先渲染一个「正在抓取」的过渡页，
-// 资料不完整时顺手排一个补全任务；相似推荐、季度导航、更新时间表任一环节失败都只是少一个区块。
+// movie 按 :id 的写法分派到豆瓣、media.id 或外部 ID 入口，写法见 MovieKey。
 func (handler *Handler) movie(c *gin.Context) {
-	doubanID, searchTitle := c.Param("id"), c.Query("title")
+	switch key := ParseMovieKey(c.Param("id")); key.Kind {
+	case MovieKeyMedia:
+		handler.mediaMovie(c, key.MediaID)
+	case MovieKeyExternal:
+		handler.externalMovie(c, key)
+	default:
+		handler.doubanMovie(c, key.DoubanID)
+	}
+}
+
+// doubanMovie 是豆瓣 ID 入口。本地没有资料时先渲染一个「正在抓取」的过渡页，
+// 资料不完整时顺手排一个补全任务。
+func (handler *Handler) doubanMovie(c *gin.Context, doubanID string) {
+	searchTitle := c.Query("title")
 	movie, err := handler.store.FindByDoubanID(c.Request.Context(), doubanID)
 	if movie != nil && movie.Title == "" {
 		_ = handler.store.DeleteByDoubanID(c.Request.Context(), doubanID)
@@ -453,20 +530,105 @@ func (handler *Handler) movie(c *gin.Context) {
 			requestmeta.Logger(c.Request.Context()).Warn("queue partial metadata", "douban_id", doubanID, "error", queueErr)
 		}
 	}
+	handler.renderMovie(c, movie)
+}
 
+// mediaMovie 是 m<media.id> 入口。有豆瓣 ID 的作品 301 回豆瓣地址，保证每部作品只有一个规范 URL；
+// 没有豆瓣 ID 的作品按 media.id 补主资料。
+func (handler *Handler) mediaMovie(c *gin.Context, mediaID int) {
+	movie, err := handler.store.FindByID(c.Request.Context(), mediaID)
+	if err != nil || movie == nil || movie.Title == "" {
+		if err != nil {
+			requestmeta.Logger(c.Request.Context()).Warn("load media detail failed", "media_id", mediaID, "error", err)
+		}
+		c.HTML(http.StatusNotFound, "404.html", platformweb.NewData(c, handler.config, platformweb.Metadata{Title: "影片未找到 - " + handler.config.SiteName}, nil))
+		return
+	}
+	if movie.DoubanID != "" {
+		handler.redirectToMovie(c, *movie)
+		return
+	}
+	if movie.MetadataStatus == "partial" || movie.CompletenessScore < 70 {
+		handler.enqueueMediaJob(c.Request.Context(), mediaID, RefreshProviderTMDBMetadata, RefreshReasonPartialMetadata)
+	}
+	handler.renderMovie(c, movie)
+}
+
+// externalMovie 是 TMDB/IMDb ID 入口：本地已有就 301 到规范地址，没有就排导入任务并渲染过渡页。
+// 过渡页刷新时会再走一遍这里，导入完成后自然跳到正式详情页。
+func (handler *Handler) externalMovie(c *gin.Context, key MovieKey) {
+	searchTitle := c.Query("title")
+	if finder, ok := handler.store.(ExternalMovieFinder); ok {
+		movie, err := finder.FindByExternalID(c.Request.Context(), key.Provider, key.ExternalType, key.ExternalID)
+		if err != nil {
+			requestmeta.Logger(c.Request.Context()).Warn("find media by external ID", "provider", key.Provider, "external_id", key.ExternalID, "error", err)
+		}
+		if movie != nil && movie.Title != "" {
+			handler.redirectToMovie(c, *movie)
+			return
+		}
+	}
+	if queue, ok := handler.refreshQueue.(MediaJobQueue); ok {
+		if _, err := queue.EnqueueExternalImport(c.Request.Context(), key, RefreshReasonMissingMetadata, 0); err != nil {
+			requestmeta.Logger(c.Request.Context()).Warn("queue external import", "provider", key.Provider, "external_id", key.ExternalID, "error", err)
+		}
+	}
+	c.HTML(http.StatusOK, "fetching.html", platformweb.NewData(c, handler.config, platformweb.Metadata{Title: searchTitle}, gin.H{
+		"Title": searchTitle, "ExternalSource": strings.ToUpper(key.Provider), "ExternalID": key.ExternalID,
+	}))
+}
+
+// redirectToMovie 301 到作品的规范详情页，保留 title 等查询参数。
+func (handler *Handler) redirectToMovie(c *gin.Context, movie Movie) {
+	location := "/movie/" + movie.DetailKey()
+	if c.Request.URL.RawQuery != "" {
+		location += "?" + c.Request.URL.RawQuery
+	}
+	c.Redirect(http.StatusMovedPermanently, location)
+}
+
+// redirectMerged 在作品已并入另一部作品时 301 过去，返回是否已经跳转。
+func (handler *Handler) redirectMerged(c *gin.Context, movie *Movie) bool {
+	finder, ok := handler.store.(MergeTargetFinder)
+	if !ok || movie.ID <= 0 {
+		return false
+	}
+	target, err := finder.FindMergeTarget(c.Request.Context(), movie.ID)
+	if err != nil {
+		requestmeta.Logger(c.Request.Context()).Warn("find merge target", "media_id", movie.ID, "error", err)
+		return false
+	}
+	if target == nil || target.Title == "" {
+		return false
+	}
+	handler.redirectToMovie(c, *target)
+	return true
+}
+
+// renderMovie 渲染影片详情页；相似推荐、季度导航、更新时间表任一环节失败都只是少一个区块。
+// 片单状态以 DetailKey 为影片标识，没有豆瓣 ID 的作品同样能标记想看/看过。
+func (handler *Handler) renderMovie(c *gin.Context, movie *Movie) {
+	if handler.redirectMerged(c, movie) {
+		return
+	}
+	doubanID, searchTitle, movieKey := movie.DoubanID, c.Query("title"), movie.DetailKey()
 	userID := auth.UserID(c)
 	isWish, isWatched := false, false
 	watchedByCount, wishByCount := 0, 0
 	if handler.userMovies != nil {
 		if userID > 0 {
-			isWish, _ = handler.userMovies.IsMarked(c.Request.Context(), userID, movie.DoubanID, "wish")
-			isWatched, _ = handler.userMovies.IsMarked(c.Request.Context(), userID, movie.DoubanID, "watched")
+			isWish, _ = handler.userMovies.IsMarked(c.Request.Context(), userID, movieKey, "wish")
+			isWatched, _ = handler.userMovies.IsMarked(c.Request.Context(), userID, movieKey, "watched")
 		}
-		watchedByCount, _ = handler.userMovies.CountByMovie(c.Request.Context(), movie.DoubanID, "watched")
-		wishByCount, _ = handler.userMovies.CountByMovie(c.Request.Context(), movie.DoubanID, "wish")
+		watchedByCount, _ = handler.userMovies.CountByMovie(c.Request.Context(), movieKey, "watched")
+		wishByCount, _ = handler.userMovies.CountByMovie(c.Request.Context(), movieKey, "wish")
 	}
 
+	translation := handler.movieTranslation(c.Request.Context(), movie, platformweb.CurrentLocale(c))
 	keywords := []string{movie.Title}
+	if translation.Title != movie.Title {
+		keywords = append(keywords, translation.Title)
+	}
 	if movie.Year != "" {
 		keywords = append(keywords, movie.Year)
 	}
@@ -474,17 +636,29 @@ func (handler *Handler) movie(c *gin.Context) {
 		keywords = append(keywords, strings.Split(movie.Genres, ",")...)
 	}
 	keywords = append(keywords, "在线观看", "免费下载", "高清资源", "Moovie", "影牛")
-	description := truncateDescription(movie.Summary, 150)
-	var directors []Director
+	description := truncateDescription(translation.Summary, 150)
+	var directors, actors []Director
 	if json.Unmarshal([]byte(movie.Directors), &directors) != nil {
 		directors = []Director{}
 	}
-	seriesSeasons := handler.findSeriesSeasons(c.Request.Context(), doubanID)
+	if json.Unmarshal([]byte(movie.Actors), &actors) != nil {
+		actors = []Director{}
+	}
+	// 合集比按 TMDB 季 ID 归拢的季度导航全（能链到没有豆瓣条目的季），有合集就用合集。
+	collection := handler.collectionView(c.Request.Context(), movie, userID)
+	seriesSeasons := collection.seriesSeasons()
+	if collection == nil {
+		seriesSeasons = handler.findSeriesSeasons(c.Request.Context(), doubanID)
+	}
 	similarMovies := excludeSeriesMovies(
-		handler.findSimilar(c.Request.Context(), doubanID, 6+len(seriesSeasons)), seriesSeasons,
+		handler.findSimilar(c.Request.Context(), *movie, 6+len(seriesSeasons)), seriesSeasons,
 		mediaidentity.TitleBase(movie.Title, movie.OriginalTitle), 6)
 	if movie.EmbeddingContent == "" {
-		handler.queueEmbedding(c.Request.Context(), doubanID)
+		if doubanID != "" {
+			handler.queueEmbedding(c.Request.Context(), doubanID)
+		} else {
+			handler.enqueueMediaJob(c.Request.Context(), movie.ID, RefreshProviderMediaEmbedding, RefreshReasonMissingEmbedding)
+		}
 	}
 	airSchedule := handler.airScheduleView(c.Request.Context(), movie)
 	playbackSummary := search.PlaybackSummary{MediaID: movie.ID, State: search.PlaybackNone}
@@ -495,14 +669,15 @@ func (handler *Handler) movie(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "movie.html", platformweb.NewData(c, handler.config, platformweb.Metadata{
-		Title:       "《" + movie.Title + "》 (" + movie.Year + ") - 剧情介绍/演职员表 - " + handler.config.SiteName,
+		Title:       "《" + translation.Title + "》 (" + movie.Year + ") - 剧情介绍/演职员表 - " + handler.config.SiteName,
 		Description: description, Keywords: strings.Join(keywords, ","),
-		Cover: proxyImageURL(movie.Poster), Canonical: fmt.Sprintf("%s/movie/%s", handler.config.SiteURL, movie.DoubanID),
+		Cover: proxyImageURL(movie.Poster), Canonical: fmt.Sprintf("%s/movie/%s", handler.config.SiteURL, movieKey),
 	}, gin.H{
-		"Movie": movie, "IsWish": isWish, "IsWatched": isWatched,
+		"Movie": movie, "Translation": translation, "IsWish": isWish, "IsWatched": isWatched,
 		"WatchedByCount": watchedByCount, "WishByCount": wishByCount,
-		"DirectorList": directors, "SearchTitle": searchTitle, "SimilarMovies": similarMovies,
+		"DirectorList": directors, "ActorList": actors, "SearchTitle": searchTitle, "SimilarMovies": similarMovies,
 		"SeriesSeasons": seriesSeasons,
+		"Collection":    collection,
 		"AirSchedule":   airSchedule, "Playback": playbackSummary,
 	}))
 }
@@ -531,11 +706,11 @@ func excludeSeriesMovies(movies []Movie, seasons []SeriesSeason, seriesTitle str
 	}
 	excluded := make(map[string]struct{}, len(seasons))
 	for _, season := range seasons {
-		excluded[season.DoubanID] = struct{}{}
+		excluded[season.DetailKey()] = struct{}{}
 	}
 	filtered := make([]Movie, 0, min(limit, len(movies)))
 	for _, movie := range movies {
-		if _, sameSeries := excluded[movie.DoubanID]; sameSeries {
+		if _, sameSeries := excluded[movie.DetailKey()]; sameSeries {
 			continue
 		}
 		// 未完成 TMDB 绑定的季度也不该混入推荐；这里只过滤，不据此建立系列关系。
@@ -586,11 +761,13 @@ func (handler *Handler) airScheduleView(ctx context.Context, movie *Movie) media
 
 // findSimilar 让同一影片第一次请求后的向量查询离开热点路径，
 // 并合并并发请求，防止热门详情页在冷缓存突发时击穿向量索引。
-func (handler *Handler) findSimilar(ctx context.Context, doubanID string, limit int) []Movie {
-	if handler.similar == nil || doubanID == "" || limit == 0 {
+// 推荐端口支持 media.id 时优先按 ID 查，没有豆瓣 ID 的作品只能走这条路。
+func (handler *Handler) findSimilar(ctx context.Context, movie Movie, limit int) []Movie {
+	byID, supportsID := handler.similar.(MediaSimilarFinder)
+	if handler.similar == nil || limit == 0 || (movie.DoubanID == "" && (!supportsID || movie.ID <= 0)) {
 		return []Movie{}
 	}
-	key := fmt.Sprintf("%s:%d", doubanID, limit)
+	key := fmt.Sprintf("%s:%d", movie.DetailKey(), limit)
 	if movies, ok := handler.cachedSimilar(key); ok {
 		return movies
 	}
@@ -598,7 +775,13 @@ func (handler *Handler) findSimilar(ctx context.Context, doubanID string, limit
 		if movies, ok := handler.cachedSimilar(key); ok {
 			return movies, nil
 		}
-		movies, err := handler.similar.FindSimilar(ctx, doubanID, limit)
+		var movies []Movie
+		var err error
+		if supportsID && movie.ID > 0 {
+			movies, err = byID.FindSimilarByID(ctx, movie.ID, limit)
+		} else {
+			movies, err = handler.similar.FindSimilar(ctx, movie.DoubanID, limit)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -621,7 +804,7 @@ func (handler *Handler) cachedSimilar(key string) ([]Movie, bool) {
 	return append([]Movie(nil), movies...), true
 }
 
-// 相似卡片只渲染身份、标题、海报、评分和年份。
+// 相似卡片只渲染身份、标题、海报（含占位色）、评分和年份。
 // 只缓存这些字段可避免为每部访问过的影片长期保留简介、演员 JSON 和向量。
 func compactSimilarMovies(movies []Movie) []Movie {
 	compact := make([]Movie, 0, len(movies))
@@ -629,6 +812,7 @@ func compactSimilarMovies(movies []Movie) []Movie {
 		compact = append(compact, Movie{
 			ID: movie.ID, DoubanID: movie.DoubanID, Title: movie.Title, Year: movie.Year,
 			Poster: movie.Poster, Rating: movie.Rating, Genres: movie.Genres,
+			ImagePalette: ImagePalette{PosterBlurhash: movie.PosterBlurhash, PosterColor: movie.PosterColor},
 		})
 	}
 	return compact
@@ -677,6 +861,17 @@ func (handler *Handler) fetchMissing(ctx context.Context, doubanID string) (bool
 	return false, nil
 }
 
+// enqueueMediaJob 按 media.id 入队；队列不支持或入队失败都只记日志，详情页照常渲染。
+func (handler *Handler) enqueueMediaJob(ctx context.Context, mediaID int, provider, reason string) {
+	queue, ok := handler.refreshQueue.(MediaJobQueue)
+	if !ok {
+		return
+	}
+	if _, err := queue.EnqueueMediaJob(ctx, mediaID, provider, reason, 0); err != nil {
+		requestmeta.Logger(ctx).Warn("queue media refresh", "media_id", mediaID, "provider", provider, "error", err)
+	}
+}
+
 // enqueueRefresh 统一入队。第一个返回值表示「有队列可用」，第二个才是入队是否出错。
 func (handler *Handler) enqueueRefresh(ctx context.Context, doubanID, provider, reason string) (bool, error) {
 	if handler.refreshQueue == nil {
@@ -2,15 +2,18 @@ package catalog
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/library"
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/cache"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
@@ -52,6 +55,7 @@ func TestMoviePagePreservesIndexedSEOJSONLDAndUserSignals(t *testing.T) {
 		`<link rel="canonical" href="https://moovie.example/movie/1292052">`,
 		`content="` + strings.Repeat("剧", 150) + `..."`,
 		`"@type": "Movie"`, `"name": "弗兰克·德拉邦特"`, "已看过", "1 人看过", "1 人想看",
+		`<a href="/person/douban-1">弗兰克·德拉邦特</a>`, `<a href="/person/douban-2">蒂姆·罗宾斯</a>`,
 	} {
 		if !strings.Contains(body, expected) {
 			t.Fatalf("movie page missing %q", expected)
@@ -136,8 +140,8 @@ func TestMoviePageRendersSeriesNavigationAndExcludesSeasonsFromRecommendations(t
 func TestSimilarRecommendationsCoalesceAndCache(t *testing.T) {
 	finder := &countingSimilarFinder{movies: []Movie{{DoubanID: "target", Title: "相关推荐", Summary: "不进入卡片缓存"}}}
 	handler := &Handler{similar: finder, similarCache: cache.New[[]Movie](similarCacheCapacity, similarCacheTTL)}
-	first := handler.findSimilar(t.Context(), "1292052", 6)
-	second := handler.findSimilar(t.Context(), "1292052", 6)
+	first := handler.findSimilar(t.Context(), Movie{DoubanID: "1292052"}, 6)
+	second := handler.findSimilar(t.Context(), Movie{DoubanID: "1292052"}, 6)
 	if len(first) != 1 || len(second) != 1 || finder.calls != 1 || first[0].Summary != "" {
 		t.Fatalf("similar results/calls = %d/%d/%d, want one result per call and one backend call", len(first), len(second), finder.calls)
 	}
@@ -356,6 +360,128 @@ func TestRefreshMediaQueuesCanonicalID(t *testing.T) {
 	}
 }
 
+func TestPersonPageRedirectsExternalIDsAndRendersFilmographyWithPlayback(t *testing.T) {
+	people := &personReaderStub{
+		person: mediaidentity.Person{ID: 5, DoubanID: "1054521", TMDBID: "504", Name: "蒂姆·罗宾斯", OriginalName: "Tim Robbins"},
+		credits: []mediaidentity.PersonCredit{
+			{MediaID: 42, DoubanID: "1292052", Title: "肖申克的救赎", Year: "1994", Roles: []string{mediaidentity.CreditActor}, Character: "安迪"},
+			{MediaID: 43, Title: "没有豆瓣条目的作品", Year: "1999", Roles: []string{mediaidentity.CreditDirector}},
+		},
+	}
+	router := catalogTestRouterWithOptions(t, nil, nil, WithPeople(people), WithResourceLister(summaryResourceLister{42: true}))
+
+	for _, path := range []string{"/person/douban-1054521", "/person/tmdb-504"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusMovedPermanently || recorder.Header().Get("Location") != "/person/5" {
+			t.Fatalf("%s = %d -> %q", path, recorder.Code, recorder.Header().Get("Location"))
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/person/5", nil))
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("person page = %d/%s", recorder.Code, body)
+	}
+	for _, expected := range []string{
+		`<link rel="canonical" href="https://moovie.example/person/5">`, "Tim Robbins", "共 2 部作品",
+		`href="/movie/1292052"`, "饰 安迪", `href="/movie/m43"`, "导演",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("person page missing %q", expected)
+		}
+	}
+	if strings.Count(body, "person-playback-badge\">") != 1 {
+		t.Fatalf("playback badges = %d, want only the playable credit", strings.Count(body, "person-playback-badge\">"))
+	}
+
+	for _, path := range []string{"/person/6", "/person/imdb-nm0000209", "/person/abc"} {
+		missing := httptest.NewRecorder()
+		router.ServeHTTP(missing, httptest.NewRequest(http.MethodGet, path, nil))
+		if missing.Code != http.StatusNotFound {
+			t.Fatalf("%s = %d, want 404", path, missing.Code)
+		}
+	}
+}
+
+func TestMoviePageUsesCollectionForWatchInOrderNavigation(t *testing.T) {
+	store := NewPostgresStore(testdb.Pool(t))
+	_ = store.Upsert(t.Context(), Movie{DoubanID: "1291843", Title: "黑客帝国2：重装上阵", Year: "2003", EmbeddingContent: "ready"})
+	current, err := store.FindByDoubanID(t.Context(), "1291843")
+	if err != nil || current == nil {
+		t.Fatalf("seed movie = %+v, %v", current, err)
+	}
+	collections := &collectionReaderStub{collection: mediaidentity.Collection{ID: 9, Kind: mediaidentity.CollectionMovie, Name: "黑客帝国（系列）",
+		Items: []mediaidentity.CollectionItem{
+			{MediaID: current.ID - 1, DoubanID: "1291843", Title: "黑客帝国", Year: "1999"},
+			{MediaID: current.ID, DoubanID: "1291843", Title: "黑客帝国2：重装上阵", Year: "2003"},
+			{MediaID: current.ID + 1, Title: "黑客帝国：矩阵重启", Year: "2021"},
+		}}}
+	collections.collection.Items[0].DoubanID = "1291841"
+	finder := staticSimilarFinder{{DoubanID: "1291841", Title: "黑客帝国"}, {DoubanID: "other", Title: "盗梦空间"}}
+	router := catalogTestRouterWithOptions(t, store, nil, WithCollections(collections), WithSimilarFinder(finder))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/movie/1291843", nil))
+	body := recorder.Body.String()
+	for _, expected := range []string{`aria-label="按顺序观看"`, `href="/collection/9"`, "共 3 部", `href="/movie/1291841"`,
+		fmt.Sprintf(`href="/movie/m%d"`, current.ID+1), `aria-current="page"`, "盗梦空间"} {
+		if recorder.Code != http.StatusOK || !strings.Contains(body, expected) {
+			t.Fatalf("collection navigation missing %q: %d/%s", expected, recorder.Code, body)
+		}
+	}
+	if strings.Contains(body, `aria-label="本剧季度"`) || strings.Count(body, ">黑客帝国<") != 1 {
+		t.Fatalf("collection member leaked into recommendations or legacy navigation: %s", body)
+	}
+}
+
+func TestCollectionPageShowsOrderPlaybackAndSignedInProgress(t *testing.T) {
+	collections := &collectionReaderStub{
+		collection: mediaidentity.Collection{ID: 3, Kind: mediaidentity.CollectionSeries, Name: "末日地堡",
+			Items: []mediaidentity.CollectionItem{
+				{MediaID: 11, DoubanID: "35468745", Title: "末日地堡 第一季", Year: "2023", SeasonNumber: 1},
+				{MediaID: 12, DoubanID: "36444323", Title: "末日地堡 第二季", Year: "2024", SeasonNumber: 2},
+				{MediaID: 13, Title: "末日地堡 第三季", Year: "2026", SeasonNumber: 3},
+			}},
+		progress: map[int]string{11: mediaidentity.CollectionWatched, 12: mediaidentity.CollectionWatching},
+	}
+	router := catalogTestRouterWithOptions(t, nil, nil, WithCollections(collections), WithResourceLister(summaryResourceLister{13: true}))
+
+	anonymous := httptest.NewRecorder()
+	router.ServeHTTP(anonymous, httptest.NewRequest(http.MethodGet, "/collection/3", nil))
+	body := anonymous.Body.String()
+	for _, expected := range []string{`<link rel="canonical" href="https://moovie.example/collection/3">`, "共 3 季",
+		`href="/movie/35468745"`, `href="/movie/m13"`, "第3季", "可播放"} {
+		if anonymous.Code != http.StatusOK || !strings.Contains(body, expected) {
+			t.Fatalf("collection page missing %q: %d/%s", expected, anonymous.Code, body)
+		}
+	}
+	if strings.Contains(body, "已看完") || collections.progressCalls != 0 {
+		t.Fatalf("anonymous visitor saw progress: calls=%d", collections.progressCalls)
+	}
+
+	now := time.Now()
+	token, _ := auth.Sign(auth.Claims{UserID: 7, Email: "user@example.com", Role: "user", Issued: now.Unix(), Expiry: now.Add(time.Hour).Unix()}, "secret")
+	request := httptest.NewRequest(http.MethodGet, "/collection/3", nil)
+	request.AddCookie(&http.Cookie{Name: "token", Value: token})
+	signedIn := httptest.NewRecorder()
+	router.ServeHTTP(signedIn, request)
+	body = signedIn.Body.String()
+	for _, expected := range []string{"已看完 1 / 3，在看 1", "width: 33%", "继续看：第2季"} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("signed-in collection page missing %q: %s", expected, body)
+		}
+	}
+
+	for _, path := range []string{"/collection/4", "/collection/abc"} {
+		missing := httptest.NewRecorder()
+		router.ServeHTTP(missing, httptest.NewRequest(http.MethodGet, path, nil))
+		if missing.Code != http.StatusNotFound {
+			t.Fatalf("%s = %d, want 404", path, missing.Code)
+		}
+	}
+}
+
 func TestMediaSuggestPreservesAPIEnvelopeAndValidation(t *testing.T) {
 	router := catalogTestRouterWithOptions(t, NewPostgresStore(testdb.Pool(t)), nil, WithSuggester(staticSuggester{{ID: "1292052", Title: "肖申克"}}))
 	missing := httptest.NewRecorder()
@@ -381,7 +507,7 @@ func catalogTestRouterWithOptions(t *testing.T, store Store, userMovies UserMovi
 	if userMovies != nil {
 		options = append(options, WithUserMovies(userMovies))
 	}
-	renderer, err := platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), []string{"movie", "fetching"})
+	renderer, err := platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), []string{"movie", "fetching", "person", "collection", "404"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -447,13 +573,21 @@ func (syncer *recordingBackdropSyncer) SyncBackdrops(_ context.Context, doubanID
 	return nil
 }
 
-type recordingVectorEnricher struct{ ids []string }
+type recordingVectorEnricher struct {
+	ids      []string
+	mediaIDs []int
+}
 
 func (enricher *recordingVectorEnricher) Enrich(_ context.Context, doubanID string) error {
 	enricher.ids = append(enricher.ids, doubanID)
 	return nil
 }
 
+func (enricher *recordingVectorEnricher) EnrichMedia(_ context.Context, mediaID int) error {
+	enricher.mediaIDs = append(enricher.mediaIDs, mediaID)
+	return nil
+}
+
 type staticSuggester []Suggestion
 
 func (suggestions staticSuggester) Suggest(context.Context, string) ([]Suggestion, error) {
@@ -471,6 +605,77 @@ func (resources *staticResourceLister) PlaybackSummary(_ context.Context, mediaI
 	return summary, nil
 }
 
+// summaryResourceLister 只给表里为 true 的作品返回可播摘要。
+type summaryResourceLister map[int]bool
+
+func (resources summaryResourceLister) PlaybackSummary(ctx context.Context, mediaID int) (search.PlaybackSummary, error) {
+	summaries, err := resources.ListPlaybackSummaries(ctx, []int{mediaID})
+	return summaries[mediaID], err
+}
+
+func (resources summaryResourceLister) ListPlaybackSummaries(_ context.Context, mediaIDs []int) (map[int]search.PlaybackSummary, error) {
+	summaries := map[int]search.PlaybackSummary{}
+	for _, mediaID := range mediaIDs {
+		summary := search.PlaybackSummary{MediaID: mediaID, State: search.PlaybackNone}
+		if resources[mediaID] {
+			best := search.VodItem{SourceKey: "source", VodId: strconv.Itoa(mediaID), PlaybackState: search.PlaybackReady}
+			summary.State, summary.ResourceCount, summary.BestResource = search.PlaybackReady, 1, &best
+		}
+		summaries[mediaID] = summary
+	}
+	return summaries, nil
+}
+
+type personReaderStub struct {
+	person  mediaidentity.Person
+	credits []mediaidentity.PersonCredit
+}
+
+func (people *personReaderStub) FindPerson(_ context.Context, id int) (mediaidentity.Person, error) {
+	if id != people.person.ID {
+		return mediaidentity.Person{}, mediaidentity.ErrPersonNotFound
+	}
+	return people.person, nil
+}
+
+func (people *personReaderStub) FindPersonByExternalID(_ context.Context, provider, externalID string) (mediaidentity.Person, error) {
+	if (provider == "douban" && externalID == people.person.DoubanID) || (provider == "tmdb" && externalID == people.person.TMDBID) {
+		return people.person, nil
+	}
+	return mediaidentity.Person{}, mediaidentity.ErrPersonNotFound
+}
+
+func (people *personReaderStub) ListPersonCredits(context.Context, int) ([]mediaidentity.PersonCredit, error) {
+	return people.credits, nil
+}
+
+type collectionReaderStub struct {
+	collection    mediaidentity.Collection
+	progress      map[int]string
+	progressCalls int
+}
+
+func (collections *collectionReaderStub) FindCollection(_ context.Context, id int) (mediaidentity.Collection, error) {
+	if id != collections.collection.ID {
+		return mediaidentity.Collection{}, mediaidentity.ErrCollectionNotFound
+	}
+	return collections.collection, nil
+}
+
+func (collections *collectionReaderStub) FindMediaCollection(_ context.Context, mediaID int) (mediaidentity.Collection, error) {
+	for _, item := range collections.collection.Items {
+		if item.MediaID == mediaID {
+			return mediaidentity.Collection{ID: collections.collection.ID, Kind: collections.collection.Kind, Name: collections.collection.Name}, nil
+		}
+	}
+	return mediaidentity.Collection{}, mediaidentity.ErrCollectionNotFound
+}
+
+func (collections *collectionReaderStub) ListCollectionProgress(context.Context, int, int) (map[int]string, error) {
+	collections.progressCalls++
+	return collections.progress, nil
+}
+
 type staticSimilarFinder []Movie
 
 func (movies staticSimilarFinder) FindSimilar(context.Context, string, int) ([]Movie, error) {
@@ -0,0 +1,222 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 磁盘缓存的维护参数：命中后至少隔一小时才刷新一次访问时间，避免每次命中都写磁盘；
+// 超限后淘汰到上限的 90%，留出余量免得每次写入都触发淘汰；写了一半的临时文件一小时后清掉。
+const (
+	imageCacheTouchInterval = time.Hour
+	imageCacheTrimRatio     = 0.9
+	imageCacheTempSuffix    = ".tmp"
+	imageCacheTempMaxAge    = time.Hour
+)
+
+// CachedImage 是缓存里的一个图片变体（某个宽度、某种格式）。
+type CachedImage struct {
+	ContentType string
+	Body        []byte
+}
+
+// ImageCache 是图片代理的磁盘缓存，按容量上限做 LRU 淘汰。
+// 文件按 key 的 sha256 分两级目录存放，首行是 Content-Type；访问时间记在文件的 mtime 上，
+// 所以 web 和 worker 两个进程共用同一个目录也能正确淘汰，不需要额外的索引文件。
+type ImageCache struct {
+	dir      string
+	maxBytes int64
+	now      func() time.Time
+
+	size     atomic.Int64
+	trimming atomic.Bool
+	trimMu   sync.Mutex
+}
+
+// NewImageCache 创建磁盘缓存，目录不存在时自动创建。maxBytes 是缓存目录的总大小上限。
+func NewImageCache(dir string, maxBytes int64) (*ImageCache, error) {
+	if strings.TrimSpace(dir) == "" || maxBytes <= 0 {
+		return nil, errors.New("image cache needs a directory and a positive size limit")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create image cache directory: %w", err)
+	}
+	cache := &ImageCache{dir: dir, maxBytes: maxBytes, now: time.Now}
+	usage, err := cache.usage()
+	if err != nil {
+		return nil, err
+	}
+	cache.size.Store(usage)
+	return cache, nil
+}
+
+// imageCacheKey 把源地址和变体参数折成缓存 key，也直接用作 ETag。
+func imageCacheKey(targetURL string, width int, format string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s", targetURL, width, format)))
+	return hex.EncodeToString(sum[:])
+}
+
+// path 返回 key 对应的文件路径，前两位做子目录，避免单个目录下文件过多。
+func (cache *ImageCache) path(key string) string {
+	return filepath.Join(cache.dir, key[:2], key)
+}
+
+// Get 读取缓存。文件损坏时当作未命中，下次写入会覆盖它。
+func (cache *ImageCache) Get(key string) (CachedImage, bool) {
+	path := cache.path(key)
+	contents, err := os.ReadFile(path) // #nosec G304 -- key 是 sha256 十六进制串，路径不可能逃出缓存目录。
+	if err != nil {
+		return CachedImage{}, false
+	}
+	contentType, body, ok := bytes.Cut(contents, []byte("\n"))
+	if !ok || !strings.HasPrefix(string(contentType), "image/") || len(body) == 0 {
+		return CachedImage{}, false
+	}
+	if info, err := os.Stat(path); err == nil && cache.now().Sub(info.ModTime()) > imageCacheTouchInterval {
+		now := cache.now()
+		_ = os.Chtimes(path, now, now)
+	}
+	return CachedImage{ContentType: string(contentType), Body: body}, true
+}
+
+// Put 写入缓存：先写临时文件再改名，读方永远看不到写了一半的图片。
+// 写入后超出容量上限时在后台淘汰，不拖慢当前请求。
+func (cache *ImageCache) Put(key string, image CachedImage) error {
+	if !strings.HasPrefix(image.ContentType, "image/") || strings.ContainsAny(image.ContentType, "\r\n") || len(image.Body) == 0 {
+		return errors.New("refusing to cache a non-image response")
+	}
+	path := cache.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("create image cache shard: %w", err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), key+"-*"+imageCacheTempSuffix)
+	if err != nil {
+		return fmt.Errorf("create image cache file: %w", err)
+	}
+	writer := bufio.NewWriter(temp)
+	_, _ = writer.WriteString(image.ContentType + "\n")
+	_, _ = writer.Write(image.Body)
+	if err := writer.Flush(); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+		return fmt.Errorf("write image cache file: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		_ = os.Remove(temp.Name())
+		return fmt.Errorf("close image cache file: %w", err)
+	}
+	// 覆盖已有文件时只计入大小差，否则同一张图反复写入会把 size 越记越大，提前触发淘汰。
+	var replaced int64
+	if info, err := os.Stat(path); err == nil {
+		replaced = info.Size()
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		_ = os.Remove(temp.Name())
+		return fmt.Errorf("store image cache file: %w", err)
+	}
+	if cache.size.Add(int64(len(image.ContentType)+1+len(image.Body))-replaced) > cache.maxBytes && cache.trimming.CompareAndSwap(false, true) {
+		go func() {
+			defer cache.trimming.Store(false)
+			_, _ = cache.Trim(context.Background())
+		}()
+	}
+	return nil
+}
+
+// imageCacheEntry 是淘汰时扫描到的一个缓存文件。
+type imageCacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Trim 扫描缓存目录，按最近访问时间从旧到新删文件，直到总大小回到上限的 90% 以内；
+// 顺带清掉进程崩溃留下的临时文件。返回删除的文件数，由运维清理任务定期调用。
+func (cache *ImageCache) Trim(ctx context.Context) (int, error) {
+	cache.trimMu.Lock()
+	defer cache.trimMu.Unlock()
+	entries, total, removed, err := cache.scan(ctx)
+	if err != nil {
+		return removed, err
+	}
+	if total > cache.maxBytes {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+		target := int64(float64(cache.maxBytes) * imageCacheTrimRatio)
+		for _, entry := range entries {
+			if total <= target {
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				cache.size.Store(total)
+				return removed, err
+			}
+			if err := os.Remove(entry.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			total -= entry.size
+			removed++
+		}
+	}
+	cache.size.Store(total)
+	return removed, nil
+}
+
+// usage 统计缓存目录当前的总大小。
+func (cache *ImageCache) usage() (int64, error) {
+	cache.trimMu.Lock()
+	defer cache.trimMu.Unlock()
+	_, total, _, err := cache.scan(context.Background())
+	return total, err
+}
+
+// scan 列出所有缓存文件并删掉过期的临时文件。
+func (cache *ImageCache) scan(ctx context.Context) ([]imageCacheEntry, int64, int, error) {
+	var entries []imageCacheEntry
+	var total int64
+	removed := 0
+	staleBefore := cache.now().Add(-imageCacheTempMaxAge)
+	err := filepath.WalkDir(cache.dir, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if errors.Is(walkErr, fs.ErrNotExist) {
+				return nil
+			}
+			return walkErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasSuffix(entry.Name(), imageCacheTempSuffix) {
+			if info.ModTime().Before(staleBefore) && os.Remove(path) == nil {
+				removed++
+			}
+			return nil
+		}
+		entries = append(entries, imageCacheEntry{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, 0, removed, fmt.Errorf("scan image cache: %w", err)
+	}
+	return entries, total, removed, nil
+}
@@ -0,0 +1,174 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	"github.com/gin-gonic/gin"
+)
+
+type stubImageEncoder string
+
+func (encoder stubImageEncoder) ContentType() string { return string(encoder) }
+
+func (encoder stubImageEncoder) Encode(_ context.Context, img image.Image) ([]byte, error) {
+	return fmt.Appendf(nil, "%s:%dx%d", encoder, img.Bounds().Dx(), img.Bounds().Dy()), nil
+}
+
+func TestImageCacheTrimEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := NewImageCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	keys := []string{imageCacheKey("https://a", 0, "original"), imageCacheKey("https://b", 0, "original"), imageCacheKey("https://c", 0, "original")}
+	for index, key := range keys {
+		// 每个文件 40 字节（含首行 Content-Type），三个一起超过 100 字节的上限。
+		if err := cache.Put(key, CachedImage{ContentType: "image/jpeg", Body: bytes.Repeat([]byte{'x'}, 29)}); err != nil {
+			t.Fatal(err)
+		}
+		modTime := base.Add(time.Duration(index) * time.Hour)
+		if err := os.Chtimes(cache.path(key), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 写完再收紧上限，避免写入时触发的后台淘汰抢在设置访问时间之前跑掉。
+	cache.maxBytes = 100
+	// 最早写入的 a 刚被读过，应该按访问时间保留下来，淘汰 b。
+	cache.now = func() time.Time { return base.Add(5 * time.Hour) }
+	if _, ok := cache.Get(keys[0]); !ok {
+		t.Fatal("cached image was not readable")
+	}
+	removed, err := cache.Trim(t.Context())
+	if err != nil || removed != 1 {
+		t.Fatalf("trim removed %d, err = %v", removed, err)
+	}
+	if _, ok := cache.Get(keys[1]); ok {
+		t.Fatal("least recently used image survived the trim")
+	}
+	for _, key := range []string{keys[0], keys[2]} {
+		if cached, ok := cache.Get(key); !ok || cached.ContentType != "image/jpeg" || len(cached.Body) != 29 {
+			t.Fatalf("recent image %s = %+v, %v", key, cached, ok)
+		}
+	}
+}
+
+func TestImageCachePutCountsOnlyTheSizeDifferenceWhenOverwriting(t *testing.T) {
+	cache, err := NewImageCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := imageCacheKey("https://a", 0, "original")
+	// 首行 "image/jpeg\n" 占 11 字节：第一次写入 40 字节，覆盖成 20 字节后总量应是 20。
+	for _, length := range []int{29, 29, 9} {
+		if err := cache.Put(key, CachedImage{ContentType: "image/jpeg", Body: bytes.Repeat([]byte{'x'}, length)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size := cache.size.Load(); size != 20 {
+		t.Fatalf("cache size after overwrites = %d, want 20", size)
+	}
+}
+
+func TestImageVariantWidthNegotiationAndResize(t *testing.T) {
+	for raw, want := range map[string]int{"": 0, "abc": 0, "-5": 0, "1": 160, "300": 320, "320": 320, "5000": 960} {
+		if got := imageVariantWidth(raw); got != want {
+			t.Errorf("imageVariantWidth(%q) = %d, want %d", raw, got, want)
+		}
+	}
+	encoders := []ImageEncoder{stubImageEncoder("image/avif"), stubImageEncoder("image/webp")}
+	if got := negotiateImageEncoder("image/avif,image/webp,*/*;q=0.8", encoders); got != encoders[0] {
+		t.Fatalf("preferred encoder = %v", got)
+	}
+	if got := negotiateImageEncoder("image/avif;q=0, image/webp;q=0.8", encoders); got != encoders[1] {
+		t.Fatalf("encoder refused with q=0 = %v", got)
+	}
+	if got := negotiateImageEncoder("image/png,*/*", encoders); got != nil {
+		t.Fatalf("encoder without browser support = %v", got)
+	}
+	source := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		source.Set(x, 0, color.RGBA{R: uint8(x * 60), A: 255})
+		source.Set(x, 1, color.RGBA{R: uint8(x * 60), A: 255})
+	}
+	resized := resizeImage(source, 2)
+	if resized.Bounds().Dx() != 2 || resized.Bounds().Dy() != 1 {
+		t.Fatalf("resized bounds = %v", resized.Bounds())
+	}
+	if r, _, _, _ := resized.At(1, 0).RGBA(); r>>8 != 150 {
+		t.Fatalf("area average of 120 and 180 = %d", r>>8)
+	}
+	if resizeImage(source, 960) != image.Image(source) {
+		t.Fatal("resize must never upscale")
+	}
+}
+
+func TestCachedImageProxyServesImmutableVariants(t *testing.T) {
+	poster := image.NewRGBA(image.Rect(0, 0, 800, 1200))
+	var original bytes.Buffer
+	if err := jpeg.Encode(&original, poster, nil); err != nil {
+		t.Fatal(err)
+	}
+	var upstreamCalls atomic.Int32
+	client := &http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		upstreamCalls.Add(1)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"image/jpeg"}},
+			Body: io.NopCloser(bytes.NewReader(original.Bytes())), Request: request}, nil
+	})}
+	cache, err := NewImageCache(t.TempDir(), 10<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := NewHandler(config.Config{SiteURL: "https://moovie.example"}, nil, WithHTTPClient(client), WithImageCache(cache, stubImageEncoder("image/webp")))
+	router.GET("/api/proxy/image/:url", handler.proxyImage)
+	serve := func(width, accept, ifNoneMatch string) *httptest.ResponseRecorder {
+		request := sameOriginImageRequest(proxyImageURL("https://img3.doubanio.com/view/poster.jpg") + "?w=" + width)
+		request.Header.Set("Accept", accept)
+		if ifNoneMatch != "" {
+			request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	webp := serve("300", "image/webp,*/*", "")
+	if webp.Code != http.StatusOK || webp.Body.String() != "image/webp:320x480" || webp.Header().Get("Content-Type") != "image/webp" {
+		t.Fatalf("webp variant = %d/%q/%q", webp.Code, webp.Header().Get("Content-Type"), webp.Body.String())
+	}
+	etag := webp.Header().Get("ETag")
+	if etag == "" || webp.Header().Get("Cache-Control") != "private, max-age=31536000, immutable" ||
+		!strings.Contains(webp.Header().Get("Vary"), "Accept") {
+		t.Fatalf("variant headers = %#v", webp.Header())
+	}
+	if revalidated := serve("300", "image/webp,*/*", etag); revalidated.Code != http.StatusNotModified || revalidated.Body.Len() != 0 {
+		t.Fatalf("conditional request = %d", revalidated.Code)
+	}
+	if cached := serve("320", "image/webp,*/*", ""); cached.Body.String() != "image/webp:320x480" || cached.Header().Get("ETag") != etag {
+		t.Fatalf("snapped width should hit the same variant: %q", cached.Body.String())
+	}
+	fallback := serve("160", "image/png,*/*", "")
+	decoded, format, err := image.Decode(fallback.Body)
+	if err != nil || format != "jpeg" || decoded.Bounds().Dx() != 160 || fallback.Header().Get("ETag") == etag {
+		t.Fatalf("jpeg fallback = %v/%q/%v", err, format, fallback.Header())
+	}
+	// 源图也进了缓存：换宽度、换格式都不再回源。
+	if calls := upstreamCalls.Load(); calls != 1 {
+		t.Fatalf("upstream fetched %d times", calls)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/netip"
@@ -17,7 +19,11 @@ import (
 )
 
 // imageProxyPrefix 是代理链接里的固定前缀，用来挡掉随手拼 base64 的请求。
-const imageProxyPrefix = "r76RqSIVvUryzx"
+// imageVariantTimeout 是缓存未命中时回源加转码的总时限。
+const (
+	imageProxyPrefix    = "r76RqSIVvUryzx"
+	imageVariantTimeout = 30 * time.Second
+)
 
 // 图片代理的安全名单：禁止访问内网和保留地址段，防止被当作内网探测跳板。
 var (
@@ -70,37 +76,13 @@ func (handler *Handler) proxyImage(c *gin.Context) {
 		c.Status(http.StatusForbidden)
 		return
 	}
-	request, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, targetURL, nil)
-	if err != nil {
-		catalogAPIError(c, http.StatusInternalServerError, "创建请求失败")
+	if handler.imageCache != nil {
+		handler.serveCachedImage(c, targetURL)
 		return
 	}
-	request.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	request.Header.Set("Referer", imageProxyReferer(targetURL))
-	client := *handler.httpClient
-	previousCheckRedirect := client.CheckRedirect
-	client.CheckRedirect = func(redirect *http.Request, via []*http.Request) error {
-		if len(via) >= 3 {
-			return fmt.Errorf("stopped after 3 redirects")
-		}
-		normalized, err := validateImageProxyTarget(redirect.URL.String())
-		if err != nil {
-			return err
-		}
-		redirect.URL, _ = url.Parse(normalized)
-		redirect.Header.Set("Referer", imageProxyReferer(normalized))
-		if previousCheckRedirect != nil {
-			return previousCheckRedirect(redirect, via)
-		}
-		return nil
-	}
-	response, err := client.Do(request)
+	response, err := fetchProxyImage(c.Request.Context(), handler.httpClient, targetURL)
 	if err != nil {
-		if errors.Is(err, errUnsafeImageProxyTarget) {
-			c.Status(http.StatusForbidden)
-			return
-		}
-		catalogAPIError(c, http.StatusInternalServerError, "请求图片失败")
+		writeProxyImageFetchError(c, err)
 		return
 	}
 	defer response.Body.Close()
@@ -125,6 +107,165 @@ func (handler *Handler) proxyImage(c *gin.Context) {
 	c.DataFromReader(http.StatusOK, response.ContentLength, contentType, reader, nil)
 }
 
+// 磁盘缓存路径上取图失败的几种情况，映射成不同的响应码。
+var (
+	errProxyImageNotImage = errors.New("proxied response is not an image")
+	errProxyImageTooLarge = errors.New("proxied image exceeds the size limit")
+)
+
+// imageUpstreamStatus 是上游返回的非 200 状态码，原样转给浏览器。
+type imageUpstreamStatus int
+
+func (status imageUpstreamStatus) Error() string {
+	return fmt.Sprintf("image upstream returned %d", int(status))
+}
+
+// serveCachedImage 是启用磁盘缓存后的代理路径：按 ?w= 和 Accept 选出变体，命中直接读盘，
+// 未命中时取源图、缩放转码后写回缓存。变体内容只由 key 决定，所以可以用 key 做 ETag 并标记 immutable。
+func (handler *Handler) serveCachedImage(c *gin.Context, targetURL string) {
+	c.Header("Vary", "Sec-Fetch-Site, Sec-Fetch-Dest, Sec-Fetch-Mode, Accept")
+	width := imageVariantWidth(c.Query("w"))
+	encoder := negotiateImageEncoder(c.GetHeader("Accept"), handler.imageEncoders)
+	format := "original"
+	if encoder != nil {
+		format = encoder.ContentType()
+	}
+	key := imageCacheKey(targetURL, width, format)
+	etag := `"` + key[:32] + `"`
+	if match := c.GetHeader("If-None-Match"); match != "" && (match == "*" || strings.Contains(match, etag)) {
+		writeImmutableImageHeaders(c, etag)
+		c.Status(http.StatusNotModified)
+		return
+	}
+	cached, ok := handler.imageCache.Get(key)
+	if !ok {
+		// 同一张海报的并发未命中只回源一次；回源不跟随单个请求取消，免得先到的请求断开后其他人全部失败。
+		value, err, _ := handler.imageFlight.Do(key, func() (any, error) {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), imageVariantTimeout)
+			defer cancel()
+			return handler.loadImageVariant(ctx, targetURL, key, width, encoder)
+		})
+		if err != nil {
+			writeCachedImageError(c, err)
+			return
+		}
+		cached = value.(CachedImage)
+	}
+	writeImmutableImageHeaders(c, etag)
+	c.Data(http.StatusOK, cached.ContentType, cached.Body)
+}
+
+// loadImageVariant 取源图并生成变体。源图本身也单独缓存一份，换个宽度或格式不必再回源豆瓣。
+func (handler *Handler) loadImageVariant(ctx context.Context, targetURL, key string, width int, encoder ImageEncoder) (CachedImage, error) {
+	sourceKey := imageCacheKey(targetURL, 0, "original")
+	original, ok := handler.imageCache.Get(sourceKey)
+	if !ok {
+		var err error
+		if original, err = downloadProxyImage(ctx, handler.httpClient, targetURL); err != nil {
+			return CachedImage{}, err
+		}
+		if err := handler.imageCache.Put(sourceKey, original); err != nil {
+			slog.Warn("image cache write failed", "error", err)
+		}
+	}
+	if key == sourceKey {
+		return original, nil
+	}
+	variant := buildImageVariant(ctx, original, width, encoder)
+	if err := handler.imageCache.Put(key, variant); err != nil {
+		slog.Warn("image cache write failed", "error", err)
+	}
+	return variant, nil
+}
+
+// downloadProxyImage 把源图完整读进内存，超过上限或不是图片时报错。
+func downloadProxyImage(ctx context.Context, client *http.Client, targetURL string) (CachedImage, error) {
+	response, err := fetchProxyImage(ctx, client, targetURL)
+	if err != nil {
+		return CachedImage{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return CachedImage{}, imageUpstreamStatus(response.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxProxyImageBytes+1))
+	if err != nil {
+		return CachedImage{}, err
+	}
+	if len(body) > maxProxyImageBytes {
+		return CachedImage{}, errProxyImageTooLarge
+	}
+	contentType := response.Header.Get("Content-Type")
+	if !strings.HasPrefix(strings.ToLower(contentType), "image/") {
+		contentType = http.DetectContentType(body)
+	}
+	if !strings.HasPrefix(strings.ToLower(contentType), "image/") {
+		return CachedImage{}, errProxyImageNotImage
+	}
+	return CachedImage{ContentType: contentType, Body: body}, nil
+}
+
+// writeCachedImageError 把缓存路径上的取图错误映射成和直连路径一致的响应。
+func writeCachedImageError(c *gin.Context, err error) {
+	var status imageUpstreamStatus
+	switch {
+	case errors.As(err, &status):
+		c.Status(int(status))
+	case errors.Is(err, errProxyImageNotImage):
+		c.Status(http.StatusUnsupportedMediaType)
+	case errors.Is(err, errProxyImageTooLarge):
+		c.Status(http.StatusBadGateway)
+	default:
+		writeProxyImageFetchError(c, err)
+	}
+}
+
+// writeImmutableImageHeaders 写缓存变体的响应头：一年有效且 immutable，浏览器刷新也不会再来校验。
+func writeImmutableImageHeaders(c *gin.Context, etag string) {
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.Header("Expires", time.Now().AddDate(1, 0, 0).Format(http.TimeFormat))
+	c.Header("ETag", etag)
+	c.Header("Cross-Origin-Resource-Policy", "same-origin")
+	c.Header("X-Content-Type-Options", "nosniff")
+}
+
+// fetchProxyImage 带上伪装的 User-Agent 和对应站点的 Referer 去取图，每一跳重定向都重新做地址校验。
+func fetchProxyImage(ctx context.Context, httpClient *http.Client, targetURL string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	request.Header.Set("Referer", imageProxyReferer(targetURL))
+	client := *httpClient
+	previousCheckRedirect := client.CheckRedirect
+	client.CheckRedirect = func(redirect *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return fmt.Errorf("stopped after 3 redirects")
+		}
+		normalized, err := validateImageProxyTarget(redirect.URL.String())
+		if err != nil {
+			return err
+		}
+		redirect.URL, _ = url.Parse(normalized)
+		redirect.Header.Set("Referer", imageProxyReferer(normalized))
+		if previousCheckRedirect != nil {
+			return previousCheckRedirect(redirect, via)
+		}
+		return nil
+	}
+	return client.Do(request)
+}
+
+// writeProxyImageFetchError 把取图失败映射成响应：命中内网地址是 403，其余按上游故障处理。
+func writeProxyImageFetchError(c *gin.Context, err error) {
+	if errors.Is(err, errUnsafeImageProxyTarget) {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	catalogAPIError(c, http.StatusInternalServerError, "请求图片失败")
+}
+
 // isSameOriginImageRequest 用浏览器发的 Sec-Fetch-* 头判断是不是本站页面在加载图片。
 func isSameOriginImageRequest(request *http.Request) bool {
 	return request.Header.Get("Sec-Fetch-Site") == "same-origin" &&
@@ -0,0 +1,221 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// imageVariantWidths 是允许的缩放宽度。只给固定几档，任意 ?w= 都会向上取到最近的一档，
+// 否则别人换着宽度请求就能把缓存目录撑爆。
+var imageVariantWidths = []int{160, 320, 480, 640, 960}
+
+// 图片处理的安全边界：源图超过这个大小或像素数就不解码，原样透传。
+const (
+	maxProxyImageBytes  = 10 << 20
+	maxProxyImagePixels = 6000 * 6000
+	proxyJPEGQuality    = 82
+)
+
+// imageVariantWidth 把 ?w= 对齐到允许的宽度，0 表示不缩放。
+func imageVariantWidth(raw string) int {
+	width, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || width <= 0 {
+		return 0
+	}
+	for _, allowed := range imageVariantWidths {
+		if width <= allowed {
+			return allowed
+		}
+	}
+	return imageVariantWidths[len(imageVariantWidths)-1]
+}
+
+// ImageEncoder 把解码后的图片编码成某种格式，供图片代理按浏览器的 Accept 头输出。
+type ImageEncoder interface {
+	ContentType() string
+	Encode(ctx context.Context, img image.Image) ([]byte, error)
+}
+
+// jpegImageEncoder 是缩放后 JPEG 源图的默认编码器。
+type jpegImageEncoder struct{}
+
+func (jpegImageEncoder) ContentType() string { return "image/jpeg" }
+
+func (jpegImageEncoder) Encode(_ context.Context, img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: proxyJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// pngImageEncoder 用于带透明通道的 PNG 源图。
+type pngImageEncoder struct{}
+
+func (pngImageEncoder) ContentType() string { return "image/png" }
+
+func (pngImageEncoder) Encode(_ context.Context, img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// commandImageEncoder 调用外部命令（cwebp、avifenc）编码。标准库没有 WebP/AVIF 编码器，
+// 引入 cgo 依赖又会让镜像构建变复杂，所以交给系统里装好的命令行工具。
+type commandImageEncoder struct {
+	contentType string
+	args        []string
+}
+
+// NewCommandImageEncoder 创建外部命令编码器。command 里用 {in} 和 {out} 表示输入输出文件，
+// 例如 "cwebp -quiet -q 80 {in} -o {out}"；输入固定是 PNG。
+func NewCommandImageEncoder(contentType, command string) (ImageEncoder, error) {
+	args := strings.Fields(command)
+	if !strings.HasPrefix(contentType, "image/") || len(args) == 0 ||
+		!strings.Contains(command, "{in}") || !strings.Contains(command, "{out}") {
+		return nil, fmt.Errorf("image encoder command for %s must reference {in} and {out}", contentType)
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, fmt.Errorf("image encoder for %s: %w", contentType, err)
+	}
+	return &commandImageEncoder{contentType: contentType, args: args}, nil
+}
+
+func (encoder *commandImageEncoder) ContentType() string { return encoder.contentType }
+
+func (encoder *commandImageEncoder) Encode(ctx context.Context, img image.Image) ([]byte, error) {
+	workdir, err := os.MkdirTemp("", "moovie-image-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workdir)
+	input, output := filepath.Join(workdir, "in.png"), filepath.Join(workdir, "out")
+	source, err := (pngImageEncoder{}).Encode(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(input, source, 0o600); err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, len(encoder.args)-1)
+	for _, arg := range encoder.args[1:] {
+		args = append(args, strings.NewReplacer("{in}", input, "{out}", output).Replace(arg))
+	}
+	// #nosec G204 -- 命令来自运维配置，不来自请求；参数里只有本进程生成的临时文件路径。
+	if combined, err := exec.CommandContext(ctx, encoder.args[0], args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", encoder.args[0], err, strings.TrimSpace(string(combined)))
+	}
+	return os.ReadFile(output) // #nosec G304 -- output 在本进程创建的临时目录里。
+}
+
+// negotiateImageEncoder 按配置顺序（通常 AVIF 在前）挑出浏览器 Accept 里声明支持的编码器，
+// 都不支持时返回 nil，表示保持源图格式。
+func negotiateImageEncoder(accept string, encoders []ImageEncoder) ImageEncoder {
+	accept = strings.ToLower(accept)
+	for _, encoder := range encoders {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if strings.TrimSpace(mediaType) != encoder.ContentType() {
+				continue
+			}
+			if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if q, err := strconv.ParseFloat(value, 64); err != nil || q <= 0 {
+					continue
+				}
+			}
+			return encoder
+		}
+	}
+	return nil
+}
+
+// buildImageVariant 把源图缩放并转码成请求的变体。做不到的情况（GIF 动图、SVG、解码失败、
+// 外部编码器出错）都退回源图：宁可多传几十 KB，也不能让海报裂掉。
+func buildImageVariant(ctx context.Context, original CachedImage, width int, encoder ImageEncoder) CachedImage {
+	if width == 0 && encoder == nil {
+		return original
+	}
+	sourceType := strings.ToLower(original.ContentType)
+	if !strings.Contains(sourceType, "jpeg") && !strings.Contains(sourceType, "png") {
+		return original
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(original.Body))
+	if err != nil || config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxProxyImagePixels {
+		return original
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(original.Body))
+	if err != nil {
+		return original
+	}
+	resized := resizeImage(decoded, width)
+	encoders := []ImageEncoder{jpegImageEncoder{}}
+	if strings.Contains(sourceType, "png") {
+		encoders = []ImageEncoder{pngImageEncoder{}}
+	}
+	if encoder != nil {
+		encoders = append([]ImageEncoder{encoder}, encoders...)
+	}
+	for _, candidate := range encoders {
+		body, err := candidate.Encode(ctx, resized)
+		if err != nil || len(body) == 0 {
+			continue
+		}
+		// 没缩放时转码只为了省流量，结果反而更大就没必要了。
+		if resized == decoded && len(body) >= len(original.Body) {
+			return original
+		}
+		return CachedImage{ContentType: candidate.ContentType(), Body: body}
+	}
+	return original
+}
+
+// resizeImage 按宽度等比缩小，源图不比目标宽时原样返回（只缩不放）。
+// 用区域平均采样：每个目标像素取它覆盖的源像素均值，缩小海报时不会出现最近邻那种锯齿。
+func resizeImage(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if width <= 0 || bounds.Dx() <= width {
+		return src
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sourceWidth, sourceHeight := bounds.Dx(), bounds.Dy()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sourceHeight/height, max((y+1)*sourceHeight/height, y*sourceHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sourceWidth/width, max((x+1)*sourceWidth/width, x*sourceWidth/width+1)
+			var r, g, b, a, count int
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(rgba.Pix[offset])
+					g += int(rgba.Pix[offset+1])
+					b += int(rgba.Pix[offset+2])
+					a += int(rgba.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+			target := dst.PixOffset(x, y)
+			dst.Pix[target] = uint8(r / count)
+			dst.Pix[target+1] = uint8(g / count)
+			dst.Pix[target+2] = uint8(b / count)
+			dst.Pix[target+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
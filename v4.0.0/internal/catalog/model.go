@@ -7,12 +7,18 @@
 //	media_external_ids   外部 ID 映射（imdb / tmdb / douban）
 //	media_aliases        别名        media_units 季集信息
 //	worker_jobs          资料刷新任务队列
+//	embedding_generations 向量代际（模型 + 维度）
 //
 // 数据来源分工：豆瓣给主资料和短评，TMDB 给剧照和季集，Wikidata/wmdb 给 IMDb 映射，
-// Ollama 给向量（可选再经 AI Gateway 改写文案）。
+// Ollama 或 OpenAI 兼容接口给向量（可选再经 AI Gateway 改写文案，换模型时在后台重建，
+// 见 embedding_generation.go）。海报和首张剧照的 BlurHash、主色由 worker
+// 取图自算（palette.go），列表页拿来画占位。
 package catalog
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // Movie 是 media 表在页面层的视图结构。
 // 注意它并不等于数据库字段：IMDbID 来自 media_external_ids，Embedding 来自 pgvector 列。
@@ -36,6 +42,7 @@ type Movie struct {
 	Backdrops             string
 	EmbeddingContent      string
 	EmbeddingSemanticHash string
+	EmbeddingModel        string
 	Embedding             []float32
 	ReviewsJSON           string
 	ReviewsUpdatedAt      time.Time
@@ -43,10 +50,23 @@ type Movie struct {
 	CompletenessScore     int
 	NextRefreshAt         *time.Time
 	UpdatedAt             time.Time
+	ImagePalette
+}
+
+// ImagePalette 是海报和首张剧照的占位信息，由 image_palette 任务计算后写回 media。
+// 列表页用 blurhash 和主色先画占位，详情页用强调色做主题色；还没算过时都是空串，模板按无占位处理。
+type ImagePalette struct {
+	PosterBlurhash      string
+	PosterColor         string
+	PosterAccentColor   string
+	BackdropBlurhash    string
+	BackdropColor       string
+	BackdropAccentColor string
 }
 
 // SeriesSeason 是详情页季度导航所需的最小数据。
 type SeriesSeason struct {
+	MediaID      int
 	DoubanID     string
 	Title        string
 	Year         string
@@ -60,3 +80,17 @@ type Director struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 }
+
+// PersonPath 是人物页入口地址。JSON 里的 id 来自豆瓣（纯数字）或 TMDB（带 tmdb- 前缀），
+// 没有 id 的旧数据返回空串，页面上就只显示名字。
+func (person Director) PersonPath() string {
+	id := strings.TrimSpace(person.ID)
+	switch {
+	case id == "":
+		return ""
+	case strings.HasPrefix(id, "tmdb-"):
+		return "/person/" + id
+	default:
+		return "/person/douban-" + id
+	}
+}
@@ -0,0 +1,93 @@
+package catalog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 详情页 /movie/:id 的 :id 有四种写法：
+//
+//	1292052          豆瓣 ID（历史链接，仍是有豆瓣条目的作品的规范地址）
+//	m42              media.id（没有豆瓣条目的作品的规范地址）
+//	tmdb-movie-603   TMDB ID，tmdb-tv-1399 同理；本地还没有时排一个导入任务
+//	imdb-tt0133093   IMDb ID，同上
+//
+// 后两种只是入口：解析到本地作品后一律 301 到规范地址，不会出现在站内链接里。
+const (
+	MovieKeyDouban   = "douban"
+	MovieKeyMedia    = "media"
+	MovieKeyExternal = "external"
+)
+
+// MovieKey 是解析后的详情页标识。
+type MovieKey struct {
+	Kind         string
+	DoubanID     string
+	MediaID      int
+	Provider     string
+	ExternalType string
+	ExternalID   string
+}
+
+var (
+	mediaKeyPattern = regexp.MustCompile(`^m([1-9][0-9]{0,17})$`)
+	tmdbKeyPattern  = regexp.MustCompile(`^tmdb-(movie|tv)-([1-9][0-9]{0,9})$`)
+	imdbKeyPattern  = regexp.MustCompile(`^imdb-(tt[0-9]{7,10})$`)
+)
+
+// ParseMovieKey 解析详情页标识。其余写法一律按豆瓣 ID 处理，保持旧链接的行为不变
+// （格式不合法的豆瓣 ID 由入队时的 validDoubanID 拦下）。
+func ParseMovieKey(raw string) MovieKey {
+	raw = strings.TrimSpace(raw)
+	if match := mediaKeyPattern.FindStringSubmatch(raw); match != nil {
+		if mediaID, err := strconv.Atoi(match[1]); err == nil {
+			return MovieKey{Kind: MovieKeyMedia, MediaID: mediaID}
+		}
+	}
+	if match := tmdbKeyPattern.FindStringSubmatch(raw); match != nil {
+		return MovieKey{Kind: MovieKeyExternal, Provider: "tmdb", ExternalType: match[1], ExternalID: match[2]}
+	}
+	if match := imdbKeyPattern.FindStringSubmatch(raw); match != nil {
+		return MovieKey{Kind: MovieKeyExternal, Provider: "imdb", ExternalID: match[1]}
+	}
+	return MovieKey{Kind: MovieKeyDouban, DoubanID: raw}
+}
+
+// ImportSubject 是外部 ID 导入任务的 subject_key，也能被 ParseImportSubject 还原。
+// IMDb 不区分电影和剧集，所以只有 TMDB 带类型段。
+func (key MovieKey) ImportSubject() string {
+	if key.Provider == "tmdb" {
+		return fmt.Sprintf("tmdb/%s/%s", key.ExternalType, key.ExternalID)
+	}
+	return key.Provider + "/" + key.ExternalID
+}
+
+// ParseImportSubject 把导入任务的 subject_key 还原成外部 ID 标识。
+func ParseImportSubject(subject string) (MovieKey, bool) {
+	var key MovieKey
+	switch parts := strings.Split(subject, "/"); {
+	case len(parts) == 3 && parts[0] == "tmdb":
+		key = ParseMovieKey("tmdb-" + parts[1] + "-" + parts[2])
+	case len(parts) == 2 && parts[0] == "imdb":
+		key = ParseMovieKey("imdb-" + parts[1])
+	}
+	return key, key.Kind == MovieKeyExternal
+}
+
+// DetailKey 返回站内链接用的详情页标识：有豆瓣 ID 用豆瓣 ID，否则用 m<media.id>。
+func (movie Movie) DetailKey() string {
+	if movie.DoubanID != "" {
+		return movie.DoubanID
+	}
+	if movie.ID > 0 {
+		return "m" + strconv.Itoa(movie.ID)
+	}
+	return ""
+}
+
+// DetailKey 是季度的详情页标识，规则与 Movie.DetailKey 一致。
+func (season SeriesSeason) DetailKey() string {
+	return Movie{ID: season.MediaID, DoubanID: season.DoubanID}.DetailKey()
+}
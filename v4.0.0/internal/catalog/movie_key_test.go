@@ -0,0 +1,44 @@
+package catalog
+
+import "testing"
+
+func TestParseMovieKeyKeepsLegacyDoubanIDsAndRecognizesMediaAndExternalIDs(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want MovieKey
+	}{
+		{"1292052", MovieKey{Kind: MovieKeyDouban, DoubanID: "1292052"}},
+		{"missing", MovieKey{Kind: MovieKeyDouban, DoubanID: "missing"}},
+		{"m42", MovieKey{Kind: MovieKeyMedia, MediaID: 42}},
+		{"m0", MovieKey{Kind: MovieKeyDouban, DoubanID: "m0"}},
+		{"tmdb-tv-1399", MovieKey{Kind: MovieKeyExternal, Provider: "tmdb", ExternalType: "tv", ExternalID: "1399"}},
+		{"tmdb-person-1", MovieKey{Kind: MovieKeyDouban, DoubanID: "tmdb-person-1"}},
+		{"imdb-tt0133093", MovieKey{Kind: MovieKeyExternal, Provider: "imdb", ExternalID: "tt0133093"}},
+	} {
+		if got := ParseMovieKey(tc.raw); got != tc.want {
+			t.Fatalf("ParseMovieKey(%q) = %+v, want %+v", tc.raw, got, tc.want)
+		}
+	}
+	for _, raw := range []string{"tmdb-movie-603", "imdb-tt0133093"} {
+		key := ParseMovieKey(raw)
+		if restored, ok := ParseImportSubject(key.ImportSubject()); !ok || restored != key {
+			t.Fatalf("import subject %q round trip = %+v/%v", key.ImportSubject(), restored, ok)
+		}
+	}
+	if (Movie{ID: 7}).DetailKey() != "m7" || (Movie{ID: 7, DoubanID: "1292052"}).DetailKey() != "1292052" {
+		t.Fatal("DetailKey must prefer the Douban ID and fall back to m<media.id>")
+	}
+}
+
+func TestDirectorPersonPathMapsBlobIDsToPersonEntries(t *testing.T) {
+	tests := map[Director]string{
+		{ID: "1047973", Name: "弗兰克·德拉邦特"}:        "/person/douban-1047973",
+		{ID: "tmdb-9813", Name: "David Benioff"}: "/person/tmdb-9813",
+		{Name: "没有 ID 的旧数据"}:                     "",
+	}
+	for person, expected := range tests {
+		if got := person.PersonPath(); got != expected {
+			t.Fatalf("%+v.PersonPath() = %q, want %q", person, got, expected)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 少数条目的海报是 GIF，注册解码器以免整张图被当成坏图。
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/blurhash"
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+// paletteSampleWidth 是计算占位信息前把原图缩到的宽度：BlurHash 和主色都只看大块颜色，
+// 几十像素足够，再大只是白白耗 CPU。
+const paletteSampleWidth = 64
+
+// ImagePaletteSyncer 计算一部作品海报和首张剧照的占位信息。
+type ImagePaletteSyncer interface {
+	SyncImagePalette(ctx context.Context, mediaID int) error
+}
+
+// ImagePaletteTarget 是计算占位信息需要的图片地址，以及上次计算时用的地址。
+type ImagePaletteTarget struct {
+	Poster   string
+	Backdrop string
+	Source   string
+}
+
+// source 把两张图的地址拼成 image_palette_source，地址没变就说明不必重算。
+func (target ImagePaletteTarget) source() string {
+	return target.Poster + "\n" + target.Backdrop
+}
+
+// ImagePaletteStore 读写 media 上的占位信息。
+type ImagePaletteStore interface {
+	FindImagePaletteTarget(ctx context.Context, mediaID int) (*ImagePaletteTarget, error)
+	SaveImagePalette(ctx context.Context, mediaID int, source string, palette ImagePalette) error
+}
+
+// ImagePaletteQueue 在主资料或剧照更新后派生占位信息任务。豆瓣任务只知道豆瓣 ID，所以另给一个入口。
+type ImagePaletteQueue interface {
+	EnqueueImagePalette(ctx context.Context, mediaID int, reason string, requestedBy int) (int, error)
+	EnqueueDoubanImagePalette(ctx context.Context, doubanID, reason string, requestedBy int) (int, error)
+}
+
+// ImagePaletteService 下载海报和首张剧照，算出 BlurHash 和主色/强调色写回 media。
+// 取图走和图片代理相同的地址校验与防盗链头，海报地址来自上游资料，同样不能信任。
+type ImagePaletteService struct {
+	client *http.Client
+	store  ImagePaletteStore
+}
+
+// NewImagePaletteService 创建占位信息计算服务，client 为 nil 时使用 15 秒超时的默认客户端。
+func NewImagePaletteService(client *http.Client, store ImagePaletteStore) *ImagePaletteService {
+	return &ImagePaletteService{client: newImageProxyHTTPClient(client), store: store}
+}
+
+// SyncImagePalette 计算并保存一部作品的占位信息。图片地址和上次一样时直接跳过；
+// 某张图取不到（上游 4xx）或解码不了时只把那张图的字段留空，照样记下来源地址，
+// 免得调度器每分钟都把它捞出来重试；网络错误则原样返回，交给任务队列重试。
+func (service *ImagePaletteService) SyncImagePalette(ctx context.Context, mediaID int) error {
+	target, err := service.store.FindImagePaletteTarget(ctx, mediaID)
+	if err != nil {
+		return fmt.Errorf("find image palette target: %w", err)
+	}
+	if target == nil {
+		return workqueue.Terminal(fmt.Errorf("media not found: %d", mediaID))
+	}
+	source := target.source()
+	if source == target.Source {
+		return nil
+	}
+	var palette ImagePalette
+	if palette.PosterBlurhash, palette.PosterColor, palette.PosterAccentColor, err = service.analyse(ctx, target.Poster, 3, 4); err != nil {
+		return err
+	}
+	if palette.BackdropBlurhash, palette.BackdropColor, palette.BackdropAccentColor, err = service.analyse(ctx, target.Backdrop, 4, 3); err != nil {
+		return err
+	}
+	return service.store.SaveImagePalette(ctx, mediaID, source, palette)
+}
+
+// analyse 取一张图并算出 BlurHash、主色和强调色。分量数按图片朝向给：竖版海报 3×4，横版剧照 4×3。
+func (service *ImagePaletteService) analyse(ctx context.Context, rawURL string, xComponents, yComponents int) (string, string, string, error) {
+	decoded, err := service.decode(ctx, rawURL)
+	if err != nil || decoded == nil {
+		return "", "", "", err
+	}
+	sample := resizeImage(decoded, paletteSampleWidth)
+	hash, err := blurhash.Encode(sample, xComponents, yComponents)
+	if err != nil {
+		return "", "", "", nil
+	}
+	dominant, accent := dominantColors(sample)
+	return hash, dominant, accent, nil
+}
+
+// decode 下载并解码图片。标准库解不了 WebP，豆瓣的 .webp 海报同一路径下都有 .jpg，换个后缀再取一次。
+// 返回 nil 图片且没有错误，表示这张图就是没法用，不值得重试。
+func (service *ImagePaletteService) decode(ctx context.Context, rawURL string) (image.Image, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return nil, nil
+	}
+	targetURL, err := validateImageProxyTarget(rawURL)
+	if err != nil {
+		return nil, nil
+	}
+	decoded, err := service.download(ctx, targetURL)
+	if decoded != nil || err != nil {
+		return decoded, err
+	}
+	if fallback, ok := doubanJPEGFallback(targetURL); ok {
+		return service.download(ctx, fallback)
+	}
+	return nil, nil
+}
+
+// download 取图并解码，上游明确拒绝、不是图片或解码失败都当作「没法用」而不是错误。
+func (service *ImagePaletteService) download(ctx context.Context, targetURL string) (image.Image, error) {
+	original, err := downloadProxyImage(ctx, service.client, targetURL)
+	var status imageUpstreamStatus
+	switch {
+	case errors.As(err, &status) && int(status) < http.StatusInternalServerError,
+		errors.Is(err, errProxyImageNotImage), errors.Is(err, errProxyImageTooLarge), errors.Is(err, errUnsafeImageProxyTarget):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("download palette image: %w", err)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(original.Body))
+	if err != nil || config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxProxyImagePixels {
+		return nil, nil
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(original.Body))
+	if err != nil {
+		return nil, nil
+	}
+	return decoded, nil
+}
+
+// doubanJPEGFallback 把豆瓣的 .webp 图片地址换成同名 .jpg。
+func doubanJPEGFallback(targetURL string) (string, bool) {
+	lower := strings.ToLower(targetURL)
+	if !strings.Contains(lower, ".doubanio.com/") || !strings.HasSuffix(lower, ".webp") {
+		return "", false
+	}
+	return targetURL[:len(targetURL)-len(".webp")] + ".jpg", true
+}
+
+// paletteBucket 是主色统计的一个颜色桶：每个通道取高 3 位，共 512 个桶。
+type paletteBucket struct {
+	count   int
+	r, g, b int
+}
+
+// dominantColors 返回图片的主色和强调色（#rrggbb）。主色是像素最多的颜色桶的平均色，
+// 用作占位背景；强调色在够鲜艳、又不太暗不太亮的桶里按「饱和度 × 像素数」挑，
+// 用作详情页的点缀色。整张图都是灰调时强调色退回主色。
+func dominantColors(img image.Image) (string, string) {
+	var buckets [512]paletteBucket
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r32, g32, b32, a32 := img.At(x, y).RGBA()
+			if a32 < 0x8000 {
+				continue
+			}
+			r, g, b := int(r32>>8), int(g32>>8), int(b32>>8)
+			bucket := &buckets[(r>>5)<<6|(g>>5)<<3|b>>5]
+			bucket.count++
+			bucket.r += r
+			bucket.g += g
+			bucket.b += b
+		}
+	}
+	dominant, accent := -1, -1
+	accentScore := 0.0
+	for index, bucket := range buckets {
+		if bucket.count == 0 {
+			continue
+		}
+		if dominant < 0 || bucket.count > buckets[dominant].count {
+			dominant = index
+		}
+		saturation, value := saturationValue(bucket.average())
+		if saturation < 0.3 || value < 0.25 || value > 0.95 {
+			continue
+		}
+		if score := saturation * float64(bucket.count); score > accentScore {
+			accent, accentScore = index, score
+		}
+	}
+	if dominant < 0 {
+		return "", ""
+	}
+	if accent < 0 {
+		accent = dominant
+	}
+	return hexColor(buckets[dominant].average()), hexColor(buckets[accent].average())
+}
+
+// average 返回桶内像素的平均色。
+func (bucket paletteBucket) average() [3]int {
+	return [3]int{bucket.r / bucket.count, bucket.g / bucket.count, bucket.b / bucket.count}
+}
+
+// saturationValue 返回 HSV 里的饱和度和明度，取值都在 0~1。
+func saturationValue(rgb [3]int) (float64, float64) {
+	high := math.Max(float64(rgb[0]), math.Max(float64(rgb[1]), float64(rgb[2])))
+	low := math.Min(float64(rgb[0]), math.Min(float64(rgb[1]), float64(rgb[2])))
+	if high == 0 {
+		return 0, 0
+	}
+	return (high - low) / high, high / 255
+}
+
+func hexColor(rgb [3]int) string {
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
+
+// FindImagePaletteTarget 取海报、首张剧照和上次计算用的地址，作品不存在时返回 (nil, nil)。
+func (store *PostgresStore) FindImagePaletteTarget(ctx context.Context, mediaID int) (*ImagePaletteTarget, error) {
+	rows, err := store.database.Query(ctx, `SELECT poster, split_part(backdrops, ',', 1), image_palette_source
+FROM media WHERE id = $1`, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("find image palette target: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var target ImagePaletteTarget
+	if err := rows.Scan(&target.Poster, &target.Backdrop, &target.Source); err != nil {
+		return nil, fmt.Errorf("scan image palette target: %w", err)
+	}
+	return &target, nil
+}
+
+// SaveImagePalette 写回占位信息。不动 updated_at：这只是图片的派生数据，不算资料更新，
+// 否则「最近更新」之类按 updated_at 排序的列表会被这个任务整个打乱。
+func (store *PostgresStore) SaveImagePalette(ctx context.Context, mediaID int, source string, palette ImagePalette) error {
+	if _, err := store.database.Exec(ctx, `UPDATE media SET
+    poster_blurhash = $2, poster_color = $3, poster_accent_color = $4,
+    backdrop_blurhash = $5, backdrop_color = $6, backdrop_accent_color = $7,
+    image_palette_source = $8
+WHERE id = $1`, mediaID, palette.PosterBlurhash, palette.PosterColor, palette.PosterAccentColor,
+		palette.BackdropBlurhash, palette.BackdropColor, palette.BackdropAccentColor, source); err != nil {
+		return fmt.Errorf("save image palette: %w", err)
+	}
+	return nil
+}
+
+// EnqueueImagePalette 按 media.id 排一个占位信息任务，图片地址没变时不入队。
+func (store *PostgresStore) EnqueueImagePalette(ctx context.Context, mediaID int, reason string, requestedBy int) (int, error) {
+	return store.EnqueueMediaJob(ctx, mediaID, RefreshProviderImagePalette, reason, requestedBy)
+}
+
+// EnqueueDoubanImagePalette 先把豆瓣 ID 换成 media.id 再入队；本地还没有这部作品时什么都不做。
+func (store *PostgresStore) EnqueueDoubanImagePalette(ctx context.Context, doubanID, reason string, requestedBy int) (int, error) {
+	rows, err := store.database.Query(ctx, `SELECT id FROM media WHERE douban_id = $1 LIMIT 1`, doubanID)
+	if err != nil {
+		return 0, fmt.Errorf("resolve image palette media: %w", err)
+	}
+	var mediaID int
+	if rows.Next() {
+		err = rows.Scan(&mediaID)
+	}
+	rows.Close()
+	if err != nil {
+		return 0, fmt.Errorf("resolve image palette media: %w", err)
+	}
+	if err := rows.Err(); err != nil || mediaID == 0 {
+		return 0, err
+	}
+	return store.EnqueueImagePalette(ctx, mediaID, reason, requestedBy)
+}
+
+// ScheduleImagePalettes 给图片地址和上次计算时不一致的作品补排占位信息任务，用于存量回填，
+// 以及兜住链式入队漏掉的情况。一天内失败过的不再捞，免得坏图每分钟都被重排一次。
+func (store *PostgresStore) ScheduleImagePalettes(ctx context.Context, limit int) error {
+	if limit <= 0 {
+		limit = 20
+	}
+	_, err := store.database.Exec(ctx, `INSERT INTO worker_jobs (task_type, subject_key, payload, reason, status, available_at)
+SELECT 'image_palette', m.id::text, JSONB_BUILD_OBJECT('media_id', m.id), 'scheduled', 'pending', NOW()
+FROM media m
+WHERE (m.poster <> '' OR m.backdrops <> '')
+  AND m.image_palette_source <> m.poster || E'\n' || split_part(m.backdrops, ',', 1)
+  AND NOT EXISTS (
+    SELECT 1 FROM worker_jobs job
+    WHERE job.task_type = 'image_palette' AND job.subject_key = m.id::text
+      AND (job.status IN ('pending', 'running')
+        OR (job.status = 'failed' AND job.finished_at > NOW() - INTERVAL '24 hours')))
+ORDER BY m.updated_at DESC, m.id
+LIMIT $1
+ON CONFLICT (task_type, subject_key) WHERE status IN ('pending', 'running') DO NOTHING`, limit)
+	if err != nil {
+		return fmt.Errorf("schedule image palettes: %w", err)
+	}
+	return nil
+}
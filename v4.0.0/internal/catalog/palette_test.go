@@ -0,0 +1,156 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+type paletteStoreStub struct {
+	target *ImagePaletteTarget
+	saved  []ImagePalette
+	source string
+}
+
+func (store *paletteStoreStub) FindImagePaletteTarget(context.Context, int) (*ImagePaletteTarget, error) {
+	return store.target, nil
+}
+
+func (store *paletteStoreStub) SaveImagePalette(_ context.Context, _ int, source string, palette ImagePalette) error {
+	store.saved = append(store.saved, palette)
+	store.source = source
+	return nil
+}
+
+type recordingPaletteSyncer struct{ ids []int }
+
+func (syncer *recordingPaletteSyncer) SyncImagePalette(_ context.Context, mediaID int) error {
+	syncer.ids = append(syncer.ids, mediaID)
+	return nil
+}
+
+func TestDominantColorsPicksLargestAreaAndSaturatedAccent(t *testing.T) {
+	// 四分之三是深灰背景，剩下一条是鲜红：主色取面积最大的灰，强调色取红。
+	poster := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			fill := color.RGBA{R: 0x30, G: 0x30, B: 0x30, A: 255}
+			if x >= 30 {
+				fill = color.RGBA{R: 0xe0, G: 0x20, B: 0x20, A: 255}
+			}
+			poster.Set(x, y, fill)
+		}
+	}
+	if dominant, accent := dominantColors(poster); dominant != "#303030" || accent != "#e02020" {
+		t.Fatalf("colors = %s/%s", dominant, accent)
+	}
+	// 全是灰调时强调色退回主色。
+	gray := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for index := range gray.Pix {
+		gray.Pix[index] = 0x80
+	}
+	if dominant, accent := dominantColors(gray); dominant != accent {
+		t.Fatalf("gray accent = %s, dominant %s", accent, dominant)
+	}
+}
+
+func TestImagePaletteServiceAnalysesPosterAndBackdrop(t *testing.T) {
+	var poster bytes.Buffer
+	source := image.NewRGBA(image.Rect(0, 0, 200, 300))
+	for index := 0; index < len(source.Pix); index += 4 {
+		copy(source.Pix[index:index+4], []byte{0x20, 0x40, 0xa0, 0xff})
+	}
+	if err := png.Encode(&poster, source); err != nil {
+		t.Fatal(err)
+	}
+	var requested []string
+	client := &http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		requested = append(requested, request.URL.String())
+		// 豆瓣的 webp 标准库解不了，应该换成同名 jpg 再取；剧照 404 只留空，不算失败。
+		switch {
+		case strings.HasSuffix(request.URL.Path, ".webp"):
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"image/webp"}},
+				Body: io.NopCloser(strings.NewReader("RIFF....WEBP")), Request: request}, nil
+		case strings.HasSuffix(request.URL.Path, ".jpg"):
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"image/png"}},
+				Body: io.NopCloser(bytes.NewReader(poster.Bytes())), Request: request}, nil
+		default:
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: request}, nil
+		}
+	})}
+	store := &paletteStoreStub{target: &ImagePaletteTarget{
+		Poster: "https://img1.doubanio.com/view/photo/p1.webp", Backdrop: "https://image.tmdb.org/t/p/original/missing.png",
+	}}
+	service := NewImagePaletteService(client, store)
+	if err := service.SyncImagePalette(t.Context(), 7); err != nil {
+		t.Fatal(err)
+	}
+	if len(requested) != 3 || !strings.HasSuffix(requested[1], "/p1.jpg") {
+		t.Fatalf("requested = %v", requested)
+	}
+	if len(store.saved) != 1 || store.source != store.target.Poster+"\n"+store.target.Backdrop {
+		t.Fatalf("saved = %+v source %q", store.saved, store.source)
+	}
+	saved := store.saved[0]
+	if len(saved.PosterBlurhash) != 28 || saved.PosterColor != "#2040a0" || saved.PosterAccentColor != "#2040a0" {
+		t.Fatalf("poster palette = %+v", saved)
+	}
+	if saved.BackdropBlurhash != "" || saved.BackdropColor != "" {
+		t.Fatalf("missing backdrop should stay empty: %+v", saved)
+	}
+	// 地址没变就不再下载。
+	store.target.Source = store.source
+	if err := service.SyncImagePalette(t.Context(), 7); err != nil || len(requested) != 3 || len(store.saved) != 1 {
+		t.Fatalf("unchanged images were analysed again: %v, %d requests", err, len(requested))
+	}
+	if err := NewImagePaletteService(client, &paletteStoreStub{}).SyncImagePalette(t.Context(), 8); !workqueue.IsTerminal(err) {
+		t.Fatalf("missing media = %v", err)
+	}
+}
+
+func TestRefreshHandlerChainsImagePaletteAfterImageChanges(t *testing.T) {
+	queue := &refreshQueueStub{}
+	palettes := &recordingPaletteSyncer{}
+	handler := NewRefreshHandler(queue, &recordingFetcher{}, nil, WithRefreshBackdrops(&recordingBackdropSyncer{}),
+		WithRefreshMediaMetadata(&recordingMediaSyncer{importedID: 9}), WithRefreshImagePalette(palettes))
+	for _, job := range []workqueue.Job{
+		{TaskType: RefreshProviderDouban, SubjectKey: "1292052"},
+		{TaskType: RefreshProviderTMDB, SubjectKey: "1292052"},
+		{TaskType: RefreshProviderTMDBMetadata, SubjectKey: "42"},
+		{TaskType: RefreshProviderTMDBImport, SubjectKey: "tmdb/tv/1399"},
+		{TaskType: RefreshProviderImagePalette, SubjectKey: "42"},
+	} {
+		if err := handler.Handle(t.Context(), job); err != nil {
+			t.Fatalf("%s: %v", job.TaskType, err)
+		}
+	}
+	want := []string{"douban:1292052", "douban:1292052", "42", "9"}
+	if len(queue.jobs) != len(want) {
+		t.Fatalf("chained jobs = %+v", queue.jobs)
+	}
+	for index, job := range queue.jobs {
+		if job.TaskType != RefreshProviderImagePalette || job.SubjectKey != want[index] {
+			t.Fatalf("chained job %d = %+v", index, job)
+		}
+	}
+	if len(palettes.ids) != 1 || palettes.ids[0] != 42 {
+		t.Fatalf("palette calls = %v", palettes.ids)
+	}
+	// 没装配计算服务时不派生任务，直接收到的任务判死。
+	queue = &refreshQueueStub{}
+	handler = NewRefreshHandler(queue, &recordingFetcher{}, nil)
+	if err := handler.Handle(t.Context(), workqueue.Job{TaskType: RefreshProviderDouban, SubjectKey: "1292052"}); err != nil || len(queue.jobs) != 0 {
+		t.Fatalf("unconfigured palette chain = %v/%+v", err, queue.jobs)
+	}
+	if err := handler.Handle(t.Context(), workqueue.Job{TaskType: RefreshProviderImagePalette, SubjectKey: "42"}); !workqueue.IsTerminal(err) {
+		t.Fatalf("unconfigured palette task = %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/requestmeta"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/TwoThreeWang/Moovie/new/internal/search"
+	"github.com/gin-gonic/gin"
+)
+
+// FilmographyEntry 是人物页作品表的一行：作品资料加站内可播状态。
+type FilmographyEntry struct {
+	mediaidentity.PersonCredit
+	Playback search.PlaybackSummary
+}
+
+// DetailKey 是作品详情页标识，规则与 Movie.DetailKey 一致。
+func (entry FilmographyEntry) DetailKey() string {
+	return Movie{ID: entry.MediaID, DoubanID: entry.DoubanID}.DetailKey()
+}
+
+// Directed 表示此人是这部作品的导演，供模板打角色标签。
+func (entry FilmographyEntry) Directed() bool {
+	return slices.Contains(entry.Roles, mediaidentity.CreditDirector)
+}
+
+// Acted 表示此人在这部作品里出演。
+func (entry FilmographyEntry) Acted() bool {
+	return slices.Contains(entry.Roles, mediaidentity.CreditActor)
+}
+
+// person 渲染人物页：基本资料和按年份倒序的作品表，每部作品标出站内能不能播。
+// :id 是 people.id；douban-<id> / tmdb-<id> 是详情页演职员链接用的入口，解析后 301 到规范地址。
+func (handler *Handler) person(c *gin.Context) {
+	ctx := c.Request.Context()
+	raw := strings.TrimSpace(c.Param("id"))
+	person, err := mediaidentity.Person{}, mediaidentity.ErrPersonNotFound
+	if handler.people != nil {
+		if provider, externalID, ok := strings.Cut(raw, "-"); ok {
+			person, err = handler.people.FindPersonByExternalID(ctx, provider, externalID)
+			if err == nil {
+				c.Redirect(http.StatusMovedPermanently, "/person/"+strconv.Itoa(person.ID))
+				return
+			}
+		} else if id, convErr := strconv.Atoi(raw); convErr == nil && id > 0 {
+			person, err = handler.people.FindPerson(ctx, id)
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, mediaidentity.ErrPersonNotFound) {
+			requestmeta.Logger(ctx).Warn("load person failed", "person", raw, "error", err)
+		}
+		c.HTML(http.StatusNotFound, "404.html", platformweb.NewData(c, handler.config, platformweb.Metadata{Title: "人物未找到 - " + handler.config.SiteName}, nil))
+		return
+	}
+
+	credits, err := handler.people.ListPersonCredits(ctx, person.ID)
+	if err != nil {
+		requestmeta.Logger(ctx).Warn("list person credits failed", "person_id", person.ID, "error", err)
+	}
+	entries := make([]FilmographyEntry, 0, len(credits))
+	mediaIDs := make([]int, 0, len(credits))
+	for _, credit := range credits {
+		entries = append(entries, FilmographyEntry{PersonCredit: credit,
+			Playback: search.PlaybackSummary{MediaID: credit.MediaID, State: search.PlaybackNone}})
+		mediaIDs = append(mediaIDs, credit.MediaID)
+	}
+	if reader, ok := handler.resources.(search.PlaybackSummaryReader); ok && len(mediaIDs) > 0 {
+		if summaries, summaryErr := reader.ListPlaybackSummaries(ctx, mediaIDs); summaryErr == nil {
+			for i := range entries {
+				if summary, found := summaries[entries[i].MediaID]; found {
+					entries[i].Playback = summary
+				}
+			}
+		}
+	}
+
+	description := fmt.Sprintf("%s的全部影视作品，共 %d 部，按年份排列并标注本站可播放的资源。", person.Name, len(entries))
+	c.HTML(http.StatusOK, "person.html", platformweb.NewData(c, handler.config, platformweb.Metadata{
+		Title:       person.Name + " - 影视作品全集 - " + handler.config.SiteName,
+		Description: description, Keywords: strings.Join([]string{person.Name, person.OriginalName, "作品", "电影", "电视剧"}, ","),
+		Cover: proxyImageURL(person.Avatar), Canonical: fmt.Sprintf("%s/person/%d", handler.config.SiteURL, person.ID),
+	}, gin.H{"Person": person, "Filmography": entries}))
+}
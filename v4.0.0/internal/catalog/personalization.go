@@ -3,63 +3,324 @@ package catalog
 import (
 	"context"
 	"fmt"
+	"math"
 )
 
-// UserRecommendations 是「猜你喜欢」：把用户看过(1.0)、想看(2.0)、看了一半(0.8) 的影片向量
-// 按权重平均成一个「口味向量」，再用 pgvector 找最接近的、且用户还没接触过的影片。
-func (store *PostgresStore) UserRecommendations(ctx context.Context, userID, limit int) ([]Movie, error) {
-	rows, err := store.database.Query(ctx, `WITH user_interests AS (
-SELECT m.id, m.embedding, 1.0 AS weight FROM media m JOIN user_movies um ON um.media_id=m.id WHERE um.user_id=$1 AND um.status='watched' AND m.embedding IS NOT NULL
-UNION ALL SELECT m.id, m.embedding, 2.0 AS weight FROM media m JOIN user_movies um ON um.media_id=m.id WHERE um.user_id=$1 AND um.status='wish' AND m.embedding IS NOT NULL
-UNION ALL SELECT m.id, m.embedding, 0.8 AS weight FROM media m JOIN playback_positions position ON position.media_id=m.id
+// 口味信号的权重。看过的片按用户打分（1~5 星，0 为未评分）调节，打了低分的是负信号；
+// 「不感兴趣」是明确的负信号，不随时间衰减。
+const (
+	tasteWishWeight          = 2.0
+	tastePlaybackWeight      = 0.8
+	tasteNotInterestedWeight = -1.5
+	// tasteHalfLifeDays 是互动的半衰期：半年前看过的片只算一半，口味会随时间变化。
+	tasteHalfLifeDays = 180.0
+	// tasteNegativeWeight 是负信号中心的折扣：口味向量 = 正信号中心 - 0.5 × 负信号中心。
+	tasteNegativeWeight = 0.5
+	// maxTasteSignals 只取最近的这么多条互动，老用户的历史再长也不会把一次查询拖慢。
+	maxTasteSignals = 300
+)
+
+// 口味信号的来源，和 user_movies.status、recommendation_feedback.signal 的取值一致。
+const (
+	tasteSignalWish          = "wish"
+	tasteSignalWatched       = "watched"
+	tasteSignalPlayback      = "playback"
+	tasteSignalNotInterested = "not_interested"
+)
+
+// TasteSignal 是用户和一部作品的一次互动，AgeDays 是距今天数。
+// Year、Genres、Directors、Actors 只用来给兴趣分组起名字和生成推荐理由，不参与向量计算。
+type TasteSignal struct {
+	MediaID   int
+	Title     string
+	Year      string
+	Genres    string
+	Directors string
+	Actors    string
+	Kind      string
+	Rating    int
+	AgeDays   float64
+	Embedding []float32
+}
+
+// Weight 返回带时间衰减的权重，负数表示用户不喜欢。
+func (signal TasteSignal) Weight() float64 {
+	var base float64
+	switch signal.Kind {
+	case tasteSignalWish:
+		base = tasteWishWeight
+	case tasteSignalWatched:
+		base = watchedTasteWeight(signal.Rating)
+	case tasteSignalPlayback:
+		base = tastePlaybackWeight
+	case tasteSignalNotInterested:
+		return tasteNotInterestedWeight
+	default:
+		return 0
+	}
+	return base * math.Pow(0.5, max(signal.AgeDays, 0)/tasteHalfLifeDays)
+}
+
+// watchedTasteWeight 按用户打分给「看过」定权重：五星 2.0、四星 1.5、三星 0.5，
+// 两星以下为负。没打分的按普通看过算 1.0。
+func watchedTasteWeight(rating int) float64 {
+	switch rating {
+	case 5:
+		return 2.0
+	case 4:
+		return 1.5
+	case 3:
+		return 0.5
+	case 2:
+		return -0.5
+	case 1:
+		return -1.0
+	default:
+		return 1.0
+	}
+}
+
+// TasteVector 按 Rocchio 的思路合成口味向量：正信号的加权中心减去打了折的负信号中心。
+// 没有任何正信号时返回 nil——只知道用户不喜欢什么，推不出他喜欢什么。
+// 推荐快照按兴趣分组时，对每组正信号加上全部负信号各算一次。
+func TasteVector(signals []TasteSignal) []float32 {
+	var liked, disliked tasteCentroid
+	for _, signal := range signals {
+		switch weight := signal.Weight(); {
+		case weight > 0:
+			liked.add(signal.Embedding, weight)
+		case weight < 0:
+			disliked.add(signal.Embedding, -weight)
+		}
+	}
+	if liked.weight == 0 {
+		return nil
+	}
+	vector := make([]float32, len(liked.sum))
+	for index, value := range liked.sum {
+		value /= liked.weight
+		if disliked.weight > 0 && len(disliked.sum) == len(liked.sum) {
+			value -= tasteNegativeWeight * disliked.sum[index] / disliked.weight
+		}
+		vector[index] = float32(value)
+	}
+	return vector
+}
+
+// tasteCentroid 累加一组向量的加权和。维度和第一条不一致的向量直接跳过，
+// 换模型重建的窗口里不会出现这种情况，但也不能让它把结果算坏。
+type tasteCentroid struct {
+	sum    []float64
+	weight float64
+}
+
+func (centroid *tasteCentroid) add(embedding []float32, weight float64) {
+	if len(embedding) == 0 {
+		return
+	}
+	if centroid.sum == nil {
+		centroid.sum = make([]float64, len(embedding))
+	}
+	if len(embedding) != len(centroid.sum) {
+		return
+	}
+	for index, value := range embedding {
+		centroid.sum[index] += weight * float64(value)
+	}
+	centroid.weight += weight
+}
+
+// tasteExclusions 是不该再推荐给用户的作品：片单里的、看过一部分的、点过不感兴趣的。
+const tasteExclusions = `SELECT media_id FROM user_movies WHERE user_id=$1 AND media_id IS NOT NULL
+UNION SELECT media_id FROM playback_positions WHERE user_id=$1 AND media_id IS NOT NULL AND deleted_at IS NULL
+UNION SELECT media_id FROM recommendation_feedback WHERE user_id=$1`
+
+// TasteSignals 读出用户最近的互动和对应向量，按时间从近到远排列。
+// 看了一半的片按作品去重，已经进了片单的以片单为准。
+func (store *PostgresStore) TasteSignals(ctx context.Context, userID int) ([]TasteSignal, error) {
+	rows, err := store.database.Query(ctx, `SELECT media_id, title, year, genres, directors, actors, kind, rating, age_days, embedding FROM (
+SELECT m.id AS media_id, m.title, m.year, m.genres, m.directors, m.actors, um.status AS kind, um.rating,
+       EXTRACT(EPOCH FROM NOW()-um.updated_at)::double precision/86400 AS age_days, m.embedding::text AS embedding
+FROM user_movies um JOIN media m ON m.id=um.media_id WHERE um.user_id=$1 AND m.embedding IS NOT NULL
+UNION ALL SELECT media_id, title, year, genres, directors, actors, 'playback', 0, age_days, embedding FROM (
+SELECT DISTINCT ON (m.id) m.id AS media_id, m.title, m.year, m.genres, m.directors, m.actors,
+       EXTRACT(EPOCH FROM NOW()-position.activity_at)::double precision/86400 AS age_days, m.embedding::text AS embedding
+FROM playback_positions position JOIN media m ON m.id=position.media_id
 WHERE position.user_id=$1 AND position.deleted_at IS NULL AND m.embedding IS NOT NULL AND position.progress_percent>5
 AND NOT EXISTS (SELECT 1 FROM user_movies um WHERE um.user_id=$1 AND um.media_id=m.id)
-), user_vector AS (SELECT AVG(embedding) AS avg_embedding FROM user_interests WHERE embedding IS NOT NULL), excluded_ids AS (
-SELECT media_id FROM user_movies WHERE user_id=$1 AND media_id IS NOT NULL
-UNION SELECT media_id FROM playback_positions WHERE user_id=$1 AND media_id IS NOT NULL AND deleted_at IS NULL)
-SELECT `+movieColumns+`
-FROM media m, user_vector uv WHERE m.embedding IS NOT NULL AND m.id NOT IN (SELECT media_id FROM excluded_ids)
-AND uv.avg_embedding IS NOT NULL ORDER BY m.embedding <-> uv.avg_embedding LIMIT $2`, userID, limit)
+ORDER BY m.id, position.activity_at DESC) latest_playback
+UNION ALL SELECT m.id, m.title, m.year, m.genres, m.directors, m.actors, feedback.signal, 0,
+       EXTRACT(EPOCH FROM NOW()-feedback.created_at)::double precision/86400, m.embedding::text
+FROM recommendation_feedback feedback JOIN media m ON m.id=feedback.media_id WHERE feedback.user_id=$1 AND m.embedding IS NOT NULL
+) signals ORDER BY age_days, media_id LIMIT $2`, userID, maxTasteSignals)
+	if err != nil {
+		return nil, fmt.Errorf("taste signals: %w", err)
+	}
+	defer rows.Close()
+	signals := make([]TasteSignal, 0)
+	for rows.Next() {
+		var signal TasteSignal
+		var embeddingText string
+		if err := rows.Scan(&signal.MediaID, &signal.Title, &signal.Year, &signal.Genres, &signal.Directors, &signal.Actors, &signal.Kind, &signal.Rating, &signal.AgeDays, &embeddingText); err != nil {
+			return nil, fmt.Errorf("scan taste signal: %w", err)
+		}
+		if signal.Embedding, err = parseEmbedding(embeddingText); err != nil {
+			return nil, fmt.Errorf("parse taste signal embedding: %w", err)
+		}
+		signals = append(signals, signal)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate taste signals: %w", err)
+	}
+	return signals, nil
+}
+
+// UserRecommendations 是「猜你喜欢」：把想看、看过（按打分）、看了一半和「不感兴趣」
+// 合成一个带时间衰减的口味向量（见 TasteVector），再用 pgvector 找最接近的、且用户还没接触过的影片。
+func (store *PostgresStore) UserRecommendations(ctx context.Context, userID, limit int) ([]Movie, error) {
+	signals, err := store.TasteSignals(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("user recommendations: %w", err)
 	}
-	return scanMovies(rows, "user recommendations")
+	taste := TasteVector(signals)
+	if taste == nil {
+		return []Movie{}, nil
+	}
+	return store.RecommendNear(ctx, userID, taste, limit)
+}
+
+// RecommendNear 找离口味向量最近、且用户还没接触过的影片。排除规则和「猜你喜欢」相同，
+// 已并入别的作品的重复条目不参与。
+func (store *PostgresStore) RecommendNear(ctx context.Context, userID int, taste []float32, limit int) ([]Movie, error) {
+	vector, err := vectorLiteral(taste)
+	if err != nil {
+		return nil, fmt.Errorf("recommend near taste: %w", err)
+	}
+	rows, err := store.database.Query(ctx, `WITH excluded_ids AS (`+tasteExclusions+`)
+SELECT `+movieColumns+`
+FROM media m WHERE m.embedding IS NOT NULL AND m.merged_into_id IS NULL AND m.id NOT IN (SELECT media_id FROM excluded_ids)
+ORDER BY m.embedding <-> $2::vector LIMIT $3`, userID, vector, limit)
+	if err != nil {
+		return nil, fmt.Errorf("recommend near taste: %w", err)
+	}
+	return scanMovies(rows, "recommend near taste")
+}
+
+// groupExclusions 是多人推荐不该推的作品：任何一个人看过、看过一部分或点过不感兴趣的。
+// 想看不排除，它们正是大家可能一起看的片。$1 是所有人的用户 ID。
+const groupExclusions = `SELECT media_id FROM user_movies WHERE user_id = ANY($1::bigint[]) AND media_id IS NOT NULL AND status = 'watched'
+UNION SELECT media_id FROM playback_positions WHERE user_id = ANY($1::bigint[]) AND media_id IS NOT NULL AND deleted_at IS NULL
+UNION SELECT media_id FROM recommendation_feedback WHERE user_id = ANY($1::bigint[])`
+
+// RecommendNearGroup 是多人版的 RecommendNear：找离合成口味向量最近、且没被任何一个人排除的影片。
+func (store *PostgresStore) RecommendNearGroup(ctx context.Context, userIDs []int, taste []float32, limit int) ([]Movie, error) {
+	vector, err := vectorLiteral(taste)
+	if err != nil {
+		return nil, fmt.Errorf("recommend near group taste: %w", err)
+	}
+	rows, err := store.database.Query(ctx, `WITH excluded_ids AS (`+groupExclusions+`)
+SELECT `+movieColumns+`
+FROM media m WHERE m.embedding IS NOT NULL AND m.merged_into_id IS NULL AND m.id NOT IN (SELECT media_id FROM excluded_ids)
+ORDER BY m.embedding <-> $2::vector LIMIT $3`, userIDs, vector, limit)
+	if err != nil {
+		return nil, fmt.Errorf("recommend near group taste: %w", err)
+	}
+	return scanMovies(rows, "recommend near group taste")
+}
+
+// GroupExcluded 返回 mediaIDs 里被这组人排除的作品，规则同 RecommendNearGroup，供共同想看的片过滤。
+func (store *PostgresStore) GroupExcluded(ctx context.Context, userIDs, mediaIDs []int) (map[int]bool, error) {
+	excluded := make(map[int]bool)
+	if len(mediaIDs) == 0 {
+		return excluded, nil
+	}
+	rows, err := store.database.Query(ctx, `SELECT media_id FROM (`+groupExclusions+`) excluded_ids
+WHERE media_id = ANY($2::bigint[])`, userIDs, mediaIDs)
+	if err != nil {
+		return nil, fmt.Errorf("list group exclusions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mediaID int
+		if err := rows.Scan(&mediaID); err != nil {
+			return nil, fmt.Errorf("scan group exclusion: %w", err)
+		}
+		excluded[mediaID] = true
+	}
+	return excluded, rows.Err()
 }
 
-// ReliveClassics 是「重温经典」：从用户 30 天前标记看过、评分不低的片里随机挑几部。
+// MarkNotInterested 记下用户对一部作品「不感兴趣」。它会从推荐里消失，
+// 并作为负信号把口味向量推离同类作品。
+func (store *PostgresStore) MarkNotInterested(ctx context.Context, userID, mediaID int) error {
+	if _, err := store.database.Exec(ctx, `INSERT INTO recommendation_feedback (user_id, media_id, signal)
+VALUES ($1, $2, 'not_interested')
+ON CONFLICT (user_id, media_id) DO UPDATE SET signal = EXCLUDED.signal, created_at = NOW()`, userID, mediaID); err != nil {
+		return fmt.Errorf("mark not interested: %w", err)
+	}
+	return nil
+}
+
+// NotInterestedMedia 返回用户点过「不感兴趣」的作品，供热门兜底等不走口味向量的板块过滤。
+func (store *PostgresStore) NotInterestedMedia(ctx context.Context, userID int) (map[int]bool, error) {
+	rows, err := store.database.Query(ctx, `SELECT media_id FROM recommendation_feedback WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list not interested media: %w", err)
+	}
+	defer rows.Close()
+	excluded := make(map[int]bool)
+	for rows.Next() {
+		var mediaID int
+		if err := rows.Scan(&mediaID); err != nil {
+			return nil, fmt.Errorf("scan not interested media: %w", err)
+		}
+		excluded[mediaID] = true
+	}
+	return excluded, rows.Err()
+}
+
+// ReliveClassics 是「重温经典」：从用户 30 天前标记看过、豆瓣评分不低的片里随机挑几部。
+// 用户自己打了三星以下的不算，那是他不想再看的片。
 func (store *PostgresStore) ReliveClassics(ctx context.Context, userID, limit int) ([]Movie, error) {
 	rows, err := store.database.Query(ctx, `SELECT `+movieColumns+`
 FROM media m JOIN user_movies um ON um.media_id=m.id WHERE um.user_id=$1 AND um.status='watched'
-AND m.rating_douban>=5 AND um.updated_at < NOW()-INTERVAL '30 day' ORDER BY RANDOM() LIMIT $2`, userID, limit)
+AND (um.rating=0 OR um.rating>=4) AND m.rating_douban>=5 AND um.updated_at < NOW()-INTERVAL '30 day'
+AND NOT EXISTS (SELECT 1 FROM recommendation_feedback feedback WHERE feedback.user_id=$1 AND feedback.media_id=m.id)
+ORDER BY RANDOM() LIMIT $2`, userID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("relive classics: %w", err)
 	}
 	return scanMovies(rows, "relive classics")
 }
 
-// RecentSimilar 是「因为你看了 X」：取最近一次观看/标记的影片，再找与它相似的。
-// 第二个返回值就是那部影片的片名，用于文案。
+// RecentSimilar 是「因为你看了 X」：取最近一次看过或看了一半、且不是打了低分的影片，再找与它相似的。
+// 结果和「猜你喜欢」一样排除片单、看过和不感兴趣的作品。第二个返回值就是那部影片的片名，用于文案。
 func (store *PostgresStore) RecentSimilar(ctx context.Context, userID, limit int) ([]Movie, string, error) {
-	rows, err := store.database.Query(ctx, `SELECT douban_id, title FROM (
-SELECT m.douban_id,m.title,um.updated_at AS action_time FROM media m JOIN user_movies um ON um.media_id=m.id
-WHERE um.user_id=$1 AND um.status='watched' AND m.embedding IS NOT NULL
-UNION ALL SELECT m.douban_id,m.title,position.activity_at AS action_time FROM media m
-JOIN playback_positions position ON position.media_id=m.id
-WHERE position.user_id=$1 AND position.deleted_at IS NULL AND m.embedding IS NOT NULL AND position.progress_percent>5
-) recent ORDER BY action_time DESC LIMIT 1`, userID)
+	signals, err := store.TasteSignals(ctx, userID)
 	if err != nil {
 		return nil, "", fmt.Errorf("recent movie: %w", err)
 	}
-	defer rows.Close()
-	if !rows.Next() {
-		return []Movie{}, "", rows.Err()
+	var anchor *TasteSignal
+	for index := range signals {
+		signal := &signals[index]
+		if (signal.Kind == tasteSignalWatched || signal.Kind == tasteSignalPlayback) && signal.Weight() > 0 {
+			anchor = signal
+			break
+		}
+	}
+	if anchor == nil {
+		return []Movie{}, "", nil
 	}
-	var doubanID, title string
-	if err := rows.Scan(&doubanID, &title); err != nil {
-		return nil, "", fmt.Errorf("scan recent movie: %w", err)
+	rows, err := store.database.Query(ctx, `WITH excluded_ids AS (`+tasteExclusions+`)
+SELECT `+movieColumns+`
+FROM media m, (SELECT embedding FROM media WHERE id=$2) anchor
+WHERE m.embedding IS NOT NULL AND m.merged_into_id IS NULL AND m.id != $2 AND m.id NOT IN (SELECT media_id FROM excluded_ids)
+ORDER BY m.embedding <-> anchor.embedding LIMIT $3`, userID, anchor.MediaID, limit)
+	if err != nil {
+		return nil, "", fmt.Errorf("recent similar: %w", err)
 	}
-	movies, err := store.FindSimilar(ctx, doubanID, limit)
-	return movies, title, err
+	movies, err := scanMovies(rows, "recent similar")
+	return movies, anchor.Title, err
 }
 
 // scanMovies 把查询结果批量扫描成 Movie 切片，label 只用于错误信息。
@@ -0,0 +1,44 @@
+package catalog
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTasteWeightsFollowRatingsAndDecay(t *testing.T) {
+	for _, testCase := range []struct {
+		signal TasteSignal
+		want   float64
+	}{
+		{TasteSignal{Kind: tasteSignalWatched}, 1.0},
+		{TasteSignal{Kind: tasteSignalWatched, Rating: 5}, 2.0},
+		{TasteSignal{Kind: tasteSignalWatched, Rating: 1}, -1.0},
+		{TasteSignal{Kind: tasteSignalWish, AgeDays: tasteHalfLifeDays}, 1.0},
+		{TasteSignal{Kind: tasteSignalPlayback, AgeDays: 2 * tasteHalfLifeDays}, 0.2},
+		// 不感兴趣是明确表态，放多久都不打折。
+		{TasteSignal{Kind: tasteSignalNotInterested, AgeDays: 1000}, tasteNotInterestedWeight},
+	} {
+		if got := testCase.signal.Weight(); math.Abs(got-testCase.want) > 1e-9 {
+			t.Fatalf("weight(%+v) = %v, want %v", testCase.signal, got, testCase.want)
+		}
+	}
+}
+
+func TestTasteVectorNeedsPositiveSignal(t *testing.T) {
+	disliked := []TasteSignal{
+		{Kind: tasteSignalWatched, Rating: 2, Embedding: []float32{1, 0}},
+		{Kind: tasteSignalNotInterested, Embedding: []float32{0, 1}},
+	}
+	if vector := TasteVector(disliked); vector != nil {
+		t.Fatalf("taste from dislikes only = %v", vector)
+	}
+	// 新近的五星压过半年前的三星，负信号再把结果从不感兴趣的方向推开。
+	signals := append([]TasteSignal{
+		{Kind: tasteSignalWatched, Rating: 5, Embedding: []float32{1, 0}},
+		{Kind: tasteSignalWatched, Rating: 3, AgeDays: tasteHalfLifeDays, Embedding: []float32{0, 1}},
+	}, disliked...)
+	vector := TasteVector(signals)
+	if len(vector) != 2 || vector[0] <= 0.7 || vector[1] >= 0 {
+		t.Fatalf("taste vector = %v", vector)
+	}
+}
@@ -30,25 +30,27 @@ func (store *PostgresStore) Count(ctx context.Context) (int, error) {
 	return count, nil
 }
 
-// UpdateEmbedding 写入向量及其来源文本和语义哈希。
-func (store *PostgresStore) UpdateEmbedding(ctx context.Context, doubanID, content, semanticHash string, embedding []float32) error {
+// UpdateEmbedding 按 media.id 写入向量及其来源文本和语义哈希。
+// 没有豆瓣条目的作品也要能生成向量，所以这里不再按 douban_id 定位。
+func (store *PostgresStore) UpdateEmbedding(ctx context.Context, mediaID int, content, semanticHash string, embedding []float32) error {
 	vector, err := vectorLiteral(embedding)
 	if err != nil {
 		return err
 	}
 	_, err = store.database.Exec(ctx, `UPDATE media SET embedding_content = $2,
 semantic_hash = $3, embedding = $4::vector,
-updated_at = NOW() WHERE douban_id = $1`, doubanID, content, semanticHash, vector)
+updated_at = NOW() WHERE id = $1`, mediaID, content, semanticHash, vector)
 	if err != nil {
 		return fmt.Errorf("update media embedding: %w", err)
 	}
 	return nil
 }
 
-// vectorLiteral 把 float32 切片转成 pgvector 的文本字面量，并校验维度和数值合法性。
+// vectorLiteral 把 float32 切片转成 pgvector 的文本字面量，并校验数值合法性。
+// 维度随向量代际变化，由 vector(N) 列自己把关，这里只拒绝空向量。
 func vectorLiteral(embedding []float32) (string, error) {
-	if len(embedding) != 768 {
-		return "", fmt.Errorf("embedding dimension mismatch: want 768, got %d", len(embedding))
+	if len(embedding) == 0 {
+		return "", fmt.Errorf("embedding is empty")
 	}
 	values := make([]string, len(embedding))
 	for index, value := range embedding {
@@ -66,8 +68,9 @@ const movieColumns = `m.id, m.douban_id, m.title, m.original_title, m.year, m.po
 m.genres, m.countries, m.directors, m.actors, m.summary, m.duration,
 COALESCE((SELECT external_id FROM media_external_ids x WHERE x.media_id = m.id AND x.provider = 'imdb'
 ORDER BY x.is_primary DESC, x.updated_at DESC LIMIT 1), ''),
-m.media_type, m.series_status, m.backdrops, m.embedding_content, m.semantic_hash, m.reviews_json,
+m.media_type, m.series_status, m.backdrops, m.embedding_content, m.semantic_hash, m.embedding_model, m.reviews_json,
 m.reviews_updated_at, m.metadata_status, m.completeness_score, m.next_refresh_at, m.updated_at,
+m.poster_blurhash, m.poster_color, m.poster_accent_color, m.backdrop_blurhash, m.backdrop_color, m.backdrop_accent_color,
 COALESCE(m.embedding::text, '')`
 
 // FindByDoubanID 按豆瓣 ID 取一部影片，不存在时返回 (nil, nil)。
@@ -104,13 +107,42 @@ func (store *PostgresStore) FindByID(ctx context.Context, id int) (*Movie, error
 	return &movie, nil
 }
 
+// FindMergeTarget 返回作品被合并进的那部作品，没有合并过时返回 (nil, nil)。
+func (store *PostgresStore) FindMergeTarget(ctx context.Context, mediaID int) (*Movie, error) {
+	rows, err := store.database.Query(ctx, `SELECT `+movieColumns+` FROM media m
+WHERE m.id = (SELECT merged_into_id FROM media WHERE id = $1) LIMIT 1`, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("find merge target: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	movie, err := scanMovie(rows)
+	if err != nil {
+		return nil, fmt.Errorf("scan movie: %w", err)
+	}
+	return &movie, nil
+}
+
 // FindSimilar 用向量距离找相似影片（详情页的「相关推荐」）。
 func (store *PostgresStore) FindSimilar(ctx context.Context, doubanID string, limit int) ([]Movie, error) {
+	return store.findSimilar(ctx, `douban_id = $1`, doubanID, limit)
+}
+
+// FindSimilarByID 与 FindSimilar 相同，但按 media.id 定位源影片，供没有豆瓣 ID 的作品使用。
+func (store *PostgresStore) FindSimilarByID(ctx context.Context, mediaID int, limit int) ([]Movie, error) {
+	return store.findSimilar(ctx, `id = $1`, mediaID, limit)
+}
+
+// findSimilar 是两种定位方式共用的向量查询，predicate 只能是上面两个固定写法。
+// 已并入别的作品的重复条目保留着向量，但不能再出现在候选里。
+func (store *PostgresStore) findSimilar(ctx context.Context, predicate string, subject any, limit int) ([]Movie, error) {
 	rows, err := store.database.Query(ctx, `SELECT `+movieColumns+`
 FROM media m
-JOIN LATERAL (SELECT embedding FROM media WHERE douban_id = $1 AND embedding IS NOT NULL) target ON true
-WHERE m.douban_id != $1 AND m.embedding IS NOT NULL
-ORDER BY m.embedding <-> target.embedding LIMIT $2`, doubanID, limit)
+JOIN LATERAL (SELECT id, embedding FROM media WHERE `+predicate+` AND embedding IS NOT NULL) target ON true
+WHERE m.id != target.id AND m.embedding IS NOT NULL AND m.merged_into_id IS NULL
+ORDER BY m.embedding <-> target.embedding LIMIT $2`, subject, limit)
 	if err != nil {
 		return nil, fmt.Errorf("find similar movies: %w", err)
 	}
@@ -129,6 +161,49 @@ ORDER BY m.embedding <-> target.embedding LIMIT $2`, doubanID, limit)
 	return movies, nil
 }
 
+// FindByExternalID 按外部 ID 取影片，不存在时返回 (nil, nil)。
+// externalType 为空时不限命名空间：IMDb ID 在详情页入口处分不清是电影还是剧集。
+func (store *PostgresStore) FindByExternalID(ctx context.Context, provider, externalType, externalID string) (*Movie, error) {
+	rows, err := store.database.Query(ctx, `SELECT `+movieColumns+` FROM media m
+JOIN media_external_ids x ON x.media_id = m.id
+WHERE x.provider = $1 AND ($2 = '' OR x.external_type = $2) AND x.external_id = $3
+ORDER BY x.is_primary DESC, m.id LIMIT 1`, provider, externalType, externalID)
+	if err != nil {
+		return nil, fmt.Errorf("find movie by external ID: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	movie, err := scanMovie(rows)
+	if err != nil {
+		return nil, fmt.Errorf("scan movie: %w", err)
+	}
+	return &movie, nil
+}
+
+// FindTMDBRef 返回作品的主 TMDB 映射；external_type 可能是 movie、tv 或 tv_season_N。
+func (store *PostgresStore) FindTMDBRef(ctx context.Context, mediaID int) (int, string, error) {
+	rows, err := store.database.Query(ctx, `SELECT external_id, external_type FROM media_external_ids
+WHERE media_id = $1 AND provider = 'tmdb' ORDER BY is_primary DESC, updated_at DESC LIMIT 1`, mediaID)
+	if err != nil {
+		return 0, "", fmt.Errorf("find TMDB mapping: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, "", rows.Err()
+	}
+	var externalID, externalType string
+	if err := rows.Scan(&externalID, &externalType); err != nil {
+		return 0, "", fmt.Errorf("scan TMDB mapping: %w", err)
+	}
+	tmdbID, err := strconv.Atoi(externalID)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid TMDB ID %q for media %d", externalID, mediaID)
+	}
+	return tmdbID, externalType, nil
+}
+
 // FindSeriesSeasons 只使用相同的 TMDB TV ID 关联季度，不用标题猜测系列关系。
 func (store *PostgresStore) FindSeriesSeasons(ctx context.Context, doubanID string) ([]SeriesSeason, error) {
 	rows, err := store.database.Query(ctx, `WITH target_series AS (
@@ -172,6 +247,8 @@ ORDER BY CAST(SUBSTRING(external.external_type FROM '^tv_season_([0-9]+)$') AS I
 
 // Upsert 写入或更新一部影片，同时把 IMDb ID 写进外部 ID 表。
 // 标题里带「第 N 季」时，external_type 会写成 tv_season_N，季度导航靠它归拢。
+// 已有字段来源记录的列交给 MergeSource 按优先级和管理员锁来改写，这里保留现值，
+// 否则豆瓣刷新会先把人工修正整行盖掉，变更历史里也看不到这次改动。
 func (store *PostgresStore) Upsert(ctx context.Context, movie Movie) error {
 	if movie.ReviewsUpdatedAt.IsZero() {
 		movie.ReviewsUpdatedAt = time.Unix(0, 0).UTC()
@@ -186,13 +263,14 @@ INSERT INTO media
 summary, duration, backdrops, embedding_content, reviews_json, reviews_updated_at, series_status, metadata_status, updated_at)
 VALUES ('movie',$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$14,$15,$16,$17,$18,
 CASE WHEN $2 <> '' THEN 'partial' ELSE 'empty' END,NOW())
-ON CONFLICT (douban_id) WHERE douban_id <> '' DO UPDATE SET title=EXCLUDED.title,
-original_title=EXCLUDED.original_title, year=EXCLUDED.year, poster=EXCLUDED.poster,
-rating_douban=EXCLUDED.rating_douban, genres=EXCLUDED.genres, countries=EXCLUDED.countries,
-directors=EXCLUDED.directors, actors=EXCLUDED.actors, summary=EXCLUDED.summary,
-duration=EXCLUDED.duration, backdrops=EXCLUDED.backdrops,
+ON CONFLICT (douban_id) WHERE douban_id <> '' DO UPDATE SET `+unmergedField("title")+`,
+`+unmergedField("original_title")+`, `+unmergedField("year")+`, `+unmergedField("poster")+`,
+`+unmergedField("rating_douban")+`, `+unmergedField("genres")+`, `+unmergedField("countries")+`,
+`+unmergedField("directors")+`, `+unmergedField("actors")+`, `+unmergedField("summary")+`,
+`+unmergedField("duration")+`, `+unmergedField("backdrops")+`,
 reviews_json=EXCLUDED.reviews_json, reviews_updated_at=EXCLUDED.reviews_updated_at,
-series_status=CASE WHEN EXCLUDED.series_status <> '' THEN EXCLUDED.series_status ELSE media.series_status END,
+series_status=CASE WHEN EXCLUDED.series_status = '' OR `+mergedFieldCondition("series_status")+` THEN media.series_status
+    ELSE EXCLUDED.series_status END,
 updated_at=NOW()
 RETURNING id, media_type
 )
@@ -212,6 +290,16 @@ media_id=EXCLUDED.media_id, is_primary=TRUE, verified_at=NOW(), updated_at=NOW()
 	return nil
 }
 
+// mergedFieldCondition 判断 media 行的这一列是否已有字段来源记录。
+func mergedFieldCondition(column string) string {
+	return "EXISTS (SELECT 1 FROM media_field_sources source WHERE source.media_id = media.id AND source.field_name = '" + column + "')"
+}
+
+// unmergedField 生成 Upsert 的 SET 子句：列已归 MergeSource 管时保留现值，否则取新值。
+func unmergedField(column string) string {
+	return column + "=CASE WHEN " + mergedFieldCondition(column) + " THEN media." + column + " ELSE EXCLUDED." + column + " END"
+}
+
 // imdbCandidatePredicate 是两个阶段共用的候选条件。
 // 豆瓣 ID 的格式约束与 validDoubanID 必须逐字一致：不合规的值在 wikidataQuery 里
 // 会被静默丢掉，留在候选里只会让「查了没命中」和「根本没查」在日志上无法区分。
@@ -323,7 +411,7 @@ func (store *PostgresStore) DeleteByDoubanID(ctx context.Context, doubanID strin
 
 // Latest 按更新时间倒序取影片。
 func (store *PostgresStore) Latest(ctx context.Context, limit int) ([]Movie, error) {
-	rows, err := store.database.Query(ctx, `SELECT `+movieColumns+` FROM media m ORDER BY m.updated_at DESC LIMIT $1`, limit)
+	rows, err := store.database.Query(ctx, `SELECT `+movieColumns+` FROM media m WHERE m.merged_into_id IS NULL ORDER BY m.updated_at DESC LIMIT $1`, limit)
 	if err != nil {
 		return nil, fmt.Errorf("latest movies: %w", err)
 	}
@@ -342,10 +430,10 @@ func (store *PostgresStore) Latest(ctx context.Context, limit int) ([]Movie, err
 	return movies, nil
 }
 
-// LatestForSitemap 刻意只查询生成 XML 所需的两个字段。
+// LatestForSitemap 刻意只查询生成 XML 所需的几个字段。
 // 普通 Latest 还会加载简介、演员、剧照和评论；若 sitemap 也使用它，数据增长后 SEO 端点会无谓变重。
 func (store *PostgresStore) LatestForSitemap(ctx context.Context, limit int) ([]content.SitemapMovie, error) {
-	rows, err := store.database.Query(ctx, `SELECT douban_id, updated_at FROM media ORDER BY updated_at DESC LIMIT $1`, limit)
+	rows, err := store.database.Query(ctx, `SELECT id, douban_id, updated_at FROM media WHERE merged_into_id IS NULL ORDER BY updated_at DESC LIMIT $1`, limit)
 	if err != nil {
 		return nil, fmt.Errorf("latest sitemap movies: %w", err)
 	}
@@ -353,7 +441,7 @@ func (store *PostgresStore) LatestForSitemap(ctx context.Context, limit int) ([]
 	movies := make([]content.SitemapMovie, 0)
 	for rows.Next() {
 		var movie content.SitemapMovie
-		if err := rows.Scan(&movie.DoubanID, &movie.UpdatedAt); err != nil {
+		if err := rows.Scan(&movie.MediaID, &movie.DoubanID, &movie.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan sitemap movie: %w", err)
 		}
 		movies = append(movies, movie)
@@ -367,7 +455,7 @@ func (store *PostgresStore) LatestForSitemap(ctx context.Context, limit int) ([]
 // Suggest 按标题模糊搜索，完全相同 > 前缀匹配 > 其他，同档再按年份和评分排。
 func (store *PostgresStore) Suggest(ctx context.Context, keyword string, limit int) ([]Movie, error) {
 	rows, err := store.database.Query(ctx, `SELECT `+movieColumns+` FROM media m
-	WHERE m.title ILIKE $1 OR m.original_title ILIKE $1
+	WHERE (m.title ILIKE $1 OR m.original_title ILIKE $1) AND m.merged_into_id IS NULL
 	ORDER BY CASE
 	    WHEN LOWER(m.title) = LOWER($2) OR LOWER(m.original_title) = LOWER($2) THEN 0
 	    WHEN m.title ILIKE $3 OR m.original_title ILIKE $3 THEN 1
@@ -395,7 +483,7 @@ func (store *PostgresStore) Suggest(ctx context.Context, keyword string, limit i
 // Popular 取有评分且已生成向量的影片，按评分倒序（上游热门接口挂了时兜底用）。
 func (store *PostgresStore) Popular(ctx context.Context, limit int) ([]Movie, error) {
 	rows, err := store.database.Query(ctx, `SELECT `+movieColumns+` FROM media m
-WHERE m.rating_douban > 0 AND m.embedding IS NOT NULL ORDER BY m.rating_douban DESC, m.updated_at DESC LIMIT $1`, limit)
+WHERE m.rating_douban > 0 AND m.embedding IS NOT NULL AND m.merged_into_id IS NULL ORDER BY m.rating_douban DESC, m.updated_at DESC LIMIT $1`, limit)
 	if err != nil {
 		return nil, fmt.Errorf("popular movies: %w", err)
 	}
@@ -421,9 +509,10 @@ func scanMovie(row interface{ Scan(...any) error }) (Movie, error) {
 	err := row.Scan(&movie.ID, &movie.DoubanID, &movie.Title, &movie.OriginalTitle, &movie.Year,
 		&movie.Poster, &movie.Rating, &movie.Genres, &movie.Countries, &movie.Directors, &movie.Actors,
 		&movie.Summary, &movie.Duration, &movie.IMDbID, &movie.MediaType, &movie.SeriesStatus, &movie.Backdrops,
-		&movie.EmbeddingContent, &movie.EmbeddingSemanticHash, &movie.ReviewsJSON,
+		&movie.EmbeddingContent, &movie.EmbeddingSemanticHash, &movie.EmbeddingModel, &movie.ReviewsJSON,
 		&movie.ReviewsUpdatedAt, &movie.MetadataStatus, &movie.CompletenessScore,
-		&movie.NextRefreshAt, &movie.UpdatedAt, &embeddingText)
+		&movie.NextRefreshAt, &movie.UpdatedAt, &movie.PosterBlurhash, &movie.PosterColor, &movie.PosterAccentColor,
+		&movie.BackdropBlurhash, &movie.BackdropColor, &movie.BackdropAccentColor, &embeddingText)
 	if err != nil {
 		return movie, err
 	}
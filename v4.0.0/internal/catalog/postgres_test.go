@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
+	"github.com/TwoThreeWang/Moovie/new/internal/search"
 )
 
 func TestPostgresStorePreservesMovieIdentityAndExistingEmbeddingOnMetadataUpdate(t *testing.T) {
@@ -29,6 +31,23 @@ func TestPostgresStorePreservesMovieIdentityAndExistingEmbeddingOnMetadataUpdate
 	}
 }
 
+func TestPostgresStoreUpsertLeavesSourceTrackedFieldsToMergeSource(t *testing.T) {
+	fake := &catalogFakeDatabase{}
+	store := NewPostgresStore(fake)
+	if err := store.Upsert(t.Context(), Movie{DoubanID: "1292052", Title: "肖申克", Poster: "douban.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range []string{"title", "poster", "summary", "rating_douban"} {
+		if strings.Contains(fake.execQuery, column+"=EXCLUDED."+column+",") ||
+			!strings.Contains(fake.execQuery, "source.field_name = '"+column+"') THEN media."+column+" ELSE EXCLUDED."+column) {
+			t.Fatalf("%s is overwritten regardless of field sources: %s", column, fake.execQuery)
+		}
+	}
+	if !strings.Contains(fake.execQuery, "reviews_json=EXCLUDED.reviews_json") {
+		t.Fatalf("reviews are no longer refreshed: %s", fake.execQuery)
+	}
+}
+
 func TestPostgresStoreScopesIMDbIdentityForSeasonPages(t *testing.T) {
 	fake := &catalogFakeDatabase{}
 	store := NewPostgresStore(fake)
@@ -44,16 +63,17 @@ func TestPostgresStoreFindAndSitemapOrdering(t *testing.T) {
 	updatedAt := time.Date(2026, time.July, 30, 12, 0, 0, 0, time.UTC)
 	reviewsAt := updatedAt.Add(-time.Hour)
 	nextRefreshAt := updatedAt.Add(24 * time.Hour)
-	// 列顺序与 movieColumns 一致：… imdb_id, media_type, series_status, backdrops, embedding_content, semantic_hash, reviews_json,
-	// reviews_updated_at, metadata_status, completeness_score, next_refresh_at, updated_at, embedding::text。
-	values := []any{1, "1292052", "肖申克", "Original", "1994", "poster", 9.7, "剧情", "美国", "[]", "[]", "简介", "142分钟", "tt0111161", "movie", "Ended", "", "推荐语", "semantic-hash", "[]", reviewsAt, "ready", 92, &nextRefreshAt, updatedAt, ""}
+	// 列顺序与 movieColumns 一致：… imdb_id, media_type, series_status, backdrops, embedding_content, semantic_hash, embedding_model, reviews_json,
+	// reviews_updated_at, metadata_status, completeness_score, next_refresh_at, updated_at, 六个图片占位字段, embedding::text。
+	values := []any{1, "1292052", "肖申克", "Original", "1994", "poster", 9.7, "剧情", "美国", "[]", "[]", "简介", "142分钟", "tt0111161", "movie", "Ended", "", "推荐语", "semantic-hash", "ollama:bge-test", "[]", reviewsAt, "ready", 92, &nextRefreshAt, updatedAt,
+		"LEHV6nWB2yk8pyo0adR*.7kCMdnj", "#203040", "#c03020", "", "", "", ""}
 	fake := &catalogFakeDatabase{rows: &catalogFakeRows{values: [][]any{values}}}
 	store := NewPostgresStore(fake)
 	movie, err := store.FindByDoubanID(t.Context(), "1292052")
 	if err != nil || movie == nil || movie.Title != "肖申克" || movie.Rating != 9.7 {
 		t.Fatalf("movie/error = %+v/%v", movie, err)
 	}
-	if movie.SeriesStatus != "Ended" {
+	if movie.SeriesStatus != "Ended" || movie.PosterBlurhash != "LEHV6nWB2yk8pyo0adR*.7kCMdnj" || movie.PosterAccentColor != "#c03020" || movie.EmbeddingModel != "ollama:bge-test" {
 		t.Fatalf("series status = %q", movie.SeriesStatus)
 	}
 	if movie.MetadataStatus != "ready" || movie.CompletenessScore != 92 || movie.NextRefreshAt == nil || !movie.NextRefreshAt.Equal(nextRefreshAt) {
@@ -72,12 +92,12 @@ func TestPostgresStoreFindAndSitemapOrdering(t *testing.T) {
 		t.Fatalf("latest query/args = %s/%#v", fake.query, fake.arguments)
 	}
 
-	fake.rows = &catalogFakeRows{values: [][]any{{"1292052", updatedAt}}}
+	fake.rows = &catalogFakeRows{values: [][]any{{7, "1292052", updatedAt}}}
 	sitemapMovies, err := store.LatestForSitemap(t.Context(), 1000)
-	if err != nil || len(sitemapMovies) != 1 || sitemapMovies[0].DoubanID != "1292052" || !sitemapMovies[0].UpdatedAt.Equal(updatedAt) {
+	if err != nil || len(sitemapMovies) != 1 || sitemapMovies[0].MediaID != 7 || sitemapMovies[0].DoubanID != "1292052" || !sitemapMovies[0].UpdatedAt.Equal(updatedAt) {
 		t.Fatalf("sitemap movies/error = %+v/%v", sitemapMovies, err)
 	}
-	if !strings.Contains(fake.query, "SELECT douban_id, updated_at FROM media") || !strings.Contains(fake.query, "ORDER BY updated_at DESC LIMIT $1") || !reflect.DeepEqual(fake.arguments, []any{1000}) {
+	if !strings.Contains(fake.query, "SELECT id, douban_id, updated_at FROM media") || !strings.Contains(fake.query, "ORDER BY updated_at DESC LIMIT $1") || !reflect.DeepEqual(fake.arguments, []any{1000}) {
 		t.Fatalf("sitemap query/args = %s/%#v", fake.query, fake.arguments)
 	}
 }
@@ -89,7 +109,7 @@ func TestPostgresSimilarQueryUsesVectorDistanceAndExcludesSource(t *testing.T) {
 	if err != nil || len(movies) != 0 {
 		t.Fatalf("movies/error = %+v/%v", movies, err)
 	}
-	for _, expected := range []string{"embedding IS NOT NULL", "m.douban_id != $1", "ORDER BY m.embedding <-> target.embedding", "LIMIT $2"} {
+	for _, expected := range []string{"embedding IS NOT NULL", "WHERE douban_id = $1", "m.id != target.id", "ORDER BY m.embedding <-> target.embedding", "LIMIT $2"} {
 		if !strings.Contains(fake.query, expected) {
 			t.Fatalf("similar query missing %q: %s", expected, fake.query)
 		}
@@ -140,13 +160,13 @@ func TestPostgresUpdateEmbeddingUsesValidatedVectorCast(t *testing.T) {
 	store := NewPostgresStore(fake)
 	vector := make([]float32, 768)
 	vector[1] = 0.25
-	if err := store.UpdateEmbedding(t.Context(), "1292052", "语义文本", "semantic-hash", vector); err != nil {
+	if err := store.UpdateEmbedding(t.Context(), 42, "语义文本", "semantic-hash", vector); err != nil {
 		t.Fatal(err)
 	}
 	if !strings.Contains(fake.execQuery, "embedding = $4::vector") || !strings.Contains(fake.execQuery, "semantic_hash = $3") || !strings.Contains(fake.execQuery, "updated_at = NOW()") {
 		t.Fatalf("update query = %s", fake.execQuery)
 	}
-	if len(fake.arguments) != 4 || fake.arguments[0] != "1292052" || fake.arguments[1] != "语义文本" || fake.arguments[2] != "semantic-hash" {
+	if len(fake.arguments) != 4 || fake.arguments[0] != 42 || fake.arguments[1] != "语义文本" || fake.arguments[2] != "semantic-hash" {
 		t.Fatalf("arguments = %#v", fake.arguments)
 	}
 	encoded, ok := fake.arguments[3].(string)
@@ -155,11 +175,40 @@ func TestPostgresUpdateEmbeddingUsesValidatedVectorCast(t *testing.T) {
 	}
 	bad := make([]float32, 768)
 	bad[3] = float32(math.NaN())
-	if err := store.UpdateEmbedding(t.Context(), "1292052", "bad", "hash", bad); err == nil {
+	if err := store.UpdateEmbedding(t.Context(), 42, "bad", "hash", bad); err == nil {
 		t.Fatal("non-finite vector was accepted")
 	}
 }
 
+func TestPostgresSaveEmbeddingWritesIntoGenerationColumn(t *testing.T) {
+	vector := make([]float32, 1024)
+	vector[0] = 0.5
+	// 重建期间按旧模型写入的条目要清掉 embedding_next，否则新向量对应的还是旧文本。
+	fake := &catalogFakeDatabase{row: catalogFakeRow{values: []any{true}}}
+	store := NewPostgresStore(fake)
+	active := EmbeddingGeneration{ID: 3, Model: "ollama:bge-test", Dimensions: 1024, Status: EmbeddingGenerationActive}
+	if err := store.SaveEmbedding(t.Context(), 42, active, "语义文本", "hash", vector); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"embedding = $4::vector", "embedding_model = $5", "embedding_next = NULL", "id = $7 AND status = 'active'"} {
+		if !strings.Contains(fake.execQuery, expected) {
+			t.Fatalf("active save missing %q: %s", expected, fake.execQuery)
+		}
+	}
+	if len(fake.arguments) != 7 || fake.arguments[4] != "ollama:bge-test" || fake.arguments[5] != 1024 || fake.arguments[6] != 3 {
+		t.Fatalf("active arguments = %#v", fake.arguments[4:])
+	}
+	// 新代际还在构建时，旧向量必须原样留着继续服务。
+	building := EmbeddingGeneration{ID: 4, Model: "openai:text-embedding-3-small", Dimensions: 1024, Status: EmbeddingGenerationBuilding}
+	if err := store.SaveEmbedding(t.Context(), 42, building, "语义文本", "hash", vector); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fake.execQuery, "embedding_next = $4::vector") || strings.Contains(fake.execQuery, "embedding = $4") ||
+		!strings.Contains(fake.execQuery, "status = 'building'") || len(fake.arguments) != 5 {
+		t.Fatalf("building save = %s / %#v", fake.execQuery, fake.arguments)
+	}
+}
+
 func TestPostgresMetadataRefreshQueueUsesUnifiedWorkerJobs(t *testing.T) {
 	fake := &catalogFakeDatabase{row: catalogFakeRow{values: []any{42}}}
 	store := NewPostgresStore(fake)
@@ -216,12 +265,29 @@ func TestPostgresPersonalizationUsesCanonicalMediaAndPositions(t *testing.T) {
 	if err != nil || len(movies) != 0 {
 		t.Fatalf("movies/error = %+v/%v", movies, err)
 	}
-	for _, expected := range []string{"1.0 AS weight", "2.0 AS weight", "0.8 AS weight", "position.progress_percent>5", "AVG(embedding)", "m.id NOT IN", "ORDER BY m.embedding <-> uv.avg_embedding"} {
+	// 没有任何互动时只读一次信号，不拿空口味向量去查库。
+	for _, expected := range []string{"FROM user_movies um", "um.rating", "position.progress_percent>5", "DISTINCT ON (m.id)", "FROM recommendation_feedback feedback", "ORDER BY age_days"} {
+		if !strings.Contains(fake.query, expected) {
+			t.Fatalf("signal query missing %q: %s", expected, fake.query)
+		}
+	}
+	if !reflect.DeepEqual(fake.arguments, []any{7, maxTasteSignals}) {
+		t.Fatalf("arguments = %#v", fake.arguments)
+	}
+	fake.rows = &catalogFakeRows{values: [][]any{
+		{int64(3), "喜欢的片", "2020", "科幻", "[]", "[]", "watched", int64(5), 0.0, "[1,0]"},
+		{int64(4), "讨厌的片", "2021", "爱情", "[]", "[]", "watched", int64(1), 0.0, "[0,1]"},
+	}}
+	if _, err := store.UserRecommendations(t.Context(), 7, 60); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"FROM recommendation_feedback WHERE user_id=$1", "m.id NOT IN", "ORDER BY m.embedding <-> $2::vector", "LIMIT $3"} {
 		if !strings.Contains(fake.query, expected) {
-			t.Fatalf("query missing %q: %s", expected, fake.query)
+			t.Fatalf("recommendation query missing %q: %s", expected, fake.query)
 		}
 	}
-	if !reflect.DeepEqual(fake.arguments, []any{7, 60}) {
+	// 五星的片拉近、一星的片推远：[1,0] - 0.5 × [0,1]。
+	if !reflect.DeepEqual(fake.arguments, []any{7, "[1,-0.5]", 60}) {
 		t.Fatalf("arguments = %#v", fake.arguments)
 	}
 	fake.rows = &catalogFakeRows{}
@@ -229,7 +295,7 @@ func TestPostgresPersonalizationUsesCanonicalMediaAndPositions(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	for _, expected := range []string{"um.status='watched'", "m.rating_douban>=5", "INTERVAL '30 day'", "ORDER BY RANDOM()"} {
+	for _, expected := range []string{"um.status='watched'", "um.rating>=4", "m.rating_douban>=5", "INTERVAL '30 day'", "recommendation_feedback", "ORDER BY RANDOM()"} {
 		if !strings.Contains(fake.query, expected) {
 			t.Fatalf("relive query missing %q: %s", expected, fake.query)
 		}
@@ -325,3 +391,94 @@ func (row catalogFakeRow) Scan(destinations ...any) error {
 	rows := &catalogFakeRows{values: [][]any{row.values}}
 	return rows.Scan(destinations...)
 }
+
+func TestMergedDuplicatesDisappearFromSearchSimilarAndRecommendations(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 7)
+	store := NewPostgresStore(pool)
+	// 源片、保留作品、被并掉的重复条目和一部无关影片，向量依次远离源片。
+	for index, doubanID := range []string{"100", "200", "201", "300"} {
+		if err := store.Upsert(t.Context(), Movie{DoubanID: doubanID, Title: "沙丘" + doubanID, Rating: 8}); err != nil {
+			t.Fatal(err)
+		}
+		movie, err := store.FindByDoubanID(t.Context(), doubanID)
+		if err != nil || movie == nil {
+			t.Fatalf("find %s = %+v / %v", doubanID, movie, err)
+		}
+		vector := make([]float32, embeddingDimensions)
+		vector[0], vector[1] = 1, float32(index)/10
+		if err := store.UpdateEmbedding(t.Context(), movie.ID, doubanID, doubanID, vector); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := pool.Exec(t.Context(), `UPDATE media SET merged_into_id = (SELECT id FROM media WHERE douban_id = '200') WHERE douban_id = '201'`); err != nil {
+		t.Fatal(err)
+	}
+	doubanIDs := func(movies []Movie) string {
+		ids := make([]string, 0, len(movies))
+		for _, movie := range movies {
+			ids = append(ids, movie.DoubanID)
+		}
+		return strings.Join(ids, ",")
+	}
+	if similar, err := store.FindSimilar(t.Context(), "100", 10); err != nil || doubanIDs(similar) != "200,300" {
+		t.Fatalf("similar = %s / %v", doubanIDs(similar), err)
+	}
+	taste := make([]float32, embeddingDimensions)
+	taste[0] = 1
+	if near, err := store.RecommendNear(t.Context(), 7, taste, 10); err != nil || doubanIDs(near) != "100,200,300" {
+		t.Fatalf("recommend near = %s / %v", doubanIDs(near), err)
+	}
+	if popular, err := store.Popular(t.Context(), 10); err != nil || strings.Contains(doubanIDs(popular), "201") {
+		t.Fatalf("popular = %s / %v", doubanIDs(popular), err)
+	}
+	items, err := search.NewPostgresStore(pool).SearchUnifiedMedia(t.Context(), search.UnifiedQuery{Keyword: "沙丘", Limit: 10})
+	if err != nil || len(items) != 3 {
+		t.Fatalf("search = %+v / %v", items, err)
+	}
+	for _, item := range items {
+		if item.DoubanID == "201" {
+			t.Fatalf("merged duplicate still searchable: %+v", items)
+		}
+	}
+}
+
+func TestRecommendNearGroupExcludesEveryMembersWatchedAndPlayed(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 7, 8)
+	store := NewPostgresStore(pool)
+	mediaIDs := make(map[string]int)
+	for index, doubanID := range []string{"100", "200", "300", "400"} {
+		if err := store.Upsert(t.Context(), Movie{DoubanID: doubanID, Title: "候选" + doubanID}); err != nil {
+			t.Fatal(err)
+		}
+		movie, err := store.FindByDoubanID(t.Context(), doubanID)
+		if err != nil || movie == nil {
+			t.Fatalf("find %s = %+v / %v", doubanID, movie, err)
+		}
+		mediaIDs[doubanID] = movie.ID
+		vector := make([]float32, embeddingDimensions)
+		vector[0], vector[1] = 1, float32(index)/10
+		if err := store.UpdateEmbedding(t.Context(), movie.ID, doubanID, doubanID, vector); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 7 号看过 100、想看 400；8 号播过 200。想看的不排除。
+	if _, err := pool.Exec(t.Context(), `INSERT INTO user_movies (user_id, movie_id, media_id, status) VALUES (7, '100', $1, 'watched'), (7, '400', $2, 'wish')`,
+		mediaIDs["100"], mediaIDs["400"]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(t.Context(), `INSERT INTO playback_positions (user_id, media_id, progress_percent) VALUES (8, $1, 40)`, mediaIDs["200"]); err != nil {
+		t.Fatal(err)
+	}
+	taste := make([]float32, embeddingDimensions)
+	taste[0] = 1
+	near, err := store.RecommendNearGroup(t.Context(), []int{7, 8}, taste, 10)
+	if err != nil || len(near) != 2 || near[0].DoubanID != "300" || near[1].DoubanID != "400" {
+		t.Fatalf("group near = %+v / %v", near, err)
+	}
+	excluded, err := store.GroupExcluded(t.Context(), []int{7, 8}, []int{mediaIDs["100"], mediaIDs["200"], mediaIDs["400"]})
+	if err != nil || len(excluded) != 2 || !excluded[mediaIDs["100"]] || !excluded[mediaIDs["200"]] {
+		t.Fatalf("excluded = %v / %v", excluded, err)
+	}
+}
@@ -3,6 +3,7 @@ package catalog
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
@@ -14,6 +15,15 @@ const (
 	RefreshProviderReviews   = "douban_reviews"
 	RefreshProviderTMDB      = "tmdb"
 	RefreshProviderEmbedding = "embedding"
+	RefreshProviderBangumi   = "bangumi"
+
+	// 下面几种任务不依赖豆瓣 ID：导入任务的 subject_key 是 MovieKey.ImportSubject
+	// （如 tmdb/tv/1399、imdb/tt0133093），其余的都是 media.id。
+	// 与上面五种分开命名，是因为 media.id 和豆瓣 ID 都是纯数字，共用任务类型会撞在同一个唯一键上。
+	RefreshProviderTMDBMetadata   = "tmdb_metadata"
+	RefreshProviderMediaEmbedding = "media_embedding"
+	RefreshProviderTMDBImport     = "tmdb_import"
+	RefreshProviderImagePalette   = "image_palette"
 
 	// 下面这些 reason 都是详情页按「某个字段还是空的」自动触发的，
 	// 需要入队冷却，理由见 autoRefreshCooldowns。
@@ -51,11 +61,27 @@ type MediaRefreshQueue interface {
 	EnqueueMediaRefresh(ctx context.Context, mediaID int, reason string, requestedBy int) (int, error)
 }
 
+// MediaJobQueue 按 media.id 入队，用于没有豆瓣 ID 的作品；导入任务按外部 ID 入队。
+type MediaJobQueue interface {
+	EnqueueMediaJob(ctx context.Context, mediaID int, provider, reason string, requestedBy int) (int, error)
+	EnqueueExternalImport(ctx context.Context, key MovieKey, reason string, requestedBy int) (int, error)
+}
+
 // TMDBRefreshChecker 判断一部影片是否还缺首次 TMDB 资料采集。
 type TMDBRefreshChecker interface {
 	NeedsTMDBRefresh(ctx context.Context, doubanID string) (bool, error)
 }
 
+// BangumiRefreshChecker 判断一部影片是否是需要走 Bangumi 补分集的动画。
+type BangumiRefreshChecker interface {
+	NeedsBangumiRefresh(ctx context.Context, doubanID string) (bool, error)
+}
+
+// AnimeSyncer 同步动画的 Bangumi 条目和分集。
+type AnimeSyncer interface {
+	SyncAnime(ctx context.Context, doubanID string) error
+}
+
 // EnqueueRefresh 把一次资料刷新放进 worker_jobs。返回的 job id 为 0 表示被冷却挡下了，不是失败。
 func (store *PostgresStore) EnqueueRefresh(ctx context.Context, doubanID, provider, reason string, requestedBy int) (int, error) {
 	if !validDoubanID(doubanID) {
@@ -87,7 +113,8 @@ func (store *PostgresStore) EnqueueRefresh(ctx context.Context, doubanID, provid
 
 // coolingDown 判断这个对象最近是否已经跑完过一轮同类任务。只看终态行：
 // pending/running 由唯一偏索引兜住，不该也不需要再被冷却挡一次。
-func (store *PostgresStore) coolingDown(ctx context.Context, provider, doubanID, reason string) (bool, error) {
+// subject 是任务的 subject_key：豆瓣 ID、media.id 或导入标识。
+func (store *PostgresStore) coolingDown(ctx context.Context, provider, subject, reason string) (bool, error) {
 	cooldown, tracked := autoRefreshCooldowns[reason]
 	if !tracked {
 		return false, nil
@@ -97,7 +124,7 @@ func (store *PostgresStore) coolingDown(ctx context.Context, provider, doubanID,
     SELECT 1 FROM worker_jobs
     WHERE task_type = $1 AND subject_key = $2 AND status IN ('completed', 'failed')
       AND finished_at IS NOT NULL AND finished_at > NOW() - make_interval(secs => $3))`,
-		provider, doubanID, cooldown.Seconds()).Scan(&recent); err != nil {
+		provider, subject, cooldown.Seconds()).Scan(&recent); err != nil {
 		return false, fmt.Errorf("check refresh cooldown: %w", err)
 	}
 	return recent, nil
@@ -115,6 +142,11 @@ func (store *PostgresStore) alreadyComplete(ctx context.Context, provider, douba
 		query = `SELECT backdrops <> '' AND EXISTS (SELECT 1 FROM media_external_ids WHERE media_id = m.id AND provider = 'tmdb') FROM media m WHERE m.douban_id = $1`
 	case RefreshProviderEmbedding:
 		query = `SELECT semantic_hash <> '' FROM media WHERE douban_id = $1`
+	case RefreshProviderBangumi:
+		// 绑过 Bangumi 条目、又没有还没播出的分集，就不必再抓；连载中的番每次刷新都要补新一集的标题和日期。
+		query = `SELECT EXISTS (SELECT 1 FROM media_external_ids WHERE media_id = m.id AND provider = 'bangumi')
+    AND NOT EXISTS (SELECT 1 FROM media_units WHERE media_id = m.id AND unit_type = 'episode' AND air_date >= CURRENT_DATE)
+FROM media m WHERE m.douban_id = $1`
 	default:
 		return false, nil
 	}
@@ -125,18 +157,80 @@ func (store *PostgresStore) alreadyComplete(ctx context.Context, provider, douba
 	return done, nil
 }
 
-// EnqueueMediaRefresh 先把 media.id 换成豆瓣 ID，再走 EnqueueRefresh。
+// EnqueueMediaRefresh 有豆瓣 ID 的作品换成豆瓣 ID 走 EnqueueRefresh，
+// 没有的按 media.id 排一个 TMDB 主资料任务。
 func (store *PostgresStore) EnqueueMediaRefresh(ctx context.Context, mediaID int, reason string, requestedBy int) (int, error) {
 	if mediaID <= 0 {
 		return 0, fmt.Errorf("invalid media ID %d", mediaID)
 	}
 	var doubanID string
-	if err := store.database.QueryRow(ctx, `SELECT douban_id FROM media WHERE id = $1 AND douban_id <> ''`, mediaID).Scan(&doubanID); err != nil {
+	if err := store.database.QueryRow(ctx, `SELECT douban_id FROM media WHERE id = $1`, mediaID).Scan(&doubanID); err != nil {
 		return 0, fmt.Errorf("resolve media refresh identity: %w", err)
 	}
+	if doubanID == "" {
+		return store.EnqueueMediaJob(ctx, mediaID, RefreshProviderTMDBMetadata, reason, requestedBy)
+	}
 	return store.EnqueueRefresh(ctx, doubanID, RefreshProviderDouban, reason, requestedBy)
 }
 
+// EnqueueMediaJob 按 media.id 入队主资料、向量或图片占位信息任务，冷却规则与 EnqueueRefresh 相同。
+func (store *PostgresStore) EnqueueMediaJob(ctx context.Context, mediaID int, provider, reason string, requestedBy int) (int, error) {
+	if mediaID <= 0 {
+		return 0, workqueue.Terminal(fmt.Errorf("invalid media ID %d", mediaID))
+	}
+	var query string
+	switch provider {
+	case RefreshProviderTMDBMetadata:
+		query = `SELECT completeness_score >= 70 AND metadata_status <> 'partial' FROM media WHERE id = $1`
+	case RefreshProviderMediaEmbedding:
+		query = `SELECT semantic_hash <> '' FROM media WHERE id = $1`
+	case RefreshProviderImagePalette:
+		// 没有图，或者图片地址和上次计算时一样，都不必再算。
+		query = `SELECT (poster = '' AND backdrops = '')
+    OR image_palette_source = poster || E'\n' || split_part(backdrops, ',', 1)
+FROM media WHERE id = $1`
+	default:
+		return 0, workqueue.Terminal(fmt.Errorf("invalid media refresh provider %q", provider))
+	}
+	var done bool
+	if err := store.database.QueryRow(ctx, query, mediaID).Scan(&done); err == nil && done {
+		return 0, nil
+	}
+	subject := strconv.Itoa(mediaID)
+	if cooling, err := store.coolingDown(ctx, provider, subject, reason); err != nil {
+		return 0, err
+	} else if cooling {
+		return 0, nil
+	}
+	priority := 0
+	if provider == RefreshProviderTMDBMetadata {
+		priority = 5
+	}
+	return workqueue.NewPostgresStore(store.database).Enqueue(ctx, workqueue.Spec{
+		TaskType: provider, SubjectKey: subject, Payload: map[string]int{"media_id": mediaID},
+		Reason: reason, RequestedBy: requestedBy, Priority: priority,
+	})
+}
+
+// EnqueueExternalImport 为本地还没有的 TMDB/IMDb 作品排一个导入任务。
+// 详情页入口任何人都能访问，所以这里只排任务、不建行：TMDB 确认有这部作品之后才写 media。
+func (store *PostgresStore) EnqueueExternalImport(ctx context.Context, key MovieKey, reason string, requestedBy int) (int, error) {
+	if key.Kind != MovieKeyExternal {
+		return 0, workqueue.Terminal(fmt.Errorf("invalid external media key %+v", key))
+	}
+	subject := key.ImportSubject()
+	if cooling, err := store.coolingDown(ctx, RefreshProviderTMDBImport, subject, reason); err != nil {
+		return 0, err
+	} else if cooling {
+		return 0, nil
+	}
+	return workqueue.NewPostgresStore(store.database).Enqueue(ctx, workqueue.Spec{
+		TaskType: RefreshProviderTMDBImport, SubjectKey: subject,
+		Payload: map[string]string{"provider": key.Provider, "external_type": key.ExternalType, "external_id": key.ExternalID},
+		Reason:  reason, RequestedBy: requestedBy, Priority: 5,
+	})
+}
+
 // NeedsTMDBRefresh 在剧照为空或尚无 TMDB 映射时返回 true。
 // IMDb 映射是当前 TMDB 采集器的查询前提，没有时交给 imdb_backfill 处理。
 func (store *PostgresStore) NeedsTMDBRefresh(ctx context.Context, doubanID string) (bool, error) {
@@ -153,10 +247,21 @@ func (store *PostgresStore) NeedsTMDBRefresh(ctx context.Context, doubanID strin
 	return needed, nil
 }
 
-// validRefreshProvider 只允许四种已知的刷新来源，防止任意字符串被写进任务表。
+// NeedsBangumiRefresh 在豆瓣类型里带「动画」时返回 true，是否已经抓全由 EnqueueRefresh 的 alreadyComplete 判断。
+func (store *PostgresStore) NeedsBangumiRefresh(ctx context.Context, doubanID string) (bool, error) {
+	var needed bool
+	if err := store.database.QueryRow(ctx, `SELECT EXISTS (
+    SELECT 1 FROM media WHERE douban_id = $1 AND genres LIKE '%动画%'
+)`, doubanID).Scan(&needed); err != nil {
+		return false, fmt.Errorf("check Bangumi refresh state: %w", err)
+	}
+	return needed, nil
+}
+
+// validRefreshProvider 只允许五种按豆瓣 ID 入队的刷新来源，防止任意字符串被写进任务表。
 func validRefreshProvider(provider string) bool {
 	switch provider {
-	case RefreshProviderDouban, RefreshProviderReviews, RefreshProviderTMDB, RefreshProviderEmbedding:
+	case RefreshProviderDouban, RefreshProviderReviews, RefreshProviderTMDB, RefreshProviderEmbedding, RefreshProviderBangumi:
 		return true
 	default:
 		return false
@@ -164,28 +269,36 @@ func validRefreshProvider(provider string) bool {
 }
 
 // ScheduleDueRefreshes 把到期且资料不完整的影片批量入队。
-// 资料已完整的影片清除 next_refresh_at，不再轮转。
+// 资料已完整的影片清除 next_refresh_at，不再轮转。有豆瓣 ID 的走豆瓣主资料任务，
+// 没有的按 media.id 走 TMDB 主资料任务（前提是至少绑了 TMDB 或 IMDb，否则无从刷新）。
 func (store *PostgresStore) ScheduleDueRefreshes(ctx context.Context, limit int) error {
 	if limit <= 0 {
 		limit = 20
 	}
 	_, err := store.database.Exec(ctx, `WITH due AS (
-    SELECT id, douban_id, (metadata_status = 'partial' OR completeness_score < 70) AS incomplete
-    FROM media
-    WHERE douban_id <> '' AND next_refresh_at IS NOT NULL AND next_refresh_at <= NOW()
-    ORDER BY next_refresh_at, id LIMIT $1
+    SELECT m.id,
+        CASE WHEN m.douban_id <> '' THEN 'douban_metadata' ELSE 'tmdb_metadata' END AS task_type,
+        CASE WHEN m.douban_id <> '' THEN m.douban_id ELSE m.id::text END AS subject_key,
+        CASE WHEN m.douban_id <> '' THEN JSONB_BUILD_OBJECT('douban_id', m.douban_id)
+            ELSE JSONB_BUILD_OBJECT('media_id', m.id) END AS payload,
+        (m.metadata_status = 'partial' OR m.completeness_score < 70) AS incomplete
+    FROM media m
+    WHERE (m.douban_id <> '' OR EXISTS (SELECT 1 FROM media_external_ids x
+        WHERE x.media_id = m.id AND x.provider IN ('tmdb', 'imdb')))
+      AND m.next_refresh_at IS NOT NULL AND m.next_refresh_at <= NOW()
+    ORDER BY m.next_refresh_at, m.id LIMIT $1
 ), skip_complete AS (
     UPDATE media SET next_refresh_at = NULL
     WHERE id IN (SELECT id FROM due WHERE NOT incomplete)
 ), queued AS (
     INSERT INTO worker_jobs (task_type, subject_key, payload, reason, status, available_at)
-    SELECT 'douban_metadata', douban_id, JSONB_BUILD_OBJECT('douban_id', douban_id), 'scheduled', 'pending', NOW()
+    SELECT task_type, subject_key, payload, 'scheduled', 'pending', NOW()
     FROM due WHERE incomplete
     ON CONFLICT (task_type, subject_key) WHERE status IN ('pending', 'running') DO NOTHING
-    RETURNING subject_key
+    RETURNING task_type, subject_key
 )
 UPDATE media SET next_refresh_at = NOW() + INTERVAL '24 hours'
-WHERE douban_id IN (SELECT subject_key FROM queued)`, limit)
+WHERE id IN (SELECT due.id FROM due JOIN queued USING (task_type, subject_key))`, limit)
 	if err != nil {
 		return fmt.Errorf("schedule due metadata refreshes: %w", err)
 	}
@@ -205,14 +318,18 @@ func (store *PostgresStore) ScheduleActiveContentRefreshes(ctx context.Context,
       AND event.media_id > 0
     LIMIT $1
 ), stale AS (
-    SELECT m.douban_id FROM active
+    SELECT m.id, m.douban_id FROM active
     JOIN media m ON m.id = active.media_id
-    WHERE m.douban_id <> ''
+    WHERE (m.douban_id <> '' OR EXISTS (SELECT 1 FROM media_external_ids x
+        WHERE x.media_id = m.id AND x.provider IN ('tmdb', 'imdb')))
       AND (m.last_metadata_sync_at IS NULL OR m.last_metadata_sync_at < NOW() - INTERVAL '3 days')
       AND (m.metadata_status = 'partial' OR m.completeness_score < 70)
 )
 INSERT INTO worker_jobs (task_type, subject_key, payload, reason, status, available_at)
-SELECT 'douban_metadata', douban_id, JSONB_BUILD_OBJECT('douban_id', douban_id), 'active_content', 'pending', NOW() FROM stale
+SELECT CASE WHEN douban_id <> '' THEN 'douban_metadata' ELSE 'tmdb_metadata' END,
+    CASE WHEN douban_id <> '' THEN douban_id ELSE id::text END,
+    CASE WHEN douban_id <> '' THEN JSONB_BUILD_OBJECT('douban_id', douban_id) ELSE JSONB_BUILD_OBJECT('media_id', id) END,
+    'active_content', 'pending', NOW() FROM stale
 ON CONFLICT (task_type, subject_key) WHERE status IN ('pending', 'running') DO NOTHING`, limit)
 	if err != nil {
 		return fmt.Errorf("schedule active content refreshes: %w", err)
@@ -220,13 +337,16 @@ ON CONFLICT (task_type, subject_key) WHERE status IN ('pending', 'running') DO N
 	return nil
 }
 
-// RefreshHandler 是资料刷新任务的执行器，四种 provider 走同一个 Handle 分发。
+// RefreshHandler 是资料刷新任务的执行器，所有 provider 走同一个 Handle 分发。
 type RefreshHandler struct {
 	queue     RefreshQueue
 	fetcher   Fetcher
 	vectors   VectorEnricher
 	reviews   ReviewFetcher
 	backdrops BackdropSyncer
+	metadata  MediaMetadataSyncer
+	anime     AnimeSyncer
+	palettes  ImagePaletteSyncer
 }
 
 // RefreshHandlerOption 是刷新执行器的可选装配项。
@@ -242,6 +362,21 @@ func WithRefreshBackdrops(syncer BackdropSyncer) RefreshHandlerOption {
 	return func(handler *RefreshHandler) { handler.backdrops = syncer }
 }
 
+// WithRefreshMediaMetadata 注入按 media.id 补主资料和按外部 ID 导入作品的能力。
+func WithRefreshMediaMetadata(syncer MediaMetadataSyncer) RefreshHandlerOption {
+	return func(handler *RefreshHandler) { handler.metadata = syncer }
+}
+
+// WithRefreshBangumi 注入动画的 Bangumi 条目和分集同步。
+func WithRefreshBangumi(syncer AnimeSyncer) RefreshHandlerOption {
+	return func(handler *RefreshHandler) { handler.anime = syncer }
+}
+
+// WithRefreshImagePalette 注入海报和剧照的 BlurHash、主色计算。
+func WithRefreshImagePalette(syncer ImagePaletteSyncer) RefreshHandlerOption {
+	return func(handler *RefreshHandler) { handler.palettes = syncer }
+}
+
 // NewRefreshHandler 创建刷新执行器。
 func NewRefreshHandler(queue RefreshQueue, fetcher Fetcher, vectors VectorEnricher, options ...RefreshHandlerOption) *RefreshHandler {
 	handler := &RefreshHandler{queue: queue, fetcher: fetcher, vectors: vectors}
@@ -252,7 +387,8 @@ func NewRefreshHandler(queue RefreshQueue, fetcher Fetcher, vectors VectorEnrich
 }
 
 // Handle 执行一个刷新任务。豆瓣主资料抓完后，只在首次 TMDB 资料确实缺失时派生 TMDB 任务；
-// 剧照是该任务的附带结果，不会因为已有资料而反复刷新。
+// 剧照是该任务的附带结果，不会因为已有资料而反复刷新。动画另外派生 Bangumi 任务补分集。
+// 海报或剧照可能换了地址的任务（豆瓣主资料、TMDB、按 media.id 的主资料和导入）之后都派生占位信息任务。
 func (handler *RefreshHandler) Handle(ctx context.Context, job workqueue.Job) error {
 	doubanID := job.SubjectKey
 	switch job.TaskType {
@@ -277,12 +413,25 @@ func (handler *RefreshHandler) Handle(ctx context.Context, job workqueue.Job) er
 				}
 			}
 		}
+		if handler.anime != nil {
+			if checker, ok := handler.queue.(BangumiRefreshChecker); ok {
+				needed, err := checker.NeedsBangumiRefresh(ctx, doubanID)
+				if err != nil {
+					return err
+				}
+				if needed {
+					if _, err := handler.queue.EnqueueRefresh(ctx, doubanID, RefreshProviderBangumi, job.Reason, job.RequestedBy); err != nil {
+						return err
+					}
+				}
+			}
+		}
 		if handler.vectors != nil {
 			if _, err := handler.queue.EnqueueRefresh(ctx, doubanID, RefreshProviderEmbedding, job.Reason, job.RequestedBy); err != nil {
 				return err
 			}
 		}
-		return nil
+		return handler.enqueueDoubanImagePalette(ctx, doubanID, job)
 	case RefreshProviderReviews:
 		if handler.reviews == nil {
 			return workqueue.Terminal(fmt.Errorf("Douban review refresher is not configured"))
@@ -292,18 +441,106 @@ func (handler *RefreshHandler) Handle(ctx context.Context, job workqueue.Job) er
 		if handler.backdrops == nil {
 			return workqueue.Terminal(fmt.Errorf("TMDB refresher is not configured"))
 		}
-		return handler.backdrops.SyncBackdrops(ctx, doubanID)
+		if err := handler.backdrops.SyncBackdrops(ctx, doubanID); err != nil {
+			return err
+		}
+		return handler.enqueueDoubanImagePalette(ctx, doubanID, job)
+	case RefreshProviderBangumi:
+		if handler.anime == nil {
+			return workqueue.Terminal(fmt.Errorf("Bangumi refresher is not configured"))
+		}
+		return handler.anime.SyncAnime(ctx, doubanID)
 	case RefreshProviderEmbedding:
 		if handler.vectors == nil {
 			return workqueue.Terminal(fmt.Errorf("embedding refresher is not configured"))
 		}
 		return handler.vectors.Enrich(ctx, doubanID)
+	case RefreshProviderTMDBMetadata:
+		if handler.metadata == nil {
+			return workqueue.Terminal(fmt.Errorf("TMDB metadata refresher is not configured"))
+		}
+		mediaID, err := strconv.Atoi(job.SubjectKey)
+		if err != nil {
+			return workqueue.Terminal(fmt.Errorf("invalid media ID %q", job.SubjectKey))
+		}
+		if err := handler.metadata.SyncMedia(ctx, mediaID); err != nil {
+			return err
+		}
+		if err := handler.enqueueMediaEmbedding(ctx, mediaID, job); err != nil {
+			return err
+		}
+		return handler.enqueueImagePalette(ctx, mediaID, job)
+	case RefreshProviderTMDBImport:
+		if handler.metadata == nil {
+			return workqueue.Terminal(fmt.Errorf("TMDB metadata refresher is not configured"))
+		}
+		key, ok := ParseImportSubject(job.SubjectKey)
+		if !ok {
+			return workqueue.Terminal(fmt.Errorf("invalid import subject %q", job.SubjectKey))
+		}
+		mediaID, err := handler.metadata.ImportExternalMedia(ctx, key)
+		if err != nil {
+			return err
+		}
+		if err := handler.enqueueMediaEmbedding(ctx, mediaID, job); err != nil {
+			return err
+		}
+		return handler.enqueueImagePalette(ctx, mediaID, job)
+	case RefreshProviderMediaEmbedding:
+		enricher, ok := handler.vectors.(MediaVectorEnricher)
+		if !ok {
+			return workqueue.Terminal(fmt.Errorf("embedding refresher is not configured"))
+		}
+		mediaID, err := strconv.Atoi(job.SubjectKey)
+		if err != nil {
+			return workqueue.Terminal(fmt.Errorf("invalid media ID %q", job.SubjectKey))
+		}
+		return enricher.EnrichMedia(ctx, mediaID)
+	case RefreshProviderImagePalette:
+		if handler.palettes == nil {
+			return workqueue.Terminal(fmt.Errorf("image palette refresher is not configured"))
+		}
+		mediaID, err := strconv.Atoi(job.SubjectKey)
+		if err != nil {
+			return workqueue.Terminal(fmt.Errorf("invalid media ID %q", job.SubjectKey))
+		}
+		return handler.palettes.SyncImagePalette(ctx, mediaID)
 	default:
 		return workqueue.Terminal(fmt.Errorf("unsupported metadata refresh provider %q", job.TaskType))
 	}
 }
 
-// Schedule 是定时入口：把到期的和近期有人播放过的媒体排进队列。
+// enqueueMediaEmbedding 在主资料写好之后派生向量任务，和豆瓣主资料任务的链式入队对应。
+func (handler *RefreshHandler) enqueueMediaEmbedding(ctx context.Context, mediaID int, job workqueue.Job) error {
+	queue, ok := handler.queue.(MediaJobQueue)
+	if _, enrich := handler.vectors.(MediaVectorEnricher); !ok || !enrich || mediaID <= 0 {
+		return nil
+	}
+	_, err := queue.EnqueueMediaJob(ctx, mediaID, RefreshProviderMediaEmbedding, job.Reason, job.RequestedBy)
+	return err
+}
+
+// enqueueImagePalette 在图片地址可能变化之后派生占位信息任务，没装配计算服务时什么都不做。
+func (handler *RefreshHandler) enqueueImagePalette(ctx context.Context, mediaID int, job workqueue.Job) error {
+	queue, ok := handler.queue.(ImagePaletteQueue)
+	if !ok || handler.palettes == nil || mediaID <= 0 {
+		return nil
+	}
+	_, err := queue.EnqueueImagePalette(ctx, mediaID, job.Reason, job.RequestedBy)
+	return err
+}
+
+// enqueueDoubanImagePalette 是 enqueueImagePalette 的豆瓣 ID 版本。
+func (handler *RefreshHandler) enqueueDoubanImagePalette(ctx context.Context, doubanID string, job workqueue.Job) error {
+	queue, ok := handler.queue.(ImagePaletteQueue)
+	if !ok || handler.palettes == nil {
+		return nil
+	}
+	_, err := queue.EnqueueDoubanImagePalette(ctx, doubanID, job.Reason, job.RequestedBy)
+	return err
+}
+
+// Schedule 是定时入口：把到期的和近期有人播放过的媒体排进队列，装配了占位信息计算时顺带回填存量图片。
 func (handler *RefreshHandler) Schedule(ctx context.Context, _ workqueue.Job) error {
 	store, ok := handler.queue.(interface {
 		ScheduleDueRefreshes(context.Context, int) error
@@ -315,5 +552,13 @@ func (handler *RefreshHandler) Schedule(ctx context.Context, _ workqueue.Job) er
 	if err := store.ScheduleDueRefreshes(ctx, 20); err != nil {
 		return err
 	}
-	return store.ScheduleActiveContentRefreshes(ctx, 10)
+	if err := store.ScheduleActiveContentRefreshes(ctx, 10); err != nil {
+		return err
+	}
+	if palettes, ok := handler.queue.(interface {
+		ScheduleImagePalettes(context.Context, int) error
+	}); ok && handler.palettes != nil {
+		return palettes.ScheduleImagePalettes(ctx, 20)
+	}
+	return nil
 }
@@ -2,6 +2,7 @@ package catalog
 
 import (
 	"context"
+	"strconv"
 	"testing"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
@@ -38,9 +39,84 @@ func TestRefreshHandlerSkipsSatisfiedTMDBCollection(t *testing.T) {
 	}
 }
 
+func TestRefreshHandlerChainsBangumiForAnime(t *testing.T) {
+	queue := &refreshQueueStub{needsBangumi: true}
+	anime := &recordingAnimeSyncer{}
+	handler := NewRefreshHandler(queue, &recordingFetcher{}, nil, WithRefreshBangumi(anime))
+	for _, taskType := range []string{RefreshProviderDouban, RefreshProviderBangumi} {
+		if err := handler.Handle(t.Context(), workqueue.Job{TaskType: taskType, SubjectKey: "35734957", Reason: "test"}); err != nil {
+			t.Fatalf("%s: %v", taskType, err)
+		}
+	}
+	if len(queue.jobs) != 1 || queue.jobs[0].TaskType != RefreshProviderBangumi || len(anime.ids) != 1 {
+		t.Fatalf("chained jobs = %+v, synced = %v", queue.jobs, anime.ids)
+	}
+	// 没装 Bangumi 的部署不派生任务，直接收到的任务判死，别占着重试预算。
+	queue = &refreshQueueStub{needsBangumi: true}
+	handler = NewRefreshHandler(queue, &recordingFetcher{}, nil)
+	if err := handler.Handle(t.Context(), workqueue.Job{TaskType: RefreshProviderDouban, SubjectKey: "35734957"}); err != nil || len(queue.jobs) != 0 {
+		t.Fatalf("unconfigured Bangumi chain = %v/%+v", err, queue.jobs)
+	}
+	if err := handler.Handle(t.Context(), workqueue.Job{TaskType: RefreshProviderBangumi, SubjectKey: "35734957"}); !workqueue.IsTerminal(err) {
+		t.Fatalf("unconfigured Bangumi task = %v", err)
+	}
+}
+
+type recordingAnimeSyncer struct{ ids []string }
+
+func (syncer *recordingAnimeSyncer) SyncAnime(_ context.Context, doubanID string) error {
+	syncer.ids = append(syncer.ids, doubanID)
+	return nil
+}
+
+func TestRefreshHandlerDispatchesMediaJobsByMediaID(t *testing.T) {
+	queue := &refreshQueueStub{}
+	metadata := &recordingMediaSyncer{importedID: 9}
+	vectors := &recordingVectorEnricher{}
+	handler := NewRefreshHandler(queue, nil, vectors, WithRefreshMediaMetadata(metadata))
+	for _, job := range []workqueue.Job{
+		{TaskType: RefreshProviderTMDBMetadata, SubjectKey: "42"},
+		{TaskType: RefreshProviderTMDBImport, SubjectKey: "tmdb/tv/1399"},
+		{TaskType: RefreshProviderMediaEmbedding, SubjectKey: "42"},
+	} {
+		if err := handler.Handle(t.Context(), job); err != nil {
+			t.Fatalf("%s: %v", job.TaskType, err)
+		}
+	}
+	if len(metadata.synced) != 1 || metadata.synced[0] != 42 || len(metadata.imported) != 1 || metadata.imported[0].ExternalID != "1399" {
+		t.Fatalf("metadata calls = synced:%v imported:%+v", metadata.synced, metadata.imported)
+	}
+	if len(vectors.mediaIDs) != 1 || vectors.mediaIDs[0] != 42 || len(vectors.ids) != 0 {
+		t.Fatalf("vector calls = media:%v douban:%v", vectors.mediaIDs, vectors.ids)
+	}
+	if len(queue.jobs) != 2 || queue.jobs[0].SubjectKey != "42" || queue.jobs[1].SubjectKey != "9" || queue.jobs[1].TaskType != RefreshProviderMediaEmbedding {
+		t.Fatalf("chained jobs = %+v", queue.jobs)
+	}
+	if err := handler.Handle(t.Context(), workqueue.Job{TaskType: RefreshProviderTMDBImport, SubjectKey: "douban/1"}); !workqueue.IsTerminal(err) {
+		t.Fatalf("invalid import subject error = %v", err)
+	}
+}
+
+type recordingMediaSyncer struct {
+	synced     []int
+	imported   []MovieKey
+	importedID int
+}
+
+func (syncer *recordingMediaSyncer) SyncMedia(_ context.Context, mediaID int) error {
+	syncer.synced = append(syncer.synced, mediaID)
+	return nil
+}
+
+func (syncer *recordingMediaSyncer) ImportExternalMedia(_ context.Context, key MovieKey) (int, error) {
+	syncer.imported = append(syncer.imported, key)
+	return syncer.importedID, nil
+}
+
 type refreshQueueStub struct {
-	jobs      []workqueue.Job
-	needsTMDB bool
+	jobs         []workqueue.Job
+	needsTMDB    bool
+	needsBangumi bool
 }
 
 func (queue *refreshQueueStub) EnqueueRefresh(_ context.Context, doubanID, provider, reason string, requestedBy int) (int, error) {
@@ -51,3 +127,27 @@ func (queue *refreshQueueStub) EnqueueRefresh(_ context.Context, doubanID, provi
 func (queue *refreshQueueStub) NeedsTMDBRefresh(context.Context, string) (bool, error) {
 	return queue.needsTMDB, nil
 }
+
+func (queue *refreshQueueStub) NeedsBangumiRefresh(context.Context, string) (bool, error) {
+	return queue.needsBangumi, nil
+}
+
+func (queue *refreshQueueStub) EnqueueMediaJob(_ context.Context, mediaID int, provider, reason string, requestedBy int) (int, error) {
+	queue.jobs = append(queue.jobs, workqueue.Job{TaskType: provider, SubjectKey: strconv.Itoa(mediaID), Reason: reason, RequestedBy: requestedBy})
+	return len(queue.jobs), nil
+}
+
+func (queue *refreshQueueStub) EnqueueExternalImport(_ context.Context, key MovieKey, reason string, requestedBy int) (int, error) {
+	queue.jobs = append(queue.jobs, workqueue.Job{TaskType: RefreshProviderTMDBImport, SubjectKey: key.ImportSubject(), Reason: reason, RequestedBy: requestedBy})
+	return len(queue.jobs), nil
+}
+
+func (queue *refreshQueueStub) EnqueueImagePalette(ctx context.Context, mediaID int, reason string, requestedBy int) (int, error) {
+	return queue.EnqueueMediaJob(ctx, mediaID, RefreshProviderImagePalette, reason, requestedBy)
+}
+
+func (queue *refreshQueueStub) EnqueueDoubanImagePalette(_ context.Context, doubanID, reason string, requestedBy int) (int, error) {
+	// 测试里用豆瓣 ID 充当 subject，能看出是从哪条链路派生的就够了。
+	queue.jobs = append(queue.jobs, workqueue.Job{TaskType: RefreshProviderImagePalette, SubjectKey: "douban:" + doubanID, Reason: reason, RequestedBy: requestedBy})
+	return len(queue.jobs), nil
+}
@@ -154,6 +154,10 @@ func (provider *TMDBProvider) sync(ctx context.Context, doubanID string) error {
 		// migration 0013 不可用时，不能把一次成功的 TMDB 刷新变成用户可见失败。
 		return nil
 	}
+	if mediaID > 0 {
+		provider.syncCollection(ctx, mediaID, tmdbID, mediaType, targetSeason, details)
+		provider.syncTranslations(ctx, mediaID, tmdbID, mediaType, targetSeason, details)
+	}
 	// 电视剧还需要把季集元数据同步到 media_units。
 	if mediaType == "tv" && mediaID > 0 {
 		provider.syncTVSeasons(ctx, mediaID, tmdbID, targetSeason, details)
@@ -234,8 +238,16 @@ func (provider *TMDBProvider) fetchImages(ctx context.Context, tmdbID int, media
 }
 
 type tmdbDetailsResponse struct {
+	// Title/Name、PosterPath、Credits 等字段只有按 media.id 补主资料时才用得上：
+	// 有豆瓣条目的作品主资料以豆瓣为准，TMDB 只补剧照和季集。
+	Title           string  `json:"title"`
+	Name            string  `json:"name"`
+	OriginalName    string  `json:"original_name"`
+	PosterPath      string  `json:"poster_path"`
+	IMDbID          string  `json:"imdb_id"`
 	OriginalTitle   string  `json:"original_title"`
 	Overview        string  `json:"overview"`
+	Tagline         string  `json:"tagline"`
 	ReleaseDate     string  `json:"release_date"`
 	FirstAirDate    string  `json:"first_air_date"`
 	Runtime         int     `json:"runtime"`
@@ -260,6 +272,36 @@ type tmdbDetailsResponse struct {
 		Name         string `json:"name"`
 		AirDate      string `json:"air_date"`
 	} `json:"seasons"`
+	ProductionCountries []struct {
+		Name string `json:"name"`
+	} `json:"production_countries"`
+	OriginCountry []string     `json:"origin_country"`
+	CreatedBy     []tmdbPerson `json:"created_by"`
+	Credits       *struct {
+		Cast []tmdbPerson `json:"cast"`
+		Crew []tmdbPerson `json:"crew"`
+	} `json:"credits"`
+	ExternalIDs *struct {
+		IMDbID string `json:"imdb_id"`
+	} `json:"external_ids"`
+	// BelongsToCollection 只有电影才有，指向三部曲之类的合集。
+	BelongsToCollection *struct {
+		ID           int    `json:"id"`
+		Name         string `json:"name"`
+		PosterPath   string `json:"poster_path"`
+		BackdropPath string `json:"backdrop_path"`
+	} `json:"belongs_to_collection"`
+}
+
+// tmdbPerson 是演职员列表里的一个人；Job 只有 crew 才有，Character 和 Order 只有 cast 才有。
+type tmdbPerson struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	OriginalName string `json:"original_name"`
+	ProfilePath  string `json:"profile_path"`
+	Job          string `json:"job"`
+	Character    string `json:"character"`
+	Order        int    `json:"order"`
 }
 
 type tmdbEpisodeStub struct {
@@ -282,7 +324,12 @@ type tmdbSeasonResponse struct {
 
 // fetchDetails 抓详情（剧集状态、时长、季列表等）。
 func (provider *TMDBProvider) fetchDetails(ctx context.Context, tmdbID int, mediaType string) (*tmdbDetailsResponse, error) {
-	endpoint := fmt.Sprintf("%s/3/%s/%d?language=zh-CN", provider.tmdbBase, mediaType, tmdbID)
+	return provider.fetchLocalizedDetails(ctx, tmdbID, mediaType, "zh-CN")
+}
+
+// fetchLocalizedDetails 按指定语言抓详情，片名、简介和宣传语随 language 变化，其余字段不变。
+func (provider *TMDBProvider) fetchLocalizedDetails(ctx context.Context, tmdbID int, mediaType, language string) (*tmdbDetailsResponse, error) {
+	endpoint := fmt.Sprintf("%s/3/%s/%d?language=%s", provider.tmdbBase, mediaType, tmdbID, url.QueryEscape(language))
 	var response tmdbDetailsResponse
 	if err := provider.getJSON(ctx, endpoint, true, &response); err != nil {
 		return nil, err
@@ -0,0 +1,430 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/requestmeta"
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+// tmdbCastLimit 是从 TMDB 演员表里保留的人数，和豆瓣详情页的主演数量相当。
+const tmdbCastLimit = 10
+
+// MediaMetadataSyncer 按 media.id 补全主资料，并能从外部 ID 导入本地还没有的作品。
+// 豆瓣没有收录的作品（欧美剧、新番、新片）靠它获得标题、简介、类型和演职员。
+type MediaMetadataSyncer interface {
+	SyncMedia(ctx context.Context, mediaID int) error
+	ImportExternalMedia(ctx context.Context, key MovieKey) (int, error)
+}
+
+// ExternalMovieFinder 按外部 ID 查本地作品，没有时返回 (nil, nil)。
+type ExternalMovieFinder interface {
+	FindByExternalID(ctx context.Context, provider, externalType, externalID string) (*Movie, error)
+}
+
+// TMDBRefFinder 读取作品已绑定的 TMDB ID，没有绑定时返回 0。
+type TMDBRefFinder interface {
+	FindTMDBRef(ctx context.Context, mediaID int) (tmdbID int, externalType string, err error)
+}
+
+// SyncMedia 按 media.id 从 TMDB 补主资料，同一作品的并发调用会被合并。
+// TMDB ID 优先用已绑定的映射，没有时再经 IMDb ID 反查。
+func (provider *TMDBProvider) SyncMedia(ctx context.Context, mediaID int) error {
+	if provider.token == "" {
+		return workqueue.Terminal(fmt.Errorf("TMDB_API_TOKEN is not configured"))
+	}
+	if mediaID <= 0 {
+		return workqueue.Terminal(fmt.Errorf("invalid media ID %d", mediaID))
+	}
+	_, err, _ := provider.group.Do(fmt.Sprintf("m%d", mediaID), func() (any, error) {
+		return nil, provider.syncMedia(ctx, mediaID)
+	})
+	return err
+}
+
+// syncMedia 是 SyncMedia 的实际流程。
+func (provider *TMDBProvider) syncMedia(ctx context.Context, mediaID int) error {
+	merger, ok := provider.canonical.(CanonicalSourceWriter)
+	if !ok {
+		return workqueue.Terminal(fmt.Errorf("canonical media writer is not configured"))
+	}
+	movie, err := provider.store.FindByID(ctx, mediaID)
+	if err != nil {
+		return fmt.Errorf("find media for TMDB metadata: %w", err)
+	}
+	if movie == nil {
+		return workqueue.Terminal(fmt.Errorf("media not found: %d", mediaID))
+	}
+	tmdbID, externalType := 0, ""
+	if finder, ok := provider.store.(TMDBRefFinder); ok {
+		if tmdbID, externalType, err = finder.FindTMDBRef(ctx, mediaID); err != nil {
+			return err
+		}
+	}
+	mediaType := tmdbMediaType(externalType)
+	if tmdbID == 0 {
+		if movie.IMDbID == "" {
+			return workqueue.Terminal(fmt.Errorf("media %d has neither TMDB nor IMDb ID", mediaID))
+		}
+		tmdbID, mediaType, err = provider.findTMDBID(ctx, movie.IMDbID)
+		if errors.Is(err, errTMDBResultNotFound) {
+			return workqueue.Terminal(err)
+		}
+		if err != nil {
+			return err
+		}
+		externalType = mediaType
+	}
+	_, err = provider.mergeTMDBMetadata(ctx, merger, mediaID, tmdbID, mediaType, externalType, movie.IMDbID)
+	return err
+}
+
+// ImportExternalMedia 为 TMDB/IMDb ID 建立本地作品并返回 media.id。
+// 已经有作品绑定了这个 ID（或 TMDB 详情里的 IMDb ID）时直接复用，不会另起一行。
+func (provider *TMDBProvider) ImportExternalMedia(ctx context.Context, key MovieKey) (int, error) {
+	if provider.token == "" {
+		return 0, workqueue.Terminal(fmt.Errorf("TMDB_API_TOKEN is not configured"))
+	}
+	if key.Kind != MovieKeyExternal {
+		return 0, workqueue.Terminal(fmt.Errorf("invalid external media key %+v", key))
+	}
+	value, err, _ := provider.group.Do("import:"+key.ImportSubject(), func() (any, error) {
+		return provider.importExternal(ctx, key)
+	})
+	mediaID, _ := value.(int)
+	return mediaID, err
+}
+
+// importExternal 是 ImportExternalMedia 的实际流程。
+func (provider *TMDBProvider) importExternal(ctx context.Context, key MovieKey) (int, error) {
+	merger, ok := provider.canonical.(CanonicalSourceWriter)
+	if !ok {
+		return 0, workqueue.Terminal(fmt.Errorf("canonical media writer is not configured"))
+	}
+	if existing, err := provider.findExternal(ctx, key.Provider, key.ExternalType, key.ExternalID); err != nil || existing > 0 {
+		return existing, err
+	}
+	tmdbID, mediaType, imdbID := 0, key.ExternalType, ""
+	if key.Provider == "imdb" {
+		imdbID = key.ExternalID
+		var err error
+		tmdbID, mediaType, err = provider.findTMDBID(ctx, imdbID)
+		if errors.Is(err, errTMDBResultNotFound) {
+			return 0, workqueue.Terminal(err)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if existing, err := provider.findExternal(ctx, "tmdb", mediaType, strconv.Itoa(tmdbID)); err != nil || existing > 0 {
+			return existing, err
+		}
+	} else {
+		tmdbID, _ = strconv.Atoi(key.ExternalID)
+	}
+	return provider.mergeTMDBMetadata(ctx, merger, 0, tmdbID, mediaType, mediaType, imdbID)
+}
+
+// findExternal 查外部 ID 是否已绑定本地作品；存储层不支持时按「没有」处理。
+func (provider *TMDBProvider) findExternal(ctx context.Context, providerName, externalType, externalID string) (int, error) {
+	finder, ok := provider.store.(ExternalMovieFinder)
+	if !ok || externalID == "" {
+		return 0, nil
+	}
+	movie, err := finder.FindByExternalID(ctx, providerName, externalType, externalID)
+	if err != nil || movie == nil {
+		return 0, err
+	}
+	return movie.ID, nil
+}
+
+// mergeTMDBMetadata 抓详情（含演职员和外部 ID）与剧照，按 TMDB 的字段优先级合并进规范媒体。
+// mediaID 为 0 表示新建作品；此时若 TMDB 给出的 IMDb ID 已经绑在某部作品上，就合并进那一部。
+func (provider *TMDBProvider) mergeTMDBMetadata(ctx context.Context, merger CanonicalSourceWriter, mediaID, tmdbID int, mediaType, externalType, imdbID string) (int, error) {
+	details, err := provider.fetchMetadata(ctx, tmdbID, mediaType)
+	if err != nil {
+		if status, ok := upstreamStatus(err); ok && status == http.StatusNotFound {
+			return 0, workqueue.Terminal(fmt.Errorf("%w: %s %d", errTMDBResultNotFound, mediaType, tmdbID))
+		}
+		return 0, err
+	}
+	// 剧照只是附带结果，抓不到不影响主资料。
+	images, _ := provider.fetchImages(ctx, tmdbID, mediaType)
+	if imdbID == "" {
+		imdbID = details.IMDbID
+		if imdbID == "" && details.ExternalIDs != nil {
+			imdbID = details.ExternalIDs.IMDbID
+		}
+	}
+	if mediaID == 0 && imdbID != "" {
+		if mediaID, err = provider.findExternal(ctx, "imdb", "", imdbID); err != nil {
+			return 0, err
+		}
+	}
+	media := tmdbMedia(details, images, mediaType)
+	media.ID = mediaID
+	payload, err := json.Marshal(struct {
+		MediaID   int    `json:"media_id"`
+		IMDbID    string `json:"imdb_id"`
+		TMDBID    int    `json:"tmdb_id"`
+		MediaType string `json:"media_type"`
+		Images    any    `json:"images"`
+		Details   any    `json:"details"`
+	}{mediaID, imdbID, tmdbID, mediaType, images, details})
+	if err != nil {
+		return 0, err
+	}
+	merged, err := merger.MergeSource(ctx, "tmdb", media, payload,
+		mediaidentity.ExternalID{Provider: "tmdb", ExternalType: externalType, ExternalID: strconv.Itoa(tmdbID), IsPrimary: true},
+		mediaidentity.ExternalID{Provider: "imdb", ExternalType: externalType, ExternalID: imdbID, IsPrimary: true})
+	if err != nil {
+		return 0, fmt.Errorf("merge TMDB metadata: %w", err)
+	}
+	if writer, ok := provider.canonical.(mediaidentity.CreditWriter); ok {
+		if err := writer.ReplaceCredits(ctx, merged.ID, "tmdb", tmdbCredits(details)); err != nil {
+			return 0, fmt.Errorf("save TMDB credits: %w", err)
+		}
+	}
+	season, _ := strconv.Atoi(strings.TrimPrefix(externalType, "tv_season_"))
+	provider.syncCollection(ctx, merged.ID, tmdbID, mediaType, season, details)
+	provider.syncTranslations(ctx, merged.ID, tmdbID, mediaType, season, details)
+	if mediaType == "tv" {
+		provider.syncTVSeasons(ctx, merged.ID, tmdbID, season, details)
+	}
+	return merged.ID, nil
+}
+
+// fetchMetadata 抓详情，并用 append_to_response 一次带回演职员表和外部 ID。
+func (provider *TMDBProvider) fetchMetadata(ctx context.Context, tmdbID int, mediaType string) (*tmdbDetailsResponse, error) {
+	endpoint := fmt.Sprintf("%s/3/%s/%d?language=zh-CN&append_to_response=credits,external_ids", provider.tmdbBase, mediaType, tmdbID)
+	var response tmdbDetailsResponse
+	if err := provider.getJSON(ctx, endpoint, true, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// syncCollection 把作品挂进所属的系列或电影合集。合集只是导航用的附加数据，写失败只记日志。
+func (provider *TMDBProvider) syncCollection(ctx context.Context, mediaID, tmdbID int, mediaType string, season int, details *tmdbDetailsResponse) {
+	writer, ok := provider.canonical.(mediaidentity.CollectionWriter)
+	if !ok {
+		return
+	}
+	collection, item, ok := tmdbCollection(details, tmdbID, mediaType, season)
+	if !ok {
+		return
+	}
+	item.MediaID = mediaID
+	if err := writer.AddToCollection(ctx, collection, item); err != nil {
+		requestmeta.Logger(ctx).Warn("save TMDB collection failed", "media_id", mediaID, "tmdb_id", tmdbID, "error", err)
+	}
+}
+
+// tmdbTranslationLocales 把 TMDB 的 language 参数映射到站内语言。中文详情本来就抓过，
+// 只需另抓一次英文。
+var tmdbTranslationLocales = map[string]string{"en": "en-US"}
+
+// syncTranslations 把 TMDB 的多语言片名、简介和宣传语写进 media_translations。
+// 中文那份直接用已抓到的详情（主要是补宣传语，片名和简介仍以 media 表为准）；
+// 译文只是展示用的附加数据，抓取或写入失败只记日志。
+func (provider *TMDBProvider) syncTranslations(ctx context.Context, mediaID, tmdbID int, mediaType string, season int, details *tmdbDetailsResponse) {
+	writer, ok := provider.canonical.(mediaidentity.TranslationWriter)
+	if !ok || mediaID <= 0 {
+		return
+	}
+	save := func(locale string, localized *tmdbDetailsResponse) {
+		if err := writer.UpsertTranslation(ctx, tmdbTranslation(mediaID, locale, mediaType, season, localized)); err != nil {
+			requestmeta.Logger(ctx).Warn("save TMDB translation failed", "media_id", mediaID, "locale", locale, "error", err)
+		}
+	}
+	if details != nil {
+		save("zh-CN", details)
+	}
+	for locale, language := range tmdbTranslationLocales {
+		localized, err := provider.fetchLocalizedDetails(ctx, tmdbID, mediaType, language)
+		if err != nil {
+			requestmeta.Logger(ctx).Warn("fetch TMDB translation failed", "media_id", mediaID, "tmdb_id", tmdbID, "language", language, "error", err)
+			continue
+		}
+		save(locale, localized)
+	}
+}
+
+// tmdbTranslation 从某个语言的详情里取出译文。豆瓣按季拆开的条目在 TMDB 上对应整部剧：
+// 中文片名以豆瓣为准（本身带季号），其他语言补上季号，否则各季都叫同一个名字。
+func tmdbTranslation(mediaID int, locale, mediaType string, season int, details *tmdbDetailsResponse) mediaidentity.Translation {
+	title := details.Title
+	if mediaType == "tv" {
+		title = details.Name
+		if season > 0 && title != "" {
+			if locale == "zh-CN" {
+				title = ""
+			} else {
+				title = fmt.Sprintf("%s Season %d", title, season)
+			}
+		}
+	}
+	return mediaidentity.Translation{MediaID: mediaID, Locale: locale, Title: title, Summary: details.Overview,
+		Tagline: details.Tagline, Provider: "tmdb"}
+}
+
+// tmdbCollection 从详情里取出作品所属的合集：电影看 belongs_to_collection；
+// 剧集只有豆瓣那种按季拆开的条目（季号 > 0）才挂进系列，整部剧本身就是系列，不必再挂。
+func tmdbCollection(details *tmdbDetailsResponse, tmdbID int, mediaType string, season int) (mediaidentity.Collection, mediaidentity.CollectionItem, bool) {
+	if details == nil {
+		return mediaidentity.Collection{}, mediaidentity.CollectionItem{}, false
+	}
+	if mediaType == "tv" {
+		if season <= 0 || details.Name == "" {
+			return mediaidentity.Collection{}, mediaidentity.CollectionItem{}, false
+		}
+		collection := mediaidentity.Collection{Kind: mediaidentity.CollectionSeries, Provider: "tmdb",
+			ExternalID: strconv.Itoa(tmdbID), Name: details.Name, Overview: details.Overview,
+			Poster: tmdbImageURL("w500", details.PosterPath)}
+		item := mediaidentity.CollectionItem{SeasonNumber: season}
+		for _, candidate := range details.Seasons {
+			if candidate.SeasonNumber == season {
+				item.ReleaseDate, _ = parseDate(candidate.AirDate)
+			}
+		}
+		return collection, item, true
+	}
+	belongs := details.BelongsToCollection
+	if belongs == nil || belongs.ID <= 0 || belongs.Name == "" {
+		return mediaidentity.Collection{}, mediaidentity.CollectionItem{}, false
+	}
+	collection := mediaidentity.Collection{Kind: mediaidentity.CollectionMovie, Provider: "tmdb",
+		ExternalID: strconv.Itoa(belongs.ID), Name: belongs.Name,
+		Poster: tmdbImageURL("w500", belongs.PosterPath), Backdrop: tmdbImageURL("w1280", belongs.BackdropPath)}
+	item := mediaidentity.CollectionItem{}
+	item.ReleaseDate, _ = parseDate(details.ReleaseDate)
+	return collection, item, true
+}
+
+// tmdbImageURL 拼 TMDB 图片地址，没有路径时返回空串。
+func tmdbImageURL(size, path string) string {
+	if path == "" {
+		return ""
+	}
+	return "https://image.tmdb.org/t/p/" + size + path
+}
+
+// tmdbMediaType 从 TMDB 外部 ID 的命名空间推出接口路径里的类型（tv_season_N 也是剧集）。
+func tmdbMediaType(externalType string) string {
+	if strings.HasPrefix(externalType, "tv") {
+		return "tv"
+	}
+	return "movie"
+}
+
+// tmdbMedia 把 TMDB 详情转换成规范媒体字段。导演和演员沿用豆瓣的 JSON 结构，
+// ID 带 tmdb- 前缀，和豆瓣影人 ID 区分开。
+func tmdbMedia(details *tmdbDetailsResponse, images *tmdbImagesResponse, mediaType string) mediaidentity.Media {
+	movie := Movie{}
+	applyTMDBData(&movie, images, details)
+	media := mediaidentity.Media{
+		MediaType: mediaType, Title: details.Title, OriginalTitle: details.OriginalTitle,
+		Year: movie.Year, Backdrops: movie.Backdrops, Summary: details.Overview,
+		Duration: movie.Duration, RatingTMDB: details.VoteAverage, VoteCountTMDB: details.VoteCount,
+		MetadataStatus: "partial",
+	}
+	if media.Title == "" {
+		media.Title = details.Name
+	}
+	if media.OriginalTitle == "" {
+		media.OriginalTitle = details.OriginalName
+	}
+	media.Poster = movie.Poster
+	if details.PosterPath != "" {
+		media.Poster = "https://image.tmdb.org/t/p/w500" + details.PosterPath
+	}
+	genres := make([]string, 0, len(details.Genres))
+	for _, genre := range details.Genres {
+		genres = append(genres, genre.Name)
+	}
+	media.Genres = strings.Join(genres, ",")
+	countries := make([]string, 0, len(details.ProductionCountries))
+	for _, country := range details.ProductionCountries {
+		countries = append(countries, country.Name)
+	}
+	if len(countries) == 0 {
+		countries = details.OriginCountry
+	}
+	media.Countries = strings.Join(countries, ",")
+	directors, cast := tmdbCrew(details)
+	media.Directors, media.Actors = tmdbPeopleJSON(directors), tmdbPeopleJSON(cast)
+	// 电影的 status 是 Released 之类的发行状态，不是连载状态。
+	if mediaType == "tv" {
+		media.SeriesStatus = movie.SeriesStatus
+	}
+	return media
+}
+
+// tmdbCrew 取出导演（剧集的主创也算）和前 tmdbCastLimit 位演员。
+func tmdbCrew(details *tmdbDetailsResponse) (directors, cast []tmdbPerson) {
+	directors = slices.Clone(details.CreatedBy)
+	if details.Credits != nil {
+		for _, member := range details.Credits.Crew {
+			if member.Job == "Director" {
+				directors = append(directors, member)
+			}
+		}
+		cast = details.Credits.Cast
+	}
+	if len(cast) > tmdbCastLimit {
+		cast = cast[:tmdbCastLimit]
+	}
+	return directors, cast
+}
+
+// tmdbCredits 把演职员转成 media_credits 的写入结构，和 media.directors / actors 取同一批人。
+func tmdbCredits(details *tmdbDetailsResponse) []mediaidentity.Credit {
+	directors, cast := tmdbCrew(details)
+	credits := make([]mediaidentity.Credit, 0, len(directors)+len(cast))
+	for _, group := range []struct {
+		role   string
+		people []tmdbPerson
+	}{{mediaidentity.CreditDirector, directors}, {mediaidentity.CreditActor, cast}} {
+		seen := make(map[int]bool, len(group.people))
+		for index, person := range group.people {
+			if person.ID <= 0 || seen[person.ID] {
+				continue
+			}
+			seen[person.ID] = true
+			avatar := ""
+			if person.ProfilePath != "" {
+				avatar = "https://image.tmdb.org/t/p/w185" + person.ProfilePath
+			}
+			credits = append(credits, mediaidentity.Credit{Role: group.role, Character: person.Character, Order: index,
+				Person: mediaidentity.Person{TMDBID: strconv.Itoa(person.ID), Name: person.Name,
+					OriginalName: person.OriginalName, Avatar: avatar}})
+		}
+	}
+	return credits
+}
+
+// tmdbPeopleJSON 把演职员转成 []Director 的 JSON，同一个人只保留一次；没有人时返回空串，
+// 这样合并时不会用空数组占住字段。
+func tmdbPeopleJSON(people []tmdbPerson) string {
+	result := make([]Director, 0, len(people))
+	seen := make(map[int]bool, len(people))
+	for _, person := range people {
+		if person.ID <= 0 || person.Name == "" || seen[person.ID] {
+			continue
+		}
+		seen[person.ID] = true
+		result = append(result, Director{ID: "tmdb-" + strconv.Itoa(person.ID), Name: person.Name})
+	}
+	if len(result) == 0 {
+		return ""
+	}
+	encoded, _ := json.Marshal(result)
+	return string(encoded)
+}
@@ -193,3 +193,115 @@ func assertTMDBBearer(t *testing.T, request *http.Request) {
 		t.Fatalf("Authorization = %q", request.Header.Get("Authorization"))
 	}
 }
+
+func TestTMDBMediaMapsCreditsCountriesAndTVStatus(t *testing.T) {
+	details := &tmdbDetailsResponse{
+		Name: "权力的游戏", OriginalName: "Game of Thrones", Overview: "简介", PosterPath: "/p.jpg",
+		OriginCountry: []string{"US"}, CreatedBy: []tmdbPerson{{ID: 9813, Name: "David Benioff"}},
+		Credits: &struct {
+			Cast []tmdbPerson `json:"cast"`
+			Crew []tmdbPerson `json:"crew"`
+		}{
+			Cast: []tmdbPerson{{ID: 22970, Name: "Peter Dinklage"}, {ID: 22970, Name: "Peter Dinklage"}},
+			Crew: []tmdbPerson{{ID: 9813, Name: "David Benioff", Job: "Director"}, {ID: 1, Name: "Editor", Job: "Editor"}},
+		},
+	}
+	details.Genres = append(details.Genres, struct {
+		Name string `json:"name"`
+	}{Name: "剧情"})
+	media := tmdbMedia(details, nil, "tv")
+	if media.Title != "权力的游戏" || media.OriginalTitle != "Game of Thrones" || media.Poster != "https://image.tmdb.org/t/p/w500/p.jpg" {
+		t.Fatalf("titles/poster = %+v", media)
+	}
+	if media.Countries != "US" || media.Genres != "剧情" || media.MetadataStatus != "partial" {
+		t.Fatalf("countries/genres/status = %q/%q/%q", media.Countries, media.Genres, media.MetadataStatus)
+	}
+	if media.Directors != `[{"id":"tmdb-9813","name":"David Benioff"}]` || media.Actors != `[{"id":"tmdb-22970","name":"Peter Dinklage"}]` {
+		t.Fatalf("people = %s / %s", media.Directors, media.Actors)
+	}
+	details.Credits.Cast[0].Character, details.Credits.Cast[0].ProfilePath = "Tyrion Lannister", "/tyrion.jpg"
+	credits := tmdbCredits(details)
+	if len(credits) != 2 || credits[0].Role != mediaidentity.CreditDirector || credits[0].Person.TMDBID != "9813" {
+		t.Fatalf("credits = %+v", credits)
+	}
+	if actor := credits[1]; actor.Role != mediaidentity.CreditActor || actor.Character != "Tyrion Lannister" ||
+		actor.Person.Avatar != "https://image.tmdb.org/t/p/w185/tyrion.jpg" {
+		t.Fatalf("actor credit = %+v", actor)
+	}
+	if movie := tmdbMedia(&tmdbDetailsResponse{Title: "电影"}, nil, "movie"); movie.Directors != "" || movie.SeriesStatus != "" {
+		t.Fatalf("empty credits = %+v", movie)
+	}
+}
+
+func TestTMDBCollectionLinksSeasonSubjectsAndMovieCollections(t *testing.T) {
+	series := &tmdbDetailsResponse{Name: "末日地堡", Overview: "简介", PosterPath: "/silo.jpg"}
+	series.Seasons = append(series.Seasons, struct {
+		SeasonNumber int    `json:"season_number"`
+		EpisodeCount int    `json:"episode_count"`
+		Name         string `json:"name"`
+		AirDate      string `json:"air_date"`
+	}{SeasonNumber: 2, AirDate: "2024-11-15"})
+	collection, item, ok := tmdbCollection(series, 125988, "tv", 2)
+	if !ok || collection.Kind != mediaidentity.CollectionSeries || collection.ExternalID != "125988" || collection.Name != "末日地堡" ||
+		collection.Poster != "https://image.tmdb.org/t/p/w500/silo.jpg" {
+		t.Fatalf("series collection = %+v, %v", collection, ok)
+	}
+	if item.SeasonNumber != 2 || item.ReleaseDate.Format("2006-01-02") != "2024-11-15" {
+		t.Fatalf("season item = %+v", item)
+	}
+	if _, _, ok := tmdbCollection(series, 125988, "tv", 0); ok {
+		t.Fatal("whole-show record should not join its own series")
+	}
+
+	movie := &tmdbDetailsResponse{Title: "黑客帝国2：重装上阵", ReleaseDate: "2003-05-15"}
+	if _, _, ok := tmdbCollection(movie, 604, "movie", 0); ok {
+		t.Fatal("movie without belongs_to_collection joined a collection")
+	}
+	movie.BelongsToCollection = &struct {
+		ID           int    `json:"id"`
+		Name         string `json:"name"`
+		PosterPath   string `json:"poster_path"`
+		BackdropPath string `json:"backdrop_path"`
+	}{ID: 2344, Name: "黑客帝国（系列）", BackdropPath: "/matrix.jpg"}
+	collection, item, ok = tmdbCollection(movie, 604, "movie", 0)
+	if !ok || collection.Kind != mediaidentity.CollectionMovie || collection.ExternalID != "2344" || collection.Poster != "" ||
+		collection.Backdrop != "https://image.tmdb.org/t/p/w1280/matrix.jpg" || item.ReleaseDate.Year() != 2003 {
+		t.Fatalf("movie collection = %+v / %+v, %v", collection, item, ok)
+	}
+}
+
+// translationWriterStub 在规范写入之外记录多语言资料。
+type translationWriterStub struct {
+	canonicalWriterStub
+	translations []mediaidentity.Translation
+}
+
+func (writer *translationWriterStub) UpsertTranslation(_ context.Context, translation mediaidentity.Translation) error {
+	writer.translations = append(writer.translations, translation)
+	return nil
+}
+
+func TestTMDBTranslationsStoreEnglishTitlesWithSeasonNumbers(t *testing.T) {
+	var languages []string
+	client := &http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		languages = append(languages, request.URL.Query().Get("language"))
+		if request.URL.Path != "/3/tv/125988" || request.URL.Query().Get("language") != "en-US" {
+			return testJSONResponse(request, http.StatusNotFound, `{}`), nil
+		}
+		return testJSONResponse(request, http.StatusOK, `{"name":"Silo","overview":"In a ruined and toxic future...","tagline":"Truth lies outside."}`), nil
+	})}
+	writer := &translationWriterStub{}
+	provider := NewTMDBProvider(client, nil, "tmdb-token", WithTMDBBase("https://tmdb.test"), WithTMDBCanonicalWriter(writer))
+	provider.syncTranslations(t.Context(), 7, 125988, "tv", 2, &tmdbDetailsResponse{Name: "末日地堡", Overview: "在一个被毁坏的未来……", Tagline: "真相在地堡之外。"})
+	if len(languages) != 1 || languages[0] != "en-US" || len(writer.translations) != 2 {
+		t.Fatalf("languages = %v, translations = %+v", languages, writer.translations)
+	}
+	// 中文片名以豆瓣为准（已带季号），只补简介和宣传语；英文片名补上季号。
+	chinese, english := writer.translations[0], writer.translations[1]
+	if chinese.Locale != "zh-CN" || chinese.Title != "" || chinese.Tagline != "真相在地堡之外。" || chinese.MediaID != 7 {
+		t.Fatalf("zh-CN translation = %+v", chinese)
+	}
+	if english.Locale != "en" || english.Title != "Silo Season 2" || english.Summary != "In a ruined and toxic future..." || english.Provider != "tmdb" {
+		t.Fatalf("en translation = %+v", english)
+	}
+}
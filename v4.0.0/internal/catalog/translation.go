@@ -0,0 +1,45 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/requestmeta"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+)
+
+// MovieTranslation 是详情页按当前语言展示的片名、简介和宣传语。
+// 片名和简介缺译文时退回 media 表里的中文资料；宣传语只显示当前语言自己的。
+type MovieTranslation struct {
+	Locale  string
+	Title   string
+	Summary string
+	Tagline string
+}
+
+// movieTranslation 读取当前语言的译文。读取失败只记日志，按中文资料展示。
+func (handler *Handler) movieTranslation(ctx context.Context, movie *Movie, locale string) MovieTranslation {
+	view := MovieTranslation{Locale: locale, Title: movie.Title, Summary: movie.Summary}
+	if handler.translations == nil || movie.ID <= 0 {
+		return view
+	}
+	translation, err := handler.translations.FindTranslation(ctx, movie.ID, locale)
+	if err != nil {
+		requestmeta.Logger(ctx).Warn("load media translation failed", "media_id", movie.ID, "locale", locale, "error", err)
+		return view
+	}
+	if translation == nil {
+		return view
+	}
+	view.Tagline = translation.Tagline
+	// 默认语言的片名和简介以 media 表为准（豆瓣优先），译文表里那份只用来补宣传语。
+	if locale == platformweb.DefaultLocale {
+		return view
+	}
+	if translation.Title != "" {
+		view.Title = translation.Title
+	}
+	if translation.Summary != "" {
+		view.Summary = translation.Summary
+	}
+	return view
+}
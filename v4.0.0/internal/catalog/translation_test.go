@@ -0,0 +1,34 @@
+package catalog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+)
+
+type translationReaderStub map[string]*mediaidentity.Translation
+
+func (reader translationReaderStub) FindTranslation(_ context.Context, _ int, locale string) (*mediaidentity.Translation, error) {
+	return reader[locale], nil
+}
+
+func TestMovieTranslationKeepsDefaultLocaleMetadataAuthoritative(t *testing.T) {
+	handler := &Handler{translations: translationReaderStub{
+		"zh-CN": {Title: "肖申克的救赎（TMDB）", Summary: "TMDB 中文简介", Tagline: "恐惧让你沦为囚犯，希望让你重获自由。"},
+		"en":    {Title: "The Shawshank Redemption", Tagline: "Fear can hold you prisoner. Hope can set you free."},
+	}}
+	movie := &Movie{ID: 7, Title: "肖申克的救赎", Summary: "豆瓣简介"}
+	chinese := handler.movieTranslation(t.Context(), movie, "zh-CN")
+	if chinese.Title != "肖申克的救赎" || chinese.Summary != "豆瓣简介" || chinese.Tagline != "恐惧让你沦为囚犯，希望让你重获自由。" {
+		t.Fatalf("zh-CN view = %+v", chinese)
+	}
+	// 英文缺简介时退回中文简介，宣传语不跨语言借用。
+	english := handler.movieTranslation(t.Context(), movie, "en")
+	if english.Title != "The Shawshank Redemption" || english.Summary != "豆瓣简介" || english.Tagline != "Fear can hold you prisoner. Hope can set you free." {
+		t.Fatalf("en view = %+v", english)
+	}
+	if plain := (&Handler{}).movieTranslation(t.Context(), movie, "en"); plain.Title != "肖申克的救赎" || plain.Tagline != "" {
+		t.Fatalf("view without translations = %+v", plain)
+	}
+}
@@ -92,7 +92,10 @@ func TestRobotsAndVerificationBodiesMatchLegacy(t *testing.T) {
 }
 
 func TestSitemapPreservesStaticAndDynamicURLs(t *testing.T) {
-	provider := &fakeSitemapProvider{movies: []SitemapMovie{{DoubanID: "1292052", UpdatedAt: time.Date(2026, time.July, 29, 9, 0, 0, 0, time.UTC)}}}
+	provider := &fakeSitemapProvider{movies: []SitemapMovie{
+		{DoubanID: "1292052", UpdatedAt: time.Date(2026, time.July, 29, 9, 0, 0, 0, time.UTC)},
+		{MediaID: 42, UpdatedAt: time.Date(2026, time.July, 28, 9, 0, 0, 0, time.UTC)},
+	}}
 	app := newTestApp(t, provider)
 	body := getBody(t, app.client, app.baseURL+"/sitemap.xml")
 
@@ -102,11 +105,19 @@ func TestSitemapPreservesStaticAndDynamicURLs(t *testing.T) {
 		"<loc>https://moovie.example/movie/1292052</loc>",
 		"<loc>https://moovie.example/similar/1292052</loc>",
 		"<lastmod>2026-07-29</lastmod>",
+		"<loc>https://moovie.example/movie/m42</loc>",
+		`xmlns:xhtml="http://www.w3.org/1999/xhtml"`,
+		`<xhtml:link rel="alternate" hreflang="zh-CN" href="https://moovie.example/movie/1292052"></xhtml:link>`,
+		`<xhtml:link rel="alternate" hreflang="en" href="https://moovie.example/movie/1292052?lang=en"></xhtml:link>`,
+		`<xhtml:link rel="alternate" hreflang="x-default" href="https://moovie.example/movie/1292052"></xhtml:link>`,
 	} {
 		if !strings.Contains(body, expected) {
 			t.Fatalf("sitemap missing %q", expected)
 		}
 	}
+	if strings.Contains(body, "/similar/m42") || strings.Contains(body, "/similar/</loc>") {
+		t.Fatalf("sitemap listed a similar page for media without a Douban ID: %s", body)
+	}
 	if provider.limit != sitemapMovieLimit {
 		t.Fatalf("provider limit = %d, want %d", provider.limit, sitemapMovieLimit)
 	}
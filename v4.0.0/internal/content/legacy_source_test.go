@@ -19,14 +19,29 @@ func TestTemplateInventoryMatchesLegacySource(t *testing.T) {
 		legacyFiles := relativeFiles(t, filepath.Join(legacyRoot, directory))
 		if directory == "pages" {
 			legacyFiles = removeStrings(legacyFiles, "square.html")
-			legacyFiles = append(legacyFiles, "admin_jobs.html", "admin_matches.html", "watch.html")
+			legacyFiles = append(legacyFiles, "admin_jobs.html", "admin_matches.html", "admin_playback_qoe.html", "watch.html")
 			legacyFiles = append(legacyFiles, "cinema.html")
+			// 人物页和合集页是新系统独有的，旧站没有演职员和合集实体。
+			legacyFiles = append(legacyFiles, "person.html", "collection.html")
+			// 元数据编辑器依赖字段来源和变更历史，旧站后台没有对应页面。
+			legacyFiles = append(legacyFiles, "admin_media.html")
+			// 重复作品复核依赖统一作品身份，旧站每个豆瓣 ID 就是一部片，没有合并的概念。
+			legacyFiles = append(legacyFiles, "admin_duplicates.html")
+			// 「今晚看什么」按多人的片单和口味向量挑片，旧站推荐只看单个用户。
+			legacyFiles = append(legacyFiles, "together.html")
+			// 通知中心是新系统独有的，旧站没有站内通知。
+			legacyFiles = append(legacyFiles, "notifications.html")
 			sort.Strings(legacyFiles)
 		} else if directory == "partials" {
 			legacyFiles = removeStrings(legacyFiles, "search_results.html", "douban_card.html", "square_activity.html", "square_grid.html", "square_leaderboard.html")
 			legacyFiles = append(legacyFiles, "unified_search_results.html")
 			// 追剧更新时间是新系统独有能力，旧站没有对应 partial 可比对。
 			legacyFiles = append(legacyFiles, "air_schedule.html", "today_updates.html")
+			legacyFiles = append(legacyFiles, "together_results.html")
+			// 每周「本周上新」摘要由 Worker 生成，旧站没有。
+			legacyFiles = append(legacyFiles, "dashboard_digest.html")
+			// 导航栏的未读通知角标，同上。
+			legacyFiles = append(legacyFiles, "notification_badge.html")
 			// play_* 这四个是从 play.html / watch.html 里抽出来的公共片段（批次 2）。
 			// 旧站把这些内容各写了一遍在两个页面里，没有独立文件可比对。
 			legacyFiles = append(legacyFiles, "play_container.html", "play_scripts.html",
@@ -217,6 +232,9 @@ var reviewedHTMXLoadingFiles = map[string]bool{
 	"pages/admin_copyright.html":                 true,
 	"pages/admin_category.html":                  true,
 	"pages/admin_jobs.html":                      true,
+	"pages/admin_playback_qoe.html":              true,
+	"pages/admin_media.html":                     true,
+	"pages/admin_duplicates.html":                true,
 	"pages/advertise.html":                       true,
 	"pages/iptv.html":                            true,
 	"static/css/style.css":                       true,
@@ -302,14 +320,31 @@ func isReviewedHTMXLoadingFile(relativePath string) bool {
 // play.html 和 watch.html 里抽出来的共用片段（批次 2），旧站是在两个页面里各抄一份的。
 // 抽出来之后两边渲染出的 HTML 不变，由 playback 包的
 // TestPlayerPagesShareTheSamePlayerAndLazySections 把关。
+// movie / fetching / similar_movies / similar_movies_with_reasons / foryou 系列是为没有豆瓣条目的作品改的：
+// 站内链接统一走 DetailKey，外部 ID 入口的过渡页显示来源 ID；movie 的导演和主演另外链到人物页。
+// person / collection 是新增的人物页和合集页，旧站没有对应文件；movie 的季度导航也改由合集驱动。
 var reviewedTemplateDrift = map[string]bool{
-	"pages/changelog.html":         true,
-	"partials/air_schedule.html":   true,
-	"partials/today_updates.html":  true,
-	"partials/play_container.html": true,
-	"partials/play_scripts.html":   true,
-	"partials/play_comments.html":  true,
-	"partials/play_similar.html":   true,
+	"pages/changelog.html":                      true,
+	"partials/air_schedule.html":                true,
+	"partials/today_updates.html":               true,
+	"partials/play_container.html":              true,
+	"partials/play_scripts.html":                true,
+	"partials/play_comments.html":               true,
+	"partials/play_similar.html":                true,
+	"pages/player_embed.html":                   true,
+	"pages/movie.html":                          true,
+	"pages/fetching.html":                       true,
+	"partials/similar_movies.html":              true,
+	"partials/similar_movies_with_reasons.html": true,
+	"partials/foryou_movies.html":               true,
+	"partials/foryou_movies_grid.html":          true,
+	"pages/person.html":                         true,
+	"pages/collection.html":                     true,
+	"pages/together.html":                       true,
+	"partials/together_results.html":            true,
+	"partials/dashboard_digest.html":            true,
+	"pages/notifications.html":                  true,
+	"partials/notification_badge.html":          true,
 }
 
 func isReviewedTemplateDrift(relativePath string) bool {
@@ -425,13 +460,17 @@ func TestLayoutDiffIsLimitedToReviewedRuntimeExtensionPoints(t *testing.T) {
 	newLayout := string(readFile(t, filepath.Join("..", "..", "web", "templates", "layouts", "base.html")))
 	legacyLayout := string(readFile(t, filepath.Join("..", "..", "..", "web", "templates", "layouts", "base.html")))
 
-	normalized := strings.Replace(newLayout,
+	normalized := normalizeReviewedLayoutLocalisation(newLayout)
+	normalized = strings.Replace(normalized,
 		`<meta name="robots" content="{{ if .Robots }}{{ .Robots }}{{ else }}index, follow{{ end }}">`,
 		`<meta name="robots" content="index, follow">`, 1)
 	normalized = strings.Replace(normalized,
 		`    {{ range .JSONLD }}<script type="application/ld+json">{{ . }}</script>{{ end }}
 `, "", 1)
 	normalized = stripMarkedBlock(normalized, "    <!-- csrf-runtime:start -->", "    <!-- csrf-runtime:end -->")
+	// 通知中心的入口和未读角标是新系统独有的，旧站没有通知。
+	normalized = stripMarkedBlock(normalized, "                <!-- notification-center:start -->", "                <!-- notification-center:end -->")
+	normalized = stripMarkedBlock(normalized, "                    <!-- notification-bell:start -->", "                    <!-- notification-bell:end -->")
 	normalized = strings.Replace(normalized,
 		`<body hx-ext="preload" data-user-id="{{ if .UserInfo }}{{ .UserInfo.ID }}{{ end }}">`,
 		`<body hx-ext="preload">`, 1)
@@ -454,6 +493,17 @@ func TestLayoutDiffIsLimitedToReviewedRuntimeExtensionPoints(t *testing.T) {
 	}
 }
 
+// reviewedTranslationCall 匹配 base.html 里的界面翻译调用，还原回旧站的中文原文后再比对。
+var reviewedTranslationCall = regexp.MustCompile(`\{\{ t \.Locale "([^"]+)" \}\}`)
+
+// normalizeReviewedLayoutLocalisation 去掉多语言改动：lang 属性、hreflang、语言切换和文案翻译调用。
+func normalizeReviewedLayoutLocalisation(layout string) string {
+	layout = strings.Replace(layout, `<html lang="{{ .Locale | default "zh-CN" }}">`, `<html lang="zh-CN">`, 1)
+	layout = stripMarkedBlock(layout, "    <!-- locale-alternates:start -->", "    <!-- locale-alternates:end -->")
+	layout = stripMarkedBlock(layout, "                    <!-- locale-switch:start -->", "                    <!-- locale-switch:end -->")
+	return reviewedTranslationCall.ReplaceAllString(layout, "$1")
+}
+
 func normalizeReviewedLayoutAccessibility(layout string) string {
 	replacements := [][2]string{
 		{
@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
 )
 
 // sitemapMovieLimit 限制进 sitemap 的影片数量。
 const sitemapMovieLimit = 1000
 
-// SitemapMovie 是 sitemap 需要的影片信息。
+// SitemapMovie 是 sitemap 需要的影片信息。没有豆瓣 ID 的作品用 MediaID 拼 /movie/m<id>。
 type SitemapMovie struct {
+	MediaID   int
 	DoubanID  string
 	UpdatedAt time.Time
 }
@@ -22,19 +25,41 @@ type SitemapMovieProvider interface {
 	LatestForSitemap(ctx context.Context, limit int) ([]SitemapMovie, error)
 }
 
-// sitemapURL 是 sitemap 中的一条 URL。
+// sitemapURL 是 sitemap 中的一条 URL，附带各语言版本的 hreflang 链接。
 type sitemapURL struct {
-	Location   string `xml:"loc"`
-	LastMod    string `xml:"lastmod,omitempty"`
-	ChangeFreq string `xml:"changefreq"`
-	Priority   string `xml:"priority"`
+	Location   string                `xml:"loc"`
+	LastMod    string                `xml:"lastmod,omitempty"`
+	ChangeFreq string                `xml:"changefreq"`
+	Priority   string                `xml:"priority"`
+	Alternates []sitemapAlternateURL `xml:"xhtml:link"`
+}
+
+// sitemapAlternateURL 是 <xhtml:link rel="alternate" hreflang="..."> 节点。
+type sitemapAlternateURL struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
 }
 
 // sitemapDocument 是 sitemap 的 XML 根节点。
 type sitemapDocument struct {
-	XMLName xml.Name     `xml:"urlset"`
-	XMLNS   string       `xml:"xmlns,attr"`
-	URLs    []sitemapURL `xml:"url"`
+	XMLName    xml.Name     `xml:"urlset"`
+	XMLNS      string       `xml:"xmlns,attr"`
+	XMLNSXHTML string       `xml:"xmlns:xhtml,attr"`
+	URLs       []sitemapURL `xml:"url"`
+}
+
+// newSitemapURL 生成一条 URL 及其语言版本，链接规则和页面 head 里的 hreflang 一致。
+func newSitemapURL(siteURL, path, lastModified, frequency, priority string) sitemapURL {
+	alternates := platformweb.Alternates(siteURL, path)
+	entry := sitemapURL{
+		Location: platformweb.CanonicalURL(siteURL, path), LastMod: lastModified, ChangeFreq: frequency, Priority: priority,
+		Alternates: make([]sitemapAlternateURL, 0, len(alternates)),
+	}
+	for _, alternate := range alternates {
+		entry.Alternates = append(entry.Alternates, sitemapAlternateURL{Rel: "alternate", Hreflang: alternate.Hreflang, Href: alternate.Href})
+	}
+	return entry
 }
 
 // staticSitemapPages 是固定收录的页面及其权重。
@@ -57,20 +82,17 @@ var staticSitemapPages = []struct {
 	{path: "/terms", priority: "0.5", frequency: "monthly"},
 }
 
-// buildSitemap 生成 sitemap：固定页面 + 最近更新的影片详情页和相似推荐页。
+// buildSitemap 生成 sitemap：固定页面 + 最近更新的影片详情页和相似推荐页，每条都带 hreflang。
 // 取影片失败时只返回固定页面，不让整个 sitemap 挂掉。
 func buildSitemap(ctx context.Context, siteURL string, provider SitemapMovieProvider) ([]byte, error) {
 	baseURL := strings.TrimRight(siteURL, "/")
 	document := sitemapDocument{
-		XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9",
-		URLs:  make([]sitemapURL, 0, len(staticSitemapPages)),
+		XMLNS:      "http://www.sitemaps.org/schemas/sitemap/0.9",
+		XMLNSXHTML: "http://www.w3.org/1999/xhtml",
+		URLs:       make([]sitemapURL, 0, len(staticSitemapPages)),
 	}
 	for _, page := range staticSitemapPages {
-		document.URLs = append(document.URLs, sitemapURL{
-			Location:   baseURL + page.path,
-			ChangeFreq: page.frequency,
-			Priority:   page.priority,
-		})
+		document.URLs = append(document.URLs, newSitemapURL(baseURL, page.path, "", page.frequency, page.priority))
 	}
 
 	if provider != nil {
@@ -78,9 +100,17 @@ func buildSitemap(ctx context.Context, siteURL string, provider SitemapMovieProv
 		if err == nil {
 			for _, movie := range movies {
 				lastModified := movie.UpdatedAt.Format("2006-01-02")
+				if movie.DoubanID == "" {
+					// 相似推荐页仍以豆瓣 ID 为入口，这类作品只收录详情页。
+					if movie.MediaID > 0 {
+						document.URLs = append(document.URLs,
+							newSitemapURL(baseURL, fmt.Sprintf("/movie/m%d", movie.MediaID), lastModified, "weekly", "0.7"))
+					}
+					continue
+				}
 				document.URLs = append(document.URLs,
-					sitemapURL{Location: fmt.Sprintf("%s/movie/%s", baseURL, movie.DoubanID), LastMod: lastModified, ChangeFreq: "weekly", Priority: "0.7"},
-					sitemapURL{Location: fmt.Sprintf("%s/similar/%s", baseURL, movie.DoubanID), LastMod: lastModified, ChangeFreq: "weekly", Priority: "0.6"},
+					newSitemapURL(baseURL, "/movie/"+movie.DoubanID, lastModified, "weekly", "0.7"),
+					newSitemapURL(baseURL, "/similar/"+movie.DoubanID, lastModified, "weekly", "0.6"),
 				)
 			}
 		}
@@ -56,6 +56,8 @@ var RequestInputs = []RequestInput{
 	{Method: "POST", Path: "/dashboard/settings/share", Name: "is_public", Location: InputForm},
 	{Method: "POST", Path: "/dashboard/settings/avatar", Name: "avatar", Location: InputForm},
 	{Method: "POST", Path: "/dashboard/settings/douban/bind", Name: "douban_user_id", Location: InputForm},
+	{Method: "GET", Path: "/dashboard/notifications", Name: "success", Location: InputQuery},
+	{Method: "POST", Path: "/dashboard/notifications/preferences", Name: "enabled", Location: InputForm},
 
 	{Method: "GET", Path: "/api/vod", Name: "ac", Location: InputQuery},
 	{Method: "GET", Path: "/api/vod", Name: "ids", Location: InputQuery},
@@ -126,6 +128,7 @@ var RequestInputs = []RequestInput{
 	{Method: "GET", Path: "/api/htmx/similar", Name: "douban_id", Location: InputQuery},
 	{Method: "GET", Path: "/api/htmx/similar", Name: "id", Location: InputQuery},
 	{Method: "GET", Path: "/api/htmx/foryou", Name: "page", Location: InputQuery, Default: "1"},
+	{Method: "GET", Path: "/api/htmx/together", Name: "members", Location: InputQuery},
 	{Method: "GET", Path: "/api/htmx/reviews", Name: "douban_id", Location: InputQuery},
 	{Method: "GET", Path: "/api/htmx/movie-comments", Name: "douban_id", Location: InputQuery},
 	{Method: "POST", Path: "/api/comments/:id/replies", Name: "content", Location: InputForm},
@@ -159,6 +162,24 @@ var RequestInputs = []RequestInput{
 	{Method: "POST", Path: "/api/danmaku", Name: "time", Location: InputJSON},
 	{Method: "POST", Path: "/api/danmaku", Name: "mode", Location: InputJSON},
 	{Method: "POST", Path: "/api/danmaku", Name: "color", Location: InputJSON},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/next", Name: "position", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/next", Name: "duration", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media/:id/resources", Name: "platform", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media/:id/resources", Name: "native_hls", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media/:id/resources", Name: "codecs", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media/:id/resources", Name: "https_only", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/playback-candidates", Name: "platform", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/playback-candidates", Name: "native_hls", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/playback-candidates", Name: "codecs", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/playback-candidates", Name: "https_only", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/next", Name: "platform", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/next", Name: "native_hls", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/next", Name: "codecs", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/next", Name: "https_only", Location: InputQuery},
+	{Method: "GET", Path: "/api/tvbox.json", Name: "platform", Location: InputQuery},
+	{Method: "GET", Path: "/api/tvbox.json", Name: "native_hls", Location: InputQuery},
+	{Method: "GET", Path: "/api/tvbox.json", Name: "codecs", Location: InputQuery},
+	{Method: "GET", Path: "/api/tvbox.json", Name: "https_only", Location: InputQuery},
 	{Method: "POST", Path: "/api/v2/playback/events", Name: "attempt_id", Location: InputJSON},
 	{Method: "POST", Path: "/api/v2/playback/events", Name: "candidate_session_id", Location: InputJSON},
 	{Method: "POST", Path: "/api/v2/playback/events", Name: "event_type", Location: InputJSON},
@@ -168,6 +189,17 @@ var RequestInputs = []RequestInput{
 	{Method: "POST", Path: "/api/v2/playback/events", Name: "vod_id", Location: InputJSON},
 	{Method: "POST", Path: "/api/v2/playback/events", Name: "elapsed_ms", Location: InputJSON},
 	{Method: "POST", Path: "/api/v2/playback/events", Name: "reason", Location: InputJSON},
+	{Method: "POST", Path: "/api/v2/playback/events", Name: "client", Location: InputJSON},
+	{Method: "POST", Path: "/api/v2/media-units/:unit_id/skip-markers", Name: "type", Location: InputJSON},
+	{Method: "POST", Path: "/api/v2/media-units/:unit_id/skip-markers", Name: "start_ms", Location: InputJSON},
+	{Method: "POST", Path: "/api/v2/media-units/:unit_id/skip-markers", Name: "end_ms", Location: InputJSON},
+	{Method: "POST", Path: "/api/v2/embeds", Name: "media_unit_id", Location: InputJSON},
+	{Method: "POST", Path: "/api/v2/embeds", Name: "allowed_origins", Location: InputJSON},
+	{Method: "POST", Path: "/api/v2/embeds", Name: "ttl_hours", Location: InputJSON},
+	{Method: "GET", Path: "/api/oembed", Name: "url", Location: InputQuery},
+	{Method: "GET", Path: "/api/oembed", Name: "format", Location: InputQuery, Default: "json"},
+	{Method: "GET", Path: "/api/oembed", Name: "maxwidth", Location: InputQuery},
+	{Method: "GET", Path: "/api/oembed", Name: "maxheight", Location: InputQuery},
 
 	{Method: "PUT", Path: "/admin/users/:id/role", Name: "role", Location: InputForm},
 	{Method: "POST", Path: "/admin/sites", Name: "key", Location: InputForm},
@@ -182,6 +214,10 @@ var RequestInputs = []RequestInput{
 	{Method: "PUT", Path: "/admin/feedback/:id/reply", Name: "reply", Location: InputForm},
 	{Method: "POST", Path: "/admin/monthly-report/generate", Name: "user_id", Location: InputForm},
 	{Method: "POST", Path: "/admin/monthly-report/generate", Name: "year_month", Location: InputForm, Default: "previous month"},
+	{Method: "GET", Path: "/admin/playback-qoe", Name: "days", Location: InputQuery, Default: "7"},
+	{Method: "GET", Path: "/admin/playback-qoe", Name: "source_key", Location: InputQuery},
+	{Method: "GET", Path: "/api/v2/admin/playback-qoe", Name: "days", Location: InputQuery, Default: "7"},
+	{Method: "GET", Path: "/api/v2/admin/playback-qoe", Name: "source_key", Location: InputQuery},
 	{Method: "POST", Path: "/admin/copyright", Name: "keyword", Location: InputForm},
 	{Method: "PUT", Path: "/admin/copyright/:id", Name: "keyword", Location: InputForm},
 	{Method: "POST", Path: "/admin/category", Name: "keyword", Location: InputForm},
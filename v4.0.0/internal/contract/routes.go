@@ -32,6 +32,7 @@ var Routes = []Route{
 	{Method: "GET", Path: "/", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/search", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/player", Surface: SurfacePublicPage},
+	{Method: "GET", Path: "/embed/:token", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/iptv", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/trends", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/feedback", Surface: SurfacePublicPage},
@@ -47,12 +48,15 @@ var Routes = []Route{
 	{Method: "GET", Path: "/robots.txt", Surface: SurfaceOperational},
 	{Method: "GET", Path: "/monoo-verify.txt", Surface: SurfaceOperational},
 	{Method: "GET", Path: "/movie/:id", Surface: SurfacePublicPage},
+	{Method: "GET", Path: "/person/:id", Surface: SurfacePublicPage},
+	{Method: "GET", Path: "/collection/:id", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/play/:source_key/:vod_id", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/watch/:douban_id", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/discover", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/discover/:type", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/foryou", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/recommend", Surface: SurfacePublicPage},
+	{Method: "GET", Path: "/together", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/cinema", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/similar/:douban_id", Surface: SurfacePublicPage},
 	{Method: "GET", Path: "/user/:user_id", Surface: SurfacePublicPage},
@@ -71,11 +75,17 @@ var Routes = []Route{
 	{Method: "POST", Path: "/dashboard/settings/password", Surface: SurfaceDashboard},
 	{Method: "POST", Path: "/dashboard/settings/share", Surface: SurfaceDashboard},
 	{Method: "POST", Path: "/dashboard/settings/avatar", Surface: SurfaceDashboard},
+	{Method: "POST", Path: "/dashboard/settings/locale", Surface: SurfaceDashboard},
 	{Method: "POST", Path: "/dashboard/settings/douban/bind", Surface: SurfaceDashboard},
 	{Method: "POST", Path: "/dashboard/settings/douban/unbind", Surface: SurfaceDashboard},
 	{Method: "POST", Path: "/dashboard/settings/douban/sync", Surface: SurfaceDashboard},
+	{Method: "GET", Path: "/dashboard/notifications", Surface: SurfaceDashboard},
+	{Method: "POST", Path: "/dashboard/notifications/read-all", Surface: SurfaceDashboard},
+	{Method: "POST", Path: "/dashboard/notifications/preferences", Surface: SurfaceDashboard},
+	{Method: "POST", Path: "/dashboard/notifications/:id/read", Surface: SurfaceDashboard},
 
 	{Method: "GET", Path: "/api/tvbox.json", Surface: SurfacePublicAPI},
+	{Method: "GET", Path: "/feed/digest/:token", Surface: SurfacePublicAPI},
 	{Method: "GET", Path: "/api/vod", Surface: SurfacePublicAPI},
 	{Method: "POST", Path: "/api/user-movies/:id/wish", Surface: SurfaceHTMX},
 	{Method: "POST", Path: "/api/user-movies/:id/watched", Surface: SurfaceHTMX},
@@ -92,6 +102,8 @@ var Routes = []Route{
 	{Method: "GET", Path: "/api/v2/search", Surface: SurfacePublicAPI},
 	{Method: "GET", Path: "/api/htmx/similar", Surface: SurfaceHTMX},
 	{Method: "GET", Path: "/api/htmx/foryou", Surface: SurfaceHTMX},
+	{Method: "POST", Path: "/api/recommendations/:media_id/not-interested", Surface: SurfaceHTMX},
+	{Method: "GET", Path: "/api/htmx/together", Surface: SurfaceHTMX},
 	{Method: "GET", Path: "/api/htmx/reviews", Surface: SurfaceHTMX},
 	{Method: "GET", Path: "/api/htmx/movie-comments", Surface: SurfaceHTMX},
 	{Method: "POST", Path: "/api/comments/:id/like", Surface: SurfaceHTMX},
@@ -108,15 +120,22 @@ var Routes = []Route{
 	{Method: "GET", Path: "/api/htmx/history/recent", Surface: SurfaceHTMX},
 	{Method: "GET", Path: "/api/htmx/history/today-updates", Surface: SurfaceHTMX},
 	{Method: "GET", Path: "/api/htmx/dashboard/feedback", Surface: SurfaceHTMX},
+	{Method: "GET", Path: "/api/htmx/dashboard/digest", Surface: SurfaceHTMX},
 	{Method: "GET", Path: "/api/htmx/public/:user_id/wish", Surface: SurfaceHTMX},
 	{Method: "GET", Path: "/api/htmx/public/:user_id/watched", Surface: SurfaceHTMX},
 	{Method: "GET", Path: "/api/htmx/douban-sync-status", Surface: SurfaceHTMX},
+	{Method: "GET", Path: "/api/htmx/notifications/unread", Surface: SurfaceHTMX},
 	{Method: "GET", Path: "/api/danmaku", Surface: SurfacePublicAPI},
 	{Method: "POST", Path: "/api/danmaku", Surface: SurfaceAuthenticatedAPI},
 	{Method: "GET", Path: "/api/watch/resolve", Surface: SurfacePublicAPI},
 	{Method: "GET", Path: "/api/v2/media/:id/resources", Surface: SurfacePublicAPI},
 	{Method: "GET", Path: "/api/v2/media-units/:unit_id/playback-candidates", Surface: SurfacePublicAPI},
+	{Method: "GET", Path: "/api/v2/media-units/:unit_id/next", Surface: SurfacePublicAPI},
 	{Method: "POST", Path: "/api/v2/playback/events", Surface: SurfacePublicAPI},
+	{Method: "POST", Path: "/api/v2/media-units/:unit_id/skip-markers", Surface: SurfaceAuthenticatedAPI},
+	{Method: "POST", Path: "/api/v2/embeds", Surface: SurfaceAuthenticatedAPI},
+	{Method: "GET", Path: "/api/v2/embeds", Surface: SurfaceAuthenticatedAPI},
+	{Method: "GET", Path: "/api/oembed", Surface: SurfacePublicAPI},
 
 	{Method: "GET", Path: "/admin", Surface: SurfaceAdmin},
 	{Method: "GET", Path: "/admin/users", Surface: SurfaceAdmin},
@@ -140,9 +159,19 @@ var Routes = []Route{
 	{Method: "POST", Path: "/admin/jobs/retry-failed", Surface: SurfaceAdmin},
 	{Method: "GET", Path: "/admin/matches", Surface: SurfaceAdmin},
 	{Method: "POST", Path: "/admin/matches/decision", Surface: SurfaceAdmin},
+	{Method: "GET", Path: "/admin/media/:id", Surface: SurfaceAdmin},
+	{Method: "POST", Path: "/admin/media/:id/fields", Surface: SurfaceAdmin},
+	{Method: "POST", Path: "/admin/media/:id/locks", Surface: SurfaceAdmin},
+	{Method: "POST", Path: "/admin/media/:id/revert", Surface: SurfaceAdmin},
+	{Method: "GET", Path: "/admin/duplicates", Surface: SurfaceAdmin},
+	{Method: "POST", Path: "/admin/duplicates/:id/merge", Surface: SurfaceAdmin},
+	{Method: "POST", Path: "/admin/duplicates/:id/dismiss", Surface: SurfaceAdmin},
+	{Method: "POST", Path: "/admin/merges/:id/split", Surface: SurfaceAdmin},
 	{Method: "GET", Path: "/api/v2/admin/media-matches", Surface: SurfaceAdmin},
 	{Method: "POST", Path: "/api/v2/admin/media-matches/:id/resolve", Surface: SurfaceAdmin},
 	{Method: "GET", Path: "/api/v2/admin/metrics", Surface: SurfaceAdmin},
+	{Method: "GET", Path: "/admin/playback-qoe", Surface: SurfaceAdmin},
+	{Method: "GET", Path: "/api/v2/admin/playback-qoe", Surface: SurfaceAdmin},
 	{Method: "POST", Path: "/admin/monthly-report/generate", Surface: SurfaceAdmin},
 	{Method: "GET", Path: "/admin/copyright", Surface: SurfaceAdmin},
 	{Method: "POST", Path: "/admin/copyright", Surface: SurfaceAdmin},
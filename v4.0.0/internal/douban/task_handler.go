@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/identity"
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
 	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
 )
 
@@ -30,12 +31,18 @@ type SyncExecutor interface {
 // MonthlyGenerator 是可选的月报生成器，每日任务顺带触发上月月报。
 type MonthlyGenerator interface{ GeneratePreviousMonth(context.Context) error }
 
+// Notifier 是站内通知的写入能力，由 notifications.Service 实现。
+type Notifier interface {
+	NotifyUser(ctx context.Context, userID int, notification notifications.Notification) error
+}
+
 // TaskHandler 是豆瓣同步的任务处理器。
 type TaskHandler struct {
 	jobs     JobStore
 	users    UserStore
 	executor SyncExecutor
 	monthly  MonthlyGenerator
+	notifier Notifier
 	now      func() time.Time
 	logger   *slog.Logger
 }
@@ -48,6 +55,11 @@ func WithMonthlyGenerator(generator MonthlyGenerator) TaskHandlerOption {
 	return func(handler *TaskHandler) { handler.monthly = generator }
 }
 
+// WithNotifier 让同步跑完后通知用户。
+func WithNotifier(notifier Notifier) TaskHandlerOption {
+	return func(handler *TaskHandler) { handler.notifier = notifier }
+}
+
 // WithLogger 替换日志器。
 func WithLogger(logger *slog.Logger) TaskHandlerOption {
 	return func(handler *TaskHandler) {
@@ -107,9 +119,39 @@ func (handler *TaskHandler) Handle(ctx context.Context, job workqueue.Job) error
 	} else {
 		err = handler.executor.SyncFull(ctx, userID, user.DoubanUserID, job.ID)
 	}
+	if err == nil {
+		handler.notifyCompleted(ctx, userID, job.ID, domainJob.SyncType)
+	}
 	return err
 }
 
+// notifyCompleted 告诉用户同步跑完了。每日增量同步对每个绑定用户都会跑一次，
+// 什么都没变的那次不打扰；全量同步是用户自己发起的，总会通知。同步本身已经成功，通知失败只记日志。
+func (handler *TaskHandler) notifyCompleted(ctx context.Context, userID, jobID int, syncType SyncType) {
+	if handler.notifier == nil {
+		return
+	}
+	processed, failed := 0, 0
+	if latest, err := handler.jobs.LatestByUser(ctx, userID); err == nil && latest != nil && latest.ID == jobID {
+		processed, failed = latest.Processed, latest.FailedCount
+	}
+	if syncType == TypeIncremental && processed == 0 && failed == 0 {
+		return
+	}
+	body := fmt.Sprintf("导入了 %d 条想看和看过的标记。", processed)
+	if syncType == TypeIncremental {
+		body = fmt.Sprintf("同步了 %d 条新的想看和看过标记。", processed)
+	}
+	if failed > 0 {
+		body += fmt.Sprintf("有 %d 条没能导入，可以稍后再同步一次。", failed)
+	}
+	notification := notifications.Notification{Kind: notifications.KindDoubanSync, Title: "豆瓣同步完成", Body: body,
+		Link: "/dashboard", DedupeKey: strconv.Itoa(jobID)}
+	if err := handler.notifier.NotifyUser(ctx, userID, notification); err != nil {
+		handler.logger.Warn("notify Douban sync completed", "user_id", userID, "job_id", jobID, "error", err)
+	}
+}
+
 // HandleDaily 是每日定时任务：给所有绑定豆瓣的用户排增量同步，并触发上月月报。
 func (handler *TaskHandler) HandleDaily(ctx context.Context, _ workqueue.Job) error {
 	failed, err := handler.jobs.RetryableBefore(ctx, handler.now().Add(-24*time.Hour), 50)
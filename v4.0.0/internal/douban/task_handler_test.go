@@ -2,11 +2,13 @@ package douban
 
 import (
 	"context"
+	"strconv"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/identity"
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
 	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
 )
@@ -56,6 +58,52 @@ func TestDailyTaskGeneratesMonthlyReportOnFirstDay(t *testing.T) {
 	}
 }
 
+func TestTaskHandlerNotifiesWhenSyncCompletes(t *testing.T) {
+	queue := workqueue.NewPostgresStore(testdb.Pool(t))
+	jobs := NewQueueJobStore(queue)
+	users := identity.NewPostgresStore(testdb.Pool(t))
+	user, _ := users.Create(t.Context(), identity.User{Email: "person@example.com", Username: "person", PasswordHash: "hash"})
+	_ = users.UpdateDoubanUserID(t.Context(), user.ID, "198878447")
+	notifier := &recordingNotifier{}
+	handler := NewTaskHandler(jobs, users, &recordingExecutor{}, WithNotifier(notifier))
+	run := func(create func(context.Context, int) (int, error)) {
+		t.Helper()
+		if _, err := create(t.Context(), user.ID); err != nil {
+			t.Fatal(err)
+		}
+		job, err := queue.Latest(t.Context(), TaskSync, strconv.Itoa(user.ID))
+		if err != nil || job == nil {
+			t.Fatalf("latest job = %+v / %v", job, err)
+		}
+		if err := handler.Handle(t.Context(), *job); err != nil {
+			t.Fatal(err)
+		}
+		// 直接收尾，下一次 Create 才会排出新任务而不是复用这一个。
+		if _, err := testdb.Pool(t).Exec(t.Context(), `UPDATE worker_jobs SET status = 'completed' WHERE id = $1`, job.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 全量同步总会通知；什么都没变的增量同步不打扰。
+	run(handler.CreateFull)
+	run(handler.CreateIncremental)
+	if len(notifier.sent) != 1 || notifier.users[0] != user.ID || notifier.sent[0].Kind != notifications.KindDoubanSync ||
+		notifier.sent[0].Body != "导入了 0 条想看和看过的标记。" || notifier.sent[0].DedupeKey == "" {
+		t.Fatalf("notifications = %+v", notifier.sent)
+	}
+}
+
+type recordingNotifier struct {
+	users []int
+	sent  []notifications.Notification
+}
+
+func (notifier *recordingNotifier) NotifyUser(_ context.Context, userID int, notification notifications.Notification) error {
+	notifier.users = append(notifier.users, userID)
+	notifier.sent = append(notifier.sent, notification)
+	return nil
+}
+
 type recordingExecutor struct {
 	fullCalls atomic.Int32
 	called    chan struct{}
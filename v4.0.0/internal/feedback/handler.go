@@ -14,8 +14,10 @@ import (
 
 // Handler 提供反馈页面、提交接口和后台管理接口。
 type Handler struct {
-	config config.Config
-	store  Store
+	config   config.Config
+	store    Store
+	notifier Notifier
+	finder   Finder
 }
 
 // NewHandler 创建反馈处理器。
@@ -172,6 +174,7 @@ func (handler *Handler) adminReply(c *gin.Context) {
 		apiError(c, http.StatusInternalServerError, "回复失败")
 		return
 	}
+	handler.notifyReplied(c.Request.Context(), id, reply)
 	apiSuccess(c, gin.H{"message": "回复成功"})
 }
 
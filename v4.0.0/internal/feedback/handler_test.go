@@ -1,6 +1,7 @@
 package feedback
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -10,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
 	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
@@ -92,6 +94,38 @@ func TestAdminFeedbackRequiresRoleAndPreservesStatusReplyEnvelope(t *testing.T)
 	}
 }
 
+func TestAdminReplyNotifiesSignedInAuthorOnly(t *testing.T) {
+	_, store, _, adminToken := feedbackTestRouter(t)
+	authorID := 1
+	mine, _ := store.Create(t.Context(), Feedback{UserID: &authorID, Type: "bug", Content: "播放卡顿"})
+	guest, _ := store.Create(t.Context(), Feedback{Type: "bug", Content: "游客反馈"})
+	notifier := &notifierStub{}
+	router := gin.New()
+	NewHandler(config.Config{AppSecret: "secret"}, store).WithNotifier(notifier, store).Register(router)
+	long := strings.Repeat("修", 100)
+	for _, id := range []int{mine.ID, guest.ID} {
+		if response := formRequest(router, http.MethodPut, "/admin/feedback/"+itoa(id)+"/reply", url.Values{"reply": {long}}, adminToken); response.Code != http.StatusOK {
+			t.Fatalf("reply = %d/%s", response.Code, response.Body.String())
+		}
+	}
+	if len(notifier.sent) != 1 || notifier.users[0] != authorID || notifier.sent[0].Kind != notifications.KindFeedbackReply ||
+		notifier.sent[0].Body != strings.Repeat("修", 80)+"…" {
+		t.Fatalf("notifications = %v / %+v", notifier.users, notifier.sent)
+	}
+}
+
+// notifierStub 记下发出的通知和接收人。
+type notifierStub struct {
+	users []int
+	sent  []notifications.Notification
+}
+
+func (stub *notifierStub) NotifyUser(_ context.Context, userID int, notification notifications.Notification) error {
+	stub.users = append(stub.users, userID)
+	stub.sent = append(stub.sent, notification)
+	return nil
+}
+
 func feedbackTestRouter(t *testing.T) (*gin.Engine, *PostgresStore, string, string) {
 	t.Helper()
 	gin.SetMode(gin.TestMode)
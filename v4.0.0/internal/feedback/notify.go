@@ -0,0 +1,51 @@
+package feedback
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
+)
+
+// replyExcerptLength 是通知正文里引用回复的最大字数，全文在用户中心的反馈列表里看。
+const replyExcerptLength = 80
+
+// Notifier 是站内通知的写入能力，由 notifications.Service 实现。
+type Notifier interface {
+	NotifyUser(ctx context.Context, userID int, notification notifications.Notification) error
+}
+
+// Finder 按 ID 读一条反馈，回复后用它找到提交人。由 PostgresStore 实现。
+type Finder interface {
+	FindByID(ctx context.Context, id int) (*Feedback, error)
+}
+
+// WithNotifier 让管理员回复反馈时通知提交人。游客提交的反馈没有账号，不通知。
+func (handler *Handler) WithNotifier(notifier Notifier, finder Finder) *Handler {
+	handler.notifier, handler.finder = notifier, finder
+	return handler
+}
+
+// notifyReplied 告诉提交人反馈有了回复。回复已经保存，通知失败只记日志。
+func (handler *Handler) notifyReplied(ctx context.Context, id int, reply string) {
+	if handler.notifier == nil || handler.finder == nil {
+		return
+	}
+	record, err := handler.finder.FindByID(ctx, id)
+	if err != nil {
+		slog.Warn("find feedback for notification", "feedback_id", id, "error", err)
+		return
+	}
+	if record == nil || record.UserID == nil {
+		return
+	}
+	body := []rune(reply)
+	if len(body) > replyExcerptLength {
+		body = append(body[:replyExcerptLength], '…')
+	}
+	notification := notifications.Notification{Kind: notifications.KindFeedbackReply, Title: "你的反馈有了回复",
+		Body: string(body), Link: "/dashboard"}
+	if err := handler.notifier.NotifyUser(ctx, *record.UserID, notification); err != nil {
+		slog.Warn("notify feedback author", "feedback_id", id, "error", err)
+	}
+}
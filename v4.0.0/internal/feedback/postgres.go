@@ -89,6 +89,15 @@ func (store *PostgresStore) Reply(ctx context.Context, id int, reply string) err
 	return nil
 }
 
+// FindByID 读一条反馈，不存在时返回 nil。
+func (store *PostgresStore) FindByID(ctx context.Context, id int) (*Feedback, error) {
+	records, err := store.list(ctx, `SELECT `+feedbackColumns+` FROM feedbacks WHERE id = $1`, id)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
 // list 是列表查询的公共实现。
 func (store *PostgresStore) list(ctx context.Context, query string, arguments ...any) ([]Feedback, error) {
 	rows, err := store.database.Query(ctx, query, arguments...)
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
 	"github.com/jackc/pgx/v5"
 )
@@ -169,15 +171,24 @@ func queryPlaybackPositions(ctx context.Context, executor database.Executor, pre
 	if err != nil {
 		return nil, fmt.Errorf("list playback positions: %w", err)
 	}
+	return scanPlaybackPositions(rows, false)
+}
+
+// scanPlaybackPositions 读出进度记录。withUpNext 为 true 时查询末尾多一列「是否已改指下一集」。
+func scanPlaybackPositions(rows database.Rows, withUpNext bool) ([]Record, error) {
 	defer rows.Close()
 	records := make([]Record, 0)
 	for rows.Next() {
 		var record Record
 		var mediaID, mediaUnitID *int
-		if err := rows.Scan(&record.ID, &record.UserID, &mediaID, &mediaUnitID, &record.DoubanID,
+		destinations := []any{&record.ID, &record.UserID, &mediaID, &mediaUnitID, &record.DoubanID,
 			&record.VodID, &record.Title, &record.Poster, &record.Episode, &record.SeasonNumber,
 			&record.EpisodeKey, &record.Progress, &record.LastTime, &record.Duration, &record.Source,
-			&record.EntryPage, &record.WatchedAt, &record.UpdatedAt); err != nil {
+			&record.EntryPage, &record.WatchedAt, &record.UpdatedAt}
+		if withUpNext {
+			destinations = append(destinations, &record.UpNext)
+		}
+		if err := rows.Scan(destinations...); err != nil {
 			return nil, fmt.Errorf("scan playback position: %w", err)
 		}
 		if mediaID != nil {
@@ -216,9 +227,60 @@ func queryPlaybackPositions(ctx context.Context, executor database.Executor, pre
 //
 // user_movies 以 media_id 关联；只有资源站身份、尚未关联规范媒体的进度记录
 // （position.media_id IS NULL）无法被标记为已看，因此始终保留在列表里。
+//
+// 已看完（completed 或进度越过 mediaidentity.CompletionPercent）的剧集不再原样出现，
+// 而是改指同一部作品的下一集（可跨季，未播出的也算）：位置清零、UpNext 置 true，
+// 有豆瓣 ID 时入口改为 /watch，因为 /play 的资源未必已经收录下一集。
+// 下一集已经有自己的进度记录时，这条就不再重复出现——那一行会自己接着往下指。
+// 没有下一集（电影、最后一集）时沿用原规则：未标记 completed 的照常保留。
 func (store *PostgresStore) ListContinue(ctx context.Context, userID, limit, offset int) ([]Record, error) {
-	return queryPlaybackPositions(ctx, store.database,
-		`position.user_id = $1 AND position.deleted_at IS NULL AND position.completed = FALSE
+	rows, err := store.database.Query(ctx, continueSelect+continueSource+`
+ORDER BY position.activity_at DESC LIMIT $2 OFFSET $3`, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("list continue positions: %w", err)
+	}
+	return scanPlaybackPositions(rows, true)
+}
+
+// continueSelect 与 playbackPositionSelect 列顺序一致，已看完的行替换成下一集的季集信息。
+const continueSelect = `SELECT position.id, position.user_id, position.media_id,
+COALESCE(next_unit.id, position.media_unit_id),
+COALESCE(media.douban_id, ''), position.last_vod_id,
+COALESCE(NULLIF(media.title, ''), position.title),
+COALESCE(NULLIF(media.poster, ''), position.poster),
+COALESCE(next_unit.episode_key, position.episode),
+COALESCE(next_unit.season_number, position.season_number),
+COALESCE(next_unit.episode_key, position.episode_key),
+CASE WHEN next_unit.id IS NULL THEN position.progress_percent ELSE 0 END,
+CASE WHEN next_unit.id IS NULL THEN position.position_seconds ELSE 0 END,
+CASE WHEN next_unit.id IS NULL THEN position.duration_seconds ELSE 0 END,
+position.last_source_key,
+CASE WHEN next_unit.id IS NOT NULL AND COALESCE(media.douban_id, '') <> '' THEN 'watch' ELSE position.entry_page END,
+position.activity_at, position.updated_at, next_unit.id IS NOT NULL`
+
+// continueSource 是「继续观看」的数据范围，ListContinue 和 CountByUser 共用，保证两边口径一致。
+// $1 是用户 ID；看完阈值是编译期常量，直接拼进 SQL，Count 查询就不用凑占位参数。
+var continueSource = `
+FROM playback_positions position
+LEFT JOIN media ON media.id = position.media_id
+LEFT JOIN media_units current_unit ON current_unit.id = position.media_unit_id
+LEFT JOIN LATERAL (
+    SELECT next.id, next.season_number, next.episode_key
+    FROM media_units next
+    WHERE (position.completed OR position.progress_percent >= ` + strconv.Itoa(mediaidentity.CompletionPercent) + `)
+      AND current_unit.unit_type = 'episode'
+      AND next.media_id = current_unit.media_id AND next.unit_type = 'episode'
+      AND (next.season_number, COALESCE(next.episode_number, 0), next.id)
+        > (current_unit.season_number, COALESCE(current_unit.episode_number, 0), current_unit.id)
+    ORDER BY next.season_number, COALESCE(next.episode_number, 0), next.id
+    LIMIT 1
+) next_unit ON TRUE
+WHERE position.user_id = $1 AND position.deleted_at IS NULL
+AND (position.completed = FALSE OR next_unit.id IS NOT NULL)
+AND (next_unit.id IS NULL OR NOT EXISTS (
+    SELECT 1 FROM playback_positions seen
+    WHERE seen.user_id = position.user_id AND seen.media_unit_id = next_unit.id AND seen.deleted_at IS NULL
+))
 AND NOT EXISTS (
     SELECT 1 FROM user_movies
     WHERE user_movies.user_id = position.user_id
@@ -226,6 +288,4 @@ AND NOT EXISTS (
       AND user_movies.media_id = position.media_id
       AND user_movies.status = 'watched'
       AND user_movies.updated_at >= position.activity_at
-)
-ORDER BY position.activity_at DESC LIMIT $2 OFFSET $3`, userID, limit, offset)
-}
+)`
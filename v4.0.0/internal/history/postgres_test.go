@@ -76,6 +76,30 @@ func TestListContinueExcludesWatchedWithoutDeletingProgress(t *testing.T) {
 	}
 }
 
+// 看完一集后继续观看应改指下一集，而不是从列表里消失或停在已看完的那一集。
+func TestListContinuePointsCompletedEpisodesAtNextUnit(t *testing.T) {
+	activity := time.Date(2026, time.August, 3, 12, 0, 0, 0, time.UTC)
+	database := &historyFakeDatabase{rows: &historyFakeRows{values: [][]any{
+		{1, 42, nil, nil, "1292052", "vod", "剧集", "poster", "S02E01", 2, "S02E01", 0, 0.0, 0.0, "source", "watch", activity, activity, true},
+	}}}
+	store := NewPostgresStore(database)
+	records, err := store.ListContinue(t.Context(), 42, 24, 0)
+	if err != nil || len(records) != 1 || !records[0].UpNext || records[0].Progress != 0 || records[0].EpisodeKey != "S02E01" {
+		t.Fatalf("records/error = %+v/%v", records, err)
+	}
+	for _, expected := range []string{
+		"LEFT JOIN LATERAL",
+		"position.progress_percent >= 90",
+		"(next.season_number, COALESCE(next.episode_number, 0), next.id)",
+		"seen.media_unit_id = next_unit.id",
+		"position.completed = FALSE OR next_unit.id IS NOT NULL",
+	} {
+		if !strings.Contains(database.query, expected) {
+			t.Fatalf("continue query missing %q: %s", expected, database.query)
+		}
+	}
+}
+
 func TestPlaybackPositionUpsertsCanonicalUnitAndKeepsTombstone(t *testing.T) {
 	database := &historyFakeDatabase{}
 	now := time.Date(2026, time.August, 3, 12, 0, 0, 0, time.UTC)
@@ -90,6 +90,7 @@ func (handler *Handler) Register(router *gin.Engine) {
 	router.POST("/dashboard/settings/password", require, handler.updatePassword)
 	router.POST("/dashboard/settings/share", require, handler.updateShare)
 	router.POST("/dashboard/settings/avatar", require, handler.updateAvatar)
+	router.POST("/dashboard/settings/locale", require, handler.updateLocale)
 }
 
 // loginPage 渲染登录页。
@@ -304,6 +305,31 @@ func (handler *Handler) updateAvatar(c *gin.Context) {
 	c.Redirect(http.StatusFound, "/dashboard/settings?success=avatar")
 }
 
+// LocaleUpdater 是保存界面语言的可选能力，由 PostgresStore 实现。
+type LocaleUpdater interface {
+	UpdateLocale(ctx context.Context, userID int, locale string) error
+}
+
+// updateLocale 保存界面语言。同时改写语言 Cookie，否则之前用 ?lang= 记住的选择会盖过新设置。
+func (handler *Handler) updateLocale(c *gin.Context) {
+	updater, ok := handler.store.(LocaleUpdater)
+	if !ok {
+		handler.settingsError(c, "当前环境不支持语言设置")
+		return
+	}
+	locale := platformweb.NormalizeLocale(c.PostForm("locale"))
+	if c.PostForm("locale") != "" && locale == "" {
+		handler.settingsError(c, "不支持的语言")
+		return
+	}
+	if err := updater.UpdateLocale(c.Request.Context(), auth.UserID(c), locale); err != nil {
+		handler.settingsError(c, "语言设置更新失败")
+		return
+	}
+	platformweb.RememberLocale(c, locale, handler.config.Env == "production")
+	c.Redirect(http.StatusFound, "/dashboard/settings?success=locale")
+}
+
 // currentUser 从库中读取当前登录用户。
 func (handler *Handler) currentUser(c *gin.Context) *User {
 	user, _ := handler.store.FindByID(c.Request.Context(), auth.UserID(c))
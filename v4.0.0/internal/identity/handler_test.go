@@ -186,6 +186,32 @@ func TestSettingsPreservePasswordAndAvatarValidation(t *testing.T) {
 	}
 }
 
+func TestSettingsSaveLocaleAndOverrideRememberedCookie(t *testing.T) {
+	router, store, now := identityTestRouter(t, "test")
+	user, _ := store.Create(t.Context(), User{Email: "locale@example.com", Username: "locale", Role: "user", CreatedAt: now})
+	token, _ := auth.Sign(auth.Claims{UserID: user.ID, Email: user.Email, Role: user.Role, Issued: time.Now().Unix(), Expiry: time.Now().Add(72 * time.Hour).Unix()}, "secret")
+
+	saved := authenticatedForm(router, token, "/dashboard/settings/locale", url.Values{"locale": {"en-US"}})
+	if saved.Code != http.StatusFound || saved.Header().Get("Location") != "/dashboard/settings?success=locale" {
+		t.Fatalf("save locale = %d/%s", saved.Code, saved.Header().Get("Location"))
+	}
+	if cookie := responseCookie(t, saved, "lang"); cookie.Value != "en" {
+		t.Fatalf("locale cookie = %+v", cookie)
+	}
+	if updated, _ := store.FindByID(t.Context(), user.ID); updated == nil || updated.PreferredLocale() != "en" {
+		t.Fatalf("stored locale = %+v", updated)
+	}
+	// 改回跟随浏览器时要清掉 Cookie，否则之前的选择一直生效。
+	cleared := authenticatedForm(router, token, "/dashboard/settings/locale", url.Values{"locale": {""}})
+	if cookie := responseCookie(t, cleared, "lang"); cookie.MaxAge >= 0 {
+		t.Fatalf("follow-browser should expire the cookie: %+v", cookie)
+	}
+	invalid := authenticatedForm(router, token, "/dashboard/settings/locale", url.Values{"locale": {"fr"}})
+	if invalid.Code != http.StatusOK || !strings.Contains(invalid.Body.String(), "不支持的语言") {
+		t.Fatalf("unsupported locale = %d", invalid.Code)
+	}
+}
+
 func identityTestRouter(t *testing.T, environment string) (*gin.Engine, *PostgresStore, time.Time) {
 	return identityTestRouterWithOptions(t, environment)
 }
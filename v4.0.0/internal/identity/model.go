@@ -16,5 +16,15 @@ type User struct {
 	DoubanUserID string    `json:"douban_user_id"`
 	IsPublic     bool      `json:"is_public"`
 	Avatar       string    `json:"avatar"`
+	Locale       string    `json:"locale"`
 	CreatedAt    time.Time `json:"created_at"`
 }
+
+// PreferredLocale 返回账号设置的界面语言，空字符串表示跟随浏览器。
+// 供 platformweb.ResolveLocale 通过接口断言读取，web 层不需要依赖 identity。
+func (user *User) PreferredLocale() string {
+	if user == nil {
+		return ""
+	}
+	return user.Locale
+}
@@ -26,6 +26,13 @@ um.status, um.rating, um.comment, um.created_at, um.updated_at`
 // recordSource 是各查询共用的表和关联，海报优先取 media 表的。
 const recordSource = ` FROM user_movies um LEFT JOIN media ON media.id = um.media_id`
 
+// movieKeyMediaID 把 movie_id（$2）解析成 media.id。详情页标识有豆瓣 ID 和 m<media.id> 两种
+// （见 catalog.ParseMovieKey），没有豆瓣条目的作品只能按后者找；正则不匹配时 SUBSTRING 返回 NULL，不会转换出错。
+const movieKeyMediaID = `COALESCE(
+    (SELECT id FROM media WHERE douban_id = $2 LIMIT 1),
+    (SELECT id FROM media WHERE id = SUBSTRING($2 FROM '^m([1-9][0-9]{0,17})$')::bigint)
+)`
+
 // Upsert 标记或更新一条片单记录，同一部片子换状态时覆盖原记录。
 func (store *PostgresStore) Upsert(ctx context.Context, record Record) error {
 	hasExternalTime := !record.CreatedAt.IsZero() || !record.UpdatedAt.IsZero()
@@ -37,7 +44,7 @@ func (store *PostgresStore) Upsert(ctx context.Context, record Record) error {
 	}
 	_, err := store.database.Exec(ctx, `INSERT INTO user_movies
 (user_id, media_id, movie_id, title, poster, year, status, rating, comment, created_at, updated_at)
-VALUES ($1,(SELECT id FROM media WHERE douban_id=$2 LIMIT 1),$2,$3,$4,$5,$6,$7,$8,$9,$10)
+VALUES ($1,`+movieKeyMediaID+`,$2,$3,$4,$5,$6,$7,$8,$9,$10)
 ON CONFLICT (user_id, movie_id) DO UPDATE SET
 media_id = COALESCE(EXCLUDED.media_id, user_movies.media_id),
 title = EXCLUDED.title, poster = EXCLUDED.poster, year = EXCLUDED.year,
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
 )
 
 func TestPostgresStorePreservesLegacyIdentityOrderingAndOwnership(t *testing.T) {
@@ -115,3 +116,36 @@ func (rows *libraryFakeRows) Scan(destinations ...any) error {
 
 func (rows *libraryFakeRows) Err() error { return nil }
 func (rows *libraryFakeRows) Close()     {}
+
+func TestUpsertResolvesMediaIDForDoubanAndMediaKeys(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 7)
+	testdb.Media(t, pool, 41, 42)
+	if _, err := pool.Exec(t.Context(), `UPDATE media SET douban_id = '1292052' WHERE id = 41`); err != nil {
+		t.Fatal(err)
+	}
+	store := NewPostgresStore(pool)
+	// 42 号只有 TMDB 来源，详情页和片单按钮用的是 m42。
+	for _, movieID := range []string{"1292052", "m42", "m999", "mabc"} {
+		if err := store.Upsert(t.Context(), Record{UserID: 7, MovieID: movieID, Title: movieID, Status: StatusWish}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := pool.Query(t.Context(), `SELECT movie_id, COALESCE(media_id, 0) FROM user_movies WHERE user_id = 7`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	mediaIDs := make(map[string]int)
+	for rows.Next() {
+		var movieID string
+		var mediaID int
+		if err := rows.Scan(&movieID, &mediaID); err != nil {
+			t.Fatal(err)
+		}
+		mediaIDs[movieID] = mediaID
+	}
+	if !reflect.DeepEqual(mediaIDs, map[string]int{"1292052": 41, "m42": 42, "m999": 0, "mabc": 0}) {
+		t.Fatalf("media ids = %v", mediaIDs)
+	}
+}
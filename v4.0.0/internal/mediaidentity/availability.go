@@ -0,0 +1,30 @@
+package mediaidentity
+
+import (
+	"context"
+	"fmt"
+)
+
+// TaskAvailabilityCheck 检查一部作品是否从「没有片源」变成了可播。
+// 资源关联、分集候选写入和播放质量重算之后都会投这个任务，处理器在 notifications 包。
+const TaskAvailabilityCheck = "availability_check"
+
+// enqueueAvailabilityCheck 给有人想看、且还没记录为可播的作品投一个检查任务。
+// 绝大多数写入对应的作品要么没人想看、要么早就能播，在这里就过滤掉，不给队列添负担。
+// 任务延后一分钟执行：一次搜索会先写关联再写分集，等它们都落库再判断。
+func (store *PostgresStore) enqueueAvailabilityCheck(ctx context.Context, reason string, mediaIDs ...int) error {
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+	_, err := store.database.Exec(ctx, `INSERT INTO worker_jobs (task_type, subject_key, payload, reason, max_attempts, available_at, priority)
+SELECT $1::text, media.id::text, JSONB_BUILD_OBJECT('media_id', media.id), $3::text, 3, NOW() + INTERVAL '1 minute', 5
+FROM media
+WHERE media.id = ANY($2::bigint[])
+  AND EXISTS (SELECT 1 FROM user_movies wish WHERE wish.media_id = media.id AND wish.status = 'wish')
+  AND NOT EXISTS (SELECT 1 FROM media_playback_states playback WHERE playback.media_id = media.id AND playback.state <> 'none')
+ON CONFLICT (task_type, subject_key) WHERE status IN ('pending', 'running') DO NOTHING`, TaskAvailabilityCheck, mediaIDs, reason)
+	if err != nil {
+		return fmt.Errorf("enqueue availability check: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package mediaidentity
+
+import (
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
+)
+
+func TestLinkResourceQueuesAvailabilityCheckOnlyForWishedUnplayableMedia(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 1)
+	testdb.Media(t, pool, 1, 2, 3)
+	// 1 号有人想看、还没片源；2 号有人想看但早就能播；3 号没人想看。
+	if _, err := pool.Exec(t.Context(), `INSERT INTO user_movies (user_id, media_id, movie_id, status, rating)
+VALUES (1, 1, 'm1', 'wish', 0), (1, 2, 'm2', 'wish', 0);
+INSERT INTO media_playback_states (media_id, state) VALUES (2, 'direct')`); err != nil {
+		t.Fatal(err)
+	}
+	store := NewPostgresStore(pool)
+	for index, mediaID := range []int{1, 1, 2, 3} {
+		link := ResourceLink{SourceKey: "site", VodID: string(rune('a' + index)), MediaID: mediaID, Confidence: 1, MatchedBy: "douban_id"}
+		if err := store.LinkResource(t.Context(), link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var subjects []string
+	rows, err := pool.Query(t.Context(), `SELECT subject_key FROM worker_jobs WHERE task_type = $1 ORDER BY subject_key`, TaskAvailabilityCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var subject string
+		if err := rows.Scan(&subject); err != nil {
+			t.Fatal(err)
+		}
+		subjects = append(subjects, subject)
+	}
+	// 同一部作品连着关联两条资源，只排一个任务。
+	if len(subjects) != 1 || subjects[0] != "1" {
+		t.Fatalf("availability jobs = %v", subjects)
+	}
+}
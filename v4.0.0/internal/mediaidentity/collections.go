@@ -0,0 +1,211 @@
+package mediaidentity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// 合集类型：series 是一部剧的各季，movie 是 TMDB 的电影合集（三部曲之类）。
+const (
+	CollectionSeries = "series"
+	CollectionMovie  = "movie"
+)
+
+// 合集成员在用户那里的进度。
+const (
+	CollectionWatched  = "watched"
+	CollectionWatching = "watching"
+)
+
+// ErrCollectionNotFound 表示合集不存在，或作品不属于任何合集。
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// Collection 是一个系列或电影合集。Items 只有 FindCollection 才会填，已按观看顺序排好。
+type Collection struct {
+	ID         int
+	Kind       string
+	Provider   string
+	ExternalID string
+	Name       string
+	Overview   string
+	Poster     string
+	Backdrop   string
+	Items      []CollectionItem
+}
+
+// CollectionItem 是合集里的一部作品。SeasonNumber 只有剧集系列才有；
+// ReleaseDate 是来源给的首映日期，用来给电影合集排顺序。
+type CollectionItem struct {
+	MediaID      int
+	DoubanID     string
+	MediaType    string
+	Title        string
+	Year         string
+	Poster       string
+	Rating       float64
+	SeasonNumber int
+	ReleaseDate  time.Time
+}
+
+// CollectionWriter 把作品挂进合集，合集不存在时按 (kind, provider, external_id) 建出来。
+type CollectionWriter interface {
+	AddToCollection(ctx context.Context, collection Collection, item CollectionItem) error
+}
+
+// CollectionReader 读取合集、作品所属的合集，以及用户在合集上的进度。
+type CollectionReader interface {
+	FindCollection(ctx context.Context, id int) (Collection, error)
+	FindMediaCollection(ctx context.Context, mediaID int) (Collection, error)
+	ListCollectionProgress(ctx context.Context, userID, collectionID int) (map[int]string, error)
+}
+
+// AddToCollection 写入合集和成员。合集资料只补空字段，成员的季号和日期以最后一次写入为准。
+func (store *PostgresStore) AddToCollection(ctx context.Context, collection Collection, item CollectionItem) error {
+	collection.Kind = strings.TrimSpace(collection.Kind)
+	collection.Provider = strings.ToLower(strings.TrimSpace(collection.Provider))
+	collection.ExternalID = strings.TrimSpace(collection.ExternalID)
+	collection.Name = strings.TrimSpace(collection.Name)
+	if item.MediaID <= 0 || collection.Provider == "" || collection.ExternalID == "" || collection.Name == "" ||
+		(collection.Kind != CollectionSeries && collection.Kind != CollectionMovie) {
+		return fmt.Errorf("invalid collection %s/%s/%s for media %d", collection.Kind, collection.Provider, collection.ExternalID, item.MediaID)
+	}
+	collectionID := 0
+	if err := store.database.QueryRow(ctx, `INSERT INTO collections (kind, provider, external_id, name, overview, poster, backdrop)
+VALUES ($1,$2,$3,$4,$5,$6,$7)
+ON CONFLICT (kind, provider, external_id) DO UPDATE SET
+name = CASE WHEN collections.name = '' THEN EXCLUDED.name ELSE collections.name END,
+overview = CASE WHEN collections.overview = '' THEN EXCLUDED.overview ELSE collections.overview END,
+poster = CASE WHEN collections.poster = '' THEN EXCLUDED.poster ELSE collections.poster END,
+backdrop = CASE WHEN collections.backdrop = '' THEN EXCLUDED.backdrop ELSE collections.backdrop END,
+updated_at = NOW()
+RETURNING id`, collection.Kind, collection.Provider, collection.ExternalID, collection.Name,
+		strings.TrimSpace(collection.Overview), strings.TrimSpace(collection.Poster), strings.TrimSpace(collection.Backdrop)).Scan(&collectionID); err != nil {
+		return fmt.Errorf("upsert collection: %w", err)
+	}
+	var releaseDate *time.Time
+	if !item.ReleaseDate.IsZero() {
+		releaseDate = &item.ReleaseDate
+	}
+	if _, err := store.database.Exec(ctx, `INSERT INTO collection_items (collection_id, media_id, season_number, release_date)
+VALUES ($1,$2,$3,$4)
+ON CONFLICT (collection_id, media_id) DO UPDATE SET
+season_number = EXCLUDED.season_number, release_date = COALESCE(EXCLUDED.release_date, collection_items.release_date),
+updated_at = NOW()`, collectionID, item.MediaID, item.SeasonNumber, releaseDate); err != nil {
+		return fmt.Errorf("save collection item: %w", err)
+	}
+	return nil
+}
+
+const collectionSelect = `SELECT id, kind, provider, external_id, name, overview, poster, backdrop FROM collections`
+
+// FindCollection 读取合集和全部成员，成员按季号、首映日期、年份排成观看顺序。
+func (store *PostgresStore) FindCollection(ctx context.Context, id int) (Collection, error) {
+	var collection Collection
+	err := store.database.QueryRow(ctx, collectionSelect+` WHERE id = $1`, id).Scan(&collection.ID, &collection.Kind,
+		&collection.Provider, &collection.ExternalID, &collection.Name, &collection.Overview, &collection.Poster, &collection.Backdrop)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Collection{}, ErrCollectionNotFound
+	}
+	if err != nil {
+		return Collection{}, fmt.Errorf("find collection: %w", err)
+	}
+	rows, err := store.database.Query(ctx, `SELECT media.id, media.douban_id, media.media_type, media.title, media.year,
+media.poster, COALESCE(NULLIF(media.rating_douban, 0), media.rating_tmdb), item.season_number, item.release_date
+FROM collection_items item
+JOIN media ON media.id = item.media_id
+WHERE item.collection_id = $1 AND media.merged_into_id IS NULL
+ORDER BY item.season_number, item.release_date NULLS LAST,
+CAST(substring(media.year FROM '[0-9]{4}') AS INTEGER) NULLS LAST, media.id`, id)
+	if err != nil {
+		return Collection{}, fmt.Errorf("list collection items: %w", err)
+	}
+	defer rows.Close()
+	collection.Items = []CollectionItem{}
+	for rows.Next() {
+		var item CollectionItem
+		var releaseDate *time.Time
+		if err := rows.Scan(&item.MediaID, &item.DoubanID, &item.MediaType, &item.Title, &item.Year,
+			&item.Poster, &item.Rating, &item.SeasonNumber, &releaseDate); err != nil {
+			return Collection{}, fmt.Errorf("scan collection item: %w", err)
+		}
+		if releaseDate != nil {
+			item.ReleaseDate = *releaseDate
+		}
+		collection.Items = append(collection.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return Collection{}, fmt.Errorf("iterate collection items: %w", err)
+	}
+	return collection, nil
+}
+
+// FindMediaCollection 返回作品所属的合集（不含成员）。同时属于多个合集时取剧集系列，
+// 一部作品被挂进电影合集又被当成某季的情况只会出自错误数据，系列更可信。
+func (store *PostgresStore) FindMediaCollection(ctx context.Context, mediaID int) (Collection, error) {
+	var collection Collection
+	err := store.database.QueryRow(ctx, `SELECT collections.id, kind, provider, external_id, name, overview, poster, backdrop
+FROM collections
+JOIN collection_items item ON item.collection_id = collections.id
+WHERE item.media_id = $1
+ORDER BY kind = 'series' DESC, collections.id
+LIMIT 1`, mediaID).Scan(&collection.ID, &collection.Kind, &collection.Provider, &collection.ExternalID,
+		&collection.Name, &collection.Overview, &collection.Poster, &collection.Backdrop)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Collection{}, ErrCollectionNotFound
+	}
+	if err != nil {
+		return Collection{}, fmt.Errorf("find media collection: %w", err)
+	}
+	return collection, nil
+}
+
+// ListCollectionProgress 返回用户在合集各成员上的进度：标记看过、正片播放进度到了完成线、
+// 或者（剧集的一季）每一集都到了完成线算 watched，有播放进度算 watching，没碰过的不出现在结果里。
+func (store *PostgresStore) ListCollectionProgress(ctx context.Context, userID, collectionID int) (map[int]string, error) {
+	rows, err := store.database.Query(ctx, `SELECT item.media_id,
+CASE WHEN EXISTS (
+    SELECT 1 FROM user_movies
+    WHERE user_movies.user_id = $1 AND user_movies.media_id = item.media_id AND user_movies.status = 'watched'
+) OR EXISTS (
+    SELECT 1 FROM playback_positions position
+    JOIN media_units unit ON unit.id = position.media_unit_id
+    WHERE position.user_id = $1 AND position.media_id = item.media_id AND position.deleted_at IS NULL
+      AND unit.unit_type = 'feature' AND (position.completed OR position.progress_percent >= $3)
+) OR (EXISTS (
+    SELECT 1 FROM media_units unit WHERE unit.media_id = item.media_id AND unit.unit_type = 'episode'
+) AND NOT EXISTS (
+    SELECT 1 FROM media_units unit
+    WHERE unit.media_id = item.media_id AND unit.unit_type = 'episode' AND NOT EXISTS (
+        SELECT 1 FROM playback_positions position
+        WHERE position.user_id = $1 AND position.media_unit_id = unit.id AND position.deleted_at IS NULL
+          AND (position.completed OR position.progress_percent >= $3)
+    )
+)) THEN 'watched' ELSE 'watching' END
+FROM collection_items item
+WHERE item.collection_id = $2 AND (
+    EXISTS (SELECT 1 FROM user_movies WHERE user_movies.user_id = $1 AND user_movies.media_id = item.media_id AND user_movies.status = 'watched')
+    OR EXISTS (SELECT 1 FROM playback_positions position WHERE position.user_id = $1 AND position.media_id = item.media_id AND position.deleted_at IS NULL)
+)`, userID, collectionID, CompletionPercent)
+	if err != nil {
+		return nil, fmt.Errorf("list collection progress: %w", err)
+	}
+	defer rows.Close()
+	progress := map[int]string{}
+	for rows.Next() {
+		var mediaID int
+		var state string
+		if err := rows.Scan(&mediaID, &state); err != nil {
+			return nil, fmt.Errorf("scan collection progress: %w", err)
+		}
+		progress[mediaID] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate collection progress: %w", err)
+	}
+	return progress, nil
+}
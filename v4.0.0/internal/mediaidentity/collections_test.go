@@ -0,0 +1,73 @@
+package mediaidentity
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
+)
+
+func TestAddToCollectionUpsertsCollectionThenItem(t *testing.T) {
+	executor := &identityFoundationExecutor{rowValues: []int{31}}
+	store := NewPostgresStore(executor)
+	if err := store.AddToCollection(t.Context(), Collection{Kind: CollectionSeries, Provider: " TMDB ", ExternalID: "125988", Name: " 末日地堡 "},
+		CollectionItem{MediaID: 7, SeasonNumber: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(executor.rowQueries) != 1 || !strings.Contains(executor.rowQueries[0], "ON CONFLICT (kind, provider, external_id)") {
+		t.Fatalf("collection queries = %#v", executor.rowQueries)
+	}
+	if arguments := executor.rowArguments[0]; arguments[1] != "tmdb" || arguments[3] != "末日地堡" {
+		t.Fatalf("collection arguments = %#v", arguments)
+	}
+	arguments := executor.execArguments[0]
+	if arguments[0] != 31 || arguments[1] != 7 || arguments[2] != 2 || arguments[3] != (*time.Time)(nil) {
+		t.Fatalf("item arguments = %#v", arguments)
+	}
+}
+
+func TestAddToCollectionRejectsIncompleteInputWithoutWriting(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	store := NewPostgresStore(executor)
+	for _, input := range []struct {
+		collection Collection
+		item       CollectionItem
+	}{
+		{Collection{Kind: "franchise", Provider: "tmdb", ExternalID: "1", Name: "未知类型"}, CollectionItem{MediaID: 7}},
+		{Collection{Kind: CollectionMovie, Provider: "tmdb", ExternalID: "1"}, CollectionItem{MediaID: 7}},
+		{Collection{Kind: CollectionMovie, Provider: "tmdb", ExternalID: "1", Name: "合集"}, CollectionItem{}},
+	} {
+		if err := store.AddToCollection(t.Context(), input.collection, input.item); err == nil {
+			t.Fatalf("AddToCollection(%+v, %+v) accepted invalid input", input.collection, input.item)
+		}
+	}
+	if len(executor.rowQueries)+len(executor.execQueries) != 0 {
+		t.Fatalf("invalid input reached the database: %#v %#v", executor.rowQueries, executor.execQueries)
+	}
+}
+
+func TestListCollectionProgressCountsFullyWatchedSeasons(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 1)
+	testdb.Media(t, pool, 1, 2, 3)
+	// 第一季两集都看完了，第二季只看完一集，第三季没碰过。
+	if _, err := pool.Exec(t.Context(), `INSERT INTO collections (id, kind, provider, external_id, name)
+VALUES (1, 'series', 'tmdb', '125988', '末日地堡');
+INSERT INTO collection_items (collection_id, media_id, season_number) VALUES (1, 1, 1), (1, 2, 2), (1, 3, 3);
+INSERT INTO media_units (id, media_id, unit_type, season_number, episode_number, episode_key) VALUES
+    (11, 1, 'episode', 1, 1, 'S01E01'), (12, 1, 'episode', 1, 2, 'S01E02'),
+    (21, 2, 'episode', 2, 1, 'S02E01'), (22, 2, 'episode', 2, 2, 'S02E02'),
+    (31, 3, 'episode', 3, 1, 'S03E01');
+INSERT INTO playback_positions (user_id, media_id, media_unit_id, progress_percent, completed) VALUES
+    (1, 1, 11, 100, TRUE), (1, 1, 12, 95, FALSE), (1, 2, 21, 100, TRUE)`); err != nil {
+		t.Fatal(err)
+	}
+	progress, err := NewPostgresStore(pool).ListCollectionProgress(t.Context(), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 2 || progress[1] != "watched" || progress[2] != "watching" {
+		t.Fatalf("progress = %#v", progress)
+	}
+}
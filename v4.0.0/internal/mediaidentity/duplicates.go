@@ -0,0 +1,759 @@
+package mediaidentity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// TaskDuplicateScan 是疑似重复作品扫描任务，每天跑一次，结果进后台复核队列。
+const TaskDuplicateScan = "media_duplicate_scan"
+
+const (
+	// DuplicateMinConfidence 是别名命中后进复核队列的最低分。片名、年份、类型全对是 0.65，
+	// 再有一项原名、演职员或季号对上才算疑似重复，免得同名不同片把队列塞满。
+	DuplicateMinConfidence = 0.7
+	// duplicateScanPairs 是一次扫描最多打分的作品对数，新作品优先。
+	duplicateScanPairs = 5000
+)
+
+var (
+	// ErrDuplicateCandidateNotFound 表示复核队列里没有这条记录，或者已经处理过。
+	ErrDuplicateCandidateNotFound = errors.New("duplicate candidate not found")
+	// ErrMediaMergeNotFound 表示合并记录不存在，或者已经拆分过。
+	ErrMediaMergeNotFound = errors.New("media merge not found")
+	// ErrInvalidMerge 表示合并参数不成立：同一部作品、保留的作品不在这一对里、某一方已被合并。
+	ErrInvalidMerge = errors.New("invalid media merge")
+)
+
+// DuplicateSide 是复核队列里一方作品的摘要，附带挂在它上面的资源数和片单数，方便决定保留哪一部。
+type DuplicateSide struct {
+	ID            int
+	DoubanID      string
+	Title         string
+	Year          string
+	MediaType     string
+	Poster        string
+	ResourceCount int
+	LibraryCount  int
+}
+
+// DetailKey 是详情页地址里的作品标识，规则与 catalog.Movie.DetailKey 一致。
+func (side DuplicateSide) DetailKey() string {
+	if side.DoubanID != "" {
+		return side.DoubanID
+	}
+	return "m" + strconv.Itoa(side.ID)
+}
+
+// DuplicateCandidate 是一对疑似重复的作品。Media 总是 ID 较小的一方。
+type DuplicateCandidate struct {
+	ID         int
+	Media      DuplicateSide
+	Duplicate  DuplicateSide
+	Confidence float64
+	MatchedBy  string
+	ReasonJSON string
+	Status     string
+	CreatedAt  time.Time
+}
+
+// MergeMoves 记录一次合并从被合并作品挪到保留作品的行键，拆分时按它原样挪回。
+// 保留作品上已有同键记录的行（同一外部 ID 命名空间、同名别名、同一集）不挪，留在原作品上。
+type MergeMoves struct {
+	ExternalIDs       []int64           `json:"external_ids,omitempty"`
+	Aliases           []int64           `json:"aliases,omitempty"`
+	Units             []int64           `json:"units,omitempty"`
+	EpisodeCandidates []movedUnitRow    `json:"episode_candidates,omitempty"`
+	PlaybackPositions []movedUnitRow    `json:"playback_positions,omitempty"`
+	ResourceLinks     []movedLink       `json:"resource_links,omitempty"`
+	UserMovies        []movedLibraryRow `json:"user_movies,omitempty"`
+}
+
+// movedUnitRow 是一条挪过的剧集级记录和它原来指向的 media_units.id。
+type movedUnitRow struct {
+	ID          int64  `json:"id"`
+	MediaUnitID *int64 `json:"media_unit_id"`
+}
+
+// movedLink 是一条挪过的资源映射。
+type movedLink struct {
+	SourceKey string `json:"source_key"`
+	VodID     string `json:"vod_id"`
+}
+
+// movedLibraryRow 是一条挪过的片单记录和它原来的 movie_id。
+type movedLibraryRow struct {
+	ID      int64  `json:"id"`
+	MovieID string `json:"movie_id"`
+}
+
+// Count 是合并挪动的总行数，后台列表用它展示合并规模。
+func (moves MergeMoves) Count() int {
+	return len(moves.ExternalIDs) + len(moves.Aliases) + len(moves.Units) + len(moves.EpisodeCandidates) +
+		len(moves.PlaybackPositions) + len(moves.ResourceLinks) + len(moves.UserMovies)
+}
+
+// MediaMerge 是一条合并留痕。SplitAt 非零表示已经拆分。
+type MediaMerge struct {
+	ID          int
+	Source      DuplicateSide
+	Target      DuplicateSide
+	CandidateID int
+	ActorUserID int
+	Reason      string
+	Moves       MergeMoves
+	MergedAt    time.Time
+	SplitReason string
+	SplitAt     time.Time
+}
+
+// Split 表示这次合并已经被拆分。
+func (merge MediaMerge) Split() bool { return !merge.SplitAt.IsZero() }
+
+// DuplicateReviewer 是后台重复作品复核需要的全部能力。
+type DuplicateReviewer interface {
+	ListDuplicateCandidates(ctx context.Context, status string, limit int) ([]DuplicateCandidate, error)
+	ListMediaMerges(ctx context.Context, limit int) ([]MediaMerge, error)
+	MergeDuplicate(ctx context.Context, candidateID, targetMediaID, actorUserID int, reason string) (MediaMerge, error)
+	DismissDuplicate(ctx context.Context, candidateID, actorUserID int) error
+	SplitMerge(ctx context.Context, mergeID, actorUserID int, reason string) error
+}
+
+// duplicatePair 是扫描出的一对作品，Left 的 ID 较小。SharedExternalID 非空表示两边挂着同一个外部 ID。
+type duplicatePair struct {
+	Left, Right      int
+	SharedExternalID string
+}
+
+// duplicateReason 是写进 reason_json 的打分说明。
+type duplicateReason struct {
+	SharedExternalID string          `json:"shared_external_id,omitempty"`
+	Score            json.RawMessage `json:"score"`
+}
+
+// DetectDuplicates 扫描疑似重复的作品写进复核队列，返回写入（或刷新）的条数。
+// 两条线索：同一个外部 ID 挂在两部作品上（季度命名空间除外，那是同剧不同季的正常共享），
+// 以及归一化别名完全相同的两部作品按资源匹配的加权打分够高。两条线索都要过打分的硬冲突检查，
+// 季号、年份、类型对不上的不算。已复核过的作品对不再重复进队列。
+func (store *PostgresStore) DetectDuplicates(ctx context.Context) (int, error) {
+	pairs, err := store.collectDuplicatePairs(ctx, `SELECT DISTINCT ON (left_id.media_id, right_id.media_id)
+    left_id.media_id, right_id.media_id, left_id.provider || ':' || left_id.external_id
+FROM media_external_ids left_id
+JOIN media_external_ids right_id ON right_id.provider = left_id.provider
+    AND right_id.external_id = left_id.external_id AND right_id.media_id > left_id.media_id
+JOIN media left_media ON left_media.id = left_id.media_id AND left_media.merged_into_id IS NULL
+JOIN media right_media ON right_media.id = right_id.media_id AND right_media.merged_into_id IS NULL
+WHERE left_id.external_type NOT LIKE 'tv_season_%' AND right_id.external_type NOT LIKE 'tv_season_%'
+  AND NOT EXISTS (SELECT 1 FROM media_duplicate_candidates reviewed
+      WHERE reviewed.media_id = left_id.media_id AND reviewed.duplicate_media_id = right_id.media_id
+        AND reviewed.status <> 'review')
+ORDER BY left_id.media_id, right_id.media_id
+LIMIT $1`, duplicateScanPairs)
+	if err != nil {
+		return 0, err
+	}
+	aliasPairs, err := store.collectDuplicatePairs(ctx, `SELECT DISTINCT left_alias.media_id, right_alias.media_id, ''
+FROM media_aliases left_alias
+JOIN media_aliases right_alias ON right_alias.normalized_alias = left_alias.normalized_alias
+    AND right_alias.media_id > left_alias.media_id
+JOIN media left_media ON left_media.id = left_alias.media_id AND left_media.merged_into_id IS NULL
+JOIN media right_media ON right_media.id = right_alias.media_id AND right_media.merged_into_id IS NULL
+WHERE left_alias.normalized_alias <> ''
+  AND NOT EXISTS (SELECT 1 FROM media_duplicate_candidates reviewed
+      WHERE reviewed.media_id = left_alias.media_id AND reviewed.duplicate_media_id = right_alias.media_id
+        AND reviewed.status <> 'review')
+ORDER BY right_alias.media_id DESC, left_alias.media_id DESC
+LIMIT $1`, duplicateScanPairs)
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[[2]int]bool, len(pairs))
+	for _, pair := range pairs {
+		seen[[2]int{pair.Left, pair.Right}] = true
+	}
+	for _, pair := range aliasPairs {
+		if !seen[[2]int{pair.Left, pair.Right}] {
+			pairs = append(pairs, pair)
+		}
+	}
+	if len(pairs) == 0 {
+		return 0, nil
+	}
+	media, err := store.loadDuplicateMedia(ctx, pairs)
+	if err != nil {
+		return 0, err
+	}
+	recorded := 0
+	for _, pair := range pairs {
+		left, leftOK := media[pair.Left]
+		right, rightOK := media[pair.Right]
+		if !leftOK || !rightOK {
+			continue
+		}
+		result, ok := scoreDuplicate(left, right, pair.SharedExternalID != "")
+		if !ok {
+			continue
+		}
+		matchedBy := result.MatchedBy
+		if pair.SharedExternalID != "" {
+			matchedBy = "shared_external_id"
+		}
+		reason, _ := json.Marshal(duplicateReason{SharedExternalID: pair.SharedExternalID, Score: json.RawMessage(result.ReasonJSON)})
+		if _, err := store.database.Exec(ctx, `INSERT INTO media_duplicate_candidates
+    (media_id, duplicate_media_id, confidence, matched_by, reason_json)
+VALUES ($1, $2, $3, $4, $5::jsonb)
+ON CONFLICT (media_id, duplicate_media_id) DO UPDATE SET
+    confidence = EXCLUDED.confidence, matched_by = EXCLUDED.matched_by,
+    reason_json = EXCLUDED.reason_json, updated_at = NOW()
+WHERE media_duplicate_candidates.status = 'review'`, pair.Left, pair.Right, result.Confidence, matchedBy, string(reason)); err != nil {
+			return recorded, fmt.Errorf("record duplicate candidate %d/%d: %w", pair.Left, pair.Right, err)
+		}
+		recorded++
+	}
+	return recorded, nil
+}
+
+// collectDuplicatePairs 读取扫描 SQL 返回的 (左 ID, 右 ID, 共享外部 ID) 三列。
+func (store *PostgresStore) collectDuplicatePairs(ctx context.Context, query string, arguments ...any) ([]duplicatePair, error) {
+	rows, err := store.database.Query(ctx, query, arguments...)
+	if err != nil {
+		return nil, fmt.Errorf("scan duplicate media: %w", err)
+	}
+	defer rows.Close()
+	var pairs []duplicatePair
+	for rows.Next() {
+		var pair duplicatePair
+		if err := rows.Scan(&pair.Left, &pair.Right, &pair.SharedExternalID); err != nil {
+			return nil, fmt.Errorf("scan duplicate media pair: %w", err)
+		}
+		pairs = append(pairs, pair)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate duplicate media pairs: %w", err)
+	}
+	return pairs, nil
+}
+
+// loadDuplicateMedia 批量读取扫描出的作品并附上演职员表，供打分时比对人名。
+func (store *PostgresStore) loadDuplicateMedia(ctx context.Context, pairs []duplicatePair) (map[int]Media, error) {
+	ids := make([]int, 0, len(pairs)*2)
+	seen := make(map[int]bool, len(pairs)*2)
+	for _, pair := range pairs {
+		for _, id := range []int{pair.Left, pair.Right} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	rows, err := store.database.Query(ctx, mediaSelect+` WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("load duplicate media: %w", err)
+	}
+	defer rows.Close()
+	media := make(map[int]Media, len(ids))
+	for rows.Next() {
+		var item Media
+		if err := scanMedia(rows, &item); err != nil {
+			return nil, fmt.Errorf("scan duplicate media: %w", err)
+		}
+		media[item.ID] = item
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate duplicate media: %w", err)
+	}
+	rows.Close()
+	credits, err := store.ListCreditsForMedia(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, item := range media {
+		item.Credits = credits[id]
+		media[id] = item
+	}
+	return media, nil
+}
+
+// scoreDuplicate 用资源匹配的加权打分比较两部作品：把一方当成「资源」去匹配另一方。
+// 有硬冲突的一律不算；共享外部 ID 的对不看分数，只要没有硬冲突就进队列。
+func scoreDuplicate(left, right Media, sharedExternalID bool) (MatchResult, bool) {
+	result := ScoreResourceMatch(duplicateInput(left), right)
+	if result.HardConflict != "" {
+		return result, false
+	}
+	if sharedExternalID {
+		result.Confidence = 1
+		return result, true
+	}
+	return result, result.Confidence >= DuplicateMinConfidence
+}
+
+// duplicateInput 把作品转成匹配输入。演职员优先取 media_credits，没有时退回 JSON 里的名字。
+func duplicateInput(media Media) MatchInput {
+	return MatchInput{
+		Title:         media.Title,
+		OriginalTitle: media.OriginalTitle,
+		Year:          media.Year,
+		MediaType:     media.MediaType,
+		Directors:     duplicatePeople(media.Directors, media.Credits, CreditDirector),
+		Actors:        duplicatePeople(media.Actors, media.Credits, CreditActor),
+	}
+}
+
+// duplicatePeople 取某一角色的人名，逗号拼成资源站那种人名串。
+func duplicatePeople(raw string, credits []Credit, role string) string {
+	names := make([]string, 0, len(credits))
+	for _, credit := range credits {
+		if credit.Role == role && credit.Person.Name != "" {
+			names = append(names, credit.Person.Name)
+		}
+	}
+	if len(names) > 0 {
+		return strings.Join(names, ",")
+	}
+	var listed []struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal([]byte(raw), &listed) != nil {
+		return raw
+	}
+	for _, person := range listed {
+		if person.Name != "" {
+			names = append(names, person.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// duplicateSideColumns 是复核列表里一方作品的列，字段顺序与 scanDuplicateSide 一致。
+func duplicateSideColumns(alias string) string {
+	return alias + `.id, ` + alias + `.douban_id, ` + alias + `.title, ` + alias + `.year, ` + alias + `.media_type, ` + alias + `.poster,
+    (SELECT COUNT(*) FROM resource_media_links link WHERE link.media_id = ` + alias + `.id),
+    (SELECT COUNT(*) FROM user_movies entry WHERE entry.media_id = ` + alias + `.id)`
+}
+
+func duplicateSideTargets(side *DuplicateSide) []any {
+	return []any{&side.ID, &side.DoubanID, &side.Title, &side.Year, &side.MediaType, &side.Poster, &side.ResourceCount, &side.LibraryCount}
+}
+
+// ListDuplicateCandidates 按分数从高到低列出某个状态的复核记录。
+// 待复核列表跳过已经被合并掉的作品，合并其中一对后与它相关的其他记录自然消失。
+func (store *PostgresStore) ListDuplicateCandidates(ctx context.Context, status string, limit int) ([]DuplicateCandidate, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 100
+	}
+	rows, err := store.database.Query(ctx, `SELECT candidate.id, candidate.confidence::float8, candidate.matched_by,
+    candidate.reason_json::text, candidate.status, candidate.created_at,
+    `+duplicateSideColumns("left_media")+`,
+    `+duplicateSideColumns("right_media")+`
+FROM media_duplicate_candidates candidate
+JOIN media left_media ON left_media.id = candidate.media_id
+JOIN media right_media ON right_media.id = candidate.duplicate_media_id
+WHERE candidate.status = $1
+  AND ($1 <> 'review' OR (left_media.merged_into_id IS NULL AND right_media.merged_into_id IS NULL))
+ORDER BY candidate.confidence DESC, candidate.id DESC
+LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list duplicate candidates: %w", err)
+	}
+	defer rows.Close()
+	var candidates []DuplicateCandidate
+	for rows.Next() {
+		var candidate DuplicateCandidate
+		targets := []any{&candidate.ID, &candidate.Confidence, &candidate.MatchedBy, &candidate.ReasonJSON, &candidate.Status, &candidate.CreatedAt}
+		targets = append(targets, duplicateSideTargets(&candidate.Media)...)
+		targets = append(targets, duplicateSideTargets(&candidate.Duplicate)...)
+		if err := rows.Scan(targets...); err != nil {
+			return nil, fmt.Errorf("scan duplicate candidate: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate duplicate candidates: %w", err)
+	}
+	return candidates, nil
+}
+
+// ListMediaMerges 列出最近的合并记录（含已拆分的），供后台拆分。
+func (store *PostgresStore) ListMediaMerges(ctx context.Context, limit int) ([]MediaMerge, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := store.database.Query(ctx, `SELECT merged.id, COALESCE(merged.candidate_id, 0), COALESCE(merged.actor_user_id, 0),
+    merged.reason, merged.moved::text, merged.merged_at, merged.split_reason, merged.split_at,
+    `+duplicateSideColumns("source")+`,
+    `+duplicateSideColumns("target")+`
+FROM media_merges merged
+JOIN media source ON source.id = merged.source_media_id
+JOIN media target ON target.id = merged.target_media_id
+ORDER BY merged.merged_at DESC, merged.id DESC
+LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list media merges: %w", err)
+	}
+	defer rows.Close()
+	var merges []MediaMerge
+	for rows.Next() {
+		var merge MediaMerge
+		var moved string
+		var splitAt *time.Time
+		targets := []any{&merge.ID, &merge.CandidateID, &merge.ActorUserID, &merge.Reason, &moved, &merge.MergedAt, &merge.SplitReason, &splitAt}
+		targets = append(targets, duplicateSideTargets(&merge.Source)...)
+		targets = append(targets, duplicateSideTargets(&merge.Target)...)
+		if err := rows.Scan(targets...); err != nil {
+			return nil, fmt.Errorf("scan media merge: %w", err)
+		}
+		if err := json.Unmarshal([]byte(moved), &merge.Moves); err != nil {
+			return nil, fmt.Errorf("decode media merge %d: %w", merge.ID, err)
+		}
+		if splitAt != nil {
+			merge.SplitAt = *splitAt
+		}
+		merges = append(merges, merge)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate media merges: %w", err)
+	}
+	return merges, nil
+}
+
+// DismissDuplicate 把一对作品标记为「不是重复」，之后扫描不再把它放回队列。
+func (store *PostgresStore) DismissDuplicate(ctx context.Context, candidateID, actorUserID int) error {
+	affected, err := store.database.Exec(ctx, `UPDATE media_duplicate_candidates
+SET status = 'dismissed', reviewed_by = $2, reviewed_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'review'`, candidateID, nullableMediaID(actorUserID))
+	if err != nil {
+		return fmt.Errorf("dismiss duplicate candidate: %w", err)
+	}
+	if affected == 0 {
+		return ErrDuplicateCandidateNotFound
+	}
+	return nil
+}
+
+// MergeDuplicate 采纳一条复核记录：保留 targetMediaID，把这一对里的另一部并进去。
+// 整个合并在一个事务里完成，挪了哪些行记在 media_merges.moved 里，SplitMerge 按它撤销。
+func (store *PostgresStore) MergeDuplicate(ctx context.Context, candidateID, targetMediaID, actorUserID int, reason string) (MediaMerge, error) {
+	if store.beginner == nil {
+		return MediaMerge{}, errors.New("media merge requires transaction support")
+	}
+	transaction, err := store.beginner.Begin(ctx)
+	if err != nil {
+		return MediaMerge{}, fmt.Errorf("begin media merge: %w", err)
+	}
+	defer transaction.Rollback(context.WithoutCancel(ctx))
+
+	var leftID, rightID int
+	if err := transaction.QueryRow(ctx, `SELECT media_id, duplicate_media_id FROM media_duplicate_candidates
+WHERE id = $1 AND status = 'review' FOR UPDATE`, candidateID).Scan(&leftID, &rightID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return MediaMerge{}, ErrDuplicateCandidateNotFound
+		}
+		return MediaMerge{}, fmt.Errorf("load duplicate candidate: %w", err)
+	}
+	sourceID := leftID
+	switch targetMediaID {
+	case leftID:
+		sourceID = rightID
+	case rightID:
+	default:
+		return MediaMerge{}, ErrInvalidMerge
+	}
+	merge, err := mergeMedia(ctx, transaction, sourceID, targetMediaID)
+	if err != nil {
+		return MediaMerge{}, err
+	}
+	merge.CandidateID, merge.ActorUserID, merge.Reason = candidateID, actorUserID, reason
+	moved, err := json.Marshal(merge.Moves)
+	if err != nil {
+		return MediaMerge{}, fmt.Errorf("encode media merge: %w", err)
+	}
+	if err := transaction.QueryRow(ctx, `INSERT INTO media_merges
+    (source_media_id, target_media_id, candidate_id, actor_user_id, reason, moved)
+VALUES ($1, $2, $3, $4, $5, $6::jsonb) RETURNING id, merged_at`,
+		sourceID, targetMediaID, candidateID, nullableMediaID(actorUserID), reason, string(moved)).Scan(&merge.ID, &merge.MergedAt); err != nil {
+		return MediaMerge{}, fmt.Errorf("record media merge: %w", err)
+	}
+	if _, err := transaction.Exec(ctx, `UPDATE media_duplicate_candidates
+SET status = 'merged', reviewed_by = $2, reviewed_at = NOW(), updated_at = NOW() WHERE id = $1`,
+		candidateID, nullableMediaID(actorUserID)); err != nil {
+		return MediaMerge{}, fmt.Errorf("update duplicate candidate: %w", err)
+	}
+	if err := transaction.Commit(ctx); err != nil {
+		return MediaMerge{}, fmt.Errorf("commit media merge: %w", err)
+	}
+	return merge, nil
+}
+
+// mergeMedia 在事务里把 sourceID 的外部 ID、别名、剧集、资源映射、片单和播放进度挪到 targetID，
+// 最后把 sourceID 标记为已并入。被合并的作品行保留：挪不过去的冲突行还挂在它上面，拆分时也要用回它。
+// 两边同一集各有一条 media_units 时，引用那一集的剧集候选和播放进度改指保留作品的那一集，原值记进留痕。
+func mergeMedia(ctx context.Context, executor database.Executor, sourceID, targetID int) (MediaMerge, error) {
+	if sourceID <= 0 || targetID <= 0 || sourceID == targetID {
+		return MediaMerge{}, ErrInvalidMerge
+	}
+	merge := MediaMerge{Source: DuplicateSide{ID: sourceID}, Target: DuplicateSide{ID: targetID}}
+	// 按 ID 顺序加锁，两个管理员同时反向合并同一对时不会死锁。
+	lockOrder := []*DuplicateSide{&merge.Source, &merge.Target}
+	if targetID < sourceID {
+		lockOrder[0], lockOrder[1] = lockOrder[1], lockOrder[0]
+	}
+	for _, side := range lockOrder {
+		var mergedInto int
+		if err := executor.QueryRow(ctx, `SELECT douban_id, title, COALESCE(merged_into_id, 0) FROM media WHERE id = $1 FOR UPDATE`,
+			side.ID).Scan(&side.DoubanID, &side.Title, &mergedInto); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return MediaMerge{}, ErrInvalidMerge
+			}
+			return MediaMerge{}, fmt.Errorf("lock media %d: %w", side.ID, err)
+		}
+		if mergedInto != 0 {
+			return MediaMerge{}, ErrInvalidMerge
+		}
+	}
+
+	var err error
+	moves := &merge.Moves
+	if moves.ExternalIDs, err = collectMovedIDs(ctx, executor, `UPDATE media_external_ids moved
+SET media_id = $2, updated_at = NOW()
+WHERE moved.media_id = $1 AND NOT EXISTS (
+    SELECT 1 FROM media_external_ids kept
+    WHERE kept.media_id = $2 AND kept.provider = moved.provider AND kept.external_type = moved.external_type)
+RETURNING moved.id`, sourceID, targetID); err != nil {
+		return MediaMerge{}, fmt.Errorf("move external IDs: %w", err)
+	}
+	if moves.Aliases, err = collectMovedIDs(ctx, executor, `UPDATE media_aliases moved
+SET media_id = $2, updated_at = NOW()
+WHERE moved.media_id = $1 AND NOT EXISTS (
+    SELECT 1 FROM media_aliases kept WHERE kept.media_id = $2 AND kept.normalized_alias = moved.normalized_alias)
+RETURNING moved.id`, sourceID, targetID); err != nil {
+		return MediaMerge{}, fmt.Errorf("move aliases: %w", err)
+	}
+	if moves.Units, err = collectMovedIDs(ctx, executor, `UPDATE media_units moved
+SET media_id = $2, updated_at = NOW()
+WHERE moved.media_id = $1 AND NOT EXISTS (
+    SELECT 1 FROM media_units kept
+    WHERE kept.media_id = $2 AND kept.unit_type = moved.unit_type
+      AND kept.season_number = moved.season_number AND kept.episode_key = moved.episode_key)
+RETURNING moved.id`, sourceID, targetID); err != nil {
+		return MediaMerge{}, fmt.Errorf("move media units: %w", err)
+	}
+	// 上面挪完以后还留在 sourceID 上的剧集都是冲突的那一集，keptUnitJoin 把它们映射到保留作品的同一集。
+	const keptUnitJoin = `LEFT JOIN media_units unit ON unit.id = original.media_unit_id AND unit.media_id = $1
+LEFT JOIN media_units kept ON kept.media_id = $2 AND kept.unit_type = unit.unit_type
+    AND kept.season_number = unit.season_number AND kept.episode_key = unit.episode_key`
+	if moves.EpisodeCandidates, err = collectMovedUnitRows(ctx, executor, `UPDATE resource_episode_candidates candidate
+SET media_id = $2, media_unit_id = COALESCE(kept.id, original.media_unit_id), updated_at = NOW()
+FROM resource_episode_candidates original
+`+keptUnitJoin+`
+WHERE candidate.id = original.id AND original.media_id = $1
+RETURNING candidate.id, original.media_unit_id`, sourceID, targetID); err != nil {
+		return MediaMerge{}, fmt.Errorf("move episode candidates: %w", err)
+	}
+	// 同一个用户在两边同一集都有进度时不挪，避免撞唯一索引；留在原作品上的那条拆分后还能用。
+	if moves.PlaybackPositions, err = collectMovedUnitRows(ctx, executor, `UPDATE playback_positions position
+SET media_id = $2, media_unit_id = COALESCE(kept.id, original.media_unit_id), updated_at = NOW()
+FROM playback_positions original
+`+keptUnitJoin+`
+WHERE position.id = original.id AND original.media_id = $1
+  AND NOT EXISTS (
+    SELECT 1 FROM playback_positions other
+    WHERE other.user_id = original.user_id AND other.id <> original.id AND (
+        (COALESCE(kept.id, original.media_unit_id) IS NOT NULL AND other.media_unit_id = COALESCE(kept.id, original.media_unit_id))
+        OR (original.media_unit_id IS NULL AND other.media_unit_id IS NULL AND other.media_id = $2
+            AND other.season_number = original.season_number AND other.episode_key = original.episode_key)))
+RETURNING position.id, original.media_unit_id`, sourceID, targetID); err != nil {
+		return MediaMerge{}, fmt.Errorf("move playback positions: %w", err)
+	}
+	rows, err := executor.Query(ctx, `UPDATE resource_media_links SET media_id = $2, updated_at = NOW()
+WHERE media_id = $1 RETURNING source_key, vod_id`, sourceID, targetID)
+	if err != nil {
+		return MediaMerge{}, fmt.Errorf("move resource links: %w", err)
+	}
+	for rows.Next() {
+		var link movedLink
+		if err := rows.Scan(&link.SourceKey, &link.VodID); err != nil {
+			rows.Close()
+			return MediaMerge{}, fmt.Errorf("scan moved resource link: %w", err)
+		}
+		moves.ResourceLinks = append(moves.ResourceLinks, link)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return MediaMerge{}, fmt.Errorf("move resource links: %w", err)
+	}
+	// 片单以 movie_id（详情页标识）为键，挪过去时一并改成保留作品的标识；用户两边都标过的不挪。
+	rows, err = executor.Query(ctx, `UPDATE user_movies entry
+SET media_id = $2, movie_id = $3, updated_at = NOW()
+FROM user_movies original
+WHERE entry.id = original.id AND original.media_id = $1
+  AND original.id = (SELECT MIN(same.id) FROM user_movies same WHERE same.user_id = original.user_id AND same.media_id = $1)
+  AND NOT EXISTS (
+    SELECT 1 FROM user_movies other
+    WHERE other.user_id = original.user_id AND (other.media_id = $2 OR other.movie_id = $3))
+RETURNING entry.id, original.movie_id`, sourceID, targetID, merge.Target.DetailKey())
+	if err != nil {
+		return MediaMerge{}, fmt.Errorf("move library entries: %w", err)
+	}
+	for rows.Next() {
+		var entry movedLibraryRow
+		if err := rows.Scan(&entry.ID, &entry.MovieID); err != nil {
+			rows.Close()
+			return MediaMerge{}, fmt.Errorf("scan moved library entry: %w", err)
+		}
+		moves.UserMovies = append(moves.UserMovies, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return MediaMerge{}, fmt.Errorf("move library entries: %w", err)
+	}
+	if _, err := executor.Exec(ctx, `UPDATE media SET merged_into_id = $2, updated_at = NOW() WHERE id = $1`, sourceID, targetID); err != nil {
+		return MediaMerge{}, fmt.Errorf("mark merged media: %w", err)
+	}
+	return merge, nil
+}
+
+// SplitMerge 撤销一次合并：按留痕把挪走的行挪回原作品，解除并入标记，并把那对作品标为「不是重复」。
+// 只挪回留痕里记下且仍挂在保留作品上的行，合并之后新产生的数据留在保留作品上。
+func (store *PostgresStore) SplitMerge(ctx context.Context, mergeID, actorUserID int, reason string) error {
+	if store.beginner == nil {
+		return errors.New("media split requires transaction support")
+	}
+	transaction, err := store.beginner.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin media split: %w", err)
+	}
+	defer transaction.Rollback(context.WithoutCancel(ctx))
+
+	var sourceID, targetID, candidateID int
+	var moved string
+	if err := transaction.QueryRow(ctx, `SELECT source_media_id, target_media_id, COALESCE(candidate_id, 0), moved::text
+FROM media_merges WHERE id = $1 AND split_at IS NULL FOR UPDATE`, mergeID).Scan(&sourceID, &targetID, &candidateID, &moved); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMediaMergeNotFound
+		}
+		return fmt.Errorf("load media merge: %w", err)
+	}
+	var moves MergeMoves
+	if err := json.Unmarshal([]byte(moved), &moves); err != nil {
+		return fmt.Errorf("decode media merge %d: %w", mergeID, err)
+	}
+	var mergedInto int
+	if err := transaction.QueryRow(ctx, `SELECT COALESCE(merged_into_id, 0) FROM media WHERE id = $1 FOR UPDATE`, sourceID).Scan(&mergedInto); err != nil {
+		return fmt.Errorf("lock merged media: %w", err)
+	}
+	if mergedInto != targetID {
+		return ErrInvalidMerge
+	}
+	for _, table := range []struct {
+		name string
+		ids  []int64
+	}{{"media_external_ids", moves.ExternalIDs}, {"media_aliases", moves.Aliases}, {"media_units", moves.Units}} {
+		if len(table.ids) == 0 {
+			continue
+		}
+		if _, err := transaction.Exec(ctx, `UPDATE `+table.name+` SET media_id = $1, updated_at = NOW()
+WHERE id = ANY($2) AND media_id = $3`, sourceID, table.ids, targetID); err != nil {
+			return fmt.Errorf("restore %s: %w", table.name, err)
+		}
+	}
+	restores := []struct {
+		name  string
+		rows  any
+		count int
+		query string
+	}{
+		{"episode candidates", moves.EpisodeCandidates, len(moves.EpisodeCandidates), `UPDATE resource_episode_candidates candidate
+SET media_id = $1, media_unit_id = moved.media_unit_id, updated_at = NOW()
+FROM jsonb_to_recordset($2::jsonb) AS moved(id BIGINT, media_unit_id BIGINT)
+WHERE candidate.id = moved.id AND candidate.media_id = $3`},
+		{"playback positions", moves.PlaybackPositions, len(moves.PlaybackPositions), `UPDATE playback_positions position
+SET media_id = $1, media_unit_id = moved.media_unit_id, updated_at = NOW()
+FROM jsonb_to_recordset($2::jsonb) AS moved(id BIGINT, media_unit_id BIGINT)
+WHERE position.id = moved.id AND position.media_id = $3`},
+		{"resource links", moves.ResourceLinks, len(moves.ResourceLinks), `UPDATE resource_media_links link
+SET media_id = $1, updated_at = NOW()
+FROM jsonb_to_recordset($2::jsonb) AS moved(source_key TEXT, vod_id TEXT)
+WHERE link.source_key = moved.source_key AND link.vod_id = moved.vod_id AND link.media_id = $3`},
+		{"library entries", moves.UserMovies, len(moves.UserMovies), `UPDATE user_movies entry
+SET media_id = $1, movie_id = moved.movie_id, updated_at = NOW()
+FROM jsonb_to_recordset($2::jsonb) AS moved(id BIGINT, movie_id TEXT)
+WHERE entry.id = moved.id AND entry.media_id = $3
+  AND NOT EXISTS (SELECT 1 FROM user_movies other
+      WHERE other.user_id = entry.user_id AND other.id <> entry.id AND other.movie_id = moved.movie_id)`},
+	}
+	for _, restore := range restores {
+		if restore.count == 0 {
+			continue
+		}
+		payload, err := json.Marshal(restore.rows)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", restore.name, err)
+		}
+		if _, err := transaction.Exec(ctx, restore.query, sourceID, string(payload), targetID); err != nil {
+			return fmt.Errorf("restore %s: %w", restore.name, err)
+		}
+	}
+	if _, err := transaction.Exec(ctx, `UPDATE media SET merged_into_id = NULL, updated_at = NOW() WHERE id = $1`, sourceID); err != nil {
+		return fmt.Errorf("unmark merged media: %w", err)
+	}
+	if _, err := transaction.Exec(ctx, `UPDATE media_merges SET split_by = $2, split_reason = $3, split_at = NOW() WHERE id = $1`,
+		mergeID, nullableMediaID(actorUserID), reason); err != nil {
+		return fmt.Errorf("record media split: %w", err)
+	}
+	if candidateID > 0 {
+		if _, err := transaction.Exec(ctx, `UPDATE media_duplicate_candidates
+SET status = 'dismissed', reviewed_by = $2, reviewed_at = NOW(), updated_at = NOW() WHERE id = $1`,
+			candidateID, nullableMediaID(actorUserID)); err != nil {
+			return fmt.Errorf("update duplicate candidate: %w", err)
+		}
+	}
+	if err := transaction.Commit(ctx); err != nil {
+		return fmt.Errorf("commit media split: %w", err)
+	}
+	return nil
+}
+
+// collectMovedIDs 执行一条 RETURNING id 的 UPDATE，收集挪过的行 ID。
+func collectMovedIDs(ctx context.Context, executor database.Executor, query string, arguments ...any) ([]int64, error) {
+	rows, err := executor.Query(ctx, query, arguments...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// collectMovedUnitRows 执行一条 RETURNING id, 原 media_unit_id 的 UPDATE。
+func collectMovedUnitRows(ctx context.Context, executor database.Executor, query string, arguments ...any) ([]movedUnitRow, error) {
+	rows, err := executor.Query(ctx, query, arguments...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var moved []movedUnitRow
+	for rows.Next() {
+		var row movedUnitRow
+		if err := rows.Scan(&row.ID, &row.MediaUnitID); err != nil {
+			return nil, err
+		}
+		moved = append(moved, row)
+	}
+	return moved, rows.Err()
+}
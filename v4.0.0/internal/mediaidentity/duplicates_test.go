@@ -0,0 +1,95 @@
+package mediaidentity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestScoreDuplicateRejectsHardConflictsAndLowScores(t *testing.T) {
+	douban := Media{ID: 1, Title: "肖申克的救赎", OriginalTitle: "The Shawshank Redemption", Year: "1994", MediaType: "movie"}
+	tmdb := Media{ID: 2, Title: "肖申克的救赎", OriginalTitle: "The Shawshank Redemption", Year: "1994", MediaType: "movie"}
+	if result, ok := scoreDuplicate(douban, tmdb, false); !ok || result.Confidence < 0.9 {
+		t.Fatalf("same movie = %+v/%v", result, ok)
+	}
+	remake := tmdb
+	remake.Year, remake.OriginalTitle = "2024", ""
+	if result, ok := scoreDuplicate(douban, remake, false); ok {
+		t.Fatalf("remake years apart should not be a duplicate: %+v", result)
+	}
+	// 同剧不同季即使挂着同一个整剧 IMDb ID，季号对不上也不算重复。
+	seasonOne := Media{ID: 3, Title: "漫长的季节 第一季", Year: "2023", MediaType: "tv"}
+	seasonTwo := Media{ID: 4, Title: "漫长的季节 第二季", Year: "2023", MediaType: "tv"}
+	if result, ok := scoreDuplicate(seasonOne, seasonTwo, true); ok {
+		t.Fatalf("different seasons sharing an external ID = %+v", result)
+	}
+	sameSeries := Media{ID: 5, Title: "漫长的季节", Year: "2023", MediaType: "tv"}
+	if result, ok := scoreDuplicate(sameSeries, Media{ID: 6, Title: "漫长的季节", Year: "2023", MediaType: "tv"}, false); ok {
+		t.Fatalf("title/year/type alone should stay below threshold: %+v", result)
+	}
+	if result, ok := scoreDuplicate(sameSeries, Media{ID: 6, Title: "漫长的季节", Year: "2023", MediaType: "tv"}, true); !ok || result.Confidence != 1 {
+		t.Fatalf("shared external ID without conflicts = %+v/%v", result, ok)
+	}
+}
+
+func TestDuplicateInputPrefersCreditsOverJSON(t *testing.T) {
+	media := Media{
+		Directors: `[{"name":"弗兰克·德拉邦特"}]`,
+		Actors:    `[{"name":"蒂姆·罗宾斯"},{"name":"摩根·弗里曼"}]`,
+		Credits:   []Credit{{Role: CreditDirector, Person: Person{Name: "Frank Darabont"}}},
+	}
+	input := duplicateInput(media)
+	if input.Directors != "Frank Darabont" || input.Actors != "蒂姆·罗宾斯,摩根·弗里曼" {
+		t.Fatalf("input = %+v", input)
+	}
+}
+
+func TestMergeMovesEncodeRecordsetColumns(t *testing.T) {
+	unitID := int64(31)
+	moves := MergeMoves{
+		ExternalIDs:       []int64{1},
+		EpisodeCandidates: []movedUnitRow{{ID: 2, MediaUnitID: &unitID}},
+		PlaybackPositions: []movedUnitRow{{ID: 3}},
+		ResourceLinks:     []movedLink{{SourceKey: "demo", VodID: "42"}},
+		UserMovies:        []movedLibraryRow{{ID: 4, MovieID: "1292052"}},
+	}
+	encoded, err := json.Marshal(moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SplitMerge 用 jsonb_to_recordset 读这些键，改名会让拆分静默地什么都不挪。
+	for _, expected := range []string{`"episode_candidates":[{"id":2,"media_unit_id":31}]`, `"playback_positions":[{"id":3,"media_unit_id":null}]`,
+		`"resource_links":[{"source_key":"demo","vod_id":"42"}]`, `"user_movies":[{"id":4,"movie_id":"1292052"}]`} {
+		if !strings.Contains(string(encoded), expected) {
+			t.Fatalf("moves JSON missing %s: %s", expected, encoded)
+		}
+	}
+	if strings.Contains(string(encoded), "aliases") || moves.Count() != 5 {
+		t.Fatalf("moves = %s (%d)", encoded, moves.Count())
+	}
+}
+
+func TestMergeRequiresTransactionsAndTwoDistinctMedia(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	store := NewPostgresStore(executor)
+	if _, err := store.MergeDuplicate(context.Background(), 1, 2, 1, ""); err == nil || !strings.Contains(err.Error(), "transaction") {
+		t.Fatalf("merge without transactions = %v", err)
+	}
+	if err := store.SplitMerge(context.Background(), 1, 1, ""); err == nil {
+		t.Fatal("split without transactions should fail")
+	}
+	if _, err := mergeMedia(context.Background(), executor, 7, 7); !errors.Is(err, ErrInvalidMerge) {
+		t.Fatalf("self merge = %v", err)
+	}
+	if len(executor.execQueries)+len(executor.rowQueries) != 0 {
+		t.Fatalf("invalid merges touched the database: %v %v", executor.execQueries, executor.rowQueries)
+	}
+	if err := store.DismissDuplicate(context.Background(), 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(executor.execArguments) != 1 || executor.execArguments[0][1] != nil || !strings.Contains(executor.execQueries[0], "status = 'review'") {
+		t.Fatalf("dismiss = %v %v", executor.execQueries, executor.execArguments)
+	}
+}
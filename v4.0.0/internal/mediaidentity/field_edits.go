@@ -0,0 +1,332 @@
+package mediaidentity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// 管理员修改以 manual 来源写入，优先级压过所有 Provider（见 sourceFields）。
+const (
+	ManualProvider = "manual"
+	ManualPriority = 1000
+)
+
+// ErrFieldNotEditable 表示字段不在编辑器允许修改的范围内，或值的格式不对。
+var ErrFieldNotEditable = errors.New("field is not editable")
+
+// ErrFieldChangeNotFound 表示要回滚的历史记录不存在，或不属于这部作品。
+var ErrFieldChangeNotFound = errors.New("field change not found")
+
+// EditableField 是编辑器里的一个字段。Numeric 的字段按数字校验和回写。
+type EditableField struct {
+	Name    string
+	Label   string
+	Numeric bool
+}
+
+// EditableFields 是后台编辑器允许修改的字段，顺序就是页面上的顺序。
+// media_type 和 vote_count_tmdb 不在里面：前者改了会牵动季集和外部 ID，后者没有人工修正的意义。
+var EditableFields = []EditableField{
+	{Name: "title", Label: "片名"}, {Name: "original_title", Label: "原名"}, {Name: "year", Label: "年份"},
+	{Name: "poster", Label: "海报"}, {Name: "backdrops", Label: "剧照"}, {Name: "summary", Label: "简介"},
+	{Name: "genres", Label: "类型"}, {Name: "countries", Label: "国家/地区"}, {Name: "directors", Label: "导演"},
+	{Name: "actors", Label: "演员"}, {Name: "duration", Label: "片长"}, {Name: "series_status", Label: "连载状态"},
+	{Name: "rating_douban", Label: "豆瓣评分", Numeric: true}, {Name: "rating_tmdb", Label: "TMDB 评分", Numeric: true},
+}
+
+// FieldSource 是字段当前的获胜来源。Locked 的字段 Provider 刷新不再改写。
+type FieldSource struct {
+	Field      string
+	Provider   string
+	Priority   int
+	Locked     bool
+	ObservedAt time.Time
+}
+
+// FieldChange 是一条字段变更历史。ActorUserID 只有管理员修改才有；
+// OldValue / NewValue 为 nil 表示那一刻这一列还没有值。
+type FieldChange struct {
+	ID          int
+	MediaID     int
+	Field       string
+	Provider    string
+	ActorUserID int
+	OldValue    *string
+	NewValue    *string
+	CreatedAt   time.Time
+}
+
+// Manual 表示这是管理员的修改。
+func (change FieldChange) Manual() bool {
+	return change.Provider == ManualProvider
+}
+
+// MetadataEditor 是后台元数据编辑器用的读写接口。
+type MetadataEditor interface {
+	FindByID(ctx context.Context, id int) (Media, error)
+	ListFieldSources(ctx context.Context, mediaID int) (map[string]FieldSource, error)
+	EditFields(ctx context.Context, mediaID, actorUserID int, values map[string]string) ([]string, error)
+	SetFieldLock(ctx context.Context, mediaID int, field string, locked bool) error
+	ListFieldHistory(ctx context.Context, mediaID, limit int) ([]FieldChange, error)
+	RevertFieldChange(ctx context.Context, mediaID, changeID, actorUserID int) error
+}
+
+// LookupEditableField 按列名找可编辑字段。
+func LookupEditableField(name string) (EditableField, bool) {
+	for _, field := range EditableFields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return EditableField{}, false
+}
+
+// FieldValue 返回字段当前值的文本形式，和编辑器表单、变更历史里的写法一致。
+func (media Media) FieldValue(name string) string {
+	switch name {
+	case "title":
+		return media.Title
+	case "original_title":
+		return media.OriginalTitle
+	case "year":
+		return media.Year
+	case "poster":
+		return media.Poster
+	case "backdrops":
+		return media.Backdrops
+	case "summary":
+		return media.Summary
+	case "genres":
+		return media.Genres
+	case "countries":
+		return media.Countries
+	case "directors":
+		return media.Directors
+	case "actors":
+		return media.Actors
+	case "duration":
+		return media.Duration
+	case "series_status":
+		return media.SeriesStatus
+	case "rating_douban":
+		return strconv.FormatFloat(media.RatingDouban, 'f', -1, 64)
+	case "rating_tmdb":
+		return strconv.FormatFloat(media.RatingTMDB, 'f', -1, 64)
+	}
+	return ""
+}
+
+// ValidateFieldValue 校验编辑器提交的一个字段。后台保存前先把整张表单校验一遍，有一个不合法就整表不写。
+func ValidateFieldValue(name, value string) error {
+	field, ok := LookupEditableField(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrFieldNotEditable, name)
+	}
+	_, err := normalizeFieldValue(field, value)
+	return err
+}
+
+// normalizeFieldValue 校验并整理管理员输入。评分只接受 0 到 10，留空按 0 处理。
+func normalizeFieldValue(field EditableField, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !field.Numeric {
+		return value, nil
+	}
+	if value == "" {
+		return "0", nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 || number > 10 {
+		return "", fmt.Errorf("%w: %s = %q", ErrFieldNotEditable, field.Name, value)
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64), nil
+}
+
+// ListFieldSources 按字段名返回每个字段当前的来源、优先级和锁定状态。
+func (store *PostgresStore) ListFieldSources(ctx context.Context, mediaID int) (map[string]FieldSource, error) {
+	rows, err := store.database.Query(ctx, `SELECT field_name, provider, priority, locked, observed_at
+FROM media_field_sources WHERE media_id = $1`, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("list media field sources: %w", err)
+	}
+	defer rows.Close()
+	sources := map[string]FieldSource{}
+	for rows.Next() {
+		var source FieldSource
+		if err := rows.Scan(&source.Field, &source.Provider, &source.Priority, &source.Locked, &source.ObservedAt); err != nil {
+			return nil, fmt.Errorf("scan media field source: %w", err)
+		}
+		sources[source.Field] = source
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate media field sources: %w", err)
+	}
+	return sources, nil
+}
+
+// EditField 以 manual 来源改写一个字段，并记一条带操作人的变更历史。
+// 值没变时什么都不写，返回 false。人工修改不受锁影响，锁只挡 Provider。
+func (store *PostgresStore) EditField(ctx context.Context, mediaID, actorUserID int, name, value string) (bool, error) {
+	return editField(ctx, store.database, mediaID, actorUserID, name, value)
+}
+
+// EditFields 保存编辑器整张表单：先校验全部字段，再在一个事务里按 EditableFields 的顺序逐个改写，
+// 返回值真的变了的字段名。有一个字段不合法或中途写失败，整张表单都不落库。
+func (store *PostgresStore) EditFields(ctx context.Context, mediaID, actorUserID int, values map[string]string) ([]string, error) {
+	for name, value := range values {
+		if err := ValidateFieldValue(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if mediaID <= 0 {
+		return nil, fmt.Errorf("%w: media %d", ErrFieldNotEditable, mediaID)
+	}
+	if store.beginner == nil {
+		return nil, errors.New("media field edits require transaction support")
+	}
+	transaction, err := store.beginner.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin media field edits: %w", err)
+	}
+	defer transaction.Rollback(context.WithoutCancel(ctx))
+
+	changed := []string{}
+	for _, field := range EditableFields {
+		value, submitted := values[field.Name]
+		if !submitted {
+			continue
+		}
+		updated, err := editField(ctx, transaction, mediaID, actorUserID, field.Name, value)
+		if err != nil {
+			return nil, err
+		}
+		if updated {
+			changed = append(changed, field.Name)
+		}
+	}
+	if err := transaction.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit media field edits: %w", err)
+	}
+	return changed, nil
+}
+
+// editField 是 EditField 的实现，EditFields 在事务里逐个字段复用它。
+func editField(ctx context.Context, executor database.Executor, mediaID, actorUserID int, name, value string) (bool, error) {
+	field, ok := LookupEditableField(name)
+	if !ok || mediaID <= 0 {
+		return false, fmt.Errorf("%w: %s", ErrFieldNotEditable, name)
+	}
+	value, err := normalizeFieldValue(field, value)
+	if err != nil {
+		return false, err
+	}
+	columnType := "TEXT"
+	if field.Numeric {
+		columnType = "DOUBLE PRECISION"
+	}
+	incoming := `CAST($2::text AS ` + columnType + `)`
+	hash := sha256.Sum256([]byte(value))
+	var actor any
+	if actorUserID > 0 {
+		actor = actorUserID
+	}
+	updated := 0
+	// 四段写在一条语句里：改值、把来源记成 manual、记历史，要么全成要么全不成。
+	if err := executor.QueryRow(ctx, `WITH previous AS (
+    SELECT `+field.Name+`::text AS value FROM media WHERE id = $1
+), updated AS (
+    UPDATE media SET `+field.Name+` = `+incoming+`, updated_at = NOW()
+    WHERE id = $1 AND `+field.Name+` IS DISTINCT FROM `+incoming+`
+    RETURNING `+field.Name+`::text AS value
+), source AS (
+    INSERT INTO media_field_sources (media_id, field_name, provider, priority, value_hash, merge_rule_version, observed_at)
+    SELECT $1, $3, $4, $5, $6, $7, NOW() FROM updated
+    ON CONFLICT (media_id, field_name) DO UPDATE SET provider = EXCLUDED.provider,
+    priority = EXCLUDED.priority, value_hash = EXCLUDED.value_hash,
+    merge_rule_version = EXCLUDED.merge_rule_version, observed_at = EXCLUDED.observed_at
+), history AS (
+    INSERT INTO media_field_history (media_id, field_name, provider, actor_user_id, old_value, new_value)
+    SELECT $1, $3, $4, $8, previous.value, updated.value FROM previous, updated
+)
+SELECT COUNT(*) FROM updated`, mediaID, value, field.Name, ManualProvider, ManualPriority,
+		hex.EncodeToString(hash[:]), mergeRuleVersion, actor).Scan(&updated); err != nil {
+		return false, fmt.Errorf("edit media field %s: %w", field.Name, err)
+	}
+	return updated > 0, nil
+}
+
+// SetFieldLock 锁定或解锁一个字段。字段还没有来源记录时补一条优先级为 0 的 manual 记录来挂锁，
+// 解锁后任何 Provider 都能正常覆盖它。
+func (store *PostgresStore) SetFieldLock(ctx context.Context, mediaID int, name string, locked bool) error {
+	if _, ok := LookupEditableField(name); !ok || mediaID <= 0 {
+		return fmt.Errorf("%w: %s", ErrFieldNotEditable, name)
+	}
+	if _, err := store.database.Exec(ctx, `INSERT INTO media_field_sources
+(media_id, field_name, provider, priority, locked, merge_rule_version, observed_at)
+VALUES ($1,$2,$3,0,$4,$5,NOW())
+ON CONFLICT (media_id, field_name) DO UPDATE SET locked = EXCLUDED.locked`,
+		mediaID, name, ManualProvider, locked, mergeRuleVersion); err != nil {
+		return fmt.Errorf("lock media field %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListFieldHistory 返回作品最近的字段变更，新的在前。
+func (store *PostgresStore) ListFieldHistory(ctx context.Context, mediaID, limit int) ([]FieldChange, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	rows, err := store.database.Query(ctx, `SELECT id, media_id, field_name, provider, COALESCE(actor_user_id, 0),
+old_value, new_value, created_at
+FROM media_field_history WHERE media_id = $1
+ORDER BY created_at DESC, id DESC LIMIT $2`, mediaID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list media field history: %w", err)
+	}
+	defer rows.Close()
+	changes := []FieldChange{}
+	for rows.Next() {
+		var change FieldChange
+		if err := rows.Scan(&change.ID, &change.MediaID, &change.Field, &change.Provider, &change.ActorUserID,
+			&change.OldValue, &change.NewValue, &change.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan media field history: %w", err)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate media field history: %w", err)
+	}
+	return changes, nil
+}
+
+// RevertFieldChange 把字段改回某条历史记录之前的值。回滚本身也是一次人工修改，
+// 同样写成 manual 来源并留下历史，所以回滚之后还能再回滚。
+func (store *PostgresStore) RevertFieldChange(ctx context.Context, mediaID, changeID, actorUserID int) error {
+	var field string
+	var oldValue *string
+	err := store.database.QueryRow(ctx, `SELECT field_name, old_value FROM media_field_history
+WHERE id = $1 AND media_id = $2`, changeID, mediaID).Scan(&field, &oldValue)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrFieldChangeNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("find media field change: %w", err)
+	}
+	value := ""
+	if oldValue != nil {
+		value = *oldValue
+	}
+	if _, err := store.EditField(ctx, mediaID, actorUserID, field, value); err != nil {
+		return err
+	}
+	return nil
+}
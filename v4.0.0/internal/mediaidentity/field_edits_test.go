@@ -0,0 +1,95 @@
+package mediaidentity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEditFieldWritesManualSourceAndHistoryInOneStatement(t *testing.T) {
+	executor := &identityFoundationExecutor{rowValues: []int{1}}
+	store := NewPostgresStore(executor)
+	updated, err := store.EditField(t.Context(), 7, 3, "poster", " https://img.example/fixed.jpg ")
+	if err != nil || !updated {
+		t.Fatalf("EditField = %v, %v", updated, err)
+	}
+	query := executor.rowQueries[0]
+	for _, expected := range []string{"UPDATE media SET poster = CAST($2::text AS TEXT)", "poster IS DISTINCT FROM", "INSERT INTO media_field_sources", "INSERT INTO media_field_history"} {
+		if !strings.Contains(query, expected) {
+			t.Fatalf("edit query missing %q: %s", expected, query)
+		}
+	}
+	arguments := executor.rowArguments[0]
+	if arguments[0] != 7 || arguments[1] != "https://img.example/fixed.jpg" || arguments[2] != "poster" ||
+		arguments[3] != ManualProvider || arguments[4] != ManualPriority || arguments[7] != 3 {
+		t.Fatalf("edit arguments = %#v", arguments)
+	}
+}
+
+func TestEditFieldValidatesFieldsAndRatings(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	store := NewPostgresStore(executor)
+	for _, edit := range [][2]string{{"media_type", "tv"}, {"douban_id", "1"}, {"rating_douban", "11"}, {"rating_tmdb", "abc"}} {
+		if _, err := store.EditField(t.Context(), 7, 3, edit[0], edit[1]); !errors.Is(err, ErrFieldNotEditable) {
+			t.Fatalf("EditField(%q, %q) error = %v", edit[0], edit[1], err)
+		}
+	}
+	if err := store.SetFieldLock(t.Context(), 7, "embedding_content", true); !errors.Is(err, ErrFieldNotEditable) {
+		t.Fatalf("SetFieldLock error = %v", err)
+	}
+	if len(executor.rowQueries)+len(executor.execQueries) != 0 {
+		t.Fatalf("invalid edits reached the database: %#v %#v", executor.rowQueries, executor.execQueries)
+	}
+
+	executor.rowValues = []int{1}
+	if _, err := store.EditField(t.Context(), 7, 0, "rating_douban", ""); err != nil {
+		t.Fatal(err)
+	}
+	if arguments := executor.rowArguments[0]; arguments[1] != "0" || arguments[7] != nil ||
+		!strings.Contains(executor.rowQueries[0], "CAST($2::text AS DOUBLE PRECISION)") {
+		t.Fatalf("rating edit = %#v / %s", arguments, executor.rowQueries[0])
+	}
+}
+
+func TestSetFieldLockKeepsExistingSourceAndOnlyTogglesTheLock(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	store := NewPostgresStore(executor)
+	if err := store.SetFieldLock(t.Context(), 7, "summary", true); err != nil {
+		t.Fatal(err)
+	}
+	query := executor.execQueries[0]
+	if !strings.Contains(query, "DO UPDATE SET locked = EXCLUDED.locked") || strings.Contains(query, "provider = EXCLUDED.provider") {
+		t.Fatalf("lock query = %s", query)
+	}
+	if arguments := executor.execArguments[0]; arguments[0] != 7 || arguments[1] != "summary" || arguments[3] != true {
+		t.Fatalf("lock arguments = %#v", arguments)
+	}
+}
+
+func TestMediaFieldValueMatchesEditableFields(t *testing.T) {
+	media := Media{Title: "肖申克的救赎", Summary: "简介", RatingDouban: 9.7, SeriesStatus: "Ended"}
+	for field, expected := range map[string]string{"title": "肖申克的救赎", "summary": "简介", "rating_douban": "9.7", "rating_tmdb": "0", "series_status": "Ended"} {
+		if got := media.FieldValue(field); got != expected {
+			t.Fatalf("FieldValue(%q) = %q, want %q", field, got, expected)
+		}
+	}
+	for _, field := range EditableFields {
+		if _, ok := LookupEditableField(field.Name); !ok || field.Label == "" {
+			t.Fatalf("editable field %+v is not addressable", field)
+		}
+	}
+}
+
+func TestEditFieldsValidatesWholeFormBeforeWriting(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	store := NewPostgresStore(executor)
+	if _, err := store.EditFields(t.Context(), 7, 3, map[string]string{"title": "改名", "rating_douban": "11"}); !errors.Is(err, ErrFieldNotEditable) {
+		t.Fatalf("EditFields with an invalid rating = %v", err)
+	}
+	if _, err := store.EditFields(t.Context(), 7, 3, map[string]string{"title": "改名"}); err == nil || !strings.Contains(err.Error(), "transaction") {
+		t.Fatalf("EditFields without transactions = %v", err)
+	}
+	if len(executor.rowQueries)+len(executor.execQueries) != 0 {
+		t.Fatalf("rejected edits reached the database: %#v %#v", executor.rowQueries, executor.execQueries)
+	}
+}
@@ -64,13 +64,17 @@ func TestUpsertEpisodesBindsStructuredResourceToMediaUnit(t *testing.T) {
 	}}); err != nil {
 		t.Fatal(err)
 	}
-	if len(executor.execQueries) != 1 || !strings.Contains(executor.execQueries[0], "resource_episode_candidates") || strings.Contains(executor.execQueries[0], "resource_episodes\n") {
+	if len(executor.execQueries) != 2 || !strings.Contains(executor.execQueries[0], "resource_episode_candidates") || strings.Contains(executor.execQueries[0], "resource_episodes\n") {
 		t.Fatalf("resource episode query = %#v", executor.execQueries)
 	}
 	arguments := executor.execArguments[0]
 	if len(arguments) != 12 || arguments[0] != 61 || arguments[1] != 7 || arguments[2] != 51 || arguments[3] != 2 || arguments[4] != "S02E03" {
 		t.Fatalf("resource episode arguments = %#v", arguments)
 	}
+	if check := executor.execArguments[1]; !strings.Contains(executor.execQueries[1], "worker_jobs") || check[0] != TaskAvailabilityCheck ||
+		!reflect.DeepEqual(check[1], []int{7}) || check[2] != "episodes_indexed" {
+		t.Fatalf("availability check = %s / %#v", executor.execQueries[1], check)
+	}
 	if len(executor.rowQueries) != 2 || !strings.Contains(executor.rowQueries[1], "resource_play_lines") {
 		t.Fatalf("resource line/candidate writes = rows:%#v args:%#v", executor.rowQueries, executor.execArguments)
 	}
@@ -122,8 +126,9 @@ func TestLinkResourceBindsOnlyStructuredEpisodeRows(t *testing.T) {
 	if err := store.LinkResource(t.Context(), ResourceLink{SourceKey: "source", VodID: "42", MediaID: 7, Confidence: 0.9, MatchedBy: "weighted_features"}); err != nil {
 		t.Fatal(err)
 	}
-	if len(executor.execQueries) != 2 || !strings.Contains(executor.execQueries[0], "resource_media_links") ||
-		!strings.Contains(executor.execQueries[1], "resource_episode_candidates") {
+	if len(executor.execQueries) != 3 || !strings.Contains(executor.execQueries[0], "resource_media_links") ||
+		!strings.Contains(executor.execQueries[1], "resource_episode_candidates") ||
+		!strings.Contains(executor.execQueries[2], "wish.status = 'wish'") || executor.execArguments[2][2] != "resource_linked" {
 		t.Fatalf("resource identity binding queries = %#v", executor.execQueries)
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 
 	"golang.org/x/text/unicode/norm"
@@ -56,11 +57,12 @@ var (
 	releaseTagPattern    = regexp.MustCompile(`(?i)\b(?:2160p|1080p|720p|4k|uhd|blu-?ray|web-?dl|hdtv|hdr|x26[45])\b`)
 	chineseTagPattern    = regexp.MustCompile(`(?:国语|粤语|中字|双语|修复版|加长版|导演剪辑版|高清|超清)`)
 	yearPattern          = regexp.MustCompile(`(?:19|20)\d{2}`)
-	nameSeparatorPattern = regexp.MustCompile(`[\s,，、/;；|]+`)
+	listSeparatorPattern = regexp.MustCompile(`[,，、/;；|]+`)
 )
 
 // MatchResource 是加权打分匹配（五层匹配里的第 4 层）：
 // 先用别名表的三元组相似度粗筛出最多 20 个候选，再逐个打分，取分最高的一个。
+// 已并入其他作品的重复条目不参与匹配，它留下的冲突别名不会把资源带回去。
 func (store *PostgresStore) MatchResource(ctx context.Context, input MatchInput) (MatchResult, error) {
 	titleKey, _ := matchTitleParts(input.Title)
 	if titleKey == "" {
@@ -71,25 +73,42 @@ func (store *PostgresStore) MatchResource(ctx context.Context, input MatchInput)
     WHERE normalized_alias = $1 OR similarity(normalized_alias, $1) >= 0.45
     ORDER BY similarity(normalized_alias, $1) DESC
     LIMIT 20
-) ORDER BY updated_at DESC`, titleKey)
+) AND merged_into_id IS NULL ORDER BY updated_at DESC`, titleKey)
 	if err != nil {
 		return MatchResult{}, fmt.Errorf("find media match candidates: %w", err)
 	}
 	defer rows.Close()
-	results := make([]MatchResult, 0, 20)
+	candidates := make([]Media, 0, 20)
 	for rows.Next() {
 		var media Media
 		if err := scanMedia(rows, &media); err != nil {
 			return MatchResult{}, fmt.Errorf("scan media match candidate: %w", err)
 		}
-		result := ScoreResourceMatch(input, media)
-		if result.MediaID > 0 {
-			results = append(results, result)
-		}
+		candidates = append(candidates, media)
 	}
 	if err := rows.Err(); err != nil {
 		return MatchResult{}, fmt.Errorf("iterate media match candidates: %w", err)
 	}
+	rows.Close()
+	if input.Directors != "" || input.Actors != "" {
+		mediaIDs := make([]int, len(candidates))
+		for index, candidate := range candidates {
+			mediaIDs[index] = candidate.ID
+		}
+		credits, err := store.ListCreditsForMedia(ctx, mediaIDs)
+		if err != nil {
+			return MatchResult{}, err
+		}
+		for index := range candidates {
+			candidates[index].Credits = credits[candidates[index].ID]
+		}
+	}
+	results := make([]MatchResult, 0, len(candidates))
+	for _, media := range candidates {
+		if result := ScoreResourceMatch(input, media); result.MediaID > 0 {
+			results = append(results, result)
+		}
+	}
 	if len(results) == 0 {
 		return MatchResult{}, nil
 	}
@@ -107,6 +126,7 @@ func (store *PostgresStore) MatchResource(ctx context.Context, input MatchInput)
 // ScoreResourceMatch 给「一条资源 vs 一部媒体」打分。
 // 权重：片名 0.40、年份 0.15、类型 0.15、原名 0.10、演员 0.10、导演 0.10。
 // 年份差 2 年以上、季号对不上、类型不符都会记为硬冲突。
+// 演职员按人比较：media.Credits 里的人中文名、原名任一命中都算，资源站写英文名也能对上。
 func ScoreResourceMatch(input MatchInput, media Media) MatchResult {
 	resourceTitle, resourceSeason := matchTitleParts(input.Title)
 	candidateTitle, candidateSeason := matchTitleParts(media.Title)
@@ -158,7 +178,8 @@ func ScoreResourceMatch(input MatchInput, media Media) MatchResult {
 	}
 	addFeature("season", 0.15, seasonSimilarity)
 
-	peopleSimilarity := (setOverlap(input.Directors, media.Directors) + setOverlap(input.Actors, media.Actors)) / 2
+	peopleSimilarity := (peopleOverlap(input.Directors, matchPeople(media.Directors, media.Credits, CreditDirector)) +
+		peopleOverlap(input.Actors, matchPeople(media.Actors, media.Credits, CreditActor))) / 2
 	addFeature("people", 0.10, peopleSimilarity)
 	addFeature("original_title", 0.10, titleSimilarity(resourceOriginal, candidateOriginal))
 
@@ -271,27 +292,74 @@ func normalizeMatchMediaType(value string) string {
 	}
 }
 
-// setOverlap 计算两组人名的重合度。
-func setOverlap(left, right string) float64 {
-	leftSet, rightSet := nameSet(left), nameSet(right)
-	if len(leftSet) == 0 || len(rightSet) == 0 {
+// matchPeople 汇总候选作品某一角色的全部人，每个人是一组归一化名字。
+// 先取 media_credits 里的人，再补上 JSON 里有而演职员表里没有的名字；
+// 旧数据里偶有不是 JSON 的分隔串，按 personNameSet 拆开，每个名字算一个人。
+func matchPeople(raw string, credits []Credit, role string) [][]string {
+	people := make([][]string, 0, len(credits))
+	seen := make(map[string]bool)
+	for _, credit := range credits {
+		if keys := credit.Person.NameKeys(); credit.Role == role && len(keys) > 0 {
+			people = append(people, keys)
+			for _, key := range keys {
+				seen[key] = true
+			}
+		}
+	}
+	var listed []struct {
+		Name string `json:"name"`
+	}
+	names := map[string]bool{}
+	if json.Unmarshal([]byte(raw), &listed) == nil {
+		for _, person := range listed {
+			if key := NormalizeTitle(person.Name); key != "" {
+				names[key] = true
+			}
+		}
+	} else {
+		names = personNameSet(raw)
+	}
+	for key := range names {
+		if !seen[key] {
+			people = append(people, []string{key})
+			seen[key] = true
+		}
+	}
+	return people
+}
+
+// peopleOverlap 是资源人名和候选作品的人的重合度：命中的人数除以两边较少的一方。
+// 分母取较少的一方，是因为各来源列的主演数量差别很大，资源站常常只写前三四位。
+func peopleOverlap(resourceNames string, people [][]string) float64 {
+	names := personNameSet(resourceNames)
+	if len(names) == 0 || len(people) == 0 {
 		return 0
 	}
-	intersection := 0
-	for name := range leftSet {
-		if rightSet[name] {
-			intersection++
+	matched := 0
+	for _, keys := range people {
+		for _, key := range keys {
+			if names[key] {
+				matched++
+				break
+			}
 		}
 	}
-	return float64(intersection) / float64(maxInt(len(leftSet), len(rightSet)))
+	return float64(min(matched, len(names))) / float64(min(len(names), len(people)))
 }
 
-// nameSet 把人名串按各种分隔符拆成集合。
-func nameSet(value string) map[string]bool {
+// personNameSet 把人名串按各种分隔符拆成集合，但拉丁字母的名字不按空格拆：
+// 「David Benioff」是一个人，「蒂姆·罗宾斯 摩根·弗里曼」是两个人。
+func personNameSet(value string) map[string]bool {
 	result := make(map[string]bool)
-	for _, name := range nameSeparatorPattern.Split(value, -1) {
-		if normalized := NormalizeTitle(name); normalized != "" {
-			result[normalized] = true
+	for _, chunk := range listSeparatorPattern.Split(value, -1) {
+		parts := []string{chunk}
+		if strings.IndexFunc(chunk, func(r rune) bool { return unicode.Is(unicode.Han, r) }) >= 0 {
+			parts = strings.Fields(chunk)
+		}
+		for _, name := range parts {
+			if normalized := NormalizeTitle(name); normalized != "" {
+				result[normalized] = true
+			}
 		}
 	}
 	return result
@@ -70,3 +70,21 @@ func TestTitleSeasonNumberUsesFirstExplicitSeason(t *testing.T) {
 		t.Fatalf("multi-word series title base = %q, want the boys", got)
 	}
 }
+
+func TestScoreResourceMatchComparesPeopleByCreditNamesAndJSONBlobs(t *testing.T) {
+	media := Media{ID: 11, Title: "权力的游戏", Year: "2011", MediaType: "tv",
+		Directors: `[{"id":"tmdb-9813","name":"大卫·贝尼奥夫"}]`,
+		Actors:    `[{"id":"1040508","name":"艾米莉亚·克拉克"},{"id":"1031895","name":"基特·哈灵顿"}]`,
+		Credits: []Credit{
+			{Role: CreditDirector, Person: Person{Name: "大卫·贝尼奥夫", OriginalName: "David Benioff"}},
+			{Role: CreditActor, Person: Person{Name: "艾米莉亚·克拉克", OriginalName: "Emilia Clarke"}},
+		}}
+	result := ScoreResourceMatch(MatchInput{Title: "权力的游戏", Year: "2011", MediaType: "电视剧",
+		Directors: "David Benioff", Actors: "Emilia Clarke, 基特·哈灵顿"}, media)
+	if !strings.Contains(result.ReasonJSON, `"people":{"weight":0.1,"similarity":1,`) {
+		t.Fatalf("people feature = %s", result.ReasonJSON)
+	}
+	if got := peopleOverlap("艾米莉亚·克拉克 / 路人甲", matchPeople(media.Actors, nil, CreditActor)); got != 0.5 {
+		t.Fatalf("blob-only overlap = %v, want 0.5", got)
+	}
+}
@@ -4,14 +4,20 @@
 // 主要涉及的表：
 //
 //	media                 规范媒体主表
-//	media_external_ids    外部 ID（douban / imdb / tmdb）
+//	media_external_ids    外部 ID（douban / imdb / tmdb / bangumi）
 //	media_aliases         别名（精确匹配和模糊匹配都靠它）
 //	media_units           季集（一集/一部电影是一个 unit）
-//	media_field_sources   字段级来源优先级（谁写的这个字段、优先级多少）
+//	media_field_sources   字段级来源优先级（谁写的这个字段、优先级多少、是否被管理员锁定）
+//	media_field_history   字段变更历史（Provider 刷新和管理员修改）
 //	media_source_snapshots 各来源最近一次抓取的记录
 //	resource_media_links  资源 → 媒体的关联
 //	resource_play_lines / resource_episode_candidates  资源的播放线路与分集候选
 //	playback_attempt_events  播放质量埋点
+//	skip_marker_votes     用户标记的片头片尾区间
+//	people / media_credits  演职员和作品的演职员表
+//	collections / collection_items  剧集系列（豆瓣分季条目归到一部剧）和电影合集
+//	media_duplicate_candidates / media_merges  疑似重复作品的复核队列和合并留痕（可拆分）
+//	media_translations    片名、简介、宣传语的其他语言版本
 package mediaidentity
 
 import "time"
@@ -45,6 +51,8 @@ type Media struct {
 	LastMetadataSyncAt time.Time
 	CreatedAt          time.Time
 	UpdatedAt          time.Time
+	// Credits 不是 media 表的列，只在资源匹配打分时按需从 media_credits 填充。
+	Credits []Credit
 }
 
 // ExternalID 是一条外部 ID 映射。(provider, external_type, external_id) 三元组唯一。
@@ -129,6 +137,8 @@ type PlaybackAttemptEvent struct {
 	VodID              string
 	ElapsedMs          int
 	Reason             string
+	// ClientProfile 是客户端画像键（如 ios-native），由播放层归一化后传入，为空表示未知。
+	ClientProfile string
 }
 
 // ResourceCandidate 是带质量统计的播放候选，播放页按这些数据给线路排序。
@@ -138,4 +148,27 @@ type ResourceCandidate struct {
 	FailureCount      int
 	AvgLoadMs         int
 	MappingConfidence float64
+	LineQoE           LineQoE
+}
+
+// ResourceRef 指向一条资源站资源。
+type ResourceRef struct {
+	SourceKey string
+	VodID     string
+}
+
+// ProfileHealth 是某类客户端在一条资源上的 7 天播放统计。
+type ProfileHealth struct {
+	SuccessCount int
+	FailureCount int
+	AvgLoadMs    int
+}
+
+// LineQoE 是一条线路 7 天窗口内的播放体验原始计数，由 RefreshQuality 写回 resource_play_lines。
+type LineQoE struct {
+	Attempts     int
+	FirstFrames  int
+	Rebuffers    int
+	Failures     int
+	AutoSwitches int
 }
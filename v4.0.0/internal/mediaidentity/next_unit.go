@@ -0,0 +1,46 @@
+package mediaidentity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CompletionPercent 是「这一集算看完了」的进度阈值。片尾字幕通常占最后几分钟，
+// 要求播到 100% 才算看完，大多数人永远等不到自动连播和「下一集」入口。
+// 继续观看列表与自动连播接口共用这个口径。
+const CompletionPercent = 90
+
+// NextUnit 返回同一部作品里紧接在给定集之后的一集，按季号、集号顺序排列，可以跨季。
+// 特别篇（unit_type 不是 episode）和电影不参与连播；没有下一集时返回零值 MediaUnit。
+func (store *PostgresStore) NextUnit(ctx context.Context, mediaUnitID int) (MediaUnit, error) {
+	if mediaUnitID <= 0 {
+		return MediaUnit{}, nil
+	}
+	var unit MediaUnit
+	var airDate *time.Time
+	err := store.database.QueryRow(ctx, `SELECT next.id, next.media_id, next.unit_type, next.season_number,
+COALESCE(next.episode_number, 0), COALESCE(next.absolute_number, 0), next.episode_key, next.title, next.air_date,
+COALESCE(next.runtime_minutes, 0)
+FROM media_units current
+JOIN media_units next ON next.media_id = current.media_id AND next.unit_type = 'episode'
+ AND (next.season_number, COALESCE(next.episode_number, 0), next.id)
+   > (current.season_number, COALESCE(current.episode_number, 0), current.id)
+WHERE current.id = $1 AND current.unit_type = 'episode'
+ORDER BY next.season_number, COALESCE(next.episode_number, 0), next.id
+LIMIT 1`, mediaUnitID).Scan(&unit.ID, &unit.MediaID, &unit.UnitType, &unit.SeasonNumber,
+		&unit.EpisodeNumber, &unit.AbsoluteNumber, &unit.EpisodeKey, &unit.Title, &airDate, &unit.RuntimeMinutes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return MediaUnit{}, nil
+	}
+	if err != nil {
+		return MediaUnit{}, fmt.Errorf("find next media unit: %w", err)
+	}
+	if airDate != nil {
+		unit.AirDate = *airDate
+	}
+	return unit, nil
+}
@@ -0,0 +1,319 @@
+package mediaidentity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+)
+
+// 演职员角色。编剧、制片等暂不入库，页面和匹配都只用得到这两种。
+const (
+	CreditDirector = "director"
+	CreditActor    = "actor"
+)
+
+// maxFilmography 限制人物页一次读出的作品数，产量极高的配音演员也不至于拖垮页面。
+const maxFilmography = 300
+
+// ErrPersonNotFound 表示人物不存在。
+var ErrPersonNotFound = errors.New("person not found")
+
+// Person 是一个演职员。DoubanID 和 TMDBID 至少有一个，两边都进来过的人两个都有。
+type Person struct {
+	ID           int
+	DoubanID     string
+	TMDBID       string
+	Name         string
+	OriginalName string
+	Avatar       string
+}
+
+// Credit 是作品的一条演职员记录。Order 是来源里的排序（主演在前），Character 只有演员才有。
+type Credit struct {
+	MediaID   int
+	Person    Person
+	Role      string
+	Character string
+	Order     int
+}
+
+// PersonCredit 是人物作品表的一行，同一部作品既导又演时 Roles 里有两个角色。
+type PersonCredit struct {
+	MediaID   int
+	DoubanID  string
+	MediaType string
+	Title     string
+	Year      string
+	Poster    string
+	Rating    float64
+	Roles     []string
+	Character string
+}
+
+// CreditWriter 按来源整批替换作品的演职员表。
+type CreditWriter interface {
+	ReplaceCredits(ctx context.Context, mediaID int, source string, credits []Credit) error
+}
+
+// PersonReader 读取人物和作品表。
+type PersonReader interface {
+	FindPerson(ctx context.Context, id int) (Person, error)
+	FindPersonByExternalID(ctx context.Context, provider, externalID string) (Person, error)
+	ListPersonCredits(ctx context.Context, personID int) ([]PersonCredit, error)
+}
+
+// personIDColumn 把来源映射到 people 表上对应的外部 ID 列，列名直接拼进 SQL，只能来自这里。
+func personIDColumn(provider string) (string, bool) {
+	switch provider {
+	case "douban":
+		return "douban_id", true
+	case "tmdb":
+		return "tmdb_id", true
+	}
+	return "", false
+}
+
+// sourceID 返回人物在某个来源下的 ID。
+func (person Person) sourceID(provider string) string {
+	if provider == "tmdb" {
+		return person.TMDBID
+	}
+	return person.DoubanID
+}
+
+// NameKeys 返回人物的全部归一化名字（中文名和原名），匹配时任一命中即算同一个人。
+func (person Person) NameKeys() []string {
+	keys := make([]string, 0, 2)
+	for _, name := range []string{person.Name, person.OriginalName} {
+		if key := NormalizeTitle(name); key != "" && (len(keys) == 0 || keys[0] != key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ReplaceCredits 写入某个来源给出的演职员表，并删掉这个来源上次写过、这次不再出现的行。
+// 人物先按来源 ID 找；找不到时在这部作品已有的（其他来源写的）同角色演职员里按名字找，
+// 找到就把来源 ID 补到那一行上，这样豆瓣和 TMDB 的同一个人会并成一个人物页。
+// 没有来源 ID 的条目无法去重，直接跳过，原始 JSON 里仍然保留着它们。
+// 整张表在一个事务里替换，写到一半失败不会留下删了旧行、新行只写了一部分的演职员表。
+func (store *PostgresStore) ReplaceCredits(ctx context.Context, mediaID int, source string, credits []Credit) error {
+	source = strings.ToLower(strings.TrimSpace(source))
+	column, ok := personIDColumn(source)
+	if mediaID <= 0 || !ok {
+		return fmt.Errorf("invalid credit source %q for media %d", source, mediaID)
+	}
+	if store.beginner == nil {
+		return errors.New("replace credits requires transaction support")
+	}
+	transaction, err := store.beginner.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin replace credits: %w", err)
+	}
+	defer transaction.Rollback(context.WithoutCancel(ctx))
+
+	existing, err := listCreditsForMedia(ctx, transaction, []int{mediaID})
+	if err != nil {
+		return err
+	}
+	kept := make([]string, 0, len(credits))
+	for _, credit := range credits {
+		credit.Person.Name = strings.TrimSpace(credit.Person.Name)
+		if credit.Person.sourceID(source) == "" || credit.Person.Name == "" ||
+			(credit.Role != CreditDirector && credit.Role != CreditActor) {
+			continue
+		}
+		personID, err := resolvePerson(ctx, transaction, source, column, credit, existing[mediaID])
+		if err != nil {
+			return err
+		}
+		if _, err := transaction.Exec(ctx, `INSERT INTO media_credits
+(media_id, person_id, role, character, credit_order, source)
+VALUES ($1,$2,$3,$4,$5,$6)
+ON CONFLICT (media_id, person_id, role, source) DO UPDATE SET
+character = EXCLUDED.character, credit_order = EXCLUDED.credit_order, updated_at = NOW()`,
+			mediaID, personID, credit.Role, strings.TrimSpace(credit.Character), credit.Order, source); err != nil {
+			return fmt.Errorf("save media credit: %w", err)
+		}
+		kept = append(kept, strconv.Itoa(personID)+":"+credit.Role)
+	}
+	if _, err := transaction.Exec(ctx, `DELETE FROM media_credits
+WHERE media_id = $1 AND source = $2 AND NOT (person_id::text || ':' || role = ANY($3::text[]))`,
+		mediaID, source, kept); err != nil {
+		return fmt.Errorf("delete stale media credits: %w", err)
+	}
+	if err := transaction.Commit(ctx); err != nil {
+		return fmt.Errorf("commit replace credits: %w", err)
+	}
+	return nil
+}
+
+// resolvePerson 找到或建出这条演职员对应的人物，返回 people.id。
+// 已有人物只补空字段；名字以豆瓣为准，TMDB 的名字常常是英文。
+func resolvePerson(ctx context.Context, executor database.Executor, source, column string, credit Credit, existing []Credit) (int, error) {
+	person := credit.Person
+	externalID := person.sourceID(source)
+	personID := 0
+	err := executor.QueryRow(ctx, `SELECT id FROM people WHERE `+column+` = $1`, externalID).Scan(&personID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("find person: %w", err)
+	}
+	if personID == 0 {
+		personID = matchExistingPerson(source, credit, existing)
+	}
+	if personID == 0 {
+		if err := executor.QueryRow(ctx, `INSERT INTO people (`+column+`, name, original_name, avatar)
+VALUES ($1,$2,$3,$4)
+ON CONFLICT (`+column+`) WHERE `+column+` <> '' DO UPDATE SET updated_at = NOW()
+RETURNING id`, externalID, person.Name, strings.TrimSpace(person.OriginalName), strings.TrimSpace(person.Avatar)).Scan(&personID); err != nil {
+			return 0, fmt.Errorf("insert person: %w", err)
+		}
+		return personID, nil
+	}
+	if _, err := executor.Exec(ctx, `UPDATE people SET
+`+column+` = CASE WHEN `+column+` = '' THEN $2 ELSE `+column+` END,
+name = CASE WHEN $5 = 'douban' OR name = '' THEN $3 ELSE name END,
+original_name = CASE WHEN original_name = '' THEN $4 ELSE original_name END,
+avatar = CASE WHEN avatar = '' THEN $6 ELSE avatar END,
+updated_at = NOW()
+WHERE id = $1`, personID, externalID, person.Name, strings.TrimSpace(person.OriginalName), source,
+		strings.TrimSpace(person.Avatar)); err != nil {
+		return 0, fmt.Errorf("update person: %w", err)
+	}
+	return personID, nil
+}
+
+// matchExistingPerson 在作品已有的演职员里找同角色、同名、且还没有这个来源 ID 的人。
+// 只在同一部作品里按名字并人：全库按名字并会把同名的不同演员并到一起。
+func matchExistingPerson(source string, credit Credit, existing []Credit) int {
+	keys := credit.Person.NameKeys()
+	for _, candidate := range existing {
+		if candidate.Role != credit.Role || candidate.Person.sourceID(source) != "" {
+			continue
+		}
+		for _, candidateKey := range candidate.Person.NameKeys() {
+			for _, key := range keys {
+				if key == candidateKey {
+					return candidate.Person.ID
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// ListMediaCredits 返回作品的演职员，同一个人同一角色只保留一行（取排序靠前的来源记录）。
+func (store *PostgresStore) ListMediaCredits(ctx context.Context, mediaID int) ([]Credit, error) {
+	creditsByMedia, err := store.ListCreditsForMedia(ctx, []int{mediaID})
+	if err != nil {
+		return nil, err
+	}
+	return creditsByMedia[mediaID], nil
+}
+
+// ListCreditsForMedia 批量读取多部作品的演职员，资源匹配给候选打分时一次取齐。
+func (store *PostgresStore) ListCreditsForMedia(ctx context.Context, mediaIDs []int) (map[int][]Credit, error) {
+	return listCreditsForMedia(ctx, store.database, mediaIDs)
+}
+
+// listCreditsForMedia 是 ListCreditsForMedia 的实现，ReplaceCredits 在事务里复用它。
+func listCreditsForMedia(ctx context.Context, executor database.Executor, mediaIDs []int) (map[int][]Credit, error) {
+	result := make(map[int][]Credit, len(mediaIDs))
+	if len(mediaIDs) == 0 {
+		return result, nil
+	}
+	rows, err := executor.Query(ctx, `SELECT media_id, person_id, role, character, credit_order,
+douban_id, tmdb_id, name, original_name, avatar
+FROM (
+    SELECT DISTINCT ON (credit.media_id, credit.person_id, credit.role)
+        credit.media_id, credit.person_id, credit.role, credit.character, credit.credit_order,
+        person.douban_id, person.tmdb_id, person.name, person.original_name, person.avatar
+    FROM media_credits credit
+    JOIN people person ON person.id = credit.person_id
+    WHERE credit.media_id = ANY($1::bigint[])
+    ORDER BY credit.media_id, credit.person_id, credit.role, credit.credit_order, credit.source
+) credits
+ORDER BY media_id, role, credit_order, person_id`, mediaIDs)
+	if err != nil {
+		return nil, fmt.Errorf("list media credits: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var credit Credit
+		if err := rows.Scan(&credit.MediaID, &credit.Person.ID, &credit.Role, &credit.Character, &credit.Order,
+			&credit.Person.DoubanID, &credit.Person.TMDBID, &credit.Person.Name, &credit.Person.OriginalName,
+			&credit.Person.Avatar); err != nil {
+			return nil, fmt.Errorf("scan media credit: %w", err)
+		}
+		result[credit.MediaID] = append(result[credit.MediaID], credit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate media credits: %w", err)
+	}
+	return result, nil
+}
+
+// FindPerson 按 people.id 读取人物。
+func (store *PostgresStore) FindPerson(ctx context.Context, id int) (Person, error) {
+	return store.scanPerson(store.database.QueryRow(ctx, personSelect+` WHERE id = $1`, id))
+}
+
+// FindPersonByExternalID 按豆瓣或 TMDB 人物 ID 读取人物。
+func (store *PostgresStore) FindPersonByExternalID(ctx context.Context, provider, externalID string) (Person, error) {
+	column, ok := personIDColumn(provider)
+	if !ok || externalID == "" {
+		return Person{}, ErrPersonNotFound
+	}
+	return store.scanPerson(store.database.QueryRow(ctx, personSelect+` WHERE `+column+` = $1`, externalID))
+}
+
+// ListPersonCredits 返回人物的作品表，按年份从新到旧；年份未知的排在最后。
+func (store *PostgresStore) ListPersonCredits(ctx context.Context, personID int) ([]PersonCredit, error) {
+	rows, err := store.database.Query(ctx, `SELECT media.id, media.douban_id, media.media_type, media.title, media.year,
+media.poster, COALESCE(NULLIF(media.rating_douban, 0), media.rating_tmdb),
+array_agg(DISTINCT credit.role ORDER BY credit.role), MAX(credit.character)
+FROM media_credits credit
+JOIN media ON media.id = credit.media_id
+WHERE credit.person_id = $1 AND media.merged_into_id IS NULL
+GROUP BY media.id
+ORDER BY CAST(substring(media.year FROM '[0-9]{4}') AS INTEGER) DESC NULLS LAST, media.title
+LIMIT $2`, personID, maxFilmography)
+	if err != nil {
+		return nil, fmt.Errorf("list person credits: %w", err)
+	}
+	defer rows.Close()
+	credits := []PersonCredit{}
+	for rows.Next() {
+		var credit PersonCredit
+		if err := rows.Scan(&credit.MediaID, &credit.DoubanID, &credit.MediaType, &credit.Title, &credit.Year,
+			&credit.Poster, &credit.Rating, &credit.Roles, &credit.Character); err != nil {
+			return nil, fmt.Errorf("scan person credit: %w", err)
+		}
+		credits = append(credits, credit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate person credits: %w", err)
+	}
+	return credits, nil
+}
+
+const personSelect = `SELECT id, douban_id, tmdb_id, name, original_name, avatar FROM people`
+
+// scanPerson 扫描一行人物，没有结果时返回 ErrPersonNotFound。
+func (store *PostgresStore) scanPerson(row database.Row) (Person, error) {
+	var person Person
+	err := row.Scan(&person.ID, &person.DoubanID, &person.TMDBID, &person.Name, &person.OriginalName, &person.Avatar)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Person{}, ErrPersonNotFound
+	}
+	if err != nil {
+		return Person{}, fmt.Errorf("scan person: %w", err)
+	}
+	return person, nil
+}
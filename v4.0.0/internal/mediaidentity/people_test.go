@@ -0,0 +1,44 @@
+package mediaidentity
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPersonNameKeysNormalizeAndDeduplicateNames(t *testing.T) {
+	person := Person{Name: "David Benioff", OriginalName: "david  benioff"}
+	if keys := person.NameKeys(); len(keys) != 1 || keys[0] != NormalizeTitle("David Benioff") {
+		t.Fatalf("name keys = %#v", keys)
+	}
+	person = Person{Name: "彼特·丁拉基", OriginalName: "Peter Dinklage"}
+	if keys := person.NameKeys(); !reflect.DeepEqual(keys, []string{NormalizeTitle("彼特·丁拉基"), NormalizeTitle("Peter Dinklage")}) {
+		t.Fatalf("name keys = %#v", keys)
+	}
+}
+
+func TestFindPersonByExternalIDRejectsUnknownProvidersWithoutQuerying(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	store := NewPostgresStore(executor)
+	for _, lookup := range [][2]string{{"imdb", "nm0000209"}, {"douban", ""}} {
+		if _, err := store.FindPersonByExternalID(t.Context(), lookup[0], lookup[1]); !errors.Is(err, ErrPersonNotFound) {
+			t.Fatalf("FindPersonByExternalID(%q, %q) error = %v", lookup[0], lookup[1], err)
+		}
+	}
+	if len(executor.rowQueries) != 0 {
+		t.Fatalf("unexpected queries: %#v", executor.rowQueries)
+	}
+}
+
+func TestReplaceCreditsRequiresTransactions(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	store := NewPostgresStore(executor)
+	credits := []Credit{{Role: CreditActor, Person: Person{Name: "彼特·丁拉基", DoubanID: "1000123"}}}
+	if err := store.ReplaceCredits(t.Context(), 7, "douban", credits); err == nil || !strings.Contains(err.Error(), "transaction") {
+		t.Fatalf("replace credits without transactions = %v", err)
+	}
+	if len(executor.execQueries)+len(executor.rowQueries) != 0 {
+		t.Fatalf("replace without transactions touched the database: %v %v", executor.execQueries, executor.rowQueries)
+	}
+}
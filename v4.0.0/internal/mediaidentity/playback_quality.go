@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/jackc/pgx/v5"
 )
 
 // ErrInvalidPlaybackEvent 表示上报的播放事件字段不合法，直接丢弃。
@@ -34,6 +36,10 @@ func (store *PostgresStore) RecordPlaybackEvent(ctx context.Context, event Playb
 	event.SourceKey = strings.TrimSpace(event.SourceKey)
 	event.VodID = strings.TrimSpace(event.VodID)
 	event.Reason = strings.ToLower(strings.TrimSpace(event.Reason))
+	event.ClientProfile = strings.ToLower(strings.TrimSpace(event.ClientProfile))
+	if len(event.ClientProfile) > 32 {
+		event.ClientProfile = ""
+	}
 	if reasonRunes := []rune(event.Reason); len(reasonRunes) > 256 {
 		event.Reason = string(reasonRunes[:256])
 	}
@@ -51,9 +57,9 @@ func (store *PostgresStore) RecordPlaybackEvent(ctx context.Context, event Playb
 	updated, err := store.database.Exec(ctx, `WITH inserted AS (
     INSERT INTO playback_attempt_events
     (attempt_id, candidate_session_id, event_type, candidate_id, play_line_id, media_unit_id, media_id,
-     source_key, vod_id, elapsed_ms, failure_reason, created_at)
+     source_key, vod_id, elapsed_ms, failure_reason, client_profile, created_at)
     SELECT $1, $9, $2, candidate.id, candidate.line_id, candidate.media_unit_id, candidate.media_id,
-           line.source_key, line.vod_id, $7, $8, NOW()
+           line.source_key, line.vod_id, $7, $8, $10, NOW()
     FROM resource_episode_candidates candidate
     JOIN resource_play_lines line ON line.id = candidate.line_id
     WHERE candidate.id = $3 AND candidate.media_unit_id = $4
@@ -84,14 +90,14 @@ SET last_accessed_at = inserted.created_at,
 FROM inserted
 WHERE resource.source_key = inserted.source_key AND resource.vod_id = inserted.vod_id`,
 		event.AttemptID, event.EventType, event.CandidateID, event.MediaUnitID,
-		event.SourceKey, event.VodID, event.ElapsedMs, event.Reason, event.CandidateSessionID)
+		event.SourceKey, event.VodID, event.ElapsedMs, event.Reason, event.CandidateSessionID, event.ClientProfile)
 	if err != nil {
 		return false, fmt.Errorf("record playback attempt event: %w", err)
 	}
 	return updated > 0, nil
 }
 
-// RefreshQuality 从 7 天明细窗口重算一条资源的播放质量统计。
+// RefreshQuality 从 7 天明细窗口重算一条资源的播放质量统计，以及它各条线路的 QoE 计数。
 func (store *PostgresStore) RefreshQuality(ctx context.Context, sourceKey, vodID string) error {
 	_, err := store.database.Exec(ctx, `UPDATE vod_items SET
     avg_speed_ms = COALESCE(q.avg, 0),
@@ -112,5 +118,97 @@ WHERE source_key = $1 AND vod_id = $2`, sourceKey, vodID)
 	if err != nil {
 		return fmt.Errorf("refresh playback quality: %w", err)
 	}
-	return nil
+	// 同一条资源下各线路（不同播放器组）的体验可能差得很远，线路计数单独重算，
+	// 排序时据此把持续卡顿、起播失败的线路降到后面。
+	_, err = store.database.Exec(ctx, `UPDATE resource_play_lines line SET
+    qoe_attempts = COALESCE(q.attempts, 0),
+    qoe_first_frames = COALESCE(q.first_frames, 0),
+    qoe_rebuffers = COALESCE(q.rebuffers, 0),
+    qoe_failures = COALESCE(q.failures, 0),
+    qoe_auto_switches = COALESCE(q.auto_switches, 0),
+    qoe_refreshed_at = NOW()
+FROM resource_play_lines target
+LEFT JOIN LATERAL (
+    SELECT COUNT(*) FILTER (WHERE e.event_type = 'attempt_started')::INT AS attempts,
+           COUNT(*) FILTER (WHERE e.event_type = 'first_frame')::INT AS first_frames,
+           COUNT(*) FILTER (WHERE e.event_type = 'rebuffer')::INT AS rebuffers,
+           COUNT(*) FILTER (WHERE e.event_type = 'fatal_error')::INT AS failures,
+           COUNT(*) FILTER (WHERE e.event_type = 'source_switched' AND e.failure_reason = 'automatic')::INT AS auto_switches
+    FROM playback_attempt_events e
+    WHERE e.play_line_id = target.id AND e.created_at >= NOW() - INTERVAL '7 days'
+) q ON TRUE
+WHERE line.id = target.id AND target.source_key = $1 AND target.vod_id = $2`, sourceKey, vodID)
+	if err != nil {
+		return fmt.Errorf("refresh line qoe: %w", err)
+	}
+	// 按客户端画像再拆一遍。窗口里已经没有事件的画像整行删掉，免得陈旧样本一直影响排序。
+	_, err = store.database.Exec(ctx, `WITH fresh AS (
+    SELECT e.client_profile,
+           COUNT(*) FILTER (WHERE e.event_type = 'played_10s')::INT AS sc,
+           COUNT(*) FILTER (WHERE e.event_type = 'fatal_error')::INT AS fc,
+           COALESCE(AVG(e.elapsed_ms) FILTER (WHERE e.event_type = 'first_frame'), 0)::INT AS avg
+    FROM playback_attempt_events e
+    WHERE e.source_key = $1 AND e.vod_id = $2 AND e.client_profile <> ''
+      AND e.created_at >= NOW() - INTERVAL '7 days'
+    GROUP BY e.client_profile
+), upserted AS (
+    INSERT INTO resource_profile_health (source_key, vod_id, client_profile, success_count, failure_count, avg_speed_ms, refreshed_at)
+    SELECT $1, $2, client_profile, sc, fc, avg, NOW() FROM fresh
+    ON CONFLICT (source_key, vod_id, client_profile) DO UPDATE
+    SET success_count = EXCLUDED.success_count, failure_count = EXCLUDED.failure_count,
+        avg_speed_ms = EXCLUDED.avg_speed_ms, refreshed_at = EXCLUDED.refreshed_at
+    RETURNING client_profile
+)
+DELETE FROM resource_profile_health
+WHERE source_key = $1 AND vod_id = $2 AND client_profile NOT IN (SELECT client_profile FROM fresh)`, sourceKey, vodID)
+	if err != nil {
+		return fmt.Errorf("refresh profile health: %w", err)
+	}
+	// 资源被人播过才会走到这里，顺带确认一下它所属作品的可播状态。
+	var mediaID int
+	err = store.database.QueryRow(ctx, `SELECT media_id FROM resource_media_links WHERE source_key = $1 AND vod_id = $2`,
+		sourceKey, vodID).Scan(&mediaID)
+	if errors.Is(err, pgx.ErrNoRows) || mediaID <= 0 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("find quality refresh media: %w", err)
+	}
+	return store.enqueueAvailabilityCheck(ctx, "quality_refresh", mediaID)
+}
+
+// ListProfileHealth 批量读取某类客户端在一组资源上的播放统计，没有样本的资源不出现在结果里。
+func (store *PostgresStore) ListProfileHealth(ctx context.Context, profile string, resources []ResourceRef) (map[ResourceRef]ProfileHealth, error) {
+	result := make(map[ResourceRef]ProfileHealth)
+	if profile == "" || len(resources) == 0 {
+		return result, nil
+	}
+	sourceKeys := make([]string, 0, len(resources))
+	vodIDs := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		sourceKeys = append(sourceKeys, resource.SourceKey)
+		vodIDs = append(vodIDs, resource.VodID)
+	}
+	rows, err := store.database.Query(ctx, `SELECT health.source_key, health.vod_id,
+health.success_count, health.failure_count, health.avg_speed_ms
+FROM resource_profile_health health
+JOIN UNNEST($2::TEXT[], $3::TEXT[]) AS wanted(source_key, vod_id)
+  ON wanted.source_key = health.source_key AND wanted.vod_id = health.vod_id
+WHERE health.client_profile = $1`, profile, sourceKeys, vodIDs)
+	if err != nil {
+		return nil, fmt.Errorf("list profile health: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var resource ResourceRef
+		var health ProfileHealth
+		if err := rows.Scan(&resource.SourceKey, &resource.VodID, &health.SuccessCount, &health.FailureCount, &health.AvgLoadMs); err != nil {
+			return nil, fmt.Errorf("scan profile health: %w", err)
+		}
+		result[resource] = health
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate profile health: %w", err)
+	}
+	return result, nil
 }
@@ -11,6 +11,7 @@ func TestRecordPlaybackEventIsCandidateBoundAndIdempotent(t *testing.T) {
 	accepted, err := store.RecordPlaybackEvent(t.Context(), PlaybackAttemptEvent{
 		AttemptID: "attempt-123456", CandidateSessionID: "session-123456", EventType: "fatal_error", CandidateID: 71,
 		MediaUnitID: 51, SourceKey: "source", VodID: "42", ElapsedMs: 30000, Reason: "manifest timeout",
+		ClientProfile: " iOS-Native ",
 	})
 	if err != nil || !accepted {
 		t.Fatalf("accepted/error = %v/%v", accepted, err)
@@ -23,6 +24,7 @@ func TestRecordPlaybackEventIsCandidateBoundAndIdempotent(t *testing.T) {
 		"INSERT INTO worker_jobs",
 		"quality_refreshed_at",
 		"candidate_session_id",
+		"client_profile",
 		"UPDATE vod_items resource",
 		"last_played_at = CASE WHEN inserted.event_type IN ('played_10s', 'ended')",
 	} {
@@ -31,7 +33,7 @@ func TestRecordPlaybackEventIsCandidateBoundAndIdempotent(t *testing.T) {
 		}
 	}
 	arguments := executor.execArguments[0]
-	if len(arguments) != 9 || arguments[0] != "attempt-123456" || arguments[8] != "session-123456" {
+	if len(arguments) != 10 || arguments[0] != "attempt-123456" || arguments[8] != "session-123456" || arguments[9] != "ios-native" {
 		t.Fatalf("event arguments = %#v", arguments)
 	}
 }
@@ -55,9 +57,27 @@ func TestResourceCandidateQueryReadsFromVodItems(t *testing.T) {
 		"COALESCE(resource.resource_status, 'active') <> 'removed'",
 		"COALESCE(resource.vod_play_url, '') <> ''",
 	} {
-		query := resourceCandidateSelect + playableCandidateFilter
+		query := resourceCandidateSelect + PlayableCandidateFilter
 		if !strings.Contains(query, expected) {
 			t.Fatalf("candidate query missing %q: %s", expected, query)
 		}
 	}
 }
+
+func TestRefreshQualityRollsUpLinesAndClientProfiles(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	if err := NewPostgresStore(executor).RefreshQuality(t.Context(), "source", "42"); err != nil {
+		t.Fatal(err)
+	}
+	if len(executor.execQueries) != 3 {
+		t.Fatalf("refresh statements = %d", len(executor.execQueries))
+	}
+	for index, expected := range []string{"UPDATE vod_items SET", "qoe_auto_switches", "INSERT INTO resource_profile_health"} {
+		if !strings.Contains(executor.execQueries[index], expected) {
+			t.Fatalf("refresh statement %d missing %q: %s", index, expected, executor.execQueries[index])
+		}
+	}
+	if !strings.Contains(executor.execQueries[2], "client_profile NOT IN (SELECT client_profile FROM fresh)") {
+		t.Fatalf("profile refresh does not drop stale profiles: %s", executor.execQueries[2])
+	}
+}
@@ -0,0 +1,174 @@
+package mediaidentity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 片头/片尾两种标记。
+const (
+	SkipMarkerIntro = "intro"
+	SkipMarkerOutro = "outro"
+)
+
+// SkipMarkerMinVotes 是形成共识所需的最少独立用户数。少于这个数时宁可不显示「跳过片头」，
+// 一两个人随手点错的区间会让整季的播放体验都跟着出错。
+const SkipMarkerMinVotes = 3
+
+// maxSkipMarkerMs 限制单个区间的长度：片头片尾超过 10 分钟基本就是误操作。
+const maxSkipMarkerMs = 10 * 60 * 1000
+
+// ErrInvalidSkipMarker 表示提交的区间不合法（类型不对、区间反了、太长或集次不存在）。
+var ErrInvalidSkipMarker = errors.New("invalid skip marker")
+
+// SkipMarkerVote 是一个用户对某一集提交的片头或片尾区间。
+type SkipMarkerVote struct {
+	UserID      int
+	MediaUnitID int
+	MarkerType  string
+	StartMs     int
+	EndMs       int
+}
+
+// SkipMarker 是聚合后的共识区间。Scope 为 unit 表示这一集自己的提交已经形成共识，
+// 为 season 表示沿用整季的共识（同一季的片头通常完全一样）。
+type SkipMarker struct {
+	MarkerType string
+	StartMs    int
+	EndMs      int
+	Votes      int
+	Scope      string
+}
+
+// ResolveSkipMarkers 从同一季的全部提交里算出某一集的片头和片尾。
+// 本集自己的提交达到共识时优先使用，否则退回整季的共识；都达不到就不返回该类型。
+func ResolveSkipMarkers(unitID int, votes []SkipMarkerVote) []SkipMarker {
+	markers := make([]SkipMarker, 0, 2)
+	for _, markerType := range []string{SkipMarkerIntro, SkipMarkerOutro} {
+		var unitVotes, seasonVotes []SkipMarkerVote
+		for _, vote := range votes {
+			if vote.MarkerType != markerType {
+				continue
+			}
+			seasonVotes = append(seasonVotes, vote)
+			if vote.MediaUnitID == unitID {
+				unitVotes = append(unitVotes, vote)
+			}
+		}
+		if marker, ok := skipMarkerConsensus(unitVotes, SkipMarkerMinVotes); ok {
+			marker.MarkerType, marker.Scope = markerType, "unit"
+			markers = append(markers, marker)
+			continue
+		}
+		if marker, ok := skipMarkerConsensus(seasonVotes, SkipMarkerMinVotes); ok {
+			marker.MarkerType, marker.Scope = markerType, "season"
+			markers = append(markers, marker)
+		}
+	}
+	return markers
+}
+
+// skipMarkerConsensus 找出互相重叠最多的那一簇提交，取簇内起点和终点的中位数。
+// 不直接对全部提交取中位数，是因为片头位置有时会分成两派（比如有无前情提要），
+// 混在一起算出来的区间两边都不对。簇内按独立用户计票，同一个人给整季每集都标一遍只算一票；
+// 票数相同时取起点更早的一簇（调用方按起点升序传入）。
+func skipMarkerConsensus(votes []SkipMarkerVote, minVotes int) (SkipMarker, bool) {
+	var best []SkipMarkerVote
+	bestUsers := 0
+	for _, anchor := range votes {
+		cluster := make([]SkipMarkerVote, 0, len(votes))
+		users := make(map[int]bool, len(votes))
+		for _, vote := range votes {
+			if vote.StartMs < anchor.EndMs && anchor.StartMs < vote.EndMs {
+				cluster = append(cluster, vote)
+				users[vote.UserID] = true
+			}
+		}
+		if len(users) > bestUsers {
+			best, bestUsers = cluster, len(users)
+		}
+	}
+	if bestUsers < minVotes {
+		return SkipMarker{}, false
+	}
+	starts := make([]int, 0, len(best))
+	ends := make([]int, 0, len(best))
+	for _, vote := range best {
+		starts = append(starts, vote.StartMs)
+		ends = append(ends, vote.EndMs)
+	}
+	marker := SkipMarker{StartMs: medianInt(starts), EndMs: medianInt(ends), Votes: bestUsers}
+	if marker.EndMs <= marker.StartMs {
+		return SkipMarker{}, false
+	}
+	return marker, true
+}
+
+// medianInt 返回中位数，偶数个时取中间两个的平均值。
+func medianInt(values []int) int {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Ints(values)
+	middle := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[middle]
+	}
+	return (values[middle-1] + values[middle]) / 2
+}
+
+// RecordSkipMarker 保存一次片头/片尾标记。同一用户对同一集同一类型重复提交时覆盖旧值。
+func (store *PostgresStore) RecordSkipMarker(ctx context.Context, vote SkipMarkerVote) error {
+	vote.MarkerType = strings.ToLower(strings.TrimSpace(vote.MarkerType))
+	if vote.UserID <= 0 || vote.MediaUnitID <= 0 ||
+		(vote.MarkerType != SkipMarkerIntro && vote.MarkerType != SkipMarkerOutro) ||
+		vote.StartMs < 0 || vote.EndMs <= vote.StartMs || vote.EndMs-vote.StartMs > maxSkipMarkerMs ||
+		vote.EndMs > 24*60*60*1000 {
+		return ErrInvalidSkipMarker
+	}
+	updated, err := store.database.Exec(ctx, `INSERT INTO skip_marker_votes
+(user_id, media_id, season_number, media_unit_id, marker_type, start_ms, end_ms)
+SELECT $1, unit.media_id, unit.season_number, unit.id, $3, $4, $5
+FROM media_units unit WHERE unit.id = $2
+ON CONFLICT (user_id, media_unit_id, marker_type) DO UPDATE
+SET start_ms = EXCLUDED.start_ms, end_ms = EXCLUDED.end_ms, updated_at = NOW()`,
+		vote.UserID, vote.MediaUnitID, vote.MarkerType, vote.StartMs, vote.EndMs)
+	if err != nil {
+		return fmt.Errorf("record skip marker: %w", err)
+	}
+	if updated == 0 {
+		return ErrInvalidSkipMarker
+	}
+	return nil
+}
+
+// ListSkipMarkers 返回某一集的片头片尾共识。一次取出整季的提交，在内存里聚合。
+func (store *PostgresStore) ListSkipMarkers(ctx context.Context, mediaUnitID int) ([]SkipMarker, error) {
+	if mediaUnitID <= 0 {
+		return nil, nil
+	}
+	rows, err := store.database.Query(ctx, `SELECT vote.user_id, vote.media_unit_id, vote.marker_type, vote.start_ms, vote.end_ms
+FROM media_units unit
+JOIN skip_marker_votes vote ON vote.media_id = unit.media_id AND vote.season_number = unit.season_number
+WHERE unit.id = $1
+ORDER BY vote.start_ms, vote.id`, mediaUnitID)
+	if err != nil {
+		return nil, fmt.Errorf("list skip marker votes: %w", err)
+	}
+	defer rows.Close()
+	var votes []SkipMarkerVote
+	for rows.Next() {
+		var vote SkipMarkerVote
+		if err := rows.Scan(&vote.UserID, &vote.MediaUnitID, &vote.MarkerType, &vote.StartMs, &vote.EndMs); err != nil {
+			return nil, fmt.Errorf("scan skip marker vote: %w", err)
+		}
+		votes = append(votes, vote)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate skip marker votes: %w", err)
+	}
+	return ResolveSkipMarkers(mediaUnitID, votes), nil
+}
@@ -0,0 +1,91 @@
+package mediaidentity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolveSkipMarkersUsesMedianOfLargestOverlappingCluster(t *testing.T) {
+	votes := []SkipMarkerVote{
+		// 三个人标在 60~150 秒附近，一个人把前情提要也算进去标成 0~30 秒。
+		{UserID: 4, MediaUnitID: 11, MarkerType: SkipMarkerIntro, StartMs: 0, EndMs: 30000},
+		{UserID: 1, MediaUnitID: 11, MarkerType: SkipMarkerIntro, StartMs: 60000, EndMs: 150000},
+		{UserID: 2, MediaUnitID: 12, MarkerType: SkipMarkerIntro, StartMs: 62000, EndMs: 151000},
+		{UserID: 3, MediaUnitID: 13, MarkerType: SkipMarkerIntro, StartMs: 90000, EndMs: 149000},
+	}
+	markers := ResolveSkipMarkers(11, votes)
+	if len(markers) != 1 {
+		t.Fatalf("markers = %#v", markers)
+	}
+	want := SkipMarker{MarkerType: SkipMarkerIntro, StartMs: 62000, EndMs: 150000, Votes: 3, Scope: "season"}
+	if markers[0] != want {
+		t.Fatalf("marker = %#v, want %#v", markers[0], want)
+	}
+}
+
+func TestResolveSkipMarkersPrefersUnitConsensusOverSeason(t *testing.T) {
+	var votes []SkipMarkerVote
+	for userID := 1; userID <= 3; userID++ {
+		votes = append(votes,
+			SkipMarkerVote{UserID: userID, MediaUnitID: 21, MarkerType: SkipMarkerOutro, StartMs: 2500000, EndMs: 2600000},
+			SkipMarkerVote{UserID: userID, MediaUnitID: 22, MarkerType: SkipMarkerOutro, StartMs: 2500000, EndMs: 2600000},
+			// 第 23 集是加长的季终集，片尾位置完全不同。
+			SkipMarkerVote{UserID: userID + 10, MediaUnitID: 23, MarkerType: SkipMarkerOutro, StartMs: 3400000, EndMs: 3500000},
+		)
+	}
+	finale := ResolveSkipMarkers(23, votes)
+	if len(finale) != 1 || finale[0].Scope != "unit" || finale[0].StartMs != 3400000 {
+		t.Fatalf("finale markers = %#v", finale)
+	}
+	regular := ResolveSkipMarkers(24, votes)
+	if len(regular) != 1 || regular[0].Scope != "season" || regular[0].StartMs != 2500000 {
+		t.Fatalf("regular markers = %#v", regular)
+	}
+}
+
+func TestResolveSkipMarkersCountsDistinctUsersOnly(t *testing.T) {
+	// 同一个人给整季都标了一遍，不能凭一己之力形成共识。
+	votes := []SkipMarkerVote{
+		{UserID: 1, MediaUnitID: 31, MarkerType: SkipMarkerIntro, StartMs: 0, EndMs: 90000},
+		{UserID: 1, MediaUnitID: 32, MarkerType: SkipMarkerIntro, StartMs: 0, EndMs: 90000},
+		{UserID: 1, MediaUnitID: 33, MarkerType: SkipMarkerIntro, StartMs: 0, EndMs: 90000},
+		{UserID: 2, MediaUnitID: 31, MarkerType: SkipMarkerIntro, StartMs: 0, EndMs: 90000},
+	}
+	if markers := ResolveSkipMarkers(31, votes); len(markers) != 0 {
+		t.Fatalf("markers below min votes = %#v", markers)
+	}
+}
+
+func TestRecordSkipMarkerDerivesSeasonFromUnit(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	store := NewPostgresStore(executor)
+	if err := store.RecordSkipMarker(t.Context(), SkipMarkerVote{
+		UserID: 7, MediaUnitID: 51, MarkerType: " Intro ", StartMs: 5000, EndMs: 95000,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	query := executor.execQueries[0]
+	for _, expected := range []string{"FROM media_units unit WHERE unit.id = $2", "ON CONFLICT (user_id, media_unit_id, marker_type) DO UPDATE"} {
+		if !strings.Contains(query, expected) {
+			t.Fatalf("skip marker query missing %q: %s", expected, query)
+		}
+	}
+	if arguments := executor.execArguments[0]; arguments[2] != SkipMarkerIntro {
+		t.Fatalf("skip marker arguments = %#v", arguments)
+	}
+}
+
+func TestRecordSkipMarkerRejectsInvalidRanges(t *testing.T) {
+	store := NewPostgresStore(&identityFoundationExecutor{})
+	for _, vote := range []SkipMarkerVote{
+		{UserID: 7, MediaUnitID: 51, MarkerType: "recap", StartMs: 0, EndMs: 1000},
+		{UserID: 7, MediaUnitID: 51, MarkerType: SkipMarkerIntro, StartMs: 9000, EndMs: 1000},
+		{UserID: 7, MediaUnitID: 51, MarkerType: SkipMarkerIntro, StartMs: 0, EndMs: 11 * 60 * 1000},
+		{UserID: 0, MediaUnitID: 51, MarkerType: SkipMarkerOutro, StartMs: 0, EndMs: 1000},
+	} {
+		if err := store.RecordSkipMarker(t.Context(), vote); !errors.Is(err, ErrInvalidSkipMarker) {
+			t.Fatalf("RecordSkipMarker(%#v) error = %v", vote, err)
+		}
+	}
+}
@@ -30,6 +30,23 @@ func TestSourceFieldsKeepProviderPriorityBoundaries(t *testing.T) {
 			t.Fatalf("TMDB duration priority = %d", field.priority)
 		}
 	}
+	bangumi := sourceFields("bangumi", Media{MediaType: "tv", Title: "咒术回战 第二季", OriginalTitle: "呪術廻戦", Summary: "简介"})
+	for _, field := range bangumi {
+		switch field.column {
+		case "media_type":
+			if field.priority != 0 {
+				t.Fatalf("Bangumi claimed media type: %d", field.priority)
+			}
+		case "title", "summary":
+			if field.priority >= 70 {
+				t.Fatalf("Bangumi %s priority %d would override Douban or TMDB", field.column, field.priority)
+			}
+		case "original_title":
+			if field.priority <= 70 || field.priority >= 100 {
+				t.Fatalf("Bangumi original title priority = %d", field.priority)
+			}
+		}
+	}
 	manual := sourceFields("manual", Media{Poster: "pinned"})
 	for _, field := range manual {
 		if field.column == "poster" && field.priority != 1000 {
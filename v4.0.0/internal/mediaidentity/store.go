@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -66,6 +67,22 @@ type PlaybackEventWriter interface {
 	RecordPlaybackEvent(ctx context.Context, event PlaybackAttemptEvent) (bool, error)
 }
 
+// ProfileHealthReader 按客户端画像读取资源播放统计，播放候选据此为每类设备单独排序。
+type ProfileHealthReader interface {
+	ListProfileHealth(ctx context.Context, profile string, resources []ResourceRef) (map[ResourceRef]ProfileHealth, error)
+}
+
+// NextUnitReader 查找紧接着的下一集，用于自动连播。
+type NextUnitReader interface {
+	NextUnit(ctx context.Context, mediaUnitID int) (MediaUnit, error)
+}
+
+// SkipMarkerStore 读写用户标记的片头片尾区间。
+type SkipMarkerStore interface {
+	RecordSkipMarker(ctx context.Context, vote SkipMarkerVote) error
+	ListSkipMarkers(ctx context.Context, mediaUnitID int) ([]SkipMarker, error)
+}
+
 // AliasWriter 写入别名。
 type AliasWriter interface {
 	UpsertAlias(ctx context.Context, alias Alias) error
@@ -80,11 +97,11 @@ type sourceField struct {
 }
 
 // mergeRuleVersion 是合并规则的版本号，改优先级表时应当同步递增，便于识别历史数据。
-const mergeRuleVersion = 1
+const mergeRuleVersion = 2
 
 // MergeSource 是规范数据的第二阶段写入路径。它为每个字段分别保留获胜来源，
 // 不允许最后完成的豆瓣/TMDB 任务覆盖无关字段。空输入会被忽略；优先级相同时，
-// 较新的成功刷新可以替换旧数据。
+// 较新的成功刷新可以替换旧数据。管理员锁定的字段一律跳过，真正改了值的字段记一条变更历史。
 func (store *PostgresStore) MergeSource(ctx context.Context, provider string, media Media, payload []byte, externalIDs ...ExternalID) (Media, error) {
 	canonical, err := store.ensureMergeBase(ctx, media)
 	if err != nil {
@@ -94,14 +111,24 @@ func (store *PostgresStore) MergeSource(ctx context.Context, provider string, me
 		if field.priority <= 0 || field.text == "" {
 			continue
 		}
-		updated, err := store.database.Exec(ctx, `UPDATE media
-SET `+field.column+` = $2, metadata_version = GREATEST(metadata_version, $3),
-updated_at = CASE WHEN `+field.column+` IS DISTINCT FROM $2 THEN NOW() ELSE updated_at END
-WHERE id = $1 AND (
-    NOT EXISTS (SELECT 1 FROM media_field_sources WHERE media_id = $1 AND field_name = $4)
-    OR $5 >= (SELECT priority FROM media_field_sources WHERE media_id = $1 AND field_name = $4)
-)`, canonical.ID, field.value, maxInt(canonical.MetadataVersion, 2), field.column, field.priority)
-		if err != nil {
+		updated := 0
+		if err := store.database.QueryRow(ctx, `WITH previous AS (
+    SELECT `+field.column+`::text AS value FROM media WHERE id = $1
+), updated AS (
+    UPDATE media
+    SET `+field.column+` = $2, metadata_version = GREATEST(metadata_version, $3),
+    updated_at = CASE WHEN `+field.column+` IS DISTINCT FROM $2 THEN NOW() ELSE updated_at END
+    WHERE id = $1 AND NOT EXISTS (
+        SELECT 1 FROM media_field_sources
+        WHERE media_id = $1 AND field_name = $4 AND (locked OR priority > $5)
+    )
+    RETURNING `+field.column+`::text AS value
+), history AS (
+    INSERT INTO media_field_history (media_id, field_name, provider, old_value, new_value)
+    SELECT $1, $4, $6, previous.value, updated.value FROM previous, updated
+    WHERE previous.value IS DISTINCT FROM updated.value
+)
+SELECT COUNT(*) FROM updated`, canonical.ID, field.value, maxInt(canonical.MetadataVersion, 2), field.column, field.priority, provider).Scan(&updated); err != nil {
 			return Media{}, fmt.Errorf("merge media field %s: %w", field.column, err)
 		}
 		if updated == 0 {
@@ -159,12 +186,15 @@ WHERE EXCLUDED.priority >= media_field_sources.priority`, canonical.ID, field.co
 // sourceFields 是字段级来源优先级表，也是整个合并机制的核心：
 // 谁在哪个字段上更权威，就由这张表说了算（数字越大越权威）。
 // 例如片名信豆瓣（100 > TMDB 的 50），原名和剧照信 TMDB，人工修改一律 1000 压过所有来源。
+// TMDB 的导演和演员只给没有豆瓣条目的作品兜底，优先级同样低于豆瓣。
+// Bangumi 只管动画：原名（日文名）比豆瓣可信，其余字段都只在前两者缺数据时兜底。
 func sourceFields(provider string, media Media) []sourceField {
 	provider = strings.ToLower(strings.TrimSpace(provider))
 	priorities := map[string]map[string]int{
-		"douban": {"media_type": 100, "title": 100, "original_title": 70, "year": 80, "poster": 100, "summary": 100, "genres": 100, "countries": 100, "directors": 100, "actors": 100, "duration": 80, "rating_douban": 100},
-		"tmdb":   {"media_type": 100, "title": 50, "original_title": 100, "year": 90, "poster": 60, "backdrops": 100, "summary": 70, "genres": 70, "countries": 60, "duration": 100, "rating_tmdb": 100, "vote_count_tmdb": 100, "series_status": 100},
-		"manual": {"media_type": 1000, "title": 1000, "original_title": 1000, "year": 1000, "poster": 1000, "backdrops": 1000, "summary": 1000, "genres": 1000, "countries": 1000, "directors": 1000, "actors": 1000, "duration": 1000, "rating_douban": 1000, "rating_tmdb": 1000, "vote_count_tmdb": 1000, "series_status": 1000},
+		"douban":  {"media_type": 100, "title": 100, "original_title": 70, "year": 80, "poster": 100, "summary": 100, "genres": 100, "countries": 100, "directors": 100, "actors": 100, "duration": 80, "rating_douban": 100},
+		"tmdb":    {"media_type": 100, "title": 50, "original_title": 100, "year": 90, "poster": 60, "backdrops": 100, "summary": 70, "genres": 70, "countries": 60, "directors": 50, "actors": 50, "duration": 100, "rating_tmdb": 100, "vote_count_tmdb": 100, "series_status": 100},
+		"bangumi": {"title": 40, "original_title": 80, "year": 60, "poster": 40, "summary": 50},
+		"manual":  {"media_type": 1000, "title": 1000, "original_title": 1000, "year": 1000, "poster": 1000, "backdrops": 1000, "summary": 1000, "genres": 1000, "countries": 1000, "directors": 1000, "actors": 1000, "duration": 1000, "rating_douban": 1000, "rating_tmdb": 1000, "vote_count_tmdb": 1000, "series_status": 1000},
 	}
 	pick := func(column string, value any, text string) sourceField {
 		return sourceField{column: column, value: value, text: text, priority: priorities[provider][column]}
@@ -225,17 +255,33 @@ func nullableMediaID(id int) any {
 }
 
 // PostgresStore 是 mediaidentity 全部存储接口的唯一实现。
-type PostgresStore struct{ database database.Executor }
+// beginner 只有重复作品合并/拆分和替换演职员表用得到，传入的执行器不支持事务时这几个操作直接报错。
+type PostgresStore struct {
+	database database.Executor
+	beginner database.Beginner
+}
 
 // NewPostgresStore 创建存储实现。
 func NewPostgresStore(executor database.Executor) *PostgresStore {
-	return &PostgresStore{database: executor}
+	store := &PostgresStore{database: executor}
+	if beginner, ok := executor.(database.Beginner); ok {
+		store.beginner = beginner
+	}
+	return store
 }
 
 // ensureMergeBase 在不替换任何既有 Provider 数据的前提下创建规范行。
 // MergeSource 会在之后应用字段级优先级；若此处使用普通 Upsert，低优先级刷新可能在
-// 优先级判断之前就覆盖整行。
+// 优先级判断之前就覆盖整行。带 ID 的输入是按 media.id 刷新已有作品（没有豆瓣 ID 的
+// 作品只能这样定位），直接取现有行。
 func (store *PostgresStore) ensureMergeBase(ctx context.Context, media Media) (Media, error) {
+	if media.ID > 0 {
+		canonical, err := store.FindByID(ctx, media.ID)
+		if err != nil {
+			return Media{}, fmt.Errorf("find merge media: %w", err)
+		}
+		return canonical, nil
+	}
 	if strings.TrimSpace(media.DoubanID) == "" {
 		return store.Upsert(ctx, media)
 	}
@@ -736,7 +782,7 @@ changed_at = CASE
 }
 
 // LinkResource 建立「资源 → 媒体」的关联，并把该资源下所有剧集候选的 media_id 一起补上。
-// 已锁定（人工确认过）的关联不会被自动匹配改掉。
+// 已锁定（人工确认过）的关联不会被自动匹配改掉。有人想看的作品还会投一个可播检查。
 func (store *PostgresStore) LinkResource(ctx context.Context, link ResourceLink) error {
 	if link.Confidence <= 0 {
 		link.Confidence = 1
@@ -760,6 +806,7 @@ FROM resource_play_lines line
 WHERE candidate.line_id = line.id AND line.source_key = $1 AND line.vod_id = $2`, link.SourceKey, link.VodID, link.MediaID); err != nil {
 			return fmt.Errorf("bind structured resource candidates: %w", err)
 		}
+		return store.enqueueAvailabilityCheck(ctx, "resource_linked", link.MediaID)
 	}
 	return nil
 }
@@ -799,7 +846,9 @@ reason = EXCLUDED.reason, updated_at = NOW()`, sourceKey, vodID, mediaID, confid
 
 // UpsertEpisodes 写入资源的播放线路和分集候选：
 // 先按需建 media_units，再写 resource_play_lines，最后写 resource_episode_candidates。
+// 写完给涉及的作品投可播检查，增量采集让想看的片第一次有了分集也能及时提醒。
 func (store *PostgresStore) UpsertEpisodes(ctx context.Context, episodes []Episode) error {
+	mediaIDs := make([]int, 0, 1)
 	for _, episode := range episodes {
 		if episode.SourceKey == "" || episode.VodID == "" || episode.EpisodeKey == "" || episode.PlayURL == "" {
 			continue
@@ -867,8 +916,11 @@ resource_status = 'active', last_seen_at = EXCLUDED.last_seen_at, updated_at = N
 			episode.SortOrder, status, nullableTime(episode.LastSeenAt)); err != nil {
 			return fmt.Errorf("upsert resource episode candidate %s/%s/%s/%s: %w", episode.SourceKey, episode.VodID, lineKey, episode.EpisodeKey, err)
 		}
+		if episode.MediaID > 0 && !slices.Contains(mediaIDs, episode.MediaID) {
+			mediaIDs = append(mediaIDs, episode.MediaID)
+		}
 	}
-	return nil
+	return store.enqueueAvailabilityCheck(ctx, "episodes_indexed", mediaIDs...)
 }
 
 // nullableUnitInt 把非正数转成 NULL 写库。
@@ -887,7 +939,7 @@ func (store *PostgresStore) ListResourceCandidates(ctx context.Context, mediaID,
 	return store.listResourceCandidates(ctx, resourceCandidateSelect+`
 WHERE candidate.media_id = $1 AND candidate.season_number = $2 AND candidate.episode_key = $3
   AND candidate.resource_status NOT IN ('retired', 'deleted')
-  AND line.resource_status NOT IN ('retired', 'deleted')`+playableCandidateFilter+`
+  AND line.resource_status NOT IN ('retired', 'deleted')`+PlayableCandidateFilter+`
 ORDER BY line.sort_order ASC, candidate.sort_order ASC`, mediaID, seasonNumber, episodeKey)
 }
 
@@ -903,7 +955,7 @@ func (store *PostgresStore) ListAllEpisodes(ctx context.Context, mediaID int) ([
 		JOIN vod_items resource ON resource.source_key = line.source_key AND resource.vod_id = line.vod_id
 		WHERE candidate.media_id = $1
 		  AND candidate.resource_status NOT IN ('retired','deleted')
-		  AND line.resource_status NOT IN ('retired','deleted')`+playableCandidateFilter+`
+		  AND line.resource_status NOT IN ('retired','deleted')`+PlayableCandidateFilter+`
 		GROUP BY candidate.season_number, candidate.episode_key
 		ORDER BY candidate.season_number ASC, candidate.episode_key ASC`, mediaID)
 	if err != nil {
@@ -929,15 +981,20 @@ func (store *PostgresStore) ListUnitResourceCandidates(ctx context.Context, medi
 	return store.listResourceCandidates(ctx, resourceCandidateSelect+`
 WHERE candidate.media_unit_id = $1
   AND candidate.resource_status NOT IN ('retired', 'deleted')
-  AND line.resource_status NOT IN ('retired', 'deleted')`+playableCandidateFilter+`
+  AND line.resource_status NOT IN ('retired', 'deleted')`+PlayableCandidateFilter+`
 ORDER BY line.sort_order ASC, candidate.sort_order ASC`, mediaUnitID)
 }
 
-const playableCandidateFilter = `
-  AND COALESCE(candidate.play_url, '') <> ''
+// PlayableResourceFilter 是「资源能播」的口径：vod_items（别名 resource）没有下架，并且有播放地址。
+// 统一搜索把这样的关联资源算作可播（有分集是 ready，没有是 direct），周报判断新上线也用它。
+const PlayableResourceFilter = `
   AND COALESCE(resource.resource_status, 'active') <> 'removed'
   AND COALESCE(resource.vod_play_url, '') <> ''`
 
+// PlayableCandidateFilter 在 PlayableResourceFilter 之上再要求分集候选（别名 candidate）有播放地址。
+const PlayableCandidateFilter = `
+  AND COALESCE(candidate.play_url, '') <> ''` + PlayableResourceFilter
+
 const resourceCandidateSelect = `SELECT candidate.id, line.id, line.line_key, line.line_label, line.sort_order,
 line.source_key, line.vod_id, candidate.media_id, candidate.media_unit_id, candidate.season_number,
 candidate.episode_key, candidate.episode_label, candidate.play_url, candidate.sort_order, candidate.format, candidate.quality,
@@ -945,7 +1002,8 @@ candidate.resource_status, candidate.last_seen_at, candidate.last_accessed_at,
 COALESCE(resource.success_count, 0)::INTEGER,
 COALESCE(resource.failure_count, 0)::INTEGER,
 COALESCE(resource.avg_speed_ms, 0)::INTEGER,
-COALESCE(link.confidence, 0)
+COALESCE(link.confidence, 0),
+line.qoe_attempts, line.qoe_first_frames, line.qoe_rebuffers, line.qoe_failures, line.qoe_auto_switches
 FROM resource_episode_candidates candidate
 JOIN resource_play_lines line ON line.id = candidate.line_id
 JOIN vod_items resource ON resource.source_key = line.source_key AND resource.vod_id = line.vod_id
@@ -968,7 +1026,9 @@ func (store *PostgresStore) listResourceCandidates(ctx context.Context, query st
 			&candidate.SourceKey, &candidate.VodID, &mediaID, &mediaUnitID, &candidate.SeasonNumber,
 			&candidate.EpisodeKey, &candidate.EpisodeLabel, &candidate.PlayURL, &candidate.SortOrder,
 			&candidate.Format, &candidate.Quality, &candidate.ResourceStatus, &lastSeen, &lastAccessed,
-			&candidate.SuccessCount, &candidate.FailureCount, &candidate.AvgLoadMs, &candidate.MappingConfidence); err != nil {
+			&candidate.SuccessCount, &candidate.FailureCount, &candidate.AvgLoadMs, &candidate.MappingConfidence,
+			&candidate.LineQoE.Attempts, &candidate.LineQoE.FirstFrames, &candidate.LineQoE.Rebuffers,
+			&candidate.LineQoE.Failures, &candidate.LineQoE.AutoSwitches); err != nil {
 			return nil, fmt.Errorf("scan resource candidate: %w", err)
 		}
 		if mediaID != nil {
@@ -1075,7 +1135,7 @@ HAVING COUNT(DISTINCT media_id) = 1`, provider, externalID).Scan(&mediaID); err
 }
 
 // FindMediaIDByTitleYearType 对规范标题、年份和媒体类型执行严格精确匹配。
-// 这是匹配层级的第 3 层：置信度高于加权评分，但低于直接 ID 匹配。
+// 这是匹配层级的第 3 层：置信度高于加权评分，但低于直接 ID 匹配。已并入其他作品的条目不参与。
 func (store *PostgresStore) FindMediaIDByTitleYearType(ctx context.Context, title, year, mediaType string) (int, error) {
 	normalizedTitle := NormalizeTitle(title)
 	if normalizedTitle == "" || strings.TrimSpace(year) == "" {
@@ -1084,13 +1144,13 @@ func (store *PostgresStore) FindMediaIDByTitleYearType(ctx context.Context, titl
 	var query string
 	var args []any
 	if mediaType != "" {
-		query = mediaSelect + ` WHERE year = $2 AND media_type = $4 AND (
+		query = mediaSelect + ` WHERE year = $2 AND media_type = $4 AND merged_into_id IS NULL AND (
     LOWER(title) = LOWER($1) OR id IN (
         SELECT media_id FROM media_aliases WHERE normalized_alias = $3 OR LOWER(alias) = LOWER($1)
     )) ORDER BY updated_at DESC LIMIT 1`
 		args = []any{strings.TrimSpace(title), strings.TrimSpace(year), normalizedTitle, mediaType}
 	} else {
-		query = mediaSelect + ` WHERE year = $2 AND (
+		query = mediaSelect + ` WHERE year = $2 AND merged_into_id IS NULL AND (
     LOWER(title) = LOWER($1) OR id IN (
         SELECT media_id FROM media_aliases WHERE normalized_alias = $3 OR LOWER(alias) = LOWER($1)
     )) ORDER BY updated_at DESC LIMIT 1`
@@ -0,0 +1,74 @@
+package mediaidentity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Translation 是作品在某个语言下的片名、简介和宣传语。空字段表示来源没给，展示时退回 media 表里的默认语言。
+type Translation struct {
+	MediaID   int
+	Locale    string
+	Title     string
+	Summary   string
+	Tagline   string
+	Provider  string
+	UpdatedAt time.Time
+}
+
+// TranslationWriter 写入多语言资料。
+type TranslationWriter interface {
+	UpsertTranslation(ctx context.Context, translation Translation) error
+}
+
+// TranslationReader 读取作品某个语言的资料，没有时返回 nil。
+type TranslationReader interface {
+	FindTranslation(ctx context.Context, mediaID int, locale string) (*Translation, error)
+}
+
+// UpsertTranslation 写入一个语言的资料。新值为空的字段保留旧值：上游偶尔缺某个语言的简介，
+// 不能因为一次不完整的刷新把已有的译文清掉。
+func (store *PostgresStore) UpsertTranslation(ctx context.Context, translation Translation) error {
+	translation.Locale = strings.TrimSpace(translation.Locale)
+	translation.Provider = strings.ToLower(strings.TrimSpace(translation.Provider))
+	translation.Title = strings.TrimSpace(translation.Title)
+	translation.Summary = strings.TrimSpace(translation.Summary)
+	translation.Tagline = strings.TrimSpace(translation.Tagline)
+	if translation.MediaID <= 0 || translation.Locale == "" || translation.Provider == "" {
+		return fmt.Errorf("invalid translation %s/%s for media %d", translation.Locale, translation.Provider, translation.MediaID)
+	}
+	if translation.Title == "" && translation.Summary == "" && translation.Tagline == "" {
+		return nil
+	}
+	if _, err := store.database.Exec(ctx, `INSERT INTO media_translations (media_id, locale, title, summary, tagline, provider)
+VALUES ($1,$2,$3,$4,$5,$6)
+ON CONFLICT (media_id, locale) DO UPDATE SET
+title = CASE WHEN EXCLUDED.title <> '' THEN EXCLUDED.title ELSE media_translations.title END,
+summary = CASE WHEN EXCLUDED.summary <> '' THEN EXCLUDED.summary ELSE media_translations.summary END,
+tagline = CASE WHEN EXCLUDED.tagline <> '' THEN EXCLUDED.tagline ELSE media_translations.tagline END,
+provider = EXCLUDED.provider, updated_at = NOW()`, translation.MediaID, translation.Locale,
+		translation.Title, translation.Summary, translation.Tagline, translation.Provider); err != nil {
+		return fmt.Errorf("upsert media translation: %w", err)
+	}
+	return nil
+}
+
+// FindTranslation 读取作品某个语言的资料。
+func (store *PostgresStore) FindTranslation(ctx context.Context, mediaID int, locale string) (*Translation, error) {
+	translation := Translation{MediaID: mediaID, Locale: strings.TrimSpace(locale)}
+	err := store.database.QueryRow(ctx, `SELECT title, summary, tagline, provider, updated_at
+FROM media_translations WHERE media_id = $1 AND locale = $2`, mediaID, translation.Locale).Scan(
+		&translation.Title, &translation.Summary, &translation.Tagline, &translation.Provider, &translation.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find media translation: %w", err)
+	}
+	return &translation, nil
+}
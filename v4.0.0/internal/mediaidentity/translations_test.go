@@ -0,0 +1,28 @@
+package mediaidentity
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestUpsertTranslationKeepsExistingFieldsAndSkipsEmptyRows(t *testing.T) {
+	executor := &identityFoundationExecutor{}
+	store := NewPostgresStore(executor)
+	if err := store.UpsertTranslation(context.Background(), Translation{MediaID: 7, Locale: "en", Provider: " TMDB ", Title: " The Shawshank Redemption "}); err != nil {
+		t.Fatal(err)
+	}
+	if len(executor.execQueries) != 1 || !strings.Contains(executor.execQueries[0], "ELSE media_translations.summary") {
+		t.Fatalf("upsert should keep stored fields when the new ones are empty: %v", executor.execQueries)
+	}
+	if arguments := executor.execArguments[0]; arguments[2] != "The Shawshank Redemption" || arguments[3] != "" || arguments[5] != "tmdb" {
+		t.Fatalf("upsert arguments = %v", arguments)
+	}
+	// 全空的一行没有意义，不写库。
+	if err := store.UpsertTranslation(context.Background(), Translation{MediaID: 7, Locale: "en", Provider: "tmdb"}); err != nil || len(executor.execQueries) != 1 {
+		t.Fatalf("empty translation = %v, queries = %d", err, len(executor.execQueries))
+	}
+	if err := store.UpsertTranslation(context.Background(), Translation{Locale: "en", Provider: "tmdb", Title: "x"}); err == nil {
+		t.Fatal("translation without media should fail")
+	}
+}
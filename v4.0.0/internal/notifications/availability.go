@@ -0,0 +1,122 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+	"github.com/TwoThreeWang/Moovie/new/internal/search"
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+// WishedMedia 是提醒里要用到的作品信息。
+type WishedMedia struct {
+	ID       int
+	DoubanID string
+	Title    string
+	Year     string
+}
+
+// AvailabilityStore 记录作品上一次的播放状态和进入这个状态的时间，并列出想看它的用户。由 PostgresStore 实现。
+type AvailabilityStore interface {
+	PlaybackState(ctx context.Context, mediaID int) (string, time.Time, error)
+	SavePlaybackState(ctx context.Context, mediaID int, state string) error
+	ListWishers(ctx context.Context, mediaID int) (WishedMedia, []Recipient, error)
+}
+
+// Notifier 是发通知的能力，由 Service 实现。
+type Notifier interface {
+	Notify(ctx context.Context, recipient Recipient, notification Notification) error
+}
+
+// AvailabilityNotifier 处理 availability_check 任务：作品的播放摘要从 none 变成 direct 或 ready 时，
+// 给每位想看它的用户发一条「想看的片可以看了」。任务由 mediaidentity 在资源关联、分集写入和质量重算后投递。
+type AvailabilityNotifier struct {
+	store    AvailabilityStore
+	playback search.PlaybackSummaryReader
+	notifier Notifier
+}
+
+// NewAvailabilityNotifier 创建可播提醒处理器。
+func NewAvailabilityNotifier(store AvailabilityStore, playback search.PlaybackSummaryReader, notifier Notifier) *AvailabilityNotifier {
+	return &AvailabilityNotifier{store: store, playback: playback, notifier: notifier}
+}
+
+// Handle 比较作品当前和上次记录的播放状态。先发通知再保存状态：
+// 发到一半失败时任务重试，收件箱按「这一次上线」去重，已经收到的人不会收到第二条。
+func (availability *AvailabilityNotifier) Handle(ctx context.Context, job workqueue.Job) error {
+	var payload struct {
+		MediaID int `json:"media_id"`
+	}
+	if err := json.Unmarshal(job.Payload, &payload); err != nil || payload.MediaID <= 0 {
+		return workqueue.Terminal(fmt.Errorf("invalid availability check payload"))
+	}
+	return availability.Check(ctx, payload.MediaID)
+}
+
+// Check 检查一部作品，必要时发提醒。
+func (availability *AvailabilityNotifier) Check(ctx context.Context, mediaID int) error {
+	summaries, err := availability.playback.ListPlaybackSummaries(ctx, []int{mediaID})
+	if err != nil {
+		return err
+	}
+	current := summaries[mediaID].State
+	if current == "" {
+		current = search.PlaybackNone
+	}
+	previous, since, err := availability.store.PlaybackState(ctx, mediaID)
+	if err != nil {
+		return err
+	}
+	if search.PlaybackState(previous) == search.PlaybackNone && current != search.PlaybackNone {
+		if err := availability.notifyWishers(ctx, mediaID, current, since); err != nil {
+			return err
+		}
+	}
+	return availability.store.SavePlaybackState(ctx, mediaID, string(current))
+}
+
+// notifyWishers 给想看这部作品的每个人发一条提醒，单人失败不影响其他人。
+// since 是作品进入 none 的时间，用来区分同一部作品下架后的再次上线。
+func (availability *AvailabilityNotifier) notifyWishers(ctx context.Context, mediaID int, state search.PlaybackState, since time.Time) error {
+	media, recipients, err := availability.store.ListWishers(ctx, mediaID)
+	if err != nil {
+		return err
+	}
+	notification := wishAvailableNotification(media, state, since)
+	var failures []error
+	for _, recipient := range recipients {
+		if err := availability.notifier.Notify(ctx, recipient, notification); err != nil {
+			failures = append(failures, fmt.Errorf("user %d: %w", recipient.UserID, err))
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// wishAvailableNotification 写提醒的文案。ready 说明分集已经整理好，可以直接选集播放。
+func wishAvailableNotification(media WishedMedia, state search.PlaybackState, since time.Time) Notification {
+	title := "《" + media.Title + "》"
+	if media.Year != "" {
+		title += "（" + media.Year + "）"
+	}
+	body := title + " 有片源了，去看看吧。"
+	if state == search.PlaybackReady {
+		body = title + " 有片源了，分集已经整理好，可以直接播放。"
+	}
+	return Notification{Kind: KindWishAvailable, Title: "想看的" + title + "可以看了", Body: body,
+		Link: "/movie/" + catalog.Movie{ID: media.ID, DoubanID: media.DoubanID}.DetailKey(), DedupeKey: availabilityDedupeKey(media.ID, since)}
+}
+
+// availabilityDedupeKey 按「这一次上线」去重：作品 ID 加上它进入 none 的时间。
+// 从没记录过状态的作品只用作品 ID，和早先写入的提醒保持一致；下架后被重置成 none 的作品带上重置时间，
+// 再上线时是一条新提醒。
+func availabilityDedupeKey(mediaID int, since time.Time) string {
+	if since.IsZero() {
+		return strconv.Itoa(mediaID)
+	}
+	return strconv.Itoa(mediaID) + ":" + strconv.FormatInt(since.Unix(), 10)
+}
@@ -0,0 +1,201 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+)
+
+// emailTimeout 是一封邮件从建连到 QUIT 的总时限。net/smtp 本身不认 context，只能靠连接截止时间兜底。
+const emailTimeout = 20 * time.Second
+
+// ConfiguredChannels 按配置返回启用的站外渠道：填了 SMTP_HOST 才发邮件，填了 NOTIFY_WEBHOOK_URL 才推 Webhook。
+// client 是 Webhook 用的出站客户端。
+func ConfiguredChannels(cfg config.Config, client *http.Client) []Channel {
+	channels := make([]Channel, 0, 2)
+	if cfg.Notify.SMTPHost != "" {
+		channels = append(channels, NewEmailChannel(cfg.Notify, cfg.SiteName, cfg.SiteURL))
+	}
+	if cfg.Notify.WebhookURL != "" {
+		channels = append(channels, NewWebhookChannel(client, cfg.Notify.WebhookURL, cfg.Notify.WebhookSecret, cfg.SiteURL))
+	}
+	return channels
+}
+
+// EmailChannel 通过 SMTP 给用户注册邮箱发纯文本邮件。
+type EmailChannel struct {
+	config   config.NotifyConfig
+	siteName string
+	siteURL  string
+}
+
+// NewEmailChannel 创建邮件渠道。
+func NewEmailChannel(notify config.NotifyConfig, siteName, siteURL string) *EmailChannel {
+	return &EmailChannel{config: notify, siteName: siteName, siteURL: siteURL}
+}
+
+// Name 返回渠道名，用于日志。
+func (channel *EmailChannel) Name() string { return "email" }
+
+// Send 发一封邮件。服务器支持 STARTTLS 时先升级加密；配置了用户名才做 AUTH PLAIN。
+func (channel *EmailChannel) Send(ctx context.Context, recipient Recipient, notification Notification) error {
+	if recipient.Email == "" {
+		return nil
+	}
+	to, err := mail.ParseAddress(recipient.Email)
+	if err != nil {
+		return fmt.Errorf("parse recipient email: %w", err)
+	}
+	address := net.JoinHostPort(channel.config.SMTPHost, strconv.Itoa(channel.config.SMTPPort))
+	dialer := net.Dialer{Timeout: emailTimeout}
+	connection, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("dial smtp: %w", err)
+	}
+	deadline := time.Now().Add(emailTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = connection.SetDeadline(deadline)
+	client, err := smtp.NewClient(connection, channel.config.SMTPHost)
+	if err != nil {
+		_ = connection.Close()
+		return fmt.Errorf("open smtp session: %w", err)
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: channel.config.SMTPHost}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if channel.config.SMTPUsername != "" {
+		auth := smtp.PlainAuth("", channel.config.SMTPUsername, channel.config.SMTPPassword, channel.config.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(channel.config.SMTPFrom); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("smtp rcpt to: %w", err)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := writer.Write(channel.message(to, notification)); err != nil {
+		return fmt.Errorf("write smtp message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("finish smtp message: %w", err)
+	}
+	return client.Quit()
+}
+
+// message 拼出完整邮件。标题走 RFC 2047 编码，正文 UTF-8 纯文本按 base64 传输，
+// 不依赖对方服务器支持 8BITMIME。
+func (channel *EmailChannel) message(to *mail.Address, notification Notification) []byte {
+	from := mail.Address{Name: channel.siteName, Address: channel.config.SMTPFrom}
+	body := notification.Body
+	if notification.Link != "" {
+		body += "\r\n\r\n" + platformweb.CanonicalURL(channel.siteURL, notification.Link)
+	}
+	var message bytes.Buffer
+	message.WriteString("From: " + from.String() + "\r\n")
+	message.WriteString("To: " + to.String() + "\r\n")
+	message.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", notification.Title) + "\r\n")
+	message.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		message.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	message.WriteString(encoded + "\r\n")
+	return message.Bytes()
+}
+
+// webhookPayload 是推给 Webhook 的 JSON。URL 已经是绝对地址。
+type webhookPayload struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	URL       string    `json:"url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookChannel 把每条通知 POST 到运营配置的地址，比如 Bot 或自动化平台。
+type WebhookChannel struct {
+	client  *http.Client
+	url     string
+	secret  string
+	siteURL string
+}
+
+// NewWebhookChannel 创建 Webhook 渠道。secret 为空时不签名。
+func NewWebhookChannel(client *http.Client, url, secret, siteURL string) *WebhookChannel {
+	return &WebhookChannel{client: client, url: url, secret: secret, siteURL: siteURL}
+}
+
+// Name 返回渠道名，用于日志。
+func (channel *WebhookChannel) Name() string { return "webhook" }
+
+// Send 推送一条通知，非 2xx 响应算失败。
+func (channel *WebhookChannel) Send(ctx context.Context, recipient Recipient, notification Notification) error {
+	payload := webhookPayload{ID: notification.ID, Kind: notification.Kind, UserID: recipient.UserID, Username: recipient.Username,
+		Title: notification.Title, Body: notification.Body, CreatedAt: notification.CreatedAt}
+	if notification.Link != "" {
+		payload.URL = platformweb.CanonicalURL(channel.siteURL, notification.Link)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build webhook request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if channel.secret != "" {
+		request.Header.Set("X-Moovie-Signature", "sha256="+webhookSignature(body, channel.secret))
+	}
+	response, err := channel.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("post webhook: %w", err)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4<<10))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", strings.TrimSpace(response.Status))
+	}
+	return nil
+}
+
+// webhookSignature 计算请求体的 HMAC-SHA256，十六进制编码。
+func webhookSignature(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,139 @@
+package notifications
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/gin-gonic/gin"
+)
+
+// centerPageSize 是通知中心一页展示的条数，更早的交给保留期清理。
+const centerPageSize = 50
+
+// CenterStore 是通知中心页面的读写接口，由 PostgresStore 实现。
+type CenterStore interface {
+	List(ctx context.Context, userID, limit int) ([]Notification, error)
+	CountUnread(ctx context.Context, userID int) (int, error)
+	MarkRead(ctx context.Context, userID, notificationID int) (*Notification, error)
+	MarkAllRead(ctx context.Context, userID int) (int, error)
+	ListMuted(ctx context.Context, userID int) (map[string]bool, error)
+	SetMuted(ctx context.Context, userID int, kinds []string) error
+}
+
+// Handler 提供通知中心页面、已读操作、免打扰设置和导航栏的未读角标。
+type Handler struct {
+	config config.Config
+	store  CenterStore
+}
+
+// NewHandler 创建通知中心处理器。
+func NewHandler(cfg config.Config, store CenterStore) *Handler {
+	return &Handler{config: cfg, store: store}
+}
+
+// Register 注册路由。通知中心挂在用户中心下面，必须登录；
+// 未读角标在每个页面的导航栏里轮询，游客访问时返回空片段而不是跳登录。
+func (handler *Handler) Register(router *gin.Engine) {
+	require := auth.Require(handler.config.AppSecret, handler.config.Env == "production")
+	router.GET("/dashboard/notifications", require, handler.center)
+	router.POST("/dashboard/notifications/read-all", require, handler.readAll)
+	router.POST("/dashboard/notifications/preferences", require, handler.savePreferences)
+	router.POST("/dashboard/notifications/:id/read", require, handler.read)
+	router.GET("/api/htmx/notifications/unread", auth.Optional(handler.config.AppSecret), handler.unread)
+}
+
+// center 渲染通知中心：最近的通知和按类型的免打扰开关。
+func (handler *Handler) center(c *gin.Context) {
+	userID := auth.UserID(c)
+	notifications, err := handler.store.List(c.Request.Context(), userID, centerPageSize)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "通知暂时打不开")
+		return
+	}
+	muted, err := handler.store.ListMuted(c.Request.Context(), userID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "通知暂时打不开")
+		return
+	}
+	unread := 0
+	for _, notification := range notifications {
+		if notification.ReadAt == nil {
+			unread++
+		}
+	}
+	c.HTML(http.StatusOK, "notifications.html", platformweb.NewData(c, handler.config, platformweb.Metadata{Title: "通知 - " + handler.config.SiteName}, gin.H{
+		"Notifications": notifications, "UnreadCount": unread, "Kinds": Kinds, "Muted": muted, "Success": c.Query("success"),
+	}))
+}
+
+// read 把一条通知标为已读，然后跳到它指向的页面；没有链接的通知回到通知中心。
+func (handler *Handler) read(c *gin.Context) {
+	notificationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || notificationID <= 0 {
+		c.Redirect(http.StatusSeeOther, "/dashboard/notifications")
+		return
+	}
+	notification, err := handler.store.MarkRead(c.Request.Context(), auth.UserID(c), notificationID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "操作失败，请重试")
+		return
+	}
+	if notification == nil || !internalLink(notification.Link) {
+		c.Redirect(http.StatusSeeOther, "/dashboard/notifications")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, notification.Link)
+}
+
+// readAll 把所有未读通知标为已读。
+func (handler *Handler) readAll(c *gin.Context) {
+	if _, err := handler.store.MarkAllRead(c.Request.Context(), auth.UserID(c)); err != nil {
+		c.String(http.StatusInternalServerError, "操作失败，请重试")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/dashboard/notifications?success=read")
+}
+
+// savePreferences 保存免打扰设置。表单里勾选的是「接收」的类型，没勾选的就是关掉的；
+// 不认识的类型直接忽略。
+func (handler *Handler) savePreferences(c *gin.Context) {
+	enabled := make(map[string]bool)
+	for _, kind := range c.PostFormArray("enabled") {
+		enabled[kind] = true
+	}
+	muted := make([]string, 0, len(Kinds))
+	for _, option := range Kinds {
+		if !enabled[option.Kind] {
+			muted = append(muted, option.Kind)
+		}
+	}
+	if err := handler.store.SetMuted(c.Request.Context(), auth.UserID(c), muted); err != nil {
+		c.String(http.StatusInternalServerError, "保存失败，请重试")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/dashboard/notifications?success=preferences")
+}
+
+// unread 渲染导航栏的未读角标，没有未读或没登录时是空片段。
+func (handler *Handler) unread(c *gin.Context) {
+	count := 0
+	if userID := auth.UserID(c); userID > 0 {
+		var err error
+		if count, err = handler.store.CountUnread(c.Request.Context(), userID); err != nil {
+			slog.Warn("count unread notifications", "user_id", userID, "error", err)
+		}
+	}
+	c.Header("Cache-Control", "no-store")
+	c.HTML(http.StatusOK, "partials/notification_badge.html", gin.H{"Count": count})
+}
+
+// internalLink 只允许跳站内路径，防止通知链接被用成开放跳转。
+func internalLink(link string) bool {
+	return strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "//") && !strings.HasPrefix(link, "/\\")
+}
@@ -0,0 +1,138 @@
+package notifications
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCenterMarksReadRedirectsSafelyAndSavesMutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	readAt := time.Now()
+	store := &centerStoreStub{notifications: []Notification{
+		{ID: 1, UserID: 7, Kind: KindCommentReply, Title: "乙 回复了你对《沙丘》的短评", Body: "同感", Link: "/movie/123"},
+		{ID: 2, UserID: 7, Kind: KindFeedbackReply, Title: "你的反馈有了回复", Link: "//evil.example", ReadAt: &readAt},
+	}, muted: map[string]bool{KindCommentLike: true}}
+	renderer, err := platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), []string{"notifications"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.HTMLRender = renderer
+	NewHandler(config.Config{SiteName: "Moovie影牛", AppSecret: "secret"}, store).Register(router)
+	now := time.Now()
+	token, _ := auth.Sign(auth.Claims{UserID: 7, Email: "u7@test.local", Role: "user", Issued: now.Unix(), Expiry: now.Add(time.Hour).Unix()}, "secret")
+	serve := func(method, path string, values url.Values, signedIn bool) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(values.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if signedIn {
+			request.AddCookie(&http.Cookie{Name: "token", Value: token})
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	page := serve(http.MethodGet, "/dashboard/notifications", nil, true)
+	body := page.Body.String()
+	if page.Code != http.StatusOK || !strings.Contains(body, "乙 回复了你对《沙丘》的短评") || !strings.Contains(body, `action="/dashboard/notifications/1/read"`) ||
+		!strings.Contains(body, `value="comment_reply" checked`) || strings.Contains(body, `value="comment_like" checked`) {
+		t.Fatalf("center = %d %s", page.Code, body)
+	}
+	if response := serve(http.MethodGet, "/dashboard/notifications", nil, false); response.Code == http.StatusOK {
+		t.Fatal("guest opened the notification center")
+	}
+
+	badge := serve(http.MethodGet, "/api/htmx/notifications/unread", nil, true)
+	if badge.Header().Get("Cache-Control") != "no-store" || !strings.Contains(badge.Body.String(), ">1<") || !strings.Contains(badge.Body.String(), `id="mobile-notification-badge"`) {
+		t.Fatalf("badge = %s", badge.Body.String())
+	}
+	if guest := serve(http.MethodGet, "/api/htmx/notifications/unread", nil, false); guest.Code != http.StatusOK || strings.Contains(guest.Body.String(), ">0<") {
+		t.Fatalf("guest badge = %d %s", guest.Code, guest.Body.String())
+	}
+
+	if response := serve(http.MethodPost, "/dashboard/notifications/1/read", nil, true); response.Code != http.StatusSeeOther || response.Header().Get("Location") != "/movie/123" {
+		t.Fatalf("read = %d %q", response.Code, response.Header().Get("Location"))
+	}
+	// 协议相对地址不跳出站外，回通知中心。
+	if response := serve(http.MethodPost, "/dashboard/notifications/2/read", nil, true); response.Header().Get("Location") != "/dashboard/notifications" {
+		t.Fatalf("unsafe link redirect = %q", response.Header().Get("Location"))
+	}
+
+	// 只勾了回复和反馈，其余类型（包括不认识的 bogus）按关掉处理，bogus 本身被忽略。
+	saved := serve(http.MethodPost, "/dashboard/notifications/preferences", url.Values{"enabled": {KindCommentReply, KindFeedbackReply, "bogus"}}, true)
+	if saved.Code != http.StatusSeeOther || strings.Join(store.saved, ",") != "comment_like,wish_available,douban_sync,monthly_report" {
+		t.Fatalf("preferences = %d %v", saved.Code, store.saved)
+	}
+	if response := serve(http.MethodPost, "/dashboard/notifications/read-all", nil, true); response.Code != http.StatusSeeOther || store.unread() != 0 {
+		t.Fatalf("read all = %d, unread %d", response.Code, store.unread())
+	}
+}
+
+// centerStoreStub 在内存里模拟一位用户的收件箱。
+type centerStoreStub struct {
+	notifications []Notification
+	muted         map[string]bool
+	saved         []string
+}
+
+func (stub *centerStoreStub) List(context.Context, int, int) ([]Notification, error) {
+	return stub.notifications, nil
+}
+
+func (stub *centerStoreStub) CountUnread(context.Context, int) (int, error) {
+	return stub.unread(), nil
+}
+
+func (stub *centerStoreStub) MarkRead(_ context.Context, userID, notificationID int) (*Notification, error) {
+	for index := range stub.notifications {
+		if notification := &stub.notifications[index]; notification.ID == notificationID && notification.UserID == userID {
+			if notification.ReadAt == nil {
+				now := time.Now()
+				notification.ReadAt = &now
+			}
+			return notification, nil
+		}
+	}
+	return nil, nil
+}
+
+func (stub *centerStoreStub) MarkAllRead(ctx context.Context, userID int) (int, error) {
+	affected := 0
+	for _, notification := range stub.notifications {
+		if notification.ReadAt == nil {
+			_, _ = stub.MarkRead(ctx, userID, notification.ID)
+			affected++
+		}
+	}
+	return affected, nil
+}
+
+func (stub *centerStoreStub) ListMuted(context.Context, int) (map[string]bool, error) {
+	return stub.muted, nil
+}
+
+func (stub *centerStoreStub) SetMuted(_ context.Context, _ int, kinds []string) error {
+	stub.saved = kinds
+	return nil
+}
+
+func (stub *centerStoreStub) unread() int {
+	count := 0
+	for _, notification := range stub.notifications {
+		if notification.ReadAt == nil {
+			count++
+		}
+	}
+	return count
+}
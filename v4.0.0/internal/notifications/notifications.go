@@ -0,0 +1,195 @@
+// Package notifications 是站内通知：每位用户一个持久化的收件箱，外加可选的邮件和 Webhook 投递。
+//
+// 业务代码只管调用 Service.Notify 或 NotifyUser；通知先写进 notifications 表，写入成功（不是重复的）
+// 才依次交给配置好的渠道。渠道失败只记日志，不影响收件箱，也不会让调用方重试。
+// 用户在通知中心关掉的类型直接跳过，收件箱和渠道都不发。
+//
+// 通知的文案由产生它的业务包自己写（social、feedback、douban、report），
+// 这里只定义类型常量，那些包各自声明一个只有 NotifyUser 的小接口，不反过来依赖它们。
+package notifications
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// 通知类型。收件箱按类型去重，免打扰也按类型设置。
+const (
+	// KindWishAvailable 是「想看的片可以看了」。
+	KindWishAvailable = "wish_available"
+	// KindCommentReply 是自己的短评收到了回复。
+	KindCommentReply = "comment_reply"
+	// KindCommentLike 是自己的短评被点赞，同一个人反复点只提醒一次。
+	KindCommentLike = "comment_like"
+	// KindFeedbackReply 是管理员回复了自己提交的反馈。
+	KindFeedbackReply = "feedback_reply"
+	// KindDoubanSync 是豆瓣同步任务跑完了。
+	KindDoubanSync = "douban_sync"
+	// KindMonthlyReport 是月度观影小记生成好了。
+	KindMonthlyReport = "monthly_report"
+)
+
+// KindOption 是通知中心设置里的一个类型开关。
+type KindOption struct {
+	Kind  string
+	Label string
+}
+
+// Kinds 按通知中心里的展示顺序列出所有类型，新增类型要同时加到这里，否则用户没法关掉它。
+var Kinds = []KindOption{
+	{Kind: KindCommentReply, Label: "短评收到回复"},
+	{Kind: KindCommentLike, Label: "短评被点赞"},
+	{Kind: KindFeedbackReply, Label: "反馈有了回复"},
+	{Kind: KindWishAvailable, Label: "想看的片可以看了"},
+	{Kind: KindDoubanSync, Label: "豆瓣同步完成"},
+	{Kind: KindMonthlyReport, Label: "月度小记生成"},
+}
+
+// KnownKind 判断是不是已知的通知类型，设置表单只接受这些值。
+func KnownKind(kind string) bool {
+	for _, option := range Kinds {
+		if option.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification 是收件箱里的一条通知。Link 是站内路径，渠道投递时再拼成绝对地址。
+// DedupeKey 非空时同一用户、同一类型只保留第一条。
+type Notification struct {
+	ID        int
+	UserID    int
+	Kind      string
+	Title     string
+	Body      string
+	Link      string
+	DedupeKey string
+	ReadAt    *time.Time
+	CreatedAt time.Time
+}
+
+// Recipient 是通知的接收人。Email 为空时邮件渠道跳过这个人。
+type Recipient struct {
+	UserID   int
+	Username string
+	Email    string
+}
+
+// Inbox 是收件箱的写入接口，由 PostgresStore 实现。
+// Create 返回 false 表示按 DedupeKey 判定为重复，什么都没写。
+type Inbox interface {
+	Create(ctx context.Context, notification Notification) (Notification, bool, error)
+}
+
+// Preferences 读用户的免打扰设置，由 PostgresStore 实现。
+type Preferences interface {
+	Muted(ctx context.Context, userID int, kind string) (bool, error)
+}
+
+// Directory 按用户 ID 查接收人的用户名和邮箱，NotifyUser 用它补全 Recipient。由 PostgresStore 实现。
+type Directory interface {
+	FindRecipient(ctx context.Context, userID int) (Recipient, error)
+}
+
+// Channel 是站外投递渠道，比如邮件和 Webhook。
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, recipient Recipient, notification Notification) error
+}
+
+// Service 把通知写进收件箱，再分发到各个渠道。
+type Service struct {
+	inbox       Inbox
+	channels    []Channel
+	preferences Preferences
+	directory   Directory
+	background  bool
+}
+
+// ServiceOption 配置通知服务的可选渠道和依赖。
+type ServiceOption func(*Service)
+
+// WithChannels 追加站外投递渠道，nil 会被忽略。
+func WithChannels(channels ...Channel) ServiceOption {
+	return func(service *Service) {
+		for _, channel := range channels {
+			if channel != nil {
+				service.channels = append(service.channels, channel)
+			}
+		}
+	}
+}
+
+// WithPreferences 启用按类型免打扰。不注入时所有类型都发。
+func WithPreferences(preferences Preferences) ServiceOption {
+	return func(service *Service) { service.preferences = preferences }
+}
+
+// WithDirectory 注入接收人查询。没注入时 NotifyUser 只知道用户 ID，邮件渠道会跳过。
+func WithDirectory(directory Directory) ServiceOption {
+	return func(service *Service) { service.directory = directory }
+}
+
+// WithBackgroundDelivery 让站外渠道在后台投递，Notify 写完收件箱就返回。
+// Web 进程里的通知跟着点赞、回复这类请求产生，不能让一次 SMTP 超时拖住请求；
+// Worker 里本来就在后台，不需要。
+func WithBackgroundDelivery() ServiceOption {
+	return func(service *Service) { service.background = true }
+}
+
+// NewService 创建通知服务。
+func NewService(inbox Inbox, options ...ServiceOption) *Service {
+	service := &Service{inbox: inbox}
+	for _, option := range options {
+		option(service)
+	}
+	return service
+}
+
+// Notify 给一位用户发通知。只有收件箱或免打扰设置读写失败才返回错误；
+// 重复通知和被关掉的类型静默跳过，也不会再投递一次。
+func (service *Service) Notify(ctx context.Context, recipient Recipient, notification Notification) error {
+	notification.UserID = recipient.UserID
+	if service.preferences != nil {
+		muted, err := service.preferences.Muted(ctx, recipient.UserID, notification.Kind)
+		if err != nil || muted {
+			return err
+		}
+	}
+	created, fresh, err := service.inbox.Create(ctx, notification)
+	if err != nil || !fresh || len(service.channels) == 0 {
+		return err
+	}
+	if service.background {
+		detached := context.WithoutCancel(ctx)
+		go service.deliver(detached, recipient, created)
+		return nil
+	}
+	service.deliver(ctx, recipient, created)
+	return nil
+}
+
+// NotifyUser 按用户 ID 发通知，接收人的用户名和邮箱从 Directory 查。业务包只知道用户 ID，走这个入口。
+func (service *Service) NotifyUser(ctx context.Context, userID int, notification Notification) error {
+	recipient := Recipient{UserID: userID}
+	if service.directory != nil {
+		found, err := service.directory.FindRecipient(ctx, userID)
+		if err != nil {
+			return err
+		}
+		recipient = found
+	}
+	return service.Notify(ctx, recipient, notification)
+}
+
+// deliver 把一条新通知依次交给各个渠道，失败只记日志。
+func (service *Service) deliver(ctx context.Context, recipient Recipient, created Notification) {
+	for _, channel := range service.channels {
+		if err := channel.Send(ctx, recipient, created); err != nil {
+			slog.Warn("deliver notification", "channel", channel.Name(), "user_id", recipient.UserID,
+				"kind", created.Kind, "error", err)
+		}
+	}
+}
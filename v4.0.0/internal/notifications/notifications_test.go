@@ -0,0 +1,417 @@
+package notifications
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications/smtpstub"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
+	"github.com/TwoThreeWang/Moovie/new/internal/search"
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+func TestServiceDeliversEachNotificationOnceThroughAllChannels(t *testing.T) {
+	mail := smtpstub.Start(t)
+	var hooks []webhookPayload
+	var signatures []string
+	var mu sync.Mutex
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload webhookPayload
+		_ = json.Unmarshal(body, &payload)
+		mu.Lock()
+		hooks = append(hooks, payload)
+		signatures = append(signatures, strings.TrimPrefix(r.Header.Get("X-Moovie-Signature"), "sha256=")+"|"+webhookSignature(body, "hook-secret"))
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	cfg := config.Config{SiteName: "Moovie影牛", SiteURL: "https://example.com", Notify: config.NotifyConfig{
+		SMTPHost: mail.Host(), SMTPPort: mail.Port(), SMTPUsername: "mailer", SMTPPassword: "pw", SMTPFrom: "noreply@example.com",
+		WebhookURL: webhook.URL, WebhookSecret: "hook-secret",
+	}}
+	inbox := &inboxStub{}
+	service := NewService(inbox, WithChannels(ConfiguredChannels(cfg, webhook.Client())...))
+	recipient := Recipient{UserID: 7, Username: "甲", Email: "a@example.com"}
+	notification := Notification{Kind: KindWishAvailable, Title: "想看的《沙丘》可以看了", Body: "《沙丘》有片源了。", Link: "/movie/123", DedupeKey: "9"}
+	for range 2 {
+		if err := service.Notify(context.Background(), recipient, notification); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没有邮箱的人只进收件箱和 Webhook。
+	if err := service.Notify(context.Background(), Recipient{UserID: 8, Username: "乙"}, notification); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inbox.created) != 2 {
+		t.Fatalf("inbox = %+v", inbox.created)
+	}
+	messages := mail.Messages()
+	if len(messages) != 1 || messages[0].From != "noreply@example.com" || messages[0].To[0] != "a@example.com" || messages[0].Username != "mailer" {
+		t.Fatalf("mail = %+v", messages)
+	}
+	header, encoded, _ := strings.Cut(messages[0].Data, "\r\n\r\n")
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(encoded, "\r\n", ""))
+	if err != nil || !strings.Contains(header, "Subject: =?UTF-8?b?") || !strings.Contains(string(body), "https://example.com/movie/123") {
+		t.Fatalf("mail data = %s / %s / %v", header, body, err)
+	}
+	if len(hooks) != 2 || hooks[0].UserID != 7 || hooks[1].Username != "乙" || hooks[0].URL != "https://example.com/movie/123" {
+		t.Fatalf("webhooks = %+v", hooks)
+	}
+	for _, signature := range signatures {
+		if got, want, _ := strings.Cut(signature, "|"); got != want {
+			t.Fatalf("signature = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestServiceKeepsInboxWhenChannelFails(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer webhook.Close()
+	channel := NewWebhookChannel(webhook.Client(), webhook.URL, "", "https://example.com")
+	if err := channel.Send(context.Background(), Recipient{UserID: 1}, Notification{Title: "x"}); err == nil {
+		t.Fatal("non-2xx webhook response should fail")
+	}
+	inbox := &inboxStub{}
+	if err := NewService(inbox, WithChannels(channel)).Notify(context.Background(), Recipient{UserID: 1}, Notification{Title: "x"}); err != nil {
+		t.Fatalf("channel failure leaked: %v", err)
+	}
+	if len(inbox.created) != 1 {
+		t.Fatalf("inbox = %+v", inbox.created)
+	}
+	inbox.err = errors.New("db down")
+	if err := NewService(inbox).Notify(context.Background(), Recipient{UserID: 1}, Notification{Title: "y"}); err == nil {
+		t.Fatal("inbox failure should be returned")
+	}
+}
+
+func TestAvailabilityNotifierAlertsWishersOnlyWhenTitleBecomesPlayable(t *testing.T) {
+	store := &availabilityStoreStub{states: map[int]string{}, changed: map[int]time.Time{}, media: WishedMedia{ID: 9, DoubanID: "123", Title: "沙丘", Year: "2021"},
+		wishers: []Recipient{{UserID: 1}, {UserID: 2}}}
+	playback := playbackStub{}
+	notifier := &notifierStub{}
+	availability := NewAvailabilityNotifier(store, playback, notifier)
+	check := func(state search.PlaybackState) {
+		t.Helper()
+		playback[9] = state
+		if err := availability.Handle(context.Background(), workqueue.Job{Payload: json.RawMessage(`{"media_id":9}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check(search.PlaybackNone)
+	if len(notifier.sent) != 0 || store.states[9] != "none" {
+		t.Fatalf("none -> none sent %+v / state %q", notifier.sent, store.states[9])
+	}
+	check(search.PlaybackDirect)
+	if len(notifier.sent) != 2 || notifier.sent[0].Link != "/movie/123" || notifier.sent[1].DedupeKey != "9" ||
+		notifier.sent[0].Title != "想看的《沙丘》（2021）可以看了" || store.states[9] != "direct" {
+		t.Fatalf("none -> direct sent %+v / state %q", notifier.sent, store.states[9])
+	}
+	// 已经能播的作品再整理出分集，不重复提醒。
+	check(search.PlaybackReady)
+	if len(notifier.sent) != 2 || store.states[9] != "ready" {
+		t.Fatalf("direct -> ready sent %+v", notifier.sent)
+	}
+
+	// 一个人发失败时其他人照发，状态不保存，任务重试时再来一次。
+	store.states[9] = "none"
+	notifier.fail = map[int]bool{1: true}
+	playback[9] = search.PlaybackReady
+	if err := availability.Check(context.Background(), 9); err == nil || store.states[9] != "none" {
+		t.Fatalf("partial failure err = %v / state %q", err, store.states[9])
+	}
+	if last := notifier.sent[len(notifier.sent)-1]; last.UserID != 2 || !strings.Contains(last.Body, "可以直接播放") {
+		t.Fatalf("ready notification = %+v", last)
+	}
+	if err := availability.Handle(context.Background(), workqueue.Job{Payload: json.RawMessage(`{}`)}); !workqueue.IsTerminal(err) {
+		t.Fatalf("invalid payload error = %v", err)
+	}
+
+	// 资源全部下架后被对账重置成 none，再上线是新的一次，想看的人会再收到提醒。
+	sent := len(notifier.sent)
+	notifier.fail = nil
+	store.changed[9] = time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	check(search.PlaybackDirect)
+	if len(notifier.sent) != sent+2 || notifier.sent[sent].DedupeKey != "9:1788220800" {
+		t.Fatalf("relaunch sent %+v", notifier.sent[sent:])
+	}
+}
+
+func TestPostgresStoreDeduplicatesAndListsWishers(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 1, 2, 3)
+	testdb.Media(t, pool, 9)
+	if _, err := pool.Exec(t.Context(), `INSERT INTO user_movies (user_id, media_id, movie_id, status, rating)
+VALUES (1, 9, 'm9', 'wish', 0), (2, 9, 'm9', 'wish', 0), (3, 9, 'm9', 'watched', 5)`); err != nil {
+		t.Fatal(err)
+	}
+	store := NewPostgresStore(pool)
+	media, wishers, err := store.ListWishers(t.Context(), 9)
+	if err != nil || media.ID != 9 || len(wishers) != 2 || wishers[0].UserID != 1 || wishers[1].Email != "u2@test.local" {
+		t.Fatalf("wishers = %+v / %+v / %v", media, wishers, err)
+	}
+
+	state, since, err := store.PlaybackState(t.Context(), 9)
+	if err != nil || state != "none" || !since.IsZero() {
+		t.Fatalf("initial state = %q / %s / %v", state, since, err)
+	}
+	if err := store.SavePlaybackState(t.Context(), 9, "direct"); err != nil {
+		t.Fatal(err)
+	}
+	if state, since, err := store.PlaybackState(t.Context(), 9); err != nil || state != "direct" || since.IsZero() {
+		t.Fatalf("saved state = %q / %s / %v", state, since, err)
+	}
+	// 9 号没有任何资源，对账时重置回 none；有可用资源的 10 号不动。
+	testdb.Media(t, pool, 10)
+	if _, err := pool.Exec(t.Context(), `INSERT INTO vod_items (source_key, vod_id, vod_name, vod_play_url) VALUES ('site', '1', '十', 'x$https://a.example/1.m3u8');
+INSERT INTO resource_media_links (source_key, vod_id, media_id, confidence, matched_by) VALUES ('site', '1', 10, 1, 'douban_id');
+INSERT INTO media_playback_states (media_id, state) VALUES (10, 'direct')`); err != nil {
+		t.Fatal(err)
+	}
+	if reset, err := store.ResetLapsedPlaybackStates(t.Context()); err != nil || reset != 1 {
+		t.Fatalf("reset = %d / %v", reset, err)
+	}
+	if state, _, _ := store.PlaybackState(t.Context(), 9); state != "none" {
+		t.Fatalf("lapsed state = %q", state)
+	}
+	if state, _, _ := store.PlaybackState(t.Context(), 10); state != "direct" {
+		t.Fatalf("playable state = %q", state)
+	}
+
+	notification := Notification{UserID: 1, Kind: KindWishAvailable, Title: "可以看了", Link: "/movie/m9", DedupeKey: "9"}
+	created, fresh, err := store.Create(t.Context(), notification)
+	if err != nil || !fresh || created.ID == 0 || created.CreatedAt.IsZero() {
+		t.Fatalf("create = %+v / %v / %v", created, fresh, err)
+	}
+	if _, fresh, err := store.Create(t.Context(), notification); err != nil || fresh {
+		t.Fatalf("duplicate create = %v / %v", fresh, err)
+	}
+	notification.DedupeKey = ""
+	for range 2 {
+		if _, fresh, err := store.Create(t.Context(), notification); err != nil || !fresh {
+			t.Fatalf("create without dedupe key = %v / %v", fresh, err)
+		}
+	}
+	listed, err := store.List(t.Context(), 1, 10)
+	if err != nil || len(listed) != 3 || listed[0].ReadAt != nil || listed[2].DedupeKey != "9" {
+		t.Fatalf("list = %+v / %v", listed, err)
+	}
+}
+
+// inboxStub 在内存里按 (用户, 类型, 去重键) 去重。
+type inboxStub struct {
+	created []Notification
+	err     error
+}
+
+func (stub *inboxStub) Create(_ context.Context, notification Notification) (Notification, bool, error) {
+	if stub.err != nil {
+		return notification, false, stub.err
+	}
+	for _, existing := range stub.created {
+		if notification.DedupeKey != "" && existing.UserID == notification.UserID && existing.Kind == notification.Kind &&
+			existing.DedupeKey == notification.DedupeKey {
+			return notification, false, nil
+		}
+	}
+	notification.ID, notification.CreatedAt = len(stub.created)+1, time.Now()
+	stub.created = append(stub.created, notification)
+	return notification, true, nil
+}
+
+type availabilityStoreStub struct {
+	states  map[int]string
+	changed map[int]time.Time
+	media   WishedMedia
+	wishers []Recipient
+}
+
+func (stub *availabilityStoreStub) PlaybackState(_ context.Context, mediaID int) (string, time.Time, error) {
+	if state, ok := stub.states[mediaID]; ok {
+		return state, stub.changed[mediaID], nil
+	}
+	return "none", time.Time{}, nil
+}
+
+func (stub *availabilityStoreStub) SavePlaybackState(_ context.Context, mediaID int, state string) error {
+	stub.states[mediaID] = state
+	return nil
+}
+
+func (stub *availabilityStoreStub) ListWishers(context.Context, int) (WishedMedia, []Recipient, error) {
+	return stub.media, stub.wishers, nil
+}
+
+// playbackStub 只给出每部作品的播放状态。
+type playbackStub map[int]search.PlaybackState
+
+func (stub playbackStub) ListPlaybackSummaries(_ context.Context, mediaIDs []int) (map[int]search.PlaybackSummary, error) {
+	summaries := make(map[int]search.PlaybackSummary, len(mediaIDs))
+	for _, mediaID := range mediaIDs {
+		summaries[mediaID] = search.PlaybackSummary{MediaID: mediaID, State: stub[mediaID]}
+	}
+	return summaries, nil
+}
+
+type notifierStub struct {
+	sent []Notification
+	fail map[int]bool
+}
+
+func (stub *notifierStub) Notify(_ context.Context, recipient Recipient, notification Notification) error {
+	if stub.fail[recipient.UserID] {
+		return errors.New("inbox unavailable")
+	}
+	notification.UserID = recipient.UserID
+	stub.sent = append(stub.sent, notification)
+	return nil
+}
+
+func TestServiceSkipsMutedKindsAndResolvesRecipientsByID(t *testing.T) {
+	inbox := &inboxStub{}
+	channel := &channelStub{delivered: make(chan Recipient, 4)}
+	preferences := preferencesStub{1: {KindCommentLike: true}}
+	directory := directoryStub{1: {UserID: 1, Username: "甲", Email: "a@example.com"}}
+	service := NewService(inbox, WithPreferences(preferences), WithDirectory(directory), WithBackgroundDelivery(), WithChannels(channel))
+
+	// 关掉的类型既不进收件箱也不外发，别的类型照常。
+	if err := service.NotifyUser(context.Background(), 1, Notification{Kind: KindCommentLike, Title: "赞"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.NotifyUser(context.Background(), 1, Notification{Kind: KindCommentReply, Title: "回复"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox.created) != 1 || inbox.created[0].Kind != KindCommentReply || inbox.created[0].UserID != 1 {
+		t.Fatalf("inbox = %+v", inbox.created)
+	}
+	// 外发在后台跑，接收人的邮箱是从 Directory 查出来的。
+	select {
+	case recipient := <-channel.delivered:
+		if recipient.Email != "a@example.com" {
+			t.Fatalf("recipient = %+v", recipient)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("background delivery did not run")
+	}
+	if err := service.NotifyUser(context.Background(), 2, Notification{Kind: KindCommentReply}); err == nil {
+		t.Fatal("unknown recipient should fail")
+	}
+}
+
+func TestInternalLinkRejectsOpenRedirects(t *testing.T) {
+	for link, want := range map[string]bool{
+		"/movie/123": true, "/dashboard": true, "": false, "https://evil.example": false, "//evil.example": false, `/\evil.example`: false,
+	} {
+		if got := internalLink(link); got != want {
+			t.Errorf("internalLink(%q) = %v, want %v", link, got, want)
+		}
+	}
+}
+
+func TestPostgresStoreReadStateMutesAndRetention(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 1, 2)
+	store := NewPostgresStore(pool)
+	var ids []int
+	for index, kind := range []string{KindCommentLike, KindCommentReply, KindFeedbackReply} {
+		created, _, err := store.Create(t.Context(), Notification{UserID: 1, Kind: kind, Title: kind, Link: "/movie/" + string(rune('a'+index))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, created.ID)
+	}
+	if _, _, err := store.Create(t.Context(), Notification{UserID: 2, Kind: KindCommentLike, Title: "别人的"}); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := store.CountUnread(t.Context(), 1); err != nil || count != 3 {
+		t.Fatalf("unread = %d / %v", count, err)
+	}
+	read, err := store.MarkRead(t.Context(), 1, ids[0])
+	if err != nil || read == nil || read.ReadAt == nil || read.Link != "/movie/a" {
+		t.Fatalf("mark read = %+v / %v", read, err)
+	}
+	// 别人的通知改不动。
+	if other, err := store.MarkRead(t.Context(), 2, ids[1]); err != nil || other != nil {
+		t.Fatalf("foreign mark read = %+v / %v", other, err)
+	}
+	if affected, err := store.MarkAllRead(t.Context(), 1); err != nil || affected != 2 {
+		t.Fatalf("mark all read = %d / %v", affected, err)
+	}
+	if count, _ := store.CountUnread(t.Context(), 2); count != 1 {
+		t.Fatalf("other user's unread = %d", count)
+	}
+
+	if err := store.SetMuted(t.Context(), 1, []string{KindCommentLike, KindDoubanSync}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetMuted(t.Context(), 1, []string{KindDoubanSync, KindMonthlyReport}); err != nil {
+		t.Fatal(err)
+	}
+	muted, err := store.ListMuted(t.Context(), 1)
+	if err != nil || len(muted) != 2 || !muted[KindDoubanSync] || !muted[KindMonthlyReport] {
+		t.Fatalf("muted = %v / %v", muted, err)
+	}
+	if isMuted, err := store.Muted(t.Context(), 1, KindCommentLike); err != nil || isMuted {
+		t.Fatalf("comment_like muted = %v / %v", isMuted, err)
+	}
+	recipient, err := store.FindRecipient(t.Context(), 2)
+	if err != nil || recipient.Email != "u2@test.local" {
+		t.Fatalf("recipient = %+v / %v", recipient, err)
+	}
+
+	// 已读的过 10 天就删，未读的要过 100 天；用户 2 的那条还没读，留着。
+	if _, err := pool.Exec(t.Context(), `UPDATE notifications SET created_at = NOW() - INTERVAL '30 days'`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	deleted, err := store.DeleteExpired(t.Context(), now.AddDate(0, 0, -10), now.AddDate(0, 0, -100), 2)
+	if err != nil || deleted != 2 {
+		t.Fatalf("deleted = %d / %v", deleted, err)
+	}
+	if deleted, err := store.DeleteExpired(t.Context(), now.AddDate(0, 0, -10), now.AddDate(0, 0, -100), 10); err != nil || deleted != 1 {
+		t.Fatalf("second pass deleted = %d / %v", deleted, err)
+	}
+	if count, _ := store.CountUnread(t.Context(), 2); count != 1 {
+		t.Fatalf("unread notification was deleted early, remaining %d", count)
+	}
+}
+
+type preferencesStub map[int]map[string]bool
+
+func (stub preferencesStub) Muted(_ context.Context, userID int, kind string) (bool, error) {
+	return stub[userID][kind], nil
+}
+
+type directoryStub map[int]Recipient
+
+func (stub directoryStub) FindRecipient(_ context.Context, userID int) (Recipient, error) {
+	recipient, ok := stub[userID]
+	if !ok {
+		return Recipient{}, errors.New("user not found")
+	}
+	return recipient, nil
+}
+
+// channelStub 把收到的接收人放进 channel，方便等后台投递跑完。
+type channelStub struct{ delivered chan Recipient }
+
+func (stub *channelStub) Name() string { return "stub" }
+
+func (stub *channelStub) Send(_ context.Context, recipient Recipient, _ Notification) error {
+	stub.delivered <- recipient
+	return nil
+}
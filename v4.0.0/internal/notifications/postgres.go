@@ -0,0 +1,253 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// PostgresStore 读写 notifications 收件箱、notification_mutes 免打扰设置和 media_playback_states。
+type PostgresStore struct{ database database.Executor }
+
+// NewPostgresStore 创建通知存储。
+func NewPostgresStore(executor database.Executor) *PostgresStore {
+	return &PostgresStore{database: executor}
+}
+
+// Create 写入一条通知。DedupeKey 撞上已有通知时返回 false，不报错。
+func (store *PostgresStore) Create(ctx context.Context, notification Notification) (Notification, bool, error) {
+	err := store.database.QueryRow(ctx, `INSERT INTO notifications (user_id, kind, title, body, link, dedupe_key)
+VALUES ($1,$2,$3,$4,$5,$6)
+ON CONFLICT (user_id, kind, dedupe_key) WHERE dedupe_key <> '' DO NOTHING
+RETURNING id, created_at`, notification.UserID, notification.Kind, notification.Title, notification.Body,
+		notification.Link, notification.DedupeKey).Scan(&notification.ID, &notification.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notification, false, nil
+	}
+	if err != nil {
+		return notification, false, fmt.Errorf("create notification: %w", err)
+	}
+	return notification, true, nil
+}
+
+// List 按时间倒序列出一位用户最近的通知。
+func (store *PostgresStore) List(ctx context.Context, userID, limit int) ([]Notification, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	rows, err := store.database.Query(ctx, `SELECT id, user_id, kind, title, body, link, dedupe_key, read_at, created_at
+FROM notifications WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list notifications: %w", err)
+	}
+	defer rows.Close()
+	notifications := make([]Notification, 0)
+	for rows.Next() {
+		var notification Notification
+		if err := rows.Scan(&notification.ID, &notification.UserID, &notification.Kind, &notification.Title, &notification.Body,
+			&notification.Link, &notification.DedupeKey, &notification.ReadAt, &notification.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan notification: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// PlaybackState 读作品上一次记录的播放状态和进入这个状态的时间，没记录过按 none 算、时间为零值。
+func (store *PostgresStore) PlaybackState(ctx context.Context, mediaID int) (string, time.Time, error) {
+	state := "none"
+	var changedAt time.Time
+	err := store.database.QueryRow(ctx, `SELECT state, changed_at FROM media_playback_states WHERE media_id = $1`, mediaID).Scan(&state, &changedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", time.Time{}, fmt.Errorf("read media playback state: %w", err)
+	}
+	return state, changedAt, nil
+}
+
+// ResetLapsedPlaybackStates 把记成可播、但已经一条可用资源都没有的作品（资源被下架、删除或解除关联）
+// 重置成 none，这样它再次上线时 mediaidentity 会重新投检查任务，想看的人也会再收到提醒。
+// 「可用资源」的口径见 mediaidentity.PlayableResourceFilter。返回重置的作品数。
+func (store *PostgresStore) ResetLapsedPlaybackStates(ctx context.Context) (int, error) {
+	affected, err := store.database.Exec(ctx, `UPDATE media_playback_states playback
+SET state = 'none', changed_at = NOW()
+WHERE playback.state <> 'none'
+  AND NOT EXISTS (
+      SELECT 1 FROM resource_media_links link
+      JOIN vod_items resource ON resource.source_key = link.source_key AND resource.vod_id = link.vod_id
+      WHERE link.media_id = playback.media_id`+mediaidentity.PlayableResourceFilter+`
+  )`)
+	if err != nil {
+		return 0, fmt.Errorf("reset lapsed playback states: %w", err)
+	}
+	return int(affected), nil
+}
+
+// SavePlaybackState 记下作品当前的播放状态，状态没变时不更新 changed_at。
+func (store *PostgresStore) SavePlaybackState(ctx context.Context, mediaID int, state string) error {
+	_, err := store.database.Exec(ctx, `INSERT INTO media_playback_states (media_id, state) VALUES ($1, $2)
+ON CONFLICT (media_id) DO UPDATE SET state = EXCLUDED.state, changed_at = NOW()
+WHERE media_playback_states.state <> EXCLUDED.state`, mediaID, state)
+	if err != nil {
+		return fmt.Errorf("save media playback state: %w", err)
+	}
+	return nil
+}
+
+// ListWishers 读作品的基本信息和所有把它标成想看的用户。作品不存在时返回 pgx.ErrNoRows。
+func (store *PostgresStore) ListWishers(ctx context.Context, mediaID int) (WishedMedia, []Recipient, error) {
+	media := WishedMedia{ID: mediaID}
+	if err := store.database.QueryRow(ctx, `SELECT douban_id, title, year FROM media WHERE id = $1`, mediaID).
+		Scan(&media.DoubanID, &media.Title, &media.Year); err != nil {
+		return media, nil, fmt.Errorf("find wished media: %w", err)
+	}
+	rows, err := store.database.Query(ctx, `SELECT DISTINCT account.id, account.username, account.email
+FROM user_movies wish
+JOIN users account ON account.id = wish.user_id
+WHERE wish.media_id = $1 AND wish.status = 'wish'
+ORDER BY account.id`, mediaID)
+	if err != nil {
+		return media, nil, fmt.Errorf("list media wishers: %w", err)
+	}
+	defer rows.Close()
+	recipients := make([]Recipient, 0)
+	for rows.Next() {
+		var recipient Recipient
+		if err := rows.Scan(&recipient.UserID, &recipient.Username, &recipient.Email); err != nil {
+			return media, nil, fmt.Errorf("scan media wisher: %w", err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	if err := rows.Err(); err != nil {
+		return media, nil, fmt.Errorf("iterate media wishers: %w", err)
+	}
+	return media, recipients, nil
+}
+
+// notificationDeleteChunk 是保留期清理每批删除的行数，单条 DELETE 不锁太多行。
+const notificationDeleteChunk = 5000
+
+// CountUnread 统计一位用户的未读通知数。
+func (store *PostgresStore) CountUnread(ctx context.Context, userID int) (int, error) {
+	var count int
+	if err := store.database.QueryRow(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkRead 把一条通知标为已读并返回它，已读过的不改时间。通知不存在或不属于这位用户时返回 nil。
+func (store *PostgresStore) MarkRead(ctx context.Context, userID, notificationID int) (*Notification, error) {
+	var notification Notification
+	err := store.database.QueryRow(ctx, `UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1 AND user_id = $2
+RETURNING id, user_id, kind, title, body, link, dedupe_key, read_at, created_at`, notificationID, userID).
+		Scan(&notification.ID, &notification.UserID, &notification.Kind, &notification.Title, &notification.Body,
+			&notification.Link, &notification.DedupeKey, &notification.ReadAt, &notification.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mark notification read: %w", err)
+	}
+	return &notification, nil
+}
+
+// MarkAllRead 把一位用户的未读通知全部标为已读，返回改了几条。
+func (store *PostgresStore) MarkAllRead(ctx context.Context, userID int) (int, error) {
+	affected, err := store.database.Exec(ctx, `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("mark all notifications read: %w", err)
+	}
+	return int(affected), nil
+}
+
+// Muted 判断用户是否关掉了某一类通知。
+func (store *PostgresStore) Muted(ctx context.Context, userID int, kind string) (bool, error) {
+	var muted bool
+	if err := store.database.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM notification_mutes WHERE user_id = $1 AND kind = $2)`, userID, kind).Scan(&muted); err != nil {
+		return false, fmt.Errorf("read notification mute: %w", err)
+	}
+	return muted, nil
+}
+
+// ListMuted 列出用户关掉的所有类型。
+func (store *PostgresStore) ListMuted(ctx context.Context, userID int) (map[string]bool, error) {
+	rows, err := store.database.Query(ctx, `SELECT kind FROM notification_mutes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list notification mutes: %w", err)
+	}
+	defer rows.Close()
+	muted := make(map[string]bool)
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return nil, fmt.Errorf("scan notification mute: %w", err)
+		}
+		muted[kind] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate notification mutes: %w", err)
+	}
+	return muted, nil
+}
+
+// SetMuted 用新的一组类型整体替换用户的免打扰设置，kinds 为空表示全部打开。
+func (store *PostgresStore) SetMuted(ctx context.Context, userID int, kinds []string) error {
+	if kinds == nil {
+		kinds = []string{}
+	}
+	_, err := store.database.Exec(ctx, `WITH removed AS (
+    DELETE FROM notification_mutes WHERE user_id = $1 AND NOT (kind = ANY($2::text[]))
+)
+INSERT INTO notification_mutes (user_id, kind)
+SELECT $1, kind FROM UNNEST($2::text[]) AS kind
+ON CONFLICT (user_id, kind) DO NOTHING`, userID, kinds)
+	if err != nil {
+		return fmt.Errorf("save notification mutes: %w", err)
+	}
+	return nil
+}
+
+// FindRecipient 读接收人的用户名和邮箱。
+func (store *PostgresStore) FindRecipient(ctx context.Context, userID int) (Recipient, error) {
+	recipient := Recipient{UserID: userID}
+	if err := store.database.QueryRow(ctx, `SELECT username, email FROM users WHERE id = $1`, userID).
+		Scan(&recipient.Username, &recipient.Email); err != nil {
+		return recipient, fmt.Errorf("find notification recipient: %w", err)
+	}
+	return recipient, nil
+}
+
+// DeleteExpired 删除过了保留期的通知：已读的早于 readBefore，未读的早于 unreadBefore。
+// 分批删，最多删 budget 行，返回实际删除数。
+func (store *PostgresStore) DeleteExpired(ctx context.Context, readBefore, unreadBefore time.Time, budget int) (int, error) {
+	if budget < 1 {
+		budget = notificationDeleteChunk
+	}
+	total := 0
+	for total < budget {
+		chunk := min(notificationDeleteChunk, budget-total)
+		affected, err := store.database.Exec(ctx, `WITH expired AS (
+    SELECT id FROM notifications
+    WHERE (read_at IS NOT NULL AND created_at < $1) OR created_at < $2
+    ORDER BY created_at LIMIT $3
+)
+DELETE FROM notifications expired_notification USING expired WHERE expired_notification.id = expired.id`, readBefore, unreadBefore, chunk)
+		if err != nil {
+			return total, fmt.Errorf("delete expired notifications: %w", err)
+		}
+		total += int(affected)
+		if int(affected) < chunk {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,153 @@
+// Package smtpstub 是测试用的本地 SMTP 服务：只监听回环地址，收到的邮件留在内存里供断言。
+//
+// 只实现 EmailChannel 用到的那部分协议（EHLO/HELO、AUTH PLAIN、MAIL、RCPT、DATA、RSET、NOOP、QUIT），
+// 不支持 STARTTLS，所以客户端会走明文；net/smtp 只在回环地址上允许明文 AUTH PLAIN，正好够用。
+package smtpstub
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Message 是收到的一封邮件。Data 是 DATA 段原文（已去掉结尾的「.」行和点转义），
+// Username 是 AUTH PLAIN 里的用户名，没认证时为空。
+type Message struct {
+	From     string
+	To       []string
+	Data     string
+	Username string
+}
+
+// Server 是一个正在监听的 SMTP 桩。
+type Server struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []Message
+	wait     sync.WaitGroup
+}
+
+// Start 在随机端口启动 SMTP 桩，测试结束时自动关闭。
+func Start(t *testing.T) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动 SMTP 桩失败: %v", err)
+	}
+	server := &Server{listener: listener}
+	server.wait.Add(1)
+	go server.serve()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		server.wait.Wait()
+	})
+	return server
+}
+
+// Host 返回监听地址，固定是 127.0.0.1。
+func (server *Server) Host() string { return "127.0.0.1" }
+
+// Port 返回监听端口。
+func (server *Server) Port() int { return server.listener.Addr().(*net.TCPAddr).Port }
+
+// Messages 返回目前收到的全部邮件。
+func (server *Server) Messages() []Message {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]Message(nil), server.messages...)
+}
+
+// serve 逐个接受连接，监听关闭后退出。
+func (server *Server) serve() {
+	defer server.wait.Done()
+	for {
+		connection, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.wait.Add(1)
+		go func() {
+			defer server.wait.Done()
+			server.session(connection)
+		}()
+	}
+}
+
+// session 处理一个 SMTP 会话。
+func (server *Server) session(connection net.Conn) {
+	defer connection.Close()
+	reader := bufio.NewReader(connection)
+	reply := func(line string) { _, _ = connection.Write([]byte(line + "\r\n")) }
+	reply("220 smtpstub ready")
+	var current Message
+	var username string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, argument, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			reply("250-smtpstub")
+			reply("250 AUTH PLAIN")
+		case "HELO", "NOOP":
+			reply("250 OK")
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(argument, " ")
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(decoded), "\x00")
+			if !strings.EqualFold(mechanism, "PLAIN") || err != nil || len(parts) != 3 {
+				reply("504 unsupported authentication")
+				continue
+			}
+			username = parts[1]
+			reply("235 authenticated")
+		case "MAIL":
+			current = Message{From: addressArgument(argument), Username: username}
+			reply("250 OK")
+		case "RCPT":
+			current.To = append(current.To, addressArgument(argument))
+			reply("250 OK")
+		case "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			current.Data = data.String()
+			server.mu.Lock()
+			server.messages = append(server.messages, current)
+			server.mu.Unlock()
+			current = Message{}
+			reply("250 OK queued as " + strconv.Itoa(len(server.Messages())))
+		case "RSET":
+			current = Message{}
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// addressArgument 从「FROM:<a@b>」「TO:<a@b>」里取出地址。
+func addressArgument(argument string) string {
+	_, address, _ := strings.Cut(argument, ":")
+	address, _, _ = strings.Cut(strings.TrimSpace(address), " ")
+	return strings.Trim(address, "<>")
+}
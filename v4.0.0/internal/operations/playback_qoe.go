@@ -0,0 +1,158 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PlaybackQoEReader 是按站点、线路、天拆分的播放体验报表查询接口。
+type PlaybackQoEReader interface {
+	PlaybackQoE(context.Context, PlaybackQoEQuery) (PlaybackQoEReport, error)
+}
+
+// PlaybackQoEQuery 是报表查询条件：最近几天，可选只看一个资源站。
+type PlaybackQoEQuery struct {
+	Days      int
+	SourceKey string
+}
+
+// PlaybackQoEReport 是 QoE 报表：窗口内每个资源站的汇总，以及站点 × 线路 × 天的明细。
+type PlaybackQoEReport struct {
+	Days      int              `json:"days"`
+	SourceKey string           `json:"source_key"`
+	Sites     []PlaybackQoERow `json:"sites"`
+	Rows      []PlaybackQoERow `json:"rows"`
+}
+
+// PlaybackQoERow 是一组播放体验指标。站点汇总行的 Day、LineID 为空。
+// 卡顿率按「出过首帧的尝试里有多少次卡顿」算，起播都没成功的尝试不计入分母；
+// 自动换源只统计播放器因失败自动切走的次数，用户手动换线不算。
+type PlaybackQoERow struct {
+	Day            string             `json:"day,omitempty"`
+	SourceKey      string             `json:"source_key"`
+	LineID         int64              `json:"line_id,omitempty"`
+	LineKey        string             `json:"line_key,omitempty"`
+	LineLabel      string             `json:"line_label,omitempty"`
+	Attempts       int64              `json:"attempts"`
+	FirstFrames    int64              `json:"first_frames"`
+	Rebuffers      int64              `json:"rebuffers"`
+	FatalErrors    int64              `json:"fatal_errors"`
+	AutoSwitches   int64              `json:"auto_switches"`
+	FirstFrameRate float64            `json:"first_frame_rate"`
+	RebufferRatio  float64            `json:"rebuffer_ratio"`
+	FailureRate    float64            `json:"failure_rate"`
+	AutoSwitchRate float64            `json:"auto_switch_rate"`
+	StartupP50Ms   int64              `json:"startup_p50_ms"`
+	StartupP90Ms   int64              `json:"startup_p90_ms"`
+	StartupP99Ms   int64              `json:"startup_p99_ms"`
+	FailureReasons []QoEFailureReason `json:"failure_reasons"`
+}
+
+// QoEFailureReason 是一种失败原因及其次数。
+type QoEFailureReason struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// PlaybackQoE 生成 QoE 报表，天数限制在 1~30（事件表只保留 30 天）。
+// 失败原因每组只保留出现最多的前 5 种，长尾原因对排查帮助不大还会撑大页面。
+func (store *MetricsStore) PlaybackQoE(ctx context.Context, query PlaybackQoEQuery) (PlaybackQoEReport, error) {
+	if query.Days < 1 || query.Days > 30 {
+		query.Days = 7
+	}
+	query.SourceKey = strings.TrimSpace(query.SourceKey)
+	if store == nil || store.database == nil {
+		return PlaybackQoEReport{Days: query.Days, SourceKey: query.SourceKey, Sites: []PlaybackQoERow{}, Rows: []PlaybackQoERow{}}, nil
+	}
+	var payload []byte
+	if err := store.database.QueryRow(ctx, playbackQoESQL, query.Days, query.SourceKey).Scan(&payload); err != nil {
+		return PlaybackQoEReport{}, fmt.Errorf("query playback qoe: %w", err)
+	}
+	report := PlaybackQoEReport{Days: query.Days, SourceKey: query.SourceKey}
+	if err := json.Unmarshal(payload, &report); err != nil {
+		return PlaybackQoEReport{}, fmt.Errorf("decode playback qoe: %w", err)
+	}
+	if report.Sites == nil {
+		report.Sites = []PlaybackQoERow{}
+	}
+	if report.Rows == nil {
+		report.Rows = []PlaybackQoERow{}
+	}
+	for _, rows := range [][]PlaybackQoERow{report.Sites, report.Rows} {
+		for index := range rows {
+			if rows[index].FailureReasons == nil {
+				rows[index].FailureReasons = []QoEFailureReason{}
+			}
+		}
+	}
+	return report, nil
+}
+
+// playbackQoESQL 一次往返取站点汇总和明细。日期按数据库会话时区切分，和后台其他按天统计一致。
+// 同一 attempt 的同类事件唯一，所以直接 COUNT(*) 就是尝试次数。
+const playbackQoESQL = `WITH event_window AS (
+    SELECT created_at::date AS day, source_key, play_line_id, event_type, elapsed_ms, failure_reason
+    FROM playback_attempt_events
+    WHERE created_at >= CURRENT_DATE - ($1::int - 1) AND ($2 = '' OR source_key = $2)
+), grouped AS (
+    SELECT GROUPING(day, play_line_id) AS site_level, day, source_key, play_line_id,
+           COUNT(*) FILTER (WHERE event_type = 'attempt_started') AS attempts,
+           COUNT(*) FILTER (WHERE event_type = 'first_frame') AS first_frames,
+           COUNT(*) FILTER (WHERE event_type = 'rebuffer') AS rebuffers,
+           COUNT(*) FILTER (WHERE event_type = 'fatal_error') AS fatal_errors,
+           COUNT(*) FILTER (WHERE event_type = 'source_switched' AND failure_reason = 'automatic') AS auto_switches,
+           PERCENTILE_CONT(0.50) WITHIN GROUP (ORDER BY elapsed_ms) FILTER (WHERE event_type = 'first_frame') AS p50,
+           PERCENTILE_CONT(0.90) WITHIN GROUP (ORDER BY elapsed_ms) FILTER (WHERE event_type = 'first_frame') AS p90,
+           PERCENTILE_CONT(0.99) WITHIN GROUP (ORDER BY elapsed_ms) FILTER (WHERE event_type = 'first_frame') AS p99
+    FROM event_window
+    GROUP BY GROUPING SETS ((source_key), (day, source_key, play_line_id))
+), reasons AS (
+    SELECT site_level, day, source_key, play_line_id,
+           JSONB_AGG(JSONB_BUILD_OBJECT('reason', reason, 'count', total) ORDER BY total DESC, reason) AS items
+    FROM (
+        SELECT counted.*, ROW_NUMBER() OVER (PARTITION BY site_level, day, source_key, play_line_id
+                                             ORDER BY total DESC, reason) AS reason_rank
+        FROM (
+            SELECT GROUPING(day, play_line_id) AS site_level, day, source_key, play_line_id,
+                   failure_reason AS reason, COUNT(*) AS total
+            FROM event_window
+            WHERE event_type = 'fatal_error' AND failure_reason <> ''
+            GROUP BY GROUPING SETS ((source_key, failure_reason), (day, source_key, play_line_id, failure_reason))
+        ) counted
+    ) ranked
+    WHERE reason_rank <= 5
+    GROUP BY site_level, day, source_key, play_line_id
+), report_rows AS (
+    SELECT grouped.site_level, grouped.day, grouped.source_key, grouped.play_line_id, JSONB_STRIP_NULLS(JSONB_BUILD_OBJECT(
+        'day', TO_CHAR(grouped.day, 'YYYY-MM-DD'),
+        'source_key', grouped.source_key,
+        'line_id', grouped.play_line_id,
+        'line_key', line.line_key,
+        'line_label', line.line_label,
+        'attempts', grouped.attempts,
+        'first_frames', grouped.first_frames,
+        'rebuffers', grouped.rebuffers,
+        'fatal_errors', grouped.fatal_errors,
+        'auto_switches', grouped.auto_switches,
+        'first_frame_rate', COALESCE(ROUND(100.0 * grouped.first_frames / NULLIF(grouped.attempts, 0), 2), 0),
+        'rebuffer_ratio', COALESCE(ROUND(100.0 * grouped.rebuffers / NULLIF(grouped.first_frames, 0), 2), 0),
+        'failure_rate', COALESCE(ROUND(100.0 * grouped.fatal_errors / NULLIF(grouped.attempts, 0), 2), 0),
+        'auto_switch_rate', COALESCE(ROUND(100.0 * grouped.auto_switches / NULLIF(grouped.attempts, 0), 2), 0),
+        'startup_p50_ms', COALESCE(grouped.p50, 0)::bigint,
+        'startup_p90_ms', COALESCE(grouped.p90, 0)::bigint,
+        'startup_p99_ms', COALESCE(grouped.p99, 0)::bigint,
+        'failure_reasons', COALESCE(reasons.items, '[]'::jsonb)
+    )) AS item
+    FROM grouped
+    LEFT JOIN resource_play_lines line ON line.id = grouped.play_line_id
+    LEFT JOIN reasons ON reasons.site_level = grouped.site_level AND reasons.source_key = grouped.source_key
+     AND reasons.day IS NOT DISTINCT FROM grouped.day AND reasons.play_line_id IS NOT DISTINCT FROM grouped.play_line_id
+)
+SELECT JSONB_BUILD_OBJECT(
+    'sites', COALESCE((SELECT JSONB_AGG(item ORDER BY (item->>'attempts')::bigint DESC, source_key)
+                       FROM report_rows WHERE site_level = 3), '[]'::jsonb),
+    'rows', COALESCE((SELECT JSONB_AGG(item ORDER BY day DESC, source_key, play_line_id)
+                      FROM report_rows WHERE site_level = 0), '[]'::jsonb)
+)`
@@ -0,0 +1,44 @@
+package operations
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPlaybackQoEDecodesSitesAndLineRows(t *testing.T) {
+	payload := []byte(`{"sites":[{"source_key":"ffzy","attempts":40,"first_frames":32,"rebuffers":4,"fatal_errors":8,"auto_switches":6,"first_frame_rate":80,"rebuffer_ratio":12.5,"failure_rate":20,"auto_switch_rate":15,"startup_p50_ms":900,"startup_p90_ms":2400,"startup_p99_ms":7000,"failure_reasons":[{"reason":"manifest timeout","count":5}]}],"rows":[{"day":"2026-08-15","source_key":"ffzy","line_id":3,"line_key":"ffm3u8","line_label":"HLS","attempts":10,"first_frames":10,"rebuffers":0,"fatal_errors":0,"auto_switches":0,"first_frame_rate":100,"rebuffer_ratio":0,"failure_rate":0,"auto_switch_rate":0,"startup_p50_ms":700,"startup_p90_ms":1200,"startup_p99_ms":1500}]}`)
+	store := NewMetricsStore(&metricsDatabase{row: metricsRow{payload: payload}})
+	report, err := store.PlaybackQoE(context.Background(), PlaybackQoEQuery{Days: 90, SourceKey: " ffzy "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Days != 7 || report.SourceKey != "ffzy" || len(report.Sites) != 1 || len(report.Rows) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if site := report.Sites[0]; site.RebufferRatio != 12.5 || site.StartupP99Ms != 7000 || site.FailureReasons[0].Count != 5 {
+		t.Fatalf("site = %+v", site)
+	}
+	if line := report.Rows[0]; line.LineID != 3 || line.Day != "2026-08-15" || line.FailureReasons == nil {
+		t.Fatalf("line = %+v", line)
+	}
+}
+
+func TestPlaybackQoEQueryGroupsBySiteLineAndDayWithoutURLs(t *testing.T) {
+	for _, required := range []string{
+		"GROUPING SETS ((source_key), (day, source_key, play_line_id))",
+		"PERCENTILE_CONT(0.90)",
+		"failure_reason = 'automatic'",
+		"event_type = 'rebuffer'",
+		"reason_rank <= 5",
+	} {
+		if !strings.Contains(playbackQoESQL, required) {
+			t.Fatalf("qoe query missing %q", required)
+		}
+	}
+	for _, forbidden := range []string{"play_url", "vod_play_url"} {
+		if strings.Contains(playbackQoESQL, forbidden) {
+			t.Fatalf("qoe query exposes %q", forbidden)
+		}
+	}
+}
@@ -29,10 +29,14 @@ const (
 	// 留更久也没人读；删过头也不会丢进度（见 history.DeleteExpiredSyncEvents）。
 	syncEventRetentionDays = 30
 	syncEventCleanupBudget = 1_000_000
-	siteAlertMinSamples    = 5
-	siteAlertCooldown      = 24 * time.Hour
-	TaskCleanup            = "operations_cleanup"
-	TaskHealthCheck        = "site_health_check"
+	// 站内通知已读的留 90 天，没读的多留到 180 天：长期不登录的人回来还能看到最近半年的动静。
+	notificationReadRetentionDays   = 90
+	notificationUnreadRetentionDays = 180
+	notificationCleanupBudget       = 1_000_000
+	siteAlertMinSamples             = 5
+	siteAlertCooldown               = 24 * time.Hour
+	TaskCleanup                     = "operations_cleanup"
+	TaskHealthCheck                 = "site_health_check"
 )
 
 // Store 是清理任务需要的接口，由 search 的站点存储实现。
@@ -51,11 +55,14 @@ type Service struct {
 	store Store
 	now   func() time.Time
 
-	mu               sync.Mutex
-	lastAlert        map[string]time.Time
-	jobCleanup       func(context.Context, time.Time, time.Time, int) (int, error)
-	telemetryCleanup func(context.Context, time.Time, int) (int, error)
-	syncEventCleanup func(context.Context, time.Time, int) (int, error)
+	mu                  sync.Mutex
+	lastAlert           map[string]time.Time
+	jobCleanup          func(context.Context, time.Time, time.Time, int) (int, error)
+	telemetryCleanup    func(context.Context, time.Time, int) (int, error)
+	syncEventCleanup    func(context.Context, time.Time, int) (int, error)
+	imageCacheCleanup   func(context.Context) (int, error)
+	notificationCleanup func(context.Context, time.Time, time.Time, int) (int, error)
+	playbackStateReset  func(context.Context) (int, error)
 }
 
 // ServiceOption 用于注入可选的清理能力。
@@ -76,6 +83,21 @@ func WithSyncEventCleanup(cleanup func(context.Context, time.Time, int) (int, er
 	return func(service *Service) { service.syncEventCleanup = cleanup }
 }
 
+// WithNotificationCleanup 注入站内通知清理，参数依次是已读通知和未读通知的截止时间。
+func WithNotificationCleanup(cleanup func(context.Context, time.Time, time.Time, int) (int, error)) ServiceOption {
+	return func(service *Service) { service.notificationCleanup = cleanup }
+}
+
+// WithPlaybackStateReset 注入可播状态的对账：资源全部失效的作品重置回「没有片源」，下次上线能再提醒想看的人。
+func WithPlaybackStateReset(reset func(context.Context) (int, error)) ServiceOption {
+	return func(service *Service) { service.playbackStateReset = reset }
+}
+
+// WithImageCacheCleanup 注入图片代理磁盘缓存的清理：按最近访问时间淘汰到容量上限以内。
+func WithImageCacheCleanup(cleanup func(context.Context) (int, error)) ServiceOption {
+	return func(service *Service) { service.imageCacheCleanup = cleanup }
+}
+
 // NewService 创建运维服务。
 func NewService(store Store, options ...ServiceOption) *Service {
 	service := &Service{
@@ -119,6 +141,23 @@ func (service *Service) HandleCleanup(ctx context.Context, _ workqueue.Job) erro
 			return service.syncEventCleanup(ctx, before, syncEventCleanupBudget)
 		}})
 	}
+	if service.notificationCleanup != nil {
+		now := service.now()
+		operations = append(operations, cleanupOperation{name: "expired notifications", run: func() (int, error) {
+			return service.notificationCleanup(ctx, now.AddDate(0, 0, -notificationReadRetentionDays), now.AddDate(0, 0, -notificationUnreadRetentionDays), notificationCleanupBudget)
+		}})
+	}
+	if service.playbackStateReset != nil {
+		// 排在资源清理之后：同一轮里刚被清掉的资源也算进去。
+		operations = append(operations, cleanupOperation{name: "lapsed playback states", run: func() (int, error) {
+			return service.playbackStateReset(ctx)
+		}})
+	}
+	if service.imageCacheCleanup != nil {
+		operations = append(operations, cleanupOperation{name: "image cache", run: func() (int, error) {
+			return service.imageCacheCleanup(ctx)
+		}})
+	}
 	var failures []error
 	for _, operation := range operations {
 		affected, err := operation.run()
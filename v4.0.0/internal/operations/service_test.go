@@ -66,13 +66,23 @@ func TestCleanupUsesRetentionWindows(t *testing.T) {
 	store := &recordingStore{}
 	var completedBefore, failedBefore time.Time
 	var cleanupLimit int
-	var telemetryBefore time.Time
+	var telemetryBefore, readNotificationsBefore, unreadNotificationsBefore time.Time
+	imageCacheTrimmed, playbackStatesReset := false, false
 	service := NewService(store, WithJobQueueCleanup(func(_ context.Context, completed, failed time.Time, limit int) (int, error) {
 		completedBefore, failedBefore, cleanupLimit = completed, failed, limit
 		return 0, nil
 	}), WithTelemetryCleanup(func(_ context.Context, before time.Time, _ int) (int, error) {
 		telemetryBefore = before
 		return 0, nil
+	}), WithNotificationCleanup(func(_ context.Context, read, unread time.Time, _ int) (int, error) {
+		readNotificationsBefore, unreadNotificationsBefore = read, unread
+		return 0, nil
+	}), WithPlaybackStateReset(func(context.Context) (int, error) {
+		playbackStatesReset = true
+		return 0, nil
+	}), WithImageCacheCleanup(func(context.Context) (int, error) {
+		imageCacheTrimmed = true
+		return 0, nil
 	}))
 	service.now = func() time.Time { return time.Date(2026, time.July, 30, 0, 0, 0, 0, time.UTC) }
 	_ = service.HandleCleanup(context.Background(), workqueue.Job{})
@@ -87,6 +97,12 @@ func TestCleanupUsesRetentionWindows(t *testing.T) {
 	if !telemetryBefore.Equal(service.now().AddDate(0, 0, -30)) {
 		t.Fatalf("telemetry cleanup before = %s", telemetryBefore)
 	}
+	if !readNotificationsBefore.Equal(service.now().AddDate(0, 0, -90)) || !unreadNotificationsBefore.Equal(service.now().AddDate(0, 0, -180)) {
+		t.Fatalf("notification cleanup = %s / %s", readNotificationsBefore, unreadNotificationsBefore)
+	}
+	if !imageCacheTrimmed || !playbackStatesReset {
+		t.Fatalf("image cache trimmed = %v, playback states reset = %v", imageCacheTrimmed, playbackStatesReset)
+	}
 }
 
 type recordingStore struct {
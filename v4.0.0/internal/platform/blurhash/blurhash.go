@@ -0,0 +1,206 @@
+// Package blurhash 实现 BlurHash 编解码（https://blurha.sh）：把一张图压成二三十个字符，
+// 页面在真图加载完之前先画出一张模糊的占位图。worker 负责编码，模板渲染时解码成小 PNG。
+package blurhash
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// characters 是 BlurHash 使用的 base83 字母表。
+const characters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// ErrInvalidHash 表示字符串不是合法的 BlurHash。
+var ErrInvalidHash = errors.New("invalid blurhash")
+
+// Encode 把图片编码成 BlurHash。xComponents、yComponents 是横竖两个方向的余弦分量数（1~9），
+// 分量越多细节越多、字符串越长；海报用 4×3 就够了。图片越大越慢，调用方应先缩到百像素以内。
+func Encode(img image.Image, xComponents, yComponents int) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", fmt.Errorf("blurhash components must be between 1 and 9, got %dx%d", xComponents, yComponents)
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 {
+		return "", errors.New("blurhash needs a non-empty image")
+	}
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			linear[y*width+x] = [3]float64{sRGBToLinear(int(r >> 8)), sRGBToLinear(int(g >> 8)), sRGBToLinear(int(b >> 8))}
+		}
+	}
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				basisY := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := basisY * math.Cos(math.Pi*float64(i)*float64(x)/float64(width))
+					pixel := linear[y*width+x]
+					factor[0] += basis * pixel[0]
+					factor[1] += basis * pixel[1]
+					factor[2] += basis * pixel[2]
+				}
+			}
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+	maximumValue := 1.0
+	if len(factors) > 1 {
+		actualMaximum := 0.0
+		for _, factor := range factors[1:] {
+			actualMaximum = math.Max(actualMaximum, math.Max(math.Abs(factor[0]), math.Max(math.Abs(factor[1]), math.Abs(factor[2]))))
+		}
+		quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		hash.WriteString(encode83(quantisedMaximum, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+	dc := factors[0]
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, factor := range factors[1:] {
+		quantise := func(value float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(value/maximumValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encode83(quantise(factor[0])*19*19+quantise(factor[1])*19+quantise(factor[2]), 2))
+	}
+	return hash.String(), nil
+}
+
+// Decode 把 BlurHash 还原成 width×height 的图片。占位图只需要很小的尺寸（如 20×30），
+// 浏览器拉伸后本来就是模糊的。punch 调整对比度，1 为原样。
+func Decode(hash string, width, height int, punch float64) (*image.NRGBA, error) {
+	if len(hash) < 6 || width <= 0 || height <= 0 {
+		return nil, ErrInvalidHash
+	}
+	sizeFlag, err := decode83(hash[:1])
+	if err != nil {
+		return nil, err
+	}
+	yComponents, xComponents := sizeFlag/9+1, sizeFlag%9+1
+	if len(hash) != 4+2*xComponents*yComponents {
+		return nil, ErrInvalidHash
+	}
+	quantisedMaximum, err := decode83(hash[1:2])
+	if err != nil {
+		return nil, err
+	}
+	if punch <= 0 {
+		punch = 1
+	}
+	maximumValue := float64(quantisedMaximum+1) / 166 * punch
+	colors := make([][3]float64, xComponents*yComponents)
+	for index := range colors {
+		if index == 0 {
+			value, err := decode83(hash[2:6])
+			if err != nil {
+				return nil, err
+			}
+			colors[0] = [3]float64{sRGBToLinear(value >> 16), sRGBToLinear((value >> 8) & 255), sRGBToLinear(value & 255)}
+			continue
+		}
+		value, err := decode83(hash[4+index*2 : 6+index*2])
+		if err != nil {
+			return nil, err
+		}
+		unquantise := func(quantised int) float64 { return signPow(float64(quantised-9)/9, 2) * maximumValue }
+		colors[index] = [3]float64{unquantise(value / (19 * 19)), unquantise((value / 19) % 19), unquantise(value % 19)}
+	}
+	decoded := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var pixel [3]float64
+			for j := 0; j < yComponents; j++ {
+				basisY := math.Cos(math.Pi * float64(y) * float64(j) / float64(height))
+				for i := 0; i < xComponents; i++ {
+					basis := math.Cos(math.Pi*float64(x)*float64(i)/float64(width)) * basisY
+					component := colors[i+j*xComponents]
+					pixel[0] += component[0] * basis
+					pixel[1] += component[1] * basis
+					pixel[2] += component[2] * basis
+				}
+			}
+			decoded.SetNRGBA(x, y, color.NRGBA{R: uint8(linearToSRGB(pixel[0])), G: uint8(linearToSRGB(pixel[1])), B: uint8(linearToSRGB(pixel[2])), A: 255})
+		}
+	}
+	return decoded, nil
+}
+
+// Valid 只检查长度和字母表，不做完整解码，用于模板渲染前快速过滤脏数据。
+func Valid(hash string) bool {
+	if len(hash) < 6 {
+		return false
+	}
+	sizeFlag, err := decode83(hash[:1])
+	if err != nil || len(hash) != 4+2*(sizeFlag%9+1)*(sizeFlag/9+1) {
+		return false
+	}
+	_, err = decode83(hash)
+	return err == nil
+}
+
+// Components 返回 BlurHash 横竖两个方向的分量数，解码时可以按它选一个比例合适的尺寸。
+func Components(hash string) (int, int, error) {
+	if !Valid(hash) {
+		return 0, 0, ErrInvalidHash
+	}
+	sizeFlag, _ := decode83(hash[:1])
+	return sizeFlag%9 + 1, sizeFlag/9 + 1, nil
+}
+
+func encode83(value, length int) string {
+	encoded := make([]byte, length)
+	for index := length - 1; index >= 0; index-- {
+		encoded[index] = characters[value%83]
+		value /= 83
+	}
+	return string(encoded)
+}
+
+func decode83(value string) (int, error) {
+	decoded := 0
+	for _, character := range value {
+		digit := strings.IndexRune(characters, character)
+		if digit < 0 {
+			return 0, ErrInvalidHash
+		}
+		decoded = decoded*83 + digit
+	}
+	return decoded, nil
+}
+
+func sRGBToLinear(value int) float64 {
+	normalized := float64(value) / 255
+	if normalized <= 0.04045 {
+		return normalized / 12.92
+	}
+	return math.Pow((normalized+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	normalized := math.Max(0, math.Min(1, value))
+	if normalized <= 0.0031308 {
+		return int(normalized*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(normalized, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exponent float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exponent), value)
+}
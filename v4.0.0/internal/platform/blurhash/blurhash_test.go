@@ -0,0 +1,78 @@
+package blurhash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEncodeSolidColourRoundTrips(t *testing.T) {
+	solid := image.NewNRGBA(image.Rect(0, 0, 16, 24))
+	for index := 0; index < len(solid.Pix); index += 4 {
+		copy(solid.Pix[index:index+4], []byte{0xc0, 0x30, 0x20, 0xff})
+	}
+	hash, err := Encode(solid, 4, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4×3 分量：1 位尺寸 + 1 位最大值 + 4 位直流 + 11 个交流分量各 2 位。
+	if len(hash) != 28 || !Valid(hash) {
+		t.Fatalf("hash = %q", hash)
+	}
+	// 直流分量就是整张图的平均色，纯色图必须原样编码进去。
+	if dc, err := decode83(hash[2:6]); err != nil || dc != 0xc03020 {
+		t.Fatalf("average colour = %06x, %v", dc, err)
+	}
+	decoded, err := Decode(hash, 4, 6, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 离散采样下交流分量不会严格为 0，还原出来允许有一点起伏。
+	for _, point := range []image.Point{{0, 0}, {3, 5}, {2, 3}} {
+		got := decoded.NRGBAAt(point.X, point.Y)
+		if absDiff(got.R, 0xc0) > 40 || absDiff(got.G, 0x30) > 40 || absDiff(got.B, 0x20) > 40 {
+			t.Fatalf("pixel %v = %+v", point, got)
+		}
+	}
+}
+
+func TestEncodeKeepsCoarseStructure(t *testing.T) {
+	gradient := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			gradient.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 8), G: uint8(x * 8), B: uint8(x * 8), A: 255})
+		}
+	}
+	hash, err := Encode(gradient, 4, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(hash, 8, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left, right := decoded.NRGBAAt(0, 4).R, decoded.NRGBAAt(7, 4).R; left+100 > right {
+		t.Fatalf("gradient lost: left %d right %d (%s)", left, right, hash)
+	}
+}
+
+func TestDecodeRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{"", "LEHV6n", "LEHV6nWB2yk8pyo0adR*.7kCMdn", "LEHV6nWB2yk8pyo0adR*.7kCMdn\""} {
+		if _, err := Decode(hash, 4, 4, 1); err == nil || Valid(hash) {
+			t.Errorf("hash %q should be rejected", hash)
+		}
+	}
+	if !Valid("LEHV6nWB2yk8pyo0adR*.7kCMdnj") {
+		t.Fatal("reference hash should be valid")
+	}
+	if _, err := Encode(image.NewNRGBA(image.Rect(0, 0, 2, 2)), 0, 3); err == nil {
+		t.Fatal("component count out of range must fail")
+	}
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
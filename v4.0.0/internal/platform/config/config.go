@@ -34,11 +34,26 @@ type Config struct {
 	Popularity              PopularityConfig
 	Catalog                 CatalogConfig
 	Danmaku                 DanmakuConfig
+	ImageCache              ImageCacheConfig
 	Database                DatabaseConfig
 	OutboundMaxConnsPerHost int
 	AppSecret               string
 	JobsInWeb               bool
 	Worker                  WorkerConfig
+	Notify                  NotifyConfig
+}
+
+// NotifyConfig 是站内通知之外的可选投递渠道。SMTPHost 为空不发邮件，WebhookURL 为空不推 Webhook；
+// 站内收件箱始终写入，不受这里影响。
+type NotifyConfig struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// WebhookSecret 非空时，每次推送都带上请求体的 HMAC-SHA256 签名，接收方据此校验来源。
+	WebhookURL    string
+	WebhookSecret string
 }
 
 // WorkerConfig 控制后台任务进程（cmd/worker）的并发数和轮询间隔。
@@ -69,6 +84,13 @@ type CatalogConfig struct {
 	CFGatewayURL string
 	CFAPIToken   string
 	CFAIModel    string
+	// Embedding* 选择向量后端：ollama 用上面的 OllamaHost，openai 走任意 OpenAI 兼容的
+	// /embeddings 接口。模型或维度一变，worker 会在后台整库重建向量，重建完成前旧向量照常服务。
+	EmbeddingProvider   string
+	EmbeddingModel      string
+	EmbeddingDimensions int
+	EmbeddingAPIURL     string
+	EmbeddingAPIKey     string
 	// AITimeout 单独给 AI Gateway 用。一次非流式 chat completion 动辄几十秒，
 	// 沿用搜索源的秒级超时会让语义改写必然失败。
 	AITimeout time.Duration
@@ -88,6 +110,8 @@ type CatalogConfig struct {
 	IMDbBackfillBatch int
 	// WikidataTimeout 单独给 SPARQL 用：批量查询比普通抓取慢得多。
 	WikidataTimeout time.Duration
+	// BangumiUserAgent 是访问 Bangumi 开放接口的 User-Agent。Bangumi 同样要求能说明来源，留空用内置默认值。
+	BangumiUserAgent string
 }
 
 // DanmakuConfig 保存可选弹幕服务地址；为空时弹幕能力安全降级。
@@ -95,6 +119,15 @@ type DanmakuConfig struct {
 	APIBase string
 }
 
+// ImageCacheConfig 控制图片代理的磁盘缓存。Dir 为空时不启用缓存，图片代理保持直连透传；
+// 两个编码命令为空时只做缩放不转码。命令里用 {in} 和 {out} 表示输入输出文件。
+type ImageCacheConfig struct {
+	Dir         string
+	MaxBytes    int64
+	WebPCommand string
+	AVIFCommand string
+}
+
 // DatabaseConfig 保存隔离新库连接信息和连接池上限。
 type DatabaseConfig struct {
 	Migrate  bool
@@ -267,6 +300,18 @@ func Load() (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	imageCacheMaxMB, err := positiveIntEnv("IMAGE_CACHE_MAX_MB", 1024)
+	if err != nil {
+		return Config{}, err
+	}
+	embeddingDimensions, err := positiveIntEnv("EMBEDDING_DIMENSIONS", 768)
+	if err != nil {
+		return Config{}, err
+	}
+	smtpPort, err := positiveIntEnv("SMTP_PORT", 587)
+	if err != nil {
+		return Config{}, err
+	}
 
 	cfg := Config{
 		Env:             appEnv,
@@ -320,6 +365,12 @@ func Load() (Config, error) {
 			CFAPIToken:   env("CF_API_TOKEN", ""),
 			CFAIModel:    env("CF_AI_MODEL", "custom-alibaba-coding/kimi-k2.5"),
 
+			EmbeddingProvider:   strings.ToLower(env("EMBEDDING_PROVIDER", "ollama")),
+			EmbeddingModel:      env("EMBEDDING_MODEL", ""),
+			EmbeddingDimensions: embeddingDimensions,
+			EmbeddingAPIURL:     strings.TrimRight(env("EMBEDDING_API_URL", ""), "/"),
+			EmbeddingAPIKey:     env("EMBEDDING_API_KEY", ""),
+
 			AITimeout:             time.Duration(catalogAITimeoutSeconds) * time.Second,
 			IMDbLookupInterval:    time.Duration(imdbLookupIntervalMilliseconds) * time.Millisecond,
 			DoubanRequestInterval: time.Duration(doubanRequestIntervalMilliseconds) * time.Millisecond,
@@ -327,8 +378,15 @@ func Load() (Config, error) {
 			WikidataUserAgent:     env("WIKIDATA_USER_AGENT", ""),
 			IMDbBackfillBatch:     imdbBackfillBatch,
 			WikidataTimeout:       time.Duration(wikidataTimeoutSeconds) * time.Second,
+			BangumiUserAgent:      env("BANGUMI_USER_AGENT", ""),
 		},
 		Danmaku: DanmakuConfig{APIBase: strings.TrimRight(env("DANMU_API_BASE", ""), "/")},
+		ImageCache: ImageCacheConfig{
+			Dir:         strings.TrimSpace(env("IMAGE_CACHE_DIR", "")),
+			MaxBytes:    int64(imageCacheMaxMB) << 20,
+			WebPCommand: strings.TrimSpace(env("IMAGE_WEBP_COMMAND", "")),
+			AVIFCommand: strings.TrimSpace(env("IMAGE_AVIF_COMMAND", "")),
+		},
 		Database: DatabaseConfig{
 			Migrate:  env("DB_AUTO_MIGRATE", "true") == "true",
 			Host:     env("DB_HOST", "localhost"),
@@ -340,6 +398,15 @@ func Load() (Config, error) {
 			TimeZone: env("DB_TIMEZONE", "Asia/Shanghai"),
 			MaxConns: databaseMaxConns,
 		},
+		Notify: NotifyConfig{
+			SMTPHost:      env("SMTP_HOST", ""),
+			SMTPPort:      smtpPort,
+			SMTPUsername:  env("SMTP_USERNAME", ""),
+			SMTPPassword:  env("SMTP_PASSWORD", ""),
+			SMTPFrom:      env("SMTP_FROM", ""),
+			WebhookURL:    env("NOTIFY_WEBHOOK_URL", ""),
+			WebhookSecret: env("NOTIFY_WEBHOOK_SECRET", ""),
+		},
 	}
 
 	if err := cfg.Validate(); err != nil {
@@ -398,12 +465,37 @@ func (c Config) Validate() error {
 	if c.Catalog.WikidataTimeout > 5*time.Minute {
 		return errors.New("WIKIDATA_TIMEOUT_SECONDS must not exceed 300")
 	}
+	switch c.Catalog.EmbeddingProvider {
+	case "", "ollama":
+	case "openai":
+		if c.Catalog.EmbeddingAPIURL == "" || c.Catalog.EmbeddingModel == "" {
+			return errors.New("EMBEDDING_API_URL and EMBEDDING_MODEL are required when EMBEDDING_PROVIDER is openai")
+		}
+	default:
+		return fmt.Errorf("unsupported EMBEDDING_PROVIDER %q", c.Catalog.EmbeddingProvider)
+	}
+	// pgvector 的 HNSW 索引最多支持 2000 维，再大相似推荐就只能全表扫描。
+	if c.Catalog.EmbeddingDimensions > 2000 {
+		return errors.New("EMBEDDING_DIMENSIONS must not exceed 2000")
+	}
+	if c.ImageCache.MaxBytes > 100<<30 {
+		return errors.New("IMAGE_CACHE_MAX_MB must not exceed 102400")
+	}
 	if c.Database.MaxConns > 100 {
 		return errors.New("DB_MAX_CONNS must not exceed 100")
 	}
 	if c.Worker.Concurrency > 64 {
 		return errors.New("WORKER_CONCURRENCY must not exceed 64")
 	}
+	if c.Notify.SMTPHost != "" && (c.Notify.SMTPFrom == "" || c.Notify.SMTPPort > 65535) {
+		return errors.New("SMTP_FROM is required and SMTP_PORT must be a valid port when SMTP_HOST is set")
+	}
+	if c.Notify.WebhookURL != "" {
+		webhookURL, err := url.Parse(c.Notify.WebhookURL)
+		if err != nil || webhookURL.Host == "" || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") {
+			return errors.New("NOTIFY_WEBHOOK_URL must be an absolute http or https URL")
+		}
+	}
 	if c.Env != "development" && c.Env != "test" && c.Env != "production" {
 		return fmt.Errorf("unsupported APP_ENV %q", c.Env)
 	}
@@ -115,6 +115,9 @@ func TestLoadUsesIsolatedDefaults(t *testing.T) {
 	t.Setenv("CF_GATEWAY_URL", "")
 	t.Setenv("CF_API_TOKEN", "")
 	t.Setenv("CF_AI_MODEL", "")
+	t.Setenv("EMBEDDING_PROVIDER", "")
+	t.Setenv("EMBEDDING_MODEL", "")
+	t.Setenv("EMBEDDING_DIMENSIONS", "")
 	t.Setenv("DANMU_API_BASE", "")
 	t.Setenv("JOBS_IN_WEB", "")
 	t.Setenv("WORKER_POLL_SECONDS", "")
@@ -163,6 +166,10 @@ func TestLoadUsesIsolatedDefaults(t *testing.T) {
 	if cfg.Catalog.OllamaHost != "http://localhost:11434" || cfg.Catalog.OllamaModel != "quentinz/bge-base-zh-v1.5" || cfg.Catalog.CFAIModel != "custom-alibaba-coding/kimi-k2.5" {
 		t.Fatalf("catalog external defaults changed: %+v", cfg.Catalog)
 	}
+	// 默认后端和维度必须对上 0030 建的 vector(768) 列，否则升级后会无故触发一次整库重建。
+	if cfg.Catalog.EmbeddingProvider != "ollama" || cfg.Catalog.EmbeddingModel != "" || cfg.Catalog.EmbeddingDimensions != 768 {
+		t.Fatalf("embedding defaults changed: %+v", cfg.Catalog)
+	}
 	// AI Gateway 的超时必须远大于搜索源超时，否则非流式 chat completion 必然超时。
 	if cfg.Catalog.AITimeout != 90*time.Second || cfg.Catalog.AITimeout <= cfg.Search.SourceTimeout {
 		t.Fatalf("catalog AI timeout = %s (search source timeout %s)", cfg.Catalog.AITimeout, cfg.Search.SourceTimeout)
@@ -214,6 +221,8 @@ func TestLoadRejectsUnsafeResourceLimits(t *testing.T) {
 		{key: "WORKER_CONCURRENCY", value: "65"},
 		{key: "HTTP_ACCESS_LOG_SAMPLE_PERCENT", value: "101"},
 		{key: "HTTP_ACCESS_LOG_MAX_PER_SECOND", value: "1001"},
+		{key: "EMBEDDING_DIMENSIONS", value: "2001"},
+		{key: "EMBEDDING_PROVIDER", value: "cohere"},
 	}
 	for _, testCase := range tests {
 		t.Run(testCase.key, func(t *testing.T) {
@@ -238,6 +247,27 @@ func TestLoadAllowsPopularityRefreshOverride(t *testing.T) {
 	}
 }
 
+func TestLoadValidatesNotificationChannels(t *testing.T) {
+	t.Setenv("APP_ENV", "test")
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	if _, err := Load(); err == nil {
+		t.Fatal("Load() accepted SMTP_HOST without SMTP_FROM")
+	}
+	t.Setenv("SMTP_FROM", "noreply@example.com")
+	t.Setenv("NOTIFY_WEBHOOK_URL", "hooks.example.com/moovie")
+	if _, err := Load(); err == nil {
+		t.Fatal("Load() accepted a relative NOTIFY_WEBHOOK_URL")
+	}
+	t.Setenv("NOTIFY_WEBHOOK_URL", "https://hooks.example.com/moovie")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Notify.SMTPPort != 587 || cfg.Notify.SMTPFrom != "noreply@example.com" || cfg.Notify.WebhookURL == "" {
+		t.Fatalf("notify config = %+v", cfg.Notify)
+	}
+}
+
 func TestLoadAllowsExplicitResourceMatchRolloutFlags(t *testing.T) {
 	t.Setenv("APP_ENV", "test")
 	t.Setenv("RESOURCE_MATCH_SHADOW", "false")
@@ -356,3 +386,21 @@ func TestDatabaseDSNRoundTripsCredentials(t *testing.T) {
 		t.Fatalf("credentials did not round trip: user=%q password=%q", parsed.User.Username(), password)
 	}
 }
+
+func TestLoadRequiresEndpointForOpenAIEmbeddings(t *testing.T) {
+	t.Setenv("APP_ENV", "test")
+	t.Setenv("EMBEDDING_PROVIDER", "openai")
+	t.Setenv("EMBEDDING_MODEL", "text-embedding-3-small")
+	t.Setenv("EMBEDDING_API_URL", "")
+	if _, err := Load(); err == nil {
+		t.Fatal("openai embeddings without EMBEDDING_API_URL were accepted")
+	}
+	t.Setenv("EMBEDDING_API_URL", "https://api.openai.test/v1/")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Catalog.EmbeddingAPIURL != "https://api.openai.test/v1" {
+		t.Fatalf("embedding API URL = %q", cfg.Catalog.EmbeddingAPIURL)
+	}
+}
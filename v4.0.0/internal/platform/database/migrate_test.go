@@ -17,7 +17,7 @@ func TestEmbeddedMigrationsIncludeCanonicalCutover(t *testing.T) {
 	for _, migration := range migrations {
 		versions = append(versions, migration.version)
 	}
-	expectedVersions := make([]string, 52)
+	expectedVersions := make([]string, 69)
 	for index := range expectedVersions {
 		expectedVersions[index] = fmt.Sprintf("%04d", index+1)
 	}
@@ -28,7 +28,7 @@ func TestEmbeddedMigrationsIncludeCanonicalCutover(t *testing.T) {
 	for _, migration := range migrations {
 		upperSQL += "\n" + strings.ToUpper(migration.sql)
 	}
-	for _, required := range []string{"CREATE TABLE SITES", "CREATE TABLE VOD_ITEMS", "CREATE TABLE COPYRIGHT_FILTERS", "CREATE TABLE CATEGORY_FILTERS", "CREATE TABLE SEARCH_LOGS", "CREATE TABLE SITE_STATS", "CREATE TABLE WATCH_HISTORIES", "CREATE TABLE USERS", "CREATE TABLE USER_MOVIES", "CREATE TABLE MOVIES", "CREATE TABLE DOUBAN_SYNC_JOBS", "CREATE TABLE MONTHLY_REPORTS", "CREATE TABLE COMMENT_LIKES", "CREATE TABLE COMMENT_REPLIES", "CREATE TABLE FEEDBACKS", "CREATE TABLE DANMAKUS", "CREATE TABLE IF NOT EXISTS MEDIA_FIELD_SOURCES", "ALTER TABLE VOD_ITEMS ADD COLUMN IF NOT EXISTS RESOURCE_STATUS", "CREATE TABLE IF NOT EXISTS RESOURCE_PLAYBACK_HEALTH", "CREATE TABLE IF NOT EXISTS HISTORY_SYNC_EVENTS", "CREATE TABLE USER_RECOMMENDATION_SNAPSHOTS", "PLAYBACK_ATTEMPT_EVENTS_TRENDING_IDX"} {
+	for _, required := range []string{"CREATE TABLE SITES", "CREATE TABLE VOD_ITEMS", "CREATE TABLE COPYRIGHT_FILTERS", "CREATE TABLE CATEGORY_FILTERS", "CREATE TABLE SEARCH_LOGS", "CREATE TABLE SITE_STATS", "CREATE TABLE WATCH_HISTORIES", "CREATE TABLE USERS", "CREATE TABLE USER_MOVIES", "CREATE TABLE MOVIES", "CREATE TABLE DOUBAN_SYNC_JOBS", "CREATE TABLE MONTHLY_REPORTS", "CREATE TABLE COMMENT_LIKES", "CREATE TABLE COMMENT_REPLIES", "CREATE TABLE FEEDBACKS", "CREATE TABLE DANMAKUS", "CREATE TABLE IF NOT EXISTS MEDIA_FIELD_SOURCES", "ALTER TABLE VOD_ITEMS ADD COLUMN IF NOT EXISTS RESOURCE_STATUS", "CREATE TABLE IF NOT EXISTS RESOURCE_PLAYBACK_HEALTH", "CREATE TABLE IF NOT EXISTS HISTORY_SYNC_EVENTS", "CREATE TABLE USER_RECOMMENDATION_SNAPSHOTS", "PLAYBACK_ATTEMPT_EVENTS_TRENDING_IDX", "CREATE TABLE SKIP_MARKER_VOTES", "PLAYBACK_ATTEMPT_EVENTS_LINE_IDX", "CREATE TABLE RESOURCE_PROFILE_HEALTH", "CREATE TABLE EMBED_LINKS", "CREATE TABLE PEOPLE", "CREATE TABLE MEDIA_CREDITS", "CREATE TABLE COLLECTIONS", "CREATE TABLE COLLECTION_ITEMS", "MEDIA_FIELD_SOURCES ADD COLUMN LOCKED", "CREATE TABLE MEDIA_FIELD_HISTORY", "MEDIA ADD COLUMN MERGED_INTO_ID", "CREATE TABLE MEDIA_DUPLICATE_CANDIDATES", "CREATE TABLE MEDIA_MERGES", "CREATE TABLE MEDIA_TRANSLATIONS", "USERS ADD COLUMN LOCALE", "CREATE TABLE EMBEDDING_GENERATIONS", "CREATE TABLE RECOMMENDATION_FEEDBACK", "CREATE TABLE MEDIA_COOCCURRENCE", "CREATE TABLE USER_DIGESTS", "CREATE TABLE NOTIFICATIONS", "CREATE TABLE MEDIA_PLAYBACK_STATES", "CREATE TABLE NOTIFICATION_MUTES"} {
 		if !strings.Contains(upperSQL, required) {
 			t.Fatalf("migration missing %q", required)
 		}
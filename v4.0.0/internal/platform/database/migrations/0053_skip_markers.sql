@@ -0,0 +1,17 @@
+-- 用户标记的片头/片尾区间。一人一集一种标记只保留最近一次提交；
+-- media_id 和 season_number 冗余存储，整季聚合时不用再回表 media_units。
+CREATE TABLE skip_marker_votes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    season_number INTEGER NOT NULL,
+    media_unit_id BIGINT NOT NULL REFERENCES media_units(id) ON DELETE CASCADE,
+    marker_type TEXT NOT NULL CHECK (marker_type IN ('intro', 'outro')),
+    start_ms INTEGER NOT NULL CHECK (start_ms >= 0),
+    end_ms INTEGER NOT NULL CHECK (end_ms > start_ms),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, media_unit_id, marker_type)
+);
+CREATE INDEX skip_marker_votes_season_idx
+    ON skip_marker_votes (media_id, season_number, marker_type);
@@ -0,0 +1,12 @@
+-- 线路级滚动播放体验（QoE）计数，由 quality_refresh 任务从 7 天事件窗口重算。
+-- 只存原始计数，评分和降权阈值留在代码里，调整口径不需要再跑迁移。
+ALTER TABLE resource_play_lines
+    ADD COLUMN qoe_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN qoe_first_frames INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN qoe_rebuffers INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN qoe_failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN qoe_auto_switches INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN qoe_refreshed_at TIMESTAMPTZ;
+
+CREATE INDEX playback_attempt_events_line_idx
+    ON playback_attempt_events (play_line_id, created_at DESC);
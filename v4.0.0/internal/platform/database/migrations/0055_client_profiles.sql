@@ -0,0 +1,18 @@
+-- 播放事件按客户端画像（平台 + HLS 播放方式）分别统计。同一条 HLS 线路在桌面 hls.js 上正常、
+-- 在 iOS Safari 或电视盒子上却可能因编码、混合内容、跨域失败，全局成功率会把这些差异平均掉。
+ALTER TABLE playback_attempt_events
+    ADD COLUMN client_profile TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE resource_profile_health (
+    source_key TEXT NOT NULL,
+    vod_id TEXT NOT NULL,
+    client_profile TEXT NOT NULL,
+    success_count INTEGER NOT NULL DEFAULT 0,
+    failure_count INTEGER NOT NULL DEFAULT 0,
+    avg_speed_ms INTEGER NOT NULL DEFAULT 0,
+    refreshed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (source_key, vod_id, client_profile),
+    FOREIGN KEY (source_key, vod_id) REFERENCES vod_items (source_key, vod_id) ON DELETE CASCADE
+);
+CREATE INDEX resource_profile_health_profile_idx
+    ON resource_profile_health (client_profile, source_key, vod_id);
@@ -0,0 +1,13 @@
+-- 外站嵌入改为签发的嵌入链接：链接指向一集（media_unit），不再接受任意播放地址；
+-- 令牌只携带链接 ID 和过期时间，允许嵌入的来源和观看次数以这张表为准。
+CREATE TABLE embed_links (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    media_unit_id BIGINT NOT NULL REFERENCES media_units(id) ON DELETE CASCADE,
+    allowed_origins TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ NOT NULL,
+    view_count BIGINT NOT NULL DEFAULT 0,
+    last_viewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX embed_links_user_idx ON embed_links (user_id, created_at DESC);
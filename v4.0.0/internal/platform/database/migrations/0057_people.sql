@@ -0,0 +1,28 @@
+-- 演职员实体。同一个人可能先从豆瓣、后从 TMDB 进来，两边的 ID 记在同一行上，
+-- 各自唯一（空串不参与）；media.directors / media.actors 里的 JSON 仍保留，供旧页面和向量文本使用。
+CREATE TABLE people (
+    id BIGSERIAL PRIMARY KEY,
+    douban_id TEXT NOT NULL DEFAULT '',
+    tmdb_id TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    original_name TEXT NOT NULL DEFAULT '',
+    avatar TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX people_douban_id_idx ON people (douban_id) WHERE douban_id <> '';
+CREATE UNIQUE INDEX people_tmdb_id_idx ON people (tmdb_id) WHERE tmdb_id <> '';
+
+-- 作品的演职员表。source 是写入这一行的来源，同一来源重新抓取时只替换自己写的行，
+-- 豆瓣和 TMDB 对同一个人的记录会各留一行，读取时按人去重。
+CREATE TABLE media_credits (
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    person_id BIGINT NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('director', 'actor')),
+    character TEXT NOT NULL DEFAULT '',
+    credit_order INTEGER NOT NULL DEFAULT 0,
+    source TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (media_id, person_id, role, source)
+);
+CREATE INDEX media_credits_person_idx ON media_credits (person_id);
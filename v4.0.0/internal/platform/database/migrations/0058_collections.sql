@@ -0,0 +1,26 @@
+-- 系列与合集。kind = series 时一行对应一部剧（TMDB TV ID），豆瓣按季拆开的条目各是其中一项；
+-- kind = movie 时对应 TMDB 的 belongs_to_collection，例如三部曲。
+CREATE TABLE collections (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (kind IN ('series', 'movie')),
+    provider TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    overview TEXT NOT NULL DEFAULT '',
+    poster TEXT NOT NULL DEFAULT '',
+    backdrop TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (kind, provider, external_id)
+);
+
+-- 合集成员。观看顺序先看季号，再看上映日期，都没有时按 media.year 兜底。
+CREATE TABLE collection_items (
+    collection_id BIGINT NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    season_number INTEGER NOT NULL DEFAULT 0,
+    release_date DATE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (collection_id, media_id)
+);
+CREATE INDEX collection_items_media_idx ON collection_items (media_id);
@@ -0,0 +1,17 @@
+-- 管理员手工修正元数据。locked 的字段任何 Provider 刷新都不再改写，只有管理员能改；
+-- 人工修改本身以 manual 来源、最高优先级记在 media_field_sources 里。
+ALTER TABLE media_field_sources ADD COLUMN locked BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 字段变更历史：Provider 刷新和管理员修改都记一行，actor_user_id 只有人工修改才有。
+-- 值统一存文本，回滚时按原列类型转回去。
+CREATE TABLE media_field_history (
+    id BIGSERIAL PRIMARY KEY,
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    field_name TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    actor_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    old_value TEXT,
+    new_value TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX media_field_history_media_idx ON media_field_history (media_id, created_at DESC, id DESC);
@@ -0,0 +1,40 @@
+-- 重复作品合并。被合并的作品行不删除（user_movies 对 media 是 RESTRICT，拆分时也要用回原行），
+-- 只记下并入了哪一部；匹配和详情页据此跳到保留的作品。
+ALTER TABLE media ADD COLUMN merged_into_id BIGINT REFERENCES media(id) ON DELETE SET NULL;
+CREATE INDEX media_merged_into_idx ON media (merged_into_id) WHERE merged_into_id IS NOT NULL;
+
+-- 疑似重复作品的复核队列。一对作品只记一行，media_id 总是较小的那个。
+CREATE TABLE media_duplicate_candidates (
+    id BIGSERIAL PRIMARY KEY,
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    duplicate_media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    confidence NUMERIC(5,4) NOT NULL,
+    matched_by TEXT NOT NULL,
+    reason_json JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'review' CHECK (status IN ('review', 'merged', 'dismissed')),
+    reviewed_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (media_id, duplicate_media_id),
+    CHECK (media_id < duplicate_media_id)
+);
+CREATE INDEX media_duplicate_candidates_review_idx ON media_duplicate_candidates (status, confidence DESC, id DESC);
+
+-- 合并留痕。moved 记下每张表被挪走的行键，拆分时按它原样挪回去，
+-- 合并之后新产生的数据留在保留的作品上。
+CREATE TABLE media_merges (
+    id BIGSERIAL PRIMARY KEY,
+    source_media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    target_media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    candidate_id BIGINT REFERENCES media_duplicate_candidates(id) ON DELETE SET NULL,
+    actor_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    moved JSONB NOT NULL DEFAULT '{}',
+    merged_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    split_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    split_reason TEXT NOT NULL DEFAULT '',
+    split_at TIMESTAMPTZ
+);
+CREATE INDEX media_merges_source_idx ON media_merges (source_media_id, merged_at DESC);
+CREATE INDEX media_merges_target_idx ON media_merges (target_media_id, merged_at DESC);
@@ -0,0 +1,15 @@
+-- 多语言资料。media 表本身的片名和简介就是默认语言（简体中文），这里只存其他语言的版本，
+-- 以及 media 表没有的宣传语。locale 用站点的语言标识（zh-CN、en），不是上游接口的写法。
+CREATE TABLE media_translations (
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    locale TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    summary TEXT NOT NULL DEFAULT '',
+    tagline TEXT NOT NULL DEFAULT '',
+    provider TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (media_id, locale)
+);
+
+-- 用户在设置页选的界面语言，空字符串表示跟随浏览器。
+ALTER TABLE users ADD COLUMN locale TEXT NOT NULL DEFAULT '';
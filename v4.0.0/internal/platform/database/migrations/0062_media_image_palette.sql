@@ -0,0 +1,11 @@
+-- 海报和首张剧照的占位信息：blurhash 让列表页在真图到达前先画一张模糊图，
+-- 主色和强调色给详情页做主题色。颜色统一存成 #rrggbb。
+-- image_palette_source 记下计算时用的海报和剧照地址，图片换了才需要重新计算。
+ALTER TABLE media
+    ADD COLUMN poster_blurhash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN poster_color TEXT NOT NULL DEFAULT '',
+    ADD COLUMN poster_accent_color TEXT NOT NULL DEFAULT '',
+    ADD COLUMN backdrop_blurhash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN backdrop_color TEXT NOT NULL DEFAULT '',
+    ADD COLUMN backdrop_accent_color TEXT NOT NULL DEFAULT '',
+    ADD COLUMN image_palette_source TEXT NOT NULL DEFAULT '';
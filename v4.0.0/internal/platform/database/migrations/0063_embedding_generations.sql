@@ -0,0 +1,27 @@
+-- 向量按「代」管理：每一代是一个模型名加维度。active 是正在服务的那一代，写在 embedding 列；
+-- 换模型时新建一代 building，worker 把全库重新向量化写进临时列 embedding_next，
+-- 建好索引后在一个事务里换列，期间相似推荐一直用旧向量。
+-- embedding_model / embedding_dimensions 记下每一行向量出自哪一代，用来判断是否需要重算。
+ALTER TABLE media
+    ADD COLUMN embedding_model TEXT NOT NULL DEFAULT '',
+    ADD COLUMN embedding_dimensions INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE embedding_generations (
+    id BIGSERIAL PRIMARY KEY,
+    model TEXT NOT NULL,
+    dimensions INTEGER NOT NULL CHECK (dimensions > 0),
+    status TEXT NOT NULL CHECK (status IN ('active', 'building', 'retired', 'abandoned')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    activated_at TIMESTAMPTZ
+);
+-- 同一时刻最多一代在服务、一代在构建。
+CREATE UNIQUE INDEX embedding_generations_active_idx ON embedding_generations ((true)) WHERE status = 'active';
+CREATE UNIQUE INDEX embedding_generations_building_idx ON embedding_generations ((true)) WHERE status = 'building';
+
+-- 现有向量都出自此前写死的 Ollama 默认模型。自定义过 OLLAMA_MODEL 的部署会在 worker
+-- 启动后发现模型对不上，自动走一遍重建，不会把两种模型的向量混在一起比较。
+UPDATE media SET embedding_model = 'ollama:quentinz/bge-base-zh-v1.5', embedding_dimensions = 768
+WHERE embedding IS NOT NULL;
+INSERT INTO embedding_generations (model, dimensions, status, activated_at)
+SELECT 'ollama:quentinz/bge-base-zh-v1.5', 768, 'active', NOW()
+WHERE EXISTS (SELECT 1 FROM media WHERE embedding IS NOT NULL);
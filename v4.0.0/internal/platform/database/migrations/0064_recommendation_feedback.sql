@@ -0,0 +1,9 @@
+-- 「不感兴趣」等推荐反馈。一位用户对一部作品只留一条，重复点击只刷新时间。
+-- 口味向量把它当作负信号，推荐和「因为你看了」都会把它排除在外。
+CREATE TABLE recommendation_feedback (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    signal TEXT NOT NULL CHECK (signal IN ('not_interested')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, media_id)
+);
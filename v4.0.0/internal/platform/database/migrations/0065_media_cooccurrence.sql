@@ -0,0 +1,13 @@
+-- 作品之间的共现相似度：「看过 X 的人也看了 Y」。由 Worker 的 recommendation_cooccurrence
+-- 任务每天从 user_movies 和 playback_positions 整表重算，每部作品只留最相关的一批。
+-- score 是余弦相似度 shared_users / sqrt(看过 X 的人数 × 看过 Y 的人数)，0~1。
+CREATE TABLE media_cooccurrence (
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    related_media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    shared_users INTEGER NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (media_id, related_media_id)
+);
+
+CREATE INDEX media_cooccurrence_score_idx ON media_cooccurrence (media_id, score DESC);
@@ -0,0 +1,13 @@
+-- 每周「本周上新」摘要：新上线且贴近口味的作品、想看或在看的剧的新集、想看的片可以看了。
+-- 由 Worker 的 recommendation_digest 任务每周一生成，一位用户一周一行；
+-- 用户中心和 RSS 订阅只读这里。item_count 为 0 的周也存一行，避免同一周反复重算。
+CREATE TABLE user_digests (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    week_start DATE NOT NULL,
+    payload JSONB NOT NULL,
+    item_count INTEGER NOT NULL DEFAULT 0,
+    generated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, week_start)
+);
+
+CREATE INDEX user_digests_user_recent_idx ON user_digests (user_id, week_start DESC) WHERE item_count > 0;
@@ -0,0 +1,46 @@
+-- 站内通知收件箱。每条通知属于一位用户，read_at 为空表示未读。
+-- dedupe_key 非空时同一用户、同一类型只会有一条，用来保证「想看的片可以看了」这类提醒只发一次。
+CREATE TABLE notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    link TEXT NOT NULL DEFAULT '',
+    dedupe_key TEXT NOT NULL DEFAULT '',
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX notifications_user_recent_idx ON notifications (user_id, created_at DESC);
+CREATE UNIQUE INDEX notifications_dedupe_idx ON notifications (user_id, kind, dedupe_key) WHERE dedupe_key <> '';
+
+-- 作品上一次检查时的播放状态（none / direct / ready），availability_check 任务据此判断
+-- 「从没有片源变成可播」。没有行等同于 none。
+CREATE TABLE media_playback_states (
+    media_id BIGINT PRIMARY KEY REFERENCES media(id) ON DELETE CASCADE,
+    state TEXT NOT NULL CHECK (state IN ('none', 'direct', 'ready')),
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- 上线时已经能播的作品先记下来，免得第一次检查就把它们当成「刚上线」群发提醒。
+-- 判断条件和 search.ListUnifiedResources 的 direct / ready 一致。
+INSERT INTO media_playback_states (media_id, state)
+SELECT link.media_id,
+       CASE WHEN BOOL_OR(EXISTS (
+           SELECT 1 FROM resource_episode_candidates candidate
+           JOIN resource_play_lines line ON line.id = candidate.line_id
+           WHERE candidate.media_id = link.media_id
+             AND line.source_key = link.source_key AND line.vod_id = link.vod_id
+             AND candidate.resource_status NOT IN ('retired', 'deleted')
+             AND line.resource_status NOT IN ('retired', 'deleted')
+             AND COALESCE(candidate.play_url, '') <> ''
+       )) THEN 'ready' ELSE 'direct' END
+FROM resource_media_links link
+JOIN vod_items resource ON resource.source_key = link.source_key AND resource.vod_id = link.vod_id
+WHERE COALESCE(resource.resource_status, 'active') <> 'removed'
+  AND COALESCE(resource.vod_play_url, '') <> ''
+GROUP BY link.media_id;
+
+-- 片源上线时要按作品找出所有想看的人，原有索引以 user_id 打头用不上。
+CREATE INDEX user_movies_media_wish_idx ON user_movies (media_id) WHERE status = 'wish';
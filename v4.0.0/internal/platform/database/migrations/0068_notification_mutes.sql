@@ -0,0 +1,12 @@
+-- 通知中心的按类型免打扰：有一行就表示这位用户不再接收这一类通知（收件箱和站外渠道都不发）。
+CREATE TABLE notification_mutes (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, kind)
+);
+
+-- 导航栏每分钟轮询一次未读数，只扫未读的那部分。
+CREATE INDEX notifications_user_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+-- 保留期清理按创建时间跨用户删除。
+CREATE INDEX notifications_created_idx ON notifications (created_at);
@@ -0,0 +1,8 @@
+-- 没有豆瓣条目的作品用 m<media.id> 作为 movie_id，之前的写入只按豆瓣 ID 找 media，
+-- 这些片单记录的 media_id 都是空的，口味向量、共现、合集进度和想看提醒都看不到它们。
+-- 正则不匹配时 SUBSTRING 返回 NULL，豆瓣 ID 这类 movie_id 不会参与转换。
+UPDATE user_movies
+SET media_id = media.id
+FROM media
+WHERE user_movies.media_id IS NULL
+  AND media.id = SUBSTRING(user_movies.movie_id FROM '^m([1-9][0-9]{0,17})$')::bigint;
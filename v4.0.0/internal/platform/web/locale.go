@@ -0,0 +1,176 @@
+package web
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 语言相关的常量。站点默认中文，其他语言通过 ?lang= 切换，不拆成 /en/ 前缀路由，
+// 这样现有的路由契约和 canonical 都不用翻一倍。
+const (
+	DefaultLocale    = "zh-CN"
+	LocaleContextKey = "locale"
+	LocaleQueryParam = "lang"
+	localeCookieName = "lang"
+	localeCookieAge  = 365 * 24 * 3600
+)
+
+// SupportedLocales 是界面和资料支持的语言，顺序即 hreflang 的输出顺序。
+var SupportedLocales = []string{DefaultLocale, "en"}
+
+// LocalePreferrer 由登录用户实现，返回账号设置里的语言（空表示跟随浏览器）。
+type LocalePreferrer interface {
+	PreferredLocale() string
+}
+
+// Alternate 是一条 hreflang 备用链接。
+type Alternate struct {
+	Hreflang string
+	Href     string
+}
+
+// NormalizeLocale 把浏览器或用户给的语言标签归一到受支持的语言，不支持时返回空字符串。
+// zh、zh-TW、zh-Hans 都落到 zh-CN：目前只有一套中文资料。
+func NormalizeLocale(value string) string {
+	tag := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(value, "_", "-")))
+	switch {
+	case tag == "":
+		return ""
+	case tag == "zh" || strings.HasPrefix(tag, "zh-"):
+		return DefaultLocale
+	case tag == "en" || strings.HasPrefix(tag, "en-"):
+		return "en"
+	default:
+		return ""
+	}
+}
+
+// ParseAcceptLanguage 按 q 值从高到低返回 Accept-Language 里第一个受支持的语言。
+func ParseAcceptLanguage(header string) string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	candidates := make([]weighted, 0, 4)
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if locale := NormalizeLocale(tag); locale != "" && q > 0 {
+			candidates = append(candidates, weighted{locale: locale, q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0].locale
+}
+
+// ResolveLocale 决定当前请求的语言：显式的 ?lang= 优先，其次是 Cookie 里记住的选择、
+// 账号设置，最后才看浏览器的 Accept-Language。
+func ResolveLocale(c *gin.Context) string {
+	if locale := NormalizeLocale(c.Query(LocaleQueryParam)); locale != "" {
+		return locale
+	}
+	if cookie, err := c.Cookie(localeCookieName); err == nil {
+		if locale := NormalizeLocale(cookie); locale != "" {
+			return locale
+		}
+	}
+	if user, exists := c.Get("user_info"); exists {
+		if preferrer, ok := user.(LocalePreferrer); ok {
+			if locale := NormalizeLocale(preferrer.PreferredLocale()); locale != "" {
+				return locale
+			}
+		}
+	}
+	if locale := ParseAcceptLanguage(c.GetHeader("Accept-Language")); locale != "" {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// Locale 解析当前请求的语言写进上下文。带 ?lang= 访问时把选择记进 Cookie，
+// 之后站内普通链接不带参数也能保持同一种语言。需要挂在 identity.LoadUser 之后才能读到账号设置。
+func Locale(secureCookie bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/static/") || strings.HasPrefix(c.Request.URL.Path, "/api/proxy/image/") {
+			c.Next()
+			return
+		}
+		locale := ResolveLocale(c)
+		if explicit := NormalizeLocale(c.Query(LocaleQueryParam)); explicit != "" {
+			RememberLocale(c, explicit, secureCookie)
+		}
+		c.Set(LocaleContextKey, locale)
+		c.Header("Content-Language", locale)
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		c.Next()
+	}
+}
+
+// RememberLocale 把语言选择写进 Cookie；locale 为空时清掉 Cookie，回到账号设置和浏览器语言。
+func RememberLocale(c *gin.Context, locale string, secureCookie bool) {
+	if locale = NormalizeLocale(locale); locale == "" {
+		c.SetCookie(localeCookieName, "", -1, "/", "", secureCookie, false)
+		return
+	}
+	c.SetCookie(localeCookieName, locale, localeCookieAge, "/", "", secureCookie, false)
+}
+
+// CurrentLocale 返回中间件解析好的语言；没挂中间件时按默认语言处理。
+func CurrentLocale(c *gin.Context) string {
+	if value, exists := c.Get(LocaleContextKey); exists {
+		if locale, ok := value.(string); ok && locale != "" {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
+
+// LocalizedPath 给站内路径加上语言参数。默认语言不带参数，保持现有 URL 不变。
+func LocalizedPath(path, locale string) string {
+	parsed, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	query := parsed.Query()
+	query.Del(LocaleQueryParam)
+	if locale = NormalizeLocale(locale); locale != "" && locale != DefaultLocale {
+		query.Set(LocaleQueryParam, locale)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// LocaleSwitchPath 是语言切换链接：总是带上 ?lang=，切回默认语言时也要覆盖 Cookie 里记住的选择。
+func LocaleSwitchPath(path, locale string) string {
+	parsed, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	query := parsed.Query()
+	query.Set(LocaleQueryParam, locale)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// Alternates 生成某个路径在各语言下的 hreflang 链接，x-default 指向默认语言。
+func Alternates(siteURL, path string) []Alternate {
+	alternates := make([]Alternate, 0, len(SupportedLocales)+1)
+	for _, locale := range SupportedLocales {
+		alternates = append(alternates, Alternate{Hreflang: locale, Href: CanonicalURL(siteURL, LocalizedPath(path, locale))})
+	}
+	return append(alternates, Alternate{Hreflang: "x-default", Href: CanonicalURL(siteURL, LocalizedPath(path, DefaultLocale))})
+}
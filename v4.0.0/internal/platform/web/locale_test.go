@@ -0,0 +1,84 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type localeUserStub string
+
+func (user localeUserStub) PreferredLocale() string { return string(user) }
+
+func TestParseAcceptLanguageHonoursWeights(t *testing.T) {
+	for header, want := range map[string]string{
+		"en-US,en;q=0.9,zh-CN;q=0.8": "en",
+		"fr-FR,zh-TW;q=0.7,en;q=0.5": "zh-CN",
+		"en;q=0.3, zh;q=0.9":         "zh-CN",
+		"fr, de;q=0.5":               "",
+		"en;q=0, zh;q=bogus":         "",
+		"":                           "",
+	} {
+		if got := ParseAcceptLanguage(header); got != want {
+			t.Errorf("ParseAcceptLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestLocaleMiddlewareResolvesQueryCookieUserAndHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resolve := func(target, cookie, accept string, user any) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if user != nil {
+				c.Set("user_info", user)
+			}
+		}, Locale(false))
+		router.GET("/movie/1", func(c *gin.Context) { c.String(http.StatusOK, CurrentLocale(c)) })
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != "" {
+			request.AddCookie(&http.Cookie{Name: localeCookieName, Value: cookie})
+		}
+		request.Header.Set("Accept-Language", accept)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	explicit := resolve("/movie/1?lang=en-GB", "zh-CN", "zh-CN", localeUserStub("zh-CN"))
+	if explicit.Body.String() != "en" || !strings.Contains(explicit.Header().Get("Set-Cookie"), "lang=en") || explicit.Header().Get("Content-Language") != "en" {
+		t.Fatalf("explicit query = %q, headers = %v", explicit.Body.String(), explicit.Header())
+	}
+	if got := resolve("/movie/1", "en", "zh-CN", localeUserStub("zh-CN")); got.Body.String() != "en" || got.Header().Get("Set-Cookie") != "" {
+		t.Fatalf("cookie should win over account and browser: %q", got.Body.String())
+	}
+	if got := resolve("/movie/1", "", "zh-CN", localeUserStub("en")); got.Body.String() != "en" {
+		t.Fatalf("account setting should win over browser: %q", got.Body.String())
+	}
+	if got := resolve("/movie/1", "", "en-US,en;q=0.9", localeUserStub("")); got.Body.String() != "en" || got.Header().Get("Vary") != "Accept-Language" {
+		t.Fatalf("browser language = %q, vary = %q", got.Body.String(), got.Header().Get("Vary"))
+	}
+	if got := resolve("/movie/1?lang=fr", "", "fr", nil); got.Body.String() != DefaultLocale {
+		t.Fatalf("unsupported language = %q", got.Body.String())
+	}
+}
+
+func TestLocalizedLinksAndTranslations(t *testing.T) {
+	if got := LocalizedPath("/search?kw=%E6%B5%81%E6%B5%AA&lang=en", DefaultLocale); got != "/search?kw=%E6%B5%81%E6%B5%AA" {
+		t.Fatalf("default locale path = %q", got)
+	}
+	if got := LocaleSwitchPath("/movie/1", DefaultLocale); got != "/movie/1?lang=zh-CN" {
+		t.Fatalf("switching back to Chinese must override the cookie: %q", got)
+	}
+	alternates := Alternates("https://moovie.example/", "/movie/1")
+	if len(alternates) != 3 || alternates[1].Href != "https://moovie.example/movie/1?lang=en" || alternates[2].Hreflang != "x-default" || alternates[2].Href != "https://moovie.example/movie/1" {
+		t.Fatalf("alternates = %+v", alternates)
+	}
+	translate := templateFunctions()["t"].(func(any, string) string)
+	if translate("en", "首页") != "Home" || translate(nil, "首页") != "首页" || translate("en", "没有译文的文案") != "没有译文的文案" {
+		t.Fatal("template translation fallback changed")
+	}
+}
@@ -0,0 +1,56 @@
+package web
+
+// messages 是界面文案的译文表，键就是模板里原本的中文文案。没有译文的文案原样输出，
+// 所以中文页面不依赖这张表，漏翻的词也只是在英文页面上显示中文。
+var messages = map[string]map[string]string{
+	"en": {
+		"发现你的下一部电影": "Find your next movie",
+		"首页":        "Home",
+		"热门好片":      "Popular",
+		"搜索趋势":      "Trending searches",
+		"为你推荐":      "For you",
+		"片场":        "Community",
+		"M3U8 播放器":  "M3U8 player",
+		"IPTV 直播":   "Live TV",
+		"建议反馈":      "Feedback",
+		"TVBox 配置":  "TVBox setup",
+		"关于本站":      "About",
+		"广告合作":      "Advertise",
+		"切换外观":      "Toggle theme",
+		"管理后台":      "Admin",
+		"通知":        "Notifications",
+		"登录 / 注册":   "Sign in / Sign up",
+		"关于我们":      "About us",
+		"反馈建议":      "Feedback",
+		"更新记录":      "Changelog",
+		"隐私政策":      "Privacy",
+		"服务协议":      "Terms",
+		"网站地图":      "Sitemap",
+		"本站不存储任何视频文件，仅提供搜索服务。": "This site stores no video files and only provides search.",
+		"语言":    "Language",
+		"剧情简介":  "Synopsis",
+		"跟随浏览器": "Follow browser",
+	},
+}
+
+// localeNames 是语言切换菜单里显示的名称，用各自的语言书写。
+var localeNames = map[string]string{
+	DefaultLocale: "简体中文",
+	"en":          "English",
+}
+
+// Translate 返回文案在指定语言下的译文，找不到时返回原文。
+func Translate(locale, text string) string {
+	if translated, ok := messages[NormalizeLocale(locale)][text]; ok {
+		return translated
+	}
+	return text
+}
+
+// LocaleName 返回语言的自称，未知语言原样返回。
+func LocaleName(locale string) string {
+	if name, ok := localeNames[locale]; ok {
+		return name
+	}
+	return locale
+}
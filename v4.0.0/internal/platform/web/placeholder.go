@@ -0,0 +1,67 @@
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"image/png"
+	"regexp"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/blurhash"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/cache"
+)
+
+// hexColorPattern 只放行 worker 写进库的 #rrggbb 格式，颜色会被原样拼进 style 属性。
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+// cssVariablePattern 限制 accentStyle 只能写自定义属性，不能借机写任意 CSS。
+var cssVariablePattern = regexp.MustCompile(`^--[a-z][a-z0-9-]*$`)
+
+// placeholderImages 缓存 BlurHash 解码出的 data URI。同一张海报会出现在很多页面上，
+// 每次渲染都重新解码、编码 PNG 不划算。
+var placeholderImages = cache.New[string](4096, 24*time.Hour)
+
+// placeholderStyle 生成图片容器的占位背景：先铺主色，再叠 BlurHash 解码出的模糊小图，
+// 真图加载出来后盖在上面。两样都没有时返回空串，容器保持原来的样式。
+func placeholderStyle(hash, color string) template.CSS {
+	style := ""
+	if hexColorPattern.MatchString(color) {
+		style = "background-color:" + color + ";"
+	}
+	if uri := placeholderDataURI(hash); uri != "" {
+		style += "background-image:url(" + uri + ");background-size:cover;background-position:center;"
+	}
+	return template.CSS(style) // #nosec G203 -- 颜色经过正则校验，图片是本进程编码的 base64 data URI。
+}
+
+// accentStyle 把强调色写成 CSS 变量，供详情页的按钮、评分等点缀元素取用。
+func accentStyle(name, color string) template.CSS {
+	if !hexColorPattern.MatchString(color) || !cssVariablePattern.MatchString(name) {
+		return ""
+	}
+	return template.CSS(name + ":" + color + ";") // #nosec G203 -- 变量名和颜色都经过正则校验。
+}
+
+// placeholderDataURI 把 BlurHash 解码成 PNG data URI。尺寸按分量数取，每个分量 4 像素，
+// 浏览器拉伸后本来就是模糊的，再大只会让 HTML 变胖。
+func placeholderDataURI(hash string) string {
+	xComponents, yComponents, err := blurhash.Components(hash)
+	if err != nil {
+		return ""
+	}
+	if uri, ok := placeholderImages.Get(hash); ok {
+		return uri
+	}
+	decoded, err := blurhash.Decode(hash, xComponents*4, yComponents*4, 1)
+	if err != nil {
+		return ""
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, decoded); err != nil {
+		return ""
+	}
+	uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(encoded.Bytes())
+	placeholderImages.Set(hash, uri)
+	return uri
+}
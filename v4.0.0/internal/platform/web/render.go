@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"html/template"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -84,7 +85,15 @@ func (r Renderer) Instance(name string, data any) render.Render {
 	}
 }
 
-// templateFunctions 注册模板里可用的辅助函数（图片代理、数字运算、JSON 处理等）。
+// proxyImageURL 把外站图片改写成本站图片代理地址，站内地址原样返回。
+func proxyImageURL(value string) string {
+	if value == "" || strings.HasPrefix(value, "/api/proxy/image") || strings.HasPrefix(value, "/static/") {
+		return value
+	}
+	return "/api/proxy/image/r76RqSIVvUryzx" + base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// templateFunctions 注册模板里可用的辅助函数（图片代理、数字运算、JSON 处理、界面翻译等）。
 func templateFunctions() template.FuncMap {
 	return template.FuncMap{
 		"jsonUnmarshal": func(value string) []any {
@@ -92,12 +101,18 @@ func templateFunctions() template.FuncMap {
 			_ = json.Unmarshal([]byte(value), &decoded)
 			return decoded
 		},
-		"proxyImg": func(value string) string {
-			if value == "" || strings.HasPrefix(value, "/api/proxy/image") || strings.HasPrefix(value, "/static/") {
-				return value
+		"proxyImg": proxyImageURL,
+		// proxyImgW 额外带上 ?w=，让图片代理返回缩小后的变体（海报墙、相似推荐这类小图）。
+		"proxyImgW": func(width int, value string) string {
+			proxied := proxyImageURL(value)
+			if width <= 0 || !strings.HasPrefix(proxied, "/api/proxy/image/") || strings.Contains(proxied, "?") {
+				return proxied
 			}
-			return "/api/proxy/image/r76RqSIVvUryzx" + base64.RawURLEncoding.EncodeToString([]byte(value))
+			return proxied + "?w=" + strconv.Itoa(width)
 		},
+		// placeholderStyle、accentStyle 把 worker 算好的 BlurHash 和主色变成内联样式，见 placeholder.go。
+		"placeholderStyle": placeholderStyle,
+		"accentStyle":      accentStyle,
 		"default": func(fallback, value any) any {
 			switch typed := value.(type) {
 			case string:
@@ -182,6 +197,13 @@ func templateFunctions() template.FuncMap {
 			}
 			return strings.Join(names, " / ")
 		},
+		// t 翻译界面文案。locale 用 any 接收：少数页面不经过 NewData，拿到的是 nil，按默认语言处理。
+		"t": func(locale any, text string) string {
+			value, _ := locale.(string)
+			return Translate(value, text)
+		},
+		"localeName":       LocaleName,
+		"localeSwitchPath": LocaleSwitchPath,
 		"dict": func(values ...any) (map[string]any, error) {
 			if len(values)%2 != 0 {
 				return nil, fmt.Errorf("dict requires key/value pairs")
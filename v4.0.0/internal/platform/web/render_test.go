@@ -136,3 +136,22 @@ func writeTestFile(t *testing.T, path, contents string) {
 		t.Fatal(err)
 	}
 }
+
+func TestPlaceholderStyleValidatesPaletteValues(t *testing.T) {
+	placeholder := templateFunctions()["placeholderStyle"].(func(string, string) template.CSS)
+	style := string(placeholder("LEHV6nWB2yk8pyo0adR*.7kCMdnj", "#1a2b3c"))
+	if !strings.HasPrefix(style, "background-color:#1a2b3c;background-image:url(data:image/png;base64,") {
+		t.Fatalf("placeholder style = %q", style)
+	}
+	// 库里的值被改坏了也不能借 style 属性注入 CSS。
+	if got := placeholder("not a hash", "red;background:url(//evil)"); got != "" {
+		t.Fatalf("invalid palette style = %q", got)
+	}
+	accent := templateFunctions()["accentStyle"].(func(string, string) template.CSS)
+	if got := accent("--movie-accent", "#e02020"); got != "--movie-accent:#e02020;" {
+		t.Fatalf("accent style = %q", got)
+	}
+	if got := accent("color", "#e02020"); got != "" {
+		t.Fatalf("accent style may only set custom properties: %q", got)
+	}
+}
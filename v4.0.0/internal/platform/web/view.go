@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"net/url"
 	"strings"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
@@ -27,7 +28,7 @@ type Metadata struct {
 	JSONLD      []template.JS
 }
 
-// ViewModel 是所有页面共享的基础渲染数据（站点信息、当前路径、登录用户、导航高亮）。
+// ViewModel 是所有页面共享的基础渲染数据（站点信息、当前路径、登录用户、导航高亮、界面语言）。
 type ViewModel struct {
 	Metadata
 	SiteName     string
@@ -41,6 +42,8 @@ type ViewModel struct {
 	UserInfo     any
 	Keyword      string
 	Bypass       bool
+	Locale       string
+	Alternates   []Alternate
 }
 
 // NewViewModel 从当前请求构造基础视图模型，Robots 默认允许收录。
@@ -56,6 +59,18 @@ func NewViewModel(c *gin.Context, cfg config.Config, metadata Metadata) ViewMode
 		FullPath:   c.Request.RequestURI,
 		Referer:    c.Request.Referer(),
 		ActiveMenu: ActiveMenu(c.Request.URL.Path, c.Query("type")),
+		Locale:     CurrentLocale(c),
+	}
+	// 规范链接指向当前语言的版本，hreflang 也从规范路径生成，带上 ?kw= 这类有意义的参数。
+	// 页面没给规范链接时退回请求路径。
+	path := c.Request.URL.Path
+	if view.Canonical != "" {
+		path = canonicalPath(view.Canonical, path)
+		view.Canonical = CanonicalURL(cfg.SiteURL, LocalizedPath(path, view.Locale))
+	}
+	// 不收录的页面（后台、个人中心）不需要 hreflang。
+	if !strings.Contains(metadata.Robots, "noindex") {
+		view.Alternates = Alternates(cfg.SiteURL, path)
 	}
 	if user, exists := c.Get("user_info"); exists {
 		view.UserInfo = user
@@ -71,7 +86,7 @@ func NewData(c *gin.Context, cfg config.Config, metadata Metadata, extra gin.H)
 		"Robots": view.Robots, "Canonical": view.Canonical, "Cover": view.Cover, "JSONLD": view.JSONLD,
 		"SiteName": view.SiteName, "SiteUrl": view.SiteUrl, "Path": view.Path,
 		"FullPath": view.FullPath, "Referer": view.Referer, "ActiveMenu": view.ActiveMenu,
-		"UserInfo": view.UserInfo,
+		"UserInfo": view.UserInfo, "Locale": view.Locale, "Locales": SupportedLocales, "Alternates": view.Alternates,
 	}
 	for key, value := range extra {
 		data[key] = value
@@ -84,6 +99,15 @@ func CanonicalURL(siteURL, path string) string {
 	return strings.TrimRight(siteURL, "/") + "/" + strings.TrimLeft(path, "/")
 }
 
+// canonicalPath 从规范链接里取出站内路径和查询参数，解析不了时退回 fallback。
+func canonicalPath(canonical, fallback string) string {
+	parsed, err := url.Parse(canonical)
+	if err != nil {
+		return fallback
+	}
+	return parsed.RequestURI()
+}
+
 // JSONLD 把结构化数据序列化成可直接嵌入 <script> 的内容。
 func JSONLD(value any) (template.JS, error) {
 	encoded, err := json.Marshal(value)
@@ -114,7 +138,7 @@ func ActiveMenu(path, searchType string) string {
 		return "discover"
 	case "/trends":
 		return "trends"
-	case "/foryou":
+	case "/foryou", "/together":
 		return "foryou"
 	case "/cinema":
 		return "cinema"
@@ -1,6 +1,13 @@
 package web
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	"github.com/gin-gonic/gin"
+)
 
 func TestActiveMenuPreservesLegacyNavigationRules(t *testing.T) {
 	tests := []struct {
@@ -31,3 +38,29 @@ func TestActiveMenuPreservesLegacyNavigationRules(t *testing.T) {
 		}
 	}
 }
+
+func TestViewModelCanonicalAndAlternatesFollowLocaleAndCanonicalPath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	view := func(target string) ViewModel {
+		var model ViewModel
+		router := gin.New()
+		router.Use(Locale(false))
+		router.GET("/search", func(c *gin.Context) {
+			model = NewViewModel(c, config.Config{SiteURL: "https://moovie.example"}, Metadata{Canonical: "https://moovie.example/search?kw=%E6%B2%99%E4%B8%98"})
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+		return model
+	}
+	// 英文页的规范链接指向自己，不指回中文页；hreflang 保留 ?kw=，丢掉 utm 这类无关参数。
+	english := view("/search?kw=%E6%B2%99%E4%B8%98&lang=en&utm_source=feed")
+	if english.Canonical != "https://moovie.example/search?kw=%E6%B2%99%E4%B8%98&lang=en" {
+		t.Fatalf("english canonical = %q", english.Canonical)
+	}
+	if len(english.Alternates) != 3 || english.Alternates[0].Href != "https://moovie.example/search?kw=%E6%B2%99%E4%B8%98" ||
+		english.Alternates[1].Href != english.Canonical {
+		t.Fatalf("english alternates = %+v", english.Alternates)
+	}
+	if chinese := view("/search?kw=%E6%B2%99%E4%B8%98"); chinese.Canonical != "https://moovie.example/search?kw=%E6%B2%99%E4%B8%98" {
+		t.Fatalf("chinese canonical = %q", chinese.Canonical)
+	}
+}
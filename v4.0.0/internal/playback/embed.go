@@ -0,0 +1,353 @@
+package playback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/requestmeta"
+)
+
+// 嵌入链接的签发限制。
+const (
+	embedHourlyLimit    = 20
+	embedMaxOrigins     = 5
+	embedDefaultTTL     = 7 * 24 * time.Hour
+	embedMaxTTL         = 90 * 24 * time.Hour
+	embedMaxSources     = 5
+	embedDefaultWidth   = 640
+	embedDefaultHeight  = 360
+	embedTokenSignLabel = "moovie-embed-v1."
+)
+
+var errInvalidEmbedToken = errors.New("invalid embed token")
+
+// embedClaims 是嵌入令牌的载荷。令牌只证明「这条链接是本站签发的、还没过期」，
+// 允许嵌入的来源和观看计数以数据库为准，所以载荷里只放链接 ID。
+type embedClaims struct {
+	LinkID int64 `json:"lid"`
+	Expiry int64 `json:"exp"`
+}
+
+// signEmbedToken 用 AppSecret 签发嵌入令牌。签名内容带固定前缀，
+// 同一个密钥签出的登录 JWT 和嵌入令牌不能互相冒用。
+func signEmbedToken(claims embedClaims, secret string) (string, error) {
+	if claims.LinkID <= 0 || claims.Expiry == 0 || secret == "" {
+		return "", errInvalidEmbedToken
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(embedSignature(encoded, secret)), nil
+}
+
+// parseEmbedToken 校验签名和有效期。
+func parseEmbedToken(token, secret string, now time.Time) (embedClaims, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || secret == "" {
+		return embedClaims{}, errInvalidEmbedToken
+	}
+	expected, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, embedSignature(encoded, secret)) {
+		return embedClaims{}, errInvalidEmbedToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return embedClaims{}, errInvalidEmbedToken
+	}
+	var claims embedClaims
+	if json.Unmarshal(payload, &claims) != nil || claims.LinkID <= 0 || claims.Expiry <= now.Unix() {
+		return embedClaims{}, errInvalidEmbedToken
+	}
+	return claims, nil
+}
+
+// embedSignature 计算 HMAC-SHA256 签名。
+func embedSignature(encoded, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(embedTokenSignLabel + encoded))
+	return mac.Sum(nil)
+}
+
+// normalizeEmbedOrigin 把用户填写的来源规范成 scheme://host[:port]。
+// 只接受 http/https，不接受路径、账号信息和通配符：frame-ancestors 按来源匹配，多写的部分没有意义。
+func normalizeEmbedOrigin(raw string) (string, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.User != nil || parsed.Host == "" || strings.Contains(parsed.Host, "*") {
+		return "", false
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", false
+	}
+	if (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", false
+	}
+	return parsed.Scheme + "://" + strings.ToLower(parsed.Host), true
+}
+
+// frameAncestors 生成嵌入页的 CSP：只有签发时登记的来源（和本站自己）能用 iframe 嵌入。
+func frameAncestors(origins []string) string {
+	return "frame-ancestors 'self' " + strings.Join(origins, " ")
+}
+
+// embedURL 返回嵌入页地址。
+func embedURL(baseURL, token string) string {
+	return baseURL + "/embed/" + token
+}
+
+// embedIframe 生成给第三方页面粘贴的 iframe 代码。
+func embedIframe(src, title string, width, height int) string {
+	return fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" title="%s" frameborder="0" allow="autoplay; fullscreen; picture-in-picture" allowfullscreen></iframe>`,
+		html.EscapeString(src), width, height, html.EscapeString(title))
+}
+
+// embedTitle 是嵌入页和 oEmbed 使用的标题。
+func embedTitle(link EmbedLink) string {
+	if link.EpisodeKey == "" {
+		return link.MediaTitle
+	}
+	return link.MediaTitle + " " + link.EpisodeKey
+}
+
+// embedLinkRequest 是签发嵌入链接的请求体。
+type embedLinkRequest struct {
+	MediaUnitID    int      `json:"media_unit_id"`
+	AllowedOrigins []string `json:"allowed_origins"`
+	TTLHours       int      `json:"ttl_hours"`
+}
+
+// createEmbedLinkV2 给登录用户签发一条指向某一集的嵌入链接。
+// 必须登记允许嵌入的来源，每人每小时最多签发 embedHourlyLimit 条。
+func (handler *Handler) createEmbedLinkV2(c *gin.Context) {
+	if handler.embeds == nil {
+		apiError(c, http.StatusServiceUnavailable, "嵌入服务暂时不可用")
+		return
+	}
+	var request embedLinkRequest
+	if c.ShouldBindJSON(&request) != nil || request.MediaUnitID <= 0 {
+		apiError(c, http.StatusBadRequest, "嵌入参数错误")
+		return
+	}
+	origins := make([]string, 0, len(request.AllowedOrigins))
+	for _, raw := range request.AllowedOrigins {
+		origin, ok := normalizeEmbedOrigin(raw)
+		if !ok {
+			apiError(c, http.StatusBadRequest, "来源格式错误："+raw)
+			return
+		}
+		if !slices.Contains(origins, origin) {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 || len(origins) > embedMaxOrigins {
+		apiError(c, http.StatusBadRequest, fmt.Sprintf("请填写 1~%d 个允许嵌入的来源", embedMaxOrigins))
+		return
+	}
+	ttl := embedDefaultTTL
+	if request.TTLHours > 0 {
+		ttl = min(time.Duration(request.TTLHours)*time.Hour, embedMaxTTL)
+	}
+	reader, ok := handler.episodes.(mediaidentity.UnitEpisodeReader)
+	if !ok {
+		apiError(c, http.StatusServiceUnavailable, "嵌入服务暂时不可用")
+		return
+	}
+	candidates, err := reader.ListUnitResourceCandidates(c.Request.Context(), request.MediaUnitID)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "获取播放候选失败")
+		return
+	}
+	if len(candidates) == 0 {
+		apiError(c, http.StatusNotFound, "这一集暂无可播放的资源")
+		return
+	}
+	link, err := handler.embeds.CreateEmbedLink(c.Request.Context(), EmbedLink{UserID: auth.UserID(c),
+		MediaUnitID: request.MediaUnitID, AllowedOrigins: origins, ExpiresAt: time.Now().Add(ttl)}, embedHourlyLimit)
+	if errors.Is(err, ErrEmbedQuotaExceeded) {
+		apiError(c, http.StatusTooManyRequests, "签发过于频繁，请稍后再试")
+		return
+	}
+	if err != nil {
+		requestmeta.Logger(c.Request.Context()).Error("create embed link failed", "media_unit_id", request.MediaUnitID, "error", err)
+		apiError(c, http.StatusInternalServerError, "签发嵌入链接失败")
+		return
+	}
+	token, err := signEmbedToken(embedClaims{LinkID: link.ID, Expiry: link.ExpiresAt.Unix()}, handler.config.AppSecret)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "签发嵌入链接失败")
+		return
+	}
+	src := embedURL(requestBaseURL(c), token)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"id": link.ID, "token": token, "embed_url": src, "allowed_origins": link.AllowedOrigins,
+		"expires_at": link.ExpiresAt, "html": embedIframe(src, handler.config.SiteName, embedDefaultWidth, embedDefaultHeight),
+	}})
+}
+
+// listEmbedLinksV2 返回当前用户签发的嵌入链接及观看次数。
+func (handler *Handler) listEmbedLinksV2(c *gin.Context) {
+	if handler.embeds == nil {
+		apiError(c, http.StatusServiceUnavailable, "嵌入服务暂时不可用")
+		return
+	}
+	links, err := handler.embeds.ListEmbedLinks(c.Request.Context(), auth.UserID(c), 50)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "获取嵌入链接失败")
+		return
+	}
+	items := make([]gin.H, 0, len(links))
+	var totalViews int64
+	for _, link := range links {
+		totalViews += link.ViewCount
+		item := gin.H{"id": link.ID, "media_unit_id": link.MediaUnitID, "title": embedTitle(link),
+			"allowed_origins": link.AllowedOrigins, "view_count": link.ViewCount,
+			"expires_at": link.ExpiresAt, "created_at": link.CreatedAt, "last_viewed_at": nil}
+		if !link.LastViewedAt.IsZero() {
+			item["last_viewed_at"] = link.LastViewedAt
+		}
+		items = append(items, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"links": items, "total_views": totalViews}})
+}
+
+// embed 渲染嵌入播放页。令牌无效、过期或链接不存在一律 404，不区分原因；
+// 页面只允许签发时登记的来源嵌入，并按 IP 限流，防止被当成免费播放器批量盗链。
+func (handler *Handler) embed(c *gin.Context) {
+	if !handler.embedLimiter.Allow(c.ClientIP()) {
+		c.String(http.StatusTooManyRequests, "请求过于频繁")
+		return
+	}
+	claims, err := parseEmbedToken(c.Param("token"), handler.config.AppSecret, time.Now())
+	if err != nil || handler.embeds == nil {
+		c.String(http.StatusNotFound, "嵌入链接无效或已过期")
+		return
+	}
+	link, err := handler.embeds.RecordEmbedView(c.Request.Context(), claims.LinkID)
+	if errors.Is(err, ErrEmbedLinkNotFound) {
+		c.String(http.StatusNotFound, "嵌入链接无效或已过期")
+		return
+	}
+	if err != nil {
+		requestmeta.Logger(c.Request.Context()).Error("open embed link failed", "embed_link_id", claims.LinkID, "error", err)
+		c.String(http.StatusInternalServerError, "加载失败")
+		return
+	}
+	sources := []string{}
+	if reader, ok := handler.episodes.(mediaidentity.UnitEpisodeReader); ok {
+		candidates, err := reader.ListUnitResourceCandidates(c.Request.Context(), link.MediaUnitID)
+		if err != nil {
+			requestmeta.Logger(c.Request.Context()).Warn("list embed candidates failed", "media_unit_id", link.MediaUnitID, "error", err)
+		}
+		for _, source := range handler.rankUnitCandidates(c, candidates, link.MediaUnitID) {
+			if len(sources) == embedMaxSources {
+				break
+			}
+			if !source.Incompatible {
+				sources = append(sources, source.PlayURL)
+			}
+		}
+	}
+	// 全站默认 X-Frame-Options: DENY，嵌入页改由 CSP frame-ancestors 精确放行。
+	c.Writer.Header().Del("X-Frame-Options")
+	c.Header("Content-Security-Policy", frameAncestors(link.AllowedOrigins))
+	c.Header("Cache-Control", "private, no-store")
+	c.HTML(http.StatusOK, "player_embed.html", gin.H{
+		"Title":    embedTitle(link),
+		"Sources":  sources,
+		"WatchURL": strings.TrimRight(handler.config.SiteURL, "/") + "/watch/" + url.PathEscape(watchKey(link.DoubanID, link.MediaID)),
+	})
+}
+
+// oEmbed 实现 oEmbed 协议（https://oembed.com）。/watch/:douban_id 返回 link 类型的标题和封面，
+// 供聊天软件、论坛生成预览卡片；/embed/:token 返回 video 类型和 iframe 代码。
+// 本站不会替匿名调用方签发嵌入令牌，需要播放器的请先由登录用户签发嵌入链接。
+func (handler *Handler) oEmbed(c *gin.Context) {
+	if format := c.DefaultQuery("format", "json"); format != "json" {
+		apiError(c, http.StatusNotImplemented, "只支持 JSON 格式")
+		return
+	}
+	target, err := url.Parse(strings.TrimSpace(c.Query("url")))
+	if err != nil || !handler.isOwnHost(c, target.Host) {
+		apiError(c, http.StatusNotFound, "不支持的地址")
+		return
+	}
+	baseURL := requestBaseURL(c)
+	response := gin.H{"version": "1.0", "provider_name": handler.config.SiteName, "provider_url": baseURL}
+	switch segments := strings.Split(strings.Trim(target.Path, "/"), "/"); {
+	case len(segments) == 2 && segments[0] == "watch" && segments[1] != "":
+		if handler.media == nil {
+			apiError(c, http.StatusNotFound, "影片不存在")
+			return
+		}
+		media, err := handler.findWatchMedia(c.Request.Context(), segments[1])
+		if err != nil || media.ID <= 0 {
+			apiError(c, http.StatusNotFound, "影片不存在")
+			return
+		}
+		response["type"] = "link"
+		response["title"] = media.Title
+		if media.Poster != "" {
+			response["thumbnail_url"] = baseURL + proxyImagePath(media.Poster)
+		}
+	case len(segments) == 2 && segments[0] == "embed":
+		claims, err := parseEmbedToken(segments[1], handler.config.AppSecret, time.Now())
+		if err != nil || handler.embeds == nil {
+			apiError(c, http.StatusNotFound, "嵌入链接无效或已过期")
+			return
+		}
+		link, err := handler.embeds.FindEmbedLink(c.Request.Context(), claims.LinkID)
+		if err != nil {
+			apiError(c, http.StatusNotFound, "嵌入链接无效或已过期")
+			return
+		}
+		width, height := oEmbedSize(c.Query("maxwidth"), c.Query("maxheight"))
+		response["type"] = "video"
+		response["title"] = embedTitle(link)
+		response["width"], response["height"] = width, height
+		response["html"] = embedIframe(embedURL(baseURL, segments[1]), embedTitle(link), width, height)
+	default:
+		apiError(c, http.StatusNotFound, "不支持的地址")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// isOwnHost 判断 oEmbed 请求的地址是否属于本站（当前访问域名或配置的站点域名）。
+func (handler *Handler) isOwnHost(c *gin.Context, host string) bool {
+	if host == "" {
+		return false
+	}
+	if strings.EqualFold(host, c.Request.Host) {
+		return true
+	}
+	site, err := url.Parse(handler.config.SiteURL)
+	return err == nil && site.Host != "" && strings.EqualFold(host, site.Host)
+}
+
+// oEmbedSize 在调用方给的最大宽高内按 16:9 缩放播放器。
+func oEmbedSize(maxWidth, maxHeight string) (int, int) {
+	width, height := embedDefaultWidth, embedDefaultHeight
+	if limit, err := strconv.Atoi(maxWidth); err == nil && limit > 0 && limit < width {
+		width, height = limit, limit*9/16
+	}
+	if limit, err := strconv.Atoi(maxHeight); err == nil && limit > 0 && limit < height {
+		width, height = limit*16/9, limit
+	}
+	return width, height
+}
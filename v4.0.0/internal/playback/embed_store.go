@@ -0,0 +1,147 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+)
+
+// 嵌入链接存储返回的业务错误。
+var (
+	ErrEmbedLinkNotFound  = errors.New("embed link not found or expired")
+	ErrEmbedQuotaExceeded = errors.New("embed link quota exceeded")
+)
+
+// EmbedLink 是签发给某个用户的一条嵌入链接。MediaID、MediaTitle、DoubanID、EpisodeKey
+// 只在读取时由作品和剧集表补齐，用于嵌入页标题、站内播放链接和 oEmbed 响应。
+type EmbedLink struct {
+	ID             int64
+	UserID         int
+	MediaUnitID    int
+	AllowedOrigins []string
+	ExpiresAt      time.Time
+	ViewCount      int64
+	LastViewedAt   time.Time
+	CreatedAt      time.Time
+	MediaID        int
+	MediaTitle     string
+	DoubanID       string
+	EpisodeKey     string
+}
+
+// EmbedStore 读写嵌入链接。
+type EmbedStore interface {
+	// CreateEmbedLink 写入一条链接；该用户最近一小时签发数已达 hourlyLimit 时返回 ErrEmbedQuotaExceeded。
+	CreateEmbedLink(ctx context.Context, link EmbedLink, hourlyLimit int) (EmbedLink, error)
+	// FindEmbedLink 读取未过期的链接，不计观看次数。
+	FindEmbedLink(ctx context.Context, id int64) (EmbedLink, error)
+	// RecordEmbedView 给未过期的链接记一次观看并返回链接。
+	RecordEmbedView(ctx context.Context, id int64) (EmbedLink, error)
+	// ListEmbedLinks 返回用户签发过的链接，新的在前。
+	ListEmbedLinks(ctx context.Context, userID int, limit int) ([]EmbedLink, error)
+}
+
+// PostgresEmbedStore 是 EmbedStore 的 PostgreSQL 实现。
+type PostgresEmbedStore struct {
+	database database.Executor
+}
+
+// NewEmbedStore 创建嵌入链接存储。
+func NewEmbedStore(db database.Executor) *PostgresEmbedStore {
+	return &PostgresEmbedStore{database: db}
+}
+
+// CreateEmbedLink 在同一条语句里检查配额并写入，并发签发最多多出几条，不会绕过限制太多。
+func (store *PostgresEmbedStore) CreateEmbedLink(ctx context.Context, link EmbedLink, hourlyLimit int) (EmbedLink, error) {
+	err := store.database.QueryRow(ctx, `INSERT INTO embed_links (user_id, media_unit_id, allowed_origins, expires_at)
+SELECT $1, $2, $3::text[], $4
+WHERE (SELECT COUNT(*) FROM embed_links WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 hour') < $5
+RETURNING id, created_at`, link.UserID, link.MediaUnitID, link.AllowedOrigins, link.ExpiresAt, hourlyLimit).
+		Scan(&link.ID, &link.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return EmbedLink{}, ErrEmbedQuotaExceeded
+	}
+	if err != nil {
+		return EmbedLink{}, fmt.Errorf("create embed link: %w", err)
+	}
+	return link, nil
+}
+
+// FindEmbedLink 读取未过期的链接。
+func (store *PostgresEmbedStore) FindEmbedLink(ctx context.Context, id int64) (EmbedLink, error) {
+	return store.scanEmbedLink(store.database.QueryRow(ctx, `SELECT `+embedLinkColumns+`
+FROM embed_links link
+JOIN media_units unit ON unit.id = link.media_unit_id
+JOIN media ON media.id = unit.media_id
+WHERE link.id = $1 AND link.expires_at > NOW()`, id))
+}
+
+// RecordEmbedView 累加观看次数。过期链接不计数，直接按不存在处理。
+func (store *PostgresEmbedStore) RecordEmbedView(ctx context.Context, id int64) (EmbedLink, error) {
+	return store.scanEmbedLink(store.database.QueryRow(ctx, `WITH link AS (
+    UPDATE embed_links SET view_count = view_count + 1, last_viewed_at = NOW()
+    WHERE id = $1 AND expires_at > NOW()
+    RETURNING *
+)
+SELECT `+embedLinkColumns+`
+FROM link
+JOIN media_units unit ON unit.id = link.media_unit_id
+JOIN media ON media.id = unit.media_id`, id))
+}
+
+// ListEmbedLinks 返回用户签发的链接（含已过期的），供用户查看各自的观看次数。
+func (store *PostgresEmbedStore) ListEmbedLinks(ctx context.Context, userID int, limit int) ([]EmbedLink, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	rows, err := store.database.Query(ctx, `SELECT `+embedLinkColumns+`
+FROM embed_links link
+JOIN media_units unit ON unit.id = link.media_unit_id
+JOIN media ON media.id = unit.media_id
+WHERE link.user_id = $1
+ORDER BY link.created_at DESC, link.id DESC
+LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list embed links: %w", err)
+	}
+	defer rows.Close()
+	links := []EmbedLink{}
+	for rows.Next() {
+		link, err := store.scanEmbedLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate embed links: %w", err)
+	}
+	return links, nil
+}
+
+// embedLinkColumns 是三个读取方法共用的列，顺序与 scanEmbedLink 一致。
+const embedLinkColumns = `link.id, link.user_id, link.media_unit_id, link.allowed_origins, link.expires_at,
+link.view_count, link.last_viewed_at, link.created_at, media.id, media.title, media.douban_id, unit.episode_key`
+
+// scanEmbedLink 扫描一行嵌入链接，没有结果时返回 ErrEmbedLinkNotFound。
+func (store *PostgresEmbedStore) scanEmbedLink(row database.Row) (EmbedLink, error) {
+	var link EmbedLink
+	var lastViewedAt *time.Time
+	err := row.Scan(&link.ID, &link.UserID, &link.MediaUnitID, &link.AllowedOrigins, &link.ExpiresAt,
+		&link.ViewCount, &lastViewedAt, &link.CreatedAt, &link.MediaID, &link.MediaTitle, &link.DoubanID, &link.EpisodeKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return EmbedLink{}, ErrEmbedLinkNotFound
+	}
+	if err != nil {
+		return EmbedLink{}, fmt.Errorf("scan embed link: %w", err)
+	}
+	if lastViewedAt != nil {
+		link.LastViewedAt = *lastViewedAt
+	}
+	return link, nil
+}
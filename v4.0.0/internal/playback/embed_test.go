@@ -0,0 +1,151 @@
+package playback
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+)
+
+type embedStoreStub struct {
+	link  EmbedLink
+	views int
+}
+
+func (store *embedStoreStub) CreateEmbedLink(_ context.Context, link EmbedLink, _ int) (EmbedLink, error) {
+	link.ID = store.link.ID
+	return link, nil
+}
+
+func (store *embedStoreStub) FindEmbedLink(_ context.Context, id int64) (EmbedLink, error) {
+	if id != store.link.ID {
+		return EmbedLink{}, ErrEmbedLinkNotFound
+	}
+	return store.link, nil
+}
+
+func (store *embedStoreStub) RecordEmbedView(ctx context.Context, id int64) (EmbedLink, error) {
+	link, err := store.FindEmbedLink(ctx, id)
+	if err == nil {
+		store.views++
+	}
+	return link, err
+}
+
+func (store *embedStoreStub) ListEmbedLinks(context.Context, int, int) ([]EmbedLink, error) {
+	return []EmbedLink{store.link}, nil
+}
+
+func TestEmbedTokenRejectsTamperingExpiryAndOtherSecrets(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	token, err := signEmbedToken(embedClaims{LinkID: 42, Expiry: now.Add(time.Hour).Unix()}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := parseEmbedToken(token, "secret", now); err != nil || claims.LinkID != 42 {
+		t.Fatalf("claims/error = %#v/%v", claims, err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+	forged, _ := signEmbedToken(embedClaims{LinkID: 43, Expiry: now.Add(time.Hour).Unix()}, "other")
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	for name, candidate := range map[string]string{
+		"other secret":      forged,
+		"swapped payload":   forgedPayload + "." + signature,
+		"missing signature": payload,
+	} {
+		if _, err := parseEmbedToken(candidate, "secret", now); err == nil {
+			t.Fatalf("%s token accepted", name)
+		}
+	}
+	if _, err := parseEmbedToken(token, "secret", now.Add(2*time.Hour)); err == nil {
+		t.Fatal("expired token accepted")
+	}
+}
+
+func TestNormalizeEmbedOriginAcceptsOnlyBareOrigins(t *testing.T) {
+	for raw, want := range map[string]string{
+		" https://Blog.Example ":    "https://blog.example",
+		"http://blog.example:8080/": "http://blog.example:8080",
+		"https://blog.example/post": "",
+		"https://*.example":         "",
+		"javascript:alert(1)":       "",
+		"https://user@blog.example": "",
+		"blog.example":              "",
+	} {
+		got, ok := normalizeEmbedOrigin(raw)
+		if got != want || ok != (want != "") {
+			t.Fatalf("normalizeEmbedOrigin(%q) = %q/%v, want %q", raw, got, ok, want)
+		}
+	}
+}
+
+func TestEmbedPageAllowsOnlyRegisteredOriginsAndCountsViews(t *testing.T) {
+	store := &embedStoreStub{link: EmbedLink{ID: 7, MediaUnitID: 60, AllowedOrigins: []string{"https://blog.example"},
+		MediaTitle: "漫长的季节", DoubanID: "35588177", EpisodeKey: "S01E02"}}
+	reader := combinedEpisodeReader{byUnit: func(context.Context, int) ([]mediaidentity.ResourceCandidate, error) {
+		return []mediaidentity.ResourceCandidate{{Episode: mediaidentity.Episode{MediaUnitID: 60, SourceKey: "a", VodID: "1",
+			PlayURL: "https://cdn.example/a.m3u8"}}}, nil
+	}}
+	router, cfg := playbackTestRouter(t, nil, staticPopularProvider{}, WithEmbedStore(store), WithEpisodeReader(reader))
+	token, err := signEmbedToken(embedClaims{LinkID: 7, Expiry: time.Now().Add(time.Hour).Unix()}, cfg.AppSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := performRequest(router, "/embed/"+token, nil)
+	if recorder.Code != http.StatusOK || store.views != 1 {
+		t.Fatalf("embed status/views = %d/%d: %s", recorder.Code, store.views, recorder.Body.String())
+	}
+	if got := recorder.Header().Get("Content-Security-Policy"); got != "frame-ancestors 'self' https://blog.example" {
+		t.Fatalf("csp = %q", got)
+	}
+	body := recorder.Body.String()
+	for _, expected := range []string{"漫长的季节 S01E02", `const sources = ["https://cdn.example/a.m3u8"]`, "https://moovie.example/watch/35588177"} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("embed page missing %q: %s", expected, body)
+		}
+	}
+
+	if recorder := performRequest(router, "/embed/"+token+"x", nil); recorder.Code != http.StatusNotFound || store.views != 1 {
+		t.Fatalf("tampered embed status/views = %d/%d", recorder.Code, store.views)
+	}
+}
+
+func TestEmbedPageLinksMediaWithoutDoubanIDByMediaKey(t *testing.T) {
+	store := &embedStoreStub{link: EmbedLink{ID: 8, MediaUnitID: 61, MediaID: 9, MediaTitle: "只在TMDB的片", EpisodeKey: "正片"}}
+	router, cfg := playbackTestRouter(t, nil, staticPopularProvider{}, WithEmbedStore(store))
+	token, _ := signEmbedToken(embedClaims{LinkID: 8, Expiry: time.Now().Add(time.Hour).Unix()}, cfg.AppSecret)
+
+	recorder := performRequest(router, "/embed/"+token, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("embed status = %d: %s", recorder.Code, recorder.Body.String())
+	}
+	body := recorder.Body.String()
+	if !strings.Contains(body, "https://moovie.example/watch/m9") || strings.Contains(body, `/watch/"`) {
+		t.Fatalf("embed page watch link: %s", body)
+	}
+}
+
+func TestOEmbedDescribesSignedEmbedLinks(t *testing.T) {
+	store := &embedStoreStub{link: EmbedLink{ID: 7, MediaUnitID: 60, MediaTitle: "漫长的季节", EpisodeKey: "S01E02"}}
+	router, cfg := playbackTestRouter(t, nil, staticPopularProvider{}, WithEmbedStore(store))
+	token, _ := signEmbedToken(embedClaims{LinkID: 7, Expiry: time.Now().Add(time.Hour).Unix()}, cfg.AppSecret)
+
+	payload := decodeJSON(t, performRequest(router, "/api/oembed?maxwidth=320&url=https%3A%2F%2Fmoovie.example%2Fembed%2F"+token, nil))
+	if payload["type"] != "video" || payload["width"] != float64(320) || payload["height"] != float64(180) ||
+		!strings.Contains(payload["html"].(string), `src="http://example.com/embed/`+token+`"`) {
+		t.Fatalf("oembed payload = %#v", payload)
+	}
+	if store.views != 0 {
+		t.Fatalf("oembed counted %d views", store.views)
+	}
+	if recorder := performRequest(router, "/api/oembed?url=https%3A%2F%2Felsewhere.example%2Fembed%2F"+token, nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("foreign oembed status = %d", recorder.Code)
+	}
+	if recorder := performRequest(router, "/api/oembed?format=xml&url=https%3A%2F%2Fmoovie.example%2Fwatch%2F1", nil); recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("xml oembed status = %d", recorder.Code)
+	}
+}
@@ -9,11 +9,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
 	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
@@ -252,7 +252,12 @@ type Handler struct {
 	episodes     mediaidentity.EpisodeReader
 	events       mediaidentity.PlaybackEventWriter
 	airSchedule  AirScheduleReader
+	skipMarkers  mediaidentity.SkipMarkerStore
+	nextUnits    mediaidentity.NextUnitReader
+	profiles     mediaidentity.ProfileHealthReader
+	embeds       EmbedStore
 	eventLimiter *ratelimit.PerIP
+	embedLimiter *ratelimit.PerIP
 }
 
 // AirScheduleReader 提供某部作品尚未播出的剧集，用于播放页展示更新时间。
@@ -299,10 +304,30 @@ func WithAirScheduleReader(reader AirScheduleReader) HandlerOption {
 	return func(handler *Handler) { handler.airSchedule = reader }
 }
 
-// NewHandler 创建播放处理器，播放事件上报默认限流每 IP 每分钟 120 次。
+// WithSkipMarkerStore 注入片头片尾标记存储，播放候选接口会一并返回共识区间。
+func WithSkipMarkerStore(store mediaidentity.SkipMarkerStore) HandlerOption {
+	return func(handler *Handler) { handler.skipMarkers = store }
+}
+
+// WithNextUnitReader 注入下一集查询，启用自动连播接口。
+func WithNextUnitReader(reader mediaidentity.NextUnitReader) HandlerOption {
+	return func(handler *Handler) { handler.nextUnits = reader }
+}
+
+// WithProfileHealthReader 注入按客户端画像拆分的播放统计，候选排序会优先参考当前设备类别的样本。
+func WithProfileHealthReader(reader mediaidentity.ProfileHealthReader) HandlerOption {
+	return func(handler *Handler) { handler.profiles = reader }
+}
+
+// WithEmbedStore 注入嵌入链接存储，启用签发嵌入链接和 /embed 嵌入页。
+func WithEmbedStore(store EmbedStore) HandlerOption {
+	return func(handler *Handler) { handler.embeds = store }
+}
+
+// NewHandler 创建播放处理器，播放事件上报默认限流每 IP 每分钟 120 次，嵌入页每 IP 每分钟 60 次。
 func NewHandler(cfg config.Config, catalog Catalog, details *DetailService, popular PopularProvider, titleFinder MovieTitleFinder, options ...HandlerOption) *Handler {
 	handler := &Handler{config: cfg, catalog: catalog, details: details, popular: popular, titleFinder: titleFinder,
-		eventLimiter: ratelimit.NewPerIP(120, time.Minute)}
+		eventLimiter: ratelimit.NewPerIP(120, time.Minute), embedLimiter: ratelimit.NewPerIP(60, time.Minute)}
 	for _, option := range options {
 		option(handler)
 	}
@@ -322,7 +347,14 @@ func (handler *Handler) Register(router *gin.Engine) {
 	router.GET("/api/watch/resolve", handler.resolveWatchURL)
 	router.GET("/api/v2/media/:id/resources", handler.resources)
 	router.GET("/api/v2/media-units/:unit_id/playback-candidates", handler.playbackCandidatesV2)
+	router.GET("/api/v2/media-units/:unit_id/next", handler.nextUnitV2)
 	router.POST("/api/v2/playback/events", handler.playbackEventV2)
+	router.POST("/api/v2/media-units/:unit_id/skip-markers",
+		auth.Require(handler.config.AppSecret, handler.config.Env == "production"), handler.skipMarkerV2)
+	router.GET("/embed/:token", handler.embed)
+	router.GET("/api/oembed", handler.oEmbed)
+	router.POST("/api/v2/embeds", auth.Require(handler.config.AppSecret, handler.config.Env == "production"), handler.createEmbedLinkV2)
+	router.GET("/api/v2/embeds", auth.Require(handler.config.AppSecret, handler.config.Env == "production"), handler.listEmbedLinksV2)
 }
 
 // resources 返回某一集的全部播放源（按质量排序）。
@@ -357,8 +389,7 @@ func (handler *Handler) resources(c *gin.Context) {
 	for _, candidate := range candidates {
 		sources = append(sources, sourceCandidate(candidate))
 	}
-	ranked := filterSameEpisode(sources, season, episodeKey)
-	ranked = RankSameEpisode(ranked, season, episodeKey)
+	ranked := handler.rankForClient(c, sources, season, episodeKey)
 	list := make([]gin.H, 0, len(ranked))
 	for _, source := range ranked {
 		list = append(list, gin.H{"source_key": source.SourceKey, "vod_id": source.VodID, "media_id": source.MediaID,
@@ -387,30 +418,205 @@ func (handler *Handler) playbackCandidatesV2(c *gin.Context) {
 		apiError(c, http.StatusInternalServerError, "获取播放候选失败")
 		return
 	}
-	sources := make([]SourceCandidate, 0, len(candidates))
-	for _, candidate := range candidates {
-		if candidate.MediaUnitID == unitID {
-			sources = append(sources, sourceCandidate(candidate))
-		}
-	}
-	sort.SliceStable(sources, func(i, j int) bool { return sources[i].Score() > sources[j].Score() })
+	sources := handler.rankUnitCandidates(c, candidates, unitID)
 	items := make([]gin.H, 0, len(sources))
 	mediaID := 0
 	for _, source := range sources {
 		mediaID = source.MediaID
-		items = append(items, gin.H{
-			"candidate_id": source.CandidateID, "play_line_id": source.LineID,
-			"line_key": source.LineKey, "line_label": source.LineLabel,
-			"source_key": source.SourceKey, "vod_id": source.VodID, "play_url": source.PlayURL,
-			"episode_key": source.EpisodeKey, "episode_label": source.EpisodeLabel,
-			"score": source.Score(), "quality_label": playbackQualityLabel(source.Health),
-			"mapping_confidence": source.MappingConfidence,
-		})
+		items = append(items, candidateView(source))
 	}
 	c.JSON(http.StatusOK, gin.H{"media_id": mediaID, "unit_id": unitID, "resume_position": 0,
 		"candidate_session_id": newCandidateSessionID(),
 		// player.js 依据该字段决定是否自动换源，自动换源已固定启用。
-		"auto_failover_enabled": true, "candidates": items})
+		"auto_failover_enabled": true, "candidates": items,
+		"skip_markers": handler.skipMarkerViews(c.Request.Context(), unitID)})
+}
+
+// rankUnitCandidates 只保留确实属于这一集的候选，按当前客户端画像排序。
+func (handler *Handler) rankUnitCandidates(c *gin.Context, candidates []mediaidentity.ResourceCandidate, unitID int) []SourceCandidate {
+	sources := make([]SourceCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.MediaUnitID == unitID {
+			sources = append(sources, sourceCandidate(candidate))
+		}
+	}
+	handler.applyClientProfile(c, sources)
+	sortCandidates(sources)
+	return sources
+}
+
+// rankForClient 是带客户端画像的 RankSameEpisode，各播放页和接口统一走这里。
+func (handler *Handler) rankForClient(c *gin.Context, candidates []SourceCandidate, season int, episodeKey string) []SourceCandidate {
+	result := filterSameEpisode(candidates, season, episodeKey)
+	handler.applyClientProfile(c, result)
+	return RankSameEpisode(result, season, episodeKey)
+}
+
+// clientProfile 返回本次请求的客户端画像。
+func (handler *Handler) clientProfile(c *gin.Context) ClientProfile {
+	return clientProfileFromRequest(c.Request, strings.HasPrefix(requestBaseURL(c), "https://"))
+}
+
+// applyClientProfile 给候选标上当前画像能否播放，并填入该画像的资源统计。
+// 画像统计读取失败只记日志，退回全局统计排序。
+func (handler *Handler) applyClientProfile(c *gin.Context, sources []SourceCandidate) {
+	profile := handler.clientProfile(c)
+	if profile.Platform == "" || len(sources) == 0 {
+		return
+	}
+	for index := range sources {
+		sources[index].Incompatible = !profile.Supports(sources[index].LineLabel, sources[index].PlayURL)
+	}
+	if handler.profiles == nil {
+		return
+	}
+	resources := make([]mediaidentity.ResourceRef, 0, len(sources))
+	for _, source := range sources {
+		resources = append(resources, mediaidentity.ResourceRef{SourceKey: source.SourceKey, VodID: source.VodID})
+	}
+	health, err := handler.profiles.ListProfileHealth(c.Request.Context(), profile.Key(), resources)
+	if err != nil {
+		requestmeta.Logger(c.Request.Context()).Warn("profile health lookup failed", "profile", profile.Key(), "error", err)
+		return
+	}
+	for index := range sources {
+		stats := health[mediaidentity.ResourceRef{SourceKey: sources[index].SourceKey, VodID: sources[index].VodID}]
+		sources[index].ProfileHealth = PlaybackHealth{SuccessCount: stats.SuccessCount,
+			FailureCount: stats.FailureCount, AvgLoadMs: stats.AvgLoadMs}
+	}
+}
+
+// candidateView 是播放候选的 JSON 形状，候选列表和下一集接口共用。
+func candidateView(source SourceCandidate) gin.H {
+	return gin.H{
+		"candidate_id": source.CandidateID, "play_line_id": source.LineID,
+		"line_key": source.LineKey, "line_label": source.LineLabel,
+		"source_key": source.SourceKey, "vod_id": source.VodID, "play_url": source.PlayURL,
+		"episode_key": source.EpisodeKey, "episode_label": source.EpisodeLabel,
+		"score": source.Score(), "quality_label": playbackQualityLabel(source.Health),
+		"mapping_confidence": source.MappingConfidence, "line_demoted": source.LineQoE.Demoted(),
+	}
+}
+
+// nextUnitV2 返回紧接着的下一集（可跨季）以及它排名最高的播放候选，播放器据此自动连播。
+// position/duration 是当前集的播放进度（秒），completed 表示是否已越过看完阈值；
+// 没有下一集时 next 为 null，下一集还没有可播资源时 candidate 为 null。
+func (handler *Handler) nextUnitV2(c *gin.Context) {
+	unitID, err := strconv.Atoi(c.Param("unit_id"))
+	if err != nil || unitID <= 0 {
+		apiError(c, http.StatusBadRequest, "media_unit_id 参数错误")
+		return
+	}
+	if handler.nextUnits == nil {
+		apiError(c, http.StatusServiceUnavailable, "下一集服务暂时不可用")
+		return
+	}
+	position, _ := strconv.ParseFloat(c.Query("position"), 64)
+	duration, _ := strconv.ParseFloat(c.Query("duration"), 64)
+	progress := 0
+	if position > 0 && duration > 0 {
+		progress = int(position * 100 / duration)
+		if progress > 100 {
+			progress = 100
+		}
+	}
+	payload := gin.H{"unit_id": unitID, "progress": progress,
+		"completed": progress >= mediaidentity.CompletionPercent, "next": nil}
+	next, err := handler.nextUnits.NextUnit(c.Request.Context(), unitID)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "获取下一集失败")
+		return
+	}
+	if next.ID <= 0 {
+		c.JSON(http.StatusOK, payload)
+		return
+	}
+	label := mediaidentity.EpisodeLabel(next.SeasonNumber, next.EpisodeNumber)
+	view := gin.H{"unit_id": next.ID, "media_id": next.MediaID, "season_number": next.SeasonNumber,
+		"episode_key": next.EpisodeKey, "episode_label": label, "title": next.Title,
+		"air_date": nil, "candidate": nil, "watch_url": ""}
+	if !next.AirDate.IsZero() {
+		view["air_date"] = next.AirDate.Format("2006-01-02")
+	}
+	if reader, ok := handler.episodes.(mediaidentity.UnitEpisodeReader); ok {
+		candidates, err := reader.ListUnitResourceCandidates(c.Request.Context(), next.ID)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, "获取播放候选失败")
+			return
+		}
+		if ranked := handler.rankUnitCandidates(c, candidates, next.ID); len(ranked) > 0 {
+			view["candidate"] = candidateView(ranked[0])
+		}
+	}
+	if resolver, ok := handler.media.(linkedMediaResolver); ok {
+		if media, err := resolver.FindByID(c.Request.Context(), next.MediaID); err == nil && media.ID > 0 {
+			view["watch_url"] = "/watch/" + url.PathEscape(watchKey(media.DoubanID, media.ID)) + "?ep=" + url.QueryEscape(next.EpisodeKey)
+		}
+	}
+	payload["next"] = view
+	c.JSON(http.StatusOK, payload)
+}
+
+// skipMarkerViews 读取某一集的片头片尾共识。读取失败只记日志，不影响播放候选本身。
+func (handler *Handler) skipMarkerViews(ctx context.Context, unitID int) []gin.H {
+	views := []gin.H{}
+	if handler.skipMarkers == nil {
+		return views
+	}
+	markers, err := handler.skipMarkers.ListSkipMarkers(ctx, unitID)
+	if err != nil {
+		requestmeta.Logger(ctx).Warn("list skip markers failed", "media_unit_id", unitID, "error", err)
+		return views
+	}
+	for _, marker := range markers {
+		views = append(views, gin.H{"type": marker.MarkerType, "start_ms": marker.StartMs, "end_ms": marker.EndMs,
+			"votes": marker.Votes, "scope": marker.Scope})
+	}
+	return views
+}
+
+// skipMarkerRequest 是播放器提交的片头或片尾区间，单位毫秒。
+type skipMarkerRequest struct {
+	Type    string `json:"type"`
+	StartMs int    `json:"start_ms"`
+	EndMs   int    `json:"end_ms"`
+}
+
+// skipMarkerV2 接收登录用户标记的片头片尾。与播放事件共用每 IP 限流。
+func (handler *Handler) skipMarkerV2(c *gin.Context) {
+	if !handler.eventLimiter.Allow(c.ClientIP()) {
+		apiError(c, http.StatusTooManyRequests, "提交过于频繁")
+		return
+	}
+	if handler.skipMarkers == nil {
+		apiError(c, http.StatusServiceUnavailable, "片头片尾标记暂时不可用")
+		return
+	}
+	unitID, err := strconv.Atoi(c.Param("unit_id"))
+	if err != nil || unitID <= 0 {
+		apiError(c, http.StatusBadRequest, "media_unit_id 参数错误")
+		return
+	}
+	var request skipMarkerRequest
+	if c.ShouldBindJSON(&request) != nil {
+		apiError(c, http.StatusBadRequest, "片头片尾参数错误")
+		return
+	}
+	err = handler.skipMarkers.RecordSkipMarker(c.Request.Context(), mediaidentity.SkipMarkerVote{
+		UserID: auth.UserID(c), MediaUnitID: unitID, MarkerType: request.Type,
+		StartMs: request.StartMs, EndMs: request.EndMs,
+	})
+	if err != nil {
+		if errors.Is(err, mediaidentity.ErrInvalidSkipMarker) {
+			apiError(c, http.StatusBadRequest, "片头片尾参数错误")
+		} else {
+			requestmeta.Logger(c.Request.Context()).Warn("skip marker persistence failed",
+				"media_unit_id", unitID, "type", request.Type, "error", err)
+			apiError(c, http.StatusInternalServerError, "片头片尾标记保存失败")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"accepted": true, "skip_markers": handler.skipMarkerViews(c.Request.Context(), unitID)})
 }
 
 // playbackEventRequest 是播放器上报的事件体。
@@ -424,6 +630,8 @@ type playbackEventRequest struct {
 	VodID              string `json:"vod_id"`
 	ElapsedMs          int    `json:"elapsed_ms"`
 	Reason             string `json:"reason"`
+	// Client 是播放器探测到的能力画像，老版本播放器不带时按 Cookie / User-Agent 推断。
+	Client *ClientProfile `json:"client"`
 }
 
 // playbackEventV2 接收播放器上报的质量事件（先限流，再校验，最后落库）。
@@ -441,11 +649,15 @@ func (handler *Handler) playbackEventV2(c *gin.Context) {
 		apiError(c, http.StatusBadRequest, "播放事件参数错误")
 		return
 	}
+	profile := handler.clientProfile(c)
+	if request.Client != nil {
+		profile = normalizeClientProfile(*request.Client)
+	}
 	accepted, err := handler.events.RecordPlaybackEvent(c.Request.Context(), mediaidentity.PlaybackAttemptEvent{
 		AttemptID: request.AttemptID, CandidateSessionID: request.CandidateSessionID,
 		EventType: request.EventType, CandidateID: request.CandidateID,
 		MediaUnitID: request.MediaUnitID, SourceKey: request.SourceKey, VodID: request.VodID,
-		ElapsedMs: request.ElapsedMs, Reason: request.Reason,
+		ElapsedMs: request.ElapsedMs, Reason: request.Reason, ClientProfile: profile.Key(),
 	})
 	if err != nil {
 		if errors.Is(err, mediaidentity.ErrInvalidPlaybackEvent) {
@@ -469,7 +681,9 @@ func sourceCandidate(candidate mediaidentity.ResourceCandidate) SourceCandidate
 		SourceKey: candidate.SourceKey, VodID: candidate.VodID, MediaID: candidate.MediaID, MediaUnitID: candidate.MediaUnitID,
 		SeasonNumber: candidate.SeasonNumber, EpisodeKey: candidate.EpisodeKey, EpisodeLabel: candidate.EpisodeLabel, PlayURL: candidate.PlayURL,
 		MappingConfidence: candidate.MappingConfidence,
-		Health:            PlaybackHealth{SuccessCount: candidate.SuccessCount, FailureCount: candidate.FailureCount, AvgLoadMs: candidate.AvgLoadMs}}
+		Health:            PlaybackHealth{SuccessCount: candidate.SuccessCount, FailureCount: candidate.FailureCount, AvgLoadMs: candidate.AvgLoadMs},
+		LineQoE: LineQoE{Attempts: candidate.LineQoE.Attempts, FirstFrames: candidate.LineQoE.FirstFrames,
+			Rebuffers: candidate.LineQoE.Rebuffers, Failures: candidate.LineQoE.Failures, AutoSwitches: candidate.LineQoE.AutoSwitches}}
 }
 
 // playbackQualityLabel 质量分对应的中文标签（接口版）。
@@ -592,8 +806,7 @@ func (handler *Handler) renderPlayPage(c *gin.Context, sourceKey, vodID, doubanI
 		title += "(" + episode + ")"
 	}
 	title += " - 在线播放免费高清线路 - " + handler.config.SiteName
-	ranked := filterSameEpisode(allCandidates, seasonNumber, episodeKey)
-	ranked = RankSameEpisode(ranked, seasonNumber, episodeKey)
+	ranked := handler.rankForClient(c, allCandidates, seasonNumber, episodeKey)
 	episodeSources := buildEpisodeSources(ranked, sourceKey, vodID, playURL, episode, doubanID)
 	extra := gin.H{
 		"DoubanID": doubanID, "MediaID": mediaID, "MediaUnitID": mediaUnitID, "CandidateID": candidateID,
@@ -656,19 +869,25 @@ type WatchEpisodeView struct {
 }
 
 // watch 是按豆瓣 ID 入口的播放页 /watch/:douban_id，步骤见下面的编号注释。
+// 没有豆瓣条目的作品用 m<media.id> 作为标识，与详情页一致。
 // 与 play 的区别：它先定媒体再挑最优资源，所以能跨资源站自动选最好的线路；
 // 但它依赖候选索引已经建好，没有候选就 302 回搜索页。
 func (handler *Handler) watch(c *gin.Context) {
-	doubanID := c.Param("douban_id")
-	if doubanID == "" || doubanID == "0" {
+	key := c.Param("douban_id")
+	if key == "" || key == "0" {
 		c.Redirect(http.StatusFound, "/")
 		return
 	}
+	// 下游的标记、换源链接都按豆瓣 ID 记，m<id> 入口没有豆瓣 ID 时传空。
+	doubanID := key
+	if catalog.ParseMovieKey(key).Kind == catalog.MovieKeyMedia {
+		doubanID = ""
+	}
 
 	// 1. 解析规范媒体身份。解析不出来时，URL 上如果指名了资源就直接按 /play 播，
 	//    否则回搜索页——优先用影片标题做关键词，裸豆瓣 ID 搜不出东西。
-	searchKeyword := doubanID
-	if handler.titleFinder != nil {
+	searchKeyword := key
+	if handler.titleFinder != nil && doubanID != "" {
 		if title, _ := handler.titleFinder.FindTitleByDoubanID(c.Request.Context(), doubanID); title != "" {
 			searchKeyword = title
 		}
@@ -680,7 +899,7 @@ func (handler *Handler) watch(c *gin.Context) {
 		c.Redirect(http.StatusFound, "/search?kw="+url.QueryEscape(searchKeyword))
 		return
 	}
-	canonical, err := handler.media.FindByDoubanID(c.Request.Context(), doubanID)
+	canonical, err := handler.findWatchMedia(c.Request.Context(), key)
 	if err != nil || canonical.ID == 0 {
 		if handler.fallbackToPlay(c, doubanID) {
 			return
@@ -717,8 +936,7 @@ func (handler *Handler) watch(c *gin.Context) {
 			}
 		}
 	}
-	ranked := filterSameEpisode(allCandidates, seasonNumber, episodeKey)
-	ranked = RankSameEpisode(ranked, seasonNumber, episodeKey)
+	ranked := handler.rankForClient(c, allCandidates, seasonNumber, episodeKey)
 
 	// 5. 没有候选时，先用 URL 上的 source_key/vod_id 现场补一次索引再重试。
 	//    剧集索引只在搜索和 /play 时写入，而搜索结果可以直接链到 /watch，
@@ -740,7 +958,7 @@ func (handler *Handler) watch(c *gin.Context) {
 				allCandidates = append(allCandidates, sourceCandidate(rc))
 			}
 		}
-		ranked = RankSameEpisode(filterSameEpisode(allCandidates, seasonNumber, episodeKey), seasonNumber, episodeKey)
+		ranked = handler.rankForClient(c, allCandidates, seasonNumber, episodeKey)
 	}
 
 	// 6. 仍然没有候选时，用 resource_media_links 找一条已关联的资源现场补录索引。
@@ -765,7 +983,7 @@ func (handler *Handler) watch(c *gin.Context) {
 						allCandidates = append(allCandidates, sourceCandidate(rc))
 					}
 				}
-				ranked = RankSameEpisode(filterSameEpisode(allCandidates, seasonNumber, episodeKey), seasonNumber, episodeKey)
+				ranked = handler.rankForClient(c, allCandidates, seasonNumber, episodeKey)
 			}
 		}
 	}
@@ -894,6 +1112,7 @@ func (handler *Handler) watch(c *gin.Context) {
 		"SourceLabel":         best.SourceKey + " · " + best.LineLabel,
 		"AutoFailoverEnabled": true,
 		"AirSchedule":         handler.airScheduleView(c.Request.Context(), &canonical),
+		"OEmbedURL":           requestBaseURL(c) + "/api/oembed?url=" + url.QueryEscape(requestBaseURL(c)+"/watch/"+watchKey(canonical.DoubanID, canonical.ID)),
 	}))
 }
 
@@ -924,6 +1143,26 @@ func (handler *Handler) indexWatchResource(ctx context.Context, media mediaident
 	return true
 }
 
+// watchKey 返回 /watch 页的媒体标识：有豆瓣 ID 用豆瓣 ID，否则用 m<media.id>。
+func watchKey(doubanID string, mediaID int) string {
+	if doubanID != "" {
+		return doubanID
+	}
+	return "m" + strconv.Itoa(mediaID)
+}
+
+// findWatchMedia 按 watchKey 查规范媒体。m<id> 需要存储支持按 ID 查询，否则按找不到处理。
+func (handler *Handler) findWatchMedia(ctx context.Context, key string) (mediaidentity.Media, error) {
+	if parsed := catalog.ParseMovieKey(key); parsed.Kind == catalog.MovieKeyMedia {
+		resolver, ok := handler.media.(linkedMediaResolver)
+		if !ok {
+			return mediaidentity.Media{}, nil
+		}
+		return resolver.FindByID(ctx, parsed.MediaID)
+	}
+	return handler.media.FindByDoubanID(ctx, key)
+}
+
 // fallbackToPlay 在 /watch 走不通时改用 /play 的资源直连方式渲染，真渲染了才返回 true。
 // URL 上带了 source_key+vod_id，就说明来源（搜索结果、换源链接）已经指名了要播哪条资源，
 // 而这两个参数正好是 /play 需要的全部输入。此时把人 302 回搜索页是纯亏：
@@ -972,8 +1211,7 @@ func (handler *Handler) resolveWatchURL(c *gin.Context) {
 	for _, rc := range raw {
 		candidates = append(candidates, sourceCandidate(rc))
 	}
-	ranked := filterSameEpisode(candidates, seasonNumber, episodeKey)
-	ranked = RankSameEpisode(ranked, seasonNumber, episodeKey)
+	ranked := handler.rankForClient(c, candidates, seasonNumber, episodeKey)
 	if len(ranked) == 0 {
 		c.JSON(http.StatusOK, gin.H{"error": "未找到可用源"})
 		return
@@ -1045,11 +1283,16 @@ func apiError(c *gin.Context, status int, message string) {
 	c.JSON(status, gin.H{"code": status, "message": message, "data": nil, "success": false})
 }
 
-// player 是独立的 M3U8 播放器工具页。
+// player 是独立的 M3U8 播放器工具页。旧的 embed=1 模式可以播放任意地址，会被外站当免费播放器盗链，
+// 现在跳回工具页本身；外站嵌入改用签发的 /embed/:token。
 func (handler *Handler) player(c *gin.Context) {
 	target := c.Query("url")
 	if c.Query("embed") == "1" {
-		c.HTML(http.StatusOK, "player_embed.html", gin.H{"URL": target})
+		location := "/player"
+		if target != "" {
+			location += "?url=" + url.QueryEscape(target)
+		}
+		c.Redirect(http.StatusMovedPermanently, location)
 		return
 	}
 	metadata := platformweb.Metadata{
@@ -1082,10 +1325,16 @@ func (handler *Handler) tvbox(c *gin.Context) {
 // tvboxConfig 返回 TVBox 客户端的订阅配置。
 func (handler *Handler) tvboxConfig(c *gin.Context) {
 	baseURL := requestBaseURL(c)
+	api := baseURL + "/api/vod"
+	// 订阅地址上带了能力画像（如 /api/tvbox.json?platform=tvbox&codecs=h264，给解不了 HEVC 的老盒子用）时，
+	// 原样转给 /api/vod，盒子之后的每次请求都会带上它。
+	if profile, ok := parseClientProfile(c.Request.URL.Query()); ok {
+		api += "?" + profile.values().Encode()
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"sites": []gin.H{{
 			"key": "moovie", "name": "Moovie 影牛", "type": 1,
-			"api": baseURL + "/api/vod", "searchable": 1, "quickSearch": 1, "filterable": 0,
+			"api": api, "searchable": 1, "quickSearch": 1, "filterable": 0,
 		}},
 		"lives": []gin.H{}, "parses": []gin.H{}, "flags": []string{},
 	})
@@ -1181,8 +1430,9 @@ func (handler *Handler) tvboxDetail(c *gin.Context, ids string) {
 
 // tvboxDetailFromDouban 用豆瓣 ID 找可播放资源，找不到就用片名再搜一次。
 func (handler *Handler) tvboxDetailFromDouban(c *gin.Context, doubanID string) {
+	profile := handler.clientProfile(c)
 	items, _ := handler.catalog.SearchByDoubanID(c.Request.Context(), doubanID)
-	if playable := firstPlayable(items); playable != nil {
+	if playable := firstPlayable(items, profile); playable != nil {
 		c.JSON(http.StatusOK, listPayload([]gin.H{buildTVBoxVOD(playable.SourceKey+":"+playable.VodId, playable,
 			handler.resolveDisplayMedia(c.Request.Context(), playable, doubanID))}))
 		return
@@ -1191,7 +1441,7 @@ func (handler *Handler) tvboxDetailFromDouban(c *gin.Context, doubanID string) {
 		title, _ := handler.titleFinder.FindTitleByDoubanID(c.Request.Context(), doubanID)
 		if title != "" {
 			items, _ = handler.catalog.Search(c.Request.Context(), title)
-			if playable := firstPlayable(items); playable != nil {
+			if playable := firstPlayable(items, profile); playable != nil {
 				c.JSON(http.StatusOK, listPayload([]gin.H{buildTVBoxVOD(playable.SourceKey+":"+playable.VodId, playable,
 					handler.resolveDisplayMedia(c.Request.Context(), playable, doubanID))}))
 				return
@@ -1201,14 +1451,22 @@ func (handler *Handler) tvboxDetailFromDouban(c *gin.Context, doubanID string) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "未找到播放源", "list": []gin.H{}})
 }
 
-// firstPlayable 取第一条有播放地址的资源。
-func firstPlayable(items []search.VodItem) *search.VodItem {
+// firstPlayable 取第一条有播放地址、且客户端画像能播的资源；都播不了时退回第一条有地址的。
+func firstPlayable(items []search.VodItem, profile ClientProfile) *search.VodItem {
+	var fallback *search.VodItem
 	for index := range items {
-		if _, url := formatTVBoxPlayURL(items[index].VodPlayUrl); url != "" {
+		from, url := formatTVBoxPlayURL(items[index].VodPlayUrl)
+		if url == "" {
+			continue
+		}
+		if profile.Supports(from, url) {
 			return &items[index]
 		}
+		if fallback == nil {
+			fallback = &items[index]
+		}
 	}
-	return nil
+	return fallback
 }
 
 // tvboxCategory 分类页，映射到对应的热门榜。
@@ -134,7 +134,7 @@ func (function playbackEventWriterFunc) RecordPlaybackEvent(ctx context.Context,
 	return function(ctx, event)
 }
 
-func TestPlayerPagesPreserveStandaloneEmbedAndMetadata(t *testing.T) {
+func TestPlayerPagesPreserveMetadataAndRetireRawURLEmbed(t *testing.T) {
 	testdb.User(t, testdb.Pool(t), 7)
 	router, cfg := playbackTestRouter(t, search.NewPostgresStore(testdb.Pool(t)), staticPopularProvider{})
 
@@ -146,12 +146,10 @@ func TestPlayerPagesPreserveStandaloneEmbedAndMetadata(t *testing.T) {
 		t.Fatalf("player canonical missing: %s", normal.Body.String())
 	}
 
+	// 任意地址的 embed 模式已下线，外站嵌入改用签发的 /embed/:token。
 	embed := performRequest(router, "/player?embed=1&url=https%3A%2F%2Fvideo.example%2Fa.m3u8", nil)
-	if embed.Code != http.StatusOK || !strings.Contains(embed.Body.String(), "https://video.example/a.m3u8") {
-		t.Fatalf("embed player status/body = %d/%s", embed.Code, embed.Body.String())
-	}
-	if strings.Contains(embed.Body.String(), "Moovie影牛 - 发现你的下一部电影") {
-		t.Fatal("embed player unexpectedly rendered the shared site layout")
+	if embed.Code != http.StatusMovedPermanently || embed.Header().Get("Location") != "/player?url=https%3A%2F%2Fvideo.example%2Fa.m3u8" {
+		t.Fatalf("embed player status/location = %d/%s", embed.Code, embed.Header().Get("Location"))
 	}
 }
 
@@ -444,6 +442,101 @@ func TestPlaybackEventV2ForwardsIdempotentAttemptIdentity(t *testing.T) {
 	}
 }
 
+// skipMarkerStoreStub 记录最后一次提交，并固定返回一条整季片头共识。
+type skipMarkerStoreStub struct {
+	recorded *mediaidentity.SkipMarkerVote
+}
+
+func (store skipMarkerStoreStub) RecordSkipMarker(_ context.Context, vote mediaidentity.SkipMarkerVote) error {
+	if vote.MarkerType != mediaidentity.SkipMarkerIntro && vote.MarkerType != mediaidentity.SkipMarkerOutro {
+		return mediaidentity.ErrInvalidSkipMarker
+	}
+	*store.recorded = vote
+	return nil
+}
+
+func (skipMarkerStoreStub) ListSkipMarkers(context.Context, int) ([]mediaidentity.SkipMarker, error) {
+	return []mediaidentity.SkipMarker{{MarkerType: mediaidentity.SkipMarkerIntro, StartMs: 5000, EndMs: 95000, Votes: 4, Scope: "season"}}, nil
+}
+
+func TestPlaybackCandidatesV2ExposesSkipMarkersAndAcceptsSubmissions(t *testing.T) {
+	testdb.User(t, testdb.Pool(t), 7)
+	var recorded mediaidentity.SkipMarkerVote
+	reader := combinedEpisodeReader{byUnit: func(context.Context, int) ([]mediaidentity.ResourceCandidate, error) {
+		return nil, nil
+	}}
+	router, _ := playbackTestRouter(t, search.NewPostgresStore(testdb.Pool(t)), staticPopularProvider{},
+		WithEpisodeReader(reader), WithSkipMarkerStore(skipMarkerStoreStub{recorded: &recorded}))
+	payload := decodeJSON(t, performRequest(router, "/api/v2/media-units/51/playback-candidates", nil))
+	markers := payload["skip_markers"].([]any)
+	if len(markers) != 1 || markers[0].(map[string]any)["type"] != "intro" || markers[0].(map[string]any)["end_ms"] != float64(95000) {
+		t.Fatalf("skip marker payload = %#v", payload)
+	}
+
+	body := `{"type":"intro","start_ms":5000,"end_ms":95000}`
+	guest := httptest.NewRequest(http.MethodPost, "/api/v2/media-units/51/skip-markers", bytes.NewBufferString(body))
+	guest.Header.Set("Content-Type", "application/json")
+	guestRecorder := httptest.NewRecorder()
+	router.ServeHTTP(guestRecorder, guest)
+	if guestRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("guest skip marker status = %d", guestRecorder.Code)
+	}
+
+	now := time.Now()
+	token, err := auth.Sign(auth.Claims{UserID: 7, Email: "person@example.com", Role: "user", Issued: now.Unix(), Expiry: now.Add(time.Hour).Unix()}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/api/v2/media-units/51/skip-markers", bytes.NewBufferString(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.AddCookie(&http.Cookie{Name: "token", Value: token})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorded.UserID != 7 || recorded.MediaUnitID != 51 || recorded.EndMs != 95000 {
+		t.Fatalf("skip marker response/record = %d/%s/%+v", recorder.Code, recorder.Body.String(), recorded)
+	}
+}
+
+type nextUnitReaderFunc func(context.Context, int) (mediaidentity.MediaUnit, error)
+
+func (function nextUnitReaderFunc) NextUnit(ctx context.Context, unitID int) (mediaidentity.MediaUnit, error) {
+	return function(ctx, unitID)
+}
+
+func TestNextUnitV2CrossesSeasonAndPreResolvesBestCandidate(t *testing.T) {
+	testdb.User(t, testdb.Pool(t), 7)
+	next := nextUnitReaderFunc(func(_ context.Context, unitID int) (mediaidentity.MediaUnit, error) {
+		if unitID != 51 {
+			return mediaidentity.MediaUnit{}, nil
+		}
+		return mediaidentity.MediaUnit{ID: 60, MediaID: 7, UnitType: "episode", SeasonNumber: 2, EpisodeNumber: 1, EpisodeKey: "S02E01"}, nil
+	})
+	reader := combinedEpisodeReader{byUnit: func(_ context.Context, unitID int) ([]mediaidentity.ResourceCandidate, error) {
+		return []mediaidentity.ResourceCandidate{
+			{Episode: mediaidentity.Episode{CandidateID: 81, SourceKey: "flaky", VodID: "a", MediaID: 7, MediaUnitID: unitID, PlayURL: "slow"}, SuccessCount: 1, FailureCount: 9},
+			{Episode: mediaidentity.Episode{CandidateID: 82, SourceKey: "healthy", VodID: "b", MediaID: 7, MediaUnitID: unitID, PlayURL: "fast"}, SuccessCount: 50, FailureCount: 1},
+		}, nil
+	}}
+	resolver := linkedMediaResolverStub{media: mediaidentity.Media{ID: 7, DoubanID: "1292052"}}
+	router, _ := playbackTestRouter(t, search.NewPostgresStore(testdb.Pool(t)), staticPopularProvider{},
+		WithEpisodeReader(reader), WithNextUnitReader(next), WithMediaResolver(resolver))
+	payload := decodeJSON(t, performRequest(router, "/api/v2/media-units/51/next?position=2700&duration=2880", nil))
+	if payload["completed"] != true || payload["progress"] != float64(93) {
+		t.Fatalf("progress payload = %#v", payload)
+	}
+	view := payload["next"].(map[string]any)
+	candidate := view["candidate"].(map[string]any)
+	if view["unit_id"] != float64(60) || view["episode_label"] != "S02E01" || candidate["candidate_id"] != float64(82) ||
+		view["watch_url"] != "/watch/1292052?ep=S02E01" {
+		t.Fatalf("next payload = %#v", view)
+	}
+
+	last := decodeJSON(t, performRequest(router, "/api/v2/media-units/99/next", nil))
+	if last["next"] != nil || last["completed"] != false {
+		t.Fatalf("last episode payload = %#v", last)
+	}
+}
+
 func playbackTestRouter(t *testing.T, store *search.PostgresStore, popular PopularProvider, options ...HandlerOption) (*gin.Engine, config.Config) {
 	t.Helper()
 	gin.SetMode(gin.TestMode)
@@ -46,6 +46,56 @@ func (health PlaybackHealth) Score() float64 {
 	return reliability*0.8 + speed*0.2
 }
 
+// 线路降权的门槛：7 天内至少 QoEMinAttempts 次起播，且 QoE 分低于 QoEDemoteThreshold。
+// 样本太少时不降权，几次偶发失败不该让一条线路长期沉底。
+const (
+	QoEMinAttempts     = 20
+	QoEDemoteThreshold = 0.5
+)
+
+// LineQoE 是一条线路的滚动播放体验。PlaybackHealth 按资源统计，同一资源下
+// 不同播放器组的线路会被平均掉；这里按线路单独计数，用来发现某条线路持续起播慢、卡顿或失败。
+type LineQoE struct {
+	Attempts     int
+	FirstFrames  int
+	Rebuffers    int
+	Failures     int
+	AutoSwitches int
+}
+
+// Score 按起播成功率（50%）、未失败率（20%）、未卡顿率（20%）和未被自动换源率（10%）加权，
+// 取值 0~1。没有样本时返回 1，未知线路不受影响。
+func (qoe LineQoE) Score() float64 {
+	if qoe.Attempts <= 0 {
+		return 1
+	}
+	rebufferRatio := 0.0
+	if qoe.FirstFrames > 0 {
+		rebufferRatio = clampRatio(float64(qoe.Rebuffers) / float64(qoe.FirstFrames))
+	}
+	attempts := float64(qoe.Attempts)
+	return clampRatio(float64(qoe.FirstFrames)/attempts)*0.5 +
+		(1-clampRatio(float64(qoe.Failures)/attempts))*0.2 +
+		(1-rebufferRatio)*0.2 +
+		(1-clampRatio(float64(qoe.AutoSwitches)/attempts))*0.1
+}
+
+// Demoted 表示这条线路的滚动 QoE 已经差到应该排在其他线路之后。
+func (qoe LineQoE) Demoted() bool {
+	return qoe.Attempts >= QoEMinAttempts && qoe.Score() < QoEDemoteThreshold
+}
+
+// clampRatio 把比例限制在 0~1（事件上报有重复和丢失，计数之比偶尔会越界）。
+func clampRatio(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+	if value > 1 {
+		return 1
+	}
+	return value
+}
+
 // SourceCandidate 是一个可播放的候选来源，带质量统计和匹配置信度。
 type SourceCandidate struct {
 	CandidateID       int
@@ -62,6 +112,10 @@ type SourceCandidate struct {
 	PlayURL           string
 	MappingConfidence float64
 	Health            PlaybackHealth
+	LineQoE           LineQoE
+	// ProfileHealth 是当前客户端画像在这条资源上的统计；Incompatible 表示画像声明的能力播不了这条线路。
+	ProfileHealth PlaybackHealth
+	Incompatible  bool
 }
 
 // Score 综合播放质量（85%）和匹配置信度（15%）。
@@ -73,20 +127,57 @@ func (candidate SourceCandidate) Score() float64 {
 	if confidence > 1 {
 		confidence = 1
 	}
-	return candidate.Health.Score()*0.85 + confidence*0.15
+	return candidate.healthScore()*0.85 + confidence*0.15
 }
 
-// RankSameEpisode 只排序请求的规范剧集候选。其他剧集会在排序前被剔除，
-// 从根本上防止“第三集失败后换源打开第一集”。
-func RankSameEpisode(candidates []SourceCandidate, season int, episodeKey string) []SourceCandidate {
-	result := filterSameEpisode(candidates, season, episodeKey)
-	sort.SliceStable(result, func(i, j int) bool {
-		left, right := result[i].Score(), result[j].Score()
+// healthScore 优先相信当前客户端画像自己的统计：画像样本满 10 个后完全采用，
+// 之前按样本数和全局统计线性混合；没有画像样本时就是全局统计。
+func (candidate SourceCandidate) healthScore() float64 {
+	global := candidate.Health.Score()
+	total := candidate.ProfileHealth.Total()
+	if total == 0 {
+		return global
+	}
+	weight := float64(total) / 10
+	if weight > 1 {
+		weight = 1
+	}
+	return candidate.ProfileHealth.Score()*weight + global*(1-weight)
+}
+
+// rankTier 是排序的第一关键字：能播且体验正常的线路在前，QoE 降权的其次，
+// 客户端声明播不了的放最后。后两类都不剔除，所有线路都失败时它们仍是后备。
+func (candidate SourceCandidate) rankTier() int {
+	switch {
+	case candidate.Incompatible:
+		return 2
+	case candidate.LineQoE.Demoted():
+		return 1
+	default:
+		return 0
+	}
+}
+
+// sortCandidates 按 rankTier、综合分、平均加载耗时排序。
+func sortCandidates(candidates []SourceCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if leftTier, rightTier := candidates[i].rankTier(), candidates[j].rankTier(); leftTier != rightTier {
+			return leftTier < rightTier
+		}
+		left, right := candidates[i].Score(), candidates[j].Score()
 		if left == right {
-			return result[i].Health.AvgLoadMs < result[j].Health.AvgLoadMs
+			return candidates[i].Health.AvgLoadMs < candidates[j].Health.AvgLoadMs
 		}
 		return left > right
 	})
+}
+
+// RankSameEpisode 只排序请求的规范剧集候选。其他剧集会在排序前被剔除，
+// 从根本上防止“第三集失败后换源打开第一集”。滚动 QoE 不达标的线路和当前客户端播不了的线路
+// 整体排在后面，排序规则见 sortCandidates。
+func RankSameEpisode(candidates []SourceCandidate, season int, episodeKey string) []SourceCandidate {
+	result := filterSameEpisode(candidates, season, episodeKey)
+	sortCandidates(result)
 	return result
 }
 
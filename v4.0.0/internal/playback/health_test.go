@@ -30,3 +30,31 @@ func TestRankSameEpisodeNeverMixesEpisodes(t *testing.T) {
 		t.Fatalf("ranked = %+v", ranked)
 	}
 }
+
+func TestRankSameEpisodeDemotesLinesWithPoorRollingQoE(t *testing.T) {
+	// 资源整体成功率很高，但这条线路最近一周起播一半失败、频繁卡顿。
+	degraded := LineQoE{Attempts: 40, FirstFrames: 18, Rebuffers: 12, Failures: 20, AutoSwitches: 15}
+	if !degraded.Demoted() {
+		t.Fatalf("degraded line score = %.4f, want demoted", degraded.Score())
+	}
+	candidates := []SourceCandidate{
+		{SourceKey: "popular", LineKey: "m3u8", SeasonNumber: 1, EpisodeKey: "S01E03", PlayURL: "popular-3",
+			Health: PlaybackHealth{SuccessCount: 200, FailureCount: 5}, LineQoE: degraded},
+		{SourceKey: "modest", LineKey: "m3u8", SeasonNumber: 1, EpisodeKey: "S01E03", PlayURL: "modest-3",
+			Health: PlaybackHealth{SuccessCount: 6, FailureCount: 3}},
+	}
+	ranked := RankSameEpisode(candidates, 1, "S01E03")
+	if len(ranked) != 2 || ranked[0].PlayURL != "modest-3" || ranked[1].PlayURL != "popular-3" {
+		t.Fatalf("ranked = %+v", ranked)
+	}
+}
+
+func TestLineQoEIgnoresSmallSamples(t *testing.T) {
+	if (LineQoE{}).Score() != 1 {
+		t.Fatal("unknown line should score 1")
+	}
+	broken := LineQoE{Attempts: QoEMinAttempts - 1, Failures: QoEMinAttempts - 1}
+	if broken.Score() >= QoEDemoteThreshold || broken.Demoted() {
+		t.Fatalf("small sample score/demoted = %.4f/%v", broken.Score(), broken.Demoted())
+	}
+}
@@ -0,0 +1,157 @@
+package playback
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// 客户端平台取值。
+const (
+	PlatformDesktop = "desktop"
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformTVBox   = "tvbox"
+)
+
+// clientProfileCookie 保存播放器探测到的能力画像（url.Values 编码），
+// 服务端渲染播放页时也能按这台设备排序，而不只是靠 User-Agent 猜。
+const clientProfileCookie = "moovie_client"
+
+// knownCodecs 是画像里允许声明的编码，其余取值直接丢弃。
+var knownCodecs = []string{"h264", "hevc", "av1"}
+
+// ClientProfile 是客户端的播放能力画像。同一条 HLS 线路在桌面 hls.js 上正常，
+// 在 iOS Safari 或电视盒子上却可能因编码、混合内容、跨域而失败，所以排序要分设备类别。
+type ClientProfile struct {
+	Platform  string   `json:"platform"`
+	NativeHLS bool     `json:"native_hls"`
+	Codecs    []string `json:"codecs"`
+	HTTPSOnly bool     `json:"https_only"`
+}
+
+// Key 返回画像键（平台 + HLS 播放方式，如 ios-native、desktop-mse），用于分桶统计播放事件。
+// 编码和 HTTPS 限制只决定候选能不能播，不进入键，避免统计桶过于分散。未知平台返回空串。
+func (profile ClientProfile) Key() string {
+	if profile.Platform == "" {
+		return ""
+	}
+	if profile.NativeHLS {
+		return profile.Platform + "-native"
+	}
+	return profile.Platform + "-mse"
+}
+
+// Supports 判断一条线路能否在该客户端上播放：HTTPS 页面加载 http:// 流会被浏览器当作混合内容拦掉；
+// 画像声明了编码列表却不含 HEVC 时，HEVC 线路只会黑屏或只有声音。
+func (profile ClientProfile) Supports(lineLabel, playURL string) bool {
+	if profile.HTTPSOnly && strings.HasPrefix(strings.ToLower(strings.TrimSpace(playURL)), "http://") {
+		return false
+	}
+	if len(profile.Codecs) > 0 && !slices.Contains(profile.Codecs, candidateCodec(lineLabel, playURL)) {
+		return false
+	}
+	return true
+}
+
+// candidateCodec 从线路名和地址猜编码。资源站只在线路名或文件名里标注 HEVC，
+// 没标注的一律按 H.264 处理。
+func candidateCodec(lineLabel, playURL string) string {
+	text := strings.ToLower(lineLabel + " " + playURL)
+	for _, marker := range []string{"hevc", "h265", "h.265", "x265"} {
+		if strings.Contains(text, marker) {
+			return "hevc"
+		}
+	}
+	return "h264"
+}
+
+// values 把画像编码成查询参数，和 parseClientProfile 互逆。
+func (profile ClientProfile) values() url.Values {
+	values := url.Values{"platform": {profile.Platform}}
+	if profile.NativeHLS {
+		values.Set("native_hls", "1")
+	}
+	if len(profile.Codecs) > 0 {
+		values.Set("codecs", strings.Join(profile.Codecs, ","))
+	}
+	if profile.HTTPSOnly {
+		values.Set("https_only", "1")
+	}
+	return values
+}
+
+// normalizeClientProfile 校验平台和编码取值，非法平台视为未知画像。
+func normalizeClientProfile(profile ClientProfile) ClientProfile {
+	profile.Platform = strings.ToLower(strings.TrimSpace(profile.Platform))
+	switch profile.Platform {
+	case PlatformDesktop, PlatformIOS, PlatformAndroid, PlatformTVBox:
+	default:
+		return ClientProfile{}
+	}
+	codecs := make([]string, 0, len(knownCodecs))
+	for _, codec := range profile.Codecs {
+		codec = strings.ToLower(strings.TrimSpace(codec))
+		if slices.Contains(knownCodecs, codec) && !slices.Contains(codecs, codec) {
+			codecs = append(codecs, codec)
+		}
+	}
+	profile.Codecs = nil
+	if len(codecs) > 0 {
+		profile.Codecs = codecs
+	}
+	return profile
+}
+
+// parseClientProfile 从查询参数（或同样编码的 Cookie）读取画像：platform、native_hls、codecs、https_only。
+func parseClientProfile(values url.Values) (ClientProfile, bool) {
+	profile := normalizeClientProfile(ClientProfile{
+		Platform:  values.Get("platform"),
+		NativeHLS: profileFlag(values.Get("native_hls")),
+		Codecs:    strings.Split(values.Get("codecs"), ","),
+		HTTPSOnly: profileFlag(values.Get("https_only")),
+	})
+	return profile, profile.Platform != ""
+}
+
+// profileFlag 解析画像里的布尔参数。
+func profileFlag(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return value == "1" || value == "true" || value == "yes"
+}
+
+// clientProfileFromRequest 按「查询参数 → Cookie → User-Agent」的顺序确定画像。
+// 查询参数由播放器和 TVBox 配置显式传入，最可靠；User-Agent 只是兜底猜测。
+func clientProfileFromRequest(request *http.Request, https bool) ClientProfile {
+	if profile, ok := parseClientProfile(request.URL.Query()); ok {
+		return profile
+	}
+	if cookie, err := request.Cookie(clientProfileCookie); err == nil {
+		if values, err := url.ParseQuery(cookie.Value); err == nil {
+			if profile, ok := parseClientProfile(values); ok {
+				return profile
+			}
+		}
+	}
+	return profileFromUserAgent(request.UserAgent(), https)
+}
+
+// profileFromUserAgent 根据 User-Agent 猜画像，口径与 player.js 的 clientProfile 一致：
+// TVBox 系客户端用 okhttp 发请求，走 ExoPlayer 原生播放；网页播放器在 iOS 上也强制走 hls.js，
+// 所以浏览器一律按 MSE 计。猜不出编码支持，不声明编码列表。
+func profileFromUserAgent(userAgent string, https bool) ClientProfile {
+	agent := strings.ToLower(userAgent)
+	switch {
+	case agent == "":
+		return ClientProfile{}
+	case strings.Contains(agent, "okhttp") || strings.Contains(agent, "tvbox"):
+		return ClientProfile{Platform: PlatformTVBox, NativeHLS: true}
+	case strings.Contains(agent, "iphone") || strings.Contains(agent, "ipad") || strings.Contains(agent, "ipod"):
+		return ClientProfile{Platform: PlatformIOS, HTTPSOnly: https}
+	case strings.Contains(agent, "android"):
+		return ClientProfile{Platform: PlatformAndroid, HTTPSOnly: https}
+	default:
+		return ClientProfile{Platform: PlatformDesktop, HTTPSOnly: https}
+	}
+}
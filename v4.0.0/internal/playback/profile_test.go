@@ -0,0 +1,110 @@
+package playback
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+)
+
+type profileHealthReaderFunc func(context.Context, string, []mediaidentity.ResourceRef) (map[mediaidentity.ResourceRef]mediaidentity.ProfileHealth, error)
+
+func (function profileHealthReaderFunc) ListProfileHealth(ctx context.Context, profile string, resources []mediaidentity.ResourceRef) (map[mediaidentity.ResourceRef]mediaidentity.ProfileHealth, error) {
+	return function(ctx, profile, resources)
+}
+
+func TestClientProfileFromRequestPrefersQueryThenCookieThenUserAgent(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/api/v2/media-units/1/playback-candidates?platform=Android&codecs=hevc,h264,vp9", nil)
+	request.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)")
+	request.AddCookie(&http.Cookie{Name: clientProfileCookie, Value: "platform=desktop&native_hls=1"})
+	if profile := clientProfileFromRequest(request, true); profile.Platform != PlatformAndroid || len(profile.Codecs) != 2 || profile.HTTPSOnly {
+		t.Fatalf("query profile = %#v", profile)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/play/source/1", nil)
+	request.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)")
+	request.AddCookie(&http.Cookie{Name: clientProfileCookie, Value: "platform=desktop&native_hls=1&codecs=h264%2Chevc"})
+	if profile := clientProfileFromRequest(request, true); profile.Key() != "desktop-native" || len(profile.Codecs) != 2 {
+		t.Fatalf("cookie profile = %#v", profile)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/api/vod", nil)
+	request.Header.Set("User-Agent", "okhttp/3.12.0")
+	if profile := clientProfileFromRequest(request, false); profile.Key() != "tvbox-native" {
+		t.Fatalf("user agent profile = %#v", profile)
+	}
+	if profile := clientProfileFromRequest(httptest.NewRequest(http.MethodGet, "/", nil), false); profile.Key() != "" {
+		t.Fatalf("anonymous profile = %#v", profile)
+	}
+}
+
+func TestClientProfileSupportsRejectsMixedContentAndUndeclaredCodecs(t *testing.T) {
+	profile := ClientProfile{Platform: PlatformIOS, Codecs: []string{"h264"}, HTTPSOnly: true}
+	for _, tc := range []struct {
+		label, url string
+		want       bool
+	}{
+		{"量子资源", "https://cdn.example/1.m3u8", true},
+		{"量子资源", "http://cdn.example/1.m3u8", false},
+		{"HEVC 高码", "https://cdn.example/1.m3u8", false},
+		{"默认", "https://cdn.example/ep1.x265.m3u8", false},
+	} {
+		if got := profile.Supports(tc.label, tc.url); got != tc.want {
+			t.Fatalf("Supports(%q, %q) = %v, want %v", tc.label, tc.url, got, tc.want)
+		}
+	}
+	if !(ClientProfile{Platform: PlatformDesktop}).Supports("HEVC", "http://cdn.example/1.m3u8") {
+		t.Fatal("profile without declared limits rejected a candidate")
+	}
+}
+
+func TestApplyClientProfileRanksIncompatibleLastAndUsesProfileHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var gotProfile string
+	handler := &Handler{profiles: profileHealthReaderFunc(func(_ context.Context, profile string, resources []mediaidentity.ResourceRef) (map[mediaidentity.ResourceRef]mediaidentity.ProfileHealth, error) {
+		gotProfile = profile
+		return map[mediaidentity.ResourceRef]mediaidentity.ProfileHealth{
+			// 全局统计最好的资源在 iOS 上几乎全部失败。
+			{SourceKey: "global", VodID: "a"}: {SuccessCount: 1, FailureCount: 29},
+			{SourceKey: "ios", VodID: "b"}:    {SuccessCount: 28, FailureCount: 2},
+		}, nil
+	})}
+	ginContext, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ginContext.Request = httptest.NewRequest(http.MethodGet, "/api/v2/media-units/1/playback-candidates?platform=ios&codecs=h264&https_only=1", nil)
+	candidates := []SourceCandidate{
+		{SourceKey: "insecure", VodID: "c", SeasonNumber: 1, EpisodeKey: "E01", PlayURL: "http://cdn.example/c.m3u8",
+			Health: PlaybackHealth{SuccessCount: 500}},
+		{SourceKey: "global", VodID: "a", SeasonNumber: 1, EpisodeKey: "E01", PlayURL: "https://cdn.example/a.m3u8",
+			Health: PlaybackHealth{SuccessCount: 95, FailureCount: 5}},
+		{SourceKey: "ios", VodID: "b", SeasonNumber: 1, EpisodeKey: "E01", PlayURL: "https://cdn.example/b.m3u8",
+			Health: PlaybackHealth{SuccessCount: 60, FailureCount: 40}},
+	}
+	ranked := handler.rankForClient(ginContext, candidates, 1, "E01")
+	if gotProfile != "ios-mse" {
+		t.Fatalf("profile key = %q", gotProfile)
+	}
+	if len(ranked) != 3 || ranked[0].SourceKey != "ios" || ranked[1].SourceKey != "global" || ranked[2].SourceKey != "insecure" {
+		t.Fatalf("ranked = %+v", ranked)
+	}
+	if !ranked[2].Incompatible {
+		t.Fatalf("insecure candidate not marked incompatible: %+v", ranked[2])
+	}
+}
+
+func TestTVBoxConfigForwardsClientProfileToVODAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	ginContext, _ := gin.CreateTestContext(recorder)
+	ginContext.Request = httptest.NewRequest(http.MethodGet, "/api/tvbox.json?platform=tvbox&codecs=h264&native_hls=1", nil)
+	ginContext.Request.Host = "tv.example"
+	(&Handler{}).tvboxConfig(ginContext)
+	payload := decodeJSON(t, recorder)
+	api := payload["sites"].([]any)[0].(map[string]any)["api"]
+	if api != "http://tv.example/api/vod?codecs=h264&native_hls=1&platform=tvbox" {
+		t.Fatalf("api = %v", api)
+	}
+}
@@ -0,0 +1,166 @@
+package recommendation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+// TaskCooccurrence 是统一 Worker 队列中重算作品共现表的全局任务。
+const TaskCooccurrence = "recommendation_cooccurrence"
+
+const (
+	// cooccurrenceUserHistory 是每位用户参与计算的最近作品数。共现对数随历史长度平方增长，
+	// 重度用户不截断的话一个人就能产生几十万对。
+	cooccurrenceUserHistory = 200
+	// cooccurrenceMinSharedUsers 是一对作品至少要被这么多人同时看过才记下，一个人的巧合不算。
+	cooccurrenceMinSharedUsers = 2
+	// cooccurrenceNeighbors 是每部作品保留的最相关作品数。
+	cooccurrenceNeighbors = 50
+)
+
+// CollaborativeMatch 是协同过滤给出的一部作品。SharedUsers 是共同看过的人数，
+// 按用户汇总多部作品时是各部之和；Score 是共现余弦相似度，汇总时同样相加。
+type CollaborativeMatch struct {
+	MediaID     int
+	SharedUsers int
+	Score       float64
+}
+
+// CooccurrenceStore 保存 media_cooccurrence，由 Worker 定期整表重算。
+type CooccurrenceStore struct{ database database.Executor }
+
+func NewCooccurrenceStore(executor database.Executor) *CooccurrenceStore {
+	return &CooccurrenceStore{database: executor}
+}
+
+// engagementsQuery 是「看过」的定义，每位用户每部作品一行，带最近一次互动时间：
+// user_movies 里标记看过且没打低分的、以及看了 5% 以上的播放记录；想看不算，那只是意向。
+// 已并入别的作品的重复条目不算，它的记录合并时已挪到保留作品上，剩下的是重复标记。
+// 共现重算和离线评估用同一个口径。
+const engagementsQuery = `SELECT user_id, media_id, MAX(activity_at) AS activity_at FROM (
+    SELECT user_id, media_id, updated_at AS activity_at FROM user_movies
+    WHERE media_id IS NOT NULL AND status = 'watched' AND (rating = 0 OR rating >= 3)
+    UNION ALL SELECT user_id, media_id, activity_at FROM playback_positions
+    WHERE media_id IS NOT NULL AND deleted_at IS NULL AND progress_percent > 5
+) source
+WHERE NOT EXISTS (SELECT 1 FROM media merged WHERE merged.id = source.media_id AND merged.merged_into_id IS NOT NULL)
+GROUP BY user_id, media_id`
+
+// Rebuild 在一个事务里清空并重算共现表，返回写入的行数。
+func (store *CooccurrenceStore) Rebuild(ctx context.Context) (int64, error) {
+	beginner, ok := store.database.(database.Beginner)
+	if !ok {
+		return 0, fmt.Errorf("rebuild media cooccurrence: executor does not support transactions")
+	}
+	transaction, err := beginner.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin media cooccurrence rebuild: %w", err)
+	}
+	defer transaction.Rollback(context.WithoutCancel(ctx))
+	inserted, err := rebuildCooccurrence(ctx, transaction)
+	if err != nil {
+		return 0, err
+	}
+	if err := transaction.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit media cooccurrence: %w", err)
+	}
+	return inserted, nil
+}
+
+// rebuildCooccurrence 在调用方的事务里重算共现表，离线评估借它在回滚前算出留出后的共现。
+func rebuildCooccurrence(ctx context.Context, executor database.Executor) (int64, error) {
+	if _, err := executor.Exec(ctx, `DELETE FROM media_cooccurrence`); err != nil {
+		return 0, fmt.Errorf("clear media cooccurrence: %w", err)
+	}
+	inserted, err := executor.Exec(ctx, `INSERT INTO media_cooccurrence (media_id, related_media_id, shared_users, score, computed_at)
+WITH engagements AS (`+engagementsQuery+`), recent AS (
+    SELECT user_id, media_id FROM (
+        SELECT user_id, media_id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY activity_at DESC, media_id) AS position
+        FROM engagements
+    ) ranked WHERE position <= $1
+), audience AS (
+    SELECT media_id, COUNT(*) AS users FROM recent GROUP BY media_id
+), pairs AS (
+    SELECT left_side.media_id, right_side.media_id AS related_media_id, COUNT(*) AS shared_users
+    FROM recent left_side JOIN recent right_side ON right_side.user_id = left_side.user_id AND right_side.media_id <> left_side.media_id
+    GROUP BY left_side.media_id, right_side.media_id HAVING COUNT(*) >= $2
+), ranked AS (
+    SELECT pairs.media_id, pairs.related_media_id, pairs.shared_users,
+           pairs.shared_users::double precision / SQRT(left_audience.users * right_audience.users) AS score
+    FROM pairs
+    JOIN audience left_audience ON left_audience.media_id = pairs.media_id
+    JOIN audience right_audience ON right_audience.media_id = pairs.related_media_id
+)
+SELECT media_id, related_media_id, shared_users, score, NOW() FROM (
+    SELECT ranked.*, ROW_NUMBER() OVER (PARTITION BY media_id ORDER BY score DESC, shared_users DESC, related_media_id) AS position
+    FROM ranked
+) neighbors WHERE position <= $3`, cooccurrenceUserHistory, cooccurrenceMinSharedUsers, cooccurrenceNeighbors)
+	if err != nil {
+		return 0, fmt.Errorf("compute media cooccurrence: %w", err)
+	}
+	return inserted, nil
+}
+
+// Related 返回和一部作品共现最强的作品。没人一起看过的冷门作品返回空列表。
+func (store *CooccurrenceStore) Related(ctx context.Context, mediaID, limit int) ([]CollaborativeMatch, error) {
+	rows, err := store.database.Query(ctx, `SELECT related_media_id, shared_users, score
+FROM media_cooccurrence WHERE media_id = $1 ORDER BY score DESC, related_media_id LIMIT $2`, mediaID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("related media cooccurrence: %w", err)
+	}
+	return scanCollaborativeMatches(rows, "related media cooccurrence")
+}
+
+// ForUser 汇总用户看过的每部作品的共现邻居，给「为你推荐」用。
+// 排除规则和口味向量推荐一致：片单里的、看过一部分的、点过不感兴趣的都不要。
+func (store *CooccurrenceStore) ForUser(ctx context.Context, userID, limit int) ([]CollaborativeMatch, error) {
+	rows, err := store.database.Query(ctx, `WITH watched AS (
+    SELECT media_id FROM user_movies
+    WHERE user_id = $1 AND media_id IS NOT NULL AND status = 'watched' AND (rating = 0 OR rating >= 3)
+    UNION SELECT media_id FROM playback_positions
+    WHERE user_id = $1 AND media_id IS NOT NULL AND deleted_at IS NULL AND progress_percent > 5
+), excluded_ids AS (
+    SELECT media_id FROM user_movies WHERE user_id = $1 AND media_id IS NOT NULL
+    UNION SELECT media_id FROM playback_positions WHERE user_id = $1 AND media_id IS NOT NULL AND deleted_at IS NULL
+    UNION SELECT media_id FROM recommendation_feedback WHERE user_id = $1
+)
+SELECT cooccurrence.related_media_id, SUM(cooccurrence.shared_users)::integer, SUM(cooccurrence.score)
+FROM media_cooccurrence cooccurrence JOIN watched ON watched.media_id = cooccurrence.media_id
+WHERE cooccurrence.related_media_id NOT IN (SELECT media_id FROM excluded_ids)
+GROUP BY cooccurrence.related_media_id
+ORDER BY SUM(cooccurrence.score) DESC, cooccurrence.related_media_id LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("user media cooccurrence: %w", err)
+	}
+	return scanCollaborativeMatches(rows, "user media cooccurrence")
+}
+
+// Handle 是 Worker 任务入口。
+func (store *CooccurrenceStore) Handle(ctx context.Context, _ workqueue.Job) error {
+	inserted, err := store.Rebuild(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("media cooccurrence rebuilt", "pairs", inserted)
+	return nil
+}
+
+func scanCollaborativeMatches(rows database.Rows, label string) ([]CollaborativeMatch, error) {
+	defer rows.Close()
+	matches := make([]CollaborativeMatch, 0)
+	for rows.Next() {
+		var match CollaborativeMatch
+		if err := rows.Scan(&match.MediaID, &match.SharedUsers, &match.Score); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", label, err)
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate %s: %w", label, err)
+	}
+	return matches, nil
+}
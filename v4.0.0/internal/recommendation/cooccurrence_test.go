@@ -0,0 +1,50 @@
+package recommendation
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+func TestCooccurrenceRebuildKeepsSharedPairsAndSkipsDislikes(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 1, 2, 3)
+	testdb.Media(t, pool, 1, 2, 3, 4)
+	for _, watched := range []struct{ userID, mediaID, rating int }{
+		{1, 1, 5}, {1, 2, 0}, {2, 1, 4}, {2, 2, 3}, {3, 1, 0}, {3, 3, 5},
+		// 打了一星的不算「看过」，不会和 1 号作品凑成一对。
+		{1, 4, 1}, {2, 4, 2},
+	} {
+		if _, err := pool.Exec(t.Context(), `INSERT INTO user_movies (user_id, media_id, movie_id, status, rating)
+VALUES ($1, $2, $3, 'watched', $4)`, watched.userID, watched.mediaID, strconv.Itoa(watched.mediaID), watched.rating); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := NewCooccurrenceStore(pool)
+	if err := store.Handle(t.Context(), workqueue.Job{}); err != nil {
+		t.Fatal(err)
+	}
+	related, err := store.Related(t.Context(), 1, 10)
+	if err != nil || len(related) != 1 || related[0].MediaID != 2 || related[0].SharedUsers != 2 ||
+		math.Abs(related[0].Score-2/math.Sqrt(6)) > 1e-9 {
+		t.Fatalf("related/error = %+v/%v", related, err)
+	}
+	// 3 号用户只和别人共同看过 1 号作品，2 号作品推给他；1 号用户两部都看过，没有可推的。
+	if matches, err := store.ForUser(t.Context(), 3, 10); err != nil || len(matches) != 1 || matches[0].MediaID != 2 {
+		t.Fatalf("user 3 matches/error = %+v/%v", matches, err)
+	}
+	if matches, err := store.ForUser(t.Context(), 1, 10); err != nil || len(matches) != 0 {
+		t.Fatalf("user 1 matches/error = %+v/%v", matches, err)
+	}
+	// 重算是整表替换，不会越积越多。
+	if _, err := store.Rebuild(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	var pairs int
+	if err := pool.QueryRow(t.Context(), `SELECT COUNT(*) FROM media_cooccurrence`).Scan(&pairs); err != nil || pairs != 2 {
+		t.Fatalf("pairs/error = %d/%v", pairs, err)
+	}
+}
@@ -0,0 +1,487 @@
+package recommendation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+	"github.com/TwoThreeWang/Moovie/new/internal/library"
+	"github.com/TwoThreeWang/Moovie/new/internal/mediaidentity"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
+)
+
+// TaskDigest 是统一 Worker 队列中生成每周「本周上新」摘要的全局任务。
+const TaskDigest = "recommendation_digest"
+
+const (
+	// digestPlayableLimit 是一周内新上线作品的读取上限，所有用户共用这一批候选。
+	digestPlayableLimit = 500
+	// digestForYouLimit 是「新上线、合你口味」最多收录的部数。
+	digestForYouLimit = 12
+	// digestMinimumSimilarity 是口味向量和作品向量的最低余弦相似度，低于它的新片不算「合你口味」。
+	digestMinimumSimilarity = 0.3
+	// digestActiveDays 是参与生成的用户范围：最近这么多天有过片单或播放互动。
+	digestActiveDays = 90
+	// digestUserBatch 是一次任务最多生成的用户数，剩下的留给下一次调度。
+	digestUserBatch = 2000
+	// shelfPlaying 是 userShelf 里表示「在看」的状态，来自播放记录而不是片单。
+	shelfPlaying = "playing"
+)
+
+// DigestItem 是摘要里的一部作品。Note 是卡片上的一句说明，At 是它上线或更新的时间。
+type DigestItem struct {
+	MediaID  int       `json:"media_id"`
+	DoubanID string    `json:"douban_id"`
+	Title    string    `json:"title"`
+	Year     string    `json:"year"`
+	Poster   string    `json:"poster"`
+	Note     string    `json:"note"`
+	At       time.Time `json:"at"`
+}
+
+// DetailKey 是作品详情页的标识，规则与 catalog.Movie.DetailKey 一致。
+func (item DigestItem) DetailKey() string {
+	return catalog.Movie{ID: item.MediaID, DoubanID: item.DoubanID}.DetailKey()
+}
+
+// Digest 是一位用户一周的「本周上新」。WeekStart 是生成那一周的周一零点，
+// 内容覆盖的是它之前的七天。
+type Digest struct {
+	UserID        int          `json:"-"`
+	WeekStart     time.Time    `json:"week_start"`
+	GeneratedAt   time.Time    `json:"generated_at"`
+	NewForYou     []DigestItem `json:"new_for_you"`
+	NewEpisodes   []DigestItem `json:"new_episodes"`
+	WishAvailable []DigestItem `json:"wish_available"`
+}
+
+// ItemCount 返回摘要里的作品总数。
+func (digest Digest) ItemCount() int {
+	return len(digest.NewForYou) + len(digest.NewEpisodes) + len(digest.WishAvailable)
+}
+
+// PeriodStart 是摘要覆盖区间的第一天。
+func (digest Digest) PeriodStart() time.Time {
+	return digest.WeekStart.AddDate(0, 0, -7)
+}
+
+// PeriodEnd 是摘要覆盖区间的最后一天。
+func (digest Digest) PeriodEnd() time.Time {
+	return digest.WeekStart.AddDate(0, 0, -1)
+}
+
+// DigestSection 是摘要里的一栏。
+type DigestSection struct {
+	Title string
+	Items []DigestItem
+}
+
+// Sections 按展示顺序返回有内容的栏目，用户中心和 RSS 正文共用。
+func (digest Digest) Sections() []DigestSection {
+	sections := make([]DigestSection, 0, 3)
+	for _, section := range []DigestSection{
+		{Title: "想看的片可以看了", Items: digest.WishAvailable},
+		{Title: "追的剧更新了", Items: digest.NewEpisodes},
+		{Title: "新上线，合你口味", Items: digest.NewForYou},
+	} {
+		if len(section.Items) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// DigestWeek 返回 moment 所在那一周的周一零点。
+func DigestWeek(moment time.Time, location *time.Location) time.Time {
+	if location == nil {
+		location = time.UTC
+	}
+	local := moment.In(location)
+	offset := (int(local.Weekday()) + 6) % 7
+	return time.Date(local.Year(), local.Month(), local.Day()-offset, 0, 0, 0, 0, location)
+}
+
+// playableMovie 是一部在区间内第一次可以播放的作品。
+type playableMovie struct {
+	movie catalog.Movie
+	at    time.Time
+}
+
+// episodeUpdate 是一部剧在区间内新增的可播放剧集。
+type episodeUpdate struct {
+	item     DigestItem
+	label    string
+	episodes int
+}
+
+// DigestStore 保存 user_digests，并提供生成摘要要用的几条查询。
+type DigestStore struct{ database database.Executor }
+
+func NewDigestStore(executor database.Executor) *DigestStore {
+	return &DigestStore{database: executor}
+}
+
+// playableResources 是作品关联的可播资源，口径见 mediaidentity.PlayableResourceFilter，
+// 没有分集、只能直接播放的资源也算。作品第一次有这样的资源就是「新上线」。
+const playableResources = `resource_media_links link
+JOIN vod_items resource ON resource.source_key = link.source_key AND resource.vod_id = link.vod_id
+WHERE link.media_id IS NOT NULL` + mediaidentity.PlayableResourceFilter
+
+// playableCandidates 是可以播放的分集：线路和分集都没有下架，所属资源也能播。
+const playableCandidates = `resource_episode_candidates candidate
+JOIN resource_play_lines line ON line.id = candidate.line_id
+JOIN vod_items resource ON resource.source_key = line.source_key AND resource.vod_id = line.vod_id
+WHERE candidate.media_id IS NOT NULL
+  AND candidate.resource_status NOT IN ('retired', 'deleted')
+  AND line.resource_status NOT IN ('retired', 'deleted')` + mediaidentity.PlayableCandidateFilter
+
+// Save 写入一位用户一周的摘要，同一周重复生成时覆盖。
+func (store *DigestStore) Save(ctx context.Context, digest Digest) error {
+	payload, err := json.Marshal(digest)
+	if err != nil {
+		return fmt.Errorf("encode digest: %w", err)
+	}
+	if _, err := store.database.Exec(ctx, `INSERT INTO user_digests (user_id, week_start, payload, item_count, generated_at)
+VALUES ($1, $2::date, $3::jsonb, $4, NOW())
+ON CONFLICT (user_id, week_start) DO UPDATE SET payload = EXCLUDED.payload,
+item_count = EXCLUDED.item_count, generated_at = EXCLUDED.generated_at`,
+		digest.UserID, digest.WeekStart.Format(time.DateOnly), string(payload), digest.ItemCount()); err != nil {
+		return fmt.Errorf("save digest: %w", err)
+	}
+	return nil
+}
+
+// Latest 返回用户最近一份有内容的摘要，没有时返回 (nil, nil)。
+func (store *DigestStore) Latest(ctx context.Context, userID int) (*Digest, error) {
+	digests, err := store.List(ctx, userID, 1)
+	if err != nil || len(digests) == 0 {
+		return nil, err
+	}
+	return &digests[0], nil
+}
+
+// List 按周倒序列出用户有内容的摘要，供 RSS 订阅使用。
+func (store *DigestStore) List(ctx context.Context, userID, limit int) ([]Digest, error) {
+	rows, err := store.database.Query(ctx, `SELECT payload, generated_at FROM user_digests
+WHERE user_id = $1 AND item_count > 0 ORDER BY week_start DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list digests: %w", err)
+	}
+	defer rows.Close()
+	digests := make([]Digest, 0, limit)
+	for rows.Next() {
+		var payload []byte
+		var generatedAt time.Time
+		if err := rows.Scan(&payload, &generatedAt); err != nil {
+			return nil, fmt.Errorf("scan digest: %w", err)
+		}
+		var digest Digest
+		if err := json.Unmarshal(payload, &digest); err != nil {
+			return nil, fmt.Errorf("decode digest: %w", err)
+		}
+		digest.UserID, digest.GeneratedAt = userID, generatedAt
+		digests = append(digests, digest)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate digests: %w", err)
+	}
+	return digests, nil
+}
+
+// pendingUsers 列出最近有过互动、但这一周还没有摘要的用户。
+// 任务中途失败或者超过一批时，下一次调度从没做完的用户继续。
+func (store *DigestStore) pendingUsers(ctx context.Context, weekStart, activeSince time.Time, limit int) ([]int, error) {
+	rows, err := store.database.Query(ctx, `SELECT user_id FROM (
+    SELECT user_id FROM user_movies WHERE updated_at >= $2
+    UNION SELECT user_id FROM playback_positions WHERE deleted_at IS NULL AND activity_at >= $2
+) active
+WHERE NOT EXISTS (SELECT 1 FROM user_digests digest WHERE digest.user_id = active.user_id AND digest.week_start = $1::date)
+ORDER BY user_id LIMIT $3`, weekStart.Format(time.DateOnly), activeSince, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list digest users: %w", err)
+	}
+	defer rows.Close()
+	users := make([]int, 0)
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("scan digest user: %w", err)
+		}
+		users = append(users, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate digest users: %w", err)
+	}
+	return users, nil
+}
+
+// newlyPlayable 返回 [since, until) 内第一次有可播放资源的作品 ID 和时间，按时间倒序。
+// 时间取资源关联到作品的时间。
+func (store *DigestStore) newlyPlayable(ctx context.Context, since, until time.Time, limit int) (map[int]time.Time, []int, error) {
+	rows, err := store.database.Query(ctx, `SELECT link.media_id, MIN(link.created_at) AS first_playable
+FROM `+playableResources+`
+GROUP BY link.media_id
+HAVING MIN(link.created_at) >= $1 AND MIN(link.created_at) < $2
+ORDER BY first_playable DESC LIMIT $3`, since, until, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list newly playable media: %w", err)
+	}
+	defer rows.Close()
+	times := make(map[int]time.Time)
+	order := make([]int, 0)
+	for rows.Next() {
+		var mediaID int
+		var at time.Time
+		if err := rows.Scan(&mediaID, &at); err != nil {
+			return nil, nil, fmt.Errorf("scan newly playable media: %w", err)
+		}
+		times[mediaID] = at
+		order = append(order, mediaID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate newly playable media: %w", err)
+	}
+	return times, order, nil
+}
+
+// userShelf 返回用户接触过的作品和状态：想看、看过，或者只有播放记录时的在看。
+// 一部作品同时想看又有播放记录时记为在看。
+func (store *DigestStore) userShelf(ctx context.Context, userID int) (map[int]string, error) {
+	rows, err := store.database.Query(ctx, `SELECT media_id, status FROM user_movies
+WHERE user_id = $1 AND media_id IS NOT NULL
+UNION ALL SELECT DISTINCT media_id, 'playing' FROM playback_positions
+WHERE user_id = $1 AND media_id IS NOT NULL AND deleted_at IS NULL`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("load digest shelf: %w", err)
+	}
+	defer rows.Close()
+	shelf := make(map[int]string)
+	for rows.Next() {
+		var mediaID int
+		var status string
+		if err := rows.Scan(&mediaID, &status); err != nil {
+			return nil, fmt.Errorf("scan digest shelf: %w", err)
+		}
+		if current := shelf[mediaID]; current == "" || (current == library.StatusWish && status == shelfPlaying) {
+			shelf[mediaID] = status
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate digest shelf: %w", err)
+	}
+	return shelf, nil
+}
+
+// newEpisodes 返回给定剧集在 [since, until) 内新增的可播放剧集，每部剧一行：最新一集的标签和新增集数。
+// 这一周才第一次能播的作品算「新上线」，不在这里重复出现。
+func (store *DigestStore) newEpisodes(ctx context.Context, mediaIDs []int, since, until time.Time) ([]episodeUpdate, error) {
+	if len(mediaIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]int64, len(mediaIDs))
+	for index, mediaID := range mediaIDs {
+		ids[index] = int64(mediaID)
+	}
+	rows, err := store.database.Query(ctx, `WITH fresh AS (
+    SELECT candidate.media_id, candidate.season_number, candidate.episode_key,
+           MAX(candidate.episode_label) AS episode_label, MAX(candidate.sort_order) AS sort_order,
+           MIN(candidate.created_at) AS created_at
+    FROM `+playableCandidates+`
+      AND candidate.media_id = ANY($1::bigint[])
+    GROUP BY candidate.media_id, candidate.season_number, candidate.episode_key
+    HAVING MIN(candidate.created_at) >= $2 AND MIN(candidate.created_at) < $3
+), ranked AS (
+    SELECT fresh.*, COUNT(*) OVER (PARTITION BY fresh.media_id) AS episodes,
+           ROW_NUMBER() OVER (PARTITION BY fresh.media_id ORDER BY fresh.season_number DESC, fresh.sort_order DESC, fresh.created_at DESC) AS position
+    FROM fresh
+    WHERE EXISTS (
+        SELECT 1 FROM `+playableCandidates+`
+          AND candidate.media_id = fresh.media_id AND candidate.created_at < $2
+    )
+)
+SELECT media.id, media.douban_id, media.title, media.year, media.poster,
+       ranked.episode_label, ranked.episodes, ranked.created_at
+FROM ranked JOIN media ON media.id = ranked.media_id
+WHERE ranked.position = 1
+ORDER BY ranked.created_at DESC`, ids, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("list new episodes: %w", err)
+	}
+	defer rows.Close()
+	updates := make([]episodeUpdate, 0)
+	for rows.Next() {
+		var update episodeUpdate
+		if err := rows.Scan(&update.item.MediaID, &update.item.DoubanID, &update.item.Title, &update.item.Year,
+			&update.item.Poster, &update.label, &update.episodes, &update.item.At); err != nil {
+			return nil, fmt.Errorf("scan new episode: %w", err)
+		}
+		updates = append(updates, update)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate new episodes: %w", err)
+	}
+	return updates, nil
+}
+
+// Digester 在 Worker 中生成每周摘要。
+type Digester struct {
+	store    *DigestStore
+	service  *Service
+	location *time.Location
+	now      func() time.Time
+}
+
+// NewDigester 创建摘要生成器。location 决定一周从哪天零点开始，和追剧日历用同一个时区。
+func NewDigester(store *DigestStore, service *Service, location *time.Location) *Digester {
+	return &Digester{store: store, service: service, location: location, now: time.Now}
+}
+
+// Handle 是每日调度的全局任务：给这一周还没有摘要的活跃用户各生成一份。
+// 新上线的作品只查一次，所有用户共用。单个用户失败不影响其他人，下次调度会重试。
+func (digester *Digester) Handle(ctx context.Context, _ workqueue.Job) error {
+	weekStart := DigestWeek(digester.now(), digester.location)
+	users, err := digester.store.pendingUsers(ctx, weekStart, digester.now().AddDate(0, 0, -digestActiveDays), digestUserBatch)
+	if err != nil || len(users) == 0 {
+		return err
+	}
+	playable, err := digester.playable(ctx, weekStart)
+	if err != nil {
+		return err
+	}
+	var failures []error
+	for _, userID := range users {
+		digest, err := digester.Generate(ctx, userID, weekStart, playable)
+		if err == nil {
+			err = digester.store.Save(ctx, digest)
+		}
+		if err != nil {
+			slog.Warn("generate weekly digest", "user_id", userID, "error", err)
+			failures = append(failures, err)
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("weekly digest failed for %d of %d users: %w", len(failures), len(users), errors.Join(failures...))
+	}
+	return nil
+}
+
+// playable 读取上一周第一次可以播放的作品详情，带向量。
+func (digester *Digester) playable(ctx context.Context, weekStart time.Time) ([]playableMovie, error) {
+	times, order, err := digester.store.newlyPlayable(ctx, weekStart.AddDate(0, 0, -7), weekStart, digestPlayableLimit)
+	if err != nil {
+		return nil, err
+	}
+	movies := make([]playableMovie, 0, len(order))
+	for _, mediaID := range order {
+		movie, err := digester.service.store.FindByID(ctx, mediaID)
+		if err != nil {
+			return nil, fmt.Errorf("load newly playable media %d: %w", mediaID, err)
+		}
+		if movie != nil {
+			movies = append(movies, playableMovie{movie: *movie, at: times[mediaID]})
+		}
+	}
+	return movies, nil
+}
+
+// Generate 计算一位用户这一周的摘要，playable 是上一周新上线的作品。
+func (digester *Digester) Generate(ctx context.Context, userID int, weekStart time.Time, playable []playableMovie) (Digest, error) {
+	shelf, err := digester.store.userShelf(ctx, userID)
+	if err != nil {
+		return Digest{}, err
+	}
+	signals, err := digester.service.tasteSignals(ctx, userID)
+	if err != nil {
+		return Digest{}, fmt.Errorf("digest taste: %w", err)
+	}
+	followed := make([]int, 0)
+	for mediaID, status := range shelf {
+		if status == library.StatusWish || status == shelfPlaying {
+			followed = append(followed, mediaID)
+		}
+	}
+	sort.Ints(followed)
+	episodes, err := digester.store.newEpisodes(ctx, followed, weekStart.AddDate(0, 0, -7), weekStart)
+	if err != nil {
+		return Digest{}, err
+	}
+	digest := composeDigest(signals, shelf, playable, episodes)
+	digest.UserID, digest.WeekStart, digest.GeneratedAt = userID, weekStart, digester.now()
+	return digest, nil
+}
+
+// composeDigest 把候选分进三栏：想看的片可以看了、想看或在看的剧有新集、
+// 没接触过且贴近口味向量的新片。接触过的作品（包括不感兴趣）不会作为新片推荐。
+func composeDigest(signals []catalog.TasteSignal, shelf map[int]string, playable []playableMovie, episodes []episodeUpdate) Digest {
+	digest := Digest{NewForYou: []DigestItem{}, NewEpisodes: []DigestItem{}, WishAvailable: []DigestItem{}}
+	touched := make(map[int]bool, len(signals))
+	for _, signal := range signals {
+		touched[signal.MediaID] = true
+	}
+	var taste []float64
+	if vector := catalog.TasteVector(signals); vector != nil {
+		taste = unitVector(vector)
+	}
+	type scored struct {
+		item       DigestItem
+		similarity float64
+	}
+	matches := make([]scored, 0)
+	for _, candidate := range playable {
+		item := digestItem(candidate.movie, candidate.at)
+		switch status := shelf[candidate.movie.ID]; {
+		case status == library.StatusWish:
+			item.Note = "想看的片可以看了"
+			digest.WishAvailable = append(digest.WishAvailable, item)
+		case status != "" || touched[candidate.movie.ID] || taste == nil || len(candidate.movie.Embedding) != len(taste):
+		default:
+			similarity := dot(taste, unitVector(candidate.movie.Embedding))
+			if similarity < digestMinimumSimilarity {
+				continue
+			}
+			item.Note = fmt.Sprintf("口味契合 %d%%", int(math.Round(similarity*100)))
+			matches = append(matches, scored{item: item, similarity: similarity})
+		}
+	}
+	sort.SliceStable(matches, func(left, right int) bool { return matches[left].similarity > matches[right].similarity })
+	for _, match := range matches[:min(len(matches), digestForYouLimit)] {
+		digest.NewForYou = append(digest.NewForYou, match.item)
+	}
+	for _, update := range episodes {
+		item := update.item
+		switch {
+		case update.label != "" && update.episodes > 1:
+			item.Note = fmt.Sprintf("更新到 %s，本周新增 %d 集", update.label, update.episodes)
+		case update.label != "":
+			item.Note = "更新到 " + update.label
+		default:
+			item.Note = fmt.Sprintf("本周新增 %d 集", update.episodes)
+		}
+		digest.NewEpisodes = append(digest.NewEpisodes, item)
+	}
+	return digest
+}
+
+// digestItem 把作品裁剪成摘要里存的字段。
+func digestItem(movie catalog.Movie, at time.Time) DigestItem {
+	return DigestItem{MediaID: movie.ID, DoubanID: movie.DoubanID, Title: movie.Title, Year: movie.Year, Poster: movie.Poster, At: at}
+}
+
+// loadDigest 读不到摘要时返回 nil，错误只记日志：摘要是用户中心的附加内容，不能因为它让页面报错。
+func loadDigest(ctx context.Context, store interface {
+	Latest(ctx context.Context, userID int) (*Digest, error)
+}, userID int) *Digest {
+	digest, err := store.Latest(ctx, userID)
+	if err != nil {
+		slog.Warn("load weekly digest", "user_id", userID, "error", err)
+		return nil
+	}
+	return digest
+}
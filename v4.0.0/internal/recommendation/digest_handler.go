@@ -0,0 +1,188 @@
+package recommendation
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"html"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// digestFeedLimit 是 RSS 订阅里保留的周数。
+	digestFeedLimit = 10
+	// digestFeedSignLabel 把订阅签名和站内其他 HMAC 用途区分开。
+	digestFeedSignLabel = "digest-feed:"
+)
+
+// DigestReader 是用户中心和 RSS 订阅读摘要的接口，由 DigestStore 实现。
+type DigestReader interface {
+	Latest(ctx context.Context, userID int) (*Digest, error)
+	List(ctx context.Context, userID, limit int) ([]Digest, error)
+}
+
+// WithDigests 注入每周摘要，用户中心的「上新」标签和 RSS 订阅读它。
+func (handler *Handler) WithDigests(digests DigestReader) *Handler {
+	handler.digests = digests
+	return handler
+}
+
+// dashboardDigest 渲染用户中心的「上新」标签：最近一份摘要和 RSS 订阅地址。
+func (handler *Handler) dashboardDigest(c *gin.Context) {
+	userID := auth.UserID(c)
+	if userID == 0 {
+		c.String(http.StatusOK, "未登录")
+		return
+	}
+	var digest *Digest
+	if handler.digests != nil {
+		digest = loadDigest(c.Request.Context(), handler.digests, userID)
+	}
+	c.HTML(http.StatusOK, "partials/dashboard_digest.html", gin.H{
+		"Digest":  digest,
+		"FeedURL": platformweb.CanonicalURL(handler.config.SiteURL, "/feed/digest/"+digestFeedToken(userID, handler.config.AppSecret)),
+	})
+}
+
+// digestFeed 返回一位用户的摘要 RSS。阅读器不带登录 Cookie，身份靠地址里的签名，
+// 地址只在用户中心展示给本人；更换 APP_SECRET 会让所有旧地址失效。
+func (handler *Handler) digestFeed(c *gin.Context) {
+	userID, ok := parseDigestFeedToken(c.Param("token"), handler.config.AppSecret)
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	digests := []Digest{}
+	if handler.digests != nil {
+		var err error
+		if digests, err = handler.digests.List(c.Request.Context(), userID, digestFeedLimit); err != nil {
+			slog.Warn("list weekly digests for feed", "user_id", userID, "error", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+	body, err := digestRSS(handler.config.SiteName, handler.config.SiteURL, digests)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Header("X-Robots-Tag", "noindex")
+	c.Data(http.StatusOK, "application/rss+xml; charset=utf-8", body)
+}
+
+// digestFeedToken 生成「用户 ID.签名」形式的订阅令牌，不会过期。
+func digestFeedToken(userID int, secret string) string {
+	id := strconv.Itoa(userID)
+	return id + "." + base64.RawURLEncoding.EncodeToString(digestFeedSignature(id, secret))
+}
+
+// parseDigestFeedToken 校验订阅令牌，返回用户 ID。
+func parseDigestFeedToken(token, secret string) (int, bool) {
+	id, signature, found := strings.Cut(token, ".")
+	if !found || secret == "" {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(id)
+	if err != nil || userID <= 0 {
+		return 0, false
+	}
+	expected, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, digestFeedSignature(id, secret)) {
+		return 0, false
+	}
+	return userID, true
+}
+
+// digestFeedSignature 计算 HMAC-SHA256 签名。
+func digestFeedSignature(id, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(digestFeedSignLabel + id))
+	return mac.Sum(nil)
+}
+
+// rssDocument 是 RSS 2.0 的根节点。
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel 是订阅频道，一周的摘要是其中一条。
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Language    string    `xml:"language"`
+	Items       []rssItem `xml:"item"`
+}
+
+// rssItem 是一周的摘要，Description 是转义后的 HTML 列表。
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+// rssGUID 是条目的唯一标识，不是可访问的链接。
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+// digestRSS 把摘要渲染成 RSS 2.0。
+func digestRSS(siteName, siteURL string, digests []Digest) ([]byte, error) {
+	document := rssDocument{Version: "2.0", Channel: rssChannel{
+		Title: "本周上新 - " + siteName, Link: platformweb.CanonicalURL(siteURL, "/dashboard"),
+		Description: "新上线且合你口味的作品、追的剧更新了几集、想看的片可以看了，每周一更新。",
+		Language:    "zh-CN", Items: make([]rssItem, 0, len(digests)),
+	}}
+	for _, digest := range digests {
+		document.Channel.Items = append(document.Channel.Items, rssItem{
+			Title: digest.PeriodStart().Format("1月2日") + " - " + digest.PeriodEnd().Format("1月2日") +
+				" 本周上新（" + strconv.Itoa(digest.ItemCount()) + " 部）",
+			Link:        platformweb.CanonicalURL(siteURL, "/dashboard"),
+			GUID:        rssGUID{Value: "digest-" + strconv.Itoa(digest.UserID) + "-" + digest.WeekStart.Format(time.DateOnly), IsPermaLink: "false"},
+			PubDate:     digest.GeneratedAt.Format(time.RFC1123Z),
+			Description: digestHTML(siteURL, digest),
+		})
+	}
+	body, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// digestHTML 把一周的摘要写成 RSS 正文里的 HTML，三栏各一个列表。
+func digestHTML(siteURL string, digest Digest) string {
+	var builder strings.Builder
+	for _, section := range digest.Sections() {
+		builder.WriteString("<h3>" + section.Title + "</h3><ul>")
+		for _, item := range section.Items {
+			link := platformweb.CanonicalURL(siteURL, "/movie/"+item.DetailKey())
+			builder.WriteString(`<li><a href="` + html.EscapeString(link) + `">` + html.EscapeString(item.Title) + "</a>")
+			if item.Year != "" {
+				builder.WriteString("（" + html.EscapeString(item.Year) + "）")
+			}
+			if item.Note != "" {
+				builder.WriteString(" · " + html.EscapeString(item.Note))
+			}
+			builder.WriteString("</li>")
+		}
+		builder.WriteString("</ul>")
+	}
+	return builder.String()
+}
@@ -0,0 +1,213 @@
+package recommendation
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/gin-gonic/gin"
+)
+
+func TestDigestWeekStartsOnMonday(t *testing.T) {
+	location := time.FixedZone("CST", 8*60*60)
+	monday := time.Date(2026, 3, 9, 0, 0, 0, 0, location)
+	for _, moment := range []time.Time{
+		monday, time.Date(2026, 3, 11, 15, 0, 0, 0, location),
+		// 东八区周日深夜在 UTC 还是周日下午，按东八区算仍属于 3 月 9 日那一周。
+		time.Date(2026, 3, 15, 15, 30, 0, 0, time.UTC),
+	} {
+		if week := DigestWeek(moment, location); !week.Equal(monday) {
+			t.Fatalf("DigestWeek(%v) = %v", moment, week)
+		}
+	}
+	if week := DigestWeek(time.Date(2026, 3, 15, 16, 30, 0, 0, time.UTC), location); !week.Equal(monday.AddDate(0, 0, 7)) {
+		t.Fatalf("next week = %v", week)
+	}
+}
+
+func TestComposeDigestSortsCandidatesIntoSections(t *testing.T) {
+	signals := []catalog.TasteSignal{
+		{MediaID: 1, Kind: "watched", Rating: 5, Embedding: []float32{1, 0}},
+		{MediaID: 5, Kind: "not_interested", Embedding: []float32{0.9, 0.1}},
+	}
+	shelf := map[int]string{1: "watched", 2: "wish", 3: shelfPlaying}
+	at := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+	playable := []playableMovie{
+		{movie: catalog.Movie{ID: 2, Title: "想看的", Embedding: []float32{0, 1}}, at: at},
+		{movie: catalog.Movie{ID: 4, Title: "合口味", Embedding: []float32{1, 0}}, at: at},
+		{movie: catalog.Movie{ID: 5, Title: "不感兴趣", Embedding: []float32{1, 0}}, at: at},
+		{movie: catalog.Movie{ID: 6, Title: "不合口味", Embedding: []float32{0, 1}}, at: at},
+		{movie: catalog.Movie{ID: 7, Title: "没有向量"}, at: at},
+	}
+	episodes := []episodeUpdate{
+		{item: DigestItem{MediaID: 3, Title: "在追的剧"}, label: "第8集", episodes: 2},
+		{item: DigestItem{MediaID: 8, Title: "只有一集"}, label: "第2集", episodes: 1},
+	}
+	digest := composeDigest(signals, shelf, playable, episodes)
+	if len(digest.WishAvailable) != 1 || digest.WishAvailable[0].MediaID != 2 {
+		t.Fatalf("wish available = %+v", digest.WishAvailable)
+	}
+	// 5 号被标了不感兴趣，6 号和口味正交，7 号没有向量，都不进「合你口味」。
+	if len(digest.NewForYou) != 1 || digest.NewForYou[0].MediaID != 4 || digest.NewForYou[0].Note != "口味契合 100%" {
+		t.Fatalf("new for you = %+v", digest.NewForYou)
+	}
+	if len(digest.NewEpisodes) != 2 || digest.NewEpisodes[0].Note != "更新到 第8集，本周新增 2 集" || digest.NewEpisodes[1].Note != "更新到 第2集" {
+		t.Fatalf("new episodes = %+v", digest.NewEpisodes)
+	}
+	if digest.ItemCount() != 4 || len(digest.Sections()) != 3 || digest.Sections()[0].Title != "想看的片可以看了" {
+		t.Fatalf("sections = %+v", digest.Sections())
+	}
+}
+
+func TestDigestFeedTokenRejectsTampering(t *testing.T) {
+	token := digestFeedToken(42, "secret")
+	if userID, ok := parseDigestFeedToken(token, "secret"); !ok || userID != 42 {
+		t.Fatalf("parse = %d/%v", userID, ok)
+	}
+	_, signature, _ := strings.Cut(token, ".")
+	for _, tampered := range []string{"43." + signature, token + "x", "42", ""} {
+		if _, ok := parseDigestFeedToken(tampered, "secret"); ok {
+			t.Fatalf("tampered token %q accepted", tampered)
+		}
+	}
+	if _, ok := parseDigestFeedToken(token, "other"); ok {
+		t.Fatal("token signed with another secret accepted")
+	}
+}
+
+func TestDigestDashboardAndFeed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	renderer, err := platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.HTMLRender = renderer
+	weekStart := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	reader := digestReaderStub{1: {{
+		UserID: 1, WeekStart: weekStart, GeneratedAt: weekStart.Add(time.Hour),
+		WishAvailable: []DigestItem{{MediaID: 9, DoubanID: "123", Title: "沙丘 <2>", Note: "想看的片可以看了"}},
+		NewEpisodes:   []DigestItem{{MediaID: 10, Title: "追的剧", Note: "更新到 第8集"}},
+	}}}
+	cfg := config.Config{SiteName: "Moovie影牛", SiteURL: "https://example.com", AppSecret: "secret"}
+	NewHandler(cfg, NewService(&hybridStoreStub{}), nil).WithDigests(reader).Register(router)
+
+	dashboard := authenticatedGet(router, "/api/htmx/dashboard/digest", recommendationToken(t, 1))
+	body := dashboard.Body.String()
+	if dashboard.Code != http.StatusOK || !strings.Contains(body, "3月2日 - 3月8日，共 2 部") || !strings.Contains(body, `href="/movie/m10"`) ||
+		!strings.Contains(body, "https://example.com/feed/digest/"+digestFeedToken(1, "secret")) {
+		t.Fatalf("dashboard = %d/%s", dashboard.Code, body)
+	}
+
+	feed := authenticatedGet(router, "/feed/digest/"+digestFeedToken(1, "secret"), "")
+	body = feed.Body.String()
+	if feed.Code != http.StatusOK || !strings.HasPrefix(feed.Header().Get("Content-Type"), "application/rss+xml") {
+		t.Fatalf("feed = %d/%s", feed.Code, feed.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{"<title>3月2日 - 3月8日 本周上新（2 部）</title>", `<guid isPermaLink="false">digest-1-2026-03-09</guid>`,
+		// 正文 HTML 先按 HTML 转义，再被 XML 转义一次。
+		"https://example.com/movie/123", "沙丘 &amp;lt;2&amp;gt;", "追的剧更新了"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("feed missing %q:\n%s", want, body)
+		}
+	}
+	if missing := authenticatedGet(router, "/feed/digest/1.forged", ""); missing.Code != http.StatusNotFound {
+		t.Fatalf("forged feed status = %d", missing.Code)
+	}
+}
+
+func TestDigestStoreFindsNewlyPlayableAndNewEpisodes(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 1, 2)
+	testdb.Media(t, pool, 1, 2, 3, 4, 5)
+	weekStart := time.Now().Truncate(24 * time.Hour)
+	// 1 号作品上周第一次能播；2 号剧早就能播，上周更新了两集；3 号作品只是上周又多了一条线路，不算新。
+	// 4 号只有直接播放的资源，也算新上线；5 号唯一的资源已下架，它和 2 号下架资源里的第 9 集都不算。
+	if _, err := pool.Exec(t.Context(), `INSERT INTO vod_items (source_key, vod_id, vod_play_url, resource_status) VALUES
+('site', 'a', 'play', 'active'), ('site', 'b', 'play', 'active'), ('site', 'c', 'play', 'active'),
+('site', 'd', 'play', 'active'), ('site', 'e', 'play', 'removed'), ('site', 'f', 'play', 'removed');
+INSERT INTO resource_play_lines (id, source_key, vod_id, line_key) VALUES
+(1, 'site', 'a', 'main'), (2, 'site', 'b', 'main'), (3, 'site', 'c', 'main'), (4, 'site', 'c', 'backup'), (5, 'site', 'e', 'main'), (6, 'site', 'f', 'main');`); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []struct {
+		vodID   string
+		mediaID int
+		daysAgo int
+	}{{"a", 1, 3}, {"b", 2, 30}, {"c", 3, 30}, {"d", 4, 2}, {"e", 5, 2}, {"f", 2, 1}} {
+		if _, err := pool.Exec(t.Context(), `INSERT INTO resource_media_links (source_key, vod_id, media_id, created_at)
+VALUES ('site', $1, $2, $3::timestamptz - $4::int * INTERVAL '1 day')`, link.vodID, link.mediaID, weekStart, link.daysAgo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, candidate := range []struct {
+		lineID, mediaID int
+		episode, label  string
+		sortOrder       int
+		daysAgo         int
+	}{
+		{1, 1, "1", "正片", 1, 3},
+		{2, 2, "1", "第1集", 1, 30}, {2, 2, "7", "第7集", 7, 4}, {2, 2, "8", "第8集", 8, 2}, {6, 2, "9", "第9集", 9, 1},
+		{3, 3, "1", "正片", 1, 30}, {4, 3, "1", "正片", 1, 2},
+		{5, 5, "1", "正片", 1, 2},
+	} {
+		if _, err := pool.Exec(t.Context(), `INSERT INTO resource_episode_candidates
+(line_id, media_id, episode_key, episode_label, play_url, sort_order, created_at)
+VALUES ($1, $2, $3, $4, 'https://example.com/v.m3u8', $5, $6::timestamptz - $7::int * INTERVAL '1 day')`,
+			candidate.lineID, candidate.mediaID, candidate.episode, candidate.label, candidate.sortOrder, weekStart, candidate.daysAgo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := pool.Exec(t.Context(), `INSERT INTO user_movies (user_id, media_id, movie_id, status, rating) VALUES (1, 1, 'm1', 'wish', 0), (1, 2, 'm2', 'wish', 0)`); err != nil {
+		t.Fatal(err)
+	}
+	store := NewDigestStore(pool)
+	since := weekStart.AddDate(0, 0, -7)
+	times, order, err := store.newlyPlayable(t.Context(), since, weekStart, 10)
+	if err != nil || len(order) != 2 || order[0] != 4 || order[1] != 1 || times[1].IsZero() {
+		t.Fatalf("newly playable = %v/%v", order, err)
+	}
+	updates, err := store.newEpisodes(t.Context(), []int{1, 2, 3, 5}, since, weekStart)
+	if err != nil || len(updates) != 1 || updates[0].item.MediaID != 2 || updates[0].label != "第8集" || updates[0].episodes != 2 {
+		t.Fatalf("new episodes = %+v/%v", updates, err)
+	}
+	shelf, err := store.userShelf(t.Context(), 1)
+	if err != nil || shelf[1] != "wish" || shelf[2] != "wish" {
+		t.Fatalf("shelf = %v/%v", shelf, err)
+	}
+
+	users, err := store.pendingUsers(t.Context(), weekStart, since, 10)
+	if err != nil || len(users) != 1 || users[0] != 1 {
+		t.Fatalf("pending users = %v/%v", users, err)
+	}
+	if err := store.Save(t.Context(), Digest{UserID: 1, WeekStart: weekStart, WishAvailable: []DigestItem{{MediaID: 1, Title: "一"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if users, err := store.pendingUsers(t.Context(), weekStart, since, 10); err != nil || len(users) != 0 {
+		t.Fatalf("pending after save = %v/%v", users, err)
+	}
+	latest, err := store.Latest(t.Context(), 1)
+	if err != nil || latest == nil || latest.ItemCount() != 1 || latest.WishAvailable[0].Title != "一" {
+		t.Fatalf("latest = %+v/%v", latest, err)
+	}
+}
+
+type digestReaderStub map[int][]Digest
+
+func (stub digestReaderStub) Latest(_ context.Context, userID int) (*Digest, error) {
+	if len(stub[userID]) == 0 {
+		return nil, nil
+	}
+	return &stub[userID][0], nil
+}
+
+func (stub digestReaderStub) List(_ context.Context, userID, limit int) ([]Digest, error) {
+	return stub[userID][:min(len(stub[userID]), limit)], nil
+}
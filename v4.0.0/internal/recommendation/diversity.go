@@ -0,0 +1,102 @@
+package recommendation
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+)
+
+// diversityLambda 是 MMR 里相关度的权重，剩下的 0.3 用来惩罚和已选影片太像的候选。
+// 取值偏向相关度：排在前面的好片不会因为「和别的片同类型」被挤到很后面，只是同系列、同导演的扎堆会被拆开。
+const diversityLambda = 0.7
+
+// 两部影片「像不像」的各维度权重：同系列最重，其次导演、类型，年代只做微调。
+const (
+	redundancyFranchiseWeight = 0.4
+	redundancyDirectorWeight  = 0.25
+	redundancyGenreWeight     = 0.25
+	redundancyEraWeight       = 0.1
+)
+
+var (
+	franchiseSeasonSuffix = regexp.MustCompile(`第[0-9一二三四五六七八九十]+[季部章]$`)
+	franchiseNumberSuffix = regexp.MustCompile(`[0-9一二三四五六七八九十ⅠⅡⅢⅣⅤⅥⅦⅧⅨⅩ]+$`)
+)
+
+// diversify 按 MMR（最大边际相关）重排：每一步选「相关度 × λ − 与已选影片的最大相似度 × (1−λ)」最高的那部。
+// 相关度按原来的名次线性给，所以第一部永远不变，头图不会被换掉。
+func diversify(movies []catalog.Movie) []catalog.Movie {
+	if len(movies) < 3 {
+		return movies
+	}
+	featureList := make([]features, len(movies))
+	for index, movie := range movies {
+		featureList[index] = extract(movie)
+	}
+	// redundancy[i] 是候选 i 与已选影片的最大相似度，每选一部增量更新。
+	redundancy := make([]float64, len(movies))
+	picked := make([]bool, len(movies))
+	result := make([]catalog.Movie, 0, len(movies))
+	for len(result) < len(movies) {
+		best, bestScore := -1, 0.0
+		for index := range movies {
+			if picked[index] {
+				continue
+			}
+			relevance := 1 - float64(index)/float64(len(movies))
+			if score := diversityLambda*relevance - (1-diversityLambda)*redundancy[index]; best < 0 || score > bestScore {
+				best, bestScore = index, score
+			}
+		}
+		picked[best] = true
+		result = append(result, movies[best])
+		for index := range movies {
+			if !picked[index] {
+				redundancy[index] = max(redundancy[index], movieRedundancy(featureList[best], featureList[index]))
+			}
+		}
+	}
+	return result
+}
+
+// movieRedundancy 是两部影片在系列、导演、类型和年代上的相似度（0~1）。
+func movieRedundancy(left, right features) float64 {
+	var franchise, director float64
+	if sameFranchise(left.title, right.title) {
+		franchise = 1
+	}
+	if score, _ := overlap(left.directors, right.directors); score > 0 {
+		director = 1
+	}
+	genre, _ := overlap(left.genres, right.genres)
+	era := 0.0
+	if left.year > 0 && right.year > 0 {
+		era = eraSimilarity(left.year, right.year)
+	}
+	return redundancyFranchiseWeight*franchise + redundancyDirectorWeight*director + redundancyGenreWeight*genre + redundancyEraWeight*era
+}
+
+// sameFranchise 判断是不是同一系列：一个片名是另一个的前缀（「银翼杀手」与「银翼杀手2049」），
+// 或者去掉副标题、季数和续集编号后相同（「速度与激情7」与「速度与激情8」）。
+func sameFranchise(left, right string) bool {
+	if left == "" || right == "" {
+		return false
+	}
+	if strings.HasPrefix(right, left) || strings.HasPrefix(left, right) {
+		return true
+	}
+	stem := franchiseStem(left)
+	return utf8.RuneCountInString(stem) >= 2 && stem == franchiseStem(right)
+}
+
+// franchiseStem 去掉片名里的副标题、「第二季」和末尾编号。只在冒号、括号和破折号处截断，
+// 空格和连字符是英文片名的一部分，按它们截断会让「The Matrix」和「The Godfather」都剩下「The」。
+func franchiseStem(title string) string {
+	if index := strings.IndexAny(title, "：:（(—"); index > 0 {
+		title = title[:index]
+	}
+	title = strings.TrimSpace(franchiseSeasonSuffix.ReplaceAllString(title, ""))
+	return strings.TrimSpace(franchiseNumberSuffix.ReplaceAllString(title, ""))
+}
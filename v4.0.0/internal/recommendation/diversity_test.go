@@ -0,0 +1,49 @@
+package recommendation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+)
+
+func TestDiversifyBreaksUpFranchiseRuns(t *testing.T) {
+	movies := []catalog.Movie{
+		{ID: 1, Title: "速度与激情7", Year: "2015", Genres: "动作,犯罪", Directors: `[{"name":"温子仁"}]`},
+		{ID: 2, Title: "速度与激情8", Year: "2017", Genres: "动作,犯罪", Directors: `[{"name":"F·加里·格雷"}]`},
+		{ID: 3, Title: "盗梦空间", Year: "2010", Genres: "科幻,悬疑", Directors: `[{"name":"克里斯托弗·诺兰"}]`},
+		{ID: 4, Title: "速度与激情9", Year: "2021", Genres: "动作,犯罪", Directors: `[{"name":"林诣彬"}]`},
+		{ID: 5, Title: "爱乐之城", Year: "2016", Genres: "爱情,歌舞", Directors: `[{"name":"达米恩·查泽雷"}]`},
+		{ID: 6, Title: "寄生虫", Year: "2019", Genres: "剧情,喜剧", Directors: `[{"name":"奉俊昊"}]`},
+	}
+	diversified := diversify(movies)
+	ids := make([]int, len(diversified))
+	for index, movie := range diversified {
+		ids[index] = movie.ID
+	}
+	// 第一部不动；同系列的续集被别的片隔开，但不会被挤出列表。
+	if !reflect.DeepEqual(ids, []int{1, 3, 2, 5, 4, 6}) {
+		t.Fatalf("diversified = %v", ids)
+	}
+	if short := diversify(movies[:2]); len(short) != 2 || short[1].ID != 2 {
+		t.Fatalf("short list reordered: %+v", short)
+	}
+}
+
+func TestSameFranchiseMatchesSequelsAndSeasons(t *testing.T) {
+	for _, pair := range [][2]string{{"速度与激情7", "速度与激情8"}, {"银翼杀手", "银翼杀手2049"}, {"漫长的季节", "漫长的季节 第二季"},
+		{"沙丘：第二部", "沙丘"}, {"Toy Story 2", "Toy Story 3"}, {"Spider-Man: No Way Home", "Spider-Man: Far From Home"}} {
+		if !sameFranchise(pair[0], pair[1]) {
+			t.Fatalf("%q and %q should be the same franchise", pair[0], pair[1])
+		}
+	}
+	if sameFranchise("星际穿越", "星际宝贝") || sameFranchise("", "沙丘") {
+		t.Fatal("unrelated titles matched")
+	}
+	// 只是开头的词相同，不算同一系列。
+	for _, pair := range [][2]string{{"The Matrix", "The Godfather"}, {"Star Wars", "Star Trek"}, {"X-Men", "X-Files"}} {
+		if sameFranchise(pair[0], pair[1]) {
+			t.Fatalf("%q and %q share only a leading word", pair[0], pair[1])
+		}
+	}
+}
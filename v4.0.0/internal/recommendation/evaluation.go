@@ -0,0 +1,345 @@
+package recommendation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+)
+
+// EvaluationOptions 是离线评估的参数。
+type EvaluationOptions struct {
+	// HoldOut 是每位用户留出的最后几部「看过」，推荐命中它们才算数。
+	HoldOut int
+	// K 是每个策略给每位用户推荐的影片数，指标都按前 K 部算。
+	K int
+	// MinHistory 是留出之后至少还要剩下的互动数，太少的用户口味向量没有意义，不参与评估。
+	MinHistory int
+	// MaxUsers 限制参与评估的用户数，按用户 ID 取前这么多位；0 表示不限。
+	MaxUsers int
+	// Collaborative 为真时在留出后的数据上重算共现表，评估协同过滤和混合排序。
+	Collaborative bool
+}
+
+// EvaluationReport 是一次离线评估的结果，按策略列出指标。
+type EvaluationReport struct {
+	HoldOut     int              `json:"hold_out"`
+	K           int              `json:"k"`
+	Users       int              `json:"users"`
+	CatalogSize int              `json:"catalog_size"`
+	Strategies  []StrategyReport `json:"strategies"`
+}
+
+// StrategyReport 是一个策略的指标。Recall 和 NDCG 按用户平均；Coverage 是所有推荐覆盖的作品占全库的比例；
+// Novelty 是推荐作品的平均自信息 −log2(看过它的用户占比)，越大说明推得越冷门。
+type StrategyReport struct {
+	Strategy string  `json:"strategy"`
+	Recall   float64 `json:"recall"`
+	NDCG     float64 `json:"ndcg"`
+	Coverage float64 `json:"coverage"`
+	Novelty  float64 `json:"novelty"`
+}
+
+// evaluationEngagement 是一条「看过」，口径见 engagementsQuery。
+type evaluationEngagement struct {
+	userID, mediaID int
+	activityAt      time.Time
+}
+
+// evaluationUser 是一位参与评估的用户：training 是留给策略看的历史，heldOut 是要猜中的最后几部。
+type evaluationUser struct {
+	id       int
+	training map[int]bool
+	heldOut  map[int]bool
+}
+
+// evaluationStrategy 给一位用户推荐至多 k 部作品，返回 media.id。
+type evaluationStrategy struct {
+	name      string
+	recommend func(ctx context.Context, user evaluationUser, k int) ([]int, error)
+}
+
+// Evaluate 按时间留出法离线评估当前的推荐策略。
+// 所有操作都在一个最后回滚的事务里：先把每位用户最后 HoldOut 部「看过」从 user_movies 删掉、把对应播放记录标成已删除，
+// 需要时重算共现表，再用和线上相同的 Service 代码给每位用户推荐，和留出的作品比对。库里的数据不会被改动，
+// 但事务期间会锁住这些行，只应对测试库或本地导入的副本运行。
+func Evaluate(ctx context.Context, beginner database.Beginner, options EvaluationOptions) (EvaluationReport, error) {
+	if options.HoldOut < 1 || options.K < 1 || options.MinHistory < 1 {
+		return EvaluationReport{}, fmt.Errorf("evaluate recommendations: hold-out, k and min history must be positive")
+	}
+	transaction, err := beginner.Begin(ctx)
+	if err != nil {
+		return EvaluationReport{}, fmt.Errorf("begin recommendation evaluation: %w", err)
+	}
+	defer transaction.Rollback(context.WithoutCancel(ctx))
+
+	engagements, err := loadEngagements(ctx, transaction)
+	if err != nil {
+		return EvaluationReport{}, err
+	}
+	users := splitEngagements(engagements, options.HoldOut, options.MinHistory)
+	if options.MaxUsers > 0 && len(users) > options.MaxUsers {
+		users = users[:options.MaxUsers]
+	}
+	report := EvaluationReport{HoldOut: options.HoldOut, K: options.K, Users: len(users), Strategies: []StrategyReport{}}
+	if err := transaction.QueryRow(ctx, `SELECT COUNT(*) FROM media`).Scan(&report.CatalogSize); err != nil {
+		return EvaluationReport{}, fmt.Errorf("count evaluation catalog: %w", err)
+	}
+	if len(users) == 0 {
+		return report, nil
+	}
+	if err := hideHeldOut(ctx, transaction, users); err != nil {
+		return EvaluationReport{}, err
+	}
+
+	movies := catalog.NewPostgresStore(transaction)
+	serviceOptions := []ServiceOption{WithPersonalizer(movies)}
+	var cooccurrence *CooccurrenceStore
+	if options.Collaborative {
+		if _, err := rebuildCooccurrence(ctx, transaction); err != nil {
+			return EvaluationReport{}, fmt.Errorf("evaluation cooccurrence: %w", err)
+		}
+		cooccurrence = NewCooccurrenceStore(transaction)
+		serviceOptions = append(serviceOptions, WithCollaborative(cooccurrence))
+	}
+	service := NewService(movies, serviceOptions...)
+	strategies, err := evaluationStrategies(ctx, service, cooccurrence, users, options.K)
+	if err != nil {
+		return EvaluationReport{}, err
+	}
+	popularity, audience := trainingPopularity(engagements, users)
+	for _, strategy := range strategies {
+		result, err := evaluateStrategy(ctx, strategy, users, options.K, popularity, audience, report.CatalogSize)
+		if err != nil {
+			return EvaluationReport{}, err
+		}
+		report.Strategies = append(report.Strategies, result)
+	}
+	return report, nil
+}
+
+// loadEngagements 按用户、时间顺序读出全部「看过」。
+func loadEngagements(ctx context.Context, executor database.Executor) ([]evaluationEngagement, error) {
+	rows, err := executor.Query(ctx, `SELECT user_id, media_id, activity_at FROM (`+engagementsQuery+`) engagements
+ORDER BY user_id, activity_at, media_id`)
+	if err != nil {
+		return nil, fmt.Errorf("load evaluation engagements: %w", err)
+	}
+	defer rows.Close()
+	engagements := make([]evaluationEngagement, 0)
+	for rows.Next() {
+		var engagement evaluationEngagement
+		if err := rows.Scan(&engagement.userID, &engagement.mediaID, &engagement.activityAt); err != nil {
+			return nil, fmt.Errorf("scan evaluation engagement: %w", err)
+		}
+		engagements = append(engagements, engagement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate evaluation engagements: %w", err)
+	}
+	return engagements, nil
+}
+
+// splitEngagements 对每位用户按时间留出最后 holdOut 部，前面至少要剩 minHistory 部，按用户 ID 排序返回。
+// engagements 要按用户、时间升序排好。
+func splitEngagements(engagements []evaluationEngagement, holdOut, minHistory int) []evaluationUser {
+	users := make([]evaluationUser, 0)
+	for start := 0; start < len(engagements); {
+		end := start
+		for end < len(engagements) && engagements[end].userID == engagements[start].userID {
+			end++
+		}
+		if history := engagements[start:end]; len(history) >= holdOut+minHistory {
+			user := evaluationUser{id: history[0].userID, training: make(map[int]bool), heldOut: make(map[int]bool)}
+			cut := len(history) - holdOut
+			for index, engagement := range history {
+				if index < cut {
+					user.training[engagement.mediaID] = true
+				} else {
+					user.heldOut[engagement.mediaID] = true
+				}
+			}
+			users = append(users, user)
+		}
+		start = end
+	}
+	sort.Slice(users, func(left, right int) bool { return users[left].id < users[right].id })
+	return users
+}
+
+// hideHeldOut 在评估事务里藏起留出的互动，策略读到的就是「那之前」的用户。
+func hideHeldOut(ctx context.Context, executor database.Executor, users []evaluationUser) error {
+	userIDs, mediaIDs := make([]int64, 0, len(users)), make([]int64, 0, len(users))
+	for _, user := range users {
+		for mediaID := range user.heldOut {
+			userIDs, mediaIDs = append(userIDs, int64(user.id)), append(mediaIDs, int64(mediaID))
+		}
+	}
+	if _, err := executor.Exec(ctx, `DELETE FROM user_movies movie USING unnest($1::bigint[], $2::bigint[]) AS held(user_id, media_id)
+WHERE movie.user_id = held.user_id AND movie.media_id = held.media_id`, userIDs, mediaIDs); err != nil {
+		return fmt.Errorf("hide held-out user movies: %w", err)
+	}
+	if _, err := executor.Exec(ctx, `UPDATE playback_positions position SET deleted_at = NOW()
+FROM unnest($1::bigint[], $2::bigint[]) AS held(user_id, media_id)
+WHERE position.user_id = held.user_id AND position.media_id = held.media_id AND position.deleted_at IS NULL`, userIDs, mediaIDs); err != nil {
+		return fmt.Errorf("hide held-out playback positions: %w", err)
+	}
+	return nil
+}
+
+// evaluationStrategies 是要比较的策略：评分热门基线、单一口味向量、协同过滤、向量和协同的混合，
+// 以及「为你推荐」快照实际的展示顺序（头图、兴趣行、猜你喜欢）。没有重算共现时不评估协同相关的两项。
+func evaluationStrategies(ctx context.Context, service *Service, cooccurrence *CooccurrenceStore, users []evaluationUser, k int) ([]evaluationStrategy, error) {
+	longestHistory := 0
+	for _, user := range users {
+		longestHistory = max(longestHistory, len(user.training))
+	}
+	// 热门榜不排除用户看过的，多取一些在 Go 里按各人的历史过滤。
+	popular, err := service.Popular(ctx, k+longestHistory)
+	if err != nil {
+		return nil, fmt.Errorf("evaluation popular baseline: %w", err)
+	}
+	strategies := []evaluationStrategy{
+		{name: "popular", recommend: func(_ context.Context, user evaluationUser, k int) ([]int, error) {
+			ids := make([]int, 0, k)
+			for _, movie := range popular {
+				if len(ids) < k && !user.training[movie.ID] {
+					ids = append(ids, movie.ID)
+				}
+			}
+			return ids, nil
+		}},
+		{name: "vector", recommend: func(ctx context.Context, user evaluationUser, k int) ([]int, error) {
+			movies, err := service.UserRecommendations(ctx, user.id, k)
+			return movieIDs(movies), err
+		}},
+	}
+	if cooccurrence != nil {
+		strategies = append(strategies,
+			evaluationStrategy{name: "collaborative", recommend: func(ctx context.Context, user evaluationUser, k int) ([]int, error) {
+				matches, err := cooccurrence.ForUser(ctx, user.id, k)
+				ids := make([]int, len(matches))
+				for index, match := range matches {
+					ids[index] = match.MediaID
+				}
+				return ids, err
+			}},
+			evaluationStrategy{name: "hybrid", recommend: func(ctx context.Context, user evaluationUser, k int) ([]int, error) {
+				movies, err := service.UserRecommendations(ctx, user.id, 60)
+				if err != nil {
+					return nil, err
+				}
+				return movieIDs(service.blendUserCollaborative(ctx, user.id, movies, nil, nil)), nil
+			}})
+	}
+	strategies = append(strategies, evaluationStrategy{name: "foryou", recommend: func(ctx context.Context, user evaluationUser, _ int) ([]int, error) {
+		data := buildForYou(ctx, service, user.id)
+		shown := make([]catalog.Movie, 0, len(data.Personalized)+1)
+		if data.HeroMovie != nil {
+			shown = append(shown, *data.HeroMovie)
+		}
+		for _, row := range data.Interests {
+			shown = append(shown, row.Movies...)
+		}
+		return movieIDs(append(shown, data.Personalized...)), nil
+	}})
+	return strategies, nil
+}
+
+// evaluateStrategy 让一个策略给每位用户推荐，汇总四项指标。
+func evaluateStrategy(ctx context.Context, strategy evaluationStrategy, users []evaluationUser, k int,
+	popularity map[int]int, audience, catalogSize int) (StrategyReport, error) {
+	report := StrategyReport{Strategy: strategy.name}
+	covered := make(map[int]bool)
+	var noveltySum float64
+	var recommendedCount int
+	for _, user := range users {
+		ids, err := strategy.recommend(ctx, user, k)
+		if err != nil {
+			return StrategyReport{}, fmt.Errorf("evaluate %s for user %d: %w", strategy.name, user.id, err)
+		}
+		ids = ids[:min(len(ids), k)]
+		report.Recall += recallAt(ids, user.heldOut)
+		report.NDCG += ndcgAt(ids, user.heldOut, k)
+		for _, mediaID := range ids {
+			covered[mediaID] = true
+			noveltySum += selfInformation(popularity[mediaID], audience)
+			recommendedCount++
+		}
+	}
+	report.Recall /= float64(len(users))
+	report.NDCG /= float64(len(users))
+	if catalogSize > 0 {
+		report.Coverage = float64(len(covered)) / float64(catalogSize)
+	}
+	if recommendedCount > 0 {
+		report.Novelty = noveltySum / float64(recommendedCount)
+	}
+	return report, nil
+}
+
+// trainingPopularity 数每部作品在留出后的数据里被多少位用户看过，第二个返回值是有「看过」记录的总人数，用来算新颖度。
+func trainingPopularity(engagements []evaluationEngagement, users []evaluationUser) (map[int]int, int) {
+	heldOut := make(map[int]map[int]bool, len(users))
+	for _, user := range users {
+		heldOut[user.id] = user.heldOut
+	}
+	popularity := make(map[int]int)
+	audience := make(map[int]bool)
+	for _, engagement := range engagements {
+		audience[engagement.userID] = true
+		if !heldOut[engagement.userID][engagement.mediaID] {
+			popularity[engagement.mediaID]++
+		}
+	}
+	return popularity, len(audience)
+}
+
+// recallAt 是命中的留出作品占全部留出作品的比例。
+func recallAt(recommended []int, relevant map[int]bool) float64 {
+	if len(relevant) == 0 {
+		return 0
+	}
+	hits := 0
+	for _, mediaID := range recommended {
+		if relevant[mediaID] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(relevant))
+}
+
+// ndcgAt 是二元相关度的 NDCG@k：命中越靠前得分越高，全部留出作品排在最前面时为 1。
+func ndcgAt(recommended []int, relevant map[int]bool, k int) float64 {
+	var dcg, ideal float64
+	for rank, mediaID := range recommended {
+		if relevant[mediaID] {
+			dcg += 1 / math.Log2(float64(rank+2))
+		}
+	}
+	for rank := 0; rank < min(len(relevant), k); rank++ {
+		ideal += 1 / math.Log2(float64(rank+2))
+	}
+	if ideal == 0 {
+		return 0
+	}
+	return dcg / ideal
+}
+
+// selfInformation 是 −log2(看过的人数占比)，分子分母各加一，没人看过的作品不会得到无穷大。
+func selfInformation(viewers, users int) float64 {
+	return -math.Log2(float64(viewers+1) / float64(users+1))
+}
+
+// movieIDs 取出影片的 media.id。
+func movieIDs(movies []catalog.Movie) []int {
+	ids := make([]int, len(movies))
+	for index, movie := range movies {
+		ids[index] = movie.ID
+	}
+	return ids
+}
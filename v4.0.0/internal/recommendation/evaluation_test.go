@@ -0,0 +1,82 @@
+package recommendation
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
+)
+
+func TestSplitEngagementsHoldsOutTheLatestAndSkipsShortHistories(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	engagements := []evaluationEngagement{
+		{userID: 2, mediaID: 10, activityAt: start}, {userID: 2, mediaID: 11, activityAt: start.Add(time.Hour)},
+		{userID: 2, mediaID: 12, activityAt: start.Add(2 * time.Hour)}, {userID: 2, mediaID: 13, activityAt: start.Add(3 * time.Hour)},
+		// 1 号用户只有两条，留出一部后只剩一部历史，不够 MinHistory。
+		{userID: 1, mediaID: 10, activityAt: start}, {userID: 1, mediaID: 11, activityAt: start.Add(time.Hour)},
+	}
+	users := splitEngagements(engagements, 2, 2)
+	if len(users) != 1 || users[0].id != 2 {
+		t.Fatalf("users = %+v", users)
+	}
+	if !users[0].training[10] || !users[0].training[11] || !users[0].heldOut[12] || !users[0].heldOut[13] || users[0].training[13] {
+		t.Fatalf("split = %+v", users[0])
+	}
+}
+
+func TestRankingMetrics(t *testing.T) {
+	relevant := map[int]bool{3: true, 9: true}
+	if recall := recallAt([]int{1, 3, 5}, relevant); recall != 0.5 {
+		t.Fatalf("recall = %v", recall)
+	}
+	if ndcg := ndcgAt([]int{3, 9, 1}, relevant, 3); math.Abs(ndcg-1) > 1e-9 {
+		t.Fatalf("perfect ndcg = %v", ndcg)
+	}
+	// 唯一的命中排第二：DCG = 1/log2(3)，理想值是两部都排在最前。
+	want := (1 / math.Log2(3)) / (1 + 1/math.Log2(3))
+	if ndcg := ndcgAt([]int{1, 9}, relevant, 3); math.Abs(ndcg-want) > 1e-9 {
+		t.Fatalf("ndcg = %v, want %v", ndcg, want)
+	}
+	if ndcg := ndcgAt(nil, relevant, 3); ndcg != 0 {
+		t.Fatalf("empty ndcg = %v", ndcg)
+	}
+	if selfInformation(0, 3) != 2 || selfInformation(3, 3) != 0 {
+		t.Fatalf("self information = %v/%v", selfInformation(0, 3), selfInformation(3, 3))
+	}
+}
+
+func TestEvaluateFindsHeldOutCooccurrenceAndRollsBack(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.User(t, pool, 1, 2, 3)
+	testdb.Media(t, pool, 1, 2, 3, 4)
+	// 1、2 号用户看完 1、2 号作品之后都看了 3 号，最后各自看的 4 号被留出；
+	// 3 号用户最后看的 3 号被留出，协同过滤应该从另外两人的记录里猜中它。
+	for _, watched := range []struct{ userID, mediaID, hoursAgo int }{
+		{1, 1, 30}, {1, 2, 20}, {1, 3, 10}, {1, 4, 1}, {2, 1, 30}, {2, 2, 20}, {2, 3, 10}, {2, 4, 1},
+		{3, 1, 30}, {3, 2, 20}, {3, 3, 1},
+	} {
+		if _, err := pool.Exec(t.Context(), `INSERT INTO user_movies (user_id, media_id, movie_id, status, rating, updated_at)
+VALUES ($1, $2, $3, 'watched', 0, NOW() - $4::int * INTERVAL '1 hour')`, watched.userID, watched.mediaID, strconv.Itoa(watched.mediaID), watched.hoursAgo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := Evaluate(t.Context(), pool, EvaluationOptions{HoldOut: 1, K: 5, MinHistory: 2, Collaborative: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Users != 3 || report.CatalogSize != 4 || len(report.Strategies) != 5 {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, strategy := range report.Strategies {
+		// 留出后没人看过 4 号，只有 3 号用户能被猜中。
+		if strategy.Strategy == "collaborative" && (math.Abs(strategy.Recall-1.0/3) > 1e-9 || strategy.Coverage != 0.25) {
+			t.Fatalf("collaborative = %+v", strategy)
+		}
+	}
+	var remaining int
+	if err := pool.QueryRow(t.Context(), `SELECT COUNT(*) FROM user_movies`).Scan(&remaining); err != nil || remaining != 11 {
+		t.Fatalf("user_movies after evaluation = %d/%v", remaining, err)
+	}
+}
@@ -0,0 +1,248 @@
+package recommendation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+	"github.com/TwoThreeWang/Moovie/new/internal/library"
+)
+
+// GroupLibrary 是多人推荐要读的片单，由 library.Store 实现。
+type GroupLibrary interface {
+	ListByUser(ctx context.Context, userID int, status string, limit, offset int) ([]library.Record, error)
+}
+
+// GroupProfiler 是多人推荐的召回和排除能力，由 catalog 实现。「有人看过就不推」在数据库里按全员的
+// 片单、播放记录和不感兴趣标记判断，不受片单分页影响。
+type GroupProfiler interface {
+	RecommendNearGroup(ctx context.Context, userIDs []int, taste []float32, limit int) ([]catalog.Movie, error)
+	GroupExcluded(ctx context.Context, userIDs, mediaIDs []int) (map[int]bool, error)
+}
+
+// WithLibrary 注入片单，「今晚看什么」靠它读每个人的想看。
+func WithLibrary(store GroupLibrary) ServiceOption {
+	return func(service *Service) { service.library = store }
+}
+
+// ErrGroupUnavailable 表示没有注入片单、或个性化推荐不支持多人召回，不能做多人推荐。
+var ErrGroupUnavailable = errors.New("group recommendations unavailable")
+
+const (
+	// maxGroupMembers 是一起挑片的人数上限（含发起人），人再多共同口味就被平均没了。
+	maxGroupMembers = 6
+	// groupLibraryLimit 是每人读取的想看条数上限，只用来找共同想看的片。
+	groupLibraryLimit = 500
+	// groupCandidates 是按合成口味向量召回的候选数，过滤掉有人看过的之后还要够排。
+	groupCandidates = 100
+	// groupMinimumWeight 是排序里「最不满意的那个人」所占的权重，剩下的给平均契合度，
+	// 避免推出一部两个人很爱、第三个人完全不想看的片。
+	groupMinimumWeight = 0.5
+)
+
+// GroupMember 是一起挑片的一个人。
+type GroupMember struct {
+	UserID   int
+	Username string
+}
+
+// MemberFit 是一部片对一个人的契合度。Percent 是口味向量与影片向量的余弦相似度（0~100），
+// 在他想看列表里的直接算 100。
+type MemberFit struct {
+	UserID   int
+	Username string
+	Percent  int
+	Wished   bool
+}
+
+// GroupPick 是多人推荐里的一部片。Wishers 是把它放进想看的人数。
+type GroupPick struct {
+	Movie   catalog.Movie
+	Wishers int
+	Fits    []MemberFit
+	Score   float64
+}
+
+// groupProfile 是一个人在多人推荐里用到的全部信息：想看列表和归一化后的口味向量。
+type groupProfile struct {
+	member GroupMember
+	wished map[string]bool
+	taste  []float64
+}
+
+// GroupRecommendations 给一组人挑今晚一起看的片：先是出现在两个人以上想看列表里的，按人数排；
+// 再用所有人口味向量的合成方向召回候选，按最低契合度和平均契合度的混合分排序。
+// 任何人看过、看过一部分或点过不感兴趣的都不推。members 的第一位是发起人。
+func (service *Service) GroupRecommendations(ctx context.Context, members []GroupMember, limit int) ([]GroupPick, error) {
+	group, ok := service.personalizer.(GroupProfiler)
+	if service.library == nil || !ok {
+		return nil, ErrGroupUnavailable
+	}
+	if len(members) == 0 || len(members) > maxGroupMembers {
+		return nil, fmt.Errorf("group recommendations: %d members", len(members))
+	}
+	profiles := make([]groupProfile, len(members))
+	userIDs := make([]int, len(members))
+	wishers := make(map[string]int)
+	wishOrder := make([]string, 0)
+	for index, member := range members {
+		userIDs[index] = member.UserID
+		wish, err := service.library.ListByUser(ctx, member.UserID, library.StatusWish, groupLibraryLimit, 0)
+		if err != nil {
+			return nil, fmt.Errorf("group wish list: %w", err)
+		}
+		profile := groupProfile{member: member, wished: make(map[string]bool, len(wish))}
+		for _, record := range wish {
+			if !profile.wished[record.MovieID] {
+				profile.wished[record.MovieID] = true
+				if wishers[record.MovieID]++; wishers[record.MovieID] == 1 {
+					wishOrder = append(wishOrder, record.MovieID)
+				}
+			}
+		}
+		signals, err := service.tasteSignals(ctx, member.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("group taste: %w", err)
+		}
+		if taste := catalog.TasteVector(signals); taste != nil {
+			profile.taste = unitVector(taste)
+		}
+		profiles[index] = profile
+	}
+
+	sharedMovies := make([]catalog.Movie, 0)
+	sharedWishers := make(map[int]int)
+	for _, movieID := range wishOrder {
+		if wishers[movieID] < 2 {
+			continue
+		}
+		movie, err := service.findByMovieKey(ctx, movieID)
+		if err != nil {
+			return nil, fmt.Errorf("group shared wish: %w", err)
+		}
+		if movie == nil || sharedWishers[movie.ID] > 0 {
+			continue
+		}
+		sharedMovies = append(sharedMovies, *movie)
+		sharedWishers[movie.ID] = wishers[movieID]
+	}
+	sharedIDs := make([]int, len(sharedMovies))
+	for index, movie := range sharedMovies {
+		sharedIDs[index] = movie.ID
+	}
+	excluded, err := group.GroupExcluded(ctx, userIDs, sharedIDs)
+	if err != nil {
+		return nil, fmt.Errorf("group shared wish: %w", err)
+	}
+	picked := make(map[int]bool)
+	shared := make([]GroupPick, 0)
+	for _, movie := range sharedMovies {
+		if excluded[movie.ID] {
+			continue
+		}
+		picked[movie.ID] = true
+		pick := groupPick(movie, profiles)
+		pick.Wishers = sharedWishers[movie.ID]
+		shared = append(shared, pick)
+	}
+	sort.SliceStable(shared, func(left, right int) bool {
+		if shared[left].Wishers != shared[right].Wishers {
+			return shared[left].Wishers > shared[right].Wishers
+		}
+		return shared[left].Score > shared[right].Score
+	})
+
+	near, err := groupNear(ctx, group, userIDs, profiles)
+	if err != nil {
+		return nil, err
+	}
+	ranked := make([]GroupPick, 0, len(near))
+	for _, movie := range near {
+		if picked[movie.ID] {
+			continue
+		}
+		picked[movie.ID] = true
+		pick := groupPick(movie, profiles)
+		for _, fit := range pick.Fits {
+			if fit.Wished {
+				pick.Wishers++
+			}
+		}
+		ranked = append(ranked, pick)
+	}
+	sort.SliceStable(ranked, func(left, right int) bool { return ranked[left].Score > ranked[right].Score })
+	result := append(shared, ranked...)
+	return result[:min(len(result), limit)], nil
+}
+
+// findByMovieKey 按片单里的 movie_id 找作品：豆瓣 ID 或没有豆瓣条目时的 m<media.id>。
+func (service *Service) findByMovieKey(ctx context.Context, movieID string) (*catalog.Movie, error) {
+	key := catalog.ParseMovieKey(movieID)
+	switch key.Kind {
+	case catalog.MovieKeyMedia:
+		return service.store.FindByID(ctx, key.MediaID)
+	case catalog.MovieKeyDouban:
+		return service.store.FindByDoubanID(ctx, key.DoubanID)
+	default:
+		return nil, nil
+	}
+}
+
+// groupNear 用所有人单位口味向量之和的方向召回候选，每个人的口味分量相同，不会被互动多的人主导。
+// 没人有口味向量时返回空。
+func groupNear(ctx context.Context, group GroupProfiler, userIDs []int, profiles []groupProfile) ([]catalog.Movie, error) {
+	var sum []float64
+	for _, profile := range profiles {
+		if profile.taste == nil || (sum != nil && len(profile.taste) != len(sum)) {
+			continue
+		}
+		if sum == nil {
+			sum = make([]float64, len(profile.taste))
+		}
+		for dimension, value := range profile.taste {
+			sum[dimension] += value
+		}
+	}
+	if sum == nil {
+		return nil, nil
+	}
+	combined := normalize(sum)
+	taste := make([]float32, len(combined))
+	for dimension, value := range combined {
+		taste[dimension] = float32(value)
+	}
+	movies, err := group.RecommendNearGroup(ctx, userIDs, taste, groupCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("group candidates: %w", err)
+	}
+	return movies, nil
+}
+
+// groupPick 算一部片对每个人的契合度和综合分。
+func groupPick(movie catalog.Movie, profiles []groupProfile) GroupPick {
+	pick := GroupPick{Movie: movie, Fits: make([]MemberFit, len(profiles))}
+	var embedding []float64
+	if len(movie.Embedding) > 0 {
+		embedding = unitVector(movie.Embedding)
+	}
+	lowest, total := 1.0, 0.0
+	for index, profile := range profiles {
+		fit := MemberFit{UserID: profile.member.UserID, Username: profile.member.Username}
+		score := 0.0
+		if profile.wished[movie.DoubanID] || profile.wished[movie.DetailKey()] {
+			fit.Wished, score = true, 1
+		} else if profile.taste != nil && len(embedding) == len(profile.taste) {
+			score = max(0, dot(profile.taste, embedding))
+		}
+		fit.Percent = int(math.Round(score * 100))
+		pick.Fits[index] = fit
+		lowest, total = min(lowest, score), total+score
+	}
+	if len(profiles) > 0 {
+		pick.Score = groupMinimumWeight*lowest + (1-groupMinimumWeight)*total/float64(len(profiles))
+	}
+	return pick
+}
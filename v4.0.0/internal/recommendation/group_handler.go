@@ -0,0 +1,111 @@
+package recommendation
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/identity"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/TwoThreeWang/Moovie/new/internal/social"
+	"github.com/gin-gonic/gin"
+)
+
+// groupPickLimit 是「今晚看什么」一次展示的影片数。
+const groupPickLimit = 24
+
+// WithGroupMembers 注入挑人用的账号和片友雷达。只有公开主页的用户能被拉进来一起挑片，
+// 公开主页就是他同意别人看到自己片单的表示。
+func (handler *Handler) WithGroupMembers(users interface {
+	FindByID(ctx context.Context, id int) (*identity.User, error)
+}, friends interface {
+	ListFilmFriends(ctx context.Context, currentUserID, limit int) ([]social.FilmFriend, error)
+}) *Handler {
+	handler.users, handler.friends = users, friends
+	return handler
+}
+
+// togetherPage 渲染「今晚看什么」：勾选片友或填用户 ID，结果由 HTMX 加载。
+func (handler *Handler) togetherPage(c *gin.Context) {
+	userID := auth.UserID(c)
+	friends := []social.FilmFriend{}
+	if userID > 0 && handler.friends != nil {
+		var err error
+		if friends, err = handler.friends.ListFilmFriends(c.Request.Context(), userID, 12); err != nil {
+			slog.Warn("list film friends for group recommendations", "user_id", userID, "error", err)
+		}
+	}
+	c.HTML(http.StatusOK, "together.html", platformweb.NewData(c, handler.config, platformweb.Metadata{
+		Title: "今晚看什么 - " + handler.config.SiteName, Robots: "noindex, nofollow",
+	}, gin.H{"NeedLogin": userID == 0, "FilmFriends": friends, "MaxMembers": maxGroupMembers - 1}))
+}
+
+// together 返回多人推荐的结果片段。members 可以重复出现，也可以用逗号分隔多个用户 ID。
+func (handler *Handler) together(c *gin.Context) {
+	userID := auth.UserID(c)
+	if userID == 0 {
+		c.HTML(http.StatusOK, "partials/together_results.html", gin.H{"NeedLogin": true})
+		return
+	}
+	if handler.users == nil {
+		c.HTML(http.StatusOK, "partials/together_results.html", gin.H{"Error": "暂不支持一起挑片"})
+		return
+	}
+	ids, err := groupMemberIDs(c.QueryArray("members"), userID)
+	if err != nil {
+		c.HTML(http.StatusOK, "partials/together_results.html", gin.H{"Error": err.Error()})
+		return
+	}
+	members := make([]GroupMember, 0, len(ids)+1)
+	for index, id := range append([]int{userID}, ids...) {
+		user, err := handler.users.FindByID(c.Request.Context(), id)
+		if err != nil {
+			c.HTML(http.StatusOK, "partials/together_results.html", gin.H{"Error": "读取用户失败，请稍后重试"})
+			return
+		}
+		// 发起人自己不需要公开主页；被拉进来的人必须公开，否则就是在未经同意的情况下读他的片单。
+		if user == nil || (index > 0 && !user.IsPublic) {
+			c.HTML(http.StatusOK, "partials/together_results.html", gin.H{"Error": "用户 " + strconv.Itoa(id) + " 不存在或没有公开主页"})
+			return
+		}
+		members = append(members, GroupMember{UserID: user.ID, Username: user.Username})
+	}
+	picks, err := handler.service.GroupRecommendations(c.Request.Context(), members, groupPickLimit)
+	if err != nil {
+		if !errors.Is(err, ErrGroupUnavailable) {
+			slog.Warn("group recommendations", "user_id", userID, "members", ids, "error", err)
+		}
+		c.HTML(http.StatusOK, "partials/together_results.html", gin.H{"Error": "挑片失败，请稍后重试"})
+		return
+	}
+	c.HTML(http.StatusOK, "partials/together_results.html", gin.H{"Picks": picks, "Members": members})
+}
+
+// groupMemberIDs 解析、去重要一起挑片的用户 ID，去掉发起人自己，至少一位、最多 maxGroupMembers-1 位。
+func groupMemberIDs(values []string, self int) ([]int, error) {
+	seen := map[int]bool{self: true}
+	ids := make([]int, 0, len(values))
+	for _, value := range values {
+		for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '，' || r == ' ' }) {
+			id, err := strconv.Atoi(part)
+			if err != nil || id <= 0 {
+				return nil, errors.New("用户 ID 无效：" + part)
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("至少选一位一起看的人")
+	}
+	if len(ids) > maxGroupMembers-1 {
+		return nil, errors.New("最多选 " + strconv.Itoa(maxGroupMembers-1) + " 位")
+	}
+	return ids, nil
+}
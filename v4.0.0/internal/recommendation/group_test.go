@@ -0,0 +1,183 @@
+package recommendation
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+	"github.com/TwoThreeWang/Moovie/new/internal/identity"
+	"github.com/TwoThreeWang/Moovie/new/internal/library"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
+	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGroupRecommendationsRankSharedWishesThenJointFit(t *testing.T) {
+	service, _ := groupTestService()
+	members := []GroupMember{{UserID: 1, Username: "甲"}, {UserID: 2, Username: "乙"}, {UserID: 3, Username: "丙"}}
+	picks, err := service.GroupRecommendations(context.Background(), members, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int, len(picks))
+	for index, pick := range picks {
+		ids[index] = pick.Movie.ID
+	}
+	// 50 在甲乙两人的想看里排第一；55 甲乙都想看但丙播过，60 丙看过，都不推；80 三人都还算喜欢，排在只合甲乙口味的 70 前面。
+	if len(ids) != 3 || ids[0] != 50 || ids[1] != 80 || ids[2] != 70 {
+		t.Fatalf("picks = %v", ids)
+	}
+	if picks[0].Wishers != 2 || !picks[0].Fits[0].Wished || !picks[0].Fits[1].Wished || picks[0].Fits[2].Wished {
+		t.Fatalf("shared wish = %+v", picks[0])
+	}
+	if fits := picks[2].Fits; fits[0].Percent != 100 || fits[2].Percent != 0 || fits[2].Username != "丙" {
+		t.Fatalf("member fits = %+v", fits)
+	}
+	if _, err := NewService(&hybridStoreStub{}).GroupRecommendations(context.Background(), members, 10); err != ErrGroupUnavailable {
+		t.Fatalf("without library error = %v", err)
+	}
+}
+
+func TestGroupMemberIDsDeduplicatesAndLimits(t *testing.T) {
+	ids, err := groupMemberIDs([]string{"2, 3", "3", "1"}, 1)
+	if err != nil || len(ids) != 2 || ids[0] != 2 || ids[1] != 3 {
+		t.Fatalf("ids/error = %v/%v", ids, err)
+	}
+	if _, err := groupMemberIDs([]string{"1"}, 1); err == nil {
+		t.Fatal("only self should be rejected")
+	}
+	if _, err := groupMemberIDs([]string{"2,3,4,5,6,7"}, 1); err == nil {
+		t.Fatal("too many members should be rejected")
+	}
+	if _, err := groupMemberIDs([]string{"abc"}, 1); err == nil {
+		t.Fatal("invalid id should be rejected")
+	}
+}
+
+func TestTogetherRequiresPublicProfiles(t *testing.T) {
+	service, _ := groupTestService()
+	gin.SetMode(gin.TestMode)
+	renderer, err := platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), []string{"together"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.HTMLRender = renderer
+	users := groupUsersStub{
+		1: {ID: 1, Username: "甲"}, 2: {ID: 2, Username: "乙", IsPublic: true}, 3: {ID: 3, Username: "丙", IsPublic: true}, 4: {ID: 4, Username: "丁"},
+	}
+	NewHandler(config.Config{SiteName: "Moovie影牛", AppSecret: "secret"}, service, nil).WithGroupMembers(users, nil).Register(router)
+	token := recommendationToken(t, 1)
+
+	page := authenticatedGet(router, "/together", token)
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), `hx-get="/api/htmx/together"`) {
+		t.Fatalf("page = %d/%s", page.Code, page.Body.String())
+	}
+	result := authenticatedGet(router, "/api/htmx/together?members=2&members=3", token)
+	body := result.Body.String()
+	if result.Code != http.StatusOK || !strings.Contains(body, "2 人想看") || !strings.Contains(body, "和 甲、乙、丙 一起挑的 3 部") {
+		t.Fatalf("together = %d/%s", result.Code, body)
+	}
+	// 丁没有公开主页，不能被拉进来读片单。
+	private := authenticatedGet(router, "/api/htmx/together?members=4", token)
+	if !strings.Contains(private.Body.String(), "用户 4 不存在或没有公开主页") {
+		t.Fatalf("private member = %s", private.Body.String())
+	}
+}
+
+// groupTestService 是三个人：甲乙口味相同且都想看 50、55；丙口味偏另一边，看过 60、播过 55。
+func groupTestService() (*Service, *groupLibraryStub) {
+	store := &hybridStoreStub{movies: map[int]catalog.Movie{
+		50: {ID: 50, DoubanID: "shared", Title: "都想看", Embedding: []float32{1, 0}},
+		55: {ID: 55, DoubanID: "played", Title: "丙播过", Embedding: []float32{1, 0}},
+	}}
+	shelves := &groupLibraryStub{
+		library.StatusWish: {1: {"shared", "played"}, 2: {"shared", "played"}},
+	}
+	profiler := &fakeInterestProfiler{near: func([]float32) []catalog.Movie {
+		return []catalog.Movie{
+			{ID: 60, DoubanID: "seen", Title: "丙看过", Embedding: []float32{0.7, 0.7}},
+			{ID: 70, DoubanID: "left", Title: "甲乙喜欢", Embedding: []float32{1, 0}},
+			{ID: 80, DoubanID: "middle", Title: "大家都行", Embedding: []float32{0.7, 0.7}},
+		}
+	}}
+	taste := &groupTasteStub{profiler: profiler, excluded: map[int][]int{3: {55, 60}}}
+	service := NewService(store, WithPersonalizer(taste), WithLibrary(shelves))
+	return service, shelves
+}
+
+// groupTasteStub 按用户给出不同的口味信号：1、2 号偏第一维，3 号偏第二维。
+// excluded 模拟数据库里每个人看过、播过的作品。
+type groupTasteStub struct {
+	profiler *fakeInterestProfiler
+	excluded map[int][]int
+}
+
+func (stub *groupTasteStub) UserRecommendations(ctx context.Context, userID, limit int) ([]catalog.Movie, error) {
+	return stub.profiler.UserRecommendations(ctx, userID, limit)
+}
+
+func (stub *groupTasteStub) ReliveClassics(ctx context.Context, userID, limit int) ([]catalog.Movie, error) {
+	return stub.profiler.ReliveClassics(ctx, userID, limit)
+}
+
+func (stub *groupTasteStub) RecentSimilar(ctx context.Context, userID, limit int) ([]catalog.Movie, string, error) {
+	return stub.profiler.RecentSimilar(ctx, userID, limit)
+}
+
+func (stub *groupTasteStub) TasteSignals(_ context.Context, userID int) ([]catalog.TasteSignal, error) {
+	embedding := []float32{1, 0}
+	if userID == 3 {
+		embedding = []float32{0, 1}
+	}
+	return []catalog.TasteSignal{{MediaID: 100 + userID, Title: "口味", Kind: "watched", Rating: 5, Embedding: embedding}}, nil
+}
+
+func (stub *groupTasteStub) RecommendNear(ctx context.Context, userID int, taste []float32, limit int) ([]catalog.Movie, error) {
+	return stub.profiler.RecommendNear(ctx, userID, taste, limit)
+}
+
+func (stub *groupTasteStub) RecommendNearGroup(ctx context.Context, userIDs []int, taste []float32, limit int) ([]catalog.Movie, error) {
+	movies, err := stub.profiler.RecommendNear(ctx, userIDs[0], taste, limit)
+	if err != nil {
+		return nil, err
+	}
+	excluded, _ := stub.GroupExcluded(ctx, userIDs, nil)
+	kept := make([]catalog.Movie, 0, len(movies))
+	for _, movie := range movies {
+		if !excluded[movie.ID] {
+			kept = append(kept, movie)
+		}
+	}
+	return kept, nil
+}
+
+func (stub *groupTasteStub) GroupExcluded(_ context.Context, userIDs, _ []int) (map[int]bool, error) {
+	excluded := make(map[int]bool)
+	for _, userID := range userIDs {
+		for _, mediaID := range stub.excluded[userID] {
+			excluded[mediaID] = true
+		}
+	}
+	return excluded, nil
+}
+
+// groupLibraryStub 按状态、用户存片单里的 movie_id。
+type groupLibraryStub map[string]map[int][]string
+
+func (stub groupLibraryStub) ListByUser(_ context.Context, userID int, status string, _, _ int) ([]library.Record, error) {
+	records := make([]library.Record, 0)
+	for _, movieID := range stub[status][userID] {
+		records = append(records, library.Record{UserID: userID, MovieID: movieID, Status: status})
+	}
+	return records, nil
+}
+
+type groupUsersStub map[int]*identity.User
+
+func (stub groupUsersStub) FindByID(_ context.Context, id int) (*identity.User, error) {
+	return stub[id], nil
+}
@@ -3,6 +3,7 @@ package recommendation
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -10,9 +11,11 @@ import (
 	"strings"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+	"github.com/TwoThreeWang/Moovie/new/internal/identity"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
 	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
+	"github.com/TwoThreeWang/Moovie/new/internal/social"
 	"github.com/TwoThreeWang/Moovie/new/internal/workqueue"
 	"github.com/gin-gonic/gin"
 )
@@ -26,6 +29,13 @@ type Handler struct {
 	queue     interface {
 		Enqueue(context.Context, workqueue.Spec) (int, error)
 	}
+	users interface {
+		FindByID(ctx context.Context, id int) (*identity.User, error)
+	}
+	friends interface {
+		ListFilmFriends(ctx context.Context, currentUserID, limit int) ([]social.FilmFriend, error)
+	}
+	digests DigestReader
 }
 
 // NewHandler 创建推荐处理器。
@@ -44,11 +54,14 @@ func (handler *Handler) WithRefreshQueue(queue interface {
 // forYouData 是「为你推荐」页面的全部内容。
 type forYouData struct {
 	Personalized   []catalog.Movie `json:"personalized"`
+	Interests      []InterestRow   `json:"interests"`
 	ReliveClassics []catalog.Movie `json:"relive_classics"`
 	SimilarToLast  []catalog.Movie `json:"similar_to_last"`
 	LastMovieTitle string          `json:"last_movie_title"`
 	HeroMovie      *catalog.Movie  `json:"hero_movie"`
 	NoPersonalData bool            `json:"no_personal_data"`
+	// Reasons 是头图、「猜你喜欢」和兴趣行里影片的推荐理由，按 media.id 索引；没有理由的不在里面。
+	Reasons map[int]string `json:"reasons"`
 }
 
 // Register 注册推荐相关路由。
@@ -60,6 +73,35 @@ func (handler *Handler) Register(router *gin.Engine) {
 	router.GET("/foryou", optional, handler.forYouPage)
 	router.GET("/recommend", optional, handler.forYouPage)
 	router.GET("/api/htmx/foryou", optional, handler.forYou)
+	router.POST("/api/recommendations/:media_id/not-interested", optional, handler.notInterested)
+	router.GET("/together", optional, handler.togetherPage)
+	router.GET("/api/htmx/together", optional, handler.together)
+	router.GET("/api/htmx/dashboard/digest", optional, handler.dashboardDigest)
+	router.GET("/feed/digest/:token", handler.digestFeed)
+}
+
+// notInterested 记下「不感兴趣」并重新生成推荐快照。返回空片段，HTMX 用它把卡片替换掉。
+func (handler *Handler) notInterested(c *gin.Context) {
+	userID := auth.UserID(c)
+	if userID == 0 {
+		c.String(http.StatusUnauthorized, "")
+		return
+	}
+	mediaID, err := strconv.Atoi(c.Param("media_id"))
+	if err != nil || mediaID <= 0 {
+		c.String(http.StatusBadRequest, "作品ID无效")
+		return
+	}
+	if err := handler.service.MarkNotInterested(c.Request.Context(), userID, mediaID); err != nil {
+		if errors.Is(err, ErrFeedbackUnavailable) {
+			c.String(http.StatusServiceUnavailable, "暂不支持该操作")
+			return
+		}
+		c.String(http.StatusInternalServerError, "操作失败")
+		return
+	}
+	handler.enqueueRefresh(c.Request.Context(), userID, "feedback")
+	c.String(http.StatusOK, "")
 }
 
 // forYouPage 渲染「为你推荐」页面骨架，内容由 HTMX 异步加载。
@@ -94,8 +136,12 @@ func (handler *Handler) forYou(c *gin.Context) {
 	}
 	paged := data.Personalized[start:end]
 	hasMore := end < len(data.Personalized)
-	view := gin.H{"Personalized": paged, "HasMore": hasMore, "NextPage": page + 1, "IsFirstPage": page == 1,
-		"ReliveClassics": data.ReliveClassics, "SimilarToLast": data.SimilarToLast, "LastMovieTitle": data.LastMovieTitle,
+	reasons := data.Reasons
+	if reasons == nil {
+		reasons = map[int]string{}
+	}
+	view := gin.H{"Personalized": paged, "Reasons": reasons, "HasMore": hasMore, "NextPage": page + 1, "IsFirstPage": page == 1,
+		"Interests": data.Interests, "ReliveClassics": data.ReliveClassics, "SimilarToLast": data.SimilarToLast, "LastMovieTitle": data.LastMovieTitle,
 		"HeroMovie": data.HeroMovie, "NoPersonalData": data.NoPersonalData}
 	if page > 1 {
 		c.HTML(http.StatusOK, "partials/foryou_movies_grid.html", view)
@@ -138,8 +184,29 @@ func (handler *Handler) enqueueRefresh(ctx context.Context, userID int, reason s
 }
 
 // buildForYou 供 Worker 组装推荐内容，没有个人数据时退回评分热门影片。
+// 能按兴趣分组时，「猜你喜欢」由各兴趣剩下的候选交错而成；否则用单一口味向量。
+// 个性化列表按 MMR 打散，每部影片再对照用户自己的作品生成一句推荐理由。
 func buildForYou(ctx context.Context, service *Service, userID int) forYouData {
-	personalized, _ := service.UserRecommendations(ctx, userID, 60)
+	signals, err := service.tasteSignals(ctx, userID)
+	if err != nil {
+		slog.Warn("load recommendation taste signals", "user_id", userID, "error", err)
+	}
+	interests, err := service.interestRows(ctx, userID, signals, interestCandidates)
+	if err != nil {
+		slog.Warn("build recommendation interests", "user_id", userID, "error", err)
+	}
+	var personalized []catalog.Movie
+	if len(interests) > 0 {
+		personalized, interests = spreadInterests(interests)
+	} else {
+		personalized, _ = service.UserRecommendations(ctx, userID, 60)
+	}
+	// 口味向量的几个板块在 SQL 里已经排除了不感兴趣的作品，热门兜底没有，要在这里滤掉。
+	dismissed, err := service.NotInterestedMedia(ctx, userID)
+	if err != nil {
+		slog.Warn("load recommendation feedback", "user_id", userID, "error", err)
+	}
+	personalized = diversify(service.blendUserCollaborative(ctx, userID, personalized, interests, dismissed))
 	hadPersonalData := len(personalized) > 0
 	relive, _ := service.ReliveClassics(ctx, userID, 12)
 	recent, lastTitle, _ := service.RecentSimilar(ctx, userID, 12)
@@ -160,7 +227,7 @@ func buildForYou(ctx context.Context, service *Service, userID int) forYouData {
 			exists[movie.ID] = true
 		}
 		for _, movie := range popular {
-			if !exists[movie.ID] {
+			if !exists[movie.ID] && !dismissed[movie.ID] {
 				personalized = append(personalized, movie)
 				exists[movie.ID] = true
 			}
@@ -173,7 +240,48 @@ func buildForYou(ctx context.Context, service *Service, userID int) forYouData {
 		hero = &personalized[0]
 		personalized = personalized[1:]
 	}
-	return forYouData{Personalized: personalized, ReliveClassics: relive, SimilarToLast: recent, LastMovieTitle: lastTitle, HeroMovie: hero, NoPersonalData: !hadPersonalData}
+	lists := [][]catalog.Movie{personalized}
+	if hero != nil {
+		lists = append(lists, []catalog.Movie{*hero})
+	}
+	for _, row := range interests {
+		lists = append(lists, row.Movies)
+	}
+	return forYouData{Personalized: personalized, Interests: interests, ReliveClassics: relive, SimilarToLast: recent, LastMovieTitle: lastTitle,
+		HeroMovie: hero, NoPersonalData: !hadPersonalData, Reasons: personalReasons(signals, lists...)}
+}
+
+// interestRowSize 是每行兴趣推荐展示的影片数，和桌面端一行六列对齐；
+// interestCandidates 是每个兴趣召回的候选数，多出来的进「猜你喜欢」。
+const (
+	interestRowSize    = 6
+	interestCandidates = 30
+)
+
+// spreadInterests 把各兴趣分到的影片拆开：每组前 interestRowSize 部做带标签的一行，
+// 剩下的轮流交错排进「猜你喜欢」。最强兴趣的第一部放在「猜你喜欢」最前面当头图，不在行里重复。
+func spreadInterests(rows []InterestRow) ([]catalog.Movie, []InterestRow) {
+	personalized := make([]catalog.Movie, 0, 60)
+	shown := make([]InterestRow, 0, len(rows))
+	rest := make([][]catalog.Movie, 0, len(rows))
+	for index, row := range rows {
+		movies := row.Movies
+		if index == 0 {
+			personalized = append(personalized, movies[0])
+			movies = movies[1:]
+		}
+		cut := min(len(movies), interestRowSize)
+		if cut > 0 {
+			shown = append(shown, InterestRow{Label: row.Label, Movies: movies[:cut]})
+		}
+		rest = append(rest, movies[cut:])
+	}
+	roundRobin(rest, func(_ int, movie catalog.Movie) {
+		if len(personalized) < 60 {
+			personalized = append(personalized, movie)
+		}
+	})
+	return personalized, shown
 }
 
 func fallbackForYou(popular []catalog.Movie) forYouData {
@@ -187,6 +295,11 @@ func fallbackForYou(popular []catalog.Movie) forYouData {
 // compactForYouData 写快照前裁掉用不到的大字段（简介、向量文本），控制存储体积。
 func compactForYouData(data forYouData) forYouData {
 	data.Personalized = compactForYouMovies(data.Personalized)
+	interests := make([]InterestRow, len(data.Interests))
+	for index, row := range data.Interests {
+		interests[index] = InterestRow{Label: compactRecommendationText(row.Label, 200), Movies: compactForYouMovies(row.Movies)}
+	}
+	data.Interests = interests
 	data.ReliveClassics = compactForYouMovies(data.ReliveClassics)
 	data.SimilarToLast = compactForYouMovies(data.SimilarToLast)
 	data.LastMovieTitle = compactRecommendationText(data.LastMovieTitle, 200)
@@ -194,9 +307,30 @@ func compactForYouData(data forYouData) forYouData {
 		movie := compactForYouMovie(*data.HeroMovie)
 		data.HeroMovie = &movie
 	}
+	data.Reasons = compactForYouReasons(data)
 	return data
 }
 
+// compactForYouReasons 只留下快照里还在的影片的理由，并限制长度。
+func compactForYouReasons(data forYouData) map[int]string {
+	reasons := make(map[int]string, len(data.Reasons))
+	keep := func(movies []catalog.Movie) {
+		for _, movie := range movies {
+			if reason, ok := data.Reasons[movie.ID]; ok {
+				reasons[movie.ID] = compactRecommendationText(reason, 200)
+			}
+		}
+	}
+	keep(data.Personalized)
+	for _, row := range data.Interests {
+		keep(row.Movies)
+	}
+	if data.HeroMovie != nil {
+		keep([]catalog.Movie{*data.HeroMovie})
+	}
+	return reasons
+}
+
 // compactForYouMovies 批量裁剪。
 func compactForYouMovies(movies []catalog.Movie) []catalog.Movie {
 	result := make([]catalog.Movie, len(movies))
@@ -213,7 +347,9 @@ func compactForYouMovie(movie catalog.Movie) catalog.Movie {
 		Title: compactRecommendationText(movie.Title, 200), Year: compactRecommendationText(movie.Year, 16),
 		Poster: compactRecommendationText(movie.Poster, 2048), Rating: movie.Rating,
 		Genres: compactRecommendationText(movie.Genres, 200), Countries: compactRecommendationText(movie.Countries, 200),
-		Summary: compactRecommendationText(movie.Summary, 600),
+		Summary: compactRecommendationText(movie.Summary, 600), ImagePalette: catalog.ImagePalette{
+			PosterBlurhash: movie.PosterBlurhash, PosterColor: movie.PosterColor,
+		},
 	}
 }
 
@@ -228,14 +364,19 @@ func compactRecommendationText(value string, limit int) string {
 
 // similar 返回相似影片片段。
 func (handler *Handler) similar(c *gin.Context) {
-	doubanID := c.Query("douban_id")
+	doubanID, mediaID := c.Query("douban_id"), 0
 	if doubanID == "" {
 		id, _ := strconv.Atoi(c.Query("id"))
 		if movie, _ := handler.service.FindByID(c.Request.Context(), id); movie != nil {
-			doubanID = movie.DoubanID
+			doubanID, mediaID = movie.DoubanID, movie.ID
 		}
 	}
-	movies, _ := handler.service.FindSimilar(c.Request.Context(), doubanID, 6)
+	var movies []catalog.Movie
+	if doubanID == "" && mediaID > 0 {
+		movies, _ = handler.service.FindSimilarByID(c.Request.Context(), mediaID, 6)
+	} else {
+		movies, _ = handler.service.FindSimilar(c.Request.Context(), doubanID, 6)
+	}
 	c.HTML(http.StatusOK, "partials/similar_movies.html", gin.H{"Movies": movies, "doubanID": doubanID})
 }
 
@@ -287,7 +428,7 @@ func (handler *Handler) page(c *gin.Context) {
 	}
 	description = strings.TrimSpace(description + " " + reason)
 	title := fmt.Sprintf("类似《%s》的电影推荐_和《%s》差不多的电影 - %s", source.Title, source.Title, handler.config.SiteName)
-	c.HTML(http.StatusOK, "recommendations.html", platformweb.NewData(c, handler.config, platformweb.Metadata{Title: title, Description: description, Canonical: fmt.Sprintf("%s/similar/%s", handler.config.SiteURL, source.DoubanID)}, gin.H{"SourceMovie": source, "SimilarMovies": movies, "PrimaryGenre": primaryGenre}))
+	c.HTML(http.StatusOK, "recommendations.html", platformweb.NewData(c, handler.config, platformweb.Metadata{Title: title, Description: description, Canonical: fmt.Sprintf("%s/similar/%s", handler.config.SiteURL, source.DetailKey())}, gin.H{"SourceMovie": source, "SimilarMovies": movies, "PrimaryGenre": primaryGenre}))
 }
 
 // directorNames 截取前几位导演用于页面展示。
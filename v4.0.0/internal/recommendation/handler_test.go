@@ -50,6 +50,37 @@ func TestRecommendationsPagePreservesPathSEOJSONLDAndReasons(t *testing.T) {
 	}
 }
 
+func TestRecommendationsLinkMediaWithoutDoubanIDByMediaKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 两部都只有 TMDB 资料：源影片和推荐结果的链接都要用 m<media.id>，不能拼成 /movie/。
+	store := &hybridStoreStub{movies: map[int]catalog.Movie{
+		5: {ID: 5, Title: "只有TMDB的源", Genres: "剧情"},
+		6: {ID: 6, Title: "只有TMDB的推荐", Genres: "剧情"},
+	}, similar: []int{6}}
+	renderer, err := platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), []string{"recommendations", "404"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.HTMLRender = renderer
+	NewHandler(config.Config{SiteName: "Moovie影牛", SiteURL: "https://moovie.example"}, NewService(store), nil).Register(router)
+	for _, target := range []string{"/similar/m5", "/api/htmx/similar-with-reason/m5"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		body := recorder.Body.String()
+		if recorder.Code != http.StatusOK || !strings.Contains(body, `href="/movie/m6"`) || strings.Contains(body, `/movie/"`) || strings.Contains(body, `/similar/"`) {
+			t.Fatalf("%s = %d/%s", target, recorder.Code, body)
+		}
+	}
+	page := httptest.NewRecorder()
+	router.ServeHTTP(page, httptest.NewRequest(http.MethodGet, "/similar/m5", nil))
+	for _, expected := range []string{`<link rel="canonical" href="https://moovie.example/similar/m5">`, `href="/movie/m5"`, `moovie.example/movie/m6"`} {
+		if !strings.Contains(page.Body.String(), expected) {
+			t.Fatalf("page missing %q", expected)
+		}
+	}
+}
+
 func TestRecommendationsMissingSourceIsReal404(t *testing.T) {
 	router, _ := recommendationTestRouter(t)
 	recorder := httptest.NewRecorder()
@@ -241,7 +272,11 @@ func seedEmbedding(t *testing.T, store *catalog.PostgresStore, doubanID string)
 	t.Helper()
 	vector := make([]float32, 768)
 	vector[len(doubanID)%768] = 0.5
-	if err := store.UpdateEmbedding(t.Context(), doubanID, "seed", "seed-hash", vector); err != nil {
+	movie, err := store.FindByDoubanID(t.Context(), doubanID)
+	if err != nil || movie == nil {
+		t.Fatalf("seed embedding %s: movie not found: %v", doubanID, err)
+	}
+	if err := store.UpdateEmbedding(t.Context(), movie.ID, "seed", "seed-hash", vector); err != nil {
 		t.Fatalf("seed embedding %s: %v", doubanID, err)
 	}
 }
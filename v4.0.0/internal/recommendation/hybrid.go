@@ -0,0 +1,157 @@
+package recommendation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+)
+
+// CollaborativeSource 是「看过 X 的人也看了 Y」的协同过滤数据，由 CooccurrenceStore 实现。
+type CollaborativeSource interface {
+	Related(ctx context.Context, mediaID, limit int) ([]CollaborativeMatch, error)
+	ForUser(ctx context.Context, userID, limit int) ([]CollaborativeMatch, error)
+}
+
+// WithCollaborative 注入协同过滤数据。没有注入时推荐只看内容向量。
+func WithCollaborative(source CollaborativeSource) ServiceOption {
+	return func(service *Service) { service.collaborative = source }
+}
+
+const (
+	// collaborativeWeight 是协同分数在混合排序里的最大权重，内容相似度始终占大头。
+	collaborativeWeight = 0.4
+	// collaborativeConfidentUsers 是协同分数拿到满权重所需的共同观众数，人少时按比例打折。
+	collaborativeConfidentUsers = 5
+)
+
+// hybridScore 是混合排序里的一部作品，Match 为空说明只有内容向量召回了它。
+type hybridScore struct {
+	MediaID int
+	Score   float64
+	Match   *CollaborativeMatch
+}
+
+// hybridRank 把向量召回的顺序和协同分数合成一个排序。
+// 内容分按名次线性给（第一名 1，最后一名接近 0），协同分按本批最高分归一化到 0~1；
+// 两者按 collaborativeWeight × 置信度 混合，置信度随共同观众数增长，到 collaborativeConfidentUsers 封顶。
+// 没有共现数据的冷门作品权重为 0，排序和纯内容推荐完全一样。
+func hybridRank(content []int, matches []CollaborativeMatch) []hybridScore {
+	scores := make(map[int]*hybridScore, len(content)+len(matches))
+	order := make([]int, 0, len(content)+len(matches))
+	for rank, mediaID := range content {
+		if scores[mediaID] != nil {
+			continue
+		}
+		scores[mediaID] = &hybridScore{MediaID: mediaID, Score: 1 - float64(rank)/float64(len(content))}
+		order = append(order, mediaID)
+	}
+	var best float64
+	for _, match := range matches {
+		best = max(best, match.Score)
+	}
+	for index := range matches {
+		match := &matches[index]
+		if best <= 0 || match.Score <= 0 {
+			continue
+		}
+		entry := scores[match.MediaID]
+		if entry == nil {
+			entry = &hybridScore{MediaID: match.MediaID}
+			scores[match.MediaID] = entry
+			order = append(order, match.MediaID)
+		}
+		weight := collaborativeWeight * min(1, float64(match.SharedUsers)/collaborativeConfidentUsers)
+		entry.Score = (1-weight)*entry.Score + weight*match.Score/best
+		entry.Match = match
+	}
+	result := make([]hybridScore, len(order))
+	for index, mediaID := range order {
+		result[index] = *scores[mediaID]
+	}
+	sort.SliceStable(result, func(left, right int) bool { return result[left].Score > result[right].Score })
+	return result
+}
+
+// blendCollaborative 用协同数据给向量召回的影片重排，并补进只被协同过滤找到的作品（按 ID 回表读）。
+// excluded 里的作品不会被补进来；没有协同数据时就是内容结果本身。第二个返回值记下哪些作品带了协同分数。
+func (service *Service) blendCollaborative(ctx context.Context, content []catalog.Movie, matches []CollaborativeMatch,
+	excluded map[int]bool, limit int) ([]catalog.Movie, map[int]*CollaborativeMatch) {
+	if len(matches) == 0 {
+		return content[:min(len(content), limit)], map[int]*CollaborativeMatch{}
+	}
+	movies := make(map[int]catalog.Movie, len(content))
+	contentIDs := make([]int, 0, len(content))
+	for _, movie := range content {
+		movies[movie.ID] = movie
+		contentIDs = append(contentIDs, movie.ID)
+	}
+	result := make([]catalog.Movie, 0, limit)
+	sources := make(map[int]*CollaborativeMatch)
+	for _, entry := range hybridRank(contentIDs, matches) {
+		if len(result) >= limit {
+			break
+		}
+		movie, ok := movies[entry.MediaID]
+		if !ok {
+			if excluded[entry.MediaID] {
+				continue
+			}
+			found, err := service.store.FindByID(ctx, entry.MediaID)
+			if err != nil || found == nil {
+				continue
+			}
+			movie = *found
+		}
+		result = append(result, movie)
+		if entry.Match != nil {
+			sources[movie.ID] = entry.Match
+		}
+	}
+	return result, sources
+}
+
+// relatedMatches 读一部作品的共现邻居，没有注入协同数据或读失败时返回空。
+func (service *Service) relatedMatches(ctx context.Context, mediaID, limit int) []CollaborativeMatch {
+	if service.collaborative == nil || mediaID <= 0 {
+		return nil
+	}
+	matches, err := service.collaborative.Related(ctx, mediaID, limit)
+	if err != nil {
+		slog.Warn("load related media cooccurrence", "media_id", mediaID, "error", err)
+		return nil
+	}
+	return matches
+}
+
+// blendUserCollaborative 用用户看过的作品的共现邻居给「猜你喜欢」混合重排。
+// 已经在兴趣行里出现的、点过不感兴趣的不会被协同过滤补回来。
+func (service *Service) blendUserCollaborative(ctx context.Context, userID int, personalized []catalog.Movie,
+	interests []InterestRow, dismissed map[int]bool) []catalog.Movie {
+	if service.collaborative == nil {
+		return personalized
+	}
+	matches, err := service.collaborative.ForUser(ctx, userID, 60)
+	if err != nil {
+		slog.Warn("load user media cooccurrence", "user_id", userID, "error", err)
+		return personalized
+	}
+	excluded := make(map[int]bool, len(dismissed))
+	for mediaID := range dismissed {
+		excluded[mediaID] = true
+	}
+	for _, row := range interests {
+		for _, movie := range row.Movies {
+			excluded[movie.ID] = true
+		}
+	}
+	blended, _ := service.blendCollaborative(ctx, personalized, matches, excluded, max(len(personalized), 60))
+	return blended
+}
+
+// collaborativeReason 是以协同分数为主的推荐理由。
+func collaborativeReason(source catalog.Movie, match CollaborativeMatch) string {
+	return fmt.Sprintf("%d 位看过《%s》的影迷也看了这部", match.SharedUsers, source.Title)
+}
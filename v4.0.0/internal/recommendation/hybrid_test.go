@@ -0,0 +1,111 @@
+package recommendation
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+)
+
+func TestHybridRankFallsBackToContentForColdItems(t *testing.T) {
+	ranked := hybridRank([]int{1, 2, 3}, nil)
+	if ids := hybridIDs(ranked); !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Fatalf("cold ranking = %v", ids)
+	}
+	// 5 号被很多人一起看过，越过内容上排在它前面的 4 号；6 号只有协同数据，也能排进来。
+	ranked = hybridRank([]int{1, 2, 3, 4, 5}, []CollaborativeMatch{{MediaID: 5, SharedUsers: 12, Score: 0.6}, {MediaID: 6, SharedUsers: 5, Score: 0.3}})
+	if ids := hybridIDs(ranked); !reflect.DeepEqual(ids, []int{1, 2, 3, 5, 4, 6}) {
+		t.Fatalf("hybrid ranking = %v", ids)
+	}
+	if ranked[0].Match != nil || ranked[3].Match == nil || ranked[3].Match.SharedUsers != 12 {
+		t.Fatalf("matches = %+v", ranked)
+	}
+	// 只有一个共同观众时置信度很低，协同分数几乎不改变内容排序。
+	ranked = hybridRank([]int{1, 2, 3}, []CollaborativeMatch{{MediaID: 3, SharedUsers: 1, Score: 0.9}})
+	if ids := hybridIDs(ranked); !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Fatalf("low-confidence ranking = %v", ids)
+	}
+}
+
+func TestFindSimilarWithReasonsBlendsCollaborativeMatches(t *testing.T) {
+	store := &hybridStoreStub{movies: map[int]catalog.Movie{
+		1: {ID: 1, DoubanID: "source", Title: "源电影", Genres: "科幻"},
+		2: {ID: 2, DoubanID: "content", Title: "内容相近", Genres: "科幻"},
+		3: {ID: 3, DoubanID: "crowd", Title: "大家也看", Genres: "纪录片"},
+	}, similar: []int{2}}
+	collaborative := &collaborativeStub{related: []CollaborativeMatch{{MediaID: 3, SharedUsers: 8, Score: 0.9}, {MediaID: 1, SharedUsers: 8, Score: 0.9}}}
+	result, source, err := NewService(store, WithCollaborative(collaborative)).FindSimilarWithReasons(context.Background(), "source", 8)
+	if err != nil || source == nil || len(result) != 2 {
+		t.Fatalf("result/source/error = %+v/%+v/%v", result, source, err)
+	}
+	if result[0].Movie.ID != 2 || result[0].ReasonType != "genre" {
+		t.Fatalf("content result = %+v", result[0])
+	}
+	if result[1].Movie.ID != 3 || result[1].ReasonType != "collaborative" || !strings.Contains(result[1].Reason, "8 位看过《源电影》") {
+		t.Fatalf("collaborative result = %+v", result[1])
+	}
+	if collaborative.relatedFor != 1 {
+		t.Fatalf("related lookup used media %d", collaborative.relatedFor)
+	}
+}
+
+type hybridStoreStub struct {
+	movies  map[int]catalog.Movie
+	similar []int
+}
+
+func (stub *hybridStoreStub) FindByDoubanID(_ context.Context, doubanID string) (*catalog.Movie, error) {
+	for _, movie := range stub.movies {
+		if movie.DoubanID == doubanID {
+			return &movie, nil
+		}
+	}
+	return nil, nil
+}
+
+func (stub *hybridStoreStub) FindByID(_ context.Context, id int) (*catalog.Movie, error) {
+	if movie, ok := stub.movies[id]; ok {
+		return &movie, nil
+	}
+	return nil, nil
+}
+
+func (stub *hybridStoreStub) FindSimilar(context.Context, string, int) ([]catalog.Movie, error) {
+	movies := make([]catalog.Movie, 0, len(stub.similar))
+	for _, id := range stub.similar {
+		movies = append(movies, stub.movies[id])
+	}
+	return movies, nil
+}
+
+func (stub *hybridStoreStub) FindSimilarByID(ctx context.Context, _ int, limit int) ([]catalog.Movie, error) {
+	return stub.FindSimilar(ctx, "", limit)
+}
+
+func (stub *hybridStoreStub) Popular(context.Context, int) ([]catalog.Movie, error) {
+	return []catalog.Movie{}, nil
+}
+
+type collaborativeStub struct {
+	related    []CollaborativeMatch
+	relatedFor int
+}
+
+func (stub *collaborativeStub) Related(_ context.Context, mediaID, _ int) ([]CollaborativeMatch, error) {
+	stub.relatedFor = mediaID
+	return stub.related, nil
+}
+
+func (stub *collaborativeStub) ForUser(context.Context, int, int) ([]CollaborativeMatch, error) {
+	return stub.related, nil
+}
+
+func hybridIDs(scores []hybridScore) []int {
+	ids := make([]int, len(scores))
+	for index, score := range scores {
+		ids[index] = score.MediaID
+	}
+	return ids
+}
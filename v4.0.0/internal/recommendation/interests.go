@@ -0,0 +1,285 @@
+package recommendation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+)
+
+// InterestProfiler 是多兴趣推荐需要的能力，由 catalog 实现：读出带权重的口味信号，
+// 再按任意口味向量找候选。个性化推荐实现了它，快照才按兴趣分组，否则只有一个平均口味向量。
+type InterestProfiler interface {
+	TasteSignals(ctx context.Context, userID int) ([]catalog.TasteSignal, error)
+	RecommendNear(ctx context.Context, userID int, taste []float32, limit int) ([]catalog.Movie, error)
+}
+
+// InterestRow 是「为你推荐」里的一行兴趣推荐，页面显示为「因为你喜欢 {Label}」。
+type InterestRow struct {
+	Label  string          `json:"label"`
+	Movies []catalog.Movie `json:"movies"`
+}
+
+const (
+	// maxInterests 是一位用户最多分出的兴趣数，再多页面上每行都太短。
+	maxInterests = 4
+	// minInterestSignals 是每个兴趣平均至少要有的正信号数，互动少的用户不硬拆。
+	minInterestSignals = 4
+	// interestIterations 是 k-means 的迭代上限，几百条信号通常三五轮就稳定了。
+	interestIterations = 10
+)
+
+// interest 是聚类得到的一组兴趣：组内的正信号和据此合成的口味向量。
+type interest struct {
+	signals []catalog.TasteSignal
+	weight  float64
+	vector  []float32
+}
+
+// InterestRows 把用户的互动聚成几个兴趣，每个兴趣各自召回 limit 部候选，再轮流分配去重。
+// 个性化推荐不支持分组时返回空列表，由调用方退回单一口味向量。
+func (service *Service) InterestRows(ctx context.Context, userID, limit int) ([]InterestRow, error) {
+	signals, err := service.tasteSignals(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("interest rows: %w", err)
+	}
+	return service.interestRows(ctx, userID, signals, limit)
+}
+
+// tasteSignals 读出用户带权重的口味信号，个性化推荐不支持多兴趣时返回空列表。
+func (service *Service) tasteSignals(ctx context.Context, userID int) ([]catalog.TasteSignal, error) {
+	profiler, ok := service.personalizer.(InterestProfiler)
+	if !ok {
+		return []catalog.TasteSignal{}, nil
+	}
+	return profiler.TasteSignals(ctx, userID)
+}
+
+// interestRows 用已经读好的口味信号分组召回，「为你推荐」快照还要拿同一批信号生成推荐理由。
+// 每行按 MMR 打散，同系列、同导演的不会挤在一起。
+func (service *Service) interestRows(ctx context.Context, userID int, signals []catalog.TasteSignal, limit int) ([]InterestRow, error) {
+	profiler, ok := service.personalizer.(InterestProfiler)
+	if !ok {
+		return []InterestRow{}, nil
+	}
+	interests := clusterInterests(signals)
+	candidates := make([][]catalog.Movie, len(interests))
+	for index, group := range interests {
+		var err error
+		if candidates[index], err = profiler.RecommendNear(ctx, userID, group.vector, limit); err != nil {
+			return nil, fmt.Errorf("interest rows: %w", err)
+		}
+	}
+	labels := interestLabels(interests)
+	rows := make([]InterestRow, len(interests))
+	for index := range rows {
+		rows[index] = InterestRow{Label: labels[index], Movies: []catalog.Movie{}}
+	}
+	roundRobin(candidates, func(index int, movie catalog.Movie) {
+		rows[index].Movies = append(rows[index].Movies, movie)
+	})
+	result := make([]InterestRow, 0, len(rows))
+	for _, row := range rows {
+		if len(row.Movies) > 0 {
+			row.Movies = diversify(row.Movies)
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
+
+// clusterInterests 用加权 k-means 把正信号按向量方向（余弦）分组，按组的总权重从大到小排列。
+// 初始中心取权重最大的那条，之后每次取离已有中心最远、权重又大的那条，结果不依赖随机数。
+// 每组的口味向量都带上全部负信号算一次，不喜欢的方向在每个兴趣里都被推开。
+func clusterInterests(signals []catalog.TasteSignal) []interest {
+	var positives, negatives []catalog.TasteSignal
+	for _, signal := range signals {
+		switch weight := signal.Weight(); {
+		case weight > 0 && len(signal.Embedding) > 0:
+			if len(positives) == 0 || len(signal.Embedding) == len(positives[0].Embedding) {
+				positives = append(positives, signal)
+			}
+		case weight < 0:
+			negatives = append(negatives, signal)
+		}
+	}
+	if len(positives) == 0 {
+		return nil
+	}
+	units := make([][]float64, len(positives))
+	for index, signal := range positives {
+		units[index] = unitVector(signal.Embedding)
+	}
+	centers := seedInterestCenters(positives, units, min(maxInterests, max(1, len(positives)/minInterestSignals)))
+	assignment := make([]int, len(positives))
+	for iteration := 0; iteration < interestIterations; iteration++ {
+		changed := iteration == 0
+		for index, unit := range units {
+			if nearest := nearestCenter(centers, unit); nearest != assignment[index] {
+				assignment[index], changed = nearest, true
+			}
+		}
+		if !changed {
+			break
+		}
+		sums := make([][]float64, len(centers))
+		for index, unit := range units {
+			center := assignment[index]
+			if sums[center] == nil {
+				sums[center] = make([]float64, len(unit))
+			}
+			for dimension, value := range unit {
+				sums[center][dimension] += positives[index].Weight() * value
+			}
+		}
+		for center, sum := range sums {
+			if sum != nil {
+				centers[center] = normalize(sum)
+			}
+		}
+	}
+	groups := make([]interest, len(centers))
+	for index, signal := range positives {
+		group := &groups[assignment[index]]
+		group.signals = append(group.signals, signal)
+		group.weight += signal.Weight()
+	}
+	interests := make([]interest, 0, len(groups))
+	for _, group := range groups {
+		if len(group.signals) == 0 {
+			continue
+		}
+		group.vector = catalog.TasteVector(append(append([]catalog.TasteSignal{}, group.signals...), negatives...))
+		interests = append(interests, group)
+	}
+	sort.SliceStable(interests, func(left, right int) bool { return interests[left].weight > interests[right].weight })
+	return interests
+}
+
+// seedInterestCenters 挑出 k 个初始中心。所有信号方向都一样时提前停下，少分几组。
+func seedInterestCenters(positives []catalog.TasteSignal, units [][]float64, k int) [][]float64 {
+	first := 0
+	for index, signal := range positives {
+		if signal.Weight() > positives[first].Weight() {
+			first = index
+		}
+	}
+	centers := [][]float64{units[first]}
+	for len(centers) < k {
+		best, bestScore := -1, 0.0
+		for index, unit := range units {
+			distance := 1 - dot(unit, centers[nearestCenter(centers, unit)])
+			if score := distance * positives[index].Weight(); score > bestScore+1e-9 {
+				best, bestScore = index, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		centers = append(centers, units[best])
+	}
+	return centers
+}
+
+// nearestCenter 返回余弦相似度最高的中心下标。
+func nearestCenter(centers [][]float64, unit []float64) int {
+	nearest, similarity := 0, math.Inf(-1)
+	for index, center := range centers {
+		if value := dot(center, unit); value > similarity {
+			nearest, similarity = index, value
+		}
+	}
+	return nearest
+}
+
+// interestLabels 给每组挑一个最有代表性的类型：组内占比比全体占比高得最多的那个，
+// 所以「剧情」这种人人都有的类型很少当选。已经被前面的组用掉的类型跳过，挑不出来就用组里权重最大的片名。
+func interestLabels(interests []interest) []string {
+	overall, total := map[string]float64{}, 0.0
+	perGroup := make([]map[string]float64, len(interests))
+	for index, group := range interests {
+		perGroup[index] = map[string]float64{}
+		for _, signal := range group.signals {
+			for genre := range peopleOrList(signal.Genres) {
+				perGroup[index][genre] += signal.Weight()
+				overall[genre] += signal.Weight()
+			}
+		}
+		total += group.weight
+	}
+	used := map[string]bool{}
+	labels := make([]string, len(interests))
+	for index, group := range interests {
+		label, bestLift, bestWeight := "", math.Inf(-1), 0.0
+		for genre, weight := range perGroup[index] {
+			if used[genre] {
+				continue
+			}
+			lift := weight/group.weight - overall[genre]/total
+			if lift > bestLift+1e-9 || (math.Abs(lift-bestLift) <= 1e-9 && (weight > bestWeight || (weight == bestWeight && genre < label))) {
+				label, bestLift, bestWeight = genre, lift, weight
+			}
+		}
+		if label == "" {
+			heaviest := group.signals[0]
+			for _, signal := range group.signals {
+				if signal.Weight() > heaviest.Weight() {
+					heaviest = signal
+				}
+			}
+			label = "《" + heaviest.Title + "》"
+		}
+		used[label] = true
+		labels[index] = label
+	}
+	return labels
+}
+
+// roundRobin 轮流从每组取下一部没出现过的影片交给 visit。一部片离几个兴趣都近时，
+// 归在它排得更靠前的那组，每组都能先拿到自己最贴近的片。
+func roundRobin(lists [][]catalog.Movie, visit func(index int, movie catalog.Movie)) {
+	seen := make(map[int]bool)
+	positions := make([]int, len(lists))
+	for remaining := true; remaining; {
+		remaining = false
+		for index, list := range lists {
+			for positions[index] < len(list) {
+				movie := list[positions[index]]
+				positions[index]++
+				if !seen[movie.ID] {
+					seen[movie.ID] = true
+					visit(index, movie)
+					break
+				}
+			}
+			remaining = remaining || positions[index] < len(list)
+		}
+	}
+}
+
+func unitVector(embedding []float32) []float64 {
+	vector := make([]float64, len(embedding))
+	for index, value := range embedding {
+		vector[index] = float64(value)
+	}
+	return normalize(vector)
+}
+
+func normalize(vector []float64) []float64 {
+	if norm := math.Sqrt(dot(vector, vector)); norm > 0 {
+		for index := range vector {
+			vector[index] /= norm
+		}
+	}
+	return vector
+}
+
+func dot(left, right []float64) float64 {
+	var sum float64
+	for index := range min(len(left), len(right)) {
+		sum += left[index] * right[index]
+	}
+	return sum
+}
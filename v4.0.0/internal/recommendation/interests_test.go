@@ -0,0 +1,108 @@
+package recommendation
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+)
+
+// twoInterestSignals 是同时爱看科幻和韩国爱情片的用户：两组向量方向几乎正交，
+// 平均下来的口味向量落在中间，哪一类都推不准。
+func twoInterestSignals() []catalog.TasteSignal {
+	signals := make([]catalog.TasteSignal, 0, 9)
+	for index := 0; index < 4; index++ {
+		signals = append(signals, catalog.TasteSignal{MediaID: index + 1, Title: "科幻片", Genres: "剧情,科幻", Kind: "watched", Rating: 5,
+			Embedding: []float32{1, 0.1 * float32(index), 0}})
+		signals = append(signals, catalog.TasteSignal{MediaID: index + 11, Title: "爱情片", Genres: "剧情/爱情", Kind: "wish",
+			Embedding: []float32{0.1 * float32(index), 1, 0}})
+	}
+	return append(signals, catalog.TasteSignal{MediaID: 21, Title: "不想看", Kind: "not_interested", Embedding: []float32{0, 0, 1}})
+}
+
+func TestClusterInterestsSeparatesDistinctTastesAndLabelsThem(t *testing.T) {
+	interests := clusterInterests(twoInterestSignals())
+	if len(interests) != 2 {
+		t.Fatalf("interests = %+v", interests)
+	}
+	for _, group := range interests {
+		if len(group.signals) != 4 || group.signals[0].Title != group.signals[3].Title {
+			t.Fatalf("mixed interest = %+v", group.signals)
+		}
+		// 负信号在每个兴趣里都被推开。
+		if group.vector[2] >= 0 {
+			t.Fatalf("interest vector ignores dislikes: %v", group.vector)
+		}
+	}
+	// 「剧情」两组都有，不当标签。
+	if labels := interestLabels(interests); !reflect.DeepEqual(labels, []string{"科幻", "爱情"}) {
+		t.Fatalf("labels = %v", labels)
+	}
+}
+
+func TestClusterInterestsKeepsSparseHistoryInOneGroup(t *testing.T) {
+	signals := twoInterestSignals()[:3]
+	interests := clusterInterests(signals)
+	if len(interests) != 1 || len(interests[0].signals) != 3 {
+		t.Fatalf("interests = %+v", interests)
+	}
+	if interests := clusterInterests([]catalog.TasteSignal{{Kind: "not_interested", Embedding: []float32{1}}}); len(interests) != 0 {
+		t.Fatalf("interests from dislikes only = %+v", interests)
+	}
+}
+
+func TestInterestRowsAssignSharedCandidatesOnce(t *testing.T) {
+	profiler := &fakeInterestProfiler{signals: twoInterestSignals(), near: func(taste []float32) []catalog.Movie {
+		if taste[0] > taste[1] {
+			return []catalog.Movie{{ID: 100}, {ID: 101}, {ID: 300}}
+		}
+		return []catalog.Movie{{ID: 300}, {ID: 200}}
+	}}
+	rows, err := NewService(nil, WithPersonalizer(profiler)).InterestRows(context.Background(), 7, 3)
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("rows/error = %+v/%v", rows, err)
+	}
+	if ids := movieIDs(rows[0].Movies); !reflect.DeepEqual(ids, []int{100, 101}) || rows[0].Label != "科幻" {
+		t.Fatalf("sci-fi row = %s %v", rows[0].Label, ids)
+	}
+	if ids := movieIDs(rows[1].Movies); !reflect.DeepEqual(ids, []int{300, 200}) || rows[1].Label != "爱情" {
+		t.Fatalf("romance row = %s %v", rows[1].Label, ids)
+	}
+	if rows, err := NewService(nil, WithPersonalizer(&fakePersonalizer{})).InterestRows(context.Background(), 7, 3); err != nil || len(rows) != 0 {
+		t.Fatalf("unsupported rows/error = %+v/%v", rows, err)
+	}
+}
+
+func TestSpreadInterestsInterleavesOverflowIntoPersonalized(t *testing.T) {
+	first, second := make([]catalog.Movie, 0, 9), make([]catalog.Movie, 0, 8)
+	for index := 1; index <= 9; index++ {
+		first = append(first, catalog.Movie{ID: index})
+	}
+	for index := 11; index <= 18; index++ {
+		second = append(second, catalog.Movie{ID: index})
+	}
+	personalized, rows := spreadInterests([]InterestRow{{Label: "科幻", Movies: first}, {Label: "爱情", Movies: second}})
+	if !reflect.DeepEqual(movieIDs(personalized), []int{1, 8, 17, 9, 18}) {
+		t.Fatalf("personalized = %v", movieIDs(personalized))
+	}
+	if len(rows) != 2 || !reflect.DeepEqual(movieIDs(rows[0].Movies), []int{2, 3, 4, 5, 6, 7}) ||
+		!reflect.DeepEqual(movieIDs(rows[1].Movies), []int{11, 12, 13, 14, 15, 16}) {
+		t.Fatalf("rows = %+v", rows)
+	}
+}
+
+type fakeInterestProfiler struct {
+	fakePersonalizer
+	signals []catalog.TasteSignal
+	near    func([]float32) []catalog.Movie
+}
+
+func (fake *fakeInterestProfiler) TasteSignals(context.Context, int) ([]catalog.TasteSignal, error) {
+	return fake.signals, nil
+}
+
+func (fake *fakeInterestProfiler) RecommendNear(_ context.Context, _ int, taste []float32, limit int) ([]catalog.Movie, error) {
+	movies := fake.near(taste)
+	return movies[:min(len(movies), limit)], nil
+}
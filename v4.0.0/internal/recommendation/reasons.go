@@ -0,0 +1,99 @@
+package recommendation
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+)
+
+// maxReasonAnchors 是生成个性化理由时参考的用户作品数，取权重最高的这几部。
+const maxReasonAnchors = 30
+
+// reasonAnchor 是个性化理由里引用的一部用户作品，label 是「你评分 5 星的《X》」这样的称呼。
+type reasonAnchor struct {
+	label    string
+	features features
+}
+
+// reasonAnchors 从口味信号里挑出权重最高的正信号作为理由的依据。
+func reasonAnchors(signals []catalog.TasteSignal) []reasonAnchor {
+	positives := make([]catalog.TasteSignal, 0, len(signals))
+	for _, signal := range signals {
+		if signal.Weight() > 0 && signal.Title != "" {
+			positives = append(positives, signal)
+		}
+	}
+	sort.SliceStable(positives, func(left, right int) bool { return positives[left].Weight() > positives[right].Weight() })
+	anchors := make([]reasonAnchor, 0, min(len(positives), maxReasonAnchors))
+	for _, signal := range positives[:min(len(positives), maxReasonAnchors)] {
+		anchors = append(anchors, reasonAnchor{label: anchorLabel(signal), features: extract(catalog.Movie{
+			Title: signal.Title, Year: signal.Year, Genres: signal.Genres, Directors: signal.Directors, Actors: signal.Actors,
+		})})
+	}
+	return anchors
+}
+
+// anchorLabel 按互动类型称呼用户的作品。
+func anchorLabel(signal catalog.TasteSignal) string {
+	switch {
+	case signal.Kind == "watched" && signal.Rating > 0:
+		return fmt.Sprintf("你评分 %d 星的《%s》", signal.Rating, signal.Title)
+	case signal.Kind == "watched":
+		return fmt.Sprintf("你看过的《%s》", signal.Title)
+	case signal.Kind == "wish":
+		return fmt.Sprintf("你想看的《%s》", signal.Title)
+	default:
+		return fmt.Sprintf("你最近在看的《%s》", signal.Title)
+	}
+}
+
+// personalReason 在所有依据作品里找和 target 关系最强的一条理由，沿用 GenerateReason 的候选和打分；
+// 分数相同时引用权重更高的作品。一条都不成立时返回空串，页面上就不显示理由。
+func personalReason(anchors []reasonAnchor, target catalog.Movie) string {
+	targetFeatures := extract(target)
+	var best reasonCandidate
+	var bestAnchor reasonAnchor
+	for _, anchor := range anchors {
+		candidates, _ := reasonCandidates(anchor.features, targetFeatures)
+		for _, candidate := range candidates {
+			if candidate.score > best.score {
+				best, bestAnchor = candidate, anchor
+			}
+		}
+	}
+	switch best.kind {
+	case "series":
+		return bestAnchor.label + "的同系列作品"
+	case "director":
+		return fmt.Sprintf("与%s同导演（%s）", bestAnchor.label, best.detail)
+	case "actor":
+		return fmt.Sprintf("和%s一样由 %s 主演", bestAnchor.label, best.detail)
+	case "genre":
+		return fmt.Sprintf("和%s同属%s片", bestAnchor.label, best.detail)
+	case "semantic":
+		return "剧情内核与" + bestAnchor.label + "相近"
+	default:
+		return ""
+	}
+}
+
+// personalReasons 给各板块的推荐影片生成理由，按 media.id 存进快照。
+func personalReasons(signals []catalog.TasteSignal, lists ...[]catalog.Movie) map[int]string {
+	reasons := make(map[int]string)
+	anchors := reasonAnchors(signals)
+	if len(anchors) == 0 {
+		return reasons
+	}
+	for _, movies := range lists {
+		for _, movie := range movies {
+			if _, done := reasons[movie.ID]; done || movie.ID == 0 {
+				continue
+			}
+			if reason := personalReason(anchors, movie); reason != "" {
+				reasons[movie.ID] = reason
+			}
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,33 @@
+package recommendation
+
+import (
+	"testing"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
+)
+
+func TestPersonalReasonsQuoteTheUsersOwnTitles(t *testing.T) {
+	signals := []catalog.TasteSignal{
+		{MediaID: 1, Title: "沙丘", Year: "2021", Genres: "科幻,冒险", Directors: `[{"name":"丹尼斯·维伦纽瓦"}]`, Kind: "watched", Rating: 5},
+		{MediaID: 2, Title: "花样年华", Year: "2000", Genres: "剧情,爱情", Directors: `[{"name":"王家卫"}]`, Kind: "wish"},
+		{MediaID: 3, Title: "恐怖片", Year: "2020", Genres: "恐怖", Directors: `[{"name":"某导演"}]`, Kind: "not_interested"},
+	}
+	reasons := personalReasons(signals, []catalog.Movie{
+		{ID: 10, Title: "银翼杀手2049", Year: "2017", Genres: "科幻,惊悚", Directors: `[{"name":"丹尼斯·维伦纽瓦"}]`},
+		{ID: 11, Title: "情书", Year: "1995", Genres: "爱情", Directors: `[{"name":"岩井俊二"}]`},
+		{ID: 12, Title: "午夜凶铃", Year: "1998", Genres: "恐怖", Directors: `[{"name":"某导演"}]`},
+	})
+	if reason := reasons[10]; reason != "与你评分 5 星的《沙丘》同导演（丹尼斯·维伦纽瓦）" {
+		t.Fatalf("director reason = %q", reason)
+	}
+	if reason := reasons[11]; reason != "和你想看的《花样年华》同属爱情片" {
+		t.Fatalf("genre reason = %q", reason)
+	}
+	// 不感兴趣的作品不会被当成理由引用。
+	if reason, ok := reasons[12]; ok {
+		t.Fatalf("reason from dismissed title = %q", reason)
+	}
+	if reasons := personalReasons(nil, []catalog.Movie{{ID: 10}}); len(reasons) != 0 {
+		t.Fatalf("reasons without signals = %v", reasons)
+	}
+}
@@ -1,7 +1,14 @@
 // Package recommendation 是推荐：相似影片、为你推荐、经典重温。
 //
 // 它自己不建表，数据全部来自 catalog（media 表和 pgvector 向量列）、
-// library（片单）和 history（观看记录）。
+// library（片单）和 history（观看记录）。「不感兴趣」反馈也由 catalog 存在
+// recommendation_feedback 里，和片单打分一起合成口味向量。
+//
+// 「看过 X 的人也看了 Y」的协同过滤数据是例外：media_cooccurrence 由本包的
+// CooccurrenceStore 每天重算，和向量相似度混合排序（hybrid.go），没人一起看过的冷门作品只看内容。
+//
+// 「为你推荐」快照由 Worker 生成：把用户的互动向量用 k-means 聚成几个兴趣（interests.go），
+// 每个兴趣各自召回候选，组成「因为你喜欢 科幻」这样带标签的几行。
 //
 // 相似推荐分两层：
 //
@@ -11,6 +18,7 @@ package recommendation
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"sort"
@@ -33,6 +41,7 @@ type Store interface {
 	FindByDoubanID(ctx context.Context, doubanID string) (*catalog.Movie, error)
 	FindByID(ctx context.Context, id int) (*catalog.Movie, error)
 	FindSimilar(ctx context.Context, doubanID string, limit int) ([]catalog.Movie, error)
+	FindSimilarByID(ctx context.Context, mediaID int, limit int) ([]catalog.Movie, error)
 	Popular(ctx context.Context, limit int) ([]catalog.Movie, error)
 }
 
@@ -43,10 +52,21 @@ type Personalizer interface {
 	RecentSimilar(ctx context.Context, userID, limit int) ([]catalog.Movie, string, error)
 }
 
+// FeedbackRecorder 是「不感兴趣」反馈，由 catalog 实现；个性化推荐实现了它才提供这个操作。
+type FeedbackRecorder interface {
+	MarkNotInterested(ctx context.Context, userID, mediaID int) error
+	NotInterestedMedia(ctx context.Context, userID int) (map[int]bool, error)
+}
+
+// ErrFeedbackUnavailable 表示没有注入支持反馈的个性化推荐实现。
+var ErrFeedbackUnavailable = errors.New("recommendation feedback is not available")
+
 // Service 是推荐服务。
 type Service struct {
-	store        Store
-	personalizer Personalizer
+	store         Store
+	personalizer  Personalizer
+	collaborative CollaborativeSource
+	library       GroupLibrary
 }
 
 // ServiceOption 用于注入个性化推荐。
@@ -71,6 +91,11 @@ func (service *Service) FindSimilar(ctx context.Context, doubanID string, limit
 	return service.store.FindSimilar(ctx, doubanID, limit)
 }
 
+// FindSimilarByID 按 media.id 返回相似影片，没有豆瓣 ID 的作品走这里。
+func (service *Service) FindSimilarByID(ctx context.Context, mediaID int, limit int) ([]catalog.Movie, error) {
+	return service.store.FindSimilarByID(ctx, mediaID, limit)
+}
+
 // FindByID 按主键查影片。
 func (service *Service) FindByID(ctx context.Context, id int) (*catalog.Movie, error) {
 	return service.store.FindByID(ctx, id)
@@ -100,24 +125,52 @@ func (service *Service) RecentSimilar(ctx context.Context, userID, limit int) ([
 	return service.personalizer.RecentSimilar(ctx, userID, limit)
 }
 
+// MarkNotInterested 记下用户不想再看到这部作品。
+func (service *Service) MarkNotInterested(ctx context.Context, userID, mediaID int) error {
+	recorder, ok := service.personalizer.(FeedbackRecorder)
+	if !ok {
+		return ErrFeedbackUnavailable
+	}
+	return recorder.MarkNotInterested(ctx, userID, mediaID)
+}
+
+// NotInterestedMedia 返回用户点过不感兴趣的作品；不支持反馈时返回空集合。
+func (service *Service) NotInterestedMedia(ctx context.Context, userID int) (map[int]bool, error) {
+	recorder, ok := service.personalizer.(FeedbackRecorder)
+	if !ok {
+		return map[int]bool{}, nil
+	}
+	return recorder.NotInterestedMedia(ctx, userID)
+}
+
 // Popular 返回热门影片，用于没有个人数据时兜底。
 func (service *Service) Popular(ctx context.Context, limit int) ([]catalog.Movie, error) {
 	return service.store.Popular(ctx, limit)
 }
 
-// FindSimilarWithReasons 在相似影片基础上补上推荐理由并按相似度重排。
-func (service *Service) FindSimilarWithReasons(ctx context.Context, doubanID string, limit int) ([]SimilarMovie, *catalog.Movie, error) {
-	source, err := service.store.FindByDoubanID(ctx, doubanID)
+// FindSimilarWithReasons 按详情页标识（豆瓣 ID 或 m<media.id>）找源影片，在相似影片基础上补上推荐理由，并用协同过滤数据混合重排（见 hybridRank）。
+// 只被协同过滤找到、或内容上说不出理由的作品，理由改成「N 位看过《X》的影迷也看了这部」。
+func (service *Service) FindSimilarWithReasons(ctx context.Context, movieKey string, limit int) ([]SimilarMovie, *catalog.Movie, error) {
+	source, err := service.findByMovieKey(ctx, movieKey)
 	if err != nil || source == nil {
 		return nil, source, err
 	}
-	movies, err := service.store.FindSimilar(ctx, doubanID, limit)
+	content, err := service.store.FindSimilarByID(ctx, source.ID, limit)
 	if err != nil {
 		return nil, source, err
 	}
+	fromContent := make(map[int]bool, len(content))
+	for _, movie := range content {
+		fromContent[movie.ID] = true
+	}
+	movies, matches := service.blendCollaborative(ctx, content, service.relatedMatches(ctx, source.ID, limit),
+		map[int]bool{source.ID: true}, limit)
 	result := make([]SimilarMovie, 0, len(movies))
 	for _, movie := range movies {
 		reason, reasonType, similarity := GenerateReason(*source, movie)
+		if match := matches[movie.ID]; match != nil && (!fromContent[movie.ID] || reasonType == "general") {
+			reason, reasonType = collaborativeReason(*source, *match), "collaborative"
+		}
 		result = append(result, SimilarMovie{Movie: movie, Reason: reason, ReasonType: reasonType, Similarity: similarity})
 	}
 	return result, source, nil
@@ -128,22 +181,39 @@ type features struct {
 	genres, directors, actors map[string]bool
 	year                      int
 	rating                    float64
-	title                     string
+	title, embeddingContent   string
 }
 
 // extract 从影片里抽取特征。
 func extract(movie catalog.Movie) features {
 	return features{
 		genres: peopleOrList(movie.Genres), directors: peopleOrList(movie.Directors), actors: peopleOrList(movie.Actors),
-		year: parseYear(movie.Year), rating: movie.Rating, title: movie.Title,
+		year: parseYear(movie.Year), rating: movie.Rating, title: movie.Title, embeddingContent: movie.EmbeddingContent,
 	}
 }
 
+// reasonCandidate 是一条候选理由，detail 是理由里点名的导演、演员或类型，生成个性化理由时要换一种说法。
+type reasonCandidate struct {
+	text, kind, detail string
+	score              float64
+}
+
 // GenerateReason 生成推荐理由和相似度。
 // 相似度权重：类型 0.40、导演 0.25、演员 0.20、评分 0.10、年代 0.05。
 // 理由从多个候选里挑分数最高的一条，系列续作优先级最高，都不满足时用通用话术兜底。
 func GenerateReason(source, target catalog.Movie) (string, string, float64) {
-	src, dst := extract(source), extract(target)
+	candidates, similarity := reasonCandidates(extract(source), extract(target))
+	best := reasonCandidate{text: "基于内容相似度深度推荐", kind: "general"}
+	for _, item := range candidates {
+		if item.score > best.score {
+			best = item
+		}
+	}
+	return best.text, best.kind, similarity
+}
+
+// reasonCandidates 列出两部影片之间所有成立的理由，同时算出相似度。
+func reasonCandidates(src, dst features) ([]reasonCandidate, float64) {
 	genreScore, commonGenres := overlap(src.genres, dst.genres)
 	directorScore, commonDirectors := overlap(src.directors, dst.directors)
 	actorScore, commonActors := overlap(src.actors, dst.actors)
@@ -151,36 +221,31 @@ func GenerateReason(source, target catalog.Movie) (string, string, float64) {
 	eraScore := eraSimilarity(src.year, dst.year)
 	similarity := genreScore*0.4 + directorScore*0.25 + actorScore*0.2 + ratingScore*0.1 + eraScore*0.05
 
-	type candidate struct {
-		text, kind string
-		score      float64
-	}
-	candidates := []candidate{}
-	if src.title != "" && dst.title != "" && (strings.HasPrefix(dst.title, src.title) || strings.HasPrefix(src.title, dst.title)) {
-		candidates = append(candidates, candidate{"该系列作品的延续，带你深入了解其光影宇宙", "series", 1.5})
+	candidates := []reasonCandidate{}
+	if sameFranchise(src.title, dst.title) {
+		candidates = append(candidates, reasonCandidate{text: "该系列作品的延续，带你深入了解其光影宇宙", kind: "series", score: 1.5})
 	}
 	if directorScore > 0.4 && len(commonDirectors) > 0 {
-		candidates = append(candidates, candidate{fmt.Sprintf("由同位导演 %s 执导，叙事风格与艺术造诣一脉相承", commonDirectors[0]), "director", 0.9 + directorScore})
+		candidates = append(candidates, reasonCandidate{text: fmt.Sprintf("由同位导演 %s 执导，叙事风格与艺术造诣一脉相承", commonDirectors[0]),
+			kind: "director", detail: commonDirectors[0], score: 0.9 + directorScore})
 	}
 	if actorScore > 0.2 && len(commonActors) > 0 {
-		candidates = append(candidates, candidate{fmt.Sprintf("同样由 %s 主演，演技表现与角色气质依然出众", commonActors[0]), "actor", 0.8 + actorScore})
+		candidates = append(candidates, reasonCandidate{text: fmt.Sprintf("同样由 %s 主演，演技表现与角色气质依然出众", commonActors[0]),
+			kind: "actor", detail: commonActors[0], score: 0.8 + actorScore})
 	}
 	if len(commonGenres) > 0 {
-		candidates = append(candidates, candidate{fmt.Sprintf("同属优质%s片，风格与本作高度契合", strings.Join(commonGenres, "、")), "genre", 0.7 + genreScore})
+		candidates = append(candidates, reasonCandidate{text: fmt.Sprintf("同属优质%s片，风格与本作高度契合", strings.Join(commonGenres, "、")),
+			kind: "genre", detail: strings.Join(commonGenres, "、"), score: 0.7 + genreScore})
 	}
-	if source.Rating > 8.5 && target.Rating > 8.5 && genreScore > 0.3 {
-		candidates = append(candidates, candidate{"两部作品均为 8.5+ 的顶级神作，艺术水准极高", "masterpiece", 1.2})
+	if src.rating > 8.5 && dst.rating > 8.5 && genreScore > 0.3 {
+		candidates = append(candidates, reasonCandidate{text: "两部作品均为 8.5+ 的顶级神作，艺术水准极高", kind: "masterpiece", score: 1.2})
 	}
-	if target.EmbeddingContent != "" {
-		candidates = append(candidates, candidate{fmt.Sprintf("剧情内核高度相关，共同探讨了关于 %s 的深刻主题", strings.Join(semanticKeywords(target.EmbeddingContent), "、")), "semantic", 0.6 + similarity*0.5})
-	}
-	best := candidate{"基于内容相似度深度推荐", "general", 0}
-	for _, item := range candidates {
-		if item.score > best.score {
-			best = item
-		}
+	if dst.embeddingContent != "" {
+		keywords := strings.Join(semanticKeywords(dst.embeddingContent), "、")
+		candidates = append(candidates, reasonCandidate{text: fmt.Sprintf("剧情内核高度相关，共同探讨了关于 %s 的深刻主题", keywords),
+			kind: "semantic", detail: keywords, score: 0.6 + similarity*0.5})
 	}
-	return best.text, best.kind, similarity
+	return candidates, similarity
 }
 
 // peopleOrList 把逗号分隔的人名或类型拆成集合。
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math"
 	"sort"
 	"strings"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
 	"github.com/TwoThreeWang/Moovie/new/internal/library"
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
 )
 
 // posterWallSize 是海报墙的影片数量。
@@ -19,15 +21,33 @@ const posterWallSize = 4
 
 // Service 负责生成月报。
 type Service struct {
-	store   Store
-	library library.Store
-	catalog catalog.Store
-	now     func() time.Time
+	store    Store
+	library  library.Store
+	catalog  catalog.Store
+	notifier Notifier
+	now      func() time.Time
+}
+
+// Notifier 是站内通知的写入能力，由 notifications.Service 实现。
+type Notifier interface {
+	NotifyUser(ctx context.Context, userID int, notification notifications.Notification) error
+}
+
+// ServiceOption 用于注入可选依赖。
+type ServiceOption func(*Service)
+
+// WithNotifier 让月报生成好之后通知本人。
+func WithNotifier(notifier Notifier) ServiceOption {
+	return func(service *Service) { service.notifier = notifier }
 }
 
 // NewService 创建月报服务。
-func NewService(store Store, libraryStore library.Store, catalogStore catalog.Store) *Service {
-	return &Service{store: store, library: libraryStore, catalog: catalogStore, now: time.Now}
+func NewService(store Store, libraryStore library.Store, catalogStore catalog.Store, options ...ServiceOption) *Service {
+	service := &Service{store: store, library: libraryStore, catalog: catalogStore, now: time.Now}
+	for _, option := range options {
+		option(service)
+	}
+	return service
 }
 
 // reportData 是算好但还没落库的报告内容。
@@ -98,9 +118,30 @@ func (service *Service) Generate(ctx context.Context, userID int, yearMonth stri
 		_ = service.store.UpdateStatus(ctx, report.ID, StatusFailed, "更新报告失败")
 		return fmt.Errorf("更新报告失败: %w", err)
 	}
+	service.notifyGenerated(ctx, *report)
 	return nil
 }
 
+// notifyGenerated 告诉用户月报生成好了。同一个月重新生成不再通知；报告已经落库，通知失败只记日志。
+func (service *Service) notifyGenerated(ctx context.Context, report MonthlyReport) {
+	if service.notifier == nil {
+		return
+	}
+	month := report.YearMonth
+	if parsed, err := time.Parse("2006-01", report.YearMonth); err == nil {
+		month = fmt.Sprintf("%d 年 %d 月", parsed.Year(), parsed.Month())
+	}
+	body := fmt.Sprintf("这个月看了 %d 部", report.WatchedCount)
+	if report.PersonaTitle != "" {
+		body += "，你是「" + report.PersonaTitle + "」"
+	}
+	notification := notifications.Notification{Kind: notifications.KindMonthlyReport, Title: month + "的观影小记生成好了",
+		Body: body + "。", Link: fmt.Sprintf("/user/%d/monthly/%s", report.UserID, report.YearMonth), DedupeKey: report.YearMonth}
+	if err := service.notifier.NotifyUser(ctx, report.UserID, notification); err != nil {
+		slog.Warn("notify monthly report generated", "user_id", report.UserID, "year_month", report.YearMonth, "error", err)
+	}
+}
+
 // GeneratePreviousMonth 给所有有记录的用户批量生成上个月的报告，由每日任务触发。
 func (service *Service) GeneratePreviousMonth(ctx context.Context) error {
 	now := service.now()
@@ -1,6 +1,7 @@
 package report
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
 	"testing"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/TwoThreeWang/Moovie/new/internal/catalog"
 	"github.com/TwoThreeWang/Moovie/new/internal/library"
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
 )
 
@@ -68,3 +70,34 @@ func TestGenerateRejectsInvalidOrEmptyMonthAndPersistsFailure(t *testing.T) {
 		t.Fatalf("failed report = %+v", report)
 	}
 }
+
+func TestGenerateNotifiesOwnerOnlyWhenReportIsReady(t *testing.T) {
+	testdb.User(t, testdb.Pool(t), 7)
+	libraryStore := library.NewPostgresStore(testdb.Pool(t))
+	watchedAt := time.Date(2026, 7, 12, 20, 0, 0, 0, time.Local)
+	_ = libraryStore.Upsert(t.Context(), library.Record{UserID: 7, MovieID: "1", Title: "一", Status: library.StatusWatched, Rating: 4, CreatedAt: watchedAt, UpdatedAt: watchedAt})
+	notifier := &recordingNotifier{}
+	service := NewService(NewPostgresStore(testdb.Pool(t)), libraryStore, catalog.NewPostgresStore(testdb.Pool(t)), WithNotifier(notifier))
+	if err := service.Generate(t.Context(), 7, "2026-06", nil); err == nil {
+		t.Fatal("empty month was generated")
+	}
+	if err := service.Generate(t.Context(), 7, "2026-07", map[int]int{7: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.sent) != 1 || notifier.users[0] != 7 || notifier.sent[0].Kind != notifications.KindMonthlyReport ||
+		notifier.sent[0].Title != "2026 年 7 月的观影小记生成好了" || notifier.sent[0].Link != "/user/7/monthly/2026-07" ||
+		notifier.sent[0].DedupeKey != "2026-07" || !strings.HasPrefix(notifier.sent[0].Body, "这个月看了 1 部") {
+		t.Fatalf("notifications = %+v", notifier.sent)
+	}
+}
+
+type recordingNotifier struct {
+	users []int
+	sent  []notifications.Notification
+}
+
+func (notifier *recordingNotifier) NotifyUser(_ context.Context, userID int, notification notifications.Notification) error {
+	notifier.users = append(notifier.users, userID)
+	notifier.sent = append(notifier.sent, notification)
+	return nil
+}
@@ -90,7 +90,8 @@ func (handler *Handler) unifiedSearchAPI(c *gin.Context) {
 		"filtered_count": result.FilteredCount, "duration_ms": result.DurationMS,
 		"resource_duration_ms": result.ResourceDurationMS, "resource_unavailable": result.ResourceUnavailable,
 		"catalog_duration_ms": result.CatalogDurationMS,
-		"catalog_fallback":    result.CatalogFallback})
+		"catalog_fallback":    result.CatalogFallback,
+		"mode":                result.Mode, "semantic_fallback": result.SemanticFallback})
 }
 
 // unifiedSearchHTMX 返回 HTMX 片段并记录一次搜索日志。
@@ -111,7 +112,7 @@ func (handler *Handler) unifiedSearchHTMX(c *gin.Context) {
 		}
 		result.Items = items
 	}
-	c.HTML(http.StatusOK, "partials/unified_search_results.html", gin.H{"Result": result, "Keyword": c.Query("q")})
+	c.HTML(http.StatusOK, "partials/unified_search_results.html", gin.H{"Result": result, "Keyword": c.Query("q"), "Bypass": c.Query("bypass") == "1"})
 }
 
 // runUnifiedSearch 校验参数、查缓存、执行统一搜索。返回值第二项为 false 表示已经写过错误响应。
@@ -131,10 +132,15 @@ func (handler *Handler) runUnifiedSearch(c *gin.Context) (UnifiedResult, bool) {
 		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid_type", "message": "type 仅支持 movie 或 tv"})
 		return UnifiedResult{}, false
 	}
+	mode, ok := searchMode(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid_mode", "message": "mode 仅支持 keyword 或 semantic"})
+		return UnifiedResult{}, false
+	}
 	excludeSourceKey, excludeVodID := excludedResource(c.Query("exclude"))
 	query := UnifiedQuery{Keyword: keyword, Year: c.Query("year"), MediaType: mediaType,
 		ExcludeSourceKey: excludeSourceKey, ExcludeVodID: excludeVodID,
-		BypassFilter: c.Query("bypass") == "1", Limit: limit}
+		BypassFilter: c.Query("bypass") == "1", Limit: limit, Mode: mode}
 	cacheKey := unifiedSearchCacheKey(query)
 	if cached, stale, found := handler.cache.GetStale(cacheKey); found {
 		if stale {
@@ -163,10 +169,33 @@ func (handler *Handler) runUnifiedSearch(c *gin.Context) (UnifiedResult, bool) {
 }
 
 // unifiedSearchCacheKey 用全部查询条件拼缓存键，避免不同筛选条件互相串结果。
+// 空 mode 和 keyword 是同一种搜索，热搜预热不带 mode 也要命中同一条缓存。
 func unifiedSearchCacheKey(query UnifiedQuery) string {
-	return fmt.Sprintf("search:%s:%s:%s:%s:%s:%t:%d", strings.ToLower(query.Keyword), query.Year,
+	if query.Mode == "" {
+		query.Mode = SearchModeKeyword
+	}
+	return fmt.Sprintf("search:%s:%s:%s:%s:%s:%t:%d:%s", strings.ToLower(query.Keyword), query.Year,
 		normalizeMediaType(query.MediaType), query.ExcludeSourceKey, query.ExcludeVodID,
-		query.BypassFilter, query.Limit)
+		query.BypassFilter, query.Limit, query.Mode)
+}
+
+// searchMode 解析 mode 参数，缺省为关键词搜索。搜索页的 HTMX 请求地址是固定模板拼的，
+// 不带 mode，所以没有显式参数时再看 HX-Current-URL，也就是 /search?kw=...&mode=semantic 这一页本身。
+func searchMode(c *gin.Context) (string, bool) {
+	mode, found := c.GetQuery("mode")
+	if !found {
+		if current, err := url.Parse(c.GetHeader("HX-Current-URL")); err == nil && current.Path == "/search" {
+			mode = current.Query().Get("mode")
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", SearchModeKeyword:
+		return SearchModeKeyword, true
+	case SearchModeSemantic:
+		return SearchModeSemantic, true
+	default:
+		return "", false
+	}
 }
 
 // excludedResource 解析 exclude=source:vodid 参数，用于“换个线路”时排除当前正在播放的资源。
@@ -196,7 +225,7 @@ func (handler *Handler) searchPage(c *gin.Context) {
 	view := platformweb.NewViewModel(c, handler.config, platformweb.Metadata{
 		Title:       keyword + "在线观看 - " + keyword + "免费高清资源搜索 - " + handler.config.SiteName,
 		Description: "Moovie影牛 为您找到关于“" + keyword + "”的相关资源。包含最新电影、电视剧在线观看线路，支持4K/高清多源码切换。",
-		Canonical:   fmt.Sprintf("%s/search?kw=%s", handler.config.SiteURL, keyword),
+		Canonical:   fmt.Sprintf("%s/search?kw=%s", handler.config.SiteURL, url.QueryEscape(keyword)),
 	})
 	view.Keyword = keyword
 	view.Bypass = c.Query("bypass") == "1"
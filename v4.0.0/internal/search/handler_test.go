@@ -41,7 +41,7 @@ func TestSearchPageRedirectsAndPreservesSEOFormula(t *testing.T) {
 	if snapshot.Description != "Moovie影牛 为您找到关于“肖申克”的相关资源。包含最新电影、电视剧在线观看线路，支持4K/高清多源码切换。" {
 		t.Fatalf("description = %q", snapshot.Description)
 	}
-	if snapshot.Canonical != "https://moovie.example/search?kw=%e8%82%96%e7%94%b3%e5%85%8b" || snapshot.Robots != "index, follow" {
+	if snapshot.Canonical != "https://moovie.example/search?kw=%E8%82%96%E7%94%B3%E5%85%8B" || snapshot.Robots != "index, follow" {
 		t.Fatalf("canonical/robots = %q/%q", snapshot.Canonical, snapshot.Robots)
 	}
 	body := responseBody(t, app.client, app.baseURL+"/search?kw=%E8%82%96%E7%94%B3%E5%85%8B")
@@ -192,6 +192,7 @@ func TestUnifiedSearchAPIValidatesStableQueryContract(t *testing.T) {
 		{path: "/api/v2/search", code: "invalid_query"},
 		{path: "/api/v2/search?q=test&limit=101", code: "invalid_limit"},
 		{path: "/api/v2/search?q=test&type=invalid", code: "invalid_type"},
+		{path: "/api/v2/search?q=test&mode=vector", code: "invalid_mode"},
 	} {
 		response := performRequest(app.handler, testCase.path)
 		if response.Code != http.StatusBadRequest || !strings.Contains(response.Body.String(), `"code":"`+testCase.code+`"`) {
@@ -200,6 +201,29 @@ func TestUnifiedSearchAPIValidatesStableQueryContract(t *testing.T) {
 	}
 }
 
+func TestSemanticModeComesFromQueryOrSearchPageURL(t *testing.T) {
+	resources := &fakeSearcher{}
+	catalog := &semanticUnifiedCatalog{semantic: []UnifiedItem{{MediaID: 3, Title: "星际穿越", Score: 0.8}}}
+	app := newSearchTestApp(t, resources, WithUnifiedSearcher(NewUnifiedSearchService(resources,
+		WithUnifiedCatalog(catalog), WithSemanticSearch(&queryEmbedderStub{vector: []float32{0.1}}))))
+	response := performRequest(app.handler, "/api/v2/search?q=%E5%A4%AA%E7%A9%BA&mode=semantic")
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"mode":"semantic"`) || !strings.Contains(response.Body.String(), "星际穿越") {
+		t.Fatalf("semantic API = %d %s", response.Code, response.Body.String())
+	}
+	// 搜索页模板里的 HTMX 地址不带 mode，只能从 HX-Current-URL 读出当前页的选择。
+	request := httptest.NewRequest(http.MethodGet, "/api/htmx/search?q=%E5%A4%AA%E7%A9%BA", nil)
+	request.Header.Set("HX-Current-URL", "https://moovie.example/search?kw=%E5%A4%AA%E7%A9%BA&mode=semantic")
+	recorder := httptest.NewRecorder()
+	app.handler.ServeHTTP(recorder, request)
+	if !strings.Contains(recorder.Body.String(), "语义匹配") || !strings.Contains(recorder.Body.String(), "改用片名搜索") {
+		t.Fatalf("semantic fragment = %s", recorder.Body.String())
+	}
+	keyword := performRequest(app.handler, "/api/v2/search?q=%E5%A4%AA%E7%A9%BA")
+	if !strings.Contains(keyword.Body.String(), `"mode":"keyword"`) || resources.callCount() != 1 {
+		t.Fatalf("keyword search reused semantic cache: %s calls=%d", keyword.Body.String(), resources.callCount())
+	}
+}
+
 func TestTrendsPagePreservesThresholdsSEOAndCache(t *testing.T) {
 	now := time.Date(2026, time.July, 29, 12, 34, 0, 0, time.UTC)
 	logger := &fakeSearchLogStore{trending: map[int][]TrendingKeyword{
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/TwoThreeWang/Moovie/new/internal/platform/database/testdb"
 )
 
 func TestPostgresStoreSearchUsesPlaybackQualityAndPreservesMapping(t *testing.T) {
@@ -40,16 +42,20 @@ func TestPostgresStoreSearchUsesPlaybackQualityAndPreservesMapping(t *testing.T)
 }
 
 func TestPostgresStoreSearchesCanonicalMediaAndAliases(t *testing.T) {
-	database := &fakeSQLDatabase{rows: &fakeSQLRows{values: [][]any{{int64(7), "流浪地球", "The Wandering Earth", []string{"流浪地球别名"}, "2019", "movie", "poster", "26266893", 9.7, "一部关于...", "科幻,冒险", "中国", `[{"name":"导演甲"}]`, `[{"name":"演员甲"}]`, "125分钟"}}}}
+	database := &fakeSQLDatabase{rows: &fakeSQLRows{values: [][]any{{int64(7), "流浪地球", "The Wandering Earth", []string{"流浪地球别名"}, "2019", "movie", "poster", "26266893", 9.7, "一部关于...", "科幻,冒险", "中国", `[{"name":"导演甲"}]`, `[{"name":"演员甲"}]`, "125分钟", "LKO2?U%2Tw=w]~RBVZRi};RPxuwH", "#1a2b3c"}}}}
 	store := NewPostgresStore(database)
 	items, err := store.SearchUnifiedMedia(t.Context(), UnifiedQuery{Keyword: "流浪", Year: "2019", MediaType: "film", Limit: 20})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(items) != 1 || items[0].MediaID != 7 || items[0].Title != "流浪地球" || len(items[0].SearchAliases) != 1 || items[0].Resources == nil || len(items[0].ActorNames()) != 1 {
+	if len(items) != 1 || items[0].MediaID != 7 || items[0].Title != "流浪地球" || len(items[0].SearchAliases) != 1 || items[0].Resources == nil || len(items[0].ActorNames()) != 1 ||
+		items[0].PosterBlurhash == "" || items[0].PosterColor != "#1a2b3c" {
 		t.Fatalf("items = %+v", items)
 	}
-	for _, expected := range []string{"FROM media", "media.douban_id <> ''", "media_aliases", "$2 <> '' AND alias.normalized_alias LIKE $2", "media.media_type = $4", "LIMIT $6"} {
+	if strings.Contains(database.query, "douban_id <> ''") {
+		t.Fatalf("canonical query still hides media without a Douban ID: %s", database.query)
+	}
+	for _, expected := range []string{"FROM media", "media.merged_into_id IS NULL", "media_aliases", "$2 <> '' AND alias.normalized_alias LIKE $2", "media.media_type = $4", "LIMIT $6"} {
 		if !strings.Contains(database.query, expected) {
 			t.Fatalf("canonical query missing %q: %s", expected, database.query)
 		}
@@ -59,6 +65,70 @@ func TestPostgresStoreSearchesCanonicalMediaAndAliases(t *testing.T) {
 	}
 }
 
+func TestPostgresStoreSearchesSemanticMediaByVectorDistance(t *testing.T) {
+	database := &fakeSQLDatabase{rows: &fakeSQLRows{values: [][]any{{int64(7), "星际穿越", "Interstellar", []string{}, "2014", "movie", "poster", "1889243", 9.4, "一队探险家...", "科幻", "美国", `[]`, `[]`, "169分钟", "", "", 0.83}}}}
+	store := NewPostgresStore(database)
+	vector := []float32{0.1, 0.2, 0.3}
+	items, err := store.SearchSemanticMedia(t.Context(), UnifiedQuery{Keyword: "穿越虫洞拯救人类", MediaType: "film", Limit: 5}, vector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].MediaID != 7 || items[0].Score != 0.83 || items[0].Resources == nil {
+		t.Fatalf("items = %+v", items)
+	}
+	// 打分和排序用同一个 L2 度量，走 vector_l2_ops 的 HNSW 索引。
+	for _, expected := range []string{"$1::real[]::vector", "media.embedding IS NOT NULL", "1 - power(media.embedding <-> target.embedding, 2) / 2", "ORDER BY media.embedding <-> target.embedding", "LIMIT $4"} {
+		if !strings.Contains(database.query, expected) {
+			t.Fatalf("semantic query missing %q: %s", expected, database.query)
+		}
+	}
+	// 候选数固定取索引一次能给的上限，最终条数由服务层在混合打分后再截。
+	if !reflect.DeepEqual(database.arguments, []any{vector, "", "movie", semanticCandidateLimit}) {
+		t.Fatalf("arguments = %#v", database.arguments)
+	}
+}
+
+func TestSemanticSearchRaisesEfSearchOnlyWhenFiltered(t *testing.T) {
+	fake := &fakeSQLBeginner{fakeSQLDatabase: &fakeSQLDatabase{rows: &fakeSQLRows{}}}
+	store := NewPostgresStore(fake)
+	if _, err := store.SearchSemanticMedia(t.Context(), UnifiedQuery{Keyword: "太空"}, []float32{0.1}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.began || len(fake.execQueries) != 0 {
+		t.Fatalf("unfiltered search opened a transaction: %v", fake.execQueries)
+	}
+	fake.rows = &fakeSQLRows{}
+	if _, err := store.SearchSemanticMedia(t.Context(), UnifiedQuery{Keyword: "太空", Year: "2014"}, []float32{0.1}); err != nil {
+		t.Fatal(err)
+	}
+	if !fake.began || !fake.committed || len(fake.execQueries) != 1 ||
+		fake.execQueries[0] != "SET LOCAL hnsw.ef_search = "+strconv.Itoa(semanticFilteredEfSearch) {
+		t.Fatalf("filtered search = began %v committed %v exec %v", fake.began, fake.committed, fake.execQueries)
+	}
+}
+
+func TestSearchFindsMediaWithoutDoubanID(t *testing.T) {
+	pool := testdb.Pool(t)
+	testdb.Media(t, pool, 1)
+	// 只有 TMDB 资料的作品：douban_id 为空，关键词和语义搜索都要能找到它，详情链接用 m<media.id>。
+	if _, err := pool.Exec(t.Context(), `UPDATE media SET title = '只在TMDB的片', embedding = array_fill(0.1::real, ARRAY[768])::vector WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	store := NewPostgresStore(pool)
+	items, err := store.SearchUnifiedMedia(t.Context(), UnifiedQuery{Keyword: "只在TMDB", Limit: 10})
+	if err != nil || len(items) != 1 || items[0].MediaID != 1 || items[0].DoubanID != "" || items[0].DetailKey() != "m1" {
+		t.Fatalf("keyword items = %+v / %v", items, err)
+	}
+	vector := make([]float32, 768)
+	for index := range vector {
+		vector[index] = 0.1
+	}
+	items, err = store.SearchSemanticMedia(t.Context(), UnifiedQuery{Keyword: "描述", Limit: 10}, vector)
+	if err != nil || len(items) != 1 || items[0].MediaID != 1 {
+		t.Fatalf("semantic items = %+v / %v", items, err)
+	}
+}
+
 func TestPostgresStoreBuildsReadyPlaybackSummaryFromUsableResources(t *testing.T) {
 	visitedAt := time.Date(2026, time.August, 3, 1, 2, 3, 0, time.UTC)
 	database := &fakeSQLDatabase{rows: &fakeSQLRows{values: [][]any{{
@@ -279,6 +349,27 @@ func (fake *fakeSQLDatabase) Exec(_ context.Context, query string, arguments ...
 	return 1, fake.err
 }
 
+// fakeSQLBeginner 给 fakeSQLDatabase 加上事务能力，事务里的语句照样记在 fakeSQLDatabase 上。
+type fakeSQLBeginner struct {
+	*fakeSQLDatabase
+	began     bool
+	committed bool
+}
+
+func (fake *fakeSQLBeginner) Begin(context.Context) (database.Transaction, error) {
+	fake.began = true
+	return fakeSQLTransaction{fake}, nil
+}
+
+type fakeSQLTransaction struct{ *fakeSQLBeginner }
+
+func (transaction fakeSQLTransaction) Commit(context.Context) error {
+	transaction.committed = true
+	return nil
+}
+
+func (fakeSQLTransaction) Rollback(context.Context) error { return nil }
+
 type fakeSQLRows struct {
 	values [][]any
 	index  int
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 统一搜索的两种检索方式，对应 /search 和 /api/v2/search 的 mode 参数。
+const (
+	SearchModeKeyword  = "keyword"
+	SearchModeSemantic = "semantic"
+)
+
+// QueryEmbedder 把搜索词变成向量，必须和 media.embedding 出自同一模型、同一维度。
+// catalog.EmbeddingService 实现了它；向量代际正在切换时应当报错，让搜索退回关键词。
+type QueryEmbedder interface {
+	EmbedQuery(ctx context.Context, text string) ([]float32, error)
+}
+
+// SemanticCatalog 是媒体库的向量检索能力：按与 vector 的距离取最近的一批媒体，
+// Score 填余弦相似度（-1~1），混合打分在服务层做。
+type SemanticCatalog interface {
+	SearchSemanticMedia(ctx context.Context, query UnifiedQuery, vector []float32) ([]UnifiedItem, error)
+}
+
+const (
+	// semanticEmbedBudget 是搜索词向量化的时限。向量后端卡住时宁可退回关键词，也不让搜索页一直转圈。
+	semanticEmbedBudget = 3 * time.Second
+	// semanticCandidateLimit 是向量召回的候选数。HNSW 索引一次扫描最多给 hnsw.ef_search（默认 40）行，
+	// 取再多也拿不到；混合打分只在这批候选里重排。
+	semanticCandidateLimit = 40
+	// semanticFilteredEfSearch 是带年份、类型筛选时的 hnsw.ef_search。筛选在索引扫描之后才做，
+	// 默认 40 行筛完可能所剩无几，放大扫描范围后筛完仍能凑够 semanticCandidateLimit。
+	semanticFilteredEfSearch = 400
+)
+
+// 混合打分的权重：语义相似度为主，关键词命中和豆瓣评分只用来在相近的候选之间拉开差距。
+const (
+	semanticSimilarityWeight = 0.7
+	semanticKeywordWeight    = 0.2
+	semanticRatingWeight     = 0.1
+)
+
+var errSemanticSearchUnavailable = errors.New("semantic search is not configured")
+
+// searchSemantic 向量化搜索词 → k-NN 召回 → 补播放资源 → 混合打分排序。
+// 不查资源站：自然语言描述拿去资源站按片名搜只会得到噪音。没有命中也按错误返回，由调用方退回关键词。
+func (service *UnifiedSearchService) searchSemantic(ctx context.Context, query UnifiedQuery) (UnifiedResult, error) {
+	semantic, ok := service.catalog.(SemanticCatalog)
+	if !ok || service.embedder == nil {
+		return UnifiedResult{}, errSemanticSearchUnavailable
+	}
+	catalogStarted := time.Now()
+	embedCtx, cancel := context.WithTimeout(ctx, semanticEmbedBudget)
+	vector, err := service.embedder.EmbedQuery(embedCtx, query.Keyword)
+	cancel()
+	if err != nil {
+		return UnifiedResult{}, fmt.Errorf("embed search query: %w", err)
+	}
+	candidates, err := semantic.SearchSemanticMedia(ctx, query, vector)
+	if err != nil {
+		return UnifiedResult{}, err
+	}
+	if len(candidates) == 0 {
+		return UnifiedResult{}, errors.New("semantic search returned no media")
+	}
+	mediaIDs := make([]int, 0, len(candidates))
+	groups := make(map[int]*UnifiedItem, len(candidates))
+	for index := range candidates {
+		item := &candidates[index]
+		item.Resources = make([]UnifiedResource, 0)
+		item.Score = semanticScore(query.Keyword, *item)
+		groups[item.MediaID] = item
+		mediaIDs = append(mediaIDs, item.MediaID)
+	}
+	resources, resourceErr := service.catalog.ListUnifiedResources(ctx, mediaIDs)
+	if resourceErr == nil {
+		for _, resource := range resources {
+			if group := groups[resource.MediaID]; group != nil && !query.excludes(resource.SourceKey, resource.VodId) {
+				appendUniqueUnifiedResource(group, resource)
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(left, right int) bool { return candidates[left].Score > candidates[right].Score })
+	items := candidates[:min(len(candidates), query.Limit)]
+	for index := range items {
+		finalizeUnifiedItem(&items[index])
+	}
+	return UnifiedResult{Items: items, Unmatched: []UnifiedResource{}, CatalogDurationMS: time.Since(catalogStarted).Milliseconds(),
+		CatalogFallback: resourceErr != nil, Mode: SearchModeSemantic}, nil
+}
+
+// semanticScore 把存储层给出的余弦相似度和关键词覆盖率、豆瓣评分按权重混合。
+// 「诺兰 时间」这类夹着人名片名的描述，只靠向量容易被题材相近的片子挤下去，关键词分把它们拉回来。
+func semanticScore(keyword string, item UnifiedItem) float64 {
+	rating := min(max(item.RatingDouban, 0), 10) / 10
+	return semanticSimilarityWeight*item.Score + semanticKeywordWeight*keywordCoverage(keyword, item) + semanticRatingWeight*rating
+}
+
+// keywordCoverage 是搜索词里能在标题、别名、类型、人物或简介中原样找到的词所占比例（0~1）。
+// 按空白和标点切词，不做中文分词：整句中文只算一个词，只有标题或简介里真有这句才加分。
+func keywordCoverage(keyword string, item UnifiedItem) float64 {
+	terms := strings.FieldsFunc(strings.ToLower(keyword), func(r rune) bool { return unicode.IsSpace(r) || unicode.IsPunct(r) })
+	if len(terms) == 0 {
+		return 0
+	}
+	haystack := strings.ToLower(strings.Join(append([]string{item.Title, item.OriginalTitle, item.Genres,
+		item.Directors, item.Actors, item.Summary}, item.SearchAliases...), "\n"))
+	matched := 0
+	for _, term := range terms {
+		if strings.Contains(haystack, term) {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(terms))
+}
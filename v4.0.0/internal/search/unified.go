@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,29 +21,36 @@ type UnifiedQuery struct {
 	ExcludeVodID     string
 	BypassFilter     bool
 	Limit            int
+	// Mode 为空或 keyword 时按标题/别名检索，semantic 时按语义向量检索（见 semantic.go）。
+	Mode string
 }
 
 // UnifiedItem 是按规范媒体聚合后的一条结果，底下挂着来自各资源站的播放资源。
+// PosterBlurhash、PosterColor 是海报加载前的占位（BlurHash 和 #rrggbb 主色），还没算过时为空。
+// Score 只在语义搜索时有值，是向量相似度、关键词和评分混合后的排序分。
 type UnifiedItem struct {
-	MediaID       int               `json:"media_id"`
-	Title         string            `json:"title"`
-	OriginalTitle string            `json:"original_title,omitempty"`
-	Year          string            `json:"year,omitempty"`
-	MediaType     string            `json:"media_type,omitempty"`
-	Poster        string            `json:"poster,omitempty"`
-	DoubanID      string            `json:"douban_id,omitempty"`
-	RatingDouban  float64           `json:"rating_douban,omitempty"`
-	Summary       string            `json:"summary,omitempty"`
-	Genres        string            `json:"genres,omitempty"`
-	Countries     string            `json:"countries,omitempty"`
-	Directors     string            `json:"directors,omitempty"`
-	Actors        string            `json:"actors,omitempty"`
-	Duration      string            `json:"duration,omitempty"`
-	ResourceCount int               `json:"resource_count"`
-	PlaybackState PlaybackState     `json:"playback_state"`
-	Resources     []UnifiedResource `json:"resources"`
-	BestResource  *UnifiedResource  `json:"best_resource,omitempty"`
-	SearchAliases []string          `json:"-"`
+	MediaID        int               `json:"media_id"`
+	Title          string            `json:"title"`
+	OriginalTitle  string            `json:"original_title,omitempty"`
+	Year           string            `json:"year,omitempty"`
+	MediaType      string            `json:"media_type,omitempty"`
+	Poster         string            `json:"poster,omitempty"`
+	PosterBlurhash string            `json:"poster_blurhash,omitempty"`
+	PosterColor    string            `json:"poster_color,omitempty"`
+	DoubanID       string            `json:"douban_id,omitempty"`
+	RatingDouban   float64           `json:"rating_douban,omitempty"`
+	Summary        string            `json:"summary,omitempty"`
+	Genres         string            `json:"genres,omitempty"`
+	Countries      string            `json:"countries,omitempty"`
+	Directors      string            `json:"directors,omitempty"`
+	Actors         string            `json:"actors,omitempty"`
+	Duration       string            `json:"duration,omitempty"`
+	ResourceCount  int               `json:"resource_count"`
+	PlaybackState  PlaybackState     `json:"playback_state"`
+	Resources      []UnifiedResource `json:"resources"`
+	BestResource   *UnifiedResource  `json:"best_resource,omitempty"`
+	Score          float64           `json:"score,omitempty"`
+	SearchAliases  []string          `json:"-"`
 }
 
 // UnifiedResource 刻意保持精简。搜索响应只需要稳定资源键和质量摘要；
@@ -68,6 +77,7 @@ type UnifiedResource struct {
 
 // UnifiedResult 是统一搜索的返回值。Unmatched 是没能归到任何媒体的裸资源；
 // 几个 Duration/Fallback 字段用于观测两条支路各自的耗时与降级情况。
+// Mode 是实际生效的检索方式：语义搜索不可用时会退回关键词，并置 SemanticFallback。
 type UnifiedResult struct {
 	Items               []UnifiedItem     `json:"items"`
 	Unmatched           []UnifiedResource `json:"unmatched"`
@@ -77,6 +87,8 @@ type UnifiedResult struct {
 	ResourceUnavailable bool              `json:"resource_unavailable"`
 	CatalogDurationMS   int64             `json:"catalog_duration_ms"`
 	CatalogFallback     bool              `json:"catalog_fallback"`
+	Mode                string            `json:"mode"`
+	SemanticFallback    bool              `json:"semantic_fallback"`
 }
 
 // UnifiedSearcher 是统一搜索接口。
@@ -116,11 +128,17 @@ func WithUnifiedSuggestions(fetcher UnifiedSuggestionFetcher) UnifiedSearchOptio
 	return func(service *UnifiedSearchService) { service.suggestions = fetcher }
 }
 
+// WithSemanticSearch 注入搜索词向量化；媒体库同时实现 SemanticCatalog 时才能按语义检索。
+func WithSemanticSearch(embedder QueryEmbedder) UnifiedSearchOption {
+	return func(service *UnifiedSearchService) { service.embedder = embedder }
+}
+
 // UnifiedSearchService 把「资源站搜索」和「媒体库检索」两条支路的结果合并成一份列表。
 type UnifiedSearchService struct {
 	resources   Searcher
 	catalog     UnifiedCatalog
 	suggestions UnifiedSuggestionFetcher
+	embedder    QueryEmbedder
 }
 
 const (
@@ -139,12 +157,25 @@ func NewUnifiedSearchService(resources Searcher, options ...UnifiedSearchOption)
 
 // SearchUnified 并发跑两条支路：资源站搜索 + 媒体库检索，然后按 media_id 分组合并。
 // 任一支路失败都尽量降级返回另一侧的结果，只有两边都不可用才返回错误。
+// 语义模式只查媒体库的向量索引；向量化失败或没有命中时按关键词模式重跑一遍。
 func (service *UnifiedSearchService) SearchUnified(ctx context.Context, query UnifiedQuery) (UnifiedResult, error) {
 	query.Keyword, query.Year, query.MediaType = strings.TrimSpace(query.Keyword), strings.TrimSpace(query.Year), normalizeMediaType(query.MediaType)
 	if query.Limit <= 0 || query.Limit > 100 {
 		query.Limit = 20
 	}
 	started := time.Now()
+	if query.Mode == SearchModeSemantic {
+		result, err := service.searchSemantic(ctx, query)
+		if err == nil {
+			result.DurationMS = time.Since(started).Milliseconds()
+			return result, nil
+		}
+		slog.Warn("语义搜索不可用，退回关键词搜索", "keyword", query.Keyword, "error", err)
+		query.Mode = SearchModeKeyword
+		result, err = service.SearchUnified(ctx, query)
+		result.SemanticFallback = true
+		return result, err
+	}
 	var (
 		resourceResult                 *Result
 		resourceErr                    error
@@ -188,7 +219,7 @@ func (service *UnifiedSearchService) SearchUnified(ctx context.Context, query Un
 			resourceErr = errors.New("resource search returned no result")
 		}
 		return UnifiedResult{Items: []UnifiedItem{}, Unmatched: []UnifiedResource{}, DurationMS: time.Since(started).Milliseconds(),
-			ResourceDurationMS: resourceDuration, ResourceUnavailable: true}, resourceErr
+			ResourceDurationMS: resourceDuration, ResourceUnavailable: true, Mode: SearchModeKeyword}, resourceErr
 	}
 	service.appendAliasResourceMatches(ctx, query, catalogItems, catalogResources, resourceResult)
 
@@ -227,7 +258,8 @@ func (service *UnifiedSearchService) SearchUnified(ctx context.Context, query Un
 			resourceErr = errors.New("unified search dependencies unavailable")
 		}
 		return UnifiedResult{Items: []UnifiedItem{}, Unmatched: []UnifiedResource{}, DurationMS: time.Since(started).Milliseconds(),
-			ResourceDurationMS: resourceDuration, ResourceUnavailable: true, CatalogDurationMS: catalogDuration, CatalogFallback: catalogFallback}, resourceErr
+			ResourceDurationMS: resourceDuration, ResourceUnavailable: true, CatalogDurationMS: catalogDuration, CatalogFallback: catalogFallback,
+			Mode: SearchModeKeyword}, resourceErr
 	}
 
 	unmatched := make([]UnifiedResource, 0)
@@ -275,7 +307,7 @@ func (service *UnifiedSearchService) SearchUnified(ctx context.Context, query Un
 	}
 	return UnifiedResult{Items: items, Unmatched: unmatched, FilteredCount: resourceResult.FilteredCount,
 		DurationMS: time.Since(started).Milliseconds(), ResourceDurationMS: resourceDuration, ResourceUnavailable: resourceUnavailable,
-		CatalogDurationMS: catalogDuration, CatalogFallback: catalogFallback}, nil
+		CatalogDurationMS: catalogDuration, CatalogFallback: catalogFallback, Mode: SearchModeKeyword}, nil
 }
 
 // RefreshPlayback 用数据库里的最新摘要覆盖缓存中的易变资源字段。
@@ -298,19 +330,26 @@ func (service *UnifiedSearchService) RefreshPlayback(ctx context.Context, result
 		if err != nil {
 			return result, err
 		}
+		// 没有豆瓣 ID 的作品不能按空字符串配对，按 media.id 判断是否已在结果里。
 		byDoubanID := make(map[string]UnifiedItem, len(catalogItems))
 		for _, item := range catalogItems {
-			byDoubanID[item.DoubanID] = item
+			if item.DoubanID != "" {
+				byDoubanID[item.DoubanID] = item
+			}
 		}
+		present := make(map[int]bool, len(items))
 		for index, item := range items {
-			if canonical, found := byDoubanID[item.DoubanID]; found {
+			if canonical, found := byDoubanID[item.DoubanID]; found && item.DoubanID != "" {
 				items[index] = canonical
 				delete(byDoubanID, item.DoubanID)
 			}
+			present[items[index].MediaID] = true
 		}
 		for _, item := range catalogItems {
-			if _, found := byDoubanID[item.DoubanID]; found && len(items) < query.Limit {
+			_, unmatched := byDoubanID[item.DoubanID]
+			if (unmatched || (item.DoubanID == "" && !present[item.MediaID])) && len(items) < query.Limit {
 				items = append(items, item)
+				present[item.MediaID] = true
 			}
 		}
 	}
@@ -466,6 +505,18 @@ func finalizeUnifiedItem(item *UnifiedItem) {
 	}
 }
 
+// DetailKey 返回详情页标识，规则同 catalog.Movie.DetailKey：有豆瓣 ID 用豆瓣 ID，
+// 只有 TMDB 等资料的作品用 m<media.id>，两者都没有（未归一的资源卡）时为空。
+func (item UnifiedItem) DetailKey() string {
+	if item.DoubanID != "" {
+		return item.DoubanID
+	}
+	if item.MediaID > 0 {
+		return "m" + strconv.Itoa(item.MediaID)
+	}
+	return ""
+}
+
 // GenreNames/CountryNames/DirectorNames/ActorNames 为规范影片卡提供精简列表。
 func (item UnifiedItem) GenreNames() []string    { return splitMetadata(item.Genres) }
 func (item UnifiedItem) CountryNames() []string  { return splitMetadata(item.Countries) }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/mediatitle"
@@ -18,14 +19,9 @@ func (store *PostgresStore) SearchUnifiedMedia(ctx context.Context, query Unifie
 	if normalizedKeyword := mediatitle.Normalize(query.Keyword); normalizedKeyword != "" {
 		normalizedPattern = "%" + normalizedKeyword + "%"
 	}
-	rows, err := store.database.Query(ctx, `SELECT media.id, media.title, media.original_title,
-       COALESCE(ARRAY(SELECT alias.alias FROM media_aliases alias
-         WHERE alias.media_id = media.id AND alias.alias_type = 'aka' ORDER BY alias.id), ARRAY[]::text[]), media.year,
-       media.media_type, media.poster, media.douban_id,
-       COALESCE(media.rating_douban, 0), COALESCE(LEFT(media.summary, 120), ''),
-       media.genres, media.countries, media.directors, media.actors, media.duration
+	rows, err := store.database.Query(ctx, `SELECT `+unifiedMediaColumns+`
 FROM media
-WHERE media.douban_id <> '' AND (media.title ILIKE $1 OR media.original_title ILIKE $1 OR EXISTS (
+WHERE media.merged_into_id IS NULL AND (media.title ILIKE $1 OR media.original_title ILIKE $1 OR EXISTS (
     SELECT 1 FROM media_aliases alias
     WHERE alias.media_id = media.id AND $2 <> '' AND alias.normalized_alias LIKE $2
 ))
@@ -40,12 +36,73 @@ LIMIT $6`, pattern, normalizedPattern, strings.TrimSpace(query.Year), normalizeM
 	if err != nil {
 		return nil, fmt.Errorf("search unified media: %w", err)
 	}
+	return scanUnifiedMedia(rows, false)
+}
+
+// SearchSemanticMedia 按与搜索词向量的 L2 距离取最近的一批媒体，走和相似推荐同一个 HNSW 索引（vector_l2_ops）。
+// 向量都是归一化的，余弦相似度可以直接由 L2 距离换算：cos = 1 - L2²/2，排序和打分用的是同一个度量。
+// 年份、类型是在索引扫描之后过滤的，带筛选时在事务里临时调大 hnsw.ef_search，免得筛完召回太少。
+func (store *PostgresStore) SearchSemanticMedia(ctx context.Context, query UnifiedQuery, vector []float32) ([]UnifiedItem, error) {
+	year, mediaType := strings.TrimSpace(query.Year), normalizeMediaType(query.MediaType)
+	if (year == "" && mediaType == "") || store.beginner == nil {
+		return searchSemanticMedia(ctx, store.database, vector, year, mediaType)
+	}
+	transaction, err := store.beginner.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin semantic search: %w", err)
+	}
+	defer transaction.Rollback(context.WithoutCancel(ctx))
+	// SET LOCAL 只在这个事务里生效，放大的扫描范围不会留在连接池的连接上。
+	if _, err := transaction.Exec(ctx, `SET LOCAL hnsw.ef_search = `+strconv.Itoa(semanticFilteredEfSearch)); err != nil {
+		return nil, fmt.Errorf("raise semantic search ef_search: %w", err)
+	}
+	items, err := searchSemanticMedia(ctx, transaction, vector, year, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	if err := transaction.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit semantic search: %w", err)
+	}
+	return items, nil
+}
+
+// searchSemanticMedia 是 SearchSemanticMedia 的查询本身，带筛选时在调过 ef_search 的事务里执行。
+func searchSemanticMedia(ctx context.Context, executor database.Executor, vector []float32, year, mediaType string) ([]UnifiedItem, error) {
+	rows, err := executor.Query(ctx, `WITH target AS (SELECT $1::real[]::vector AS embedding)
+SELECT `+unifiedMediaColumns+`, 1 - power(media.embedding <-> target.embedding, 2) / 2
+FROM media, target
+WHERE media.embedding IS NOT NULL AND media.merged_into_id IS NULL
+  AND ($2 = '' OR media.year = $2)
+  AND ($3 = '' OR media.media_type = $3)
+ORDER BY media.embedding <-> target.embedding
+LIMIT $4`, vector, year, mediaType, semanticCandidateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("search semantic media: %w", err)
+	}
+	return scanUnifiedMedia(rows, true)
+}
+
+// unifiedMediaColumns 是搜索卡片需要的媒体字段，顺序与 scanUnifiedMedia 对应。
+const unifiedMediaColumns = `media.id, media.title, media.original_title,
+       COALESCE(ARRAY(SELECT alias.alias FROM media_aliases alias
+         WHERE alias.media_id = media.id AND alias.alias_type = 'aka' ORDER BY alias.id), ARRAY[]::text[]), media.year,
+       media.media_type, media.poster, media.douban_id,
+       COALESCE(media.rating_douban, 0), COALESCE(LEFT(media.summary, 120), ''),
+       media.genres, media.countries, media.directors, media.actors, media.duration,
+       media.poster_blurhash, media.poster_color`
+
+// scanUnifiedMedia 扫描 unifiedMediaColumns；withScore 时多读末尾一列相似度。
+func scanUnifiedMedia(rows database.Rows, withScore bool) ([]UnifiedItem, error) {
 	defer rows.Close()
 	items := make([]UnifiedItem, 0)
 	for rows.Next() {
 		var item UnifiedItem
-		if err := rows.Scan(&item.MediaID, &item.Title, &item.OriginalTitle, &item.SearchAliases, &item.Year, &item.MediaType, &item.Poster, &item.DoubanID, &item.RatingDouban, &item.Summary,
-			&item.Genres, &item.Countries, &item.Directors, &item.Actors, &item.Duration); err != nil {
+		destinations := []any{&item.MediaID, &item.Title, &item.OriginalTitle, &item.SearchAliases, &item.Year, &item.MediaType, &item.Poster, &item.DoubanID, &item.RatingDouban, &item.Summary,
+			&item.Genres, &item.Countries, &item.Directors, &item.Actors, &item.Duration, &item.PosterBlurhash, &item.PosterColor}
+		if withScore {
+			destinations = append(destinations, &item.Score)
+		}
+		if err := rows.Scan(destinations...); err != nil {
 			return nil, fmt.Errorf("scan unified media: %w", err)
 		}
 		item.Resources = make([]UnifiedResource, 0)
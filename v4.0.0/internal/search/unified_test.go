@@ -191,6 +191,69 @@ func TestRefreshPlaybackReplacesCachedResourceStateFromCatalog(t *testing.T) {
 	}
 }
 
+func TestSemanticSearchBlendsSimilarityKeywordsAndRating(t *testing.T) {
+	resources := &recordingUnifiedResources{result: Result{Items: []VodItem{{SourceKey: "site", VodId: "9", VodName: "无关资源", MediaID: 9}}}}
+	catalog := &semanticUnifiedCatalog{recordingUnifiedCatalog: recordingUnifiedCatalog{
+		resources: []VodItem{{SourceKey: "stored", VodId: "1", VodName: "盗梦空间", MediaID: 2, SampleCount: 5, AvgSpeedMs: 90, PlaybackState: PlaybackReady}},
+	}, semantic: []UnifiedItem{
+		{MediaID: 1, Title: "记忆碎片", Score: 0.80, RatingDouban: 8.6},
+		{MediaID: 2, Title: "盗梦空间", Summary: "诺兰执导的梦境题材", Score: 0.78, RatingDouban: 9.4},
+		{MediaID: 3, Title: "低分奇幻片", Score: 0.79, RatingDouban: 3.0},
+	}}
+	embedder := &queryEmbedderStub{vector: []float32{0.1, 0.2}}
+	service := NewUnifiedSearchService(resources, WithUnifiedCatalog(catalog), WithSemanticSearch(embedder))
+	result, err := service.SearchUnified(t.Context(), UnifiedQuery{Keyword: " 诺兰 梦境 ", Limit: 2, Mode: SearchModeSemantic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embedder.text != "诺兰 梦境" || len(catalog.vector) != 2 || resources.keyword != "" {
+		t.Fatalf("embedded %q vector=%v resource search=%q", embedder.text, catalog.vector, resources.keyword)
+	}
+	// 相似度最高的不一定排第一：关键词全中的盗梦空间靠关键词分反超，低分片被评分压下去。
+	if result.Mode != SearchModeSemantic || len(result.Items) != 2 || result.Items[0].MediaID != 2 || result.Items[1].MediaID != 1 {
+		t.Fatalf("semantic result = %+v", result)
+	}
+	if result.Items[0].ResourceCount != 1 || result.Items[0].PlaybackState != PlaybackReady || len(result.Unmatched) != 0 || result.Items[0].Score <= result.Items[1].Score {
+		t.Fatalf("semantic item = %+v", result.Items[0])
+	}
+}
+
+func TestSemanticSearchFallsBackToKeywordsWhenEmbeddingFails(t *testing.T) {
+	resources := &recordingUnifiedResources{result: Result{Items: []VodItem{{SourceKey: "site", VodId: "1", VodName: "影片", MediaID: 7, PlaybackState: PlaybackDirect}}}}
+	catalog := &semanticUnifiedCatalog{}
+	embedder := &queryEmbedderStub{err: errors.New("embedding generation is not active")}
+	service := NewUnifiedSearchService(resources, WithUnifiedCatalog(catalog), WithSemanticSearch(embedder))
+	result, err := service.SearchUnified(t.Context(), UnifiedQuery{Keyword: "影片", Limit: 20, Mode: SearchModeSemantic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mode != SearchModeKeyword || !result.SemanticFallback || resources.keyword != "影片" || len(result.Items) != 1 || catalog.vector != nil {
+		t.Fatalf("fallback result = %+v", result)
+	}
+}
+
+type semanticUnifiedCatalog struct {
+	recordingUnifiedCatalog
+	semantic []UnifiedItem
+	vector   []float32
+}
+
+func (catalog *semanticUnifiedCatalog) SearchSemanticMedia(_ context.Context, _ UnifiedQuery, vector []float32) ([]UnifiedItem, error) {
+	catalog.vector = vector
+	return append([]UnifiedItem(nil), catalog.semantic...), nil
+}
+
+type queryEmbedderStub struct {
+	vector []float32
+	err    error
+	text   string
+}
+
+func (stub *queryEmbedderStub) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	stub.text = text
+	return stub.vector, stub.err
+}
+
 type recordingUnifiedResources struct {
 	result  Result
 	keyword string
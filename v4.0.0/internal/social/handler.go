@@ -21,9 +21,11 @@ const (
 
 // Handler 提供片场页面和短评互动接口。
 type Handler struct {
-	config config.Config
-	store  Store
-	now    func() time.Time
+	config   config.Config
+	store    Store
+	now      func() time.Time
+	notifier Notifier
+	comments CommentFinder
 }
 
 // NewHandler 创建片场处理器。
@@ -123,6 +125,9 @@ func (handler *Handler) toggleLike(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "")
 		return
 	}
+	if liked {
+		handler.notifyLiked(c.Request.Context(), userMovieID, userID)
+	}
 	c.HTML(http.StatusOK, "partials/comment_like_button.html", gin.H{"UserMovieID": userMovieID, "LikeCount": count, "Liked": liked})
 }
 
@@ -161,6 +166,7 @@ func (handler *Handler) createReply(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "回复失败")
 		return
 	}
+	handler.notifyReplied(c.Request.Context(), userMovieID, userID, content)
 	handler.renderReplies(c, userMovieID, userID)
 }
 
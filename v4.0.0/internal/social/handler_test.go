@@ -1,6 +1,7 @@
 package social
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/TwoThreeWang/Moovie/new/internal/identity"
 	"github.com/TwoThreeWang/Moovie/new/internal/library"
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/auth"
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/config"
 	platformweb "github.com/TwoThreeWang/Moovie/new/internal/platform/web"
@@ -66,6 +68,52 @@ func TestCommentsLikesAndRepliesPreserveLegacyHTMXBehavior(t *testing.T) {
 	}
 }
 
+func TestLikesAndRepliesNotifyCommentOwnerButNotThemselves(t *testing.T) {
+	router, users, movies, store, publicUser, token := socialTestRouter(t)
+	now := time.Now()
+	author, _ := users.Create(t.Context(), identity.User{Email: "author@example.com", Username: "作者", Role: "user", CreatedAt: now})
+	_ = movies.Upsert(t.Context(), library.Record{UserID: author.ID, MovieID: "1292052", Title: "肖申克的救赎", Status: library.StatusWatched, Comment: "希望是美好的事物", CreatedAt: now, UpdatedAt: now})
+	_ = movies.Upsert(t.Context(), library.Record{UserID: publicUser.ID, MovieID: "1292052", Title: "肖申克的救赎", Status: library.StatusWatched, Comment: "自己的短评", CreatedAt: now, UpdatedAt: now})
+	authored, _ := movies.GetByUserAndMovie(t.Context(), author.ID, "1292052")
+	own, _ := movies.GetByUserAndMovie(t.Context(), publicUser.ID, "1292052")
+	notifier := &notifierStub{}
+	router = gin.New()
+	router.HTMLRender, _ = platformweb.LoadRenderer(filepath.Join("..", "..", "web", "templates"), nil)
+	NewHandler(config.Config{AppSecret: "secret"}, store).WithNotifier(notifier, store).Register(router)
+
+	// 赞、取消、再赞：取消不通知，两次点赞带同一个去重键，收件箱里只会留一条。
+	for range 3 {
+		performRequest(router, http.MethodPost, "/api/comments/"+itoa(authored.ID)+"/like", "", token)
+	}
+	performRequest(router, http.MethodPost, "/api/comments/"+itoa(authored.ID)+"/replies", "content=同感", token)
+	performRequest(router, http.MethodPost, "/api/comments/"+itoa(own.ID)+"/like", "", token)
+	performRequest(router, http.MethodPost, "/api/comments/"+itoa(own.ID)+"/replies", "content=自言自语", token)
+
+	if len(notifier.sent) != 3 {
+		t.Fatalf("notifications = %+v", notifier.sent)
+	}
+	like, reply := notifier.sent[0], notifier.sent[2]
+	if notifier.users[0] != author.ID || like.Kind != notifications.KindCommentLike || like.Title != "公开用户 赞了你对《肖申克的救赎》的短评" ||
+		like.DedupeKey != itoa(authored.ID)+":"+itoa(publicUser.ID) || like.Link != "/movie/1292052" || like.Body != "希望是美好的事物" {
+		t.Fatalf("like notification = %+v", like)
+	}
+	if reply.Kind != notifications.KindCommentReply || reply.Body != "同感" || reply.DedupeKey != "" {
+		t.Fatalf("reply notification = %+v", reply)
+	}
+}
+
+// notifierStub 记下发出的通知和接收人。
+type notifierStub struct {
+	users []int
+	sent  []notifications.Notification
+}
+
+func (stub *notifierStub) NotifyUser(_ context.Context, userID int, notification notifications.Notification) error {
+	stub.users = append(stub.users, userID)
+	stub.sent = append(stub.sent, notification)
+	return nil
+}
+
 func TestCinemaBuildsProgramCommentsAndFilmFriendRadar(t *testing.T) {
 	router, users, movies, _, publicUser, token := socialTestRouter(t)
 	now := time.Now()
@@ -0,0 +1,84 @@
+package social
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/TwoThreeWang/Moovie/new/internal/notifications"
+)
+
+// commentExcerptLength 是通知正文里引用短评或回复的最大字数。
+const commentExcerptLength = 60
+
+// CommentInteraction 是一次点赞或回复要通知的内容：短评作者、片子、短评原文和互动者的名字。
+type CommentInteraction struct {
+	OwnerID   int
+	MovieID   string
+	Title     string
+	Comment   string
+	ActorName string
+}
+
+// Notifier 是站内通知的写入能力，由 notifications.Service 实现。
+type Notifier interface {
+	NotifyUser(ctx context.Context, userID int, notification notifications.Notification) error
+}
+
+// CommentFinder 查被互动的短评和互动者，由 PostgresStore 实现。短评不存在时返回 nil。
+type CommentFinder interface {
+	FindCommentInteraction(ctx context.Context, userMovieID, actorID int) (*CommentInteraction, error)
+}
+
+// WithNotifier 让点赞和回复给短评作者发通知。不注入时互动照常进行，只是不通知。
+func (handler *Handler) WithNotifier(notifier Notifier, comments CommentFinder) *Handler {
+	handler.notifier, handler.comments = notifier, comments
+	return handler
+}
+
+// notifyLiked 告诉作者短评被赞了。同一个人取消再点只提醒一次。
+func (handler *Handler) notifyLiked(ctx context.Context, userMovieID, actorID int) {
+	handler.notifyOwner(ctx, userMovieID, actorID, func(interaction CommentInteraction) notifications.Notification {
+		return notifications.Notification{Kind: notifications.KindCommentLike,
+			Title: interaction.ActorName + " 赞了你对《" + interaction.Title + "》的短评",
+			Body:  excerpt(interaction.Comment), Link: "/movie/" + interaction.MovieID,
+			DedupeKey: strconv.Itoa(userMovieID) + ":" + strconv.Itoa(actorID)}
+	})
+}
+
+// notifyReplied 告诉作者短评有了新回复。
+func (handler *Handler) notifyReplied(ctx context.Context, userMovieID, actorID int, content string) {
+	handler.notifyOwner(ctx, userMovieID, actorID, func(interaction CommentInteraction) notifications.Notification {
+		return notifications.Notification{Kind: notifications.KindCommentReply,
+			Title: interaction.ActorName + " 回复了你对《" + interaction.Title + "》的短评",
+			Body:  excerpt(content), Link: "/movie/" + interaction.MovieID}
+	})
+}
+
+// notifyOwner 是两种通知的公共部分：查短评、跳过自己给自己的互动、发送。
+// 通知是互动的附带效果，任何失败只记日志，不影响已经成功的点赞或回复。
+func (handler *Handler) notifyOwner(ctx context.Context, userMovieID, actorID int, build func(CommentInteraction) notifications.Notification) {
+	if handler.notifier == nil || handler.comments == nil {
+		return
+	}
+	interaction, err := handler.comments.FindCommentInteraction(ctx, userMovieID, actorID)
+	if err != nil {
+		slog.Warn("find comment for notification", "user_movie_id", userMovieID, "error", err)
+		return
+	}
+	if interaction == nil || interaction.OwnerID == actorID {
+		return
+	}
+	if err := handler.notifier.NotifyUser(ctx, interaction.OwnerID, build(*interaction)); err != nil {
+		slog.Warn("notify comment owner", "user_movie_id", userMovieID, "error", err)
+	}
+}
+
+// excerpt 截取前若干个字，超出部分用省略号。
+func excerpt(text string) string {
+	characters := []rune(text)
+	if len(characters) <= commentExcerptLength {
+		return text
+	}
+	return string(characters[:commentExcerptLength]) + "…"
+}
@@ -2,10 +2,12 @@ package social
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/TwoThreeWang/Moovie/new/internal/platform/database"
+	"github.com/jackc/pgx/v5"
 )
 
 // PostgresStore 是片场的 PostgreSQL 实现。
@@ -153,6 +155,23 @@ VALUES ($1,$2,$3) RETURNING id, created_at`, userMovieID, userID, content).Scan(
 	return reply, nil
 }
 
+// FindCommentInteraction 查短评的作者、片名和原文，以及互动者的用户名。短评不存在时返回 nil。
+func (store *PostgresStore) FindCommentInteraction(ctx context.Context, userMovieID, actorID int) (*CommentInteraction, error) {
+	var interaction CommentInteraction
+	err := store.database.QueryRow(ctx, `SELECT um.user_id, um.movie_id, COALESCE(NULLIF(media.title, ''), um.title), COALESCE(um.comment, ''),
+COALESCE((SELECT username FROM users WHERE id = $2), '')
+FROM user_movies um LEFT JOIN media ON media.id = um.media_id
+WHERE um.id = $1`, userMovieID, actorID).Scan(&interaction.OwnerID, &interaction.MovieID, &interaction.Title,
+		&interaction.Comment, &interaction.ActorName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find comment interaction: %w", err)
+	}
+	return &interaction, nil
+}
+
 // ListWeeklyFilms 统计本周被标记最多的影片。
 func (store *PostgresStore) ListWeeklyFilms(ctx context.Context, since time.Time, limit int) ([]WeeklyFilm, error) {
 	rows, err := store.database.Query(ctx, `SELECT um.movie_id,
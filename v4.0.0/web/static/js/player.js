@@ -86,6 +86,33 @@ function createPlaybackAttemptId() {
     return 'attempt-' + Date.now().toString(36) + '-' + Math.random().toString(36).slice(2);
 }
 
+// 客户端能力画像：服务端按设备类别分别统计播放质量并排序线路（internal/playback/profile.go）。
+// 写进 Cookie 后，候选接口和下次打开的播放页都能按这台设备排序，不必每个请求都带参数。
+var CLIENT_PROFILE = null;
+function clientProfile() {
+    if (CLIENT_PROFILE) return CLIENT_PROFILE;
+    var video = document.createElement('video');
+    var usesMSE = typeof Hls !== 'undefined' && (Hls.isSupported() || isIOS());
+    var mediaSource = window.ManagedMediaSource || window.MediaSource;
+    var hevcType = 'video/mp4; codecs="hvc1.1.6.L93.B0"';
+    var codecs = ['h264'];
+    if ((mediaSource && mediaSource.isTypeSupported && mediaSource.isTypeSupported(hevcType)) || video.canPlayType(hevcType)) {
+        codecs.push('hevc');
+    }
+    CLIENT_PROFILE = {
+        platform: isIOS() ? 'ios' : (/Android/i.test(navigator.userAgent) ? 'android' : 'desktop'),
+        native_hls: !usesMSE && !!video.canPlayType('application/vnd.apple.mpegurl'),
+        codecs: codecs,
+        https_only: location.protocol === 'https:'
+    };
+    var params = new URLSearchParams({platform: CLIENT_PROFILE.platform, codecs: codecs.join(',')});
+    if (CLIENT_PROFILE.native_hls) params.set('native_hls', '1');
+    if (CLIENT_PROFILE.https_only) params.set('https_only', '1');
+    document.cookie = 'moovie_client=' + params.toString() + '; path=/; max-age=2592000; SameSite=Lax';
+    return CLIENT_PROFILE;
+}
+document.addEventListener('DOMContentLoaded', clientProfile);
+
 function reportPlaybackEvent(eventType, elapsedMs, reason, context) {
     if (!context || !context.attempt_id || !context.candidate_id || !context.media_unit_id) return;
     fetch('/api/v2/playback/events', {
@@ -102,7 +129,8 @@ function reportPlaybackEvent(eventType, elapsedMs, reason, context) {
             source_key: context.sourceKey,
             vod_id: context.vodId,
             elapsed_ms: Math.max(0, Math.round(elapsedMs || 0)),
-            reason: reason || ''
+            reason: reason || '',
+            client: clientProfile()
         })
     }).catch(function() {});
 }
@@ -476,6 +504,166 @@ function createAutoPlayManager(options) {
     };
 }
 
+// 按季集 ID 自动连播：/watch 页没有完整的选集播放地址，触发时再向服务端询问下一集（可跨季）。
+// 下一集还没有可播资源或没有 /watch 地址时静默不弹倒计时。
+function createNextUnitAutoPlay(art, options) {
+    var manager = null;
+    var loading = null;
+
+    function load() {
+        if (loading) return loading;
+        var params = '?position=' + encodeURIComponent(art.currentTime || 0) +
+            '&duration=' + encodeURIComponent(art.duration || 0);
+        loading = fetch('/api/v2/media-units/' + encodeURIComponent(options.media_unit_id) + '/next' + params, {
+            credentials: 'same-origin'
+        }).then(function(res) {
+            return res.ok ? res.json() : null;
+        }).then(function(data) {
+            var next = data && data.next;
+            if (!next || !next.candidate || !next.watch_url) return null;
+            var current = options.episode || options.episode_key || '';
+            var nextTitle = next.episode_label + (next.title ? ' ' + next.title : '');
+            manager = createAutoPlayManager({
+                episode: current,
+                episodes: [{ title: current, url: '' }, { title: nextTitle, url: next.watch_url }]
+            });
+            return manager;
+        }).catch(function() {
+            loading = null;
+            return null;
+        });
+        return loading;
+    }
+
+    return {
+        trigger: function() {
+            load().then(function(loaded) { if (loaded) loaded.trigger(); });
+        },
+        cancel: function() { if (manager) manager.cancel(); },
+        destroy: function() { if (manager) manager.destroy(); }
+    };
+}
+
+// 片头片尾管理器：从播放候选接口读取众包共识区间。
+// 片头期间显示「跳过片头」按钮；播到片尾起点时提前弹出下一集倒计时；
+// 登录用户可以在设置面板里标记区间，两次点击分别记录起点和终点。
+function createSkipMarkerManager(art, options, autoPlayState) {
+    if (!options.media_unit_id) return null;
+    var markers = {};
+    var skipButton = null;
+    var outroTriggered = false;
+    var pendingStarts = {};
+
+    var endpoint = '/api/v2/media-units/' + encodeURIComponent(options.media_unit_id) + '/playback-candidates';
+    fetch(endpoint, { credentials: 'same-origin' })
+        .then(function(res) { return res.ok ? res.json() : null; })
+        .then(function(data) { applyMarkers(data && data.skip_markers); })
+        .catch(function() {});
+
+    function applyMarkers(list) {
+        markers = {};
+        (list || []).forEach(function(marker) {
+            if (marker && marker.end_ms > marker.start_ms) markers[marker.type] = marker;
+        });
+    }
+
+    function getSkipButton() {
+        if (skipButton) return skipButton;
+        var container = document.getElementById('artplayer-app');
+        if (!container) return null;
+        if (getComputedStyle(container).position === 'static') {
+            container.style.position = 'relative';
+        }
+        skipButton = document.createElement('button');
+        skipButton.type = 'button';
+        skipButton.className = 'skip-intro-btn';
+        skipButton.textContent = '跳过片头';
+        skipButton.addEventListener('click', function(e) {
+            e.stopPropagation();
+            if (markers.intro) art.currentTime = markers.intro.end_ms / 1000;
+            hideSkipButton();
+        });
+        container.appendChild(skipButton);
+        return skipButton;
+    }
+
+    function hideSkipButton() {
+        if (skipButton) skipButton.style.display = 'none';
+    }
+
+    function onTimeUpdate(seconds) {
+        var ms = seconds * 1000;
+        var intro = markers.intro;
+        if (intro && ms >= intro.start_ms && ms < intro.end_ms - 1000) {
+            var button = getSkipButton();
+            if (button) button.style.display = '';
+        } else {
+            hideSkipButton();
+        }
+        var outro = markers.outro;
+        if (outro && autoPlayState && !outroTriggered && ms >= outro.start_ms && ms < outro.end_ms) {
+            outroTriggered = true;
+            autoPlayState.trigger();
+        }
+        if (outro && ms < outro.start_ms) {
+            outroTriggered = false;
+        }
+    }
+
+    function submitMarker(type, startMs, endMs) {
+        fetch('/api/v2/media-units/' + encodeURIComponent(options.media_unit_id) + '/skip-markers', {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ type: type, start_ms: startMs, end_ms: endMs })
+        }).then(function(res) {
+            if (!res.ok) throw new Error('status ' + res.status);
+            return res.json();
+        }).then(function(data) {
+            applyMarkers(data && data.skip_markers);
+            art.notice.show = '感谢标记，达到足够人数后会对所有人生效';
+        }).catch(function() {
+            art.notice.show = '标记保存失败，请稍后重试';
+        });
+    }
+
+    function markSetting(type, label) {
+        return {
+            html: '标记' + label,
+            tooltip: '记录起点',
+            onClick: function(item) {
+                var nowMs = Math.floor(art.currentTime * 1000);
+                if (pendingStarts[type] === undefined) {
+                    pendingStarts[type] = nowMs;
+                    art.notice.show = '已记录' + label + '起点 ' + formatTime(art.currentTime) + '，播到' + label + '结束时再点一次';
+                    return '记录终点';
+                }
+                var startMs = pendingStarts[type];
+                delete pendingStarts[type];
+                if (nowMs <= startMs) {
+                    art.notice.show = label + '终点必须晚于起点，请重新标记';
+                    return '记录起点';
+                }
+                submitMarker(type, startMs, nowMs);
+                return '记录起点';
+            }
+        };
+    }
+
+    if (options.canMarkSkip && art.setting && typeof art.setting.add === 'function') {
+        art.setting.add(markSetting('intro', '片头'));
+        art.setting.add(markSetting('outro', '片尾'));
+    }
+
+    return {
+        onTimeUpdate: onTimeUpdate,
+        destroy: function() {
+            if (skipButton && skipButton.parentNode) skipButton.parentNode.removeChild(skipButton);
+            skipButton = null;
+        }
+    };
+}
+
 // 构建弹幕插件配置
 // 依赖 artplayer-plugin-danmuku，未加载时静默跳过（弹幕永远不能影响正片播放）
 var DANMAKU_VISIBLE_KEY = 'moovie_danmaku_visible';
@@ -807,6 +995,10 @@ function initPlayer(containerId, url, options) {
 
     try {
         var art = new Artplayer(config);
+        if (!autoPlayState && options.media_unit_id && options.entryPage === 'watch') {
+            autoPlayState = createNextUnitAutoPlay(art, options);
+        }
+        var skipMarkerState = createSkipMarkerManager(art, options, autoPlayState);
         currentArt = art;
 
         if (danmakuPlugin) {
@@ -894,6 +1086,9 @@ function initPlayer(containerId, url, options) {
                 effectivePlaybackMs += Math.min(playbackNow - lastPlaybackTick, 2000);
             }
             lastPlaybackTick = playbackNow;
+            if (skipMarkerState) {
+                skipMarkerState.onTimeUpdate(art.currentTime);
+            }
             if (effectivePlaybackMs >= 10000 && !options._played_10s_reported) {
                 options._played_10s_reported = true;
                 reportPlaybackEvent('played_10s', effectivePlaybackMs, '', options);
@@ -959,6 +1154,9 @@ function initPlayer(containerId, url, options) {
             if (autoPlayState) {
                 autoPlayState.destroy();
             }
+            if (skipMarkerState) {
+                skipMarkerState.destroy();
+            }
             if (currentArt === art) {
                 currentArt = null;
             }